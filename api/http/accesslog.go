@@ -0,0 +1,182 @@
+// Copyright 2017 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/pkg/errors"
+)
+
+// Fields of the access log entries
+const (
+	AccessLogFieldTime       = "time"
+	AccessLogFieldMethod     = "method"
+	AccessLogFieldPath       = "path"
+	AccessLogFieldStatus     = "status"
+	AccessLogFieldLatency    = "latency_ms"
+	AccessLogFieldBytes      = "bytes"
+	AccessLogFieldSubject    = "subject"
+	AccessLogFieldTenant     = "tenant_id"
+	AccessLogFieldRequestID  = "request_id"
+	AccessLogFieldRemoteAddr = "remote_addr"
+	AccessLogFieldUserAgent  = "user_agent"
+)
+
+var (
+	AccessLogFields = []string{
+		AccessLogFieldTime,
+		AccessLogFieldMethod,
+		AccessLogFieldPath,
+		AccessLogFieldStatus,
+		AccessLogFieldLatency,
+		AccessLogFieldBytes,
+		AccessLogFieldSubject,
+		AccessLogFieldTenant,
+		AccessLogFieldRequestID,
+		AccessLogFieldRemoteAddr,
+		AccessLogFieldUserAgent,
+	}
+
+	DefaultAccessLogFields = []string{
+		AccessLogFieldTime,
+		AccessLogFieldMethod,
+		AccessLogFieldPath,
+		AccessLogFieldStatus,
+		AccessLogFieldLatency,
+		AccessLogFieldSubject,
+		AccessLogFieldTenant,
+		AccessLogFieldRequestID,
+	}
+)
+
+// AccessLogMiddleware logs the requests as JSON lines with the selected
+// fields. The successful verification requests, which most of the traffic
+// is made of, can be sampled; failed requests are always logged.
+// rest.RecorderMiddleware has to run after it.
+type AccessLogMiddleware struct {
+	fields           []string
+	verifySampleRate float64
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewAccessLogMiddleware sets up the access log written to w, with the
+// fraction verifySampleRate, in [0, 1], of the successful verification
+// requests logged
+func NewAccessLogMiddleware(w io.Writer, fields []string,
+	verifySampleRate float64) (*AccessLogMiddleware, error) {
+
+	for _, f := range fields {
+		if !isAccessLogField(f) {
+			return nil, errors.Errorf("unknown access log field %q", f)
+		}
+	}
+	if verifySampleRate < 0 || verifySampleRate > 1 {
+		return nil, errors.Errorf("access log sample rate %v out of [0, 1]",
+			verifySampleRate)
+	}
+
+	return &AccessLogMiddleware{
+		fields:           fields,
+		verifySampleRate: verifySampleRate,
+		w:                w,
+	}, nil
+}
+
+func isAccessLogField(field string) bool {
+	for _, f := range AccessLogFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (mw *AccessLogMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		start := time.Now()
+
+		h(w, r)
+
+		status, _ := r.Env["STATUS_CODE"].(int)
+		if !mw.sampled(r, status) {
+			return
+		}
+
+		entry := make(map[string]interface{}, len(mw.fields))
+		for _, f := range mw.fields {
+			if v := accessLogValue(f, r, start, status); v != nil {
+				entry[f] = v
+			}
+		}
+
+		mw.mu.Lock()
+		defer mw.mu.Unlock()
+		// failing to log is no reason to fail the request
+		_ = json.NewEncoder(mw.w).Encode(entry)
+	}
+}
+
+func (mw *AccessLogMiddleware) sampled(r *rest.Request, status int) bool {
+	if status >= http.StatusBadRequest || !IsVerificationEndpoint(r) {
+		return true
+	}
+	return mw.verifySampleRate >= 1 || rand.Float64() < mw.verifySampleRate
+}
+
+// accessLogValue returns the value of the field, nil if it's unknown
+func accessLogValue(field string, r *rest.Request, start time.Time, status int) interface{} {
+	switch field {
+	case AccessLogFieldTime:
+		return start.UTC().Format(time.RFC3339Nano)
+	case AccessLogFieldMethod:
+		return r.Method
+	case AccessLogFieldPath:
+		return r.URL.Path
+	case AccessLogFieldStatus:
+		return status
+	case AccessLogFieldLatency:
+		return float64(time.Since(start)) / float64(time.Millisecond)
+	case AccessLogFieldBytes:
+		bytes, _ := r.Env["BYTES_WRITTEN"].(int64)
+		return bytes
+	case AccessLogFieldSubject:
+		if id := identity.FromContext(r.Context()); id != nil {
+			return id.Subject
+		}
+	case AccessLogFieldTenant:
+		if id := identity.FromContext(r.Context()); id != nil && id.Tenant != "" {
+			return id.Tenant
+		}
+	case AccessLogFieldRequestID:
+		if reqId := requestid.GetReqId(r); reqId != "" {
+			return reqId
+		}
+	case AccessLogFieldRemoteAddr:
+		return r.RemoteAddr
+	case AccessLogFieldUserAgent:
+		return r.UserAgent()
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewAccessLogMiddleware(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewAccessLogMiddleware(&bytes.Buffer{}, AccessLogFields, 0.5)
+	assert.NoError(t, err)
+
+	_, err = NewAccessLogMiddleware(&bytes.Buffer{}, []string{"method", "foo"}, 1)
+	assert.EqualError(t, err, `unknown access log field "foo"`)
+
+	_, err = NewAccessLogMiddleware(&bytes.Buffer{}, DefaultAccessLogFields, 1.5)
+	assert.EqualError(t, err, "access log sample rate 1.5 out of [0, 1]")
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		method     string
+		path       string
+		status     int
+		sampleRate float64
+
+		logged bool
+	}{
+		"logged": {
+			method:     http.MethodGet,
+			path:       "/api/management/v1/useradm/users",
+			status:     http.StatusOK,
+			sampleRate: 0,
+			logged:     true,
+		},
+		"verification, sampled out": {
+			method:     http.MethodPost,
+			path:       uriInternalAuthVerify,
+			status:     http.StatusOK,
+			sampleRate: 0,
+		},
+		"verification, sampled": {
+			method:     http.MethodPost,
+			path:       uriInternalAuthVerify,
+			status:     http.StatusOK,
+			sampleRate: 1,
+			logged:     true,
+		},
+		"verification, failed": {
+			method:     http.MethodPost,
+			path:       uriInternalAuthVerify,
+			status:     http.StatusUnauthorized,
+			sampleRate: 0,
+			logged:     true,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			mw, err := NewAccessLogMiddleware(&out, DefaultAccessLogFields, tc.sampleRate)
+			assert.NoError(t, err)
+
+			api := rest.NewApi()
+			api.Use(&RequestIdMiddleware{}, mw, &rest.RecorderMiddleware{})
+			api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+				r.Request = r.WithContext(identity.WithContext(r.Context(),
+					&identity.Identity{Subject: "user-1", Tenant: "tenant-1"}))
+				w.WriteHeader(tc.status)
+			}))
+
+			req, _ := http.NewRequest(tc.method, "http://1.2.3.4"+tc.path, nil)
+			req.Header.Set(RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api.MakeHandler(), req)
+			recorded.CodeIs(tc.status)
+
+			if !tc.logged {
+				assert.Empty(t, out.String())
+				return
+			}
+
+			var entry map[string]interface{}
+			assert.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+			assert.Len(t, entry, len(DefaultAccessLogFields))
+			assert.Equal(t, tc.method, entry[AccessLogFieldMethod])
+			assert.Equal(t, tc.path, entry[AccessLogFieldPath])
+			assert.Equal(t, float64(tc.status), entry[AccessLogFieldStatus])
+			assert.Contains(t, entry, AccessLogFieldLatency)
+			assert.Contains(t, entry, AccessLogFieldTime)
+			assert.Equal(t, "user-1", entry[AccessLogFieldSubject])
+			assert.Equal(t, "tenant-1", entry[AccessLogFieldTenant])
+			assert.Equal(t, "test", entry[AccessLogFieldRequestID])
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+// error codes of the device token endpoint, see RFC 8628 3.5
+const (
+	oauthErrAuthorizationPending = "authorization_pending"
+	oauthErrSlowDown             = "slow_down"
+	oauthErrExpiredToken         = "expired_token"
+)
+
+// DeviceCodeHandler is the device authorization endpoint, starting the
+// login of e.g. the mender-cli, see RFC 8628 3.1
+func (u *UserAdmApiHandlers) DeviceCodeHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := r.ParseForm(); err != nil {
+		oauthErr(w, http.StatusBadRequest, oauthErrInvalidRequest,
+			"malformed request body")
+		return
+	}
+
+	rsp, err := u.userAdm.StartDeviceAuthorization(ctx,
+		r.PostForm.Get("client_id"), r.PostForm.Get("scope"))
+	if err != nil {
+		if _, ok := errors.Cause(err).(*model.FieldError); ok {
+			oauthErr(w, http.StatusBadRequest, oauthErrInvalidRequest, err.Error())
+			return
+		}
+		tokenErr(w, l, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteJson(rsp)
+}
+
+// DeviceTokenHandler is the token endpoint the devices poll until the
+// user approves or denies the login, see RFC 8628 3.4
+func (u *UserAdmApiHandlers) DeviceTokenHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := r.ParseForm(); err != nil {
+		oauthErr(w, http.StatusBadRequest, oauthErrInvalidRequest,
+			"malformed request body")
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != model.GrantTypeDeviceCode {
+		oauthErr(w, http.StatusBadRequest, oauthErrUnsupportedGrantType,
+			"only the "+model.GrantTypeDeviceCode+" grant is supported")
+		return
+	}
+
+	token, err := u.userAdm.IssueDeviceToken(ctx,
+		r.PostForm.Get("client_id"), r.PostForm.Get("device_code"))
+	if err != nil {
+		tokenErr(w, l, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteJson(token)
+}
+
+// GetDeviceAuthorizationHandler returns the login the user is about to
+// approve, for the verification page to show
+func (u *UserAdmApiHandlers) GetDeviceAuthorizationHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	userCode := r.URL.Query().Get("user_code")
+	if !model.IsUserCode(userCode) {
+		restErr(w, r, l, model.ErrInvalidUserCode, http.StatusBadRequest)
+		return
+	}
+
+	info, err := u.userAdm.GetDeviceAuthorization(ctx, userCode)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(info)
+}
+
+func (u *UserAdmApiHandlers) VerifyDeviceAuthorizationHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	v := model.DeviceVerification{}
+	if err := decodeJsonStrict(r, &v); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := v.Validate(); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := u.userAdm.VerifyDeviceAuthorization(ctx, v); err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,396 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	useradm "github.com/mendersoftware/useradm/user"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
+)
+
+func makeFormReq(t *testing.T, path string, form url.Values) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, "http://1.2.3.4"+path,
+		strings.NewReader(form.Encode()))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add(requestid.RequestIdHeader, "test")
+	return req
+}
+
+func TestUserAdmApiDeviceCode(t *testing.T) {
+	t.Parallel()
+
+	rsp := &model.DeviceAuthorizationResponse{
+		DeviceCode:              "device-code",
+		UserCode:                "BCDF-GHJK",
+		VerificationURI:         "https://mender.example.com/ui/device",
+		VerificationURIComplete: "https://mender.example.com/ui/device?user_code=BCDF-GHJK",
+		ExpiresIn:               600,
+		Interval:                5,
+	}
+
+	testCases := map[string]struct {
+		uaRsp *model.DeviceAuthorizationResponse
+		uaErr error
+
+		status int
+		body   interface{}
+	}{
+		"ok": {
+			uaRsp: rsp,
+
+			status: http.StatusOK,
+			body:   rsp,
+		},
+		"error: no client id": {
+			uaErr: model.ErrInvalidDeviceClientID,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       oauthErrInvalidRequest,
+				Description: model.ErrInvalidDeviceClientID.Error(),
+			},
+		},
+		"error: invalid scope": {
+			uaErr: useradm.ErrInvalidScope,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       oauthErrInvalidScope,
+				Description: useradm.ErrInvalidScope.Error(),
+			},
+		},
+		"error: disabled": {
+			uaErr: useradm.ErrDeviceFlowDisabled,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       oauthErrUnsupportedGrantType,
+				Description: useradm.ErrDeviceFlowDisabled.Error(),
+			},
+		},
+		"error: internal": {
+			uaErr: errors.New("db connection failed"),
+
+			status: http.StatusInternalServerError,
+			body:   OAuthError{Error: oauthErrServerError},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("StartDeviceAuthorization", mtesting.ContextMatcher(),
+				"mender-cli", "mender.users:read").Return(tc.uaRsp, tc.uaErr)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeFormReq(t, "/api/management/v1/useradm/auth/device/code",
+				url.Values{
+					"client_id": {"mender-cli"},
+					"scope":     {"mender.users:read"},
+				})
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, mt.NewJSONResponse(tc.status, nil, tc.body), recorded)
+			assert.Equal(t, "no-store", recorded.Recorder.HeaderMap.Get("Cache-Control"))
+		})
+	}
+}
+
+func TestUserAdmApiDeviceToken(t *testing.T) {
+	t.Parallel()
+
+	token := &model.AccessToken{
+		AccessToken: "token",
+		TokenType:   model.TokenTypeBearer,
+		ExpiresIn:   3600,
+		Scope:       "mender.*",
+	}
+
+	testCases := map[string]struct {
+		grantType string
+
+		uaToken *model.AccessToken
+		uaErr   error
+
+		status int
+		body   interface{}
+	}{
+		"ok": {
+			grantType: model.GrantTypeDeviceCode,
+			uaToken:   token,
+
+			status: http.StatusOK,
+			body:   token,
+		},
+		"error: other grant": {
+			grantType: model.GrantTypeClientCredentials,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       oauthErrUnsupportedGrantType,
+				Description: "only the " + model.GrantTypeDeviceCode + " grant is supported",
+			},
+		},
+		"error: pending": {
+			grantType: model.GrantTypeDeviceCode,
+			uaErr:     useradm.ErrAuthorizationPending,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       oauthErrAuthorizationPending,
+				Description: useradm.ErrAuthorizationPending.Error(),
+			},
+		},
+		"error: slow down": {
+			grantType: model.GrantTypeDeviceCode,
+			uaErr:     useradm.ErrSlowDown,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       oauthErrSlowDown,
+				Description: useradm.ErrSlowDown.Error(),
+			},
+		},
+		"error: denied": {
+			grantType: model.GrantTypeDeviceCode,
+			uaErr:     useradm.ErrAccessDenied,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       oauthErrAccessDenied,
+				Description: useradm.ErrAccessDenied.Error(),
+			},
+		},
+		"error: expired": {
+			grantType: model.GrantTypeDeviceCode,
+			uaErr:     useradm.ErrExpiredDeviceCode,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       oauthErrExpiredToken,
+				Description: useradm.ErrExpiredDeviceCode.Error(),
+			},
+		},
+		"error: unknown device code": {
+			grantType: model.GrantTypeDeviceCode,
+			uaErr:     useradm.ErrInvalidDeviceCode,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       oauthErrInvalidGrant,
+				Description: useradm.ErrInvalidDeviceCode.Error(),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("IssueDeviceToken", mtesting.ContextMatcher(),
+				"mender-cli", "device-code").Return(tc.uaToken, tc.uaErr)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeFormReq(t, "/api/management/v1/useradm/auth/device/token",
+				url.Values{
+					"grant_type":  {tc.grantType},
+					"client_id":   {"mender-cli"},
+					"device_code": {"device-code"},
+				})
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, mt.NewJSONResponse(tc.status, nil, tc.body), recorded)
+			assert.Equal(t, "no-store", recorded.Recorder.HeaderMap.Get("Cache-Control"))
+		})
+	}
+}
+
+func TestUserAdmApiGetDeviceAuthorization(t *testing.T) {
+	t.Parallel()
+
+	info := &model.DeviceAuthorizationInfo{
+		UserCode:  "BCDF-GHJK",
+		ClientID:  "mender-cli",
+		ExpiresTs: time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC),
+	}
+
+	testCases := map[string]struct {
+		userCode string
+
+		uaInfo *model.DeviceAuthorizationInfo
+		uaErr  error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			userCode: "bcdf-ghjk",
+			uaInfo:   info,
+
+			checker: mt.NewJSONResponse(http.StatusOK, nil, info),
+		},
+		"error: invalid user code": {
+			userCode: "AEIO-UAEI",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrInvalidUserCode.Error(), model.ErrInvalidUserCode),
+			),
+		},
+		"error: not found": {
+			userCode: "BCDF-GHJK",
+			uaErr:    store.ErrDeviceAuthorizationNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrDeviceAuthorizationNotFound.Error(),
+					"device_authorization_not_found"),
+			),
+		},
+		"error: disabled": {
+			userCode: "BCDF-GHJK",
+			uaErr:    useradm.ErrDeviceFlowDisabled,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(useradm.ErrDeviceFlowDisabled.Error(), "device_flow_disabled"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetDeviceAuthorization", mtesting.ContextMatcher(), tc.userCode).
+				Return(tc.uaInfo, tc.uaErr)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v1/useradm/auth/device/verify?user_code="+
+					tc.userCode,
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiVerifyDeviceAuthorization(t *testing.T) {
+	t.Parallel()
+
+	approve := true
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaErr error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"user_code": "BCDF-GHJK",
+				"approve":   true,
+			},
+
+			checker: mt.NewJSONResponse(http.StatusNoContent, nil, nil),
+		},
+		"error: no decision": {
+			body: map[string]interface{}{
+				"user_code": "BCDF-GHJK",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrMissingDeviceApproval.Error(),
+					model.ErrMissingDeviceApproval),
+			),
+		},
+		"error: not found": {
+			body: map[string]interface{}{
+				"user_code": "BCDF-GHJK",
+				"approve":   true,
+			},
+			uaErr: store.ErrDeviceAuthorizationNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrDeviceAuthorizationNotFound.Error(),
+					"device_authorization_not_found"),
+			),
+		},
+		"error: scope not granted to the user": {
+			body: map[string]interface{}{
+				"user_code": "BCDF-GHJK",
+				"approve":   true,
+			},
+			uaErr: useradm.ErrInvalidScope,
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError(useradm.ErrInvalidScope.Error(), "invalid_scope"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("VerifyDeviceAuthorization", mtesting.ContextMatcher(),
+				model.DeviceVerification{
+					UserCode: "BCDF-GHJK",
+					Approve:  &approve,
+				}).Return(tc.uaErr)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodPost,
+				"http://1.2.3.4/api/management/v1/useradm/auth/device/verify",
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
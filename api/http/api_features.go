@@ -0,0 +1,111 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+func (u *UserAdmApiHandlers) GetFeaturesHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	features, err := u.userAdm.GetFeatures(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(features)
+}
+
+func (u *UserAdmApiHandlers) GetTenantFeaturesHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
+
+	features, err := u.userAdm.GetFeatures(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(features)
+}
+
+func (u *UserAdmApiHandlers) SetTenantFeatureHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
+
+	var f model.Feature
+	if err := decodeJsonStrict(r, &f); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	f.Name = r.PathParam("name")
+
+	if err := f.Validate(); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := u.userAdm.SetFeature(ctx, f); err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) ResetTenantFeatureHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
+
+	if err := u.userAdm.ResetFeature(ctx, r.PathParam("name")); err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
+)
+
+func TestUserAdmApiGetFeatures(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaFeatures map[string]bool
+		uaError    error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaFeatures: map[string]bool{"foo": true, "bar": false},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				map[string]bool{"foo": true, "bar": false},
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetFeatures", mtesting.ContextMatcher()).
+				Return(tc.uaFeatures, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("GET",
+				"http://1.2.3.4/api/management/v1/useradm/features",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiSetTenantFeature(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		name string
+		body interface{}
+
+		uaFeature *model.Feature
+		uaError   error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			name:      "foo",
+			body:      map[string]interface{}{"enabled": true},
+			uaFeature: &model.Feature{Name: "foo", Enabled: true},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: invalid name": {
+			name: "Foo",
+			body: map[string]interface{}{"enabled": true},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrInvalidFeatureName.Error(),
+					model.ErrInvalidFeatureName),
+			),
+		},
+		"error: no body": {
+			name: "foo",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to decode request body: JSON payload is empty",
+					"empty_request_body"),
+			),
+		},
+		"error: useradm internal": {
+			name:      "foo",
+			body:      map[string]interface{}{"enabled": false},
+			uaFeature: &model.Feature{Name: "foo"},
+			uaError:   errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			if tc.uaFeature != nil {
+				uadm.On("SetFeature", mock.MatchedBy(func(c context.Context) bool {
+					return identity.FromContext(c).Tenant == "1"
+				}),
+					*tc.uaFeature).
+					Return(tc.uaError)
+			}
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodPut,
+				"http://1.2.3.4/api/internal/v1/useradm/tenants/1/features/"+tc.name,
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+			uadm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserAdmApiResetTenantFeature(t *testing.T) {
+	t.Parallel()
+
+	uadm := &museradm.App{}
+	uadm.On("ResetFeature", mock.MatchedBy(func(c context.Context) bool {
+		return identity.FromContext(c).Tenant == "1"
+	}),
+		"foo").
+		Return(nil)
+
+	api := makeMockApiHandler(t, uadm, nil)
+
+	req := makeReq(http.MethodDelete,
+		"http://1.2.3.4/api/internal/v1/useradm/tenants/1/features/foo",
+		"",
+		nil)
+
+	recorded := test.RunRequest(t, api, req)
+	recorded.CodeIs(http.StatusNoContent)
+	uadm.AssertExpectations(t)
+}
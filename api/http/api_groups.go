@@ -0,0 +1,149 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+)
+
+func (u *UserAdmApiHandlers) CreateGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	group, err := parseGroup(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err = u.userAdm.CreateGroup(ctx, group)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.Header().Add("Location", "groups/"+group.ID)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (u *UserAdmApiHandlers) GetGroupsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	groups, err := u.userAdm.GetGroups(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(groups)
+}
+
+func (u *UserAdmApiHandlers) GetGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	group, err := u.userAdm.GetGroup(ctx, r.PathParam("id"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	if group == nil {
+		restErr(w, r, l, store.ErrGroupNotFound, http.StatusNotFound)
+		return
+	}
+
+	w.WriteJson(group)
+}
+
+func (u *UserAdmApiHandlers) DeleteGroupHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := u.userAdm.DeleteGroup(ctx, r.PathParam("id"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) GetGroupMembersHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	users, err := u.userAdm.GetGroupMembers(ctx, r.PathParam("id"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(users)
+}
+
+func (u *UserAdmApiHandlers) AddGroupMemberHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := u.userAdm.AddGroupMember(ctx, r.PathParam("id"), r.PathParam("userid"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) RemoveGroupMemberHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := u.userAdm.RemoveGroupMember(ctx, r.PathParam("id"), r.PathParam("userid"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseGroup(r *rest.Request) (*model.Group, error) {
+	group := model.Group{}
+
+	//decode body
+	if err := decodeJsonStrict(r, &group); err != nil {
+		return nil, err
+	}
+
+	if err := group.ValidateNew(); err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
@@ -0,0 +1,480 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest/test"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
+)
+
+func TestUserAdmApiCreateGroup(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"name":        "devops",
+				"description": "DevOps team",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				nil,
+				nil,
+			),
+		},
+		"error: invalid name": {
+			body: map[string]interface{}{
+				"name": "dev ops",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrInvalidGroupName.Error(), model.ErrInvalidGroupName),
+			),
+		},
+		"error: no body": {
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to decode request body: JSON payload is empty", "empty_request_body"),
+			),
+		},
+		"error: duplicate name": {
+			body: map[string]interface{}{
+				"name": "devops",
+			},
+			uaError: store.ErrDuplicateGroupName,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnprocessableEntity,
+				nil,
+				restError(store.ErrDuplicateGroupName.Error(), "duplicate_group_name"),
+			),
+		},
+		"error: useradm internal": {
+			body: map[string]interface{}{
+				"name": "devops",
+			},
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("CreateGroup", mtesting.ContextMatcher(),
+				mock.AnythingOfType("*model.Group")).
+				Run(func(args mock.Arguments) {
+					g := args.Get(1).(*model.Group)
+					g.ID = "group-1"
+				}).
+				Return(tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("POST",
+				"http://1.2.3.4/api/management/v1/useradm/groups",
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+
+			if recorded.Recorder.Code == http.StatusCreated {
+				assert.Equal(t, "groups/group-1",
+					recorded.Recorder.HeaderMap.Get("Location"))
+			}
+		})
+	}
+}
+
+func TestUserAdmApiGetGroups(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		uaGroups []model.Group
+		uaError  error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaGroups: []model.Group{
+				{
+					ID:        "group-1",
+					Name:      "devops",
+					CreatedTs: &ts,
+				},
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]model.Group{
+					{
+						ID:        "group-1",
+						Name:      "devops",
+						CreatedTs: &ts,
+					},
+				},
+			),
+		},
+		"ok, empty": {
+			uaGroups: []model.Group{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]model.Group{},
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetGroups", mtesting.ContextMatcher()).
+				Return(tc.uaGroups, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("GET",
+				"http://1.2.3.4/api/management/v1/useradm/groups",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetGroup(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaGroup *model.Group
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaGroup: &model.Group{
+				ID:   "group-1",
+				Name: "devops",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				&model.Group{
+					ID:   "group-1",
+					Name: "devops",
+				},
+			),
+		},
+		"error: not found": {
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrGroupNotFound.Error(), "group_not_found"),
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetGroup", mtesting.ContextMatcher(), "group-1").
+				Return(tc.uaGroup, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("GET",
+				"http://1.2.3.4/api/management/v1/useradm/groups/group-1",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiDeleteGroup(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("DeleteGroup", mtesting.ContextMatcher(), "group-1").
+				Return(tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("DELETE",
+				"http://1.2.3.4/api/management/v1/useradm/groups/group-1",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetGroupMembers(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaUsers []model.User
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaUsers: []model.User{
+				{
+					ID:     "user-1",
+					Email:  "foo@bar.com",
+					Groups: []string{"group-1"},
+				},
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]model.User{
+					{
+						ID:     "user-1",
+						Email:  "foo@bar.com",
+						Groups: []string{"group-1"},
+					},
+				},
+			),
+		},
+		"error: group not found": {
+			uaError: store.ErrGroupNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrGroupNotFound.Error(), "group_not_found"),
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetGroupMembers", mtesting.ContextMatcher(), "group-1").
+				Return(tc.uaUsers, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("GET",
+				"http://1.2.3.4/api/management/v1/useradm/groups/group-1/members",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGroupMember(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		method string
+
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok, add": {
+			method: "PUT",
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error, add: group not found": {
+			method:  "PUT",
+			uaError: store.ErrGroupNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrGroupNotFound.Error(), "group_not_found"),
+			),
+		},
+		"error, add: user not found": {
+			method:  "PUT",
+			uaError: store.ErrUserNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrUserNotFound.Error(), "user_not_found"),
+			),
+		},
+		"error, add: useradm internal": {
+			method:  "PUT",
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+		"ok, remove": {
+			method: "DELETE",
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error, remove: user not found": {
+			method:  "DELETE",
+			uaError: store.ErrUserNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrUserNotFound.Error(), "user_not_found"),
+			),
+		},
+		"error, remove: useradm internal": {
+			method:  "DELETE",
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("AddGroupMember", mtesting.ContextMatcher(),
+				"group-1", "user-1").Return(tc.uaError)
+			uadm.On("RemoveGroupMember", mtesting.ContextMatcher(),
+				"group-1", "user-1").Return(tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(tc.method,
+				"http://1.2.3.4/api/management/v1/useradm/groups/group-1/members/user-1",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
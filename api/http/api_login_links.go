@@ -0,0 +1,87 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+// RequestLoginLinkHandler mails a login link to the user; the response is
+// the same whether the user exists or not
+func (u *UserAdmApiHandlers) RequestLoginLinkHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	req := model.LoginLinkRequest{}
+	if err := decodeJsonStrict(r, &req); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := u.userAdm.RequestLoginLink(ctx, req.Email); err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// LoginLinkHandler exchanges the code of the login link for a token,
+// the same as AuthLoginHandler returns
+func (u *UserAdmApiHandlers) LoginLinkHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	e := model.LoginLinkExchange{}
+	if err := decodeJsonStrict(r, &e); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := e.Validate(); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	token, err := u.userAdm.LoginWithLink(ctx, e.Code, model.LoginInfo{
+		IP:        u.clientIP(r),
+		UserAgent: r.UserAgent(),
+		Scope:     r.URL.Query().Get("scope"),
+	})
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	setMetricsTenant(r, token.Claims.Tenant)
+
+	raw, err := u.userAdm.SignToken(ctx, token)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jwt")
+	w.(http.ResponseWriter).Write([]byte(raw))
+}
@@ -0,0 +1,175 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest/test"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	useradm "github.com/mendersoftware/useradm/user"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
+)
+
+func TestUserAdmApiRequestLoginLink(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaErr error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: map[string]interface{}{"email": "foo@bar.com"},
+
+			checker: mt.NewJSONResponse(http.StatusAccepted, nil, nil),
+		},
+		"error: invalid email": {
+			body: map[string]interface{}{"email": "foo"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrInvalidLoginLinkEmail.Error(),
+					model.ErrInvalidLoginLinkEmail),
+			),
+		},
+		"error: disabled": {
+			body:  map[string]interface{}{"email": "foo@bar.com"},
+			uaErr: useradm.ErrMagicLinkDisabled,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(useradm.ErrMagicLinkDisabled.Error(), "magic_link_disabled"),
+			),
+		},
+		"error: internal": {
+			body:  map[string]interface{}{"email": "foo@bar.com"},
+			uaErr: errors.New("mail server unreachable"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("RequestLoginLink", mtesting.ContextMatcher(), "foo@bar.com").
+				Return(tc.uaErr)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodPost,
+				"http://1.2.3.4/api/management/v1/useradm/auth/magic-link",
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiLoginLink(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaToken *jwt.Token
+		uaErr   error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body:    map[string]interface{}{"code": "code"},
+			uaToken: &jwt.Token{},
+
+			checker: &mt.BaseResponse{
+				Status:      http.StatusOK,
+				ContentType: "application/jwt",
+				Body:        "dummytoken",
+			},
+		},
+		"error: no code": {
+			body: map[string]interface{}{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrMissingLoginLinkCode.Error(),
+					model.ErrMissingLoginLinkCode),
+			),
+		},
+		"error: unauthorized": {
+			body:  map[string]interface{}{"code": "code"},
+			uaErr: useradm.ErrUnauthorized,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnauthorized,
+				nil,
+				restError("unauthorized", "unauthorized"),
+			),
+		},
+		"error: disabled": {
+			body:  map[string]interface{}{"code": "code"},
+			uaErr: useradm.ErrMagicLinkDisabled,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(useradm.ErrMagicLinkDisabled.Error(), "magic_link_disabled"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("LoginWithLink", mtesting.ContextMatcher(), "code",
+				model.LoginInfo{IP: "5.6.7.8", UserAgent: "test-agent"}).
+				Return(tc.uaToken, tc.uaErr)
+			uadm.On("SignToken", mtesting.ContextMatcher(), tc.uaToken).
+				Return("dummytoken", nil)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodPost,
+				"http://1.2.3.4/api/management/v1/useradm/auth/magic-link/login",
+				"",
+				tc.body)
+			req.RemoteAddr = "5.6.7.8:5678"
+			req.Header.Set("User-Agent", "test-agent")
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/user"
+)
+
+// error codes of the token endpoint, see RFC 6749 5.2
+const (
+	oauthErrInvalidRequest       = "invalid_request"
+	oauthErrInvalidClient        = "invalid_client"
+	oauthErrInvalidScope         = "invalid_scope"
+	oauthErrInvalidGrant         = "invalid_grant"
+	oauthErrUnsupportedGrantType = "unsupported_grant_type"
+	oauthErrServerError          = "server_error"
+	// see RFC 8693 2.2.2
+	oauthErrUnsupportedTokenType = "unsupported_token_type"
+)
+
+// OAuthError is the error response of the token endpoint, which OAuth2
+// clients expect instead of the usual error body
+type OAuthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (u *UserAdmApiHandlers) CreateOAuthClientHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	client, err := parseOAuthClient(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	creds, err := u.userAdm.CreateOAuthClient(ctx, *client)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.Header().Add("Location", "clients/"+creds.ID)
+	w.WriteHeader(http.StatusCreated)
+	w.WriteJson(creds)
+}
+
+func (u *UserAdmApiHandlers) GetOAuthClientsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	clients, err := u.userAdm.GetOAuthClients(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(clients)
+}
+
+func (u *UserAdmApiHandlers) DeleteOAuthClientHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := u.userAdm.DeleteOAuthClient(ctx, r.PathParam("id"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AuthTokenHandler is the OAuth2 token endpoint, granting tokens to the
+// registered clients with the client credentials grant, the users'
+// tokens to the OpenID Connect clients with the authorization code grant,
+// and the tokens acting on the users' behalf with the token exchange grant
+func (u *UserAdmApiHandlers) AuthTokenHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := r.ParseForm(); err != nil {
+		oauthErr(w, http.StatusBadRequest, oauthErrInvalidRequest,
+			"malformed request body")
+		return
+	}
+
+	// the credentials in the header are preferred, see RFC 6749 2.3.1
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case model.GrantTypeClientCredentials:
+	case model.GrantTypeAuthorizationCode:
+		u.exchangeAuthCode(w, r, model.AuthCodeExchange{
+			ClientID:     id,
+			ClientSecret: secret,
+			Code:         r.PostForm.Get("code"),
+			RedirectURI:  r.PostForm.Get("redirect_uri"),
+			CodeVerifier: r.PostForm.Get("code_verifier"),
+		})
+		return
+	case model.GrantTypeTokenExchange:
+		u.exchangeToken(w, r, model.TokenExchange{
+			ClientID:           id,
+			ClientSecret:       secret,
+			SubjectToken:       r.PostForm.Get("subject_token"),
+			SubjectTokenType:   r.PostForm.Get("subject_token_type"),
+			RequestedTokenType: r.PostForm.Get("requested_token_type"),
+			Scope:              r.PostForm.Get("scope"),
+		})
+		return
+	default:
+		oauthErr(w, http.StatusBadRequest, oauthErrUnsupportedGrantType,
+			"only the client_credentials, authorization_code and "+
+				model.GrantTypeTokenExchange+" grants are supported")
+		return
+	}
+
+	token, err := u.userAdm.IssueClientToken(ctx, id, secret, r.PostForm.Get("scope"))
+	if err != nil {
+		tokenErr(w, l, err)
+		return
+	}
+
+	setMetricsTenant(r, token.Claims.Tenant)
+
+	raw, err := u.userAdm.SignToken(ctx, token)
+	if err != nil {
+		l.Errorf("failed to sign client token: %v", err)
+		oauthErr(w, http.StatusInternalServerError, oauthErrServerError, "")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteJson(model.AccessToken{
+		AccessToken: raw,
+		TokenType:   model.TokenTypeBearer,
+		ExpiresIn:   token.Claims.ExpiresAt - token.Claims.IssuedAt,
+		Scope:       token.Claims.Scope,
+	})
+}
+
+// exchangeAuthCode responds to the token request of the authorization code
+// grant, with the ID token along with the access token
+func (u *UserAdmApiHandlers) exchangeAuthCode(w rest.ResponseWriter, r *rest.Request,
+	e model.AuthCodeExchange) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	token, err := u.userAdm.ExchangeAuthCode(ctx, e)
+	if err != nil {
+		tokenErr(w, l, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteJson(token)
+}
+
+// exchangeToken responds to the token request of the token exchange grant
+func (u *UserAdmApiHandlers) exchangeToken(w rest.ResponseWriter, r *rest.Request,
+	e model.TokenExchange) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if e.SubjectToken == "" || e.SubjectTokenType == "" {
+		oauthErr(w, http.StatusBadRequest, oauthErrInvalidRequest,
+			"subject_token and subject_token_type are required")
+		return
+	}
+
+	token, err := u.userAdm.ExchangeToken(ctx, e)
+	if err != nil {
+		tokenErr(w, l, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteJson(token)
+}
+
+// tokenErr responds with the error of the token endpoint, see RFC 6749 5.2
+func tokenErr(w rest.ResponseWriter, l *log.Logger, err error) {
+	switch err {
+	case useradm.ErrInvalidClient:
+		w.Header().Set("WWW-Authenticate", `Basic realm="useradm"`)
+		oauthErr(w, http.StatusUnauthorized, oauthErrInvalidClient, err.Error())
+	case useradm.ErrInvalidScope:
+		oauthErr(w, http.StatusBadRequest, oauthErrInvalidScope, err.Error())
+	case useradm.ErrInvalidGrant:
+		oauthErr(w, http.StatusBadRequest, oauthErrInvalidGrant, err.Error())
+	case useradm.ErrOIDCDisabled, useradm.ErrDeviceFlowDisabled:
+		oauthErr(w, http.StatusBadRequest, oauthErrUnsupportedGrantType, err.Error())
+	case useradm.ErrInvalidDeviceCode:
+		oauthErr(w, http.StatusBadRequest, oauthErrInvalidGrant, err.Error())
+	case useradm.ErrExpiredDeviceCode:
+		oauthErr(w, http.StatusBadRequest, oauthErrExpiredToken, err.Error())
+	case useradm.ErrAuthorizationPending:
+		oauthErr(w, http.StatusBadRequest, oauthErrAuthorizationPending, err.Error())
+	case useradm.ErrSlowDown:
+		oauthErr(w, http.StatusBadRequest, oauthErrSlowDown, err.Error())
+	case useradm.ErrAccessDenied:
+		oauthErr(w, http.StatusBadRequest, oauthErrAccessDenied, err.Error())
+	case useradm.ErrInvalidSubjectToken:
+		oauthErr(w, http.StatusBadRequest, oauthErrInvalidRequest, err.Error())
+	case useradm.ErrUnsupportedTokenType:
+		oauthErr(w, http.StatusBadRequest, oauthErrUnsupportedTokenType, err.Error())
+	case useradm.ErrTenantAccountSuspended, useradm.ErrTenantTrialExpired,
+		useradm.ErrTenantPaymentOverdue:
+		oauthErr(w, http.StatusUnauthorized, oauthErrInvalidClient, err.Error())
+	default:
+		l.Errorf("failed to issue token: %v", err)
+		oauthErr(w, http.StatusInternalServerError, oauthErrServerError, "")
+	}
+}
+
+func oauthErr(w rest.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.WriteJson(OAuthError{
+		Error:       code,
+		Description: description,
+	})
+}
+
+func parseOAuthClient(r *rest.Request) (*model.OAuthClientNew, error) {
+	client := model.OAuthClientNew{}
+
+	if err := decodeJsonStrict(r, &client); err != nil {
+		return nil, err
+	}
+
+	if err := client.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &client, nil
+}
@@ -0,0 +1,502 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	useradm "github.com/mendersoftware/useradm/user"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
+)
+
+func TestUserAdmApiCreateOAuthClient(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaClient *model.OAuthClientNew
+		uaCreds  *model.OAuthClientCredentials
+		uaError  error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"name":  "ci",
+				"scope": "mender.users:read",
+			},
+			uaClient: &model.OAuthClientNew{Name: "ci", Scope: "mender.users:read"},
+			uaCreds: &model.OAuthClientCredentials{
+				OAuthClient: model.OAuthClient{
+					ID:        "client-1",
+					Name:      "ci",
+					Scope:     "mender.users:read",
+					CreatedTs: created,
+				},
+				Secret: "secret",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				nil,
+				map[string]interface{}{
+					"client_id":     "client-1",
+					"client_secret": "secret",
+					"name":          "ci",
+					"scope":         "mender.users:read",
+					"created_ts":    created,
+				},
+			),
+		},
+		"error: no name": {
+			body: map[string]interface{}{
+				"scope": "mender.users:read",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrInvalidOAuthClientName.Error(),
+					model.ErrInvalidOAuthClientName),
+			),
+		},
+		"error: invalid scope": {
+			body: map[string]interface{}{
+				"name":  "ci",
+				"scope": "mender.operator",
+			},
+			uaClient: &model.OAuthClientNew{Name: "ci", Scope: "mender.operator"},
+			uaError:  useradm.ErrInvalidScope,
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError(useradm.ErrInvalidScope.Error(), "invalid_scope"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			if tc.uaClient != nil {
+				uadm.On("CreateOAuthClient", mtesting.ContextMatcher(), *tc.uaClient).
+					Return(tc.uaCreds, tc.uaError)
+			}
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodPost,
+				"http://1.2.3.4/api/management/v1/useradm/clients",
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+			uadm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserAdmApiDeleteOAuthClient(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: not found": {
+			uaError: store.ErrOAuthClientNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrOAuthClientNotFound.Error(), "client_not_found"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("DeleteOAuthClient", mtesting.ContextMatcher(), "client-1").
+				Return(tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodDelete,
+				"http://1.2.3.4/api/management/v1/useradm/clients/client-1",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiAuthToken(t *testing.T) {
+	t.Parallel()
+
+	token := &jwt.Token{
+		Claims: jwt.Claims{
+			IssuedAt:  1500000000,
+			ExpiresAt: 1500003600,
+			Scope:     "mender.users:read",
+			Client:    true,
+		},
+	}
+
+	testCases := map[string]struct {
+		form      url.Values
+		basicAuth []string
+
+		uaId, uaSecret, uaScope string
+		uaError                 error
+
+		uaExchange    *model.AuthCodeExchange
+		uaExchanged   *model.AccessToken
+		uaExchangeErr error
+
+		uaTokenExchange    *model.TokenExchange
+		uaTokenExchanged   *model.AccessToken
+		uaTokenExchangeErr error
+
+		status int
+		body   interface{}
+	}{
+		"ok, basic auth": {
+			form: url.Values{
+				"grant_type": {"client_credentials"},
+				"scope":      {"mender.users:read"},
+			},
+			basicAuth: []string{"client-1", "secret"},
+			uaId:      "client-1",
+			uaSecret:  "secret",
+			uaScope:   "mender.users:read",
+
+			status: http.StatusOK,
+			body: model.AccessToken{
+				AccessToken: "signed",
+				TokenType:   "Bearer",
+				ExpiresIn:   3600,
+				Scope:       "mender.users:read",
+			},
+		},
+		"ok, credentials in the body": {
+			form: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {"client-1"},
+				"client_secret": {"secret"},
+			},
+			uaId:     "client-1",
+			uaSecret: "secret",
+
+			status: http.StatusOK,
+			body: model.AccessToken{
+				AccessToken: "signed",
+				TokenType:   "Bearer",
+				ExpiresIn:   3600,
+				Scope:       "mender.users:read",
+			},
+		},
+		"error: unsupported grant": {
+			form: url.Values{
+				"grant_type": {"password"},
+			},
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error: "unsupported_grant_type",
+				Description: "only the client_credentials, authorization_code and " +
+					model.GrantTypeTokenExchange + " grants are supported",
+			},
+		},
+		"error: invalid client": {
+			form: url.Values{
+				"grant_type": {"client_credentials"},
+			},
+			basicAuth: []string{"client-1", "wrong"},
+			uaId:      "client-1",
+			uaSecret:  "wrong",
+			uaError:   useradm.ErrInvalidClient,
+
+			status: http.StatusUnauthorized,
+			body: OAuthError{
+				Error:       "invalid_client",
+				Description: useradm.ErrInvalidClient.Error(),
+			},
+		},
+		"error: invalid scope": {
+			form: url.Values{
+				"grant_type": {"client_credentials"},
+				"scope":      {"mender.*"},
+			},
+			basicAuth: []string{"client-1", "secret"},
+			uaId:      "client-1",
+			uaSecret:  "secret",
+			uaScope:   "mender.*",
+			uaError:   useradm.ErrInvalidScope,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       "invalid_scope",
+				Description: useradm.ErrInvalidScope.Error(),
+			},
+		},
+		"ok, authorization code": {
+			form: url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {"code-1"},
+				"redirect_uri":  {"https://tool.example.com/callback"},
+				"code_verifier": {"verifier"},
+			},
+			basicAuth: []string{"client-1", "secret"},
+			uaExchange: &model.AuthCodeExchange{
+				ClientID:     "client-1",
+				ClientSecret: "secret",
+				Code:         "code-1",
+				RedirectURI:  "https://tool.example.com/callback",
+				CodeVerifier: "verifier",
+			},
+			uaExchanged: &model.AccessToken{
+				AccessToken: "signed",
+				TokenType:   "Bearer",
+				ExpiresIn:   3600,
+				Scope:       "openid email",
+				IDToken:     "signed.id",
+			},
+
+			status: http.StatusOK,
+			body: model.AccessToken{
+				AccessToken: "signed",
+				TokenType:   "Bearer",
+				ExpiresIn:   3600,
+				Scope:       "openid email",
+				IDToken:     "signed.id",
+			},
+		},
+		"error: invalid authorization code": {
+			form: url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {"code-1"},
+				"redirect_uri":  {"https://tool.example.com/callback"},
+				"code_verifier": {"verifier"},
+				"client_id":     {"client-1"},
+				"client_secret": {"secret"},
+			},
+			uaExchange: &model.AuthCodeExchange{
+				ClientID:     "client-1",
+				ClientSecret: "secret",
+				Code:         "code-1",
+				RedirectURI:  "https://tool.example.com/callback",
+				CodeVerifier: "verifier",
+			},
+			uaExchangeErr: useradm.ErrInvalidGrant,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       "invalid_grant",
+				Description: useradm.ErrInvalidGrant.Error(),
+			},
+		},
+		"error: OpenID Connect disabled": {
+			form: url.Values{
+				"grant_type": {"authorization_code"},
+				"code":       {"code-1"},
+			},
+			basicAuth: []string{"client-1", "secret"},
+			uaExchange: &model.AuthCodeExchange{
+				ClientID:     "client-1",
+				ClientSecret: "secret",
+				Code:         "code-1",
+			},
+			uaExchangeErr: useradm.ErrOIDCDisabled,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       "unsupported_grant_type",
+				Description: useradm.ErrOIDCDisabled.Error(),
+			},
+		},
+		"ok, token exchange": {
+			form: url.Values{
+				"grant_type":         {model.GrantTypeTokenExchange},
+				"subject_token":      {"user.token"},
+				"subject_token_type": {model.TokenTypeAccessToken},
+				"scope":              {"mender.users:read"},
+			},
+			basicAuth: []string{"client-1", "secret"},
+			uaTokenExchange: &model.TokenExchange{
+				ClientID:         "client-1",
+				ClientSecret:     "secret",
+				SubjectToken:     "user.token",
+				SubjectTokenType: model.TokenTypeAccessToken,
+				Scope:            "mender.users:read",
+			},
+			uaTokenExchanged: &model.AccessToken{
+				AccessToken:     "signed",
+				TokenType:       "Bearer",
+				ExpiresIn:       300,
+				Scope:           "mender.users:read",
+				IssuedTokenType: model.TokenTypeAccessToken,
+			},
+
+			status: http.StatusOK,
+			body: model.AccessToken{
+				AccessToken:     "signed",
+				TokenType:       "Bearer",
+				ExpiresIn:       300,
+				Scope:           "mender.users:read",
+				IssuedTokenType: model.TokenTypeAccessToken,
+			},
+		},
+		"error: token exchange, no subject token": {
+			form: url.Values{
+				"grant_type":         {model.GrantTypeTokenExchange},
+				"subject_token_type": {model.TokenTypeAccessToken},
+			},
+			basicAuth: []string{"client-1", "secret"},
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       "invalid_request",
+				Description: "subject_token and subject_token_type are required",
+			},
+		},
+		"error: token exchange, invalid subject token": {
+			form: url.Values{
+				"grant_type":         {model.GrantTypeTokenExchange},
+				"subject_token":      {"user.token"},
+				"subject_token_type": {model.TokenTypeJWT},
+				"client_id":          {"client-1"},
+				"client_secret":      {"secret"},
+			},
+			uaTokenExchange: &model.TokenExchange{
+				ClientID:         "client-1",
+				ClientSecret:     "secret",
+				SubjectToken:     "user.token",
+				SubjectTokenType: model.TokenTypeJWT,
+			},
+			uaTokenExchangeErr: useradm.ErrInvalidSubjectToken,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       "invalid_request",
+				Description: useradm.ErrInvalidSubjectToken.Error(),
+			},
+		},
+		"error: token exchange, unsupported token type": {
+			form: url.Values{
+				"grant_type":         {model.GrantTypeTokenExchange},
+				"subject_token":      {"user.token"},
+				"subject_token_type": {"urn:ietf:params:oauth:token-type:saml2"},
+			},
+			basicAuth: []string{"client-1", "secret"},
+			uaTokenExchange: &model.TokenExchange{
+				ClientID:         "client-1",
+				ClientSecret:     "secret",
+				SubjectToken:     "user.token",
+				SubjectTokenType: "urn:ietf:params:oauth:token-type:saml2",
+			},
+			uaTokenExchangeErr: useradm.ErrUnsupportedTokenType,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       "unsupported_token_type",
+				Description: useradm.ErrUnsupportedTokenType.Error(),
+			},
+		},
+		"error: internal": {
+			form: url.Values{
+				"grant_type": {"client_credentials"},
+			},
+			basicAuth: []string{"client-1", "secret"},
+			uaId:      "client-1",
+			uaSecret:  "secret",
+			uaError:   errors.New("db connection failed"),
+
+			status: http.StatusInternalServerError,
+			body:   OAuthError{Error: "server_error"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			if tc.uaId != "" {
+				uadm.On("IssueClientToken", mtesting.ContextMatcher(),
+					tc.uaId, tc.uaSecret, tc.uaScope).
+					Return(token, tc.uaError)
+				uadm.On("SignToken", mtesting.ContextMatcher(), token).
+					Return("signed", nil)
+			}
+			if tc.uaExchange != nil {
+				uadm.On("ExchangeAuthCode", mtesting.ContextMatcher(), *tc.uaExchange).
+					Return(tc.uaExchanged, tc.uaExchangeErr)
+			}
+			if tc.uaTokenExchange != nil {
+				uadm.On("ExchangeToken", mtesting.ContextMatcher(), *tc.uaTokenExchange).
+					Return(tc.uaTokenExchanged, tc.uaTokenExchangeErr)
+			}
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req, _ := http.NewRequest(http.MethodPost,
+				"http://1.2.3.4/api/management/v1/useradm/auth/token",
+				strings.NewReader(tc.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Add(requestid.RequestIdHeader, "test")
+			if tc.basicAuth != nil {
+				req.SetBasicAuth(tc.basicAuth[0], tc.basicAuth[1])
+			}
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, mt.NewJSONResponse(tc.status, nil, tc.body), recorded)
+			assert.Equal(t, "no-store", recorded.Recorder.HeaderMap.Get("Cache-Control"))
+			uadm.AssertNotCalled(t, "Login", mock.Anything, mock.Anything,
+				mock.Anything, mock.Anything)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/user"
+)
+
+// error codes of the authorization endpoint, see RFC 6749 4.1.2.1
+const (
+	oauthErrAccessDenied            = "access_denied"
+	oauthErrUnsupportedResponseType = "unsupported_response_type"
+)
+
+func (u *UserAdmApiHandlers) GetOIDCConfigurationHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	config, err := u.userAdm.GetOIDCConfiguration(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(config)
+}
+
+func (u *UserAdmApiHandlers) GetOIDCKeysHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	keys, err := u.userAdm.GetOIDCKeys(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(keys)
+}
+
+// OIDCAuthorizeHandler is the authorization endpoint of the OpenID Connect
+// authorization code flow; the user is the one of the request's token,
+// and is sent back to the client with the code, or the error
+func (u *UserAdmApiHandlers) OIDCAuthorizeHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	query := r.URL.Query()
+	req := model.AuthorizationRequest{
+		ResponseType:        query.Get("response_type"),
+		ClientID:            query.Get("client_id"),
+		RedirectURI:         query.Get("redirect_uri"),
+		Scope:               query.Get("scope"),
+		State:               query.Get("state"),
+		Nonce:               query.Get("nonce"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+	}
+
+	code, err := u.userAdm.AuthorizeOIDC(ctx, req)
+
+	// the user is never sent to a redirect URI not registered
+	// for the client, see RFC 6749 4.1.2.1
+	switch err {
+	case useradm.ErrOIDCDisabled, useradm.ErrUnauthorized:
+		restAppErr(w, r, l, err)
+		return
+	case useradm.ErrInvalidClient, useradm.ErrInvalidRedirectURI:
+		oauthErr(w, http.StatusBadRequest, oauthErrInvalidRequest, err.Error())
+		return
+	}
+
+	params := url.Values{}
+	switch err {
+	case nil:
+		params.Set("code", code)
+	case model.ErrInvalidResponseType:
+		params.Set("error", oauthErrUnsupportedResponseType)
+		params.Set("error_description", err.Error())
+	case model.ErrMissingOpenIDScope, model.ErrInvalidCodeChallenge:
+		params.Set("error", oauthErrInvalidRequest)
+		params.Set("error_description", err.Error())
+	case useradm.ErrInvalidScope:
+		params.Set("error", oauthErrInvalidScope)
+		params.Set("error_description", err.Error())
+	case useradm.ErrUserInactive:
+		params.Set("error", oauthErrAccessDenied)
+		params.Set("error_description", err.Error())
+	default:
+		l.Errorf("failed to authorize client %s: %v", req.ClientID, err)
+		params.Set("error", oauthErrServerError)
+	}
+	if req.State != "" {
+		params.Set("state", req.State)
+	}
+
+	redirect, _ := url.Parse(req.RedirectURI)
+	query = redirect.Query()
+	for k, v := range params {
+		query[k] = v
+	}
+	redirect.RawQuery = query.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", redirect.String())
+	w.WriteHeader(http.StatusFound)
+}
+
+func (u *UserAdmApiHandlers) GetUserInfoHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	info, err := u.userAdm.GetUserInfo(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(info)
+}
@@ -0,0 +1,241 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest/test"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	useradm "github.com/mendersoftware/useradm/user"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
+)
+
+func TestUserAdmApiGetOIDCConfiguration(t *testing.T) {
+	t.Parallel()
+
+	config := &model.OIDCConfiguration{
+		Issuer:                "https://mender.example.com/api/management/v1/useradm/oidc",
+		AuthorizationEndpoint: "https://mender.example.com/api/management/v1/useradm/oidc/authorize",
+	}
+
+	testCases := map[string]struct {
+		uaConfig *model.OIDCConfiguration
+		uaError  error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaConfig: config,
+
+			checker: mt.NewJSONResponse(http.StatusOK, nil, config),
+		},
+		"error: disabled": {
+			uaError: useradm.ErrOIDCDisabled,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(useradm.ErrOIDCDisabled.Error(), "oidc_disabled"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetOIDCConfiguration", mtesting.ContextMatcher()).
+				Return(tc.uaConfig, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v1/useradm/oidc/.well-known/openid-configuration",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetOIDCKeys(t *testing.T) {
+	t.Parallel()
+
+	keys := &jwt.JWKS{
+		Keys: []jwt.JWK{{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: "RS256",
+			KeyID:     "kid",
+			Modulus:   "n",
+			Exponent:  "AQAB",
+		}},
+	}
+
+	uadm := &museradm.App{}
+	uadm.On("GetOIDCKeys", mtesting.ContextMatcher()).Return(keys, nil)
+
+	api := makeMockApiHandler(t, uadm, nil)
+
+	req := makeReq(http.MethodGet,
+		"http://1.2.3.4/api/management/v1/useradm/oidc/jwks",
+		"",
+		nil)
+
+	recorded := test.RunRequest(t, api, req)
+	mt.CheckResponse(t, mt.NewJSONResponse(http.StatusOK, nil, keys), recorded)
+}
+
+func TestUserAdmApiOIDCAuthorize(t *testing.T) {
+	t.Parallel()
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"client-1"},
+		"redirect_uri":          {"https://tool.example.com/callback?tool=1"},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-1"},
+		"code_challenge":        {"challenge"},
+		"code_challenge_method": {"S256"},
+	}
+	request := model.AuthorizationRequest{
+		ResponseType:        "code",
+		ClientID:            "client-1",
+		RedirectURI:         "https://tool.example.com/callback?tool=1",
+		Scope:               "openid email",
+		State:               "xyz",
+		Nonce:               "n-1",
+		CodeChallenge:       "challenge",
+		CodeChallengeMethod: "S256",
+	}
+
+	testCases := map[string]struct {
+		uaCode  string
+		uaError error
+
+		status   int
+		location string
+		body     interface{}
+	}{
+		"ok": {
+			uaCode: "code-1",
+
+			status:   http.StatusFound,
+			location: "https://tool.example.com/callback?code=code-1&state=xyz&tool=1",
+		},
+		"error: invalid scope": {
+			uaError: useradm.ErrInvalidScope,
+
+			status: http.StatusFound,
+			location: "https://tool.example.com/callback?error=invalid_scope&" +
+				"error_description=invalid+or+not+granted+scope+requested&state=xyz&tool=1",
+		},
+		"error: no PKCE": {
+			uaError: model.ErrInvalidCodeChallenge,
+
+			status: http.StatusFound,
+			location: "https://tool.example.com/callback?error=invalid_request&" +
+				"error_description=code_challenge%3A+an+S256+code+challenge+is+required&" +
+				"state=xyz&tool=1",
+		},
+		"error: internal": {
+			uaError: errors.New("db connection failed"),
+
+			status:   http.StatusFound,
+			location: "https://tool.example.com/callback?error=server_error&state=xyz&tool=1",
+		},
+		"error: redirect URI not registered": {
+			uaError: useradm.ErrInvalidRedirectURI,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       "invalid_request",
+				Description: useradm.ErrInvalidRedirectURI.Error(),
+			},
+		},
+		"error: unknown client": {
+			uaError: useradm.ErrInvalidClient,
+
+			status: http.StatusBadRequest,
+			body: OAuthError{
+				Error:       "invalid_request",
+				Description: useradm.ErrInvalidClient.Error(),
+			},
+		},
+		"error: disabled": {
+			uaError: useradm.ErrOIDCDisabled,
+
+			status: http.StatusNotFound,
+			body:   restError(useradm.ErrOIDCDisabled.Error(), "oidc_disabled"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("AuthorizeOIDC", mtesting.ContextMatcher(), request).
+				Return(tc.uaCode, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v1/useradm/oidc/authorize?"+query.Encode(),
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			recorded.CodeIs(tc.status)
+			assert.Equal(t, tc.location, recorded.Recorder.HeaderMap.Get("Location"))
+			if tc.body != nil {
+				mt.CheckResponse(t, mt.NewJSONResponse(tc.status, nil, tc.body), recorded)
+			}
+		})
+	}
+}
+
+func TestUserAdmApiGetUserInfo(t *testing.T) {
+	t.Parallel()
+
+	info := &model.UserInfo{
+		Subject: "user-1",
+		Email:   "foo@bar.com",
+	}
+
+	uadm := &museradm.App{}
+	uadm.On("GetUserInfo", mtesting.ContextMatcher()).Return(info, nil)
+
+	api := makeMockApiHandler(t, uadm, nil)
+
+	req := makeReq(http.MethodGet,
+		"http://1.2.3.4/api/management/v1/useradm/oidc/userinfo",
+		"",
+		nil)
+
+	recorded := test.RunRequest(t, api, req)
+	mt.CheckResponse(t, mt.NewJSONResponse(http.StatusOK, nil, info), recorded)
+}
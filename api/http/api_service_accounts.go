@@ -0,0 +1,177 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+)
+
+func (u *UserAdmApiHandlers) CreateServiceAccountHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var a model.ServiceAccountNew
+	if err := decodeJsonStrict(r, &a); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := a.Validate(); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	account, err := u.userAdm.CreateServiceAccount(ctx, a)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.Header().Add("Location", "serviceaccounts/"+account.ID)
+	w.WriteHeader(http.StatusCreated)
+	w.WriteJson(account)
+}
+
+func (u *UserAdmApiHandlers) GetServiceAccountsHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	accounts, err := u.userAdm.GetServiceAccounts(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(accounts)
+}
+
+func (u *UserAdmApiHandlers) GetServiceAccountHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	account, err := u.userAdm.GetServiceAccount(ctx, r.PathParam("id"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	if account == nil {
+		restErr(w, r, l, store.ErrServiceAccountNotFound, http.StatusNotFound)
+		return
+	}
+
+	w.WriteJson(account)
+}
+
+func (u *UserAdmApiHandlers) UpdateServiceAccountHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var update model.ServiceAccountUpdate
+	if err := decodeJsonStrict(r, &update); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := update.Validate(); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	account, err := u.userAdm.UpdateServiceAccount(ctx, r.PathParam("id"), update)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(account)
+}
+
+func (u *UserAdmApiHandlers) DeleteServiceAccountHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := u.userAdm.DeleteServiceAccount(ctx, r.PathParam("id"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// IssueServiceAccountTokenHandler returns a signed token of the service
+// account; the request body is optional
+func (u *UserAdmApiHandlers) IssueServiceAccountTokenHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var req model.ServiceAccountTokenRequest
+	err := decodeJsonStrict(r, &req)
+	if err != nil && errors.Cause(err) != rest.ErrJsonPayloadEmpty {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	token, err := u.userAdm.IssueServiceAccountToken(ctx, r.PathParam("id"), req)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	raw, err := u.userAdm.SignToken(ctx, token)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jwt")
+	w.(http.ResponseWriter).Write([]byte(raw))
+}
+
+func (u *UserAdmApiHandlers) RevokeServiceAccountTokensHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := u.userAdm.RevokeServiceAccountTokens(ctx, r.PathParam("id"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,346 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
+)
+
+func TestUserAdmApiCreateServiceAccount(t *testing.T) {
+	t.Parallel()
+
+	created := time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaAccount *model.ServiceAccountNew
+		uaOut     *model.ServiceAccount
+		uaError   error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"name":        "ci",
+				"description": "deployment pipeline",
+			},
+			uaAccount: &model.ServiceAccountNew{
+				Name:        "ci",
+				Description: "deployment pipeline",
+			},
+			uaOut: &model.ServiceAccount{
+				ID:          "sa-1",
+				Name:        "ci",
+				Description: "deployment pipeline",
+				Scope:       "mender.*",
+				Owner:       "user-1",
+				CreatedTs:   created,
+				UpdatedTs:   created,
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				nil,
+				map[string]interface{}{
+					"id":          "sa-1",
+					"name":        "ci",
+					"description": "deployment pipeline",
+					"scope":       "mender.*",
+					"owner":       "user-1",
+					"created_ts":  created,
+					"updated_ts":  created,
+				},
+			),
+		},
+		"error: invalid name": {
+			body: map[string]interface{}{
+				"name": "ci pipeline",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrInvalidServiceAccountName.Error(),
+					model.ErrInvalidServiceAccountName),
+			),
+		},
+		"error: password": {
+			body: map[string]interface{}{
+				"name":     "ci",
+				"password": "secret",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("password: unknown field",
+					model.NewFieldError("password", "unknown field")),
+			),
+		},
+		"error: unknown owner": {
+			body: map[string]interface{}{
+				"name":  "ci",
+				"owner": "user-2",
+			},
+			uaAccount: &model.ServiceAccountNew{Name: "ci", Owner: "user-2"},
+			uaError:   model.ErrInvalidServiceAccountOwner,
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrInvalidServiceAccountOwner.Error(),
+					model.ErrInvalidServiceAccountOwner),
+			),
+		},
+		"error: duplicate name": {
+			body: map[string]interface{}{
+				"name": "ci",
+			},
+			uaAccount: &model.ServiceAccountNew{Name: "ci"},
+			uaError:   store.ErrDuplicateServiceAccountName,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnprocessableEntity,
+				nil,
+				restError(store.ErrDuplicateServiceAccountName.Error(),
+					"duplicate_service_account_name"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			if tc.uaAccount != nil {
+				uadm.On("CreateServiceAccount", mtesting.ContextMatcher(), *tc.uaAccount).
+					Return(tc.uaOut, tc.uaError)
+			}
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodPost,
+				"http://1.2.3.4/api/management/v1/useradm/serviceaccounts",
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+			uadm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserAdmApiGetServiceAccount(t *testing.T) {
+	t.Parallel()
+
+	uadm := &museradm.App{}
+	uadm.On("GetServiceAccount", mtesting.ContextMatcher(), "sa-1").
+		Return(nil, nil)
+
+	api := makeMockApiHandler(t, uadm, nil)
+
+	req := makeReq(http.MethodGet,
+		"http://1.2.3.4/api/management/v1/useradm/serviceaccounts/sa-1",
+		"",
+		nil)
+
+	recorded := test.RunRequest(t, api, req)
+	mt.CheckResponse(t, mt.NewJSONResponse(
+		http.StatusNotFound,
+		nil,
+		restError(store.ErrServiceAccountNotFound.Error(), "service_account_not_found"),
+	), recorded)
+}
+
+func TestUserAdmApiUpdateServiceAccount(t *testing.T) {
+	t.Parallel()
+
+	scope := "mender.users:read"
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaUpdate *model.ServiceAccountUpdate
+		uaOut    *model.ServiceAccount
+		uaError  error
+
+		status int
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"scope": scope,
+			},
+			uaUpdate: &model.ServiceAccountUpdate{Scope: &scope},
+			uaOut:    &model.ServiceAccount{ID: "sa-1", Scope: scope},
+
+			status: http.StatusOK,
+		},
+		"error: name": {
+			body: map[string]interface{}{
+				"name": "other",
+			},
+
+			status: http.StatusBadRequest,
+		},
+		"error: not found": {
+			body: map[string]interface{}{
+				"scope": scope,
+			},
+			uaUpdate: &model.ServiceAccountUpdate{Scope: &scope},
+			uaError:  store.ErrServiceAccountNotFound,
+
+			status: http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			if tc.uaUpdate != nil {
+				uadm.On("UpdateServiceAccount", mtesting.ContextMatcher(),
+					"sa-1", *tc.uaUpdate).
+					Return(tc.uaOut, tc.uaError)
+			}
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodPut,
+				"http://1.2.3.4/api/management/v1/useradm/serviceaccounts/sa-1",
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, api, req)
+			recorded.CodeIs(tc.status)
+			uadm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserAdmApiIssueServiceAccountToken(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaRequest *model.ServiceAccountTokenRequest
+		uaToken   *jwt.Token
+		uaError   error
+
+		signErr error
+
+		status int
+	}{
+		"ok, no body": {
+			uaRequest: &model.ServiceAccountTokenRequest{},
+			uaToken:   &jwt.Token{Id: "t1"},
+
+			status: http.StatusOK,
+		},
+		"ok, expires in": {
+			body:      map[string]interface{}{"expires_in": 3600},
+			uaRequest: &model.ServiceAccountTokenRequest{ExpiresIn: 3600},
+			uaToken:   &jwt.Token{Id: "t1"},
+
+			status: http.StatusOK,
+		},
+		"error: negative expires in": {
+			body: map[string]interface{}{"expires_in": -1},
+
+			status: http.StatusBadRequest,
+		},
+		"error: not found": {
+			uaRequest: &model.ServiceAccountTokenRequest{},
+			uaError:   store.ErrServiceAccountNotFound,
+
+			status: http.StatusNotFound,
+		},
+		"error: sign": {
+			uaRequest: &model.ServiceAccountTokenRequest{},
+			uaToken:   &jwt.Token{Id: "t1"},
+			signErr:   errors.New("sign failed"),
+
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			if tc.uaRequest != nil {
+				uadm.On("IssueServiceAccountToken", mtesting.ContextMatcher(),
+					"sa-1", *tc.uaRequest).
+					Return(tc.uaToken, tc.uaError)
+			}
+			uadm.On("SignToken", mock.Anything, tc.uaToken).
+				Return("signed.token", tc.signErr)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := test.MakeSimpleRequest(http.MethodPost,
+				"http://1.2.3.4/api/management/v1/useradm/serviceaccounts/sa-1/tokens",
+				tc.body)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+			recorded.CodeIs(tc.status)
+			if tc.status == http.StatusOK {
+				assert.Equal(t, "application/jwt",
+					recorded.Recorder.HeaderMap.Get("Content-Type"))
+				recorded.BodyIs("signed.token")
+			}
+		})
+	}
+}
+
+func TestUserAdmApiRevokeServiceAccountTokens(t *testing.T) {
+	t.Parallel()
+
+	uadm := &museradm.App{}
+	uadm.On("RevokeServiceAccountTokens", mtesting.ContextMatcher(), "sa-1").
+		Return(store.ErrServiceAccountNotFound)
+
+	api := makeMockApiHandler(t, uadm, nil)
+
+	req := makeReq(http.MethodDelete,
+		"http://1.2.3.4/api/management/v1/useradm/serviceaccounts/sa-1/tokens",
+		"",
+		nil)
+
+	recorded := test.RunRequest(t, api, req)
+	mt.CheckResponse(t, mt.NewJSONResponse(
+		http.StatusNotFound,
+		nil,
+		restError(store.ErrServiceAccountNotFound.Error(), "service_account_not_found"),
+	), recorded)
+}
@@ -0,0 +1,242 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/schema"
+	"github.com/mendersoftware/useradm/store"
+)
+
+var (
+	ErrSettingsSchemaNotFound = errors.New("settings schema not set")
+)
+
+func (u *UserAdmApiHandlers) SaveSettingsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var settings map[string]interface{}
+
+	err := r.DecodeJsonPayload(&settings)
+	if err != nil {
+		restErr(w, r, l, errors.New("cannot parse request body as json"), http.StatusBadRequest)
+		return
+	}
+
+	etag, err := u.userAdm.SaveSettings(ctx, settings, parseIfMatch(r))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	setETag(w, etag)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (u *UserAdmApiHandlers) GetSettingsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	settings, err := u.userAdm.GetSettings(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	etag, _ := settings["etag"].(string)
+	setETag(w, etag)
+	w.WriteJson(settings)
+}
+
+func (u *UserAdmApiHandlers) GetSettingsHistoryHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	versions, err := u.userAdm.GetSettingsHistory(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(versions)
+}
+
+func (u *UserAdmApiHandlers) RollbackSettingsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	etag, err := u.userAdm.RollbackSettings(ctx, r.PathParam("etag"), parseIfMatch(r))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	setETag(w, etag)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) GetSettingHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	settings, err := u.userAdm.GetSettings(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	value, ok := settings[r.PathParam("key")]
+	if !ok {
+		restErr(w, r, l, store.ErrSettingNotFound, http.StatusNotFound)
+		return
+	}
+
+	etag, _ := settings["etag"].(string)
+	setETag(w, etag)
+	w.WriteJson(value)
+}
+
+func (u *UserAdmApiHandlers) SaveSettingHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var value interface{}
+
+	err := r.DecodeJsonPayload(&value)
+	if err != nil {
+		restErr(w, r, l, errors.New("cannot parse request body as json"), http.StatusBadRequest)
+		return
+	}
+
+	etag, err := u.userAdm.SaveSetting(ctx, r.PathParam("key"), value, parseIfMatch(r))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	setETag(w, etag)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) DeleteSettingHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	etag, err := u.userAdm.DeleteSetting(ctx, r.PathParam("key"), parseIfMatch(r))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	setETag(w, etag)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) SaveTenantSettingsSchemaHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("tenant id must be provided"), http.StatusBadRequest)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
+
+	data, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		restErr(w, r, l, errors.Wrap(err, "failed to read request body"),
+			http.StatusBadRequest)
+		return
+	}
+
+	if _, err := schema.Parse(data); err != nil {
+		restErr(w, r, l, errors.Wrap(err, "invalid schema"), http.StatusBadRequest)
+		return
+	}
+
+	if err := u.userAdm.SaveSettingsSchema(ctx, string(data)); err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) GetTenantSettingsSchemaHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("tenant id must be provided"), http.StatusBadRequest)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
+
+	data, err := u.userAdm.GetSettingsSchema(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	if data == "" {
+		restErr(w, r, l, ErrSettingsSchemaNotFound, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.(http.ResponseWriter).Write([]byte(data))
+}
+
+func (u *UserAdmApiHandlers) DeleteTenantSettingsSchemaHandler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("tenant id must be provided"), http.StatusBadRequest)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
+
+	if err := u.userAdm.DeleteSettingsSchema(ctx); err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
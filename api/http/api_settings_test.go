@@ -0,0 +1,835 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	"github.com/mendersoftware/useradm/user"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
+)
+
+func TestUserAdmApiSaveSettings(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body    interface{}
+		ifMatch string
+
+		uaIfMatch []string
+		uaError   error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"foo": "foo-val",
+				"bar": "bar-val",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				map[string]string{"ETag": `"v2"`},
+				nil,
+			),
+		},
+		"ok, if-match": {
+			body: map[string]interface{}{
+				"foo": "foo-val",
+			},
+			ifMatch: `"v1"`,
+
+			uaIfMatch: []string{"v1"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				map[string]string{"ETag": `"v2"`},
+				nil,
+			),
+		},
+		"ok, empty": {
+			body: map[string]interface{}{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				nil,
+				nil,
+			),
+		},
+		"error, etag mismatch": {
+			body: map[string]interface{}{
+				"foo": "foo-val",
+			},
+			ifMatch: `"v0"`,
+
+			uaIfMatch: []string{"v0"},
+			uaError:   store.ErrSettingsETagMismatch,
+
+			checker: mt.NewJSONResponse(
+				http.StatusPreconditionFailed,
+				nil,
+				restError(store.ErrSettingsETagMismatch.Error(), "etag_mismatch"),
+			),
+		},
+		"error, invalid settings": {
+			body: map[string]interface{}{
+				"password_min_length": float64(4),
+				"session_length":      "1h",
+			},
+
+			uaError: model.FieldErrors{
+				model.NewFieldError("password_min_length",
+					"must be an integer between 8 and 128"),
+				model.NewFieldError("session_length",
+					"must be an integer between 60 and 2592000"),
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("password_min_length: must be an integer between 8 and 128; "+
+					"session_length: must be an integer between 60 and 2592000",
+					model.NewFieldError("password_min_length",
+						"must be an integer between 8 and 128"),
+					model.NewFieldError("session_length",
+						"must be an integer between 60 and 2592000")),
+			),
+		},
+		"error, no identity": {
+			body: map[string]interface{}{
+				"foo": "foo-val",
+			},
+
+			uaError: useradm.ErrUnauthorized,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnauthorized,
+				nil,
+				restError(useradm.ErrUnauthorized.Error(), "unauthorized"),
+			),
+		},
+		"error, not json": {
+			body: "asdf",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("cannot parse request body as json", "bad_request"),
+			),
+		},
+		"error, useradm internal": {
+			body: map[string]interface{}{
+				"foo": "foo-val",
+				"bar": "bar-val",
+			},
+
+			uaError: errors.New("generic"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("SaveSettings", ctx, tc.body, tc.uaIfMatch).
+				Return("v2", tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req := makeReq(http.MethodPost,
+				"http://1.2.3.4/api/management/v1/useradm/settings",
+				"",
+				tc.body)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetSettings(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaSettings map[string]interface{}
+		uaError    error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaSettings: map[string]interface{}{
+				"foo":  "foo-val",
+				"bar":  "bar-val",
+				"etag": "v1",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				map[string]string{"ETag": `"v1"`},
+				map[string]interface{}{
+					"foo":  "foo-val",
+					"bar":  "bar-val",
+					"etag": "v1",
+				},
+			),
+		},
+		"error: generic": {
+			uaError: errors.New("failed to get settings"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("GetSettings", ctx).Return(tc.uaSettings, tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v1/useradm/settings",
+				"",
+				nil)
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetSettingsHistory(t *testing.T) {
+	t.Parallel()
+
+	replaced := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		uaVersions []model.SettingsVersion
+		uaError    error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaVersions: []model.SettingsVersion{
+				{
+					ETag:       "v1",
+					ReplacedTs: replaced,
+					Settings:   map[string]interface{}{"foo": "foo-val"},
+				},
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]model.SettingsVersion{
+					{
+						ETag:       "v1",
+						ReplacedTs: replaced,
+						Settings:   map[string]interface{}{"foo": "foo-val"},
+					},
+				},
+			),
+		},
+		"ok, empty": {
+			uaVersions: []model.SettingsVersion{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]model.SettingsVersion{},
+			),
+		},
+		"error: generic": {
+			uaError: errors.New("failed to get settings history"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("GetSettingsHistory", ctx).Return(tc.uaVersions, tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v1/useradm/settings/history",
+				"",
+				nil)
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiRollbackSettings(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		ifMatch string
+
+		uaIfMatch []string
+		uaError   error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				map[string]string{"ETag": `"v3"`},
+				nil,
+			),
+		},
+		"ok, if-match": {
+			ifMatch:   `"v2"`,
+			uaIfMatch: []string{"v2"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				map[string]string{"ETag": `"v3"`},
+				nil,
+			),
+		},
+		"error: version not found": {
+			uaError: store.ErrSettingsVersionNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrSettingsVersionNotFound.Error(),
+					"settings_version_not_found"),
+			),
+		},
+		"error: etag mismatch": {
+			ifMatch:   `"v0"`,
+			uaIfMatch: []string{"v0"},
+			uaError:   store.ErrSettingsETagMismatch,
+
+			checker: mt.NewJSONResponse(
+				http.StatusPreconditionFailed,
+				nil,
+				restError(store.ErrSettingsETagMismatch.Error(), "etag_mismatch"),
+			),
+		},
+		"error: generic": {
+			uaError: errors.New("db connection failed"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("RollbackSettings", ctx, "v1", tc.uaIfMatch).
+				Return("v3", tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req := makeReq(http.MethodPost,
+				"http://1.2.3.4/api/management/v1/useradm/settings/history/v1/rollback",
+				"",
+				nil)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetSetting(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		key string
+
+		uaSettings map[string]interface{}
+		uaError    error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			key: "foo",
+			uaSettings: map[string]interface{}{
+				"foo":  []interface{}{"a", "b"},
+				"etag": "v1",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				map[string]string{"ETag": `"v1"`},
+				[]interface{}{"a", "b"},
+			),
+		},
+		"error: not found": {
+			key: "bar",
+			uaSettings: map[string]interface{}{
+				"foo":  "foo-val",
+				"etag": "v1",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrSettingNotFound.Error(), "setting_not_found"),
+			),
+		},
+		"error: generic": {
+			key:     "foo",
+			uaError: errors.New("failed to get settings"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("GetSettings", ctx).Return(tc.uaSettings, tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v1/useradm/settings/"+tc.key,
+				"",
+				nil)
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiSaveSetting(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		key     string
+		body    interface{}
+		ifMatch string
+
+		uaIfMatch []string
+		uaError   error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			key:  "foo",
+			body: "foo-val",
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				map[string]string{"ETag": `"v2"`},
+				nil,
+			),
+		},
+		"ok, if-match": {
+			key:     model.SettingPasswordMinLength,
+			body:    12,
+			ifMatch: `"v1"`,
+
+			uaIfMatch: []string{"v1"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				map[string]string{"ETag": `"v2"`},
+				nil,
+			),
+		},
+		"error, invalid": {
+			key:  "foo",
+			body: strings.Repeat("a", useradm.MaxSettingSize),
+
+			uaError: model.NewFieldError("foo", "must not be larger than 16384 bytes"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("foo: must not be larger than 16384 bytes",
+					model.NewFieldError("foo", "must not be larger than 16384 bytes")),
+			),
+		},
+		"error, no body": {
+			key: "foo",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("cannot parse request body as json", "bad_request"),
+			),
+		},
+		"error, etag mismatch": {
+			key:     "foo",
+			body:    "foo-val",
+			ifMatch: `"v0"`,
+
+			uaIfMatch: []string{"v0"},
+			uaError:   store.ErrSettingsETagMismatch,
+
+			checker: mt.NewJSONResponse(
+				http.StatusPreconditionFailed,
+				nil,
+				restError(store.ErrSettingsETagMismatch.Error(), "etag_mismatch"),
+			),
+		},
+		"error, useradm internal": {
+			key:     "foo",
+			body:    "foo-val",
+			uaError: errors.New("generic"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			if tc.body != nil {
+				// numbers are decoded as float64
+				value := tc.body
+				if n, ok := value.(int); ok {
+					value = float64(n)
+				}
+				uadm.On("SaveSetting", ctx, tc.key, value, tc.uaIfMatch).
+					Return("v2", tc.uaError)
+			}
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req := makeReq(http.MethodPut,
+				"http://1.2.3.4/api/management/v1/useradm/settings/"+tc.key,
+				"",
+				tc.body)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiDeleteSetting(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		key     string
+		ifMatch string
+
+		uaIfMatch []string
+		uaError   error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			key: "foo",
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				map[string]string{"ETag": `"v2"`},
+				nil,
+			),
+		},
+		"ok, if-match": {
+			key:       "foo",
+			ifMatch:   `"v1"`,
+			uaIfMatch: []string{"v1"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				map[string]string{"ETag": `"v2"`},
+				nil,
+			),
+		},
+		"error: required": {
+			key:     "foo",
+			uaError: model.NewFieldError("foo", "is required"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("foo: is required",
+					model.NewFieldError("foo", "is required")),
+			),
+		},
+		"error: not found": {
+			key:     "foo",
+			uaError: store.ErrSettingNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrSettingNotFound.Error(), "setting_not_found"),
+			),
+		},
+		"error: etag mismatch": {
+			key:       "foo",
+			ifMatch:   `"v0"`,
+			uaIfMatch: []string{"v0"},
+			uaError:   store.ErrSettingsETagMismatch,
+
+			checker: mt.NewJSONResponse(
+				http.StatusPreconditionFailed,
+				nil,
+				restError(store.ErrSettingsETagMismatch.Error(), "etag_mismatch"),
+			),
+		},
+		"error: useradm internal": {
+			key:     "foo",
+			uaError: errors.New("generic"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("DeleteSetting", ctx, tc.key, tc.uaIfMatch).
+				Return("v2", tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req := makeReq(http.MethodDelete,
+				"http://1.2.3.4/api/management/v1/useradm/settings/"+tc.key,
+				"",
+				nil)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiTenantSettingsSchema(t *testing.T) {
+	t.Parallel()
+
+	const validSchema = `{"type": "object", "required": ["theme"]}`
+
+	testCases := map[string]struct {
+		method string
+		body   string
+
+		uaSchema string
+		uaError  error
+
+		checker mt.ResponseChecker
+	}{
+		"ok: put": {
+			method: http.MethodPut,
+			body:   validSchema,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: put, invalid schema": {
+			method: http.MethodPut,
+			body:   `{"type": "object", "allOf": []}`,
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError(`invalid schema: unsupported keyword "allOf"`, "bad_request"),
+			),
+		},
+		"error: put, useradm internal": {
+			method:  http.MethodPut,
+			body:    validSchema,
+			uaError: errors.New("db connection failed"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+		"ok: get": {
+			method:   http.MethodGet,
+			uaSchema: validSchema,
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				map[string]interface{}{
+					"type":     "object",
+					"required": []interface{}{"theme"},
+				},
+			),
+		},
+		"error: get, not set": {
+			method: http.MethodGet,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(ErrSettingsSchemaNotFound.Error(), "settings_schema_not_found"),
+			),
+		},
+		"ok: delete": {
+			method: http.MethodDelete,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: delete, useradm internal": {
+			method:  http.MethodDelete,
+			uaError: errors.New("db connection failed"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mock.MatchedBy(func(c context.Context) bool {
+				return identity.FromContext(c).Tenant == "1"
+			})
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("SaveSettingsSchema", ctx, tc.body).Return(tc.uaError)
+			uadm.On("GetSettingsSchema", ctx).Return(tc.uaSchema, tc.uaError)
+			uadm.On("DeleteSettingsSchema", ctx).Return(tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req, _ := http.NewRequest(tc.method,
+				"http://1.2.3.4/api/internal/v1/useradm/tenants/1/settings/schema",
+				strings.NewReader(tc.body))
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+func (u *UserAdmApiHandlers) AddUserEmailHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var e model.UserEmailNew
+	if err := decodeJsonStrict(r, &e); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := e.Validate(); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathParam("id")
+	email, err := u.userAdm.AddUserEmail(ctx, id, e)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.Header().Add("Location", "emails/"+url.PathEscape(email.Email))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (u *UserAdmApiHandlers) DeleteUserEmailHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	email, err := emailPathParam(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err = u.userAdm.DeleteUserEmail(ctx, r.PathParam("id"), email)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) VerifyUserEmailHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	email, err := emailPathParam(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	var v model.EmailVerification
+	if err := decodeJsonStrict(r, &v); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := v.Validate(); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err = u.userAdm.VerifyUserEmail(ctx, r.PathParam("id"), email, v.Code)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) SetPrimaryEmailHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	email, err := emailPathParam(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err = u.userAdm.SetPrimaryEmail(ctx, r.PathParam("id"), email)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// emailPathParam returns the email from the request path; the router
+// leaves the path parameters escaped
+func emailPathParam(r *rest.Request) (string, error) {
+	email, err := url.PathUnescape(r.PathParam("email"))
+	if err != nil {
+		return "", errors.Wrap(err, "invalid email")
+	}
+	return email, nil
+}
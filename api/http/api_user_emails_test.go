@@ -0,0 +1,307 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest/test"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	useradm "github.com/mendersoftware/useradm/user"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
+)
+
+func TestUserAdmApiAddUserEmail(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"email": "foo@baz.com",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				nil,
+				nil,
+			),
+		},
+		"error: invalid email": {
+			body: map[string]interface{}{
+				"email": "foobaz",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("email: foobaz does not validate as email",
+					model.NewFieldError("email", "foobaz does not validate as email")),
+			),
+		},
+		"error: no user": {
+			body: map[string]interface{}{
+				"email": "foo@baz.com",
+			},
+			uaError: store.ErrUserNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrUserNotFound.Error(), "user_not_found"),
+			),
+		},
+		"error: duplicate email": {
+			body: map[string]interface{}{
+				"email": "foo@baz.com",
+			},
+			uaError: store.ErrDuplicateEmail,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnprocessableEntity,
+				nil,
+				restError(store.ErrDuplicateEmail.Error(), "duplicate_email"),
+			),
+		},
+		"error: useradm internal": {
+			body: map[string]interface{}{
+				"email": "foo@baz.com",
+			},
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("AddUserEmail", mtesting.ContextMatcher(), "1",
+				model.UserEmailNew{Email: "foo@baz.com"}).
+				Return(&model.UserEmail{Email: "foo@baz.com"}, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("POST",
+				"http://1.2.3.4/api/management/v1/useradm/users/1/emails",
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+
+			if recorded.Recorder.Code == http.StatusCreated {
+				assert.Equal(t, "emails/foo@baz.com",
+					recorded.Recorder.HeaderMap.Get("Location"))
+			}
+		})
+	}
+}
+
+func TestUserAdmApiVerifyUserEmail(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"code": "1234",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: no code": {
+			body: map[string]interface{}{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrEmptyCode.Error(), model.ErrEmptyCode),
+			),
+		},
+		"error: no such email": {
+			body: map[string]interface{}{
+				"code": "1234",
+			},
+			uaError: store.ErrUserEmailNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrUserEmailNotFound.Error(), "user_email_not_found"),
+			),
+		},
+		"error: invalid code": {
+			body: map[string]interface{}{
+				"code": "1234",
+			},
+			uaError: useradm.ErrInvalidVerificationCode,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnprocessableEntity,
+				nil,
+				restError(useradm.ErrInvalidVerificationCode.Error(),
+					"invalid_verification_code"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("VerifyUserEmail", mtesting.ContextMatcher(),
+				"1", "foo@baz.com", "1234").
+				Return(tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("POST",
+				"http://1.2.3.4/api/management/v1/useradm/users/1/emails/foo%40baz.com/verify",
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiDeleteUserEmail(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: no such email": {
+			uaError: store.ErrUserEmailNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrUserEmailNotFound.Error(), "user_email_not_found"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("DeleteUserEmail", mtesting.ContextMatcher(), "1", "foo@baz.com").
+				Return(tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("DELETE",
+				"http://1.2.3.4/api/management/v1/useradm/users/1/emails/foo@baz.com",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiSetPrimaryEmail(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: not verified": {
+			uaError: useradm.ErrEmailNotVerified,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnprocessableEntity,
+				nil,
+				restError(useradm.ErrEmailNotVerified.Error(), "email_not_verified"),
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("SetPrimaryEmail", mtesting.ContextMatcher(), "1", "foo@baz.com").
+				Return(tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("PUT",
+				"http://1.2.3.4/api/management/v1/useradm/users/1/emails/foo%40baz.com/primary",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
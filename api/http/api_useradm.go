@@ -15,8 +15,15 @@ package http
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/asaskevich/govalidator"
@@ -28,62 +35,251 @@ import (
 
 	"github.com/mendersoftware/useradm/authz"
 	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/scope"
 	"github.com/mendersoftware/useradm/store"
 	"github.com/mendersoftware/useradm/user"
 )
 
 const (
-	uriManagementAuthLogin = "/api/management/v1/useradm/auth/login"
-	uriManagementUser      = "/api/management/v1/useradm/users/:id"
-	uriManagementUsers     = "/api/management/v1/useradm/users"
-	uriManagementSettings  = "/api/management/v1/useradm/settings"
-
-	uriInternalAuthVerify = "/api/internal/v1/useradm/auth/verify"
-	uriInternalTenants    = "/api/internal/v1/useradm/tenants"
-	uriInternalTenantUser = "/api/internal/v1/useradm/tenants/:id/users"
-	uriInternalTokens     = "/api/internal/v1/useradm/tokens"
+	uriManagementAuthLogin      = "/api/management/v1/useradm/auth/login"
+	uriManagementAuthToken      = "/api/management/v1/useradm/auth/token"
+	uriManagementUser           = "/api/management/v1/useradm/users/:id"
+	uriManagementUserMe         = "/api/management/v1/useradm/users/me"
+	uriManagementUserMeSettings = "/api/management/v1/useradm/users/me/settings"
+	uriManagementUserLogins     = "/api/management/v1/useradm/users/:id/logins"
+	uriManagementUserEmails     = "/api/management/v1/useradm/users/:id/emails"
+	// emails contain dots, which the strict :param placeholder stops at
+	uriManagementUserEmail        = "/api/management/v1/useradm/users/:id/emails/#email"
+	uriManagementUserEmailVerify  = "/api/management/v1/useradm/users/:id/emails/#email/verify"
+	uriManagementUserEmailPrimary = "/api/management/v1/useradm/users/:id/emails/#email/primary"
+	uriManagementUsers            = "/api/management/v1/useradm/users"
+	uriManagementUsersCount       = "/api/management/v1/useradm/users/count"
+	uriManagementUsersBatch       = "/api/management/v1/useradm/users/batch"
+	uriManagementUsersImport      = "/api/management/v1/useradm/users/import"
+	uriManagementUsersExport      = "/api/management/v1/useradm/users/export"
+	uriManagementSettings         = "/api/management/v1/useradm/settings"
+	uriManagementSetting          = "/api/management/v1/useradm/settings/:key"
+	uriManagementSettingsHistory  = "/api/management/v1/useradm/settings/history"
+	uriManagementSettingsRollback = "/api/management/v1/useradm/settings/history/:etag/rollback"
+	uriManagementLimit            = "/api/management/v1/useradm/limits/:name"
+	uriManagementFeatures         = "/api/management/v1/useradm/features"
+	uriManagementPlan             = "/api/management/v1/useradm/plan"
+	uriManagementGroups           = "/api/management/v1/useradm/groups"
+	uriManagementGroup            = "/api/management/v1/useradm/groups/:id"
+	uriManagementGroupMembers     = "/api/management/v1/useradm/groups/:id/members"
+	uriManagementGroupMember      = "/api/management/v1/useradm/groups/:id/members/:userid"
+	uriManagementOAuthClients     = "/api/management/v1/useradm/clients"
+	uriManagementOAuthClient      = "/api/management/v1/useradm/clients/:id"
+
+	uriManagementOIDCDiscovery = "/api/management/v1/useradm/oidc/.well-known/openid-configuration"
+	uriManagementOIDCJWKS      = "/api/management/v1/useradm/oidc/jwks"
+	uriManagementOIDCAuthorize = "/api/management/v1/useradm/oidc/authorize"
+	uriManagementOIDCUserinfo  = "/api/management/v1/useradm/oidc/userinfo"
+
+	uriManagementAuthDeviceCode   = "/api/management/v1/useradm/auth/device/code"
+	uriManagementAuthDeviceToken  = "/api/management/v1/useradm/auth/device/token"
+	uriManagementAuthDeviceVerify = "/api/management/v1/useradm/auth/device/verify"
+
+	uriManagementAuthMagicLink      = "/api/management/v1/useradm/auth/magic-link"
+	uriManagementAuthMagicLinkLogin = "/api/management/v1/useradm/auth/magic-link/login"
+
+	uriManagementServiceAccounts      = "/api/management/v1/useradm/serviceaccounts"
+	uriManagementServiceAccount       = "/api/management/v1/useradm/serviceaccounts/:id"
+	uriManagementServiceAccountTokens = "/api/management/v1/useradm/serviceaccounts/:id/tokens"
+
+	uriInternalAuthVerify           = "/api/internal/v1/useradm/auth/verify"
+	uriInternalUsers                = "/api/internal/v1/useradm/users"
+	uriInternalTenants              = "/api/internal/v1/useradm/tenants"
+	uriInternalTenant               = "/api/internal/v1/useradm/tenants/:id"
+	uriInternalTenantLimit          = "/api/internal/v1/useradm/tenants/:id/limits/:name"
+	uriInternalTenantPlan           = "/api/internal/v1/useradm/tenants/:id/plan"
+	uriInternalTenantStatus         = "/api/internal/v1/useradm/tenants/:id/status"
+	uriInternalTenantFeatures       = "/api/internal/v1/useradm/tenants/:id/features"
+	uriInternalTenantFeature        = "/api/internal/v1/useradm/tenants/:id/features/:name"
+	uriInternalTenantMigrations     = "/api/internal/v1/useradm/tenants/:id/migrations"
+	uriInternalMigrations           = "/api/internal/v1/useradm/migrations"
+	uriInternalTenantSettingsSchema = "/api/internal/v1/useradm/tenants/:id/settings/schema"
+	uriInternalTenantUser           = "/api/internal/v1/useradm/tenants/:id/users"
+	uriInternalUserRestore          = "/api/internal/v1/useradm/tenants/:id/users/:userid/restore"
+	uriInternalUserData             = "/api/internal/v1/useradm/tenants/:id/users/:userid/data"
+	uriInternalUserImpersonate      = "/api/internal/v1/useradm/tenants/:id/users/:userid/impersonate"
+	uriInternalTokens               = "/api/internal/v1/useradm/tokens"
+	uriInternalTokenRevocation      = "/api/internal/v1/useradm/tokens/revocations/:id"
+	uriInternalJobs                 = "/api/internal/v1/useradm/jobs"
+	uriInternalUsageUsers           = "/api/internal/v1/useradm/usage/users"
+)
+
+const (
+	attributesQueryPrefix = "attributes."
+	queryFields           = "fields"
+
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeCSV        = "text/csv"
+
+	hdrTotalCount = "X-Total-Count"
+	// one-time code of the second factor, on logins
+	hdrOTP = "X-MEN-OTP"
 )
 
 var (
-	ErrAuthHeader   = errors.New("invalid or missing auth header")
-	ErrUserNotFound = errors.New("user not found")
+	ErrAuthHeader            = errors.New("invalid or missing auth header")
+	ErrUserNotFound          = errors.New("user not found")
+	ErrMergePatchContentType = errors.New("Bad Content-Type, expected '" +
+		mediaTypeMergePatch + "'")
 )
 
 type UserAdmApiHandlers struct {
 	userAdm useradm.App
 	db      store.DataStore
+	// serve Swagger UI for the management API
+	swaggerUI bool
+	// maintenance mode switched via the internal API, if set
+	maintenance *Maintenance
+	// metrics served via the internal API, if set
+	metrics *Metrics
+	// proxies the client address is taken from the forwarding headers of
+	trustedProxies []*net.IPNet
 }
 
 // return an ApiHandler for user administration and authentiacation app
-func NewUserAdmApiHandlers(userAdm useradm.App, db store.DataStore) ApiHandler {
+func NewUserAdmApiHandlers(userAdm useradm.App, db store.DataStore) *UserAdmApiHandlers {
 	return &UserAdmApiHandlers{
 		userAdm: userAdm,
 		db:      db,
 	}
 }
 
+// WithTrustedProxies makes the handlers take the client address from the
+// X-Forwarded-For and X-Real-IP headers of requests from the given proxies
+func (i *UserAdmApiHandlers) WithTrustedProxies(proxies []*net.IPNet) *UserAdmApiHandlers {
+	i.trustedProxies = proxies
+	return i
+}
+
+// ParseTrustedProxies parses the addresses and CIDR ranges of proxies
+func ParseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	nets := []*net.IPNet{}
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, errors.Errorf("invalid proxy address %q", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy address range %q", p)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
 func (i *UserAdmApiHandlers) GetApp() (rest.App, error) {
 	routes := []*rest.Route{
 		rest.Post(uriInternalAuthVerify, i.AuthVerifyHandler),
+		rest.Get(uriInternalUsers, i.LookupUserHandler),
 		rest.Post(uriInternalTenants, i.CreateTenantHandler),
+		rest.Delete(uriInternalTenant, i.DeleteTenantHandler),
+		rest.Get(uriInternalTenantMigrations, i.GetTenantMigrationStatusHandler),
+		rest.Get(uriInternalMigrations, i.GetMigrationProgressHandler),
+		rest.Get(uriInternalJobs, i.GetJobStatusesHandler),
+		rest.Get(uriInternalUsageUsers, i.GetUserCountsHandler),
+		rest.Put(uriInternalTenantLimit, i.SetTenantLimitHandler),
+		rest.Put(uriInternalTenantPlan, i.SetTenantPlanHandler),
+		rest.Put(uriInternalTenantStatus, i.SetTenantStatusHandler),
+		rest.Get(uriInternalTenantFeatures, i.GetTenantFeaturesHandler),
+		rest.Put(uriInternalTenantFeature, i.SetTenantFeatureHandler),
+		rest.Delete(uriInternalTenantFeature, i.ResetTenantFeatureHandler),
+		rest.Put(uriInternalTenantSettingsSchema, i.SaveTenantSettingsSchemaHandler),
+		rest.Get(uriInternalTenantSettingsSchema, i.GetTenantSettingsSchemaHandler),
+		rest.Delete(uriInternalTenantSettingsSchema, i.DeleteTenantSettingsSchemaHandler),
 		rest.Post(uriInternalTenantUser, i.CreateTenantUserHandler),
+		rest.Get(uriInternalTenantUser, i.GetTenantUsersHandler),
+		rest.Post(uriInternalUserRestore, i.RestoreTenantUserHandler),
+		rest.Get(uriInternalUserData, i.GetTenantUserDataHandler),
+		rest.Delete(uriInternalUserData, i.EraseTenantUserDataHandler),
+		rest.Post(uriInternalUserImpersonate, i.ImpersonateTenantUserHandler),
 		rest.Delete(uriInternalTokens, i.DeleteTokensHandler),
+		rest.Get(uriInternalTokenRevocation, i.GetTokenRevocationHandler),
 
 		rest.Post(uriManagementAuthLogin, i.AuthLoginHandler),
+		rest.Post(uriManagementAuthToken, i.AuthTokenHandler),
+		rest.Post(uriManagementAuthMagicLink, i.RequestLoginLinkHandler),
+		rest.Post(uriManagementAuthMagicLinkLogin, i.LoginLinkHandler),
+		rest.Post(uriManagementAuthDeviceCode, i.DeviceCodeHandler),
+		rest.Post(uriManagementAuthDeviceToken, i.DeviceTokenHandler),
+		rest.Get(uriManagementAuthDeviceVerify, i.GetDeviceAuthorizationHandler),
+		rest.Post(uriManagementAuthDeviceVerify, i.VerifyDeviceAuthorizationHandler),
 		rest.Post(uriManagementUsers, i.AddUserHandler),
+		rest.Post(uriManagementUsersBatch, i.AddUsersBatchHandler),
+		rest.Post(uriManagementUsersImport, i.ImportUsersHandler),
 		rest.Get(uriManagementUsers, i.GetUsersHandler),
+		rest.Head(uriManagementUsers, i.HeadUsersHandler),
+		// must precede uriManagementUser, the first defined route wins
+		rest.Delete(uriManagementUserMe, i.DeleteOwnUserHandler),
+		rest.Get(uriManagementUserMeSettings, i.GetOwnSettingsHandler),
+		rest.Put(uriManagementUserMeSettings, i.SaveOwnSettingsHandler),
+		rest.Get(uriManagementUsersCount, i.CountUsersHandler),
+		rest.Get(uriManagementUsersExport, i.ExportUsersHandler),
 		rest.Get(uriManagementUser, i.GetUserHandler),
+		rest.Head(uriManagementUser, i.HeadUserHandler),
 		rest.Put(uriManagementUser, i.UpdateUserHandler),
+		rest.Patch(uriManagementUser, i.PatchUserHandler),
 		rest.Delete(uriManagementUser, i.DeleteUserHandler),
+		rest.Get(uriManagementUserLogins, i.GetUserLoginsHandler),
+		rest.Post(uriManagementUserEmails, i.AddUserEmailHandler),
+		rest.Delete(uriManagementUserEmail, i.DeleteUserEmailHandler),
+		rest.Post(uriManagementUserEmailVerify, i.VerifyUserEmailHandler),
+		rest.Put(uriManagementUserEmailPrimary, i.SetPrimaryEmailHandler),
 		rest.Post(uriManagementSettings, i.SaveSettingsHandler),
 		rest.Get(uriManagementSettings, i.GetSettingsHandler),
+		rest.Get(uriManagementSettingsHistory, i.GetSettingsHistoryHandler),
+		rest.Post(uriManagementSettingsRollback, i.RollbackSettingsHandler),
+		rest.Get(uriManagementSetting, i.GetSettingHandler),
+		rest.Put(uriManagementSetting, i.SaveSettingHandler),
+		rest.Delete(uriManagementSetting, i.DeleteSettingHandler),
+		rest.Get(uriManagementLimit, i.GetLimitHandler),
+		rest.Get(uriManagementPlan, i.GetPlanHandler),
+		rest.Get(uriManagementFeatures, i.GetFeaturesHandler),
+		rest.Post(uriManagementGroups, i.CreateGroupHandler),
+		rest.Get(uriManagementGroups, i.GetGroupsHandler),
+		rest.Get(uriManagementGroup, i.GetGroupHandler),
+		rest.Delete(uriManagementGroup, i.DeleteGroupHandler),
+		rest.Get(uriManagementGroupMembers, i.GetGroupMembersHandler),
+		rest.Put(uriManagementGroupMember, i.AddGroupMemberHandler),
+		rest.Delete(uriManagementGroupMember, i.RemoveGroupMemberHandler),
+		rest.Post(uriManagementOAuthClients, i.CreateOAuthClientHandler),
+		rest.Get(uriManagementOAuthClients, i.GetOAuthClientsHandler),
+		rest.Delete(uriManagementOAuthClient, i.DeleteOAuthClientHandler),
+		rest.Get(uriManagementOIDCDiscovery, i.GetOIDCConfigurationHandler),
+		rest.Get(uriManagementOIDCJWKS, i.GetOIDCKeysHandler),
+		rest.Get(uriManagementOIDCAuthorize, i.OIDCAuthorizeHandler),
+		rest.Get(uriManagementOIDCUserinfo, i.GetUserInfoHandler),
+		rest.Post(uriManagementServiceAccounts, i.CreateServiceAccountHandler),
+		rest.Get(uriManagementServiceAccounts, i.GetServiceAccountsHandler),
+		rest.Get(uriManagementServiceAccount, i.GetServiceAccountHandler),
+		rest.Put(uriManagementServiceAccount, i.UpdateServiceAccountHandler),
+		rest.Delete(uriManagementServiceAccount, i.DeleteServiceAccountHandler),
+		rest.Post(uriManagementServiceAccountTokens, i.IssueServiceAccountTokenHandler),
+		rest.Delete(uriManagementServiceAccountTokens, i.RevokeServiceAccountTokensHandler),
 	}
 
-	routes = append(routes)
+	routes = append(routes, i.routesV2()...)
+	routes = append(routes, i.routesMaintenance()...)
+	routes = append(routes, i.routesMetrics()...)
+	routes = append(routes, i.routesOpenAPI(routes)...)
 
 	app, err := rest.MakeRouter(
 		// augment routes with OPTIONS handler
-		routing.AutogenOptionsRoutes(routes, routing.AllowHeaderOptionsGenerator)...,
+		withRouteLabels(routing.AutogenOptionsRoutes(routes,
+			routing.AllowHeaderOptionsGenerator))...,
 	)
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create router")
@@ -100,25 +296,27 @@ func (u *UserAdmApiHandlers) AuthLoginHandler(w rest.ResponseWriter, r *rest.Req
 	//parse auth header
 	email, pass, ok := r.BasicAuth()
 	if !ok {
-		rest_utils.RestErrWithLog(w, r, l,
+		restErr(w, r, l,
 			ErrAuthHeader, http.StatusUnauthorized)
 		return
 	}
 
-	token, err := u.userAdm.Login(ctx, email, pass)
+	token, err := u.userAdm.Login(ctx, email, pass, model.LoginInfo{
+		IP:        u.clientIP(r),
+		UserAgent: r.UserAgent(),
+		Scope:     r.URL.Query().Get("scope"),
+		OTP:       r.Header.Get(hdrOTP),
+	})
 	if err != nil {
-		switch {
-		case err == useradm.ErrUnauthorized || err == useradm.ErrTenantAccountSuspended:
-			rest_utils.RestErrWithLog(w, r, l, err, http.StatusUnauthorized)
-		default:
-			rest_utils.RestErrWithLogInternal(w, r, l, err)
-		}
+		restAppErr(w, r, l, err)
 		return
 	}
 
+	setMetricsTenant(r, token.Claims.Tenant)
+
 	raw, err := u.userAdm.SignToken(ctx, token)
 	if err != nil {
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		restAppErr(w, r, l, err)
 		return
 	}
 
@@ -134,16 +332,48 @@ func (u *UserAdmApiHandlers) AuthVerifyHandler(w rest.ResponseWriter, r *rest.Re
 	// note that the request has passed through authz - the token is valid
 	token := authz.GetRequestToken(r.Env)
 
+	// the gateway passes the original request's headers on
+	if tenantId := r.Header.Get(TenantHeader); tenantId != "" {
+		if !scope.Allows(token.Claims.Scope, scope.Operator) {
+			restErr(w, r, l, ErrTenantHeaderForbidden, http.StatusForbidden)
+			return
+		}
+		l.F(log.Ctx{
+			"operator_id":        token.Claims.Subject,
+			"operator_tenant_id": token.Claims.Tenant,
+			"tenant_id":          tenantId,
+			"method":             r.Header.Get("X-Original-Method"),
+			"uri":                r.Header.Get("X-Original-URI"),
+		}).Warn("operator request to another tenant")
+	}
+
 	err := u.userAdm.Verify(ctx, token)
 	if err != nil {
-		if err == useradm.ErrUnauthorized {
-			rest_utils.RestErrWithLog(w, r, l, useradm.ErrUnauthorized, http.StatusUnauthorized)
-		} else {
-			rest_utils.RestErrWithLogInternal(w, r, l, err)
-		}
+		restAppErr(w, r, l, err)
 		return
 	}
 
+	// every request made while impersonating a user is audited
+	if token.Claims.Impersonator != "" {
+		l.F(log.Ctx{
+			"user_id":      token.Claims.Subject,
+			"token_id":     token.Id,
+			"impersonator": token.Claims.Impersonator,
+			"method":       r.Header.Get("X-Original-Method"),
+			"uri":          r.Header.Get("X-Original-URI"),
+		}).Warn("request made with an impersonation token")
+	}
+
+	// the requests of the service accounts are told apart from the users'
+	if token.Claims.ServiceAccount {
+		l.F(log.Ctx{
+			"service_account_id": token.Claims.Subject,
+			"token_id":           token.Id,
+			"method":             r.Header.Get("X-Original-Method"),
+			"uri":                r.Header.Get("X-Original-URI"),
+		}).Info("request made with a service account token")
+	}
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -154,23 +384,25 @@ func (u *UserAdmApiHandlers) CreateTenantUserHandler(w rest.ResponseWriter, r *r
 
 	user, err := parseUserInternal(r)
 	if err != nil {
-		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	key, err := parseIdempotencyKey(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
 	tenantId := r.PathParam("id")
 	if tenantId == "" {
-		rest_utils.RestErrWithLog(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
 		return
 	}
 	ctx = getTenantContext(ctx, tenantId)
-	err = u.userAdm.CreateUserInternal(ctx, user)
+	_, err = u.userAdm.CreateUserInternalOnce(ctx, key, user)
 	if err != nil {
-		if err == store.ErrDuplicateEmail {
-			rest_utils.RestErrWithLog(w, r, l, err, http.StatusUnprocessableEntity)
-		} else {
-			rest_utils.RestErrWithLogInternal(w, r, l, err)
-		}
+		restAppErr(w, r, l, err)
 		return
 	}
 
@@ -178,274 +410,1141 @@ func (u *UserAdmApiHandlers) CreateTenantUserHandler(w rest.ResponseWriter, r *r
 
 }
 
-func (u *UserAdmApiHandlers) AddUserHandler(w rest.ResponseWriter, r *rest.Request) {
+func (u *UserAdmApiHandlers) LookupUserHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
-	user, err := parseUser(r)
+	login := r.URL.Query().Get("email")
+	if login == "" {
+		login = r.URL.Query().Get("username")
+	}
+	if login == "" {
+		restErr(w, r, l, errors.New("email or username must be provided"),
+			http.StatusBadRequest)
+		return
+	}
+
+	lookup, err := u.userAdm.LookupUser(ctx, login)
 	if err != nil {
-		if err == model.ErrPasswordTooShort {
-			rest_utils.RestErrWithLog(w, r, l, err, http.StatusUnprocessableEntity)
-		} else {
-			rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
-		}
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(lookup)
+}
+
+func (u *UserAdmApiHandlers) GetTenantUsersHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
 		return
 	}
+	ctx = getTenantContext(ctx, tenantId)
 
-	err = u.userAdm.CreateUser(ctx, user)
+	page, perPage, err := rest_utils.ParsePagination(r)
 	if err != nil {
-		if err == store.ErrDuplicateEmail {
-			rest_utils.RestErrWithLog(w, r, l, err, http.StatusUnprocessableEntity)
-		} else {
-			rest_utils.RestErrWithLogInternal(w, r, l, err)
-		}
+		restErr(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Add("Location", "users/"+string(user.ID))
-	w.WriteHeader(http.StatusCreated)
+	fltr, err := parseUserFilter(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	// ask for one more to find out whether there's a next page
+	fltr.Skip = int((page - 1) * perPage)
+	fltr.Limit = int(perPage + 1)
+
+	users, err := u.userAdm.GetUsers(ctx, *fltr)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	hasNext := len(users) > int(perPage)
+	if hasNext {
+		users = users[:perPage]
+	}
 
+	for _, link := range rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext) {
+		w.Header().Add(rest_utils.LinkHdr, link)
+	}
+	w.WriteJson(users)
 }
 
-func (u *UserAdmApiHandlers) GetUsersHandler(w rest.ResponseWriter, r *rest.Request) {
+func (u *UserAdmApiHandlers) RestoreTenantUserHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
-	users, err := u.userAdm.GetUsers(ctx)
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
+
+	err := u.userAdm.RestoreUser(ctx, r.PathParam("userid"))
 	if err != nil {
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		restAppErr(w, r, l, err)
 		return
 	}
 
-	w.WriteJson(users)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (u *UserAdmApiHandlers) GetUserHandler(w rest.ResponseWriter, r *rest.Request) {
+func (u *UserAdmApiHandlers) GetTenantUserDataHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
-	user, err := u.userAdm.GetUser(ctx, r.PathParam("id"))
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
+
+	data, err := u.userAdm.GetUserData(ctx, r.PathParam("userid"))
 	if err != nil {
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		restAppErr(w, r, l, err)
 		return
 	}
 
-	if user == nil {
-		rest_utils.RestErrWithLog(w, r, l, ErrUserNotFound, 404)
+	w.WriteJson(data)
+}
+
+func (u *UserAdmApiHandlers) EraseTenantUserDataHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
+
+	receipt, err := u.userAdm.EraseUser(ctx, r.PathParam("userid"))
+	if err != nil {
+		restAppErr(w, r, l, err)
 		return
 	}
 
-	w.WriteJson(user)
+	w.WriteJson(receipt)
 }
 
-func (u *UserAdmApiHandlers) UpdateUserHandler(w rest.ResponseWriter, r *rest.Request) {
+// ImpersonateTenantUserHandler issues a token acting as the user to a
+// super-admin, e.g. for support; the token is marked with the actor
+// and recorded in the user's login history
+func (u *UserAdmApiHandlers) ImpersonateTenantUserHandler(w rest.ResponseWriter,
+	r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
-	id := r.PathParam("id")
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
 
-	userUpdate, err := parseUserUpdate(r)
+	var imp model.Impersonation
+	if err := decodeJsonStrict(r, &imp); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := imp.Validate(); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	token, err := u.userAdm.Impersonate(ctx, r.PathParam("userid"), imp)
 	if err != nil {
-		if err == model.ErrPasswordTooShort {
-			rest_utils.RestErrWithLog(w, r, l, err, http.StatusUnprocessableEntity)
-		} else {
-			rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
-		}
+		restAppErr(w, r, l, err)
 		return
 	}
 
-	err = u.userAdm.UpdateUser(ctx, id, userUpdate)
+	raw, err := u.userAdm.SignToken(ctx, token)
 	if err != nil {
-		switch err {
-		case store.ErrDuplicateEmail:
-			rest_utils.RestErrWithLog(w, r, l, err, http.StatusUnprocessableEntity)
-		case store.ErrUserNotFound:
-			rest_utils.RestErrWithLog(w, r, l, err, http.StatusNotFound)
-		default:
-			rest_utils.RestErrWithLogInternal(w, r, l, err)
-		}
+		restAppErr(w, r, l, err)
+		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	w.Header().Set("Content-Type", "application/jwt")
+	w.(http.ResponseWriter).Write([]byte(raw))
 }
 
-func (u *UserAdmApiHandlers) DeleteUserHandler(w rest.ResponseWriter, r *rest.Request) {
+func (u *UserAdmApiHandlers) AddUserHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
-	err := u.userAdm.DeleteUser(ctx, r.PathParam("id"))
+	user, err := parseUser(r)
 	if err != nil {
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		restKnownErr(w, r, l, err, http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	key, err := parseIdempotencyKey(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	id, err := u.userAdm.CreateUserOnce(ctx, key, user)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.Header().Add("Location", "users/"+id)
+	w.WriteHeader(http.StatusCreated)
+
 }
 
-func parseUser(r *rest.Request) (*model.User, error) {
-	user := model.User{}
+func (u *UserAdmApiHandlers) GetUsersHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
 
-	//decode body
-	err := r.DecodeJsonPayload(&user)
+	l := log.FromContext(ctx)
+
+	fltr, err := parseUserFilter(r)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to decode request body")
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
 	}
 
-	if err := user.ValidateNew(); err != nil {
-		return nil, err
+	fltr.Fields, err = parseUserFields(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
 	}
 
-	return &user, nil
-}
+	// large lists can be streamed, the total count is not known
+	// before the last user is written then
+	if acceptsNDJSON(r) {
+		u.streamUsers(w, r, l, fltr, &ndjsonUserExporter{
+			w:      w.(http.ResponseWriter),
+			fields: fltr.Fields,
+		})
+		return
+	}
 
-func parseUserInternal(r *rest.Request) (*model.UserInternal, error) {
-	user := model.UserInternal{}
+	if !u.usersModified(w, r, l, fltr) {
+		return
+	}
 
-	//decode body
-	err := r.DecodeJsonPayload(&user)
+	total, err := u.userAdm.CountUsers(ctx, *fltr)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to decode request body")
+		restAppErr(w, r, l, err)
+		return
 	}
 
-	if err := user.ValidateNew(); err != nil {
-		return nil, err
+	users, err := u.userAdm.GetUsers(ctx, *fltr)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
 	}
 
-	return &user, nil
+	rsp, err := selectUsersFields(users, fltr.Fields)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.Header().Set(hdrTotalCount, strconv.Itoa(total))
+	w.WriteJson(rsp)
 }
 
-func parseUserUpdate(r *rest.Request) (*model.UserUpdate, error) {
-	userUpdate := model.UserUpdate{}
+// HeadUsersHandler returns the headers of the users list only,
+// for cheap freshness checks
+func (u *UserAdmApiHandlers) HeadUsersHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
 
-	//decode body
-	err := r.DecodeJsonPayload(&userUpdate)
+	l := log.FromContext(ctx)
+
+	fltr, err := parseUserFilter(r)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to decode request body")
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
 	}
 
-	if err := userUpdate.Validate(); err != nil {
-		return nil, err
+	version, err := u.userAdm.GetUsersVersion(ctx, *fltr)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
 	}
 
-	return &userUpdate, nil
+	etag := usersETag(version)
+	setETag(w, etag)
+	w.Header().Set(hdrTotalCount, strconv.Itoa(version.Count))
+
+	if ifNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
 }
 
-func readBodyRaw(r *rest.Request) ([]byte, error) {
-	content, err := ioutil.ReadAll(r.Body)
-	r.Body.Close()
+func (u *UserAdmApiHandlers) CountUsersHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	fltr, err := parseUserFilter(r)
 	if err != nil {
-		return nil, err
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
 	}
 
-	return content, nil
-}
+	n, err := u.userAdm.CountUsers(ctx, *fltr)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
 
-type newTenantRequest struct {
-	TenantID string `json:"tenant_id" valid:"required"`
+	w.Header().Set(hdrTotalCount, strconv.Itoa(n))
+	w.WriteJson(map[string]int{"count": n})
 }
 
-func (u *UserAdmApiHandlers) CreateTenantHandler(w rest.ResponseWriter, r *rest.Request) {
+func (u *UserAdmApiHandlers) GetUserHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
-	var newTenant newTenantRequest
+	fields, err := parseUserFields(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
 
-	if err := r.DecodeJsonPayload(&newTenant); err != nil {
-		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+	user, err := u.getUserFields(ctx, r.PathParam("id"), fields)
+	if err != nil {
+		restAppErr(w, r, l, err)
 		return
 	}
 
-	if _, err := govalidator.ValidateStruct(newTenant); err != nil {
-		rest_utils.RestErrWithLog(w, r, l, err, http.StatusBadRequest)
+	if user == nil {
+		restErr(w, r, l, ErrUserNotFound, 404)
 		return
 	}
 
-	err := u.userAdm.CreateTenant(ctx, model.NewTenant{
-		ID: newTenant.TenantID,
-	})
+	rsp, err := selectUserFields(user, fields)
 	if err != nil {
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		restAppErr(w, r, l, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	setETag(w, user.ETag)
+	w.WriteJson(rsp)
 }
 
-func getTenantContext(ctx context.Context, tenantId string) context.Context {
-	if ctx == nil {
-		ctx = context.Background()
+// HeadUserHandler returns the headers of the user information only,
+// for cheap existence and freshness checks
+func (u *UserAdmApiHandlers) HeadUserHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	user, err := u.userAdm.GetUser(ctx, r.PathParam("id"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
 	}
-	if tenantId != "" {
-		id := &identity.Identity{
-			Tenant: tenantId,
-		}
 
-		ctx = identity.WithContext(ctx, id)
+	if user == nil {
+		restErr(w, r, l, ErrUserNotFound, http.StatusNotFound)
+		return
 	}
 
-	return ctx
-}
+	setETag(w, user.ETag)
 
-func (u *UserAdmApiHandlers) DeleteTokensHandler(w rest.ResponseWriter, r *rest.Request) {
+	if user.ETag != "" && ifNoneMatch(r, user.ETag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
 
+func (u *UserAdmApiHandlers) GetUserLoginsHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
-	tenantId := r.URL.Query().Get("tenant_id")
-	if tenantId == "" {
-		rest_utils.RestErrWithLog(w, r, l, errors.New("tenant_id must be provided"), http.StatusBadRequest)
+	events, err := u.userAdm.GetLoginHistory(ctx, r.PathParam("id"))
+	if err != nil {
+		restAppErr(w, r, l, err)
 		return
 	}
-	userId := r.URL.Query().Get("user_id")
 
-	err := u.userAdm.DeleteTokens(ctx, tenantId, userId)
-	switch err {
-	case nil:
-		w.WriteHeader(http.StatusNoContent)
-	default:
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
-	}
+	w.WriteJson(events)
 }
 
-func (u *UserAdmApiHandlers) SaveSettingsHandler(w rest.ResponseWriter, r *rest.Request) {
+func (u *UserAdmApiHandlers) UpdateUserHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
-	var settings map[string]interface{}
+	id := r.PathParam("id")
 
-	err := r.DecodeJsonPayload(&settings)
+	userUpdate, err := parseUserUpdate(r)
 	if err != nil {
-		rest_utils.RestErrWithLog(w, r, l, errors.New("cannot parse request body as json"), http.StatusBadRequest)
+		restKnownErr(w, r, l, err, http.StatusBadRequest)
 		return
 	}
+	userUpdate.IfMatch = parseIfMatch(r)
 
-	err = u.db.SaveSettings(ctx, settings)
+	err = u.userAdm.UpdateUser(ctx, id, userUpdate)
 	if err != nil {
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		restAppErr(w, r, l, err)
+		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
+	setETag(w, userUpdate.ETag)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (u *UserAdmApiHandlers) GetSettingsHandler(w rest.ResponseWriter, r *rest.Request) {
+func (u *UserAdmApiHandlers) PatchUserHandler(w rest.ResponseWriter, r *rest.Request) {
 	ctx := r.Context()
 
 	l := log.FromContext(ctx)
 
-	settings, err := u.db.GetSettings(ctx)
+	if !IsMergePatchRequest(r) {
+		restErr(w, r, l, ErrMergePatchContentType,
+			http.StatusUnsupportedMediaType)
+		return
+	}
+
+	patch := map[string]interface{}{}
+	if err := r.DecodeJsonPayload(&patch); err != nil {
+		restErr(w, r, l,
+			errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathParam("id")
 
+	user, err := u.userAdm.GetUser(ctx, id)
 	if err != nil {
-		rest_utils.RestErrWithLogInternal(w, r, l, err)
+		restAppErr(w, r, l, err)
 		return
 	}
 
-	w.WriteJson(settings)
+	if user == nil {
+		restErr(w, r, l, ErrUserNotFound, http.StatusNotFound)
+		return
+	}
+
+	if etags := parseIfMatch(r); etags != nil && !etagMatches(etags, user.ETag) {
+		restErr(w, r, l, store.ErrETagMismatch,
+			http.StatusPreconditionFailed)
+		return
+	}
+
+	userUpdate, err := user.MergePatch(patch)
+	if err != nil {
+		restKnownErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if userUpdate.IsEmpty() {
+		setETag(w, user.ETag)
+	} else {
+		// the patch was applied to this version of the user, fail
+		// if it was modified in the meantime
+		userUpdate.IfMatch = []string{user.ETag}
+
+		err = u.userAdm.UpdateUser(ctx, id, userUpdate)
+		if err != nil {
+			restAppErr(w, r, l, err)
+			return
+		}
+		setETag(w, userUpdate.ETag)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) DeleteUserHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	err := u.userAdm.DeleteUser(ctx, r.PathParam("id"), parseIfMatch(r))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type deleteOwnUserRequest struct {
+	Password string `json:"password" valid:"required"`
+}
+
+func (u *UserAdmApiHandlers) DeleteOwnUserHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var req deleteOwnUserRequest
+
+	if err := decodeJsonStrict(r, &req); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := govalidator.ValidateStruct(req); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err := u.userAdm.DeleteOwnUser(ctx, req.Password)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseUser(r *rest.Request) (*model.User, error) {
+	user := model.User{}
+
+	//decode body
+	if err := decodeJsonStrict(r, &user); err != nil {
+		return nil, err
+	}
+
+	if err := user.ValidateNew(); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// parseUserFilter reads the user list filter from the query, attribute
+// filters are given as attributes.<key>=<value>
+func parseUserFilter(r *rest.Request) (*model.UserFilter, error) {
+	fltr := model.UserFilter{}
+
+	for k, v := range r.URL.Query() {
+		if !strings.HasPrefix(k, attributesQueryPrefix) {
+			continue
+		}
+		if fltr.Attributes == nil {
+			fltr.Attributes = map[string]string{}
+		}
+		fltr.Attributes[strings.TrimPrefix(k, attributesQueryPrefix)] = v[0]
+	}
+
+	if err := fltr.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &fltr, nil
+}
+
+// parseUserFields returns the user fields selected with
+// the fields query parameter, e.g. ?fields=id,email
+func parseUserFields(r *rest.Request) ([]string, error) {
+	q := r.URL.Query().Get(queryFields)
+	if q == "" {
+		return nil, nil
+	}
+
+	fields := []string{}
+	for _, f := range strings.Split(q, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+
+	if err := model.ValidateUserFields(fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// getUserFields fetches the user with the given fields only, all if
+// none are given; nil if there's no such user
+func (u *UserAdmApiHandlers) getUserFields(ctx context.Context, id string,
+	fields []string) (*model.User, error) {
+	if len(fields) == 0 {
+		return u.userAdm.GetUser(ctx, id)
+	}
+
+	users, err := u.userAdm.GetUsers(ctx, model.UserFilter{ID: id, Fields: fields})
+	if err != nil || len(users) == 0 {
+		return nil, err
+	}
+	return &users[0], nil
+}
+
+// selectUserFields returns the user with the given fields only,
+// or the whole user if none are given
+func selectUserFields(user *model.User, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return user, nil
+	}
+
+	data, err := json.Marshal(user)
+	if err != nil {
+		return nil, err
+	}
+
+	all := map[string]interface{}{}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	selected := map[string]interface{}{}
+	for _, f := range fields {
+		if v, ok := all[f]; ok {
+			selected[f] = v
+		}
+	}
+
+	return selected, nil
+}
+
+// selectUsersFields works like selectUserFields on a list of users
+func selectUsersFields(users []model.User, fields []string) (interface{}, error) {
+	if len(fields) == 0 {
+		return users, nil
+	}
+
+	selected := make([]interface{}, len(users))
+	for i := range users {
+		u, err := selectUserFields(&users[i], fields)
+		if err != nil {
+			return nil, err
+		}
+		selected[i] = u
+	}
+
+	return selected, nil
+}
+
+func parseUserInternal(r *rest.Request) (*model.UserInternal, error) {
+	user := model.UserInternal{}
+
+	//decode body
+	err := r.DecodeJsonPayload(&user)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode request body")
+	}
+
+	if err := user.ValidateNew(); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func parseUserUpdate(r *rest.Request) (*model.UserUpdate, error) {
+	userUpdate := model.UserUpdate{}
+
+	//decode body
+	if err := decodeJsonStrict(r, &userUpdate); err != nil {
+		return nil, err
+	}
+
+	if err := userUpdate.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &userUpdate, nil
+}
+
+// parseIfMatch returns the entity tags listed in the If-Match header,
+// nil if the header is not set or matches any version
+func parseIfMatch(r *rest.Request) []string {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+
+	etags := []string{}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil
+		}
+		// weak tags are kept quoted and never match, as If-Match
+		// requires the strong comparison
+		if len(tag) >= 2 && strings.HasPrefix(tag, `"`) && strings.HasSuffix(tag, `"`) {
+			tag = tag[1 : len(tag)-1]
+		}
+		etags = append(etags, tag)
+	}
+
+	return etags
+}
+
+func etagMatches(etags []string, etag string) bool {
+	for _, tag := range etags {
+		if tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// usersModified sets the ETag of the list of users matching the filter
+// and, if the client has the list in that version already, responds with
+// 304; returns false if the response was written
+func (u *UserAdmApiHandlers) usersModified(w rest.ResponseWriter, r *rest.Request,
+	l *log.Logger, fltr *model.UserFilter) bool {
+	version, err := u.userAdm.GetUsersVersion(r.Context(), *fltr)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return false
+	}
+
+	etag := usersETag(version)
+	setETag(w, etag)
+
+	if ifNoneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return false
+	}
+
+	return true
+}
+
+// usersETag returns the ETag of a list of users in the given version
+func usersETag(v *model.UsersVersion) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d:%d:%d:%d", v.Count, v.UpdatedTs.UnixNano(),
+		v.LastLoginTs.UnixNano(), v.FailedLoginAttempts)
+
+	return hex.EncodeToString(h.Sum(nil))[:32]
+}
+
+// ifNoneMatch returns true if the If-None-Match header lists the etag,
+// weak tags are compared as strong ones
+func ifNoneMatch(r *rest.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == `"`+etag+`"` {
+			return true
+		}
+	}
+
+	return false
+}
+
+func setETag(w rest.ResponseWriter, etag string) {
+	if etag != "" {
+		w.Header().Set("ETag", `"`+etag+`"`)
+	}
+}
+
+// clientIP returns the address of the client; the forwarding headers are
+// honoured only in requests from trusted proxies
+func (i *UserAdmApiHandlers) clientIP(r *rest.Request) string {
+	addr, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		addr = r.RemoteAddr
+	}
+	// anyone else can put anything in the headers
+	if !i.trustedProxy(addr) {
+		return addr
+	}
+
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		// each proxy appends the address it got the request from,
+		// the first one from the end not added by a trusted proxy
+		// is the client
+		hops := strings.Split(fwd, ",")
+		for j := len(hops) - 1; j >= 0; j-- {
+			addr = strings.TrimSpace(hops[j])
+			if !i.trustedProxy(addr) {
+				break
+			}
+		}
+		return addr
+	}
+
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+
+	return addr
+}
+
+func (i *UserAdmApiHandlers) trustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range i.trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func readBodyRaw(r *rest.Request) ([]byte, error) {
+	content, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return content, nil
+}
+
+type newTenantRequest struct {
+	TenantID string `json:"tenant_id" valid:"required"`
+	// first administrator, invited by email
+	AdminEmail string `json:"admin_email,omitempty" valid:"email"`
+}
+
+func (u *UserAdmApiHandlers) CreateTenantHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var newTenant newTenantRequest
+
+	if err := r.DecodeJsonPayload(&newTenant); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := govalidator.ValidateStruct(newTenant); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	err := u.userAdm.CreateTenant(ctx, model.NewTenant{
+		ID:         newTenant.TenantID,
+		AdminEmail: newTenant.AdminEmail,
+	})
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (u *UserAdmApiHandlers) DeleteTenantHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
+		return
+	}
+
+	if err := u.userAdm.DeleteTenant(ctx, tenantId); err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) GetTenantMigrationStatusHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	status, err := u.userAdm.GetTenantMigrationStatus(ctx, r.PathParam("id"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(status)
+}
+
+func (u *UserAdmApiHandlers) GetMigrationProgressHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	progress, err := u.userAdm.GetMigrationProgress(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+	if progress == nil {
+		restErr(w, r, l, errors.New("no migration was run"), http.StatusNotFound)
+		return
+	}
+
+	w.WriteJson(progress)
+}
+
+func (u *UserAdmApiHandlers) GetJobStatusesHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	statuses, err := u.userAdm.GetJobStatuses(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(statuses)
+}
+
+func (u *UserAdmApiHandlers) GetUserCountsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	counts, err := u.userAdm.GetUserCounts(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(counts)
+}
+
+func (u *UserAdmApiHandlers) SetTenantLimitHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
+
+	limit := model.Limit{}
+	if err := r.DecodeJsonPayload(&limit); err != nil {
+		restErr(w, r, l, errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+	limit.Name = r.PathParam("name")
+
+	if err := limit.Validate(); err != nil {
+		restKnownErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := u.userAdm.SetLimit(ctx, limit); err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) SetTenantPlanHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
+
+	plan := model.Plan{}
+	if err := decodeJsonStrict(r, &plan); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := plan.Validate(); err != nil {
+		restKnownErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := u.userAdm.SetPlan(ctx, plan); err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) SetTenantStatusHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.PathParam("id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("Entity not found"), http.StatusNotFound)
+		return
+	}
+	ctx = getTenantContext(ctx, tenantId)
+
+	status := model.TenantStatus{}
+	if err := r.DecodeJsonPayload(&status); err != nil {
+		restErr(w, r, l, errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+
+	if err := status.Validate(); err != nil {
+		restKnownErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := u.userAdm.SetTenantStatus(ctx, status.Status); err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getTenantContext(ctx context.Context, tenantId string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if tenantId != "" {
+		id := &identity.Identity{
+			Tenant: tenantId,
+		}
+
+		ctx = identity.WithContext(ctx, id)
+	}
+
+	return ctx
+}
+
+func (u *UserAdmApiHandlers) DeleteTokensHandler(w rest.ResponseWriter, r *rest.Request) {
+
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	tenantId := r.URL.Query().Get("tenant_id")
+	if tenantId == "" {
+		restErr(w, r, l, errors.New("tenant_id must be provided"), http.StatusBadRequest)
+		return
+	}
+	userId := r.URL.Query().Get("user_id")
+
+	// the tokens are rejected right away, and removed in the background
+	revocation, err := u.userAdm.RevokeTokens(ctx, tenantId, userId)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.Header().Add("Location", "tokens/revocations/"+revocation.ID)
+	w.WriteHeader(http.StatusAccepted)
+	w.WriteJson(revocation)
+}
+
+func (u *UserAdmApiHandlers) GetTokenRevocationHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	revocation, err := u.userAdm.GetTokenRevocation(ctx, r.PathParam("id"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+	if revocation == nil {
+		restErr(w, r, l, errors.New("token revocation not found"), http.StatusNotFound)
+		return
+	}
+
+	w.WriteJson(revocation)
+}
+
+func (u *UserAdmApiHandlers) GetLimitHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	usage, err := u.userAdm.GetLimitUsage(ctx, r.PathParam("name"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(usage)
+}
+
+func (u *UserAdmApiHandlers) GetPlanHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	plan, err := u.userAdm.GetPlan(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(plan)
+}
+
+func (u *UserAdmApiHandlers) GetOwnSettingsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	settings, err := u.userAdm.GetOwnSettings(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteJson(settings)
+}
+
+func (u *UserAdmApiHandlers) SaveOwnSettingsHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var settings map[string]interface{}
+
+	err := r.DecodeJsonPayload(&settings)
+	if err != nil || settings == nil {
+		restErr(w, r, l, errors.New("cannot parse request body as json"), http.StatusBadRequest)
+		return
+	}
+
+	err = u.userAdm.SaveOwnSettings(ctx, settings)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
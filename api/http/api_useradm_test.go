@@ -17,7 +17,9 @@ import (
 	"context"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 
@@ -37,8 +39,8 @@ import (
 	"github.com/mendersoftware/useradm/jwt"
 	"github.com/mendersoftware/useradm/keys"
 	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/scope"
 	"github.com/mendersoftware/useradm/store"
-	mstore "github.com/mendersoftware/useradm/store/mocks"
 	"github.com/mendersoftware/useradm/user"
 	museradm "github.com/mendersoftware/useradm/user/mocks"
 	mtesting "github.com/mendersoftware/useradm/utils/testing"
@@ -61,6 +63,7 @@ func TestUserAdmApiLogin(t *testing.T) {
 
 	testCases := map[string]struct {
 		inAuthHeader string
+		inOTP        string
 
 		uaToken *jwt.Token
 		uaError error
@@ -92,14 +95,14 @@ func TestUserAdmApiLogin(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusUnauthorized,
 				nil,
-				restError("unauthorized")),
+				restError("unauthorized", "unauthorized")),
 		},
 		"error: corrupt auth header": {
 			inAuthHeader: "ZW1haWw6cGFzcw==",
 			checker: mt.NewJSONResponse(
 				http.StatusUnauthorized,
 				nil,
-				restError("invalid or missing auth header")),
+				restError("invalid or missing auth header", "invalid_auth_header")),
 		},
 		"error: useradm create error": {
 			inAuthHeader: "Basic ZW1haWw6cGFzcw==",
@@ -107,7 +110,7 @@ func TestUserAdmApiLogin(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusInternalServerError,
 				nil,
-				restError("internal error")),
+				restError("internal error", "internal_error")),
 		},
 		"error: useradm error": {
 			inAuthHeader: "Basic ZW1haWw6cGFzcw==",
@@ -116,7 +119,7 @@ func TestUserAdmApiLogin(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusInternalServerError,
 				nil,
-				restError("internal error"),
+				restError("internal error", "internal_error"),
 			),
 		},
 		"error: sign error": {
@@ -126,9 +129,19 @@ func TestUserAdmApiLogin(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusInternalServerError,
 				nil,
-				restError("internal error"),
+				restError("internal error", "internal_error"),
 			),
 		},
+		"error: user inactive": {
+			inAuthHeader: "Basic ZW1haWw6cGFzcw==",
+			signed:       "initial",
+			uaError:      useradm.ErrUserInactive,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnauthorized,
+				nil,
+				restError(useradm.ErrUserInactive.Error(), "user_inactive")),
+		},
 		"error: tenant account suspended": {
 			inAuthHeader: "Basic ZW1haWw6cGFzcw==",
 			signed:       "initial",
@@ -137,7 +150,48 @@ func TestUserAdmApiLogin(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusUnauthorized,
 				nil,
-				restError(useradm.ErrTenantAccountSuspended.Error())),
+				restError(useradm.ErrTenantAccountSuspended.Error(), "tenant_suspended")),
+		},
+		"ok, with one-time code": {
+			inAuthHeader: "Basic ZW1haWw6cGFzcw==",
+			inOTP:        "123456",
+			uaToken:      &jwt.Token{},
+
+			signed: "dummytoken",
+
+			checker: &mt.BaseResponse{
+				Status:      http.StatusOK,
+				ContentType: "application/jwt",
+				Body:        "dummytoken",
+			},
+		},
+		"error: one-time code required": {
+			inAuthHeader: "Basic ZW1haWw6cGFzcw==",
+			uaError:      useradm.ErrOTPRequired,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnauthorized,
+				nil,
+				restError(useradm.ErrOTPRequired.Error(), "otp_required")),
+		},
+		"error: invalid one-time code": {
+			inAuthHeader: "Basic ZW1haWw6cGFzcw==",
+			inOTP:        "654321",
+			uaError:      useradm.ErrInvalidOTP,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnauthorized,
+				nil,
+				restError(useradm.ErrInvalidOTP.Error(), "invalid_otp")),
+		},
+		"error: one-time code can't be sent": {
+			inAuthHeader: "Basic ZW1haWw6cGFzcw==",
+			uaError:      useradm.ErrOTPUndeliverable,
+
+			checker: mt.NewJSONResponse(
+				http.StatusServiceUnavailable,
+				nil,
+				restError(useradm.ErrOTPUndeliverable.Error(), "service_unavailable")),
 		},
 	}
 
@@ -150,7 +204,8 @@ func TestUserAdmApiLogin(t *testing.T) {
 		uadm := &museradm.App{}
 		uadm.On("Login", ctx,
 			mock.AnythingOfType("string"),
-			mock.AnythingOfType("string")).
+			mock.AnythingOfType("string"),
+			model.LoginInfo{IP: "5.6.7.8", UserAgent: "test-agent", OTP: tc.inOTP}).
 			Return(tc.uaToken, tc.uaError)
 
 		uadm.On("SignToken", ctx, tc.uaToken).Return(tc.signed, tc.signErr)
@@ -158,6 +213,11 @@ func TestUserAdmApiLogin(t *testing.T) {
 		//make mock request
 		req := makeReq("POST", "http://1.2.3.4/api/management/v1/useradm/auth/login",
 			tc.inAuthHeader, nil)
+		req.RemoteAddr = "5.6.7.8:5678"
+		req.Header.Set("User-Agent", "test-agent")
+		if tc.inOTP != "" {
+			req.Header.Set("X-MEN-OTP", tc.inOTP)
+		}
 
 		api := makeMockApiHandler(t, uadm, nil)
 
@@ -167,6 +227,93 @@ func TestUserAdmApiLogin(t *testing.T) {
 	}
 }
 
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"1.2.3.4", "10.0.0.0/8"})
+	assert.NoError(t, err)
+
+	testCases := map[string]struct {
+		headers    map[string]string
+		remoteAddr string
+
+		ip string
+	}{
+		"remote address": {
+			remoteAddr: "1.2.3.4:5678",
+			ip:         "1.2.3.4",
+		},
+		"x-real-ip": {
+			headers:    map[string]string{"X-Real-IP": "5.6.7.8"},
+			remoteAddr: "1.2.3.4:5678",
+			ip:         "5.6.7.8",
+		},
+		"x-forwarded-for": {
+			headers: map[string]string{
+				"X-Forwarded-For": "9.9.9.9, 5.6.7.8",
+				"X-Real-IP":       "5.6.7.8",
+			},
+			remoteAddr: "1.2.3.4:5678",
+			ip:         "5.6.7.8",
+		},
+		"x-forwarded-for, trusted proxies": {
+			headers: map[string]string{
+				"X-Forwarded-For": "9.9.9.9, 5.6.7.8, 10.1.1.1",
+			},
+			remoteAddr: "10.2.2.2:5678",
+			ip:         "5.6.7.8",
+		},
+		"x-forwarded-for, trusted proxies only": {
+			headers: map[string]string{
+				"X-Forwarded-For": "10.1.1.1",
+			},
+			remoteAddr: "1.2.3.4:5678",
+			ip:         "10.1.1.1",
+		},
+		"untrusted, x-real-ip": {
+			headers:    map[string]string{"X-Real-IP": "5.6.7.8"},
+			remoteAddr: "4.3.2.1:5678",
+			ip:         "4.3.2.1",
+		},
+		"untrusted, x-forwarded-for": {
+			headers: map[string]string{
+				"X-Forwarded-For": "9.9.9.9",
+			},
+			remoteAddr: "4.3.2.1:5678",
+			ip:         "4.3.2.1",
+		},
+	}
+
+	handlers := NewUserAdmApiHandlers(nil, nil).WithTrustedProxies(proxies)
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		req := test.MakeSimpleRequest("POST",
+			"http://1.2.3.4/api/management/v1/useradm/auth/login", nil)
+		req.RemoteAddr = tc.remoteAddr
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+
+		assert.Equal(t, tc.ip, handlers.clientIP(&rest.Request{Request: req}))
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"1.2.3.4", "10.0.0.0/8", "::1"})
+	assert.NoError(t, err)
+	assert.Len(t, proxies, 3)
+	assert.True(t, proxies[0].Contains(net.ParseIP("1.2.3.4")))
+	assert.False(t, proxies[0].Contains(net.ParseIP("1.2.3.5")))
+	assert.True(t, proxies[1].Contains(net.ParseIP("10.20.30.40")))
+	assert.True(t, proxies[2].Contains(net.ParseIP("::1")))
+
+	_, err = ParseTrustedProxies([]string{"foo"})
+	assert.EqualError(t, err, `invalid proxy address "foo"`)
+
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/40"})
+	assert.EqualError(t, err, `invalid proxy address range "10.0.0.0/40": invalid CIDR address: 10.0.0.0/40`)
+}
+
 func TestCreateUser(t *testing.T) {
 	t.Parallel()
 
@@ -192,6 +339,89 @@ func TestCreateUser(t *testing.T) {
 				nil,
 			),
 		},
+		"ok, with profile": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v1/useradm/users",
+				map[string]interface{}{
+					"email":    "foo@foo.com",
+					"password": "foobarbar",
+					"name":     "Foo Bar",
+					"phone":    "+47 123 45 678",
+					"locale":   "nb-NO",
+					"timezone": "Europe/Oslo",
+				},
+			),
+
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				nil,
+				nil,
+			),
+		},
+		"invalid timezone": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v1/useradm/users",
+				map[string]interface{}{
+					"email":    "foo@foo.com",
+					"password": "foobarbar",
+					"timezone": "Mars/Olympus_Mons",
+				},
+			),
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrInvalidTimezone.Error(), model.ErrInvalidTimezone),
+			),
+		},
+		"password shorter than tenant's policy": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v1/useradm/users",
+				map[string]interface{}{
+					"email":    "foo@foo.com",
+					"password": "foobarbar",
+				},
+			),
+			createUserErr: model.ErrPasswordTooShort,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnprocessableEntity,
+				nil,
+				restError(model.ErrPasswordTooShort.Error(), "password_too_short"),
+			),
+		},
+		"email domain not allowed by tenant's policy": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v1/useradm/users",
+				map[string]interface{}{
+					"email":    "foo@foo.com",
+					"password": "foobarbar",
+				},
+			),
+			createUserErr: model.ErrEmailDomainNotAllowed,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnprocessableEntity,
+				nil,
+				restError(model.ErrEmailDomainNotAllowed.Error(), "email_domain_not_allowed"),
+			),
+		},
+		"user limit reached": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v1/useradm/users",
+				map[string]interface{}{
+					"email":    "foo@foo.com",
+					"password": "foobarbar",
+				},
+			),
+			createUserErr: store.ErrUserLimitReached,
+
+			checker: mt.NewJSONResponse(
+				http.StatusForbidden,
+				nil,
+				restError(store.ErrUserLimitReached.Error(), "user_limit_reached"),
+			),
+		},
 		"password too short": {
 			inReq: test.MakeSimpleRequest("POST",
 				"http://1.2.3.4/api/management/v1/useradm/users",
@@ -204,7 +434,7 @@ func TestCreateUser(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusUnprocessableEntity,
 				nil,
-				restError(model.ErrPasswordTooShort.Error()),
+				restError(model.ErrPasswordTooShort.Error(), "password_too_short"),
 			),
 		},
 		"duplicated email": {
@@ -220,7 +450,7 @@ func TestCreateUser(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusUnprocessableEntity,
 				nil,
-				restError(store.ErrDuplicateEmail.Error()),
+				restError(store.ErrDuplicateEmail.Error(), "duplicate_email"),
 			),
 		},
 		"invalid email ('+')": {
@@ -235,7 +465,8 @@ func TestCreateUser(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusBadRequest,
 				nil,
-				restError("email: invalid character '+' in email address"),
+				restFieldError("email: invalid character '+' in email address",
+					model.NewFieldError("email", "invalid character '+' in email address")),
 			),
 		},
 		"invalid email (non-ascii)": {
@@ -250,7 +481,43 @@ func TestCreateUser(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusBadRequest,
 				nil,
-				restError("email: ąę@org.com does not validate as ascii;"),
+				restFieldError("email: ąę@org.com does not validate as ascii",
+					model.NewFieldError("email", "ąę@org.com does not validate as ascii")),
+			),
+		},
+		"unknown field": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v1/useradm/users",
+				map[string]interface{}{
+					"emial":    "foo@foo.com",
+					"password": "foobarbar",
+				},
+			),
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("emial: unknown field",
+					model.NewFieldError("emial", "unknown field")),
+			),
+		},
+		"read-only fields": {
+			inReq: test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v1/useradm/users",
+				map[string]interface{}{
+					"id":         "1234",
+					"email":      "foo@foo.com",
+					"password":   "foobarbar",
+					"created_ts": "2018-01-01T00:00:00Z",
+				},
+			),
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("created_ts: read-only field; id: read-only field",
+					model.NewFieldError("created_ts", "read-only field"),
+					model.NewFieldError("id", "read-only field")),
 			),
 		},
 		"no body": {
@@ -260,7 +527,7 @@ func TestCreateUser(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusBadRequest,
 				nil,
-				restError("failed to decode request body: JSON payload is empty"),
+				restError("failed to decode request body: JSON payload is empty", "empty_request_body"),
 			),
 		},
 	}
@@ -270,9 +537,9 @@ func TestCreateUser(t *testing.T) {
 
 			//make mock useradm
 			uadm := &museradm.App{}
-			uadm.On("CreateUser", mtesting.ContextMatcher(),
+			uadm.On("CreateUserOnce", mtesting.ContextMatcher(), "",
 				mock.AnythingOfType("*model.User")).
-				Return(tc.createUserErr)
+				Return("", tc.createUserErr)
 
 			api := makeMockApiHandler(t, uadm, nil)
 
@@ -284,6 +551,86 @@ func TestCreateUser(t *testing.T) {
 	}
 }
 
+func TestCreateUserIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		key string
+
+		createUserID string
+		createErr    error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			key:          "key-1",
+			createUserID: "1234",
+
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				map[string]string{"Location": "users/1234"},
+				nil,
+			),
+		},
+		"error, in progress": {
+			key:       "key-1",
+			createErr: useradm.ErrIdempotencyKeyInProgress,
+
+			checker: mt.NewJSONResponse(
+				http.StatusConflict,
+				nil,
+				restError(useradm.ErrIdempotencyKeyInProgress.Error(),
+					"idempotency_key_in_progress"),
+			),
+		},
+		"error, used for another user": {
+			key:       "key-1",
+			createErr: useradm.ErrIdempotencyKeyReused,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnprocessableEntity,
+				nil,
+				restError(useradm.ErrIdempotencyKeyReused.Error(),
+					"idempotency_key_reused"),
+			),
+		},
+		"error, key too long": {
+			key: strings.Repeat("k", 256),
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError(ErrInvalidIdempotencyKey.Error(), "invalid_idempotency_key"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc: %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("CreateUserOnce", mtesting.ContextMatcher(), tc.key,
+				mock.AnythingOfType("*model.User")).
+				Return(tc.createUserID, tc.createErr)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/management/v1/useradm/users",
+				map[string]interface{}{
+					"email":    "foo@foo.com",
+					"password": "foobarbar",
+				},
+			)
+			req.Header.Set("Idempotency-Key", tc.key)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
 func TestCreateUserForTenant(t *testing.T) {
 	t.Parallel()
 
@@ -342,7 +689,7 @@ func TestCreateUserForTenant(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusBadRequest,
 				nil,
-				restError("password *or* password_hash must be provided"),
+				restError("password *or* password_hash must be provided", "bad_request"),
 			),
 			propagate: true,
 		},
@@ -360,7 +707,7 @@ func TestCreateUserForTenant(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusBadRequest,
 				nil,
-				restError("password *or* password_hash must be provided"),
+				restError("password *or* password_hash must be provided", "bad_request"),
 			),
 			propagate: true,
 		},
@@ -409,7 +756,7 @@ func TestCreateUserForTenant(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusBadRequest,
 				nil,
-				restError(model.ErrPasswordTooShort.Error()),
+				restError(model.ErrPasswordTooShort.Error(), "password_too_short"),
 			),
 			propagate: true,
 		},
@@ -426,7 +773,7 @@ func TestCreateUserForTenant(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusUnprocessableEntity,
 				nil,
-				restError(store.ErrDuplicateEmail.Error()),
+				restError(store.ErrDuplicateEmail.Error(), "duplicate_email"),
 			),
 			propagate: true,
 		},
@@ -437,7 +784,7 @@ func TestCreateUserForTenant(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusBadRequest,
 				nil,
-				restError("failed to decode request body: JSON payload is empty"),
+				restError("failed to decode request body: JSON payload is empty", "empty_request_body"),
 			),
 			propagate: true,
 		},
@@ -453,7 +800,7 @@ func TestCreateUserForTenant(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusNotFound,
 				nil,
-				restError("Entity not found"),
+				restError("Entity not found", "not_found"),
 			),
 			propagate: true,
 		},
@@ -464,11 +811,11 @@ func TestCreateUserForTenant(t *testing.T) {
 
 			//make mock useradm
 			uadm := &museradm.App{}
-			uadm.On("CreateUserInternal", mock.MatchedBy(func(c context.Context) bool {
+			uadm.On("CreateUserInternalOnce", mock.MatchedBy(func(c context.Context) bool {
 				return identity.FromContext(c).Tenant == "1"
-			}),
+			}), "",
 				mock.AnythingOfType("*model.UserInternal")).
-				Return(tc.createUserErr)
+				Return("", tc.createUserErr)
 
 			api := makeMockApiHandler(t, uadm, nil)
 
@@ -484,8 +831,10 @@ func TestUpdateUser(t *testing.T) {
 	t.Parallel()
 
 	testCases := map[string]struct {
-		inReq *http.Request
+		inReq     *http.Request
+		inIfMatch string
 
+		outIfMatch    []string
 		updateUserErr error
 
 		checker mt.ResponseChecker
@@ -505,6 +854,41 @@ func TestUpdateUser(t *testing.T) {
 				nil,
 			),
 		},
+		"ok, if match": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/useradm/users/123",
+				map[string]interface{}{
+					"email": "foo@foo.com",
+				},
+			),
+			inIfMatch: `"v1", W/"v2"`,
+
+			outIfMatch: []string{"v1", `W/"v2"`},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: if match": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/useradm/users/123",
+				map[string]interface{}{
+					"email": "foo@foo.com",
+				},
+			),
+			inIfMatch: `"v1"`,
+
+			outIfMatch:    []string{"v1"},
+			updateUserErr: store.ErrETagMismatch,
+
+			checker: mt.NewJSONResponse(
+				http.StatusPreconditionFailed,
+				nil,
+				restError(store.ErrETagMismatch.Error(), "etag_mismatch"),
+			),
+		},
 		"password too short": {
 			inReq: test.MakeSimpleRequest("PUT",
 				"http://1.2.3.4/api/management/v1/useradm/users/123",
@@ -516,7 +900,7 @@ func TestUpdateUser(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusUnprocessableEntity,
 				nil,
-				restError(model.ErrPasswordTooShort.Error()),
+				restError(model.ErrPasswordTooShort.Error(), "password_too_short"),
 			),
 		},
 		"duplicated email": {
@@ -531,7 +915,7 @@ func TestUpdateUser(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusUnprocessableEntity,
 				nil,
-				restError(store.ErrDuplicateEmail.Error()),
+				restError(store.ErrDuplicateEmail.Error(), "duplicate_email"),
 			),
 		},
 		"no body": {
@@ -541,37 +925,113 @@ func TestUpdateUser(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusBadRequest,
 				nil,
-				restError("failed to decode request body: JSON payload is empty"),
+				restError("failed to decode request body: JSON payload is empty", "empty_request_body"),
 			),
 		},
-		"incorrect body": {
+		"ok, status": {
 			inReq: test.MakeSimpleRequest("PUT",
 				"http://1.2.3.4/api/management/v1/useradm/users/123",
 				map[string]interface{}{
-					"id": "1234",
-				}),
+					"status": "inactive",
+				},
+			),
 
 			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
+				http.StatusNoContent,
+				nil,
 				nil,
-				restError(model.ErrEmptyUpdate.Error()),
 			),
 		},
-	}
-
-	for name, tc := range testCases {
-		t.Run(fmt.Sprintf("tc: %s", name), func(t *testing.T) {
+		"invalid status": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/useradm/users/123",
+				map[string]interface{}{
+					"status": "suspended",
+				},
+			),
 
-			//make mock useradm
-			uadm := &museradm.App{}
-			uadm.On("UpdateUser", mtesting.ContextMatcher(),
-				mock.AnythingOfType("string"),
-				mock.AnythingOfType("*model.UserUpdate")).
-				Return(tc.updateUserErr)
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrInvalidStatus.Error(), model.ErrInvalidStatus),
+			),
+		},
+		"last admin": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/useradm/users/123",
+				map[string]interface{}{
+					"status": "inactive",
+				},
+			),
+			updateUserErr: useradm.ErrLastAdmin,
+
+			checker: mt.NewJSONResponse(
+				http.StatusConflict,
+				nil,
+				restError(useradm.ErrLastAdmin.Error(), "last_admin"),
+			),
+		},
+		"incorrect body": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/useradm/users/123",
+				map[string]interface{}{}),
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError(model.ErrEmptyUpdate.Error(), "empty_update"),
+			),
+		},
+		"unknown fields": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/useradm/users/123",
+				map[string]interface{}{
+					"id":    "1234",
+					"emial": "foo@bar.com",
+				}),
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("emial: unknown field; id: unknown field",
+					model.NewFieldError("emial", "unknown field"),
+					model.NewFieldError("id", "unknown field")),
+			),
+		},
+		"wrong field type": {
+			inReq: test.MakeSimpleRequest("PUT",
+				"http://1.2.3.4/api/management/v1/useradm/users/123",
+				map[string]interface{}{
+					"name": 42,
+				}),
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("name: must be a string",
+					model.NewFieldError("name", "must be a string")),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc: %s", name), func(t *testing.T) {
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("UpdateUser", mtesting.ContextMatcher(),
+				mock.AnythingOfType("string"),
+				mock.MatchedBy(func(u *model.UserUpdate) bool {
+					return assert.ObjectsAreEqual(tc.outIfMatch, u.IfMatch)
+				})).
+				Return(tc.updateUserErr)
 
 			api := makeMockApiHandler(t, uadm, nil)
 
 			tc.inReq.Header.Add(requestid.RequestIdHeader, "test")
+			if tc.inIfMatch != "" {
+				tc.inReq.Header.Set("If-Match", tc.inIfMatch)
+			}
 			recorded := test.RunRequest(t, api, tc.inReq)
 
 			mt.CheckResponse(t, tc.checker, recorded)
@@ -632,6 +1092,278 @@ func makeMockApiHandler(t *testing.T, uadm useradm.App, db store.DataStore) http
 	return api.MakeHandler()
 }
 
+func TestPatchUser(t *testing.T) {
+	t.Parallel()
+
+	user := &model.User{
+		ID:     "123",
+		Email:  "foo@bar.com",
+		Name:   "Foo Bar",
+		Status: model.UserStatusActive,
+		ETag:   "v1",
+	}
+
+	testCases := map[string]struct {
+		contentType string
+		ifMatch     string
+		body        interface{}
+
+		getUser    *model.User
+		getUserErr error
+
+		update        *model.UserUpdate
+		updateUserErr error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			contentType: "application/merge-patch+json",
+			body: map[string]interface{}{
+				"name":  nil,
+				"phone": "+47 123 45 678",
+			},
+
+			getUser: user,
+
+			update: &model.UserUpdate{
+				Phone:   "+47 123 45 678",
+				Clear:   []string{"name"},
+				IfMatch: []string{"v1"},
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"ok, if match": {
+			contentType: "application/merge-patch+json",
+			ifMatch:     `"v0", "v1"`,
+			body: map[string]interface{}{
+				"phone": "+47 123 45 678",
+			},
+
+			getUser: user,
+
+			update: &model.UserUpdate{
+				Phone:   "+47 123 45 678",
+				IfMatch: []string{"v1"},
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: if match": {
+			contentType: "application/merge-patch+json",
+			ifMatch:     `"v0"`,
+			body: map[string]interface{}{
+				"phone": "+47 123 45 678",
+			},
+
+			getUser: user,
+
+			checker: mt.NewJSONResponse(
+				http.StatusPreconditionFailed,
+				nil,
+				restError(store.ErrETagMismatch.Error(), "etag_mismatch"),
+			),
+		},
+		"error: modified concurrently": {
+			contentType: "application/merge-patch+json",
+			body: map[string]interface{}{
+				"phone": "+47 123 45 678",
+			},
+
+			getUser: user,
+
+			update: &model.UserUpdate{
+				Phone:   "+47 123 45 678",
+				IfMatch: []string{"v1"},
+			},
+			updateUserErr: store.ErrETagMismatch,
+
+			checker: mt.NewJSONResponse(
+				http.StatusPreconditionFailed,
+				nil,
+				restError(store.ErrETagMismatch.Error(), "etag_mismatch"),
+			),
+		},
+		"ok, no changes": {
+			contentType: "application/merge-patch+json",
+			body: map[string]interface{}{
+				"name": "Foo Bar",
+			},
+
+			getUser: user,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: content type": {
+			contentType: "application/json",
+			body: map[string]interface{}{
+				"name": "Foo Baz",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnsupportedMediaType,
+				nil,
+				restError("Bad Content-Type, expected 'application/merge-patch+json'", "unsupported_media_type"),
+			),
+		},
+		"error: not an object": {
+			contentType: "application/merge-patch+json",
+			body:        []string{"foo"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to decode request body: json: cannot unmarshal "+
+					"array into Go value of type map[string]interface {}", "bad_request"),
+			),
+		},
+		"error: user not found": {
+			contentType: "application/merge-patch+json",
+			body: map[string]interface{}{
+				"name": "Foo Baz",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError("user not found", "user_not_found"),
+			),
+		},
+		"error: get user": {
+			contentType: "application/merge-patch+json",
+			body: map[string]interface{}{
+				"name": "Foo Baz",
+			},
+
+			getUserErr: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+		"error: read-only field": {
+			contentType: "application/merge-patch+json",
+			body: map[string]interface{}{
+				"id": "1234",
+			},
+
+			getUser: user,
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("id: field can't be modified",
+					model.NewFieldError("id", "field can't be modified")),
+			),
+		},
+		"error: password too short": {
+			contentType: "application/merge-patch+json",
+			body: map[string]interface{}{
+				"password": "foo",
+			},
+
+			getUser: user,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnprocessableEntity,
+				nil,
+				restError(model.ErrPasswordTooShort.Error(), "password_too_short"),
+			),
+		},
+		"error: duplicate email": {
+			contentType: "application/merge-patch+json",
+			body: map[string]interface{}{
+				"email": "bar@bar.com",
+			},
+
+			getUser: user,
+
+			update: &model.UserUpdate{
+				Email:   "bar@bar.com",
+				IfMatch: []string{"v1"},
+			},
+			updateUserErr: store.ErrDuplicateEmail,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnprocessableEntity,
+				nil,
+				restError(store.ErrDuplicateEmail.Error(), "duplicate_email"),
+			),
+		},
+		"error: update user": {
+			contentType: "application/merge-patch+json",
+			body: map[string]interface{}{
+				"email": "bar@bar.com",
+			},
+
+			getUser: user,
+
+			update: &model.UserUpdate{
+				Email:   "bar@bar.com",
+				IfMatch: []string{"v1"},
+			},
+			updateUserErr: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc: %s", name), func(t *testing.T) {
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("GetUser", mtesting.ContextMatcher(), "123").
+				Return(tc.getUser, tc.getUserErr)
+			if tc.update != nil {
+				uadm.On("UpdateUser", mtesting.ContextMatcher(), "123",
+					tc.update).
+					Return(tc.updateUserErr)
+			}
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("PATCH",
+				"http://1.2.3.4/api/management/v1/useradm/users/123",
+				"",
+				tc.body)
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+
+			recorded := test.RunRequest(t, api, req)
+
+			mt.CheckResponse(t, tc.checker, recorded)
+			if tc.update != nil {
+				uadm.AssertCalled(t, "UpdateUser", mtesting.ContextMatcher(),
+					"123", tc.update)
+			} else {
+				uadm.AssertNotCalled(t, "UpdateUser", mock.Anything,
+					mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
 func TestUserAdmApiPostVerify(t *testing.T) {
 	t.Parallel()
 
@@ -649,7 +1381,24 @@ func TestUserAdmApiPostVerify(t *testing.T) {
 		"j3zWev8zKVH0Sef0lB6SAapVs1GS3rK3-oy6wk" +
 		"ACNbKY1tB7Ox6CKiJ9F8Hhvh_icOtfvjCuiY-HkJL55T4wziFQNv2xU_2W7Lw"
 
+	privkey, err := keys.LoadRSAPrivate("../../crypto/private.pem")
+	assert.NoError(t, err)
+	operatorToken, err := jwt.NewJWTHandlerRS256(privkey).ToJWT(&jwt.Token{
+		Claims: jwt.Claims{
+			Issuer:    "mender",
+			ExpiresAt: 4481893900,
+			Subject:   "operator",
+			Scope:     scope.All + " " + scope.Operator,
+			Tenant:    "operators",
+			User:      true,
+		},
+	})
+	assert.NoError(t, err)
+
 	testCases := map[string]struct {
+		token        string
+		tenantHeader string
+
 		uaVerifyError error
 
 		uaError error
@@ -666,6 +1415,26 @@ func TestUserAdmApiPostVerify(t *testing.T) {
 				nil,
 			),
 		},
+		"ok: operator, tenant header": {
+			token:        operatorToken,
+			tenantHeader: "tenant1",
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				nil,
+			),
+		},
+		"error: tenant header, not an operator": {
+			tenantHeader: "tenant1",
+
+			checker: mt.NewJSONResponse(
+				http.StatusForbidden,
+				nil,
+				restError(ErrTenantHeaderForbidden.Error(),
+					"tenant_header_forbidden"),
+			),
+		},
 		"error: useradm unauthorized": {
 			uaVerifyError: nil,
 			uaError:       useradm.ErrUnauthorized,
@@ -673,7 +1442,7 @@ func TestUserAdmApiPostVerify(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusUnauthorized,
 				nil,
-				restError("unauthorized"),
+				restError("unauthorized", "unauthorized"),
 			),
 		},
 		"error: useradm internal": {
@@ -683,7 +1452,7 @@ func TestUserAdmApiPostVerify(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusInternalServerError,
 				nil,
-				restError("internal error"),
+				restError("internal error", "internal_error"),
 			),
 		},
 	}
@@ -703,10 +1472,17 @@ func TestUserAdmApiPostVerify(t *testing.T) {
 		api := makeMockApiHandler(t, uadm, nil)
 
 		//make request
+		reqToken := token
+		if tc.token != "" {
+			reqToken = tc.token
+		}
 		req := makeReq("POST",
 			"http://1.2.3.4/api/internal/v1/useradm/auth/verify",
-			"Bearer "+token,
+			"Bearer "+reqToken,
 			nil)
+		if tc.tenantHeader != "" {
+			req.Header.Set(TenantHeader, tc.tenantHeader)
+		}
 
 		// set these to make the middleware happy
 		req.Header.Add("X-Original-URI", "/api/mgmt/0.1/someservice/some/resource")
@@ -737,12 +1513,17 @@ func TestUserAdmApiGetUsers(t *testing.T) {
 
 	now := time.Now()
 	testCases := map[string]struct {
+		query string
+		fltr  model.UserFilter
+
+		uaCount int
 		uaUsers []model.User
 		uaError error
 
 		checker mt.ResponseChecker
 	}{
 		"ok": {
+			uaCount: 2,
 			uaUsers: []model.User{
 				{
 					ID:    "1",
@@ -759,7 +1540,7 @@ func TestUserAdmApiGetUsers(t *testing.T) {
 
 			checker: mt.NewJSONResponse(
 				http.StatusOK,
-				nil,
+				map[string]string{"X-Total-Count": "2"},
 				[]model.User{
 					{
 						ID:    "1",
@@ -780,109 +1561,2149 @@ func TestUserAdmApiGetUsers(t *testing.T) {
 
 			checker: mt.NewJSONResponse(
 				http.StatusOK,
-				nil,
+				map[string]string{"X-Total-Count": "0"},
 				[]model.User{},
 			),
 		},
-		"error: useradm internal": {
-			uaUsers: nil,
-			uaError: errors.New("some internal error"),
+		"ok: attribute filter": {
+			query: "?attributes.department=rnd&attributes.cost_center=42&page=1",
+			fltr: model.UserFilter{
+				Attributes: map[string]string{
+					"department":  "rnd",
+					"cost_center": "42",
+				},
+			},
+			uaCount: 1,
+			uaUsers: []model.User{
+				{
+					ID:    "1",
+					Email: "foo@acme.com",
+					Attributes: map[string]string{
+						"department":  "rnd",
+						"cost_center": "42",
+					},
+				},
+			},
 
 			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
-				nil,
-				restError("internal error"),
+				http.StatusOK,
+				map[string]string{"X-Total-Count": "1"},
+				[]model.User{
+					{
+						ID:    "1",
+						Email: "foo@acme.com",
+						Attributes: map[string]string{
+							"department":  "rnd",
+							"cost_center": "42",
+						},
+					},
+				},
 			),
 		},
-	}
-
-	for name, tc := range testCases {
-		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+		"ok: fields": {
+			query: "?fields=id,%20name,status",
+			fltr: model.UserFilter{
+				Fields: []string{"id", "name", "status"},
+			},
+			uaCount: 1,
+			uaUsers: []model.User{
+				{
+					ID:   "1",
+					Name: "Foo",
+				},
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				map[string]string{"X-Total-Count": "1"},
+				[]map[string]interface{}{
+					{"id": "1", "name": "Foo"},
+				},
+			),
+		},
+		"error: unknown field": {
+			query: "?fields=id,password",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("fields: unknown field: password",
+					model.NewFieldError("fields", "unknown field: password")),
+			),
+		},
+		"error: invalid attribute filter": {
+			query: "?attributes.$where=1",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrInvalidAttributeKey.Error(), model.ErrInvalidAttributeKey),
+			),
+		},
+		"ok: total counted by the store": {
+			// a user was added between counting and listing
+			uaCount: 1,
+			uaUsers: []model.User{
+				{ID: "1", Email: "foo@acme.com"},
+				{ID: "2", Email: "bar@acme.com"},
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				map[string]string{"X-Total-Count": "1"},
+				[]model.User{
+					{ID: "1", Email: "foo@acme.com"},
+					{ID: "2", Email: "bar@acme.com"},
+				},
+			),
+		},
+		"error: useradm internal": {
+			uaUsers: nil,
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
 
 			ctx := mtesting.ContextMatcher()
 
 			//make mock useradm
 			uadm := &museradm.App{}
-			uadm.On("GetUsers", ctx).Return(tc.uaUsers, tc.uaError)
+			uadm.On("GetUsersVersion", ctx, tc.fltr).
+				Return(&model.UsersVersion{Count: len(tc.uaUsers)}, nil)
+			uadm.On("CountUsers", ctx, tc.fltr).Return(tc.uaCount, nil)
+			uadm.On("GetUsers", ctx, tc.fltr).Return(tc.uaUsers, tc.uaError)
 
 			//make handler
 			api := makeMockApiHandler(t, uadm, nil)
 
 			//make request
+			req := makeReq("GET",
+				"http://1.2.3.4/api/management/v1/useradm/users"+tc.query,
+				"Bearer "+token,
+				nil)
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetUsersNotModified(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	version := &model.UsersVersion{Count: 2, UpdatedTs: ts}
+	etag := usersETag(version)
+
+	testCases := map[string]struct {
+		ifNoneMatch string
+
+		uaVersionErr error
+
+		status int
+		etag   string
+	}{
+		"ok: modified": {
+			ifNoneMatch: `"0123456789"`,
+
+			status: http.StatusOK,
+			etag:   `"` + etag + `"`,
+		},
+		"ok: no etag": {
+			status: http.StatusOK,
+			etag:   `"` + etag + `"`,
+		},
+		"ok: not modified": {
+			ifNoneMatch: `"0123456789", "` + etag + `"`,
+
+			status: http.StatusNotModified,
+			etag:   `"` + etag + `"`,
+		},
+		"ok: not modified, weak": {
+			ifNoneMatch: `W/"` + etag + `"`,
+
+			status: http.StatusNotModified,
+			etag:   `"` + etag + `"`,
+		},
+		"ok: not modified, any": {
+			ifNoneMatch: "*",
+
+			status: http.StatusNotModified,
+			etag:   `"` + etag + `"`,
+		},
+		"error: version": {
+			uaVersionErr: errors.New("db connection failed"),
+
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			uadm := &museradm.App{}
+			uadm.On("GetUsersVersion", ctx, model.UserFilter{}).
+				Return(version, tc.uaVersionErr)
+			uadm.On("CountUsers", ctx, model.UserFilter{}).Return(2, nil)
+			uadm.On("GetUsers", ctx, model.UserFilter{}).
+				Return([]model.User{{ID: "1"}, {ID: "2"}}, nil)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
 			req := makeReq("GET",
 				"http://1.2.3.4/api/management/v1/useradm/users",
+				"",
+				nil)
+			if tc.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+
+			recorded := test.RunRequest(t, api, req)
+
+			assert.Equal(t, tc.status, recorded.Recorder.Code)
+			assert.Equal(t, tc.etag, recorded.Recorder.Header().Get("ETag"))
+			if tc.status == http.StatusNotModified {
+				assert.Empty(t, recorded.Recorder.Body.String())
+				uadm.AssertNotCalled(t, "GetUsers", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestUserAdmApiCountUsers(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		query string
+		fltr  model.UserFilter
+
+		uaCount int
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaCount: 42,
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				map[string]string{"X-Total-Count": "42"},
+				map[string]int{"count": 42},
+			),
+		},
+		"ok: attribute filter": {
+			query: "?attributes.department=rnd",
+			fltr: model.UserFilter{
+				Attributes: map[string]string{
+					"department": "rnd",
+				},
+			},
+			uaCount: 3,
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				map[string]string{"X-Total-Count": "3"},
+				map[string]int{"count": 3},
+			),
+		},
+		"error: invalid attribute filter": {
+			query: "?attributes.$where=1",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrInvalidAttributeKey.Error(), model.ErrInvalidAttributeKey),
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("CountUsers", mtesting.ContextMatcher(), tc.fltr).
+				Return(tc.uaCount, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("GET",
+				"http://1.2.3.4/api/management/v1/useradm/users/count"+tc.query,
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetUser(t *testing.T) {
+	t.Parallel()
+
+	// we setup authz, so a real token is needed
+	token := "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9." +
+		"eyJleHAiOjQ0ODE4OTM5MDAsImlzcyI6Im1lb" +
+		"mRlciIsInN1YiI6InRlc3RzdWJqZWN0Iiwic2" +
+		"NwIjoibWVuZGVyLioifQ.NzXNhh_59_03mal_" +
+		"-KImArI8sfvnNFyCW0dEqmnW1gYojmTjWBBEJK" +
+		"xCnh8hbHhY2mfv6Jk9wk1dEnT8_8mCACrBrw97" +
+		"7oRUzlogu8yV2z1m65jpvDBGK_IsJz_GfZA2w" +
+		"SBz55hkqiMEzFqswIEC46xW5RMY0vfMMSVIO7f" +
+		"ncOlmTgJTdCVtr9RVDREBJIoWoC-OLGYat9ivx" +
+		"yA_N_mRvu5iFPZI3FniYaBjY9k_jR62I-QPIVk" +
+		"j3zWev8zKVH0Sef0lB6SAapVs1GS3rK3-oy6wk" +
+		"ACNbKY1tB7Ox6CKiJ9F8Hhvh_icOtfvjCuiY-HkJL55T4wziFQNv2xU_2W7Lw"
+
+	now := time.Now()
+	testCases := map[string]struct {
+		query  string
+		fields []string
+
+		uaUser  *model.User
+		uaUsers []model.User
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaUser: &model.User{
+				ID:        "1",
+				Email:     "foo@acme.com",
+				CreatedTs: &now,
+				UpdatedTs: &now,
+				ETag:      "v1",
+			},
+			uaError: nil,
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				map[string]string{"ETag": `"v1"`},
+				&model.User{
+					ID:        "1",
+					Email:     "foo@acme.com",
+					CreatedTs: &now,
+					UpdatedTs: &now,
+				},
+			),
+		},
+		"ok: fields": {
+			query:  "?fields=email,created_ts",
+			fields: []string{"email", "created_ts"},
+			uaUsers: []model.User{{
+				Email:     "foo@acme.com",
+				CreatedTs: &now,
+				ETag:      "v1",
+			}},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				map[string]string{"ETag": `"v1"`},
+				map[string]interface{}{
+					"email":      "foo@acme.com",
+					"created_ts": &now,
+				},
+			),
+		},
+		"error: unknown field": {
+			query: "?fields=etag",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("fields: unknown field: etag",
+					model.NewFieldError("fields", "unknown field: etag")),
+			),
+		},
+		"not found": {
+			uaUser:  nil,
+			uaError: nil,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError("user not found", "user_not_found"),
+			),
+		},
+		"not found: fields": {
+			query:   "?fields=email",
+			fields:  []string{"email"},
+			uaUsers: []model.User{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError("user not found", "user_not_found"),
+			),
+		},
+		"error: useradm internal": {
+			uaUser:  nil,
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+		"error: useradm internal, fields": {
+			query:   "?fields=email",
+			fields:  []string{"email"},
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("GetUser", ctx, "foo").Return(tc.uaUser, tc.uaError)
+			uadm.On("GetUsers", ctx,
+				model.UserFilter{ID: "foo", Fields: tc.fields}).
+				Return(tc.uaUsers, tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req := makeReq("GET",
+				"http://1.2.3.4/api/management/v1/useradm/users/foo"+tc.query,
 				"Bearer "+token,
 				nil)
 
-			//test
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiHeadUsers(t *testing.T) {
+	t.Parallel()
+
+	version := &model.UsersVersion{Count: 2}
+	etag := usersETag(version)
+
+	testCases := map[string]struct {
+		query       string
+		ifNoneMatch string
+		fltr        model.UserFilter
+
+		uaVersionErr error
+
+		status int
+		etag   string
+		total  string
+	}{
+		"ok": {
+			query: "?attributes.department=rnd",
+			fltr: model.UserFilter{
+				Attributes: map[string]string{"department": "rnd"},
+			},
+
+			status: http.StatusOK,
+			etag:   `"` + etag + `"`,
+			total:  "2",
+		},
+		"ok: not modified": {
+			ifNoneMatch: `"` + etag + `"`,
+
+			status: http.StatusNotModified,
+			etag:   `"` + etag + `"`,
+			total:  "2",
+		},
+		"error: invalid attribute filter": {
+			query: "?attributes.$where=1",
+
+			status: http.StatusBadRequest,
+		},
+		"error: useradm internal": {
+			uaVersionErr: errors.New("db connection failed"),
+
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetUsersVersion", mtesting.ContextMatcher(), tc.fltr).
+				Return(version, tc.uaVersionErr)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodHead,
+				"http://1.2.3.4/api/management/v1/useradm/users"+tc.query,
+				"",
+				nil)
+			if tc.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+
+			recorded := test.RunRequest(t, api, req)
+
+			assert.Equal(t, tc.status, recorded.Recorder.Code)
+			assert.Equal(t, tc.etag, recorded.Recorder.Header().Get("ETag"))
+			assert.Equal(t, tc.total, recorded.Recorder.Header().Get(hdrTotalCount))
+			if tc.status < http.StatusBadRequest {
+				assert.Empty(t, recorded.Recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestUserAdmApiHeadUser(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		ifNoneMatch string
+
+		uaUser  *model.User
+		uaError error
+
+		status int
+		etag   string
+	}{
+		"ok": {
+			uaUser: &model.User{ID: "foo", ETag: "v1"},
+
+			status: http.StatusOK,
+			etag:   `"v1"`,
+		},
+		"ok: not modified": {
+			ifNoneMatch: `"v1"`,
+			uaUser:      &model.User{ID: "foo", ETag: "v1"},
+
+			status: http.StatusNotModified,
+			etag:   `"v1"`,
+		},
+		"ok: modified": {
+			ifNoneMatch: `"v0"`,
+			uaUser:      &model.User{ID: "foo", ETag: "v1"},
+
+			status: http.StatusOK,
+			etag:   `"v1"`,
+		},
+		"not found": {
+			status: http.StatusNotFound,
+		},
+		"error: useradm internal": {
+			uaError: errors.New("db connection failed"),
+
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetUser", mtesting.ContextMatcher(), "foo").
+				Return(tc.uaUser, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodHead,
+				"http://1.2.3.4/api/management/v1/useradm/users/foo",
+				"",
+				nil)
+			if tc.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+
+			recorded := test.RunRequest(t, api, req)
+
+			assert.Equal(t, tc.status, recorded.Recorder.Code)
+			assert.Equal(t, tc.etag, recorded.Recorder.Header().Get("ETag"))
+			if tc.status < http.StatusBadRequest {
+				assert.Empty(t, recorded.Recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestUserAdmApiGetUserLogins(t *testing.T) {
+	t.Parallel()
+
+	// we setup authz, so a real token is needed
+	token := "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9." +
+		"eyJleHAiOjQ0ODE4OTM5MDAsImlzcyI6Im1lb" +
+		"mRlciIsInN1YiI6InRlc3RzdWJqZWN0Iiwic2" +
+		"NwIjoibWVuZGVyLioifQ.NzXNhh_59_03mal_" +
+		"-KImArI8sfvnNFyCW0dEqmnW1gYojmTjWBBEJK" +
+		"xCnh8hbHhY2mfv6Jk9wk1dEnT8_8mCACrBrw97" +
+		"7oRUzlogu8yV2z1m65jpvDBGK_IsJz_GfZA2w" +
+		"SBz55hkqiMEzFqswIEC46xW5RMY0vfMMSVIO7f" +
+		"ncOlmTgJTdCVtr9RVDREBJIoWoC-OLGYat9ivx" +
+		"yA_N_mRvu5iFPZI3FniYaBjY9k_jR62I-QPIVk" +
+		"j3zWev8zKVH0Sef0lB6SAapVs1GS3rK3-oy6wk" +
+		"ACNbKY1tB7Ox6CKiJ9F8Hhvh_icOtfvjCuiY-HkJL55T4wziFQNv2xU_2W7Lw"
+
+	ts := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		uaEvents []model.LoginEvent
+		uaError  error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaEvents: []model.LoginEvent{
+				{
+					ID:        "event-1",
+					UserID:    "foo",
+					Timestamp: ts,
+					IP:        "1.2.3.4",
+					UserAgent: "curl/7.58.0",
+					Success:   true,
+					Method:    model.LoginMethodPassword,
+				},
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]model.LoginEvent{
+					{
+						ID:        "event-1",
+						UserID:    "foo",
+						Timestamp: ts,
+						IP:        "1.2.3.4",
+						UserAgent: "curl/7.58.0",
+						Success:   true,
+						Method:    model.LoginMethodPassword,
+					},
+				},
+			),
+		},
+		"ok, empty": {
+			uaEvents: []model.LoginEvent{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]model.LoginEvent{},
+			),
+		},
+		"error: user not found": {
+			uaError: store.ErrUserNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError("user not found", "user_not_found"),
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("GetLoginHistory", ctx, "foo").Return(tc.uaEvents, tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req := makeReq("GET",
+				"http://1.2.3.4/api/management/v1/useradm/users/foo/logins",
+				"Bearer "+token,
+				nil)
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiDeleteUser(t *testing.T) {
+	t.Parallel()
+
+	// we setup authz, so a real token is needed
+	token := "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9." +
+		"eyJleHAiOjQ0ODE4OTM5MDAsImlzcyI6Im1lb" +
+		"mRlciIsInN1YiI6InRlc3RzdWJqZWN0Iiwic2" +
+		"NwIjoibWVuZGVyLioifQ.NzXNhh_59_03mal_" +
+		"-KImArI8sfvnNFyCW0dEqmnW1gYojmTjWBBEJK" +
+		"xCnh8hbHhY2mfv6Jk9wk1dEnT8_8mCACrBrw97" +
+		"7oRUzlogu8yV2z1m65jpvDBGK_IsJz_GfZA2w" +
+		"SBz55hkqiMEzFqswIEC46xW5RMY0vfMMSVIO7f" +
+		"ncOlmTgJTdCVtr9RVDREBJIoWoC-OLGYat9ivx" +
+		"yA_N_mRvu5iFPZI3FniYaBjY9k_jR62I-QPIVk" +
+		"j3zWev8zKVH0Sef0lB6SAapVs1GS3rK3-oy6wk" +
+		"ACNbKY1tB7Ox6CKiJ9F8Hhvh_icOtfvjCuiY-HkJL55T4wziFQNv2xU_2W7Lw"
+
+	testCases := map[string]struct {
+		ifMatch   string
+		uaIfMatch []string
+		uaError   error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaError: nil,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"ok, if match": {
+			ifMatch:   `"v0", "v1"`,
+			uaIfMatch: []string{"v0", "v1"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"ok, if match any": {
+			ifMatch: "*",
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: if match": {
+			ifMatch:   `"v0"`,
+			uaIfMatch: []string{"v0"},
+			uaError:   store.ErrETagMismatch,
+
+			checker: mt.NewJSONResponse(
+				http.StatusPreconditionFailed,
+				nil,
+				restError(store.ErrETagMismatch.Error(), "etag_mismatch"),
+			),
+		},
+		"error: if match, weak tag": {
+			ifMatch:   `W/"v1"`,
+			uaIfMatch: []string{`W/"v1"`},
+			uaError:   store.ErrETagMismatch,
+
+			checker: mt.NewJSONResponse(
+				http.StatusPreconditionFailed,
+				nil,
+				restError(store.ErrETagMismatch.Error(), "etag_mismatch"),
+			),
+		},
+		"error: if match, user not found": {
+			ifMatch:   `"v1"`,
+			uaIfMatch: []string{"v1"},
+			uaError:   store.ErrUserNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError("user not found", "user_not_found"),
+			),
+		},
+		"error: last admin": {
+			uaError: useradm.ErrLastAdmin,
+
+			checker: mt.NewJSONResponse(
+				http.StatusConflict,
+				nil,
+				restError(useradm.ErrLastAdmin.Error(), "last_admin"),
+			),
+		},
+		"error: self delete": {
+			uaError: useradm.ErrSelfDelete,
+
+			checker: mt.NewJSONResponse(
+				http.StatusForbidden,
+				nil,
+				restError(useradm.ErrSelfDelete.Error(), "self_delete"),
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("DeleteUser", ctx, "foo", tc.uaIfMatch).Return(tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req := makeReq("DELETE",
+				"http://1.2.3.4/api/management/v1/useradm/users/foo",
+				"Bearer "+token,
+				nil)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiDeleteOwnUser(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: map[string]interface{}{
+				"password": "correcthorsebatterystaple",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: no password": {
+			body: map[string]interface{}{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("password: non zero value required;", "bad_request"),
+			),
+		},
+		"error: no body": {
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to decode request body: JSON payload is empty", "empty_request_body"),
+			),
+		},
+		"error: wrong password": {
+			body: map[string]interface{}{
+				"password": "notmypassword",
+			},
+			uaError: useradm.ErrUnauthorized,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnauthorized,
+				nil,
+				restError(useradm.ErrUnauthorized.Error(), "unauthorized"),
+			),
+		},
+		"error: last admin": {
+			body: map[string]interface{}{
+				"password": "correcthorsebatterystaple",
+			},
+			uaError: useradm.ErrLastAdmin,
+
+			checker: mt.NewJSONResponse(
+				http.StatusConflict,
+				nil,
+				restError(useradm.ErrLastAdmin.Error(), "last_admin"),
+			),
+		},
+		"error: useradm internal": {
+			body: map[string]interface{}{
+				"password": "correcthorsebatterystaple",
+			},
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("DeleteOwnUser", ctx, mock.AnythingOfType("string")).
+				Return(tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req := makeReq("DELETE",
+				"http://1.2.3.4/api/management/v1/useradm/users/me",
+				"",
+				tc.body)
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiLookupUser(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		query string
+
+		uaLookup *model.UserLookup
+		uaError  error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			query: "?email=foo%40acme.com",
+			uaLookup: &model.UserLookup{
+				ID:       "1",
+				Email:    "foo@acme.com",
+				TenantID: "tenant-1",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				&model.UserLookup{
+					ID:       "1",
+					Email:    "foo@acme.com",
+					TenantID: "tenant-1",
+				},
+			),
+		},
+		"error: no email": {
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("email or username must be provided", "bad_request"),
+			),
+		},
+		"ok, username": {
+			query: "?username=foo",
+			uaLookup: &model.UserLookup{
+				ID:       "1",
+				Email:    "foo@acme.com",
+				Username: "foo",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				&model.UserLookup{
+					ID:       "1",
+					Email:    "foo@acme.com",
+					Username: "foo",
+				},
+			),
+		},
+		"error: not found": {
+			query:   "?email=foo%40acme.com",
+			uaError: store.ErrUserNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrUserNotFound.Error(), "user_not_found"),
+			),
+		},
+		"error: useradm internal": {
+			query:   "?email=foo%40acme.com",
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("LookupUser", mtesting.ContextMatcher(), "foo@acme.com").
+				Return(tc.uaLookup, tc.uaError)
+			uadm.On("LookupUser", mtesting.ContextMatcher(), "foo").
+				Return(tc.uaLookup, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/internal/v1/useradm/users"+tc.query,
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetTenantUsers(t *testing.T) {
+	t.Parallel()
+
+	users := []model.User{
+		{ID: "1", Email: "bar@acme.com"},
+		{ID: "2", Email: "baz@acme.com"},
+		{ID: "3", Email: "foo@acme.com"},
+	}
+
+	testCases := map[string]struct {
+		query string
+		fltr  model.UserFilter
+
+		uaUsers []model.User
+		uaError error
+
+		links   []string
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			fltr:    model.UserFilter{Skip: 0, Limit: 21},
+			uaUsers: users,
+
+			links: []string{
+				`<http://1.2.3.4/api/internal/v1/useradm/tenants/1/users?page=1&per_page=20>; rel="first"`,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				users,
+			),
+		},
+		"ok: paged, with filter": {
+			query: "?page=2&per_page=2&attributes.department=rnd",
+			fltr: model.UserFilter{
+				Attributes: map[string]string{"department": "rnd"},
+				Skip:       2,
+				Limit:      3,
+			},
+			uaUsers: users,
+
+			links: []string{
+				`<http://1.2.3.4/api/internal/v1/useradm/tenants/1/users?attributes.department=rnd&page=1&per_page=2>; rel="prev"`,
+				`<http://1.2.3.4/api/internal/v1/useradm/tenants/1/users?attributes.department=rnd&page=3&per_page=2>; rel="next"`,
+				`<http://1.2.3.4/api/internal/v1/useradm/tenants/1/users?attributes.department=rnd&page=1&per_page=2>; rel="first"`,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				users[:2],
+			),
+		},
+		"error: invalid page": {
+			query: "?page=0",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("Param page is out of bounds", "bad_request"),
+			),
+		},
+		"error: invalid per_page": {
+			query: "?per_page=foo",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("Can't parse param per_page", "bad_request"),
+			),
+		},
+		"error: useradm internal": {
+			fltr:    model.UserFilter{Skip: 0, Limit: 21},
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetUsers", mock.MatchedBy(func(c context.Context) bool {
+				return identity.FromContext(c).Tenant == "1"
+			}),
+				tc.fltr).
+				Return(tc.uaUsers, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/internal/v1/useradm/tenants/1/users"+tc.query,
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+			if tc.links != nil {
+				assert.Equal(t, tc.links, recorded.Recorder.HeaderMap["Link"])
+			}
+		})
+	}
+}
+
+func TestUserAdmApiRestoreTenantUser(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: not found": {
+			uaError: store.ErrUserNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrUserNotFound.Error(), "user_not_found"),
+			),
+		},
+		"error: duplicate email": {
+			uaError: store.ErrDuplicateEmail,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnprocessableEntity,
+				nil,
+				restError(store.ErrDuplicateEmail.Error(), "duplicate_email"),
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("RestoreUser", mock.MatchedBy(func(c context.Context) bool {
+				return identity.FromContext(c).Tenant == "1"
+			}),
+				"foo").
+				Return(tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/useradm/tenants/1/users/foo/restore", nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetTenantUserData(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+	data := &model.UserData{
+		User: model.User{
+			ID:    "foo",
+			Email: "foo@acme.com",
+		},
+		Groups: []model.Group{},
+		Tokens: []model.TokenInfo{
+			{ID: "token-1", IssuedAt: ts, ExpiresAt: ts.Add(time.Hour)},
+		},
+		LoginHistory: []model.LoginEvent{},
+		ExportedTs:   ts,
+	}
+
+	testCases := map[string]struct {
+		uaData  *model.UserData
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaData: data,
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				data,
+			),
+		},
+		"error: not found": {
+			uaError: store.ErrUserNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrUserNotFound.Error(), "user_not_found"),
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetUserData", mock.MatchedBy(func(c context.Context) bool {
+				return identity.FromContext(c).Tenant == "1"
+			}),
+				"foo").
+				Return(tc.uaData, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := test.MakeSimpleRequest("GET",
+				"http://1.2.3.4/api/internal/v1/useradm/tenants/1/users/foo/data", nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiEraseTenantUserData(t *testing.T) {
+	t.Parallel()
+
+	receipt := &model.ErasureReceipt{
+		UserID:    "foo",
+		TenantID:  "1",
+		ErasedTs:  time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC),
+		Signature: "signed.receipt.token",
+	}
+
+	testCases := map[string]struct {
+		uaReceipt *model.ErasureReceipt
+		uaError   error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaReceipt: receipt,
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				receipt,
+			),
+		},
+		"error: not found": {
+			uaError: store.ErrUserNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(store.ErrUserNotFound.Error(), "user_not_found"),
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("EraseUser", mock.MatchedBy(func(c context.Context) bool {
+				return identity.FromContext(c).Tenant == "1"
+			}),
+				"foo").
+				Return(tc.uaReceipt, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := test.MakeSimpleRequest("DELETE",
+				"http://1.2.3.4/api/internal/v1/useradm/tenants/1/users/foo/data", nil)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiImpersonateTenantUser(t *testing.T) {
+	t.Parallel()
+
+	imp := model.Impersonation{
+		Actor:     "support@mender.io",
+		Reason:    "ticket 1234",
+		ExpiresIn: 600,
+	}
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaToken *jwt.Token
+		uaError error
+
+		signed  string
+		signErr error
+
+		status  int
+		outBody string
+	}{
+		"ok": {
+			body:    imp,
+			uaToken: &jwt.Token{Id: "t1"},
+			signed:  "signed.impersonation.token",
+
+			status:  http.StatusOK,
+			outBody: "signed.impersonation.token",
+		},
+		"error: no reason": {
+			body: map[string]interface{}{"actor": "support@mender.io"},
+
+			status: http.StatusBadRequest,
+		},
+		"error: unknown field": {
+			body: map[string]interface{}{
+				"actor":  "support@mender.io",
+				"reason": "ticket 1234",
+				"scope":  "mender.*",
+			},
+
+			status: http.StatusBadRequest,
+		},
+		"error: not found": {
+			body:    imp,
+			uaError: store.ErrUserNotFound,
+
+			status: http.StatusNotFound,
+		},
+		"error: sign": {
+			body:    imp,
+			uaToken: &jwt.Token{Id: "t1"},
+			signErr: errors.New("sign failed"),
+
+			status: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			uadm := &museradm.App{}
+			uadm.On("Impersonate", mock.MatchedBy(func(c context.Context) bool {
+				return identity.FromContext(c).Tenant == "1"
+			}),
+				"foo", imp).
+				Return(tc.uaToken, tc.uaError)
+			uadm.On("SignToken", mock.Anything, tc.uaToken).
+				Return(tc.signed, tc.signErr)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := test.MakeSimpleRequest("POST",
+				"http://1.2.3.4/api/internal/v1/useradm/tenants/1/users/foo/impersonate",
+				tc.body)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+			recorded.CodeIs(tc.status)
+			if tc.status == http.StatusOK {
+				assert.Equal(t, "application/jwt",
+					recorded.Recorder.HeaderMap.Get("Content-Type"))
+				recorded.BodyIs(tc.outBody)
+			}
+		})
+	}
+}
+
+func TestUserAdmApiCreateTenant(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaError error
+		body    interface{}
+		tenant  model.NewTenant
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaError: nil,
+			body: map[string]interface{}{
+				"tenant_id": "foobar",
+			},
+			tenant: model.NewTenant{ID: "foobar"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				nil,
+				nil,
+			),
+		},
+		"ok, with admin": {
+			body: map[string]interface{}{
+				"tenant_id":   "foobar",
+				"admin_email": "admin@acme.com",
+			},
+			tenant: model.NewTenant{ID: "foobar", AdminEmail: "admin@acme.com"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusCreated,
+				nil,
+				nil,
+			),
+		},
+		"error: invalid admin email": {
+			body: map[string]interface{}{
+				"tenant_id":   "foobar",
+				"admin_email": "admin",
+			},
+			tenant: model.NewTenant{ID: "foobar", AdminEmail: "admin"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("admin_email: admin does not validate as email;",
+					"bad_request"),
+			),
+		},
+		"error: tenant has users": {
+			body: map[string]interface{}{
+				"tenant_id":   "foobar",
+				"admin_email": "admin@acme.com",
+			},
+			uaError: useradm.ErrTenantHasUsers,
+			tenant:  model.NewTenant{ID: "foobar", AdminEmail: "admin@acme.com"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusConflict,
+				nil,
+				restError("tenant already has users", "tenant_has_users"),
+			),
+		},
+		"error: useradm internal": {
+			body: map[string]interface{}{
+				"tenant_id": "failing-tenant",
+			},
+			uaError: errors.New("some internal error"),
+			tenant:  model.NewTenant{ID: "failing-tenant"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+		"error: no tenant id": {
+			body: map[string]interface{}{
+				"tenant_id": "",
+			},
+			tenant: model.NewTenant{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("tenant_id: non zero value required;", "bad_request"),
+			),
+		},
+		"error: empty json": {
+			tenant: model.NewTenant{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("JSON payload is empty", "empty_request_body"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("CreateTenant", ctx, tc.tenant).Return(tc.uaError)
+
+			//make handler
+			api := makeMockApiHandler(t, uadm, nil)
+
+			//make request
+			req := makeReq(http.MethodPost,
+				"http://1.2.3.4/api/internal/v1/useradm/tenants",
+				"",
+				tc.body)
+
+			//test
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiDeleteTenant(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("DeleteTenant", mtesting.ContextMatcher(), "foo").
+				Return(tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodDelete,
+				"http://1.2.3.4/api/internal/v1/useradm/tenants/foo",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetTenantMigrationStatus(t *testing.T) {
+	t.Parallel()
+
+	status := &model.MigrationStatus{
+		TenantID: "foo",
+		Version:  "0.1.0",
+		Target:   "1.0.0",
+		Steps: []model.MigrationStep{
+			{Version: "0.1.0", Description: "initial schema"},
+			{Version: "1.0.0", Description: "index tokens and login history by user"},
+		},
+	}
+
+	testCases := map[string]struct {
+		uaStatus *model.MigrationStatus
+		uaError  error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaStatus: status,
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				status,
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetTenantMigrationStatus", mtesting.ContextMatcher(), "foo").
+				Return(tc.uaStatus, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/internal/v1/useradm/tenants/foo/migrations",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetMigrationProgress(t *testing.T) {
+	t.Parallel()
+
+	progress := &model.MigrationProgress{
+		Version:   "1.0.0",
+		Total:     10,
+		Migrated:  4,
+		Skipped:   2,
+		StartedTs: time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC),
+		UpdatedTs: time.Date(2018, 6, 1, 10, 5, 0, 0, time.UTC),
+	}
+
+	testCases := map[string]struct {
+		uaProgress *model.MigrationProgress
+		uaError    error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaProgress: progress,
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				progress,
+			),
+		},
+		"error: no migration": {
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError("no migration was run", "not_found"),
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetMigrationProgress", mtesting.ContextMatcher()).
+				Return(tc.uaProgress, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/internal/v1/useradm/migrations",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetJobStatuses(t *testing.T) {
+	t.Parallel()
+
+	success := time.Date(2018, 6, 1, 9, 0, 0, 0, time.UTC)
+	statuses := []model.JobStatus{
+		{
+			Name:           "delete expired tokens",
+			Runs:           2,
+			Failures:       1,
+			LastStartedTs:  time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC),
+			LastFinishedTs: time.Date(2018, 6, 1, 10, 0, 1, 0, time.UTC),
+			LastDurationMs: 1000,
+			LastError:      "db connection failed",
+			LastSuccessTs:  &success,
+		},
+	}
+
+	testCases := map[string]struct {
+		uaStatuses []model.JobStatus
+		uaError    error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaStatuses: statuses,
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				statuses,
+			),
+		},
+		"ok, no runs": {
+			uaStatuses: []model.JobStatus{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]model.JobStatus{},
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetJobStatuses", mtesting.ContextMatcher()).
+				Return(tc.uaStatuses, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/internal/v1/useradm/jobs",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiGetUserCounts(t *testing.T) {
+	t.Parallel()
+
+	counts := []model.UserCount{
+		{TenantID: "foo", Total: 12, Active: 4},
+		{TenantID: "bar", Total: 1, Active: 0},
+	}
+
+	testCases := map[string]struct {
+		uaCounts []model.UserCount
+		uaError  error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaCounts: counts,
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				counts,
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetUserCounts", mtesting.ContextMatcher()).
+				Return(tc.uaCounts, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/internal/v1/useradm/usage/users",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiSetTenantLimit(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		name string
+		body interface{}
+
+		uaLimit *model.Limit
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			name:    model.LimitMaxUsers,
+			body:    map[string]interface{}{"value": 10},
+			uaLimit: &model.Limit{Name: model.LimitMaxUsers, Value: 10},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: unknown limit": {
+			name: "max_devices",
+			body: map[string]interface{}{"value": 10},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(model.ErrUnknownLimit.Error(), "unknown_limit"),
+			),
+		},
+		"error: negative value": {
+			name: model.LimitMaxUsers,
+			body: map[string]interface{}{"value": -1},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("value: must not be negative",
+					model.NewFieldError("value", "must not be negative")),
+			),
+		},
+		"error: no body": {
+			name: model.LimitMaxUsers,
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to decode request body: JSON payload is empty", "empty_request_body"),
+			),
+		},
+		"error: useradm internal": {
+			name:    model.LimitMaxUsers,
+			body:    map[string]interface{}{"value": 10},
+			uaLimit: &model.Limit{Name: model.LimitMaxUsers, Value: 10},
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			if tc.uaLimit != nil {
+				uadm.On("SetLimit", mock.MatchedBy(func(c context.Context) bool {
+					return identity.FromContext(c).Tenant == "1"
+				}),
+					*tc.uaLimit).
+					Return(tc.uaError)
+			}
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodPut,
+				"http://1.2.3.4/api/internal/v1/useradm/tenants/1/limits/"+tc.name,
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+			uadm.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserAdmApiGetLimit(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaUsage *model.LimitUsage
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaUsage: &model.LimitUsage{
+				Limit: model.Limit{Name: model.LimitMaxUsers, Value: 10},
+				Usage: 4,
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				map[string]interface{}{
+					"name":  model.LimitMaxUsers,
+					"value": 10,
+					"usage": 4,
+				},
+			),
+		},
+		"error: unknown limit": {
+			uaError: model.ErrUnknownLimit,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(model.ErrUnknownLimit.Error(), "unknown_limit"),
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetLimitUsage", mtesting.ContextMatcher(), model.LimitMaxUsers).
+				Return(tc.uaUsage, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v1/useradm/limits/max_users",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiSetTenantPlan(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body interface{}
+
+		uaPlan  *model.Plan
+		uaError error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body:   map[string]interface{}{"name": model.PlanProfessional},
+			uaPlan: &model.Plan{Name: model.PlanProfessional},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				nil,
+				nil,
+			),
+		},
+		"error: unknown plan": {
+			body: map[string]interface{}{"name": "gold"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError(model.ErrUnknownPlan.Error(), "unknown_plan"),
+			),
+		},
+		"error: unknown field": {
+			body: map[string]interface{}{
+				"name":      model.PlanProfessional,
+				"max_users": 1000,
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("max_users: unknown field",
+					model.NewFieldError("max_users", "unknown field")),
+			),
+		},
+		"error: useradm internal": {
+			body:    map[string]interface{}{"name": model.PlanProfessional},
+			uaPlan:  &model.Plan{Name: model.PlanProfessional},
+			uaError: errors.New("some internal error"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			if tc.uaPlan != nil {
+				uadm.On("SetPlan", mock.MatchedBy(func(c context.Context) bool {
+					return identity.FromContext(c).Tenant == "1"
+				}),
+					*tc.uaPlan).
+					Return(tc.uaError)
+			}
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodPut,
+				"http://1.2.3.4/api/internal/v1/useradm/tenants/1/plan",
+				"",
+				tc.body)
+
 			recorded := test.RunRequest(t, api, req)
 			mt.CheckResponse(t, tc.checker, recorded)
+			uadm.AssertExpectations(t)
 		})
 	}
 }
 
-func TestUserAdmApiGetUser(t *testing.T) {
+func TestUserAdmApiSetTenantStatus(t *testing.T) {
 	t.Parallel()
 
-	// we setup authz, so a real token is needed
-	token := "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9." +
-		"eyJleHAiOjQ0ODE4OTM5MDAsImlzcyI6Im1lb" +
-		"mRlciIsInN1YiI6InRlc3RzdWJqZWN0Iiwic2" +
-		"NwIjoibWVuZGVyLioifQ.NzXNhh_59_03mal_" +
-		"-KImArI8sfvnNFyCW0dEqmnW1gYojmTjWBBEJK" +
-		"xCnh8hbHhY2mfv6Jk9wk1dEnT8_8mCACrBrw97" +
-		"7oRUzlogu8yV2z1m65jpvDBGK_IsJz_GfZA2w" +
-		"SBz55hkqiMEzFqswIEC46xW5RMY0vfMMSVIO7f" +
-		"ncOlmTgJTdCVtr9RVDREBJIoWoC-OLGYat9ivx" +
-		"yA_N_mRvu5iFPZI3FniYaBjY9k_jR62I-QPIVk" +
-		"j3zWev8zKVH0Sef0lB6SAapVs1GS3rK3-oy6wk" +
-		"ACNbKY1tB7Ox6CKiJ9F8Hhvh_icOtfvjCuiY-HkJL55T4wziFQNv2xU_2W7Lw"
-
-	now := time.Now()
 	testCases := map[string]struct {
-		uaUser  *model.User
-		uaError error
+		body interface{}
+
+		uaStatus string
+		uaError  error
 
 		checker mt.ResponseChecker
 	}{
 		"ok": {
-			uaUser: &model.User{
-				ID:        "1",
-				Email:     "foo@acme.com",
-				CreatedTs: &now,
-				UpdatedTs: &now,
-			},
-			uaError: nil,
+			body:     map[string]interface{}{"status": model.TenantStatusTrialExpired},
+			uaStatus: model.TenantStatusTrialExpired,
 
 			checker: mt.NewJSONResponse(
-				http.StatusOK,
+				http.StatusNoContent,
+				nil,
 				nil,
-				&model.User{
-					ID:        "1",
-					Email:     "foo@acme.com",
-					CreatedTs: &now,
-					UpdatedTs: &now,
-				},
 			),
 		},
-		"not found": {
-			uaUser:  nil,
-			uaError: nil,
+		"error: unknown status": {
+			body: map[string]interface{}{"status": "frozen"},
 
 			checker: mt.NewJSONResponse(
-				http.StatusNotFound,
+				http.StatusBadRequest,
 				nil,
-				restError("user not found"),
+				restError(model.ErrUnknownTenantStatus.Error(), "unknown_tenant_status"),
 			),
 		},
 		"error: useradm internal": {
-			uaUser:  nil,
-			uaError: errors.New("some internal error"),
+			body:     map[string]interface{}{"status": model.TenantStatusActive},
+			uaStatus: model.TenantStatusActive,
+			uaError:  errors.New("some internal error"),
 
 			checker: mt.NewJSONResponse(
 				http.StatusInternalServerError,
 				nil,
-				restError("internal error"),
+				restError("internal error", "internal_error"),
 			),
 		},
 	}
@@ -890,57 +3711,57 @@ func TestUserAdmApiGetUser(t *testing.T) {
 	for name, tc := range testCases {
 		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
 
-			ctx := mtesting.ContextMatcher()
-
-			//make mock useradm
 			uadm := &museradm.App{}
-			uadm.On("GetUser", ctx, "foo").Return(tc.uaUser, tc.uaError)
+			if tc.uaStatus != "" {
+				uadm.On("SetTenantStatus", mock.MatchedBy(func(c context.Context) bool {
+					return identity.FromContext(c).Tenant == "1"
+				}),
+					tc.uaStatus).
+					Return(tc.uaError)
+			}
 
-			//make handler
 			api := makeMockApiHandler(t, uadm, nil)
 
-			//make request
-			req := makeReq("GET",
-				"http://1.2.3.4/api/management/v1/useradm/users/foo",
-				"Bearer "+token,
-				nil)
+			req := makeReq(http.MethodPut,
+				"http://1.2.3.4/api/internal/v1/useradm/tenants/1/status",
+				"",
+				tc.body)
 
-			//test
 			recorded := test.RunRequest(t, api, req)
 			mt.CheckResponse(t, tc.checker, recorded)
+			uadm.AssertExpectations(t)
 		})
 	}
 }
 
-func TestUserAdmApiDeleteUser(t *testing.T) {
+func TestUserAdmApiGetPlan(t *testing.T) {
 	t.Parallel()
 
-	// we setup authz, so a real token is needed
-	token := "eyJhbGciOiJSUzI1NiIsInR5cCI6IkpXVCJ9." +
-		"eyJleHAiOjQ0ODE4OTM5MDAsImlzcyI6Im1lb" +
-		"mRlciIsInN1YiI6InRlc3RzdWJqZWN0Iiwic2" +
-		"NwIjoibWVuZGVyLioifQ.NzXNhh_59_03mal_" +
-		"-KImArI8sfvnNFyCW0dEqmnW1gYojmTjWBBEJK" +
-		"xCnh8hbHhY2mfv6Jk9wk1dEnT8_8mCACrBrw97" +
-		"7oRUzlogu8yV2z1m65jpvDBGK_IsJz_GfZA2w" +
-		"SBz55hkqiMEzFqswIEC46xW5RMY0vfMMSVIO7f" +
-		"ncOlmTgJTdCVtr9RVDREBJIoWoC-OLGYat9ivx" +
-		"yA_N_mRvu5iFPZI3FniYaBjY9k_jR62I-QPIVk" +
-		"j3zWev8zKVH0Sef0lB6SAapVs1GS3rK3-oy6wk" +
-		"ACNbKY1tB7Ox6CKiJ9F8Hhvh_icOtfvjCuiY-HkJL55T4wziFQNv2xU_2W7Lw"
-
 	testCases := map[string]struct {
+		uaInfo  *model.PlanInfo
 		uaError error
 
 		checker mt.ResponseChecker
 	}{
 		"ok": {
-			uaError: nil,
+			uaInfo: &model.PlanInfo{
+				Name: model.PlanOpenSource,
+				PlanCapabilities: model.PlanCapabilities{
+					MaxUsers:         5,
+					LoginHistoryDays: 7,
+					Capabilities:     []string{},
+				},
+			},
 
 			checker: mt.NewJSONResponse(
-				http.StatusNoContent,
-				nil,
+				http.StatusOK,
 				nil,
+				map[string]interface{}{
+					"name":               model.PlanOpenSource,
+					"max_users":          5,
+					"login_history_days": 7,
+					"capabilities":       []string{},
+				},
 			),
 		},
 		"error: useradm internal": {
@@ -949,7 +3770,7 @@ func TestUserAdmApiDeleteUser(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusInternalServerError,
 				nil,
-				restError("internal error"),
+				restError("internal error", "internal_error"),
 			),
 		},
 	}
@@ -957,83 +3778,61 @@ func TestUserAdmApiDeleteUser(t *testing.T) {
 	for name, tc := range testCases {
 		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
 
-			ctx := mtesting.ContextMatcher()
-
-			//make mock useradm
 			uadm := &museradm.App{}
-			uadm.On("DeleteUser", ctx, "foo").Return(tc.uaError)
+			uadm.On("GetPlan", mtesting.ContextMatcher()).
+				Return(tc.uaInfo, tc.uaError)
 
-			//make handler
 			api := makeMockApiHandler(t, uadm, nil)
 
-			//make request
-			req := makeReq("DELETE",
-				"http://1.2.3.4/api/management/v1/useradm/users/foo",
-				"Bearer "+token,
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v1/useradm/plan",
+				"",
 				nil)
 
-			//test
 			recorded := test.RunRequest(t, api, req)
 			mt.CheckResponse(t, tc.checker, recorded)
 		})
 	}
 }
 
-func TestUserAdmApiCreateTenant(t *testing.T) {
+func TestUserAdmApiGetOwnSettings(t *testing.T) {
 	t.Parallel()
 
 	testCases := map[string]struct {
-		uaError error
-		body    interface{}
-		tenant  model.NewTenant
+		uaSettings map[string]interface{}
+		uaError    error
 
 		checker mt.ResponseChecker
 	}{
 		"ok": {
-			uaError: nil,
-			body: map[string]interface{}{
-				"tenant_id": "foobar",
-			},
-			tenant: model.NewTenant{ID: "foobar"},
-
-			checker: mt.NewJSONResponse(
-				http.StatusCreated,
-				nil,
-				nil,
-			),
-		},
-		"error: useradm internal": {
-			body: map[string]interface{}{
-				"tenant_id": "failing-tenant",
+			uaSettings: map[string]interface{}{
+				"theme": "dark",
 			},
-			uaError: errors.New("some internal error"),
-			tenant:  model.NewTenant{ID: "failing-tenant"},
 
 			checker: mt.NewJSONResponse(
-				http.StatusInternalServerError,
+				http.StatusOK,
 				nil,
-				restError("internal error"),
+				map[string]interface{}{
+					"theme": "dark",
+				},
 			),
 		},
-		"error: no tenant id": {
-			body: map[string]interface{}{
-				"tenant_id": "",
-			},
-			tenant: model.NewTenant{},
+		"error: no identity": {
+			uaError: useradm.ErrUnauthorized,
 
 			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
+				http.StatusUnauthorized,
 				nil,
-				restError("tenant_id: non zero value required;"),
+				restError(useradm.ErrUnauthorized.Error(), "unauthorized"),
 			),
 		},
-		"error: empty json": {
-			tenant: model.NewTenant{},
+		"error: generic": {
+			uaError: errors.New("failed to get settings"),
 
 			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
+				http.StatusInternalServerError,
 				nil,
-				restError("JSON payload is empty"),
+				restError("internal error", "internal_error"),
 			),
 		},
 	}
@@ -1045,16 +3844,16 @@ func TestUserAdmApiCreateTenant(t *testing.T) {
 
 			//make mock useradm
 			uadm := &museradm.App{}
-			uadm.On("CreateTenant", ctx, tc.tenant).Return(tc.uaError)
+			uadm.On("GetOwnSettings", ctx).Return(tc.uaSettings, tc.uaError)
 
 			//make handler
 			api := makeMockApiHandler(t, uadm, nil)
 
 			//make request
-			req := makeReq(http.MethodPost,
-				"http://1.2.3.4/api/internal/v1/useradm/tenants",
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v1/useradm/users/me/settings",
 				"",
-				tc.body)
+				nil)
 
 			//test
 			recorded := test.RunRequest(t, api, req)
@@ -1063,35 +3862,42 @@ func TestUserAdmApiCreateTenant(t *testing.T) {
 	}
 }
 
-func TestUserAdmApiSaveSettings(t *testing.T) {
+func TestUserAdmApiSaveOwnSettings(t *testing.T) {
 	t.Parallel()
 
 	testCases := map[string]struct {
 		body interface{}
 
-		dbError error
+		uaError error
 
 		checker mt.ResponseChecker
 	}{
 		"ok": {
 			body: map[string]interface{}{
-				"foo": "foo-val",
-				"bar": "bar-val",
+				"theme": "dark",
 			},
 
 			checker: mt.NewJSONResponse(
-				http.StatusCreated,
+				http.StatusNoContent,
 				nil,
 				nil,
 			),
 		},
-		"ok, empty": {
-			body: map[string]interface{}{},
+		"error, read-only timestamps": {
+			body: map[string]interface{}{
+				"theme":      "dark",
+				"created_ts": "2018-01-01T00:00:00Z",
+			},
+
+			uaError: model.FieldErrors{
+				model.NewFieldError("created_ts", "field can't be modified"),
+			},
 
 			checker: mt.NewJSONResponse(
-				http.StatusCreated,
-				nil,
+				http.StatusBadRequest,
 				nil,
+				restFieldError("created_ts: field can't be modified",
+					model.NewFieldError("created_ts", "field can't be modified")),
 			),
 		},
 		"error, not json": {
@@ -1100,21 +3906,33 @@ func TestUserAdmApiSaveSettings(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusBadRequest,
 				nil,
-				restError("cannot parse request body as json"),
+				restError("cannot parse request body as json", "bad_request"),
+			),
+		},
+		"error, no identity": {
+			body: map[string]interface{}{
+				"theme": "dark",
+			},
+
+			uaError: useradm.ErrUnauthorized,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnauthorized,
+				nil,
+				restError(useradm.ErrUnauthorized.Error(), "unauthorized"),
 			),
 		},
-		"error, db": {
+		"error, useradm internal": {
 			body: map[string]interface{}{
-				"foo": "foo-val",
-				"bar": "bar-val",
+				"theme": "dark",
 			},
 
-			dbError: errors.New("generic"),
+			uaError: errors.New("generic"),
 
 			checker: mt.NewJSONResponse(
 				http.StatusInternalServerError,
 				nil,
-				restError("internal error"),
+				restError("internal error", "internal_error"),
 			),
 		},
 	}
@@ -1124,16 +3942,16 @@ func TestUserAdmApiSaveSettings(t *testing.T) {
 
 			ctx := mtesting.ContextMatcher()
 
-			//make mock store
-			db := &mstore.DataStore{}
-			db.On("SaveSettings", ctx, tc.body).Return(tc.dbError)
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("SaveOwnSettings", ctx, tc.body).Return(tc.uaError)
 
 			//make handler
-			api := makeMockApiHandler(t, nil, db)
+			api := makeMockApiHandler(t, uadm, nil)
 
 			//make request
-			req := makeReq(http.MethodPost,
-				"http://1.2.3.4/api/management/v1/useradm/settings",
+			req := makeReq(http.MethodPut,
+				"http://1.2.3.4/api/management/v1/useradm/users/me/settings",
 				"",
 				tc.body)
 
@@ -1144,37 +3962,97 @@ func TestUserAdmApiSaveSettings(t *testing.T) {
 	}
 }
 
-func TestUserAdmApiGetSettings(t *testing.T) {
+func makeReq(method, url, auth string, body interface{}) *http.Request {
+	req := test.MakeSimpleRequest(method, url, body)
+
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	req.Header.Add(requestid.RequestIdHeader, "test")
+
+	return req
+}
+
+func restError(status, code string) map[string]interface{} {
+	return map[string]interface{}{"error": status, "code": code, "request_id": "test"}
+}
+
+func restFieldError(status string, fields ...*model.FieldError) map[string]interface{} {
+	fe := []interface{}{}
+	for _, f := range fields {
+		fe = append(fe, map[string]interface{}{"field": f.Field, "message": f.Message})
+	}
+	e := restError(status, "validation_failed")
+	e["fields"] = fe
+	return e
+}
+
+func TestUserAdmApiDeleteTokens(t *testing.T) {
 	t.Parallel()
 
+	revocation := &model.TokenRevocation{
+		ID:        "1",
+		TenantID:  "foo",
+		Status:    model.RevocationStatusPending,
+		CreatedTs: time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC),
+	}
+	userRevocation := &model.TokenRevocation{
+		ID:        "2",
+		TenantID:  "foo",
+		UserID:    "bar",
+		Status:    model.RevocationStatusPending,
+		CreatedTs: time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC),
+	}
+
 	testCases := map[string]struct {
-		dbSettings map[string]interface{}
-		dbError    error
+		params string
+
+		uaTenant     string
+		uaUser       string
+		uaRevocation *model.TokenRevocation
+		uaError      error
 
 		checker mt.ResponseChecker
 	}{
-		"ok": {
-			dbSettings: map[string]interface{}{
-				"foo": "foo-val",
-				"bar": "bar-val",
-			},
+		"ok, tenant": {
+			params:       "?tenant_id=foo",
+			uaTenant:     "foo",
+			uaRevocation: revocation,
 
 			checker: mt.NewJSONResponse(
-				http.StatusOK,
+				http.StatusAccepted,
+				map[string]string{"Location": "tokens/revocations/1"},
+				revocation,
+			),
+		},
+		"ok, tenant and user": {
+			params:       "?tenant_id=foo&user_id=bar",
+			uaTenant:     "foo",
+			uaUser:       "bar",
+			uaRevocation: userRevocation,
+
+			checker: mt.NewJSONResponse(
+				http.StatusAccepted,
+				map[string]string{"Location": "tokens/revocations/2"},
+				userRevocation,
+			),
+		},
+		"error: wrong params": {
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
 				nil,
-				map[string]interface{}{
-					"foo": "foo-val",
-					"bar": "bar-val",
-				},
+				restError("tenant_id must be provided", "bad_request"),
 			),
 		},
-		"error: generic": {
-			dbError: errors.New("failed to get settings"),
+		"error: useradm internal": {
+			params:   "?tenant_id=foo",
+			uaTenant: "foo",
+			uaError:  errors.New("some internal error"),
 
 			checker: mt.NewJSONResponse(
 				http.StatusInternalServerError,
 				nil,
-				restError("internal error"),
+				restError("internal error", "internal_error"),
 			),
 		},
 	}
@@ -1184,16 +4062,17 @@ func TestUserAdmApiGetSettings(t *testing.T) {
 
 			ctx := mtesting.ContextMatcher()
 
-			//make mock store
-			db := &mstore.DataStore{}
-			db.On("GetSettings", ctx).Return(tc.dbSettings, tc.dbError)
+			//make mock useradm
+			uadm := &museradm.App{}
+			uadm.On("RevokeTokens", ctx, tc.uaTenant, tc.uaUser).
+				Return(tc.uaRevocation, tc.uaError)
 
 			//make handler
-			api := makeMockApiHandler(t, nil, db)
+			api := makeMockApiHandler(t, uadm, nil)
 
 			//make request
-			req := makeReq(http.MethodGet,
-				"http://1.2.3.4/api/management/v1/useradm/settings",
+			req := makeReq("DELETE",
+				"http://1.2.3.4/api/internal/v1/useradm/tokens"+tc.params,
 				"",
 				nil)
 
@@ -1204,68 +4083,47 @@ func TestUserAdmApiGetSettings(t *testing.T) {
 	}
 }
 
-func makeReq(method, url, auth string, body interface{}) *http.Request {
-	req := test.MakeSimpleRequest(method, url, body)
+func TestUserAdmApiGetTokenRevocation(t *testing.T) {
+	t.Parallel()
 
-	if auth != "" {
-		req.Header.Set("Authorization", auth)
+	finished := time.Date(2018, 6, 1, 10, 0, 5, 0, time.UTC)
+	revocation := &model.TokenRevocation{
+		ID:         "1",
+		TenantID:   "foo",
+		Status:     model.RevocationStatusDone,
+		CreatedTs:  time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC),
+		FinishedTs: &finished,
 	}
-	req.Header.Add(requestid.RequestIdHeader, "test")
-
-	return req
-}
-
-func restError(status string) map[string]interface{} {
-	return map[string]interface{}{"error": status, "request_id": "test"}
-}
-
-func TestUserAdmApiDeleteTokens(t *testing.T) {
-	t.Parallel()
 
 	testCases := map[string]struct {
-		params string
-
-		uaError error
+		uaRevocation *model.TokenRevocation
+		uaError      error
 
 		checker mt.ResponseChecker
 	}{
-		"ok, tenant": {
-			params:  "?tenant_id=foo",
-			uaError: nil,
-
-			checker: mt.NewJSONResponse(
-				http.StatusNoContent,
-				nil,
-				nil,
-			),
-		},
-		"ok, tenant and user": {
-			params:  "?tenant_id=foo&user_id=bar",
-			uaError: nil,
+		"ok": {
+			uaRevocation: revocation,
 
 			checker: mt.NewJSONResponse(
-				http.StatusNoContent,
-				nil,
+				http.StatusOK,
 				nil,
+				revocation,
 			),
 		},
-		"error: wrong params": {
-			uaError: nil,
-
+		"error: not found": {
 			checker: mt.NewJSONResponse(
-				http.StatusBadRequest,
+				http.StatusNotFound,
 				nil,
-				restError("tenant_id must be provided"),
+				restError("token revocation not found", "not_found"),
 			),
 		},
 		"error: useradm internal": {
-			params:  "?tenant_id=foo",
 			uaError: errors.New("some internal error"),
 
 			checker: mt.NewJSONResponse(
 				http.StatusInternalServerError,
 				nil,
-				restError("internal error"),
+				restError("internal error", "internal_error"),
 			),
 		},
 	}
@@ -1273,22 +4131,17 @@ func TestUserAdmApiDeleteTokens(t *testing.T) {
 	for name, tc := range testCases {
 		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
 
-			ctx := mtesting.ContextMatcher()
-
-			//make mock useradm
 			uadm := &museradm.App{}
-			uadm.On("DeleteTokens", ctx, mock.AnythingOfType("string"), mock.AnythingOfType("string")).Return(tc.uaError)
+			uadm.On("GetTokenRevocation", mtesting.ContextMatcher(), "1").
+				Return(tc.uaRevocation, tc.uaError)
 
-			//make handler
 			api := makeMockApiHandler(t, uadm, nil)
 
-			//make request
-			req := makeReq("DELETE",
-				"http://1.2.3.4/api/internal/v1/useradm/tokens"+tc.params,
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/internal/v1/useradm/tokens/revocations/1",
 				"",
 				nil)
 
-			//test
 			recorded := test.RunRequest(t, api, req)
 			mt.CheckResponse(t, tc.checker, recorded)
 		})
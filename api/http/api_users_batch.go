@@ -0,0 +1,278 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	useradm "github.com/mendersoftware/useradm/user"
+)
+
+const (
+	// max number of users created by a single batch request
+	maxUsersBatchSize = 1000
+
+	batchStatusCreated   = "created"
+	batchStatusDuplicate = "duplicate"
+	batchStatusInvalid   = "invalid"
+	batchStatusFailed    = "failed"
+)
+
+var (
+	ErrEmptyUsersBatch    = errors.New("no users provided")
+	ErrUsersBatchTooLarge = errors.New("too many users, the limit is 1000")
+	ErrUsersBatchNotArray = errors.New("expected a JSON array of users")
+	ErrCSVContentType     = errors.New("Bad Content-Type, expected '" +
+		mediaTypeCSV + "'")
+	ErrEmptyCSV = errors.New("no header row, expected e.g. 'email,password,name'")
+)
+
+// batchUserResult is the outcome of creating one user of a batch
+type batchUserResult struct {
+	// position of the user in the request
+	Index int `json:"index"`
+
+	// one of: created, duplicate, invalid, failed
+	Status string `json:"status"`
+
+	// ID of the created user
+	ID string `json:"id,omitempty"`
+
+	Email string `json:"email,omitempty"`
+
+	// why the user wasn't created
+	Error  string            `json:"error,omitempty"`
+	Code   string            `json:"code,omitempty"`
+	Fields model.FieldErrors `json:"fields,omitempty"`
+}
+
+func (u *UserAdmApiHandlers) AddUsersBatchHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var items []json.RawMessage
+	if err := r.DecodeJsonPayload(&items); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			err = ErrUsersBatchNotArray
+		}
+		restErr(w, r, l, errors.Wrap(err, "failed to decode request body"),
+			http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case len(items) == 0:
+		restErr(w, r, l, ErrEmptyUsersBatch, http.StatusBadRequest)
+		return
+	case len(items) > maxUsersBatchSize:
+		restErr(w, r, l, ErrUsersBatchTooLarge, http.StatusBadRequest)
+		return
+	}
+
+	users := make([]*model.User, len(items))
+	results := make([]batchUserResult, len(items))
+
+	for i, item := range items {
+		results[i].Index = i
+
+		user := model.User{}
+		err := decodeStrict(item, &user)
+		if err == nil {
+			err = user.ValidateNew()
+		}
+		if err != nil {
+			results[i].Email = user.Email
+			results[i].setError(batchStatusInvalid, err, http.StatusBadRequest)
+			continue
+		}
+
+		users[i] = &user
+	}
+
+	u.createUsers(ctx, users, results)
+
+	w.WriteJson(results)
+}
+
+// csvUserColumns are the user fields accepted in CSV imports, by column name
+var csvUserColumns = map[string]func(u *model.User, v string){
+	"email":    func(u *model.User, v string) { u.Email = v },
+	"password": func(u *model.User, v string) { u.Password = v },
+	"name":     func(u *model.User, v string) { u.Name = v },
+	"phone":    func(u *model.User, v string) { u.Phone = v },
+	"locale":   func(u *model.User, v string) { u.Locale = v },
+	"timezone": func(u *model.User, v string) { u.Timezone = v },
+}
+
+func (u *UserAdmApiHandlers) ImportUsersHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediatype != mediaTypeCSV {
+		restErr(w, r, l, ErrCSVContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	reader := csv.NewReader(r.Body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			err = ErrEmptyCSV
+		}
+		restErr(w, r, l, errors.Wrap(err, "failed to read CSV header"),
+			http.StatusBadRequest)
+		return
+	}
+
+	if err := checkCSVHeader(header); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	users := []*model.User{}
+	results := []batchUserResult{}
+
+	for i := 0; ; i++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			restErr(w, r, l, errors.Wrap(err, "failed to read CSV"),
+				http.StatusBadRequest)
+			return
+		}
+
+		if i == maxUsersBatchSize {
+			restErr(w, r, l, ErrUsersBatchTooLarge, http.StatusBadRequest)
+			return
+		}
+
+		res := batchUserResult{Index: i}
+
+		user := &model.User{}
+		for c, v := range row {
+			if c < len(header) {
+				csvUserColumns[header[c]](user, strings.TrimSpace(v))
+			}
+		}
+		res.Email = user.Email
+
+		if len(row) != len(header) {
+			res.setError(batchStatusInvalid,
+				errors.Errorf("expected %d columns, got %d", len(header), len(row)),
+				http.StatusBadRequest)
+			user = nil
+		} else if err := user.ValidateNew(); err != nil {
+			res.setError(batchStatusInvalid, err, http.StatusBadRequest)
+			user = nil
+		}
+
+		users = append(users, user)
+		results = append(results, res)
+	}
+
+	if len(users) == 0 {
+		restErr(w, r, l, ErrEmptyUsersBatch, http.StatusBadRequest)
+		return
+	}
+
+	u.createUsers(ctx, users, results)
+
+	w.WriteJson(results)
+}
+
+// checkCSVHeader checks that the columns are known user fields, given once
+func checkCSVHeader(header []string) error {
+	errs := model.FieldErrors{}
+	seen := map[string]bool{}
+
+	for i, c := range header {
+		c = strings.ToLower(strings.TrimSpace(c))
+		header[i] = c
+
+		switch _, known := csvUserColumns[c]; {
+		case !known:
+			errs = append(errs, model.NewFieldError(c, "unknown column"))
+		case seen[c]:
+			errs = append(errs, model.NewFieldError(c, "duplicate column"))
+		}
+		seen[c] = true
+	}
+
+	if !seen["email"] {
+		errs = append(errs, model.NewFieldError("email", "missing column"))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// createUsers creates the given users one by one, recording the outcome
+// in the matching results; nil users are skipped
+func (u *UserAdmApiHandlers) createUsers(ctx context.Context, users []*model.User,
+	results []batchUserResult) {
+	l := log.FromContext(ctx)
+
+	for i, user := range users {
+		if user == nil {
+			continue
+		}
+
+		results[i].Email = user.Email
+
+		err := u.userAdm.CreateUser(ctx, user)
+		switch err {
+		case nil:
+			results[i].Status = batchStatusCreated
+			results[i].ID = user.ID
+		case store.ErrDuplicateEmail, store.ErrDuplicateUsername:
+			results[i].setError(batchStatusDuplicate, err, http.StatusUnprocessableEntity)
+		case model.ErrPasswordTooShort, model.ErrEmailDomainNotAllowed:
+			results[i].setError(batchStatusInvalid, err, http.StatusUnprocessableEntity)
+		case store.ErrUserLimitReached, useradm.ErrPlanLimit:
+			results[i].setError(batchStatusFailed, err, http.StatusForbidden)
+		default:
+			l.Errorf("failed to create user %s: %v", user.Email, err)
+			results[i].Status = batchStatusFailed
+			results[i].Error = "internal error"
+			results[i].Code = statusErrorCodes[http.StatusInternalServerError]
+		}
+	}
+}
+
+func (res *batchUserResult) setError(status string, err error, httpStatus int) {
+	res.Status = status
+	res.Error = err.Error()
+	res.Code, res.Fields = errorDetails(err, httpStatus)
+}
@@ -0,0 +1,351 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
+)
+
+func TestUserAdmApiAddUsersBatch(t *testing.T) {
+	t.Parallel()
+
+	tooMany := make([]interface{}, maxUsersBatchSize+1)
+	for i := range tooMany {
+		tooMany[i] = map[string]interface{}{
+			"email":    fmt.Sprintf("user-%d@foo.com", i),
+			"password": "foobarbar",
+		}
+	}
+
+	testCases := map[string]struct {
+		body interface{}
+
+		// CreateUser errors by email
+		uaErrors map[string]error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: []interface{}{
+				map[string]interface{}{
+					"email":    "foo@foo.com",
+					"password": "foobarbar",
+				},
+				map[string]interface{}{
+					"email":    "bar@foo.com",
+					"password": "foobarbar",
+					"name":     "Bar",
+				},
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]batchUserResult{
+					{Index: 0, Status: "created", ID: "id-foo@foo.com", Email: "foo@foo.com"},
+					{Index: 1, Status: "created", ID: "id-bar@foo.com", Email: "bar@foo.com"},
+				},
+			),
+		},
+		"ok, partial": {
+			body: []interface{}{
+				map[string]interface{}{
+					"email":    "foo@foo.com",
+					"password": "foobarbar",
+				},
+				map[string]interface{}{
+					"email":    "dup@foo.com",
+					"password": "foobarbar",
+				},
+				map[string]interface{}{
+					"email":    "short@foo.com",
+					"password": "foo",
+				},
+				map[string]interface{}{
+					"emial":    "typo@foo.com",
+					"password": "foobarbar",
+				},
+				"not-a-user",
+				map[string]interface{}{
+					"email":    "broken@foo.com",
+					"password": "foobarbar",
+				},
+			},
+			uaErrors: map[string]error{
+				"dup@foo.com":    store.ErrDuplicateEmail,
+				"broken@foo.com": errors.New("db failed"),
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]batchUserResult{
+					{Index: 0, Status: "created", ID: "id-foo@foo.com", Email: "foo@foo.com"},
+					{
+						Index:  1,
+						Status: "duplicate",
+						Email:  "dup@foo.com",
+						Error:  store.ErrDuplicateEmail.Error(),
+						Code:   "duplicate_email",
+					},
+					{
+						Index:  2,
+						Status: "invalid",
+						Email:  "short@foo.com",
+						Error:  model.ErrPasswordTooShort.Error(),
+						Code:   "password_too_short",
+					},
+					{
+						Index:  3,
+						Status: "invalid",
+						Error:  "emial: unknown field",
+						Code:   "validation_failed",
+						Fields: model.FieldErrors{
+							model.NewFieldError("emial", "unknown field"),
+						},
+					},
+					{
+						Index:  4,
+						Status: "invalid",
+						Error:  ErrNotJsonObject.Error(),
+						Code:   "bad_request",
+					},
+					{
+						Index:  5,
+						Status: "failed",
+						Email:  "broken@foo.com",
+						Error:  "internal error",
+						Code:   "internal_error",
+					},
+				},
+			),
+		},
+		"error, empty": {
+			body: []interface{}{},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError(ErrEmptyUsersBatch.Error(), "empty_batch"),
+			),
+		},
+		"error, too many users": {
+			body: tooMany,
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError(ErrUsersBatchTooLarge.Error(), "batch_too_large"),
+			),
+		},
+		"error, not an array": {
+			body: map[string]interface{}{
+				"email":    "foo@foo.com",
+				"password": "foobarbar",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to decode request body: "+
+					ErrUsersBatchNotArray.Error(), "bad_request"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("CreateUser", mtesting.ContextMatcher(),
+				mock.AnythingOfType("*model.User")).
+				Return(func(_ context.Context, u *model.User) error {
+					if err := tc.uaErrors[u.Email]; err != nil {
+						return err
+					}
+					u.ID = "id-" + u.Email
+					return nil
+				})
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("POST",
+				"http://1.2.3.4/api/management/v1/useradm/users/batch",
+				"",
+				tc.body)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiImportUsers(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		contentType string
+		body        string
+
+		// CreateUser errors by email
+		uaErrors map[string]error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			contentType: "text/csv; charset=utf-8",
+			body: "email,password,name\n" +
+				"foo@foo.com,foobarbar,Foo\n" +
+				"bar@foo.com, foobarbar ,\n",
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]batchUserResult{
+					{Index: 0, Status: "created", ID: "id-foo@foo.com", Email: "foo@foo.com"},
+					{Index: 1, Status: "created", ID: "id-bar@foo.com", Email: "bar@foo.com"},
+				},
+			),
+		},
+		"ok, partial": {
+			contentType: "text/csv",
+			body: "Email,Password\n" +
+				"dup@foo.com,foobarbar\n" +
+				"foo.com,foobarbar\n" +
+				"foo@foo.com\n" +
+				"bar@foo.com,foobarbar\n",
+			uaErrors: map[string]error{
+				"dup@foo.com": store.ErrDuplicateEmail,
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]batchUserResult{
+					{
+						Index:  0,
+						Status: "duplicate",
+						Email:  "dup@foo.com",
+						Error:  store.ErrDuplicateEmail.Error(),
+						Code:   "duplicate_email",
+					},
+					{
+						Index:  1,
+						Status: "invalid",
+						Email:  "foo.com",
+						Error:  "email: foo.com does not validate as email",
+						Code:   "validation_failed",
+						Fields: model.FieldErrors{
+							model.NewFieldError("email", "foo.com does not validate as email"),
+						},
+					},
+					{
+						Index:  2,
+						Status: "invalid",
+						Email:  "foo@foo.com",
+						Error:  "expected 2 columns, got 1",
+						Code:   "bad_request",
+					},
+					{Index: 3, Status: "created", ID: "id-bar@foo.com", Email: "bar@foo.com"},
+				},
+			),
+		},
+		"error, bad header": {
+			contentType: "text/csv",
+			body: "password,role,password\n" +
+				"foobarbar,admin,foobarbar\n",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("role: unknown column; password: duplicate column; "+
+					"email: missing column",
+					model.NewFieldError("role", "unknown column"),
+					model.NewFieldError("password", "duplicate column"),
+					model.NewFieldError("email", "missing column")),
+			),
+		},
+		"error, no rows": {
+			contentType: "text/csv",
+			body:        "email,password\n",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError(ErrEmptyUsersBatch.Error(), "empty_batch"),
+			),
+		},
+		"error, empty": {
+			contentType: "text/csv",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("failed to read CSV header: "+ErrEmptyCSV.Error(), "bad_request"),
+			),
+		},
+		"error, content type": {
+			contentType: "application/json",
+			body:        "email,password\n",
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnsupportedMediaType,
+				nil,
+				restError(ErrCSVContentType.Error(), "unsupported_media_type"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("CreateUser", mtesting.ContextMatcher(),
+				mock.AnythingOfType("*model.User")).
+				Return(func(_ context.Context, u *model.User) error {
+					if err := tc.uaErrors[u.Email]; err != nil {
+						return err
+					}
+					u.ID = "id-" + u.Email
+					return nil
+				})
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req, _ := http.NewRequest("POST",
+				"http://1.2.3.4/api/management/v1/useradm/users/import",
+				strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			req.Header.Add(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+const (
+	exportFormatCSV    = "csv"
+	exportFormatJSON   = "json"
+	exportFormatNDJSON = "ndjson"
+
+	mediaTypeNDJSON = "application/x-ndjson"
+)
+
+var (
+	ErrInvalidExportFormat = errors.New("format must be one of: " +
+		exportFormatCSV + ", " + exportFormatJSON + ", " + exportFormatNDJSON)
+
+	// columns of CSV user exports
+	csvExportColumns = []string{
+		"id", "email", "name", "phone", "locale", "timezone", "status",
+		"expires_at", "created_ts", "updated_ts", "last_login_ts",
+		"last_login_ip", "groups", "attributes",
+	}
+)
+
+// userExporter writes users in one of the export formats
+type userExporter interface {
+	// Begin is called before the first user
+	Begin() error
+	Write(u *model.User) error
+	// End is called after the last user
+	End() error
+}
+
+func (u *UserAdmApiHandlers) ExportUsersHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	fltr, err := parseUserFilter(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" && acceptsNDJSON(r) {
+		format = exportFormatNDJSON
+	}
+
+	var exp userExporter
+	switch format {
+	case exportFormatJSON, "":
+		exp = &jsonUserExporter{w: w.(http.ResponseWriter)}
+	case exportFormatCSV:
+		exp = &csvUserExporter{w: w.(http.ResponseWriter)}
+	case exportFormatNDJSON:
+		exp = &ndjsonUserExporter{w: w.(http.ResponseWriter), attachment: true}
+	default:
+		restErr(w, r, l, ErrInvalidExportFormat, http.StatusBadRequest)
+		return
+	}
+
+	u.streamUsers(w, r, l, fltr, exp)
+}
+
+// streamUsers writes the users matching the filter as they are read
+// from the database, without keeping them in memory
+func (u *UserAdmApiHandlers) streamUsers(w rest.ResponseWriter, r *rest.Request, l *log.Logger,
+	fltr *model.UserFilter, exp userExporter) {
+	// the response starts with the first user, errors before
+	// that can still be reported with a proper status
+	started := false
+	start := func() error {
+		started = true
+		return exp.Begin()
+	}
+
+	err := u.userAdm.ForEachUser(r.Context(), *fltr, func(user *model.User) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		return exp.Write(user)
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		err = exp.End()
+	}
+
+	if err != nil {
+		if !started {
+			restAppErr(w, r, l, err)
+			return
+		}
+		// too late to change the response, the client gets
+		// a truncated document
+		l.Errorf("failed to export users: %v", err)
+	}
+}
+
+// acceptsNDJSON returns true if the client asked for
+// newline delimited JSON in the Accept header
+func acceptsNDJSON(r *rest.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediatype, _, _ := mime.ParseMediaType(accept)
+		if mediatype == mediaTypeNDJSON {
+			return true
+		}
+	}
+	return false
+}
+
+type jsonUserExporter struct {
+	w     http.ResponseWriter
+	first bool
+}
+
+func (e *jsonUserExporter) Begin() error {
+	e.w.Header().Set("Content-Type", "application/json")
+	e.w.Header().Set("Content-Disposition", `attachment; filename="users.json"`)
+	e.w.WriteHeader(http.StatusOK)
+	e.first = true
+
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonUserExporter) Write(u *model.User) error {
+	if !e.first {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.first = false
+
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonUserExporter) End() error {
+	_, err := io.WriteString(e.w, "]")
+	return err
+}
+
+// ndjsonUserExporter writes one JSON user per line, so that clients
+// can process the users without reading the whole response first
+type ndjsonUserExporter struct {
+	w          http.ResponseWriter
+	attachment bool
+	// fields of the users written, all if empty
+	fields []string
+	enc    *json.Encoder
+}
+
+func (e *ndjsonUserExporter) Begin() error {
+	e.w.Header().Set("Content-Type", mediaTypeNDJSON)
+	if e.attachment {
+		e.w.Header().Set("Content-Disposition", `attachment; filename="users.ndjson"`)
+	}
+	e.w.WriteHeader(http.StatusOK)
+
+	e.enc = json.NewEncoder(e.w)
+	return nil
+}
+
+func (e *ndjsonUserExporter) Write(u *model.User) error {
+	user, err := selectUserFields(u, e.fields)
+	if err != nil {
+		return err
+	}
+	return e.enc.Encode(user)
+}
+
+func (e *ndjsonUserExporter) End() error {
+	return nil
+}
+
+type csvUserExporter struct {
+	w  http.ResponseWriter
+	cw *csv.Writer
+}
+
+func (e *csvUserExporter) Begin() error {
+	e.w.Header().Set("Content-Type", mediaTypeCSV)
+	e.w.Header().Set("Content-Disposition", `attachment; filename="users.csv"`)
+	e.w.WriteHeader(http.StatusOK)
+
+	e.cw = csv.NewWriter(e.w)
+	return e.cw.Write(csvExportColumns)
+}
+
+func (e *csvUserExporter) Write(u *model.User) error {
+	status := u.Status
+	if status == "" {
+		status = model.UserStatusActive
+	}
+
+	attributes := ""
+	if len(u.Attributes) > 0 {
+		data, err := json.Marshal(u.Attributes)
+		if err != nil {
+			return err
+		}
+		attributes = string(data)
+	}
+
+	return e.cw.Write([]string{
+		u.ID,
+		u.Email,
+		u.Name,
+		u.Phone,
+		u.Locale,
+		u.Timezone,
+		status,
+		formatTime(u.ExpiresAt),
+		formatTime(u.CreatedTs),
+		formatTime(u.UpdatedTs),
+		formatTime(u.LastLoginTs),
+		u.LastLoginIP,
+		strings.Join(u.Groups, ";"),
+		attributes,
+	})
+}
+
+func (e *csvUserExporter) End() error {
+	e.cw.Flush()
+	return e.cw.Error()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,229 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
+)
+
+func TestUserAdmApiExportUsers(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	users := []model.User{
+		{
+			ID:          "1",
+			Email:       "bar@acme.com",
+			Name:        "Bar, Jr.",
+			CreatedTs:   &ts,
+			LastLoginTs: &ts,
+			LastLoginIP: "1.2.3.4",
+			Groups:      []string{"g1", "g2"},
+			Attributes:  map[string]string{"department": "rnd"},
+		},
+		{
+			ID:     "2",
+			Email:  "foo@acme.com",
+			Status: model.UserStatusInactive,
+		},
+	}
+
+	usersJSON, _ := json.Marshal(users)
+	firstJSON, _ := json.Marshal(users[0])
+	secondJSON, _ := json.Marshal(users[1])
+
+	testCases := map[string]struct {
+		query  string
+		accept string
+		fltr   model.UserFilter
+
+		uaUsers []model.User
+		uaError error
+
+		status      int
+		contentType string
+		body        string
+	}{
+		"ok, json": {
+			uaUsers: users,
+
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        string(usersJSON),
+		},
+		"ok, json, empty": {
+			query: "?format=json",
+
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        "[]",
+		},
+		"ok, csv": {
+			query: "?format=csv&attributes.department=rnd",
+			fltr: model.UserFilter{
+				Attributes: map[string]string{"department": "rnd"},
+			},
+			uaUsers: users,
+
+			status:      http.StatusOK,
+			contentType: "text/csv",
+			body: "id,email,name,phone,locale,timezone,status,expires_at," +
+				"created_ts,updated_ts,last_login_ts,last_login_ip,groups,attributes\n" +
+				`1,bar@acme.com,"Bar, Jr.",,,,active,,2018-05-01T12:00:00Z,,` +
+				`2018-05-01T12:00:00Z,1.2.3.4,g1;g2,"{""department"":""rnd""}"` + "\n" +
+				"2,foo@acme.com,,,,,inactive,,,,,,,\n",
+		},
+		"ok, ndjson": {
+			query:   "?format=ndjson",
+			uaUsers: users,
+
+			status:      http.StatusOK,
+			contentType: "application/x-ndjson",
+			body:        string(firstJSON) + "\n" + string(secondJSON) + "\n",
+		},
+		"ok, ndjson, accept": {
+			accept:  "application/x-ndjson, application/json;q=0.5",
+			uaUsers: users,
+
+			status:      http.StatusOK,
+			contentType: "application/x-ndjson",
+			body:        string(firstJSON) + "\n" + string(secondJSON) + "\n",
+		},
+		"ok, format overrides accept": {
+			query:  "?format=json",
+			accept: "application/x-ndjson",
+
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        "[]",
+		},
+		"error, format": {
+			query: "?format=xml",
+
+			status: http.StatusBadRequest,
+			body: `{"error":"format must be one of: csv, json, ndjson",` +
+				`"code":"invalid_export_format","request_id":"test"}`,
+		},
+		"error, before first user": {
+			uaError: errors.New("db failed"),
+
+			status: http.StatusInternalServerError,
+			body:   `{"error":"internal error","code":"internal_error","request_id":"test"}`,
+		},
+		"error, truncated": {
+			uaUsers: users[:1],
+			uaError: errors.New("db failed"),
+
+			status:      http.StatusOK,
+			contentType: "application/json",
+			body:        "[" + string(firstJSON),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("ForEachUser", mtesting.ContextMatcher(), tc.fltr,
+				mock.AnythingOfType("func(*model.User) error")).
+				Return(func(_ context.Context, _ model.UserFilter,
+					fn func(*model.User) error) error {
+					for i := range tc.uaUsers {
+						if err := fn(&tc.uaUsers[i]); err != nil {
+							return err
+						}
+					}
+					return tc.uaError
+				})
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq("GET",
+				"http://1.2.3.4/api/management/v1/useradm/users/export"+tc.query,
+				"",
+				nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			recorded := test.RunRequest(t, api, req)
+
+			assert.Equal(t, tc.status, recorded.Recorder.Code)
+			if tc.contentType != "" {
+				assert.Equal(t, tc.contentType,
+					recorded.Recorder.HeaderMap.Get("Content-Type"))
+			}
+			assert.Equal(t, tc.body, recorded.Recorder.Body.String())
+		})
+	}
+}
+
+func TestUserAdmApiGetUsersNDJSON(t *testing.T) {
+	t.Parallel()
+
+	users := []model.User{
+		{ID: "1", Email: "bar@acme.com"},
+		{ID: "2", Email: "foo@acme.com"},
+	}
+
+	uadm := &museradm.App{}
+	uadm.On("ForEachUser", mtesting.ContextMatcher(),
+		model.UserFilter{Attributes: map[string]string{"department": "rnd"}},
+		mock.AnythingOfType("func(*model.User) error")).
+		Return(func(_ context.Context, _ model.UserFilter,
+			fn func(*model.User) error) error {
+			for i := range users {
+				if err := fn(&users[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+	api := makeMockApiHandler(t, uadm, nil)
+
+	req := makeReq("GET",
+		"http://1.2.3.4/api/management/v1/useradm/users?attributes.department=rnd",
+		"",
+		nil)
+	req.Header.Set("Accept", "application/x-ndjson")
+
+	recorded := test.RunRequest(t, api, req)
+
+	assert.Equal(t, http.StatusOK, recorded.Recorder.Code)
+	assert.Equal(t, "application/x-ndjson",
+		recorded.Recorder.HeaderMap.Get("Content-Type"))
+	assert.Empty(t, recorded.Recorder.HeaderMap.Get("Content-Disposition"))
+	assert.Equal(t,
+		`{"id":"1","email":"bar@acme.com","failed_login_attempts":0}`+"\n"+
+			`{"id":"2","email":"foo@acme.com","failed_login_attempts":0}`+"\n",
+		recorded.Recorder.Body.String())
+
+	uadm.AssertNotCalled(t, "GetUsers", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,279 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/rest_utils"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+// the v2 management API; all lists are paged the same way, with the
+// total count and the page links in the headers, resources carry their
+// version in the ETag header only
+const (
+	uriV2ManagementUsers           = "/api/management/v2/useradm/users"
+	uriV2ManagementUser            = "/api/management/v2/useradm/users/:id"
+	uriV2ManagementUserTokens      = "/api/management/v2/useradm/users/:id/tokens"
+	uriV2ManagementSettings        = "/api/management/v2/useradm/settings"
+	uriV2ManagementSetting         = "/api/management/v2/useradm/settings/:key"
+	uriV2ManagementSettingsHistory = "/api/management/v2/useradm/settings/history"
+)
+
+const (
+	queryGroup = "group"
+)
+
+func (i *UserAdmApiHandlers) routesV2() []*rest.Route {
+	return []*rest.Route{
+		rest.Get(uriV2ManagementUsers, i.GetUsersV2Handler),
+		rest.Head(uriV2ManagementUsers, i.HeadUsersHandler),
+		rest.Get(uriV2ManagementUser, i.GetUserHandler),
+		rest.Head(uriV2ManagementUser, i.HeadUserHandler),
+		rest.Get(uriV2ManagementUserTokens, i.GetUserTokensV2Handler),
+		rest.Get(uriV2ManagementSettings, i.GetSettingsV2Handler),
+		rest.Put(uriV2ManagementSettings, i.SaveSettingsV2Handler),
+		// must precede uriV2ManagementSetting, the first defined route wins
+		rest.Get(uriV2ManagementSettingsHistory, i.GetSettingsHistoryV2Handler),
+		rest.Get(uriV2ManagementSetting, i.GetSettingHandler),
+		rest.Put(uriV2ManagementSetting, i.SaveSettingHandler),
+		rest.Delete(uriV2ManagementSetting, i.DeleteSettingHandler),
+	}
+}
+
+func (u *UserAdmApiHandlers) GetUsersV2Handler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := checkQueryParams(r, queryGroup, queryFields, attributesQueryPrefix); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	page, perPage, err := rest_utils.ParsePagination(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	fltr, err := parseUserFilter(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	fltr.Group = r.URL.Query().Get(queryGroup)
+
+	fltr.Fields, err = parseUserFields(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if !u.usersModified(w, r, l, fltr) {
+		return
+	}
+
+	total, err := u.userAdm.CountUsers(ctx, *fltr)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	fltr.Skip = int((page - 1) * perPage)
+	fltr.Limit = int(perPage)
+
+	users, err := u.userAdm.GetUsers(ctx, *fltr)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	rsp, err := selectUsersFields(users, fltr.Fields)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	writePageHeaders(w, r, page, perPage, total)
+	w.WriteJson(rsp)
+}
+
+func (u *UserAdmApiHandlers) GetUserTokensV2Handler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := checkQueryParams(r); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	page, perPage, err := rest_utils.ParsePagination(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := u.userAdm.GetUserTokens(ctx, r.PathParam("id"))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	from, to := pageBounds(len(tokens), page, perPage)
+
+	writePageHeaders(w, r, page, perPage, len(tokens))
+	w.WriteJson(tokens[from:to])
+}
+
+func (u *UserAdmApiHandlers) GetSettingsV2Handler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	settings, err := u.userAdm.GetSettings(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	etag, _ := settings["etag"].(string)
+	delete(settings, "etag")
+
+	setETag(w, etag)
+	w.WriteJson(settings)
+}
+
+func (u *UserAdmApiHandlers) SaveSettingsV2Handler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var settings map[string]interface{}
+
+	err := r.DecodeJsonPayload(&settings)
+	if err != nil || settings == nil {
+		restErr(w, r, l, errors.New("cannot parse request body as json"), http.StatusBadRequest)
+		return
+	}
+
+	etag, err := u.userAdm.SaveSettings(ctx, settings, parseIfMatch(r))
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	setETag(w, etag)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (u *UserAdmApiHandlers) GetSettingsHistoryV2Handler(w rest.ResponseWriter,
+	r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	if err := checkQueryParams(r); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	page, perPage, err := rest_utils.ParsePagination(r)
+	if err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	versions, err := u.userAdm.GetSettingsHistory(ctx)
+	if err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	from, to := pageBounds(len(versions), page, perPage)
+
+	writePageHeaders(w, r, page, perPage, len(versions))
+	w.WriteJson(versions[from:to])
+}
+
+// checkQueryParams reports the query parameters of a list request other
+// than the paging ones and the given filters; filters ending with a dot
+// match all parameters with that prefix
+func checkQueryParams(r *rest.Request, filters ...string) error {
+	known := func(k string) bool {
+		if k == rest_utils.PageName || k == rest_utils.PerPageName {
+			return true
+		}
+		for _, f := range filters {
+			if k == f || (strings.HasSuffix(f, ".") && strings.HasPrefix(k, f)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	unknown := []string{}
+	for k := range r.URL.Query() {
+		if !known(k) {
+			unknown = append(unknown, k)
+		}
+	}
+	sort.Strings(unknown)
+
+	errs := model.FieldErrors{}
+	for _, k := range unknown {
+		errs = append(errs, model.NewFieldError(k, "unknown query parameter"))
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// writePageHeaders sets the total number of items and the links
+// to the neighbouring pages of a list
+func writePageHeaders(w rest.ResponseWriter, r *rest.Request, page, perPage uint64, total int) {
+	w.Header().Set(hdrTotalCount, strconv.Itoa(total))
+
+	hasNext := page*perPage < uint64(total)
+	for _, link := range rest_utils.MakePageLinkHdrs(r, page, perPage, hasNext) {
+		w.Header().Add(rest_utils.LinkHdr, link)
+	}
+}
+
+// pageBounds returns the range of the items of a list
+// of the given length shown on the page
+func pageBounds(n int, page, perPage uint64) (int, int) {
+	from := (page - 1) * perPage
+	if from > uint64(n) {
+		return n, n
+	}
+
+	to := from + perPage
+	if to > uint64(n) {
+		to = uint64(n)
+	}
+
+	return int(from), int(to)
+}
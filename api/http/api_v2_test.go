@@ -0,0 +1,500 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest/test"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	useradm "github.com/mendersoftware/useradm/user"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
+)
+
+func TestUserAdmApiV2GetUsers(t *testing.T) {
+	t.Parallel()
+
+	users := []model.User{
+		{ID: "1", Email: "bar@acme.com"},
+		{ID: "2", Email: "baz@acme.com"},
+	}
+
+	testCases := map[string]struct {
+		query string
+		fltr  model.UserFilter
+
+		uaCount    int
+		uaCountErr error
+		uaUsers    []model.User
+		uaError    error
+
+		total   string
+		links   []string
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			fltr:    model.UserFilter{Skip: 0, Limit: 20},
+			uaCount: 2,
+			uaUsers: users,
+
+			total: "2",
+			links: []string{
+				`<http://1.2.3.4/api/management/v2/useradm/users?page=1&per_page=20>; rel="first"`,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				users,
+			),
+		},
+		"ok: paged, with filters": {
+			query: "?page=2&per_page=2&group=g1&attributes.department=rnd",
+			fltr: model.UserFilter{
+				Attributes: map[string]string{"department": "rnd"},
+				Group:      "g1",
+				Skip:       2,
+				Limit:      2,
+			},
+			uaCount: 5,
+			uaUsers: users,
+
+			total: "5",
+			links: []string{
+				`<http://1.2.3.4/api/management/v2/useradm/users?attributes.department=rnd&group=g1&page=1&per_page=2>; rel="prev"`,
+				`<http://1.2.3.4/api/management/v2/useradm/users?attributes.department=rnd&group=g1&page=3&per_page=2>; rel="next"`,
+				`<http://1.2.3.4/api/management/v2/useradm/users?attributes.department=rnd&group=g1&page=1&per_page=2>; rel="first"`,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				users,
+			),
+		},
+		"error: unknown query parameters": {
+			query: "?sort=email&email=foo",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("email: unknown query parameter; "+
+					"sort: unknown query parameter",
+					model.NewFieldError("email", "unknown query parameter"),
+					model.NewFieldError("sort", "unknown query parameter")),
+			),
+		},
+		"error: invalid page": {
+			query: "?page=0",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("Param page is out of bounds", "bad_request"),
+			),
+		},
+		"error: count": {
+			fltr:       model.UserFilter{},
+			uaCountErr: errors.New("db connection failed"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+		"error: useradm internal": {
+			fltr:    model.UserFilter{Skip: 0, Limit: 20},
+			uaCount: 2,
+			uaError: errors.New("db connection failed"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := mtesting.ContextMatcher()
+
+			countFltr := tc.fltr
+			countFltr.Skip, countFltr.Limit = 0, 0
+
+			uadm := &museradm.App{}
+			uadm.On("GetUsersVersion", ctx, countFltr).
+				Return(&model.UsersVersion{Count: tc.uaCount}, nil)
+			uadm.On("CountUsers", ctx, countFltr).Return(tc.uaCount, tc.uaCountErr)
+			uadm.On("GetUsers", ctx, tc.fltr).Return(tc.uaUsers, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v2/useradm/users"+tc.query,
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+			if tc.links != nil {
+				assert.Equal(t, tc.total, recorded.Recorder.Header().Get(hdrTotalCount))
+				assert.Equal(t, tc.links, recorded.Recorder.HeaderMap["Link"])
+			}
+		})
+	}
+}
+
+func TestUserAdmApiV2GetUserTokens(t *testing.T) {
+	t.Parallel()
+
+	issued := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tokens := []model.TokenInfo{
+		{ID: "1", IssuedAt: issued, ExpiresAt: issued.Add(time.Hour)},
+		{ID: "2", IssuedAt: issued, ExpiresAt: issued.Add(time.Hour)},
+		{ID: "3", IssuedAt: issued, ExpiresAt: issued.Add(time.Hour)},
+	}
+
+	testCases := map[string]struct {
+		query string
+
+		uaTokens []model.TokenInfo
+		uaError  error
+
+		total   string
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaTokens: tokens,
+
+			total: "3",
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				tokens,
+			),
+		},
+		"ok: last page": {
+			query:    "?page=2&per_page=2",
+			uaTokens: tokens,
+
+			total: "3",
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				tokens[2:],
+			),
+		},
+		"ok: past the last page": {
+			query:    "?page=3&per_page=2",
+			uaTokens: tokens,
+
+			total: "3",
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				nil,
+				[]model.TokenInfo{},
+			),
+		},
+		"error: unknown query parameter": {
+			query: "?attributes.foo=bar",
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("attributes.foo: unknown query parameter",
+					model.NewFieldError("attributes.foo", "unknown query parameter")),
+			),
+		},
+		"error: user not found": {
+			uaError: store.ErrUserNotFound,
+
+			checker: mt.NewJSONResponse(
+				http.StatusNotFound,
+				nil,
+				restError(ErrUserNotFound.Error(), "user_not_found"),
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("db connection failed"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetUserTokens", mtesting.ContextMatcher(), "foo").
+				Return(tc.uaTokens, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v2/useradm/users/foo/tokens"+tc.query,
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+			if tc.total != "" {
+				assert.Equal(t, tc.total, recorded.Recorder.Header().Get(hdrTotalCount))
+			}
+		})
+	}
+}
+
+func TestUserAdmApiV2GetSettings(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		uaSettings map[string]interface{}
+		uaError    error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaSettings: map[string]interface{}{
+				"foo":  "foo-val",
+				"etag": "v1",
+			},
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				map[string]string{"ETag": `"v1"`},
+				map[string]interface{}{
+					"foo": "foo-val",
+				},
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("db connection failed"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetSettings", mtesting.ContextMatcher()).
+				Return(tc.uaSettings, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v2/useradm/settings",
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiV2SaveSettings(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body    interface{}
+		ifMatch string
+
+		uaIfMatch []string
+		uaError   error
+
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			body: map[string]interface{}{"foo": "foo-val"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				map[string]string{"ETag": `"v2"`},
+				nil,
+			),
+		},
+		"ok, if-match": {
+			body:      map[string]interface{}{"foo": "foo-val"},
+			ifMatch:   `"v1"`,
+			uaIfMatch: []string{"v1"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusNoContent,
+				map[string]string{"ETag": `"v2"`},
+				nil,
+			),
+		},
+		"error: etag mismatch": {
+			body:      map[string]interface{}{"foo": "foo-val"},
+			ifMatch:   `"v0"`,
+			uaIfMatch: []string{"v0"},
+			uaError:   store.ErrSettingsETagMismatch,
+
+			checker: mt.NewJSONResponse(
+				http.StatusPreconditionFailed,
+				nil,
+				restError(store.ErrSettingsETagMismatch.Error(), "etag_mismatch"),
+			),
+		},
+		"error: invalid settings": {
+			body:    map[string]interface{}{"etag": "v1"},
+			uaError: model.NewFieldError("etag", "field can't be modified"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError("etag: field can't be modified",
+					model.NewFieldError("etag", "field can't be modified")),
+			),
+		},
+		"error: no identity": {
+			body:    map[string]interface{}{"foo": "foo-val"},
+			uaError: useradm.ErrUnauthorized,
+
+			checker: mt.NewJSONResponse(
+				http.StatusUnauthorized,
+				nil,
+				restError(useradm.ErrUnauthorized.Error(), "unauthorized"),
+			),
+		},
+		"error: not an object": {
+			body: []string{"foo"},
+
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restError("cannot parse request body as json", "bad_request"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("SaveSettings", mtesting.ContextMatcher(), tc.body, tc.uaIfMatch).
+				Return("v2", tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodPut,
+				"http://1.2.3.4/api/management/v2/useradm/settings",
+				"",
+				tc.body)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+		})
+	}
+}
+
+func TestUserAdmApiV2GetSettingsHistory(t *testing.T) {
+	t.Parallel()
+
+	replaced := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	versions := []model.SettingsVersion{
+		{ETag: "v2", ReplacedTs: replaced, Settings: map[string]interface{}{"foo": "2"}},
+		{ETag: "v1", ReplacedTs: replaced, Settings: map[string]interface{}{"foo": "1"}},
+	}
+
+	testCases := map[string]struct {
+		query string
+
+		uaVersions []model.SettingsVersion
+		uaError    error
+
+		links   []string
+		checker mt.ResponseChecker
+	}{
+		"ok": {
+			uaVersions: versions,
+
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				map[string]string{hdrTotalCount: "2"},
+				versions,
+			),
+		},
+		"ok: paged": {
+			query:      "?per_page=1",
+			uaVersions: versions,
+
+			links: []string{
+				`<http://1.2.3.4/api/management/v2/useradm/settings/history?page=2&per_page=1>; rel="next"`,
+				`<http://1.2.3.4/api/management/v2/useradm/settings/history?page=1&per_page=1>; rel="first"`,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusOK,
+				map[string]string{hdrTotalCount: "2"},
+				versions[:1],
+			),
+		},
+		"error: useradm internal": {
+			uaError: errors.New("db connection failed"),
+
+			checker: mt.NewJSONResponse(
+				http.StatusInternalServerError,
+				nil,
+				restError("internal error", "internal_error"),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			uadm := &museradm.App{}
+			uadm.On("GetSettingsHistory", mtesting.ContextMatcher()).
+				Return(tc.uaVersions, tc.uaError)
+
+			api := makeMockApiHandler(t, uadm, nil)
+
+			req := makeReq(http.MethodGet,
+				"http://1.2.3.4/api/management/v2/useradm/settings/history"+tc.query,
+				"",
+				nil)
+
+			recorded := test.RunRequest(t, api, req)
+			mt.CheckResponse(t, tc.checker, recorded)
+			if tc.links != nil {
+				assert.Equal(t, tc.links, recorded.Recorder.HeaderMap["Link"])
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+var (
+	ErrNotJsonObject = errors.New("expected a JSON object")
+)
+
+// decodeJsonStrict decodes the JSON request body into v, a pointer to
+// a struct; unlike rest.Request.DecodeJsonPayload, fields not defined
+// in the struct, or tagged `readonly:"true"` as set by the server only,
+// are rejected, all of them reported as field errors
+func decodeJsonStrict(r *rest.Request, v interface{}) error {
+	content, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed to decode request body")
+	}
+
+	if len(content) == 0 {
+		return errors.Wrap(rest.ErrJsonPayloadEmpty, "failed to decode request body")
+	}
+
+	err = decodeStrict(content, v)
+	switch err.(type) {
+	case nil, model.FieldErrors, *model.FieldError:
+		return err
+	default:
+		return errors.Wrap(err, "failed to decode request body")
+	}
+}
+
+// decodeStrict decodes a JSON document the way decodeJsonStrict does
+func decodeStrict(content []byte, v interface{}) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(content, &fields); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			return ErrNotJsonObject
+		}
+		return err
+	}
+
+	known := jsonFields(reflect.TypeOf(v).Elem())
+
+	rejected := model.FieldErrors{}
+	for name := range fields {
+		writable, ok := known[name]
+		switch {
+		case !ok:
+			rejected = append(rejected, model.NewFieldError(name, "unknown field"))
+		case !writable:
+			rejected = append(rejected, model.NewFieldError(name, "read-only field"))
+		}
+	}
+	if len(rejected) > 0 {
+		sort.Slice(rejected, func(i, j int) bool {
+			return rejected[i].Field < rejected[j].Field
+		})
+		return rejected
+	}
+
+	if err := json.Unmarshal(content, v); err != nil {
+		if te, ok := err.(*json.UnmarshalTypeError); ok && te.Field != "" {
+			return model.NewFieldError(te.Field, "must be "+jsonTypeName(te.Type))
+		}
+		return err
+	}
+
+	return nil
+}
+
+// jsonFields returns the names of the JSON fields of a struct type,
+// false for the read-only ones
+func jsonFields(t reflect.Type) map[string]bool {
+	fields := map[string]bool{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for n, writable := range jsonFields(f.Type) {
+				fields[n] = writable
+			}
+			continue
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Tag.Get("readonly") != "true"
+	}
+
+	return fields
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	default:
+		return "of type " + t.String()
+	}
+}
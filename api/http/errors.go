@@ -0,0 +1,275 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	useradm "github.com/mendersoftware/useradm/user"
+)
+
+const (
+	// code of requests failing body validation, the invalid
+	// fields are listed in the response
+	errCodeValidationFailed = "validation_failed"
+)
+
+var (
+	// stable, machine-readable codes of the known errors
+	errorCodes = map[error]string{
+		ErrAuthHeader:                        "invalid_auth_header",
+		ErrUserNotFound:                      "user_not_found",
+		ErrMergePatchContentType:             "unsupported_media_type",
+		ErrInvalidIdempotencyKey:             "invalid_idempotency_key",
+		useradm.ErrIdempotencyKeyInProgress:  "idempotency_key_in_progress",
+		useradm.ErrIdempotencyKeyReused:      "idempotency_key_reused",
+		ErrEmptyUsersBatch:                   "empty_batch",
+		ErrUsersBatchTooLarge:                "batch_too_large",
+		ErrCSVContentType:                    "unsupported_media_type",
+		ErrInvalidExportFormat:               "invalid_export_format",
+		ErrSettingsSchemaNotFound:            "settings_schema_not_found",
+		ErrMaintenance:                       "maintenance_mode",
+		ErrRequestBodyTooLarge:               "request_body_too_large",
+		ErrTenantHeaderForbidden:             "tenant_header_forbidden",
+		rest.ErrJsonPayloadEmpty:             "empty_request_body",
+		model.ErrPasswordTooShort:            "password_too_short",
+		model.ErrEmailDomainNotAllowed:       "email_domain_not_allowed",
+		model.ErrEmptyUpdate:                 "empty_update",
+		model.ErrUnknownLimit:                "unknown_limit",
+		model.ErrUnknownPlan:                 "unknown_plan",
+		model.ErrUnknownTenantStatus:         "unknown_tenant_status",
+		store.ErrUserNotFound:                "user_not_found",
+		store.ErrDuplicateEmail:              "duplicate_email",
+		store.ErrDuplicateUsername:           "duplicate_username",
+		store.ErrUserEmailNotFound:           "user_email_not_found",
+		store.ErrGroupNotFound:               "group_not_found",
+		store.ErrDuplicateGroupName:          "duplicate_group_name",
+		store.ErrETagMismatch:                "etag_mismatch",
+		store.ErrUserLimitReached:            "user_limit_reached",
+		store.ErrSettingsETagMismatch:        "etag_mismatch",
+		store.ErrSettingsVersionNotFound:     "settings_version_not_found",
+		store.ErrSettingNotFound:             "setting_not_found",
+		useradm.ErrUnauthorized:              "unauthorized",
+		useradm.ErrAuthExpired:               "token_expired",
+		useradm.ErrAuthInvalid:               "token_invalid",
+		useradm.ErrUserNotFound:              "user_not_found",
+		useradm.ErrTenantAccountSuspended:    "tenant_suspended",
+		useradm.ErrTenantTrialExpired:        "trial_expired",
+		useradm.ErrTenantPaymentOverdue:      "payment_overdue",
+		useradm.ErrLastAdmin:                 "last_admin",
+		useradm.ErrSelfDelete:                "self_delete",
+		useradm.ErrNotAdmin:                  "forbidden",
+		useradm.ErrUserInactive:              "user_inactive",
+		useradm.ErrInvalidVerificationCode:   "invalid_verification_code",
+		useradm.ErrEmailNotVerified:          "email_not_verified",
+		useradm.ErrInvalidScope:              "invalid_scope",
+		useradm.ErrTenantHasUsers:            "tenant_has_users",
+		useradm.ErrPlanLimit:                 "plan_limit",
+		useradm.ErrInvalidClient:             "invalid_client",
+		store.ErrOAuthClientNotFound:         "client_not_found",
+		store.ErrServiceAccountNotFound:      "service_account_not_found",
+		useradm.ErrOIDCDisabled:              "oidc_disabled",
+		useradm.ErrDeviceFlowDisabled:        "device_flow_disabled",
+		useradm.ErrMagicLinkDisabled:         "magic_link_disabled",
+		useradm.ErrAdditionalEmailsDisabled:  "additional_emails_disabled",
+		useradm.ErrOTPRequired:               "otp_required",
+		useradm.ErrInvalidOTP:                "invalid_otp",
+		store.ErrDeviceAuthorizationNotFound: "device_authorization_not_found",
+		store.ErrDuplicateServiceAccountName: "duplicate_service_account_name",
+	}
+
+	// statuses of the responses to the known errors, see restAppErr
+	errorStatuses = map[error]int{
+		ErrUserNotFound:                      http.StatusNotFound,
+		useradm.ErrIdempotencyKeyInProgress:  http.StatusConflict,
+		useradm.ErrIdempotencyKeyReused:      http.StatusUnprocessableEntity,
+		model.ErrPasswordTooShort:            http.StatusUnprocessableEntity,
+		model.ErrEmailDomainNotAllowed:       http.StatusUnprocessableEntity,
+		model.ErrTooManyEmails:               http.StatusUnprocessableEntity,
+		model.ErrUnknownLimit:                http.StatusNotFound,
+		store.ErrUserNotFound:                http.StatusNotFound,
+		store.ErrDuplicateEmail:              http.StatusUnprocessableEntity,
+		store.ErrDuplicateUsername:           http.StatusUnprocessableEntity,
+		store.ErrUserEmailNotFound:           http.StatusNotFound,
+		store.ErrGroupNotFound:               http.StatusNotFound,
+		store.ErrDuplicateGroupName:          http.StatusUnprocessableEntity,
+		store.ErrETagMismatch:                http.StatusPreconditionFailed,
+		store.ErrUserLimitReached:            http.StatusForbidden,
+		store.ErrSettingsETagMismatch:        http.StatusPreconditionFailed,
+		store.ErrSettingsVersionNotFound:     http.StatusNotFound,
+		store.ErrSettingNotFound:             http.StatusNotFound,
+		useradm.ErrUnauthorized:              http.StatusUnauthorized,
+		useradm.ErrTenantAccountSuspended:    http.StatusUnauthorized,
+		useradm.ErrTenantTrialExpired:        http.StatusUnauthorized,
+		useradm.ErrTenantPaymentOverdue:      http.StatusUnauthorized,
+		useradm.ErrUserInactive:              http.StatusUnauthorized,
+		useradm.ErrUserNotFound:              http.StatusNotFound,
+		useradm.ErrLastAdmin:                 http.StatusConflict,
+		useradm.ErrSelfDelete:                http.StatusForbidden,
+		useradm.ErrNotAdmin:                  http.StatusForbidden,
+		useradm.ErrInvalidVerificationCode:   http.StatusUnprocessableEntity,
+		useradm.ErrEmailNotVerified:          http.StatusUnprocessableEntity,
+		useradm.ErrInvalidScope:              http.StatusBadRequest,
+		useradm.ErrTenantHasUsers:            http.StatusConflict,
+		useradm.ErrPlanLimit:                 http.StatusForbidden,
+		useradm.ErrInvalidClient:             http.StatusUnauthorized,
+		store.ErrOAuthClientNotFound:         http.StatusNotFound,
+		store.ErrServiceAccountNotFound:      http.StatusNotFound,
+		useradm.ErrOIDCDisabled:              http.StatusNotFound,
+		useradm.ErrDeviceFlowDisabled:        http.StatusNotFound,
+		useradm.ErrMagicLinkDisabled:         http.StatusNotFound,
+		useradm.ErrAdditionalEmailsDisabled:  http.StatusNotFound,
+		useradm.ErrOTPRequired:               http.StatusUnauthorized,
+		useradm.ErrInvalidOTP:                http.StatusUnauthorized,
+		useradm.ErrOTPUndeliverable:          http.StatusServiceUnavailable,
+		store.ErrDeviceAuthorizationNotFound: http.StatusNotFound,
+		store.ErrDuplicateServiceAccountName: http.StatusUnprocessableEntity,
+	}
+
+	// codes of errors not listed above, by HTTP status
+	statusErrorCodes = map[int]string{
+		http.StatusBadRequest:           "bad_request",
+		http.StatusUnauthorized:         "unauthorized",
+		http.StatusForbidden:            "forbidden",
+		http.StatusNotFound:             "not_found",
+		http.StatusConflict:             "conflict",
+		http.StatusPreconditionFailed:   "precondition_failed",
+		http.StatusUnsupportedMediaType: "unsupported_media_type",
+		http.StatusUnprocessableEntity:  "unprocessable_entity",
+		http.StatusInternalServerError:  "internal_error",
+		http.StatusServiceUnavailable:   "service_unavailable",
+	}
+)
+
+// errorResponse is the body of all error responses
+type errorResponse struct {
+	Error     string            `json:"error"`
+	Code      string            `json:"code"`
+	RequestID string            `json:"request_id"`
+	Fields    model.FieldErrors `json:"fields,omitempty"`
+}
+
+// errorCode returns the machine-readable code of an error
+func errorCode(e error, status int) string {
+	cause := errors.Cause(e)
+	if reflect.TypeOf(cause).Comparable() {
+		if code, ok := errorCodes[cause]; ok {
+			return code
+		}
+	}
+
+	return statusErrorCodes[status]
+}
+
+// errorDetails returns the code of an error and, for validation errors,
+// the invalid request fields
+func errorDetails(e error, status int) (string, model.FieldErrors) {
+	switch fe := errors.Cause(e).(type) {
+	case model.FieldErrors:
+		return errCodeValidationFailed, fe
+	case *model.FieldError:
+		return errCodeValidationFailed, model.FieldErrors{fe}
+	default:
+		return errorCode(e, status), nil
+	}
+}
+
+// restErr works like rest_utils.RestErrWithLog, additionally including
+// the error code and, for validation errors, the invalid request fields
+// in the response
+func restErr(w rest.ResponseWriter, r *rest.Request, l *log.Logger, e error, status int) {
+	// bodies of unknown length cut off by BodyLimitMiddleware fail to
+	// decode, the same as bodies exceeding the limit up front
+	if errors.Cause(e) == ErrRequestBodyTooLarge {
+		status = http.StatusRequestEntityTooLarge
+	}
+
+	rsp := errorResponse{
+		Error:     e.Error(),
+		RequestID: requestid.GetReqId(r),
+	}
+	rsp.Code, rsp.Fields = errorDetails(e, status)
+
+	writeErr(w, l, e, status, rsp)
+}
+
+// errorStatus returns the status of the response to a known error,
+// 400 to validation errors
+func errorStatus(e error) (int, bool) {
+	switch cause := errors.Cause(e).(type) {
+	case model.FieldErrors, *model.FieldError:
+		return http.StatusBadRequest, true
+	default:
+		if reflect.TypeOf(cause).Comparable() {
+			status, ok := errorStatuses[cause]
+			return status, ok
+		}
+	}
+	return 0, false
+}
+
+// restAppErr responds to an error of useradm.App or the datastore with
+// the status listed in errorStatuses; the details of the other errors
+// are only logged, with 500 returned
+func restAppErr(w rest.ResponseWriter, r *rest.Request, l *log.Logger, e error) {
+	restKnownErr(w, r, l, e, http.StatusInternalServerError)
+}
+
+// restKnownErr works like restAppErr, with the errors not listed in
+// errorStatuses returned with the status, e.g. 400 to request decoding
+// errors
+func restKnownErr(w rest.ResponseWriter, r *rest.Request, l *log.Logger, e error,
+	status int) {
+	if s, ok := errorStatus(e); ok {
+		status = s
+	}
+	if status == http.StatusInternalServerError {
+		restErrInternal(w, r, l, e)
+		return
+	}
+	restErr(w, r, l, e, status)
+}
+
+// restErrInternal works like rest_utils.RestErrWithLogInternal,
+// the error details are only logged
+func restErrInternal(w rest.ResponseWriter, r *rest.Request, l *log.Logger, e error) {
+	const msg = "internal error"
+
+	writeErr(w, l, errors.Wrap(e, msg), http.StatusInternalServerError,
+		errorResponse{
+			Error:     msg,
+			Code:      statusErrorCodes[http.StatusInternalServerError],
+			RequestID: requestid.GetReqId(r),
+		})
+}
+
+func writeErr(w rest.ResponseWriter, l *log.Logger, e error, status int, rsp errorResponse) {
+	w.WriteHeader(status)
+	if err := w.WriteJson(rsp); err != nil {
+		panic(err)
+	}
+	if f, ok := w.(interface{ finish() }); ok {
+		f.finish()
+	}
+
+	l.F(log.Ctx{}).Error(e.Error())
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	useradm "github.com/mendersoftware/useradm/user"
+)
+
+func TestErrorStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		err error
+
+		status int
+		known  bool
+	}{
+		"app error": {
+			err:    useradm.ErrUnauthorized,
+			status: http.StatusUnauthorized,
+			known:  true,
+		},
+		"wrapped store error": {
+			err:    errors.Wrap(store.ErrDuplicateEmail, "failed to create user"),
+			status: http.StatusUnprocessableEntity,
+			known:  true,
+		},
+		"validation error": {
+			err:    model.FieldErrors{{Field: "email", Message: "required"}},
+			status: http.StatusBadRequest,
+			known:  true,
+		},
+		"unknown error": {
+			err: errors.New("db connection lost"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			status, known := errorStatus(tc.err)
+			assert.Equal(t, tc.known, known)
+			assert.Equal(t, tc.status, status)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/pkg/errors"
+)
+
+const (
+	hdrIdempotencyKey = "Idempotency-Key"
+
+	maxIdempotencyKeyLen = 255
+)
+
+var (
+	ErrInvalidIdempotencyKey = errors.New("Idempotency-Key must be at most " +
+		"255 characters long")
+)
+
+// parseIdempotencyKey returns the Idempotency-Key header, empty if not set
+func parseIdempotencyKey(r *rest.Request) (string, error) {
+	key := r.Header.Get(hdrIdempotencyKey)
+	if len(key) > maxIdempotencyKeyLen {
+		return "", ErrInvalidIdempotencyKey
+	}
+
+	return key, nil
+}
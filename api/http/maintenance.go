@@ -0,0 +1,206 @@
+// Copyright 2017 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+)
+
+const (
+	uriInternalMaintenance = "/api/internal/v1/useradm/maintenance"
+)
+
+var (
+	ErrMaintenance = errors.New("the service is in maintenance mode, " +
+		"only reads and logins are allowed")
+)
+
+// Maintenance holds the maintenance mode of the service; it's stored in
+// the database for all the instances, and cached by each of them, so that
+// the requests aren't held up by reading it
+type Maintenance struct {
+	db store.DataStore
+
+	mu    sync.RWMutex
+	state model.MaintenanceState
+
+	defaultRetryAfter int
+}
+
+// NewMaintenance returns the maintenance mode stored in db, disabled until
+// loaded, advising clients to retry in retryAfter seconds by default
+func NewMaintenance(db store.DataStore, retryAfter int) *Maintenance {
+	return &Maintenance{
+		db:                db,
+		state:             model.MaintenanceState{RetryAfter: retryAfter},
+		defaultRetryAfter: retryAfter,
+	}
+}
+
+func (m *Maintenance) State() model.MaintenanceState {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Load refreshes the cached maintenance mode from the database,
+// following the switches made by the other instances
+func (m *Maintenance) Load(ctx context.Context) error {
+	s, err := m.db.GetMaintenance(ctx)
+	if err != nil {
+		return err
+	}
+	if s == nil {
+		s = &model.MaintenanceState{}
+	}
+	if s.RetryAfter == 0 {
+		s.RetryAfter = m.defaultRetryAfter
+	}
+
+	m.mu.Lock()
+	m.state = *s
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Set switches the maintenance mode of all the instances; the time it was
+// enabled at is kept if it's enabled already
+func (m *Maintenance) Set(ctx context.Context, s model.MaintenanceState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s.RetryAfter == 0 {
+		s.RetryAfter = m.defaultRetryAfter
+	}
+
+	switch {
+	case !s.Enabled:
+		s.Since = nil
+	case m.state.Enabled:
+		s.Since = m.state.Since
+	default:
+		now := time.Now().UTC()
+		s.Since = &now
+	}
+
+	if err := m.db.SaveMaintenance(ctx, &s); err != nil {
+		return err
+	}
+
+	m.state = s
+	return nil
+}
+
+func (m *Maintenance) Enabled() bool {
+	return m.State().Enabled
+}
+
+// MaintenanceMiddleware rejects the requests modifying data while
+// in maintenance mode, with 503 and the Retry-After header set
+type MaintenanceMiddleware struct {
+	Maintenance *Maintenance
+}
+
+func (mw *MaintenanceMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		if s := mw.Maintenance.State(); s.Enabled && !IsAllowedInMaintenance(r) {
+			w.Header().Set("Retry-After", strconv.Itoa(s.RetryAfter))
+			restErr(w, r, log.FromContext(r.Context()),
+				ErrMaintenance, http.StatusServiceUnavailable)
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+// IsAllowedInMaintenance returns true for the requests served in
+// maintenance mode: reads, logins, token verification and the
+// maintenance mode switch
+func IsAllowedInMaintenance(r *rest.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	case http.MethodPost:
+		return r.URL.Path == uriManagementAuthLogin || r.URL.Path == uriInternalAuthVerify
+	case http.MethodPut:
+		return r.URL.Path == uriInternalMaintenance
+	default:
+		return false
+	}
+}
+
+// WithMaintenance makes the handlers serve the maintenance mode switch
+// at uriInternalMaintenance
+func (i *UserAdmApiHandlers) WithMaintenance(m *Maintenance) *UserAdmApiHandlers {
+	i.maintenance = m
+	return i
+}
+
+func (i *UserAdmApiHandlers) routesMaintenance() []*rest.Route {
+	if i.maintenance == nil {
+		return nil
+	}
+
+	return []*rest.Route{
+		rest.Get(uriInternalMaintenance, i.GetMaintenanceHandler),
+		rest.Put(uriInternalMaintenance, i.SetMaintenanceHandler),
+	}
+}
+
+func (i *UserAdmApiHandlers) GetMaintenanceHandler(w rest.ResponseWriter, r *rest.Request) {
+	w.WriteJson(i.maintenance.State())
+}
+
+func (i *UserAdmApiHandlers) SetMaintenanceHandler(w rest.ResponseWriter, r *rest.Request) {
+	ctx := r.Context()
+
+	l := log.FromContext(ctx)
+
+	var s model.MaintenanceState
+	if err := decodeJsonStrict(r, &s); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+	if err := s.Validate(); err != nil {
+		restErr(w, r, l, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := i.maintenance.Set(ctx, s); err != nil {
+		restAppErr(w, r, l, err)
+		return
+	}
+
+	if s.Enabled {
+		l.Warnf("maintenance mode enabled, retry after %d seconds",
+			i.maintenance.State().RetryAfter)
+	} else {
+		l.Warn("maintenance mode disabled")
+	}
+
+	w.WriteJson(i.maintenance.State())
+}
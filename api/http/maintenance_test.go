@@ -0,0 +1,233 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	mt "github.com/mendersoftware/go-lib-micro/testing"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store/memory"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+)
+
+func TestMaintenanceMiddleware(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		enabled bool
+		method  string
+		path    string
+
+		status int
+	}{
+		"ok, disabled": {
+			method: http.MethodPost,
+			path:   uriManagementUsers,
+			status: http.StatusNoContent,
+		},
+		"ok, read": {
+			enabled: true,
+			method:  http.MethodGet,
+			path:    uriManagementUsers,
+			status:  http.StatusNoContent,
+		},
+		"ok, login": {
+			enabled: true,
+			method:  http.MethodPost,
+			path:    uriManagementAuthLogin,
+			status:  http.StatusNoContent,
+		},
+		"ok, verify": {
+			enabled: true,
+			method:  http.MethodPost,
+			path:    uriInternalAuthVerify,
+			status:  http.StatusNoContent,
+		},
+		"ok, maintenance switch": {
+			enabled: true,
+			method:  http.MethodPut,
+			path:    uriInternalMaintenance,
+			status:  http.StatusNoContent,
+		},
+		"error: create": {
+			enabled: true,
+			method:  http.MethodPost,
+			path:    uriManagementUsers,
+			status:  http.StatusServiceUnavailable,
+		},
+		"error: delete": {
+			enabled: true,
+			method:  http.MethodDelete,
+			path:    "/api/management/v1/useradm/users/1",
+			status:  http.StatusServiceUnavailable,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			m := NewMaintenance(memory.NewDataStoreMemory(), 120)
+			assert.NoError(t, m.Set(context.Background(),
+				model.MaintenanceState{Enabled: tc.enabled}))
+
+			api := rest.NewApi()
+			api.Use(&requestid.RequestIdMiddleware{},
+				&MaintenanceMiddleware{Maintenance: m})
+			api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			req, _ := http.NewRequest(tc.method, "http://1.2.3.4"+tc.path, nil)
+			req.Header.Set(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api.MakeHandler(), req)
+			recorded.CodeIs(tc.status)
+			if tc.status == http.StatusServiceUnavailable {
+				recorded.HeaderIs("Retry-After", "120")
+				recorded.BodyIs(`{"error":"` + ErrMaintenance.Error() +
+					`","code":"maintenance_mode","request_id":"test"}`)
+			}
+		})
+	}
+}
+
+func TestMaintenanceSet(t *testing.T) {
+	ctx := context.Background()
+
+	m := NewMaintenance(memory.NewDataStoreMemory(), 300)
+	assert.Equal(t, model.MaintenanceState{RetryAfter: 300}, m.State())
+
+	assert.NoError(t, m.Set(ctx, model.MaintenanceState{Enabled: true}))
+	s := m.State()
+	assert.True(t, s.Enabled)
+	assert.Equal(t, 300, s.RetryAfter)
+	assert.NotNil(t, s.Since)
+
+	// enabling again keeps the time it was enabled at
+	assert.NoError(t, m.Set(ctx, model.MaintenanceState{Enabled: true, RetryAfter: 60}))
+	assert.Equal(t, model.MaintenanceState{Enabled: true, RetryAfter: 60, Since: s.Since},
+		m.State())
+
+	assert.NoError(t, m.Set(ctx, model.MaintenanceState{}))
+	assert.Equal(t, model.MaintenanceState{RetryAfter: 300}, m.State())
+}
+
+func TestMaintenanceLoad(t *testing.T) {
+	ctx := context.Background()
+	db := memory.NewDataStoreMemory()
+
+	// the instances share the mode stored in the database
+	m := NewMaintenance(db, 300)
+	other := NewMaintenance(db, 300)
+	assert.NoError(t, other.Load(ctx))
+	assert.False(t, other.Enabled())
+
+	assert.NoError(t, m.Set(ctx, model.MaintenanceState{Enabled: true, RetryAfter: 60}))
+	assert.False(t, other.Enabled())
+	assert.NoError(t, other.Load(ctx))
+	assert.Equal(t, m.State(), other.State())
+
+	assert.NoError(t, m.Set(ctx, model.MaintenanceState{}))
+	assert.NoError(t, other.Load(ctx))
+	assert.Equal(t, model.MaintenanceState{RetryAfter: 300}, other.State())
+}
+
+func TestMaintenanceSetError(t *testing.T) {
+	db := &mstore.DataStore{}
+	db.On("SaveMaintenance", mock.Anything, mock.AnythingOfType("*model.MaintenanceState")).
+		Return(errors.New("db connection failed"))
+
+	m := NewMaintenance(db, 300)
+	err := m.Set(context.Background(), model.MaintenanceState{Enabled: true})
+	assert.EqualError(t, err, "db connection failed")
+	assert.False(t, m.Enabled())
+}
+
+func TestUserAdmApiSetMaintenance(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body interface{}
+
+		status  int
+		enabled bool
+		checker mt.ResponseChecker
+	}{
+		"ok, enable": {
+			body: map[string]interface{}{
+				"enabled":     true,
+				"retry_after": 60,
+			},
+			status:  http.StatusOK,
+			enabled: true,
+		},
+		"ok, disable": {
+			body: map[string]interface{}{
+				"enabled": false,
+			},
+			status: http.StatusOK,
+		},
+		"error: invalid retry_after": {
+			body: map[string]interface{}{
+				"enabled":     true,
+				"retry_after": -1,
+			},
+			checker: mt.NewJSONResponse(
+				http.StatusBadRequest,
+				nil,
+				restFieldError(model.ErrInvalidRetryAfter.Error(), model.ErrInvalidRetryAfter),
+			),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			m := NewMaintenance(memory.NewDataStoreMemory(), 300)
+
+			handlers := NewUserAdmApiHandlers(&museradm.App{}, nil).WithMaintenance(m)
+			app, err := handlers.GetApp()
+			assert.NoError(t, err)
+			api := rest.NewApi()
+			api.Use(&requestid.RequestIdMiddleware{})
+			api.SetApp(app)
+
+			req := makeReq("PUT", "http://1.2.3.4"+uriInternalMaintenance, "", tc.body)
+
+			recorded := test.RunRequest(t, api.MakeHandler(), req)
+			if tc.checker != nil {
+				mt.CheckResponse(t, tc.checker, recorded)
+				assert.False(t, m.Enabled())
+				return
+			}
+
+			recorded.CodeIs(tc.status)
+			var s model.MaintenanceState
+			assert.NoError(t, json.Unmarshal(recorded.Recorder.Body.Bytes(), &s))
+			assert.Equal(t, m.State(), s)
+			assert.Equal(t, tc.enabled, m.Enabled())
+		})
+	}
+}
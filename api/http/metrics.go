@@ -0,0 +1,167 @@
+// Copyright 2017 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/useradm/authz"
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/metrics"
+)
+
+const (
+	uriInternalMetrics = "/api/internal/v1/useradm/metrics"
+
+	// keys of the request's Env set by the handlers for the metrics:
+	// the matched route's path template, and the tenant of requests
+	// without an identity, e.g. logins
+	envRoute  = "USERADM_ROUTE"
+	envTenant = "USERADM_TENANT"
+
+	// route label of the requests matching no route
+	unmatchedRoute = "unmatched"
+)
+
+// Metrics holds the metrics of the HTTP requests: their number by route,
+// status code and tenant, their duration by route, and the number of the
+// tokens rejected by reason
+type Metrics struct {
+	registry   *metrics.Registry
+	requests   *metrics.CounterVec
+	duration   *metrics.HistogramVec
+	rejections *metrics.CounterVec
+	tenants    *metrics.TenantLabels
+}
+
+// NewMetrics returns the HTTP metrics, labelled with at most maxTenants
+// tenants to bound their number
+func NewMetrics(maxTenants int) *Metrics {
+	m := &Metrics{
+		registry: metrics.NewRegistry(),
+		requests: metrics.NewCounterVec("useradm_http_requests_total",
+			"Number of HTTP requests handled.",
+			"method", "route", "status", "tenant"),
+		duration: metrics.NewHistogramVec("useradm_http_request_duration_seconds",
+			"Duration of the HTTP requests.", metrics.DefaultBuckets,
+			"method", "route"),
+		rejections: metrics.NewCounterVec("useradm_token_rejections_total",
+			"Number of tokens rejected, by reason: expired, not_yet_valid "+
+				"(most likely drifting clocks) or invalid.",
+			"reason"),
+		tenants: metrics.NewTenantLabels(maxTenants),
+	}
+	m.registry.Register(m.requests, m.duration, m.rejections)
+	return m
+}
+
+// Registry returns the registry served with the HTTP metrics, where
+// other metrics can be added
+func (m *Metrics) Registry() *metrics.Registry {
+	return m.registry
+}
+
+// MetricsMiddleware records the metrics of the requests;
+// rest.RecorderMiddleware has to run after it
+type MetricsMiddleware struct {
+	Metrics *Metrics
+}
+
+func (mw *MetricsMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		start := time.Now()
+
+		h(w, r)
+
+		route, ok := r.Env[envRoute].(string)
+		if !ok {
+			route = unmatchedRoute
+		}
+		status, _ := r.Env["STATUS_CODE"].(int)
+
+		tenant, _ := r.Env[envTenant].(string)
+		if id := identity.FromContext(r.Context()); id != nil && tenant == "" {
+			tenant = id.Tenant
+		}
+
+		m := mw.Metrics
+		m.requests.Inc(r.Method, route, strconv.Itoa(status), m.tenants.Label(tenant))
+		m.duration.Observe(time.Since(start).Seconds(), r.Method, route)
+
+		if err, ok := r.Env[authz.ReqTokenError].(error); ok {
+			m.rejections.Inc(tokenRejectionReason(err))
+		}
+	}
+}
+
+// tokenRejectionReason labels the reason the token was rejected for
+func tokenRejectionReason(err error) string {
+	switch err {
+	case jwt.ErrTokenExpired:
+		return "expired"
+	case jwt.ErrTokenNotValidYet:
+		return "not_yet_valid"
+	default:
+		return "invalid"
+	}
+}
+
+// withRouteLabels makes the routes' handlers set the path template
+// of the route for the metrics
+func withRouteLabels(routes []*rest.Route) []*rest.Route {
+	for _, route := range routes {
+		h, path := route.Func, route.PathExp
+		route.Func = func(w rest.ResponseWriter, r *rest.Request) {
+			r.Env[envRoute] = path
+			h(w, r)
+		}
+	}
+	return routes
+}
+
+// setMetricsTenant sets the tenant of requests without an identity
+func setMetricsTenant(r *rest.Request, tenant string) {
+	r.Env[envTenant] = tenant
+}
+
+// WithMetrics makes the handlers serve the metrics in the Prometheus
+// text format at uriInternalMetrics
+func (i *UserAdmApiHandlers) WithMetrics(m *Metrics) *UserAdmApiHandlers {
+	i.metrics = m
+	return i
+}
+
+func (i *UserAdmApiHandlers) routesMetrics() []*rest.Route {
+	if i.metrics == nil {
+		return nil
+	}
+
+	return []*rest.Route{
+		rest.Get(uriInternalMetrics, i.GetMetricsHandler),
+	}
+}
+
+func (i *UserAdmApiHandlers) GetMetricsHandler(w rest.ResponseWriter, r *rest.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := i.metrics.registry.WriteText(w.(http.ResponseWriter)); err != nil {
+		log.FromContext(r.Context()).Errorf("failed to write metrics: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/authz"
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/metrics"
+	"github.com/mendersoftware/useradm/model"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+)
+
+// identityFromHeader sets the identity of the requests to the tenant
+// in the header, in place of the identity middleware
+type identityFromHeader struct{}
+
+func (identityFromHeader) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		if tenant := r.Header.Get("X-Tenant"); tenant != "" {
+			r.Request = r.WithContext(identity.WithContext(r.Context(),
+				&identity.Identity{Subject: "user", Tenant: tenant}))
+		}
+		h(w, r)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	uadm := &museradm.App{}
+	uadm.On("GetUser", mock.Anything, mock.AnythingOfType("string")).
+		Return(&model.User{ID: "1", Email: "foo@example.com"}, nil)
+
+	m := NewMetrics(2)
+	handlers := NewUserAdmApiHandlers(uadm, nil).WithMetrics(m)
+	app, err := handlers.GetApp()
+	assert.NoError(t, err)
+
+	api := rest.NewApi()
+	api.Use(&MetricsMiddleware{Metrics: m}, &rest.RecorderMiddleware{},
+		identityFromHeader{})
+	api.SetApp(app)
+
+	requests := []struct {
+		path   string
+		tenant string
+		status int
+	}{
+		{"/api/management/v1/useradm/users/1", "tenant-1", http.StatusOK},
+		{"/api/management/v1/useradm/users/2", "tenant-1", http.StatusOK},
+		{"/api/management/v1/useradm/users/3", "tenant-2", http.StatusOK},
+		{"/api/management/v1/useradm/users/4", "tenant-3", http.StatusOK},
+		{"/api/management/v1/useradm/users/5", "", http.StatusOK},
+		{"/api/management/v1/useradm/foo", "tenant-1", http.StatusNotFound},
+	}
+	for _, r := range requests {
+		req, _ := http.NewRequest(http.MethodGet, "http://1.2.3.4"+r.path, nil)
+		req.Header.Set("X-Tenant", r.tenant)
+
+		recorded := test.RunRequest(t, api.MakeHandler(), req)
+		recorded.CodeIs(r.status)
+	}
+
+	assert.Equal(t, float64(2), m.requests.Value("GET", uriManagementUser, "200", "tenant-1"))
+	assert.Equal(t, float64(1), m.requests.Value("GET", uriManagementUser, "200", "tenant-2"))
+	assert.Equal(t, float64(1), m.requests.Value("GET", uriManagementUser, "200",
+		metrics.OtherTenants))
+	assert.Equal(t, float64(1), m.requests.Value("GET", uriManagementUser, "200", ""))
+	assert.Equal(t, float64(1), m.requests.Value("GET", unmatchedRoute, "404", "tenant-1"))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://1.2.3.4"+uriInternalMetrics, nil)
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(http.StatusOK)
+	recorded.HeaderIs("Content-Type", metrics.ContentType)
+	assert.Contains(t, recorded.Recorder.Body.String(),
+		`useradm_http_requests_total{method="GET",route="/api/management/v1/useradm/users/:id",`+
+			`status="200",tenant="tenant-1"} 2`)
+	assert.Contains(t, recorded.Recorder.Body.String(),
+		`useradm_http_request_duration_seconds_count{method="GET",`+
+			`route="/api/management/v1/useradm/users/:id"} 5`)
+}
+
+func TestMetricsTokenRejections(t *testing.T) {
+	t.Parallel()
+
+	m := NewMetrics(2)
+
+	api := rest.NewApi()
+	api.Use(&MetricsMiddleware{Metrics: m}, &rest.RecorderMiddleware{})
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		switch r.URL.Query().Get("reason") {
+		case "expired":
+			r.Env[authz.ReqTokenError] = jwt.ErrTokenExpired
+		case "not_yet_valid":
+			r.Env[authz.ReqTokenError] = jwt.ErrTokenNotValidYet
+		case "invalid":
+			r.Env[authz.ReqTokenError] = errors.New("signature is invalid")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, reason := range []string{"expired", "not_yet_valid", "not_yet_valid",
+		"invalid", ""} {
+		req, _ := http.NewRequest(http.MethodPost,
+			"http://1.2.3.4/api/internal/v1/useradm/auth/verify?reason="+reason, nil)
+		test.RunRequest(t, api.MakeHandler(), req).CodeIs(http.StatusNoContent)
+	}
+
+	assert.Equal(t, float64(1), m.rejections.Value("expired"))
+	assert.Equal(t, float64(2), m.rejections.Value("not_yet_valid"))
+	assert.Equal(t, float64(1), m.rejections.Value("invalid"))
+}
+
+func TestMetricsNotServed(t *testing.T) {
+	t.Parallel()
+
+	app, err := NewUserAdmApiHandlers(&museradm.App{}, nil).GetApp()
+	assert.NoError(t, err)
+	api := rest.NewApi()
+	api.SetApp(app)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://1.2.3.4"+uriInternalMetrics, nil)
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(http.StatusNotFound)
+}
@@ -14,15 +14,324 @@
 package http
 
 import (
+	"bufio"
+	"context"
 	"errors"
+	"io"
+	"mime"
+	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/mendersoftware/go-lib-micro/requestlog"
+	"github.com/satori/go.uuid"
 
 	"github.com/mendersoftware/useradm/authz"
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/scope"
 )
 
+const (
+	// RequestIdHeader is the common request ID header, accepted and
+	// returned along with requestid.RequestIdHeader
+	RequestIdHeader = "X-Request-Id"
+
+	// request IDs set by the clients are replaced if longer
+	maxRequestIdLength = 128
+
+	// TenantHeader addresses a tenant other than the token's, which only
+	// the hosted operators may do
+	TenantHeader = "X-MEN-Tenant"
+)
+
+var (
+	ErrRequestBodyTooLarge   = errors.New("request body too large")
+	ErrTenantHeaderForbidden = errors.New("only operators may address other tenants")
+)
+
+// RequestIdMiddleware works like requestid.RequestIdMiddleware, the ID
+// is also taken from and returned in X-Request-Id. It's set in the
+// request headers too, for the access log. IDs which aren't printable
+// ASCII, or are too long, are replaced so they can't tamper with the logs.
+type RequestIdMiddleware struct{}
+
+func (mw *RequestIdMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		reqId := r.Header.Get(requestid.RequestIdHeader)
+		if reqId == "" {
+			reqId = r.Header.Get(RequestIdHeader)
+		}
+		if !validRequestId(reqId) {
+			reqId = uuid.NewV4().String()
+		}
+
+		r.Header.Set(requestid.RequestIdHeader, reqId)
+		r.Header.Set(RequestIdHeader, reqId)
+		r = requestid.SetReqId(r, reqId)
+
+		l := requestlog.GetRequestLogger(r).F(log.Ctx{"request_id": reqId})
+		r = requestlog.SetRequestLogger(r, l)
+
+		w.Header().Set(requestid.RequestIdHeader, reqId)
+		w.Header().Set(RequestIdHeader, reqId)
+
+		h(w, r)
+	}
+}
+
+func validRequestId(reqId string) bool {
+	if reqId == "" || len(reqId) > maxRequestIdLength {
+		return false
+	}
+	for _, c := range reqId {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// BodyLimitMiddleware rejects requests with bodies larger than Limit bytes;
+// bodies of unknown length are cut off at the limit, failing to read
+// with ErrRequestBodyTooLarge
+type BodyLimitMiddleware struct {
+	Limit int64
+}
+
+func (mw *BodyLimitMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		if r.ContentLength > mw.Limit {
+			restErr(w, r, log.FromContext(r.Context()),
+				ErrRequestBodyTooLarge, http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		r.Body = &limitedBody{
+			ReadCloser: http.MaxBytesReader(w.(http.ResponseWriter), r.Body, mw.Limit),
+			limit:      mw.Limit,
+		}
+
+		h(w, r)
+	}
+}
+
+// limitedBody reports the failure of http.MaxBytesReader to read past
+// the limit as ErrRequestBodyTooLarge, responded to with 413
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	read  int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		err = ErrRequestBodyTooLarge
+	}
+	return n, err
+}
+
+// RequestTimeoutMiddleware sets the deadline of the request's context,
+// which the datastore calls made by the handlers are bounded by
+type RequestTimeoutMiddleware struct {
+	Timeout time.Duration
+}
+
+func (mw *RequestTimeoutMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), mw.Timeout)
+		defer cancel()
+
+		r.Request = r.Request.WithContext(ctx)
+
+		h(w, r)
+	}
+}
+
+// OperatorTenantMiddleware serves the requests with TenantHeader as if
+// made by a user of the tenant, for the tokens with the operator scope;
+// the requests of the other tokens are rejected. The requests addressing
+// other tenants are logged with both tenants, for audit.
+type OperatorTenantMiddleware struct {
+	JWTHandler jwt.Handler
+}
+
+func (mw *OperatorTenantMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		tenantId := r.Header.Get(TenantHeader)
+		if tenantId == "" {
+			h(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		l := log.FromContext(ctx)
+
+		// unlike the identity, the operator scope isn't trusted
+		// without checking the token's signature
+		token, err := jwt.FromJWT(ctx, mw.JWTHandler, bearerToken(r))
+		if err != nil || !scope.Allows(token.Claims.Scope, scope.Operator) {
+			restErr(w, r, l, ErrTenantHeaderForbidden, http.StatusForbidden)
+			return
+		}
+
+		l = l.F(log.Ctx{
+			"operator_id":        token.Claims.Subject,
+			"operator_tenant_id": token.Claims.Tenant,
+			"tenant_id":          tenantId,
+		})
+		l.Warnf("operator request %s %s to tenant %s",
+			r.Method, r.URL.Path, tenantId)
+
+		ident := identity.Identity{
+			Subject: token.Claims.Subject,
+			Tenant:  tenantId,
+			IsUser:  token.Claims.User,
+		}
+		ctx = identity.WithContext(log.WithContext(ctx, l), &ident)
+		r.Request = r.Request.WithContext(ctx)
+
+		h(w, r)
+	}
+}
+
+// OpaqueTokenIdentityMiddleware sets the identity of the requests made with
+// opaque tokens, whose claims the identity middleware can't read; the
+// requests with JWTs are left as they are
+type OpaqueTokenIdentityMiddleware struct {
+	// resolves the opaque tokens
+	JWTHandler jwt.Handler
+}
+
+func (mw *OpaqueTokenIdentityMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		raw := bearerToken(r)
+		if raw == "" || strings.Contains(raw, ".") {
+			h(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		l := log.FromContext(ctx)
+
+		// like with the identity middleware, the request goes on without
+		// the identity, and the handlers needing one reject it
+		token, err := jwt.FromJWT(ctx, mw.JWTHandler, raw)
+		if err != nil {
+			l.Warnf("Failed to resolve opaque token: %v", err)
+			h(w, r)
+			return
+		}
+
+		logCtx := log.Ctx{"sub": token.Claims.Subject}
+		if token.Claims.User {
+			logCtx = log.Ctx{"user_id": token.Claims.Subject}
+		}
+		if token.Claims.Tenant != "" {
+			logCtx["tenant_id"] = token.Claims.Tenant
+		}
+
+		ident := identity.Identity{
+			Subject: token.Claims.Subject,
+			Tenant:  token.Claims.Tenant,
+			IsUser:  token.Claims.User,
+		}
+		ctx = identity.WithContext(log.WithContext(ctx, l.F(logCtx)), &ident)
+		r.Request = r.Request.WithContext(ctx)
+
+		h(w, r)
+	}
+}
+
+// bearerToken returns the token of the request's Authorization header
+func bearerToken(r *rest.Request) string {
+	const prefix = "bearer "
+
+	auth := r.Header.Get("Authorization")
+	if len(auth) > len(prefix) && strings.EqualFold(auth[:len(prefix)], prefix) {
+		return strings.TrimSpace(auth[len(prefix):])
+	}
+	return ""
+}
+
+// SingleResponseMiddleware makes sure a handler writes a single response:
+// status codes set after the first one are dropped, as are writes following
+// an error response, with both logged as handler bugs
+type SingleResponseMiddleware struct{}
+
+func (mw *SingleResponseMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		h(&singleResponseWriter{
+			ResponseWriter: w,
+			l:              log.FromContext(r.Context()),
+		}, r)
+	}
+}
+
+type singleResponseWriter struct {
+	rest.ResponseWriter
+	l *log.Logger
+
+	status   int
+	finished bool
+}
+
+func (w *singleResponseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		w.l.Errorf("dropping status %d, response already started with %d",
+			status, w.status)
+		return
+	}
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *singleResponseWriter) WriteJson(v interface{}) error {
+	b, err := w.EncodeJson(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (w *singleResponseWriter) Write(b []byte) (int, error) {
+	if w.finished {
+		w.l.Errorf("dropping %d bytes written after an error response", len(b))
+		return len(b), nil
+	}
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.(http.ResponseWriter).Write(b)
+}
+
+// finish marks the response as complete, see writeErr
+func (w *singleResponseWriter) finish() {
+	w.finished = true
+}
+
+func (w *singleResponseWriter) Flush() {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *singleResponseWriter) CloseNotify() <-chan bool {
+	return w.ResponseWriter.(http.CloseNotifier).CloseNotify()
+}
+
+func (w *singleResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
 func IsVerificationEndpoint(r *rest.Request) bool {
 	if r.URL.Path == uriInternalAuthVerify && r.Method == http.MethodPost {
 		return true
@@ -31,6 +340,56 @@ func IsVerificationEndpoint(r *rest.Request) bool {
 	}
 }
 
+// IsManagementEndpoint returns true for requests to the management API
+func IsManagementEndpoint(r *rest.Request) bool {
+	return strings.HasPrefix(r.URL.Path, prefixManagementAPI)
+}
+
+// IsInternalPath returns true for paths of the internal API
+func IsInternalPath(path string) bool {
+	return strings.HasPrefix(path, prefixInternalAPI)
+}
+
+// IsExportPath returns true for paths of the users export, streaming
+// responses the server's write timeout does not apply to
+func IsExportPath(path string) bool {
+	return path == uriManagementUsersExport
+}
+
+// IsMergePatchRequest returns true for requests carrying a JSON merge patch
+func IsMergePatchRequest(r *rest.Request) bool {
+	if r.Method != http.MethodPatch {
+		return false
+	}
+
+	mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediatype == mediaTypeMergePatch
+}
+
+// ChecksOwnContentType returns true for requests whose Content-Type
+// is checked by the handler instead of the common middleware, which
+// only accepts JSON
+func ChecksOwnContentType(r *rest.Request) bool {
+	if IsMergePatchRequest(r) {
+		return true
+	}
+
+	if r.Method != http.MethodPost {
+		return false
+	}
+
+	switch r.URL.Path {
+	case uriManagementUsersImport,
+		// OAuth token requests are form-encoded, see RFC 6749 3.2
+		uriManagementAuthToken,
+		// and so are the device login's, see RFC 8628 3.1 and 3.4
+		uriManagementAuthDeviceCode,
+		uriManagementAuthDeviceToken:
+		return true
+	}
+	return false
+}
+
 // ExtractResourceAction extracts resource action from the request url
 func ExtractResourceAction(r *rest.Request) (*authz.Action, error) {
 	action := authz.Action{}
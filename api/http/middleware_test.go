@@ -0,0 +1,382 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/jwt"
+	mjwt "github.com/mendersoftware/useradm/jwt/mocks"
+	"github.com/mendersoftware/useradm/keys"
+	"github.com/mendersoftware/useradm/scope"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		body    string
+		chunked bool
+
+		status int
+		code   string
+	}{
+		"ok": {
+			body:   `{"email":"foo@bar.com"}`,
+			status: http.StatusNoContent,
+		},
+		"error: too large": {
+			body:   `{"email":"` + strings.Repeat("a", 64) + `"}`,
+			status: http.StatusRequestEntityTooLarge,
+			code:   "request_body_too_large",
+		},
+		"error: too large, unknown length": {
+			body:    `{"email":"` + strings.Repeat("a", 64) + `"}`,
+			chunked: true,
+			status:  http.StatusRequestEntityTooLarge,
+			code:    "request_body_too_large",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			api := rest.NewApi()
+			api.Use(&requestid.RequestIdMiddleware{},
+				&BodyLimitMiddleware{Limit: 32})
+			api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+				var body map[string]interface{}
+				if err := r.DecodeJsonPayload(&body); err != nil {
+					restErr(w, r, log.FromContext(r.Context()), err,
+						http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			req, _ := http.NewRequest(http.MethodPost, "http://1.2.3.4/",
+				strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(requestid.RequestIdHeader, "test")
+			if tc.chunked {
+				req.ContentLength = -1
+			}
+
+			recorded := test.RunRequest(t, api.MakeHandler(), req)
+			recorded.CodeIs(tc.status)
+			if tc.code != "" {
+				recorded.BodyIs(`{"error":"request body too large","code":"` +
+					tc.code + `","request_id":"test"}`)
+			}
+		})
+	}
+}
+
+func TestRequestTimeoutMiddleware(t *testing.T) {
+	t.Parallel()
+
+	api := rest.NewApi()
+	api.Use(&RequestTimeoutMiddleware{Timeout: time.Minute})
+	api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+		deadline, ok := r.Context().Deadline()
+		if !ok || time.Until(deadline) > time.Minute {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://1.2.3.4/", nil)
+
+	recorded := test.RunRequest(t, api.MakeHandler(), req)
+	recorded.CodeIs(http.StatusNoContent)
+}
+
+func TestRequestIdMiddleware(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		header string
+		value  string
+
+		reqId string
+	}{
+		"generated": {},
+		"X-MEN-RequestID": {
+			header: requestid.RequestIdHeader,
+			value:  "foo",
+			reqId:  "foo",
+		},
+		"X-Request-Id": {
+			header: RequestIdHeader,
+			value:  "bar",
+			reqId:  "bar",
+		},
+		"replaced: not printable": {
+			header: RequestIdHeader,
+			value:  "foo\tlevel=error",
+		},
+		"replaced: too long": {
+			header: RequestIdHeader,
+			value:  strings.Repeat("a", maxRequestIdLength+1),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			var handled string
+
+			api := rest.NewApi()
+			api.Use(&RequestIdMiddleware{})
+			api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+				handled = requestid.GetReqId(r)
+				assert.Equal(t, handled, r.Header.Get(requestid.RequestIdHeader))
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			req, _ := http.NewRequest(http.MethodGet, "http://1.2.3.4/", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+
+			recorded := test.RunRequest(t, api.MakeHandler(), req)
+			recorded.CodeIs(http.StatusNoContent)
+
+			if tc.reqId != "" {
+				assert.Equal(t, tc.reqId, handled)
+			} else {
+				assert.NotEqual(t, tc.value, handled)
+				assert.Len(t, handled, 36)
+			}
+			recorded.HeaderIs(requestid.RequestIdHeader, handled)
+			recorded.HeaderIs(RequestIdHeader, handled)
+		})
+	}
+}
+
+func TestSingleResponseMiddleware(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		handler rest.HandlerFunc
+
+		status int
+		body   string
+	}{
+		"ok": {
+			handler: func(w rest.ResponseWriter, r *rest.Request) {
+				w.WriteHeader(http.StatusCreated)
+				w.WriteJson(map[string]string{"id": "1"})
+			},
+			status: http.StatusCreated,
+			body:   `{"id":"1"}`,
+		},
+		"ok, implicit status": {
+			handler: func(w rest.ResponseWriter, r *rest.Request) {
+				w.WriteJson(map[string]string{"id": "1"})
+			},
+			status: http.StatusOK,
+			body:   `{"id":"1"}`,
+		},
+		"status after error dropped": {
+			handler: func(w rest.ResponseWriter, r *rest.Request) {
+				restErr(w, r, log.FromContext(r.Context()),
+					ErrUserNotFound, http.StatusNotFound)
+				w.WriteHeader(http.StatusNoContent)
+			},
+			status: http.StatusNotFound,
+			body: `{"error":"user not found","code":"user_not_found",` +
+				`"request_id":"test"}`,
+		},
+		"body after error dropped": {
+			handler: func(w rest.ResponseWriter, r *rest.Request) {
+				restErr(w, r, log.FromContext(r.Context()),
+					ErrUserNotFound, http.StatusNotFound)
+				w.WriteJson(map[string]string{"id": "1"})
+			},
+			status: http.StatusNotFound,
+			body: `{"error":"user not found","code":"user_not_found",` +
+				`"request_id":"test"}`,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			api := rest.NewApi()
+			api.Use(&requestid.RequestIdMiddleware{},
+				&SingleResponseMiddleware{})
+			api.SetApp(rest.AppSimple(tc.handler))
+
+			req, _ := http.NewRequest(http.MethodGet, "http://1.2.3.4/", nil)
+			req.Header.Set(requestid.RequestIdHeader, "test")
+
+			recorded := test.RunRequest(t, api.MakeHandler(), req)
+			recorded.CodeIs(tc.status)
+			recorded.BodyIs(tc.body)
+		})
+	}
+}
+
+func TestOperatorTenantMiddleware(t *testing.T) {
+	t.Parallel()
+
+	privkey, err := keys.LoadRSAPrivate("../../crypto/private.pem")
+	assert.NoError(t, err)
+	jwth := jwt.NewJWTHandlerRS256(privkey)
+
+	sign := func(scp string) string {
+		token, err := jwth.ToJWT(&jwt.Token{
+			Claims: jwt.Claims{
+				Issuer:    "mender",
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+				Subject:   "user1",
+				Scope:     scp,
+				Tenant:    "operators",
+				User:      true,
+			},
+		})
+		assert.NoError(t, err)
+		return token
+	}
+
+	testCases := map[string]struct {
+		token        string
+		tenantHeader string
+
+		status int
+		tenant string
+	}{
+		"ok: no tenant header": {
+			token:  sign(scope.All),
+			status: http.StatusNoContent,
+		},
+		"ok: operator": {
+			token:        sign(scope.All + " " + scope.Operator),
+			tenantHeader: "tenant1",
+			status:       http.StatusNoContent,
+			tenant:       "tenant1",
+		},
+		"error: not an operator": {
+			token:        sign(scope.All),
+			tenantHeader: "tenant1",
+			status:       http.StatusForbidden,
+		},
+		"error: no token": {
+			tenantHeader: "tenant1",
+			status:       http.StatusForbidden,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			api := rest.NewApi()
+			api.Use(&requestid.RequestIdMiddleware{},
+				&OperatorTenantMiddleware{JWTHandler: jwth})
+			api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+				tenant := ""
+				if id := identity.FromContext(r.Context()); id != nil {
+					tenant = id.Tenant
+				}
+				assert.Equal(t, tc.tenant, tenant)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			req, _ := http.NewRequest(http.MethodGet,
+				"http://1.2.3.4/api/management/v1/useradm/users", nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			if tc.tenantHeader != "" {
+				req.Header.Set(TenantHeader, tc.tenantHeader)
+			}
+
+			recorded := test.RunRequest(t, api.MakeHandler(), req)
+			recorded.CodeIs(tc.status)
+		})
+	}
+}
+
+func TestOpaqueTokenIdentityMiddleware(t *testing.T) {
+	t.Parallel()
+
+	token := &jwt.Token{
+		Id: "token-1",
+		Claims: jwt.Claims{
+			Subject: "user1",
+			Tenant:  "tenant1",
+			User:    true,
+		},
+	}
+
+	testCases := map[string]struct {
+		token string
+
+		identity *identity.Identity
+	}{
+		"ok: opaque token": {
+			token: "ref",
+			identity: &identity.Identity{
+				Subject: "user1",
+				Tenant:  "tenant1",
+				IsUser:  true,
+			},
+		},
+		"ok: jwt left to the identity middleware": {
+			token: "header.claims.signature",
+		},
+		"ok: no token": {},
+		"error: unknown reference": {
+			token: "unknown",
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			jwth := &mjwt.Handler{}
+			jwth.On("FromJWT", "ref").Return(token, nil)
+			jwth.On("FromJWT", "unknown").Return(nil, jwt.ErrTokenInvalid)
+
+			api := rest.NewApi()
+			api.Use(&requestid.RequestIdMiddleware{},
+				&OpaqueTokenIdentityMiddleware{JWTHandler: jwth})
+			api.SetApp(rest.AppSimple(func(w rest.ResponseWriter, r *rest.Request) {
+				assert.Equal(t, tc.identity, identity.FromContext(r.Context()))
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			req, _ := http.NewRequest(http.MethodGet,
+				"http://1.2.3.4/api/management/v1/useradm/users", nil)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+
+			recorded := test.RunRequest(t, api.MakeHandler(), req)
+			recorded.CodeIs(http.StatusNoContent)
+			jwth.AssertNotCalled(t, "FromJWT", "header.claims.signature")
+		})
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/ant0ine/go-json-rest/rest"
+)
+
+const (
+	uriManagementOpenAPI = "/api/management/v1/useradm/openapi.json"
+	uriManagementDocs    = "/api/management/v1/useradm/docs"
+	uriInternalOpenAPI   = "/api/internal/v1/useradm/openapi.json"
+
+	prefixManagementAPI = "/api/management/"
+	prefixInternalAPI   = "/api/internal/"
+)
+
+// swaggerUIPage loads Swagger UI from a CDN and points it
+// at the management API specification
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>User administration and authentication</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@3/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@3/swagger-ui-bundle.js"></script>
+  <script>
+    SwaggerUIBundle({url: "%s", dom_id: "#swagger-ui"});
+  </script>
+</body>
+</html>
+`
+
+// WithSwaggerUI makes the handlers serve Swagger UI for
+// the management API at uriManagementDocs
+func (i *UserAdmApiHandlers) WithSwaggerUI() *UserAdmApiHandlers {
+	i.swaggerUI = true
+	return i
+}
+
+// routesOpenAPI returns the routes serving the specifications
+// of the APIs made of the given routes
+func (i *UserAdmApiHandlers) routesOpenAPI(routes []*rest.Route) []*rest.Route {
+	management := openAPIDocument("User administration and authentication",
+		prefixManagementAPI, routes)
+	internal := openAPIDocument("User administration and authentication, internal API",
+		prefixInternalAPI, routes)
+
+	openAPIRoutes := []*rest.Route{
+		rest.Get(uriManagementOpenAPI, serveDocument(management)),
+		rest.Get(uriInternalOpenAPI, serveDocument(internal)),
+	}
+
+	if i.swaggerUI {
+		openAPIRoutes = append(openAPIRoutes,
+			rest.Get(uriManagementDocs, serveSwaggerUI))
+	}
+
+	return openAPIRoutes
+}
+
+func serveDocument(doc interface{}) rest.HandlerFunc {
+	return func(w rest.ResponseWriter, r *rest.Request) {
+		w.WriteJson(doc)
+	}
+}
+
+func serveSwaggerUI(w rest.ResponseWriter, r *rest.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w.(http.ResponseWriter), swaggerUIPage, uriManagementOpenAPI)
+}
+
+// openAPIDocument builds an OpenAPI (Swagger 2.0) document listing the
+// routes with the given path prefix; the operations are named after their
+// handlers, the request and response bodies are described in docs/
+func openAPIDocument(title, prefix string, routes []*rest.Route) map[string]interface{} {
+	paths := map[string]map[string]interface{}{}
+
+	for _, route := range routes {
+		if !strings.HasPrefix(route.PathExp, prefix) {
+			continue
+		}
+
+		path, params := openAPIPath(route.PathExp)
+		if paths[path] == nil {
+			paths[path] = map[string]interface{}{}
+		}
+
+		op := map[string]interface{}{
+			"operationId": operationID(route.Func),
+			"responses": map[string]interface{}{
+				"default": map[string]string{"description": "See the API documentation."},
+			},
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+
+		paths[path][strings.ToLower(route.HttpMethod)] = op
+	}
+
+	return map[string]interface{}{
+		"swagger": "2.0",
+		"info": map[string]string{
+			"title":   title,
+			"version": "1",
+		},
+		"paths": paths,
+	}
+}
+
+// openAPIPath converts a route path to the OpenAPI notation,
+// returning the descriptions of its parameters
+func openAPIPath(pathExp string) (string, []map[string]interface{}) {
+	params := []map[string]interface{}{}
+
+	segments := strings.Split(pathExp, "/")
+	for n, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "#") ||
+			strings.HasPrefix(s, "*") {
+			name := s[1:]
+			segments[n] = "{" + name + "}"
+			params = append(params, map[string]interface{}{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"type":     "string",
+			})
+		}
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+// operationID names the operation after its handler,
+// e.g. GetUserHandler becomes GetUser
+func operationID(handler rest.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+
+	name = strings.TrimSuffix(name, "-fm")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+
+	return strings.TrimSuffix(name, "Handler")
+}
@@ -0,0 +1,141 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	t.Parallel()
+
+	handlers := &UserAdmApiHandlers{}
+
+	routes := []*rest.Route{
+		rest.Get(uriManagementUser, handlers.GetUserHandler),
+		rest.Delete(uriManagementUser, handlers.DeleteUserHandler),
+		rest.Put(uriManagementGroupMember, handlers.AddGroupMemberHandler),
+		rest.Post(uriInternalTenants, handlers.CreateTenantHandler),
+	}
+
+	doc := openAPIDocument("test", prefixManagementAPI, routes)
+
+	assert.Equal(t, "2.0", doc["swagger"])
+
+	paths := doc["paths"].(map[string]map[string]interface{})
+	assert.Len(t, paths, 2)
+
+	user := paths["/api/management/v1/useradm/users/{id}"]
+	assert.Len(t, user, 2)
+	assert.Equal(t, "GetUser", user["get"].(map[string]interface{})["operationId"])
+	assert.Equal(t, "DeleteUser", user["delete"].(map[string]interface{})["operationId"])
+
+	member := paths["/api/management/v1/useradm/groups/{id}/members/{userid}"]
+	params := member["put"].(map[string]interface{})["parameters"].([]map[string]interface{})
+	assert.Len(t, params, 2)
+	assert.Equal(t, "id", params[0]["name"])
+	assert.Equal(t, "userid", params[1]["name"])
+	assert.Equal(t, "path", params[1]["in"])
+}
+
+func TestUserAdmApiOpenAPI(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		url       string
+		swaggerUI bool
+
+		status   int
+		path     string
+		notPath  string
+		bodyPart string
+	}{
+		"ok: management": {
+			url: "http://1.2.3.4/api/management/v1/useradm/openapi.json",
+
+			status:  http.StatusOK,
+			path:    "/api/management/v1/useradm/users/{id}",
+			notPath: "/api/internal/v1/useradm/auth/verify",
+		},
+		"ok: management v2": {
+			url: "http://1.2.3.4/api/management/v1/useradm/openapi.json",
+
+			status: http.StatusOK,
+			path:   "/api/management/v2/useradm/users/{id}/tokens",
+		},
+		"ok: internal": {
+			url: "http://1.2.3.4/api/internal/v1/useradm/openapi.json",
+
+			status:  http.StatusOK,
+			path:    "/api/internal/v1/useradm/auth/verify",
+			notPath: "/api/management/v1/useradm/users/{id}",
+		},
+		"ok: swagger ui": {
+			url:       "http://1.2.3.4/api/management/v1/useradm/docs",
+			swaggerUI: true,
+
+			status:   http.StatusOK,
+			bodyPart: `url: "/api/management/v1/useradm/openapi.json"`,
+		},
+		"error: swagger ui disabled": {
+			url: "http://1.2.3.4/api/management/v1/useradm/docs",
+
+			status: http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			handlers := NewUserAdmApiHandlers(nil, nil)
+			if tc.swaggerUI {
+				handlers = handlers.WithSwaggerUI()
+			}
+
+			app, err := handlers.GetApp()
+			assert.NoError(t, err)
+
+			api := rest.NewApi()
+			api.SetApp(app)
+
+			req := makeReq(http.MethodGet, tc.url, "", nil)
+
+			recorded := test.RunRequest(t, api.MakeHandler(), req)
+			recorded.CodeIs(tc.status)
+
+			body := recorded.Recorder.Body.String()
+			if tc.bodyPart != "" {
+				assert.True(t, strings.Contains(body, tc.bodyPart))
+			}
+			if tc.path != "" {
+				var doc struct {
+					Paths map[string]interface{} `json:"paths"`
+				}
+				assert.NoError(t, json.Unmarshal([]byte(body), &doc))
+				assert.Contains(t, doc.Paths, tc.path)
+				if tc.notPath != "" {
+					assert.NotContains(t, doc.Paths, tc.notPath)
+				}
+			}
+		})
+	}
+}
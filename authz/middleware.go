@@ -18,8 +18,10 @@ import (
 	"strings"
 
 	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/requestid"
 	"github.com/mendersoftware/go-lib-micro/requestlog"
-	"github.com/mendersoftware/go-lib-micro/rest_utils"
+	"github.com/pkg/errors"
 
 	"github.com/mendersoftware/useradm/jwt"
 )
@@ -27,6 +29,19 @@ import (
 const (
 	// token's key in request.Env
 	ReqToken = "authz_token"
+	// key in request.Env of the reason the token was rejected for,
+	// e.g. jwt.ErrTokenNotValidYet
+	ReqTokenError = "authz_token_error"
+)
+
+var (
+	// machine-readable codes of the authorization errors, consistent
+	// with the ones returned by the API handlers
+	errorCodes = map[error]string{
+		ErrAuthzNoAuthHeader: "invalid_auth_header",
+		ErrAuthzTokenInvalid: "token_invalid",
+		ErrAuthzUnauthorized: "forbidden",
+	}
 )
 
 // AuthzMiddleware checks the authorization on a given request.
@@ -54,14 +69,19 @@ func (mw *AuthzMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
 		//get token, no token header = http 401
 		tokstr := extractToken(r.Header)
 		if tokstr == "" {
-			rest_utils.RestErrWithLog(w, r, l, ErrAuthzNoAuthHeader, http.StatusUnauthorized)
+			restErr(w, r, l, ErrAuthzNoAuthHeader, http.StatusUnauthorized)
 			return
 		}
 
 		// parse token, insert into env
-		token, err := mw.JWTHandler.FromJWT(tokstr)
+		token, err := jwt.FromJWT(r.Context(), mw.JWTHandler, tokstr)
 		if err != nil {
-			rest_utils.RestErrWithLog(w, r, l, ErrAuthzTokenInvalid, http.StatusUnauthorized)
+			// the reason is logged, so that the clocks drifting apart
+			// can be told from the tokens actually expired or forged
+			r.Env[ReqTokenError] = err
+			writeErr(w, r, l, errors.Wrap(err, ErrAuthzTokenInvalid.Error()),
+				http.StatusUnauthorized, ErrAuthzTokenInvalid.Error(),
+				errorCodes[ErrAuthzTokenInvalid])
 			return
 		}
 
@@ -70,7 +90,7 @@ func (mw *AuthzMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
 		// extract resource action
 		action, err := mw.ResFunc(r)
 		if err != nil {
-			rest_utils.RestErrWithLogInternal(w, r, l, err)
+			restErrInternal(w, r, l, err)
 			return
 		}
 
@@ -80,13 +100,13 @@ func (mw *AuthzMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
 		err = mw.Authz.Authorize(ctx, token, action.Resource, action.Method)
 		if err != nil {
 			if err == ErrAuthzUnauthorized {
-				rest_utils.RestErrWithLog(w, r, l,
+				restErr(w, r, l,
 					ErrAuthzUnauthorized, http.StatusForbidden)
 			} else if err == ErrAuthzTokenInvalid {
-				rest_utils.RestErrWithLog(w, r, l,
+				restErr(w, r, l,
 					ErrAuthzTokenInvalid, http.StatusUnauthorized)
 			} else {
-				rest_utils.RestErrWithLogInternal(w, r, l, err)
+				restErrInternal(w, r, l, err)
 			}
 			return
 		}
@@ -95,6 +115,33 @@ func (mw *AuthzMiddleware) MiddlewareFunc(h rest.HandlerFunc) rest.HandlerFunc {
 	}
 }
 
+// restErr writes an error response with the error's code, see
+// rest_utils.RestErrWithLog
+func restErr(w rest.ResponseWriter, r *rest.Request, l *log.Logger, e error, status int) {
+	writeErr(w, r, l, e, status, e.Error(), errorCodes[e])
+}
+
+func restErrInternal(w rest.ResponseWriter, r *rest.Request, l *log.Logger, e error) {
+	const msg = "internal error"
+	writeErr(w, r, l, errors.Wrap(e, msg), http.StatusInternalServerError,
+		msg, "internal_error")
+}
+
+func writeErr(w rest.ResponseWriter, r *rest.Request, l *log.Logger, e error,
+	status int, msg, code string) {
+	w.WriteHeader(status)
+	err := w.WriteJson(map[string]string{
+		rest.ErrorFieldName: msg,
+		"code":              code,
+		"request_id":        requestid.GetReqId(r),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	l.F(log.Ctx{}).Error(e.Error())
+}
+
 // extracts JWT from authorization header
 func extractToken(header http.Header) string {
 	const authHeaderName = "Authorization"
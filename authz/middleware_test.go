@@ -93,7 +93,7 @@ func TestAuthzMiddleware(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusUnauthorized,
 				nil,
-				restError("missing or invalid auth header"),
+				restError("missing or invalid auth header", "invalid_auth_header"),
 			),
 		},
 
@@ -122,7 +122,7 @@ func TestAuthzMiddleware(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusInternalServerError,
 				nil,
-				restError("internal error"),
+				restError("internal error", "internal_error"),
 			),
 		},
 		"error: invalid token": {
@@ -138,7 +138,7 @@ func TestAuthzMiddleware(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusUnauthorized,
 				nil,
-				restError("invalid jwt"),
+				restError("invalid jwt", "token_invalid"),
 			),
 		},
 		"error: unauthorized token": {
@@ -166,7 +166,7 @@ func TestAuthzMiddleware(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusForbidden,
 				nil,
-				restError("unauthorized"),
+				restError("unauthorized", "forbidden"),
 			),
 		},
 		"error: authorizer internal error": {
@@ -194,7 +194,7 @@ func TestAuthzMiddleware(t *testing.T) {
 			checker: mt.NewJSONResponse(
 				http.StatusInternalServerError,
 				nil,
-				restError("internal error"),
+				restError("internal error", "internal_error"),
 			),
 		},
 	}
@@ -272,8 +272,8 @@ func makeReq(method, url, auth string, body interface{}) *http.Request {
 	return req
 }
 
-func restError(status string) map[string]interface{} {
-	return map[string]interface{}{"error": status, "request_id": "test"}
+func restError(status, code string) map[string]interface{} {
+	return map[string]interface{}{"error": status, "code": code, "request_id": "test"}
 }
 
 func loadPrivKey(path string, t *testing.T) *rsa.PrivateKey {
@@ -15,6 +15,8 @@ package main
 
 import (
 	"context"
+	"net/http"
+	"strings"
 
 	"github.com/mendersoftware/useradm/authz"
 	"github.com/mendersoftware/useradm/jwt"
@@ -29,6 +31,19 @@ const (
 	ResourceInitialUser = ServiceName + ":users:initial"
 )
 
+// scopeResources lists the resources which may be accessed with the scopes
+// other than the full permissions, by the resource prefix; the resources
+// are the paths of the management API following the version, e.g.
+// "useradm:users:<id>"
+var scopeResources = []struct {
+	prefix      string
+	read, write string
+}{
+	{ServiceName + ":users", scope.UsersRead, scope.UsersWrite},
+	{ServiceName + ":groups", scope.UsersRead, scope.UsersWrite},
+	{ServiceName + ":settings", scope.SettingsRead, scope.SettingsWrite},
+}
+
 // SimpleAuthz is a trivial authorizer, mostly ensuring
 // proper permission check for the 'create initial user' case.
 type SimpleAuthz struct {
@@ -43,9 +58,31 @@ func (sa *SimpleAuthz) Authorize(_ context.Context, token *jwt.Token, resource,
 	tokenScope := token.Claims.Scope
 
 	// allow all actions on all services for 'mender.*'
-	if tokenScope == scope.All {
+	if scope.Allows(tokenScope, scope.All) {
+		return nil
+	}
+
+	required := requiredScope(resource, action)
+	if required != "" && scope.Allows(tokenScope, required) {
 		return nil
 	}
 
 	return authz.ErrAuthzUnauthorized
 }
+
+// requiredScope returns the scope required for the action on the resource,
+// or "" if only the full permissions allow it
+func requiredScope(resource, action string) string {
+	for _, r := range scopeResources {
+		if resource != r.prefix && !strings.HasPrefix(resource, r.prefix+":") {
+			continue
+		}
+		switch action {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return r.read
+		default:
+			return r.write
+		}
+	}
+	return ""
+}
@@ -59,6 +59,107 @@ func TestSimpleAuthzAuthorize(t *testing.T) {
 				},
 			},
 		},
+		"ok - read scope": {
+			inResource: "useradm:users:1234",
+			inAction:   "GET",
+			inToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Issuer:    "mender",
+					ExpiresAt: 2147483647,
+					Subject:   "testsubject",
+					Scope:     scope.UsersRead,
+				},
+			},
+		},
+		"ok - write scope allows reads": {
+			inResource: "useradm:groups",
+			inAction:   "GET",
+			inToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Issuer:    "mender",
+					ExpiresAt: 2147483647,
+					Subject:   "testsubject",
+					Scope:     scope.UsersWrite,
+				},
+			},
+		},
+		"ok - one of many scopes": {
+			inResource: "useradm:settings",
+			inAction:   "POST",
+			inToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Issuer:    "mender",
+					ExpiresAt: 2147483647,
+					Subject:   "testsubject",
+					Scope:     scope.UsersRead + " " + scope.SettingsWrite,
+				},
+			},
+		},
+		"error: read scope, write action": {
+			inResource: "useradm:users:1234",
+			inAction:   "PUT",
+			inToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Issuer:    "mender",
+					ExpiresAt: 2147483647,
+					Subject:   "testsubject",
+					Scope:     scope.UsersRead,
+				},
+			},
+			outErr: "unauthorized",
+		},
+		"error: scope of other resource": {
+			inResource: "useradm:settings",
+			inAction:   "GET",
+			inToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Issuer:    "mender",
+					ExpiresAt: 2147483647,
+					Subject:   "testsubject",
+					Scope:     scope.UsersWrite,
+				},
+			},
+			outErr: "unauthorized",
+		},
+		"error: prefix of other resource": {
+			inResource: "useradm:usersfoo",
+			inAction:   "GET",
+			inToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Issuer:    "mender",
+					ExpiresAt: 2147483647,
+					Subject:   "testsubject",
+					Scope:     scope.UsersRead,
+				},
+			},
+			outErr: "unauthorized",
+		},
+		"error: scoped token, other service": {
+			inResource: "otherservice:users",
+			inAction:   "GET",
+			inToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Issuer:    "mender",
+					ExpiresAt: 2147483647,
+					Subject:   "testsubject",
+					Scope:     scope.UsersRead,
+				},
+			},
+			outErr: "unauthorized",
+		},
+		"error: erasure receipt": {
+			inResource: "useradm:users:1234",
+			inAction:   "GET",
+			inToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Issuer:    "mender",
+					ExpiresAt: 2147483647,
+					Subject:   "testsubject",
+					Scope:     scope.UserErasure,
+				},
+			},
+			outErr: "unauthorized",
+		},
 		"error: unknown/incompatible scope": {
 			inResource: "useradm:some:resource:id",
 			inAction:   "POST",
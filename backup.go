@@ -0,0 +1,356 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	useradm "github.com/mendersoftware/useradm/user"
+)
+
+const (
+	// version of the backup format, bumped on incompatible changes
+	backupVersion = 1
+)
+
+// backupData is the format of the backup command's output, a JSON document:
+//
+//	{
+//	  "version": 1,
+//	  "created_ts": "2018-10-15T10:00:00Z",
+//	  "tenants": [
+//	    {
+//	      "id": "",                  // empty for the default tenant
+//	      "users": [
+//	        {
+//	          ...                    // the user as in the management API
+//	          "groups": ["<group id>"],
+//	          "password_hash": "...", // only with --with-password-hashes
+//	          "settings": {...}       // the user's own settings
+//	        }
+//	      ],
+//	      "groups": [{"id": "...", "name": "...", ...}],
+//	      "settings": {...},
+//	      "settings_schema": "..."
+//	    }
+//	  ]
+//	}
+type backupData struct {
+	Version   int            `json:"version"`
+	CreatedTs time.Time      `json:"created_ts"`
+	Tenants   []tenantBackup `json:"tenants"`
+}
+
+type tenantBackup struct {
+	ID             string                 `json:"id"`
+	Users          []userBackup           `json:"users"`
+	Groups         []model.Group          `json:"groups"`
+	Settings       map[string]interface{} `json:"settings,omitempty"`
+	SettingsSchema string                 `json:"settings_schema,omitempty"`
+}
+
+type userBackup struct {
+	model.User
+	PasswordHash string                 `json:"password_hash,omitempty"`
+	Settings     map[string]interface{} `json:"settings,omitempty"`
+}
+
+// tenantLister is implemented by the stores which can list the tenants
+type tenantLister interface {
+	GetTenantIDs(ctx context.Context) ([]string, error)
+}
+
+// backupOptions are the options of the backup and restore commands
+type backupOptions struct {
+	// tenant to back up or restore to, the default one if empty
+	tenantId   string
+	allTenants bool
+
+	withPasswordHashes bool
+}
+
+func commandBackup(c config.Reader, w io.Writer, opts backupOptions) error {
+	db, _, err := dataStoreFromAppConfig(c)
+	if err != nil {
+		return errors.Wrap(err, "database connection failed")
+	}
+
+	tenants := []string{opts.tenantId}
+	if opts.allTenants {
+		lister, ok := db.(tenantLister)
+		if !ok {
+			return errors.New("backing up all tenants requires the mongo backend")
+		}
+		ids, err := lister.GetTenantIDs(context.Background())
+		if err != nil {
+			return err
+		}
+		tenants = append([]string{""}, ids...)
+	}
+
+	backup := backupData{
+		Version:   backupVersion,
+		CreatedTs: time.Now().UTC(),
+	}
+	for _, tenantId := range tenants {
+		t, err := backupTenant(getTenantContext(tenantId), db, opts.withPasswordHashes)
+		if err != nil {
+			return errors.Wrapf(err, "failed to back up %s", tenantName(tenantId))
+		}
+		t.ID = tenantId
+		backup.Tenants = append(backup.Tenants, *t)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(backup)
+}
+
+func backupTenant(ctx context.Context, db store.DataStore, withPasswordHashes bool) (*tenantBackup, error) {
+	var err error
+	t := &tenantBackup{}
+
+	users, err := db.GetUsers(ctx, model.UserFilter{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get users")
+	}
+	for _, u := range users {
+		bu := userBackup{User: u}
+		bu.Password = ""
+
+		if withPasswordHashes {
+			// only the lookup by email, done at login, returns the hash
+			withHash, err := db.GetUserByEmail(ctx, u.Email)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get password of user %s", u.ID)
+			}
+			if withHash != nil {
+				bu.PasswordHash = withHash.Password
+			}
+		}
+
+		if bu.Settings, err = db.GetUserSettings(ctx, u.ID); err != nil {
+			return nil, errors.Wrapf(err, "failed to get settings of user %s", u.ID)
+		}
+		dropReadOnlySettings(bu.Settings)
+
+		t.Users = append(t.Users, bu)
+	}
+
+	if t.Groups, err = db.GetGroups(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to get groups")
+	}
+	if t.Settings, err = db.GetSettings(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to get settings")
+	}
+	dropReadOnlySettings(t.Settings)
+	if t.SettingsSchema, err = db.GetSettingsSchema(ctx); err != nil {
+		return nil, errors.Wrap(err, "failed to get settings schema")
+	}
+
+	return t, nil
+}
+
+// dropReadOnlySettings removes the keys the store sets on saving
+func dropReadOnlySettings(settings map[string]interface{}) {
+	for _, k := range useradm.ReadOnlySettings {
+		delete(settings, k)
+	}
+}
+
+// commandRestore imports the backup into empty tenants, or completes a
+// restore which failed; users are restored in the database only, tenantadm
+// has to be restored on its own
+func commandRestore(c config.Reader, r io.Reader, opts backupOptions) error {
+	backup := backupData{}
+	if err := json.NewDecoder(r).Decode(&backup); err != nil {
+		return errors.Wrap(err, "failed to parse backup")
+	}
+	if backup.Version != backupVersion {
+		return errors.Errorf("unsupported backup version %d", backup.Version)
+	}
+
+	if opts.tenantId != "" {
+		// restoring to another tenant clones it
+		if len(backup.Tenants) != 1 {
+			return errors.Errorf("the backup has %d tenants, "+
+				"only a single one can be restored to another tenant",
+				len(backup.Tenants))
+		}
+		backup.Tenants[0].ID = opts.tenantId
+	}
+
+	db, tenantKeeper, err := dataStoreFromAppConfig(c)
+	if err != nil {
+		return errors.Wrap(err, "database connection failed")
+	}
+
+	for _, t := range backup.Tenants {
+		ctx := getTenantContext(t.ID)
+
+		if t.ID != "" {
+			if err := tenantKeeper.MigrateTenant(ctx, t.ID); err != nil {
+				return errors.Wrapf(err, "failed to apply migrations for tenant %v", t.ID)
+			}
+		}
+
+		if err := restoreTenant(ctx, db, &t); err != nil {
+			return errors.Wrapf(err, "failed to restore %s", tenantName(t.ID))
+		}
+	}
+
+	return nil
+}
+
+// restoreTenant imports the backup into a tenant without users or groups
+// other than the backup's; what's there already is skipped, so that
+// a restore which failed midway can be run again
+func restoreTenant(ctx context.Context, db store.DataStore, t *tenantBackup) error {
+	users, err := db.GetUsers(ctx, model.UserFilter{})
+	if err != nil {
+		return errors.Wrap(err, "failed to get users")
+	}
+	groups, err := db.GetGroups(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to get groups")
+	}
+
+	existingUsers := map[string]*model.User{}
+	for i := range users {
+		existingUsers[users[i].ID] = &users[i]
+	}
+	existingGroups := map[string]bool{}
+	for _, g := range groups {
+		existingGroups[g.ID] = true
+	}
+	if !backupHasUsers(t, existingUsers) || !backupHasGroups(t, existingGroups) {
+		return errors.New("the tenant has users or groups already")
+	}
+
+	for i := range t.Groups {
+		if existingGroups[t.Groups[i].ID] {
+			continue
+		}
+		if err := db.CreateGroup(ctx, &t.Groups[i]); err != nil {
+			return errors.Wrapf(err, "failed to create group %s", t.Groups[i].Name)
+		}
+	}
+
+	for _, bu := range t.Users {
+		u, ok := existingUsers[bu.ID]
+		if !ok {
+			created := bu.User
+			// users without a hash have to get their passwords set
+			created.Password = bu.PasswordHash
+			if err := db.CreateUser(ctx, &created); err != nil {
+				return errors.Wrapf(err, "failed to create user %s", created.ID)
+			}
+			u = &created
+		}
+
+		// the store sets these apart from the user
+		for _, groupID := range bu.Groups {
+			if hasString(u.Groups, groupID) {
+				continue
+			}
+			if err := db.AddUserToGroup(ctx, u.ID, groupID); err != nil {
+				return errors.Wrapf(err, "failed to add user %s to group %s",
+					u.ID, groupID)
+			}
+		}
+		for _, e := range bu.Emails {
+			existing := userEmail(u, e.Email)
+			if existing == nil {
+				email := e
+				if err := db.AddUserEmail(ctx, u.ID, &email); err != nil {
+					return errors.Wrapf(err, "failed to add email of user %s", u.ID)
+				}
+			}
+			if e.Verified && (existing == nil || !existing.Verified) {
+				if err := db.VerifyUserEmail(ctx, u.ID, e.Email); err != nil {
+					return errors.Wrapf(err, "failed to verify email of user %s", u.ID)
+				}
+			}
+		}
+
+		if len(bu.Settings) > 0 {
+			if err := db.SaveUserSettings(ctx, u.ID, bu.Settings); err != nil {
+				return errors.Wrapf(err, "failed to restore settings of user %s", u.ID)
+			}
+		}
+	}
+
+	if t.SettingsSchema != "" {
+		if err := db.SaveSettingsSchema(ctx, t.SettingsSchema); err != nil {
+			return errors.Wrap(err, "failed to restore settings schema")
+		}
+	}
+	if len(t.Settings) > 0 {
+		if _, err := db.SaveSettings(ctx, t.Settings, nil); err != nil {
+			return errors.Wrap(err, "failed to restore settings")
+		}
+	}
+
+	return nil
+}
+
+// backupHasUsers tells if all the users are in the backup
+func backupHasUsers(t *tenantBackup, users map[string]*model.User) bool {
+	n := 0
+	for _, bu := range t.Users {
+		if _, ok := users[bu.ID]; ok {
+			n++
+		}
+	}
+	return n == len(users)
+}
+
+// backupHasGroups tells if all the groups are in the backup
+func backupHasGroups(t *tenantBackup, groups map[string]bool) bool {
+	n := 0
+	for _, g := range t.Groups {
+		if groups[g.ID] {
+			n++
+		}
+	}
+	return n == len(groups)
+}
+
+func hasString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// userEmail returns the user's additional email address, nil if the
+// user has no such address
+func userEmail(u *model.User, email string) *model.UserEmail {
+	for i := range u.Emails {
+		if u.Emails[i].Email == email {
+			return &u.Emails[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store/memory"
+)
+
+func TestBackupRestoreTenant(t *testing.T) {
+	ctx := context.Background()
+
+	src := memory.NewDataStoreMemory()
+	assert.NoError(t, src.CreateGroup(ctx, &model.Group{ID: "g1", Name: "admins"}))
+	assert.NoError(t, src.CreateUser(ctx, &model.User{
+		ID:       "u1",
+		Email:    "foo@bar.com",
+		Password: "$2a$10$hash",
+	}))
+	assert.NoError(t, src.AddUserToGroup(ctx, "u1", "g1"))
+	assert.NoError(t, src.AddUserEmail(ctx, "u1", &model.UserEmail{Email: "foo@baz.com"}))
+	assert.NoError(t, src.VerifyUserEmail(ctx, "u1", "foo@baz.com"))
+	assert.NoError(t, src.SaveUserSettings(ctx, "u1", map[string]interface{}{"theme": "dark"}))
+	_, err := src.SaveSettings(ctx, map[string]interface{}{"foo": "bar"}, nil)
+	assert.NoError(t, err)
+
+	for _, withHashes := range []bool{true, false} {
+		t.Logf("with password hashes: %v", withHashes)
+
+		backup, err := backupTenant(ctx, src, withHashes)
+		assert.NoError(t, err)
+
+		// round trip through the documented format
+		raw, err := json.Marshal(backup)
+		assert.NoError(t, err)
+		assert.Equal(t, withHashes, strings.Contains(string(raw), "$2a$10$hash"))
+		decoded := &tenantBackup{}
+		assert.NoError(t, json.Unmarshal(raw, decoded))
+		assert.Equal(t, map[string]interface{}{"foo": "bar"}, decoded.Settings)
+		if assert.Len(t, decoded.Users, 1) {
+			assert.Equal(t, map[string]interface{}{"theme": "dark"},
+				decoded.Users[0].Settings)
+		}
+
+		dst := memory.NewDataStoreMemory()
+		assert.NoError(t, restoreTenant(ctx, dst, decoded))
+
+		user, err := dst.GetUserByEmail(ctx, "foo@bar.com")
+		assert.NoError(t, err)
+		if assert.NotNil(t, user) {
+			assert.Equal(t, "u1", user.ID)
+			assert.Equal(t, []string{"g1"}, user.Groups)
+			if assert.Len(t, user.Emails, 1) {
+				assert.Equal(t, "foo@baz.com", user.Emails[0].Email)
+				assert.True(t, user.Emails[0].Verified)
+			}
+			if withHashes {
+				assert.Equal(t, "$2a$10$hash", user.Password)
+			} else {
+				assert.Empty(t, user.Password)
+			}
+		}
+
+		group, err := dst.GetGroupById(ctx, "g1")
+		assert.NoError(t, err)
+		assert.Equal(t, "admins", group.Name)
+
+		userSettings, err := dst.GetUserSettings(ctx, "u1")
+		assert.NoError(t, err)
+		assert.Equal(t, "dark", userSettings["theme"])
+
+		settings, err := dst.GetSettings(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, "bar", settings["foo"])
+
+		// running the restore again changes nothing
+		assert.NoError(t, restoreTenant(ctx, dst, decoded))
+		user, err = dst.GetUserByEmail(ctx, "foo@bar.com")
+		assert.NoError(t, err)
+		if assert.NotNil(t, user) {
+			assert.Equal(t, []string{"g1"}, user.Groups)
+			assert.Len(t, user.Emails, 1)
+		}
+
+		// restoring over other data is refused
+		assert.NoError(t, dst.CreateUser(ctx, &model.User{
+			ID:    "u2",
+			Email: "bar@bar.com",
+		}))
+		assert.EqualError(t, restoreTenant(ctx, dst, decoded),
+			"the tenant has users or groups already")
+	}
+}
+
+func TestRestoreTenantResume(t *testing.T) {
+	ctx := context.Background()
+
+	backup := &tenantBackup{
+		Groups: []model.Group{{ID: "g1", Name: "admins"}},
+		Users: []userBackup{
+			{
+				User: model.User{
+					ID:     "u1",
+					Email:  "foo@bar.com",
+					Groups: []string{"g1"},
+					Emails: []model.UserEmail{
+						{Email: "foo@baz.com", Verified: true},
+					},
+				},
+			},
+			{
+				User: model.User{ID: "u2", Email: "bar@bar.com"},
+			},
+		},
+		Settings: map[string]interface{}{"foo": "bar"},
+	}
+
+	// the first restore stopped after adding the email of u1
+	dst := memory.NewDataStoreMemory()
+	assert.NoError(t, dst.CreateGroup(ctx, &model.Group{ID: "g1", Name: "admins"}))
+	assert.NoError(t, dst.CreateUser(ctx, &model.User{ID: "u1", Email: "foo@bar.com"}))
+	assert.NoError(t, dst.AddUserToGroup(ctx, "u1", "g1"))
+	assert.NoError(t, dst.AddUserEmail(ctx, "u1", &model.UserEmail{Email: "foo@baz.com"}))
+
+	assert.NoError(t, restoreTenant(ctx, dst, backup))
+
+	user, err := dst.GetUserById(ctx, "u1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, user) {
+		assert.Equal(t, []string{"g1"}, user.Groups)
+		if assert.Len(t, user.Emails, 1) {
+			assert.True(t, user.Emails[0].Verified)
+		}
+	}
+
+	user, err = dst.GetUserById(ctx, "u2")
+	assert.NoError(t, err)
+	assert.NotNil(t, user)
+
+	settings, err := dst.GetSettings(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", settings["foo"])
+}
+
+func TestCommandRestore(t *testing.T) {
+	testCases := map[string]struct {
+		backup   string
+		tenantId string
+
+		err string
+	}{
+		"error: invalid": {
+			backup: "foo",
+			err:    "failed to parse backup: invalid character 'o' in literal false (expecting 'a')",
+		},
+		"error: version": {
+			backup: `{"version": 2}`,
+			err:    "unsupported backup version 2",
+		},
+		"error: clone of many tenants": {
+			backup:   `{"version": 1, "tenants": [{"id": "foo"}, {"id": "bar"}]}`,
+			tenantId: "baz",
+			err: "the backup has 2 tenants, " +
+				"only a single one can be restored to another tenant",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		err := commandRestore(nil, bytes.NewBufferString(tc.backup),
+			backupOptions{tenantId: tc.tenantId})
+		assert.EqualError(t, err, tc.err)
+	}
+}
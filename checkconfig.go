@@ -0,0 +1,252 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/pkg/errors"
+
+	api_http "github.com/mendersoftware/useradm/api/http"
+	"github.com/mendersoftware/useradm/keys"
+	"github.com/mendersoftware/useradm/schema"
+	"github.com/mendersoftware/useradm/store/mongo"
+	useradm "github.com/mendersoftware/useradm/user"
+)
+
+// configCheck is a single step of check-config; it returns an error
+// telling the operator which setting to fix
+type configCheck struct {
+	name  string
+	check func(c config.Reader) error
+}
+
+var configChecks = []configCheck{
+	{"middleware", checkMiddleware},
+	{"CORS", checkCORS},
+	{"private key", checkPrivateKey},
+	{"token format", checkTokenFormat},
+	{"token lifetimes", checkTokenLifetimes},
+	{"mail", checkMail},
+	{"TLS", checkTLS},
+	{"settings schema", checkSettingsSchema},
+	{"PII encryption keyring", checkKeyring},
+	{"database", checkDatabase},
+	{"tenantadm", checkTenantAdm},
+}
+
+// commandCheckConfig runs all the configuration checks, reporting the outcome
+// of each one, and fails if any of them did
+func commandCheckConfig(c config.Reader, w io.Writer) error {
+	failed := 0
+	for _, cc := range configChecks {
+		if err := cc.check(c); err != nil {
+			failed++
+			fmt.Fprintf(w, "FAIL  %s: %v\n", cc.name, err)
+			continue
+		}
+		fmt.Fprintf(w, "ok    %s\n", cc.name)
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d of %d configuration checks failed",
+			failed, len(configChecks))
+	}
+	return nil
+}
+
+// settingHint names the setting along with the environment variable
+// overriding it
+func settingHint(setting string) string {
+	return fmt.Sprintf("%s (USERADM_%s)", setting, strings.ToUpper(setting))
+}
+
+func checkMiddleware(c config.Reader) error {
+	switch mw := c.GetString(SettingMiddleware); mw {
+	case EnvProd, EnvDev:
+	default:
+		return errors.Errorf("unknown middleware %q, set %s to %q or %q",
+			mw, settingHint(SettingMiddleware), EnvProd, EnvDev)
+	}
+
+	if _, err := api_http.ParseTrustedProxies(c.GetStringSlice(SettingTrustedProxies)); err != nil {
+		return errors.Wrapf(err, "check %s", settingHint(SettingTrustedProxies))
+	}
+
+	if _, err := newAccessLogMiddleware(accessLogConfigFromAppConfig(c)); err != nil {
+		return errors.Wrapf(err, "check %s, %s and %s",
+			settingHint(SettingAccessLogFormat), settingHint(SettingAccessLogFields),
+			settingHint(SettingAccessLogVerifySampleRate))
+	}
+	return nil
+}
+
+// checkCORS rejects credentials allowed in requests from any origin,
+// which browsers refuse anyway
+func checkCORS(c config.Reader) error {
+	if !c.GetBool(SettingCORSAllowCredentials) {
+		return nil
+	}
+	for _, o := range c.GetStringSlice(SettingCORSAllowedOrigins) {
+		if o == "*" {
+			return errors.Errorf("%s requires %s to list the origins, not %q",
+				settingHint(SettingCORSAllowCredentials),
+				settingHint(SettingCORSAllowedOrigins), o)
+		}
+	}
+	return nil
+}
+
+func checkPrivateKey(c config.Reader) error {
+	path := c.GetString(SettingPrivKeyPath)
+	if _, err := keys.LoadRSAPrivate(path); err != nil {
+		return errors.Wrapf(err, "failed to load %s, point %s to a PEM encoded RSA key",
+			path, settingHint(SettingPrivKeyPath))
+	}
+	return nil
+}
+
+func checkTokenFormat(c config.Reader) error {
+	switch format := c.GetString(SettingTokenFormat); format {
+	case useradm.TokenFormatJWT:
+		if c.GetBool(SettingTokenFormatRejectJWT) {
+			return errors.Errorf("%s requires %s to be %q",
+				settingHint(SettingTokenFormatRejectJWT),
+				settingHint(SettingTokenFormat), useradm.TokenFormatOpaque)
+		}
+		return nil
+	case useradm.TokenFormatOpaque:
+		return nil
+	default:
+		return errors.Errorf("unknown token format %q, set %s to %q or %q",
+			format, settingHint(SettingTokenFormat),
+			useradm.TokenFormatJWT, useradm.TokenFormatOpaque)
+	}
+}
+
+// checkTokenLifetimes rejects lifetimes the tokens would be issued
+// expired with
+func checkTokenLifetimes(c config.Reader) error {
+	for _, setting := range tokenLifetimeSettings {
+		if t := c.GetInt(setting); t <= 0 {
+			return errors.Errorf("invalid token lifetime %d, set %s to a number "+
+				"of seconds greater than 0", t, settingHint(setting))
+		}
+	}
+	return nil
+}
+
+// checkMail rejects the features mailing the users enabled without
+// the SMTP server to send the mails with
+func checkMail(c config.Reader) error {
+	if c.GetBool(SettingAdditionalEmails) && c.GetString(SettingSMTPAddress) == "" {
+		return errors.Errorf("%s requires %s to be set",
+			settingHint(SettingAdditionalEmails), settingHint(SettingSMTPAddress))
+	}
+	return nil
+}
+
+func checkTLS(c config.Reader) error {
+	tlsConfig, _, err := tlsConfigFromAppConfig(c)
+	if err != nil {
+		return errors.Wrapf(err, "check %s, %s, %s and %s",
+			settingHint(SettingTLSCertPath), settingHint(SettingTLSKeyPath),
+			settingHint(SettingTLSMinVersion), settingHint(SettingTLSCipherSuites))
+	}
+
+	if c.GetString(SettingListenInternal) == "" {
+		if c.GetString(SettingInternalTLSClientCAPath) != "" {
+			return errors.Errorf("%s requires %s to be set",
+				settingHint(SettingInternalTLSClientCAPath),
+				settingHint(SettingListenInternal))
+		}
+		return nil
+	}
+
+	if _, err := internalTLSConfigFromAppConfig(c, tlsConfig); err != nil {
+		return errors.Wrapf(err, "check %s",
+			settingHint(SettingInternalTLSClientCAPath))
+	}
+	return nil
+}
+
+func checkSettingsSchema(c config.Reader) error {
+	path := c.GetString(SettingSettingsSchemaPath)
+	if path == "" {
+		return nil
+	}
+	if _, err := schema.Load(path); err != nil {
+		return errors.Wrapf(err, "check %s", settingHint(SettingSettingsSchemaPath))
+	}
+	return nil
+}
+
+func checkKeyring(c config.Reader) error {
+	path := c.GetString(SettingPIIEncryptionKeyringPath)
+	if path == "" {
+		return nil
+	}
+	if _, err := keys.LoadKeyring(path); err != nil {
+		return errors.Wrapf(err, "check %s", settingHint(SettingPIIEncryptionKeyringPath))
+	}
+	return nil
+}
+
+func checkDatabase(c config.Reader) error {
+	switch backend := c.GetString(SettingDbBackend); backend {
+	case DbBackendMemory:
+		return nil
+	case DbBackendMongo:
+	default:
+		return errors.Errorf("unknown backend %q, set %s to %q or %q",
+			backend, settingHint(SettingDbBackend), DbBackendMongo, DbBackendMemory)
+	}
+
+	switch mode := c.GetString(SettingDbIndexMode); mode {
+	case mongo.IndexModeCreate, mongo.IndexModeBackground,
+		mongo.IndexModeCheck, mongo.IndexModeSkip:
+	default:
+		return errors.Errorf("unknown index mode %q, set %s to one of: %s",
+			mode, settingHint(SettingDbIndexMode), strings.Join([]string{
+				mongo.IndexModeCreate, mongo.IndexModeBackground,
+				mongo.IndexModeCheck, mongo.IndexModeSkip}, ", "))
+	}
+
+	if _, err := mongo.NewDataStoreMongo(dataStoreMongoConfigFromAppConfig(c)); err != nil {
+		return errors.Wrapf(err, "failed to connect, check %s, the credentials "+
+			"and the SSL settings", settingHint(SettingDb))
+	}
+	return nil
+}
+
+func checkTenantAdm(c config.Reader) error {
+	verifier, err := tenantVerifierFromAppConfig(c)
+	if err != nil {
+		return errors.Wrapf(err, "check %s", settingHint(SettingTenantVerification))
+	}
+	if tenantVerification(c) != TenantVerificationTenantAdm {
+		return nil
+	}
+
+	addr := c.GetString(SettingTenantAdmAddr)
+	if err := verifier.CheckHealth(context.Background()); err != nil {
+		return errors.Wrapf(err, "tenantadm at %s is not reachable, check %s",
+			addr, settingHint(SettingTenantAdmAddr))
+	}
+	return nil
+}
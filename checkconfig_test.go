@@ -0,0 +1,224 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	cmocks "github.com/mendersoftware/go-lib-micro/config/mocks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckMiddleware(t *testing.T) {
+	testCases := map[string]struct {
+		mw         string
+		format     string
+		fields     []string
+		sampleRate float64
+		proxies    []string
+
+		err string
+	}{
+		"ok": {
+			mw:         EnvProd,
+			format:     AccessLogFormatSimple,
+			sampleRate: 1,
+		},
+		"ok, json access log": {
+			mw:         EnvProd,
+			format:     AccessLogFormatJSON,
+			fields:     []string{"method", "path", "status"},
+			sampleRate: 0.1,
+		},
+		"error: unknown": {
+			mw: "foo",
+			err: `unknown middleware "foo", set middleware (USERADM_MIDDLEWARE) ` +
+				`to "prod" or "dev"`,
+		},
+		"ok, trusted proxies": {
+			mw:         EnvProd,
+			format:     AccessLogFormatSimple,
+			sampleRate: 1,
+			proxies:    []string{"10.0.0.0/8", "192.168.1.1"},
+		},
+		"error: trusted proxies": {
+			mw:      EnvProd,
+			proxies: []string{"10.0.0.0/8", "foo"},
+			err: `check trusted_proxies (USERADM_TRUSTED_PROXIES): ` +
+				`invalid proxy address "foo"`,
+		},
+		"error: unknown access log field": {
+			mw:         EnvProd,
+			format:     AccessLogFormatJSON,
+			fields:     []string{"method", "foo"},
+			sampleRate: 1,
+			err: `check access_log_format (USERADM_ACCESS_LOG_FORMAT), ` +
+				`access_log_fields (USERADM_ACCESS_LOG_FIELDS) and ` +
+				`access_log_verify_sample_rate (USERADM_ACCESS_LOG_VERIFY_SAMPLE_RATE): ` +
+				`unknown access log field "foo"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		conf := &cmocks.Reader{}
+		conf.On("GetString", SettingMiddleware).Return(tc.mw)
+		conf.On("GetStringSlice", SettingTrustedProxies).Return(tc.proxies)
+		conf.On("GetString", SettingAccessLogFormat).Return(tc.format)
+		conf.On("GetStringSlice", SettingAccessLogFields).Return(tc.fields)
+		conf.On("GetFloat64", SettingAccessLogVerifySampleRate).Return(tc.sampleRate)
+
+		err := checkMiddleware(conf)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestCheckPrivateKey(t *testing.T) {
+	conf := &cmocks.Reader{}
+	conf.On("GetString", SettingPrivKeyPath).Return("crypto/private.pem")
+	assert.NoError(t, checkPrivateKey(conf))
+
+	conf = &cmocks.Reader{}
+	conf.On("GetString", SettingPrivKeyPath).Return("crypto/missing.pem")
+	err := checkPrivateKey(conf)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "USERADM_SERVER_PRIV_KEY_PATH")
+}
+
+func TestCheckTokenFormat(t *testing.T) {
+	conf := &cmocks.Reader{}
+	conf.On("GetString", SettingTokenFormat).Return("opaque")
+	assert.NoError(t, checkTokenFormat(conf))
+
+	conf = &cmocks.Reader{}
+	conf.On("GetString", SettingTokenFormat).Return("jwt")
+	conf.On("GetBool", SettingTokenFormatRejectJWT).Return(true)
+	assert.EqualError(t, checkTokenFormat(conf),
+		`token_format_reject_jwt (USERADM_TOKEN_FORMAT_REJECT_JWT) requires `+
+			`token_format (USERADM_TOKEN_FORMAT) to be "opaque"`)
+
+	conf = &cmocks.Reader{}
+	conf.On("GetString", SettingTokenFormat).Return("foo")
+	assert.EqualError(t, checkTokenFormat(conf),
+		`unknown token format "foo", set token_format (USERADM_TOKEN_FORMAT) `+
+			`to "jwt" or "opaque"`)
+}
+
+func TestCheckCORS(t *testing.T) {
+	conf := &cmocks.Reader{}
+	conf.On("GetBool", SettingCORSAllowCredentials).Return(false)
+	assert.NoError(t, checkCORS(conf))
+
+	conf = &cmocks.Reader{}
+	conf.On("GetBool", SettingCORSAllowCredentials).Return(true)
+	conf.On("GetStringSlice", SettingCORSAllowedOrigins).
+		Return([]string{"https://ui.example.com"})
+	assert.NoError(t, checkCORS(conf))
+
+	conf = &cmocks.Reader{}
+	conf.On("GetBool", SettingCORSAllowCredentials).Return(true)
+	conf.On("GetStringSlice", SettingCORSAllowedOrigins).
+		Return([]string{"https://ui.example.com", "*"})
+	assert.EqualError(t, checkCORS(conf),
+		`cors_allow_credentials (USERADM_CORS_ALLOW_CREDENTIALS) requires `+
+			`cors_allowed_origins (USERADM_CORS_ALLOWED_ORIGINS) to list the origins, not "*"`)
+}
+
+func TestCheckTokenLifetimes(t *testing.T) {
+	conf := &cmocks.Reader{}
+	for _, s := range tokenLifetimeSettings {
+		conf.On("GetInt", s).Return(3600)
+	}
+	assert.NoError(t, checkTokenLifetimes(conf))
+
+	conf = &cmocks.Reader{}
+	conf.On("GetInt", SettingJWTExpirationTimeout).Return(3600)
+	conf.On("GetInt", SettingImpersonationExpirationTimeout).Return(0)
+	assert.EqualError(t, checkTokenLifetimes(conf),
+		`invalid token lifetime 0, set impersonation_exp_timeout `+
+			`(USERADM_IMPERSONATION_EXP_TIMEOUT) to a number of seconds greater than 0`)
+}
+
+func TestCheckMail(t *testing.T) {
+	conf := &cmocks.Reader{}
+	conf.On("GetBool", SettingAdditionalEmails).Return(false)
+	assert.NoError(t, checkMail(conf))
+
+	conf = &cmocks.Reader{}
+	conf.On("GetBool", SettingAdditionalEmails).Return(true)
+	conf.On("GetString", SettingSMTPAddress).Return("smtp.example.com:587")
+	assert.NoError(t, checkMail(conf))
+
+	conf = &cmocks.Reader{}
+	conf.On("GetBool", SettingAdditionalEmails).Return(true)
+	conf.On("GetString", SettingSMTPAddress).Return("")
+	assert.EqualError(t, checkMail(conf),
+		`additional_emails (USERADM_ADDITIONAL_EMAILS) requires `+
+			`smtp_address (USERADM_SMTP_ADDRESS) to be set`)
+}
+
+func TestCheckDatabase(t *testing.T) {
+	conf := &cmocks.Reader{}
+	conf.On("GetString", SettingDbBackend).Return(DbBackendMemory)
+	assert.NoError(t, checkDatabase(conf))
+
+	conf = &cmocks.Reader{}
+	conf.On("GetString", SettingDbBackend).Return("foo")
+	assert.EqualError(t, checkDatabase(conf),
+		`unknown backend "foo", set db (USERADM_DB) to "mongo" or "memory"`)
+
+	conf = &cmocks.Reader{}
+	conf.On("GetString", SettingDbBackend).Return(DbBackendMongo)
+	conf.On("GetString", SettingDbIndexMode).Return("foo")
+	assert.EqualError(t, checkDatabase(conf),
+		`unknown index mode "foo", set mongo_index_mode (USERADM_MONGO_INDEX_MODE) `+
+			`to one of: create, background, check, skip`)
+}
+
+func TestCommandCheckConfig(t *testing.T) {
+	conf := &cmocks.Reader{}
+	conf.On("GetString", SettingMiddleware).Return("foo")
+	conf.On("GetBool", SettingCORSAllowCredentials).Return(false)
+	conf.On("GetString", SettingPrivKeyPath).Return("crypto/private.pem")
+	conf.On("GetString", SettingTokenFormat).Return("jwt")
+	conf.On("GetBool", SettingTokenFormatRejectJWT).Return(false)
+	conf.On("GetBool", SettingAdditionalEmails).Return(false)
+	for _, s := range tokenLifetimeSettings {
+		conf.On("GetInt", s).Return(3600)
+	}
+	conf.On("GetString", SettingTLSCertPath).Return("")
+	conf.On("GetString", SettingTLSKeyPath).Return("")
+	conf.On("GetString", SettingTLSMinVersion).Return("1.2")
+	conf.On("GetStringSlice", SettingTLSCipherSuites).Return([]string{})
+	conf.On("GetString", SettingListenInternal).Return("")
+	conf.On("GetString", SettingInternalTLSClientCAPath).Return("")
+	conf.On("GetString", SettingSettingsSchemaPath).Return("")
+	conf.On("GetString", SettingPIIEncryptionKeyringPath).Return("")
+	conf.On("GetString", SettingDbBackend).Return(DbBackendMemory)
+	conf.On("GetString", SettingTenantVerification).Return("")
+	conf.On("GetString", SettingTenantAdmAddr).Return("")
+
+	var out bytes.Buffer
+	err := commandCheckConfig(conf, &out)
+	assert.EqualError(t, err, "1 of 11 configuration checks failed")
+	assert.Contains(t, out.String(), "FAIL  middleware: ")
+	assert.Contains(t, out.String(), "ok    private key\n")
+	assert.Contains(t, out.String(), "ok    database\n")
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package billing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/apiclient"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+const (
+	// type of the event carrying the user counts
+	EventUserCounts = "user_counts"
+	// default request timeout, 10s
+	defaultReqTimeout = time.Duration(10) * time.Second
+)
+
+// UnexpectedStatusError is returned when the billing service responds
+// with a status other than 2xx
+type UnexpectedStatusError struct {
+	Status int
+}
+
+func (e *UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("POST user counts request failed with unexpected status %v",
+		e.Status)
+}
+
+// Config conveys client configuration
+type Config struct {
+	// URL the events are posted to
+	URL string
+	// request timeout
+	Timeout time.Duration
+}
+
+// Event is the billing service's api struct
+type Event struct {
+	Type      string            `json:"type"`
+	Timestamp time.Time         `json:"timestamp"`
+	Counts    []model.UserCount `json:"counts"`
+}
+
+// Client posts the usage events to the billing service
+type Client struct {
+	conf       Config
+	httpClient apiclient.HttpRunner
+}
+
+func NewClient(conf Config) *Client {
+	if conf.Timeout == 0 {
+		conf.Timeout = defaultReqTimeout
+	}
+
+	return &Client{
+		conf:       conf,
+		httpClient: &apiclient.HttpApi{},
+	}
+}
+
+// ReportUserCounts posts the user counts of the tenants in a single event
+func (c *Client) ReportUserCounts(ctx context.Context, counts []model.UserCount) error {
+	body, err := json.Marshal(Event{
+		Type:      EventUserCounts,
+		Timestamp: time.Now().UTC(),
+		Counts:    counts,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to prepare body for POST user counts")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request for POST user counts")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(ctx, c.conf.Timeout)
+	defer cancel()
+
+	if reqId := requestid.FromContext(ctx); reqId != "" {
+		req.Header.Set(requestid.RequestIdHeader, reqId)
+	}
+
+	rsp, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "POST user counts request failed")
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return &UnexpectedStatusError{Status: rsp.StatusCode}
+	}
+	return nil
+}
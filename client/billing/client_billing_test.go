@@ -0,0 +1,84 @@
+// Copyright 2017 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package billing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+func TestReportUserCounts(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		status int
+		err    error
+	}{
+		"ok": {
+			status: http.StatusNoContent,
+		},
+		"ok, accepted": {
+			status: http.StatusAccepted,
+		},
+		"error: generic": {
+			status: http.StatusInternalServerError,
+			err:    errors.New("POST user counts request failed with unexpected status 500"),
+		},
+	}
+
+	counts := []model.UserCount{
+		{TenantID: "foo", Total: 3, Active: 1},
+		{TenantID: "bar", Total: 1, Active: 0},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("name %v", name), func(t *testing.T) {
+			t.Parallel()
+
+			var event Event
+			s := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(t, http.MethodPost, r.Method)
+					assert.Equal(t, "/usage", r.URL.Path)
+					assert.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+					w.WriteHeader(tc.status)
+				}))
+			defer s.Close()
+
+			c := NewClient(Config{
+				URL: s.URL + "/usage",
+			})
+
+			err := c.ReportUserCounts(context.Background(), counts)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, EventUserCounts, event.Type)
+			assert.False(t, event.Timestamp.IsZero())
+			assert.Equal(t, counts, event.Counts)
+		})
+	}
+}
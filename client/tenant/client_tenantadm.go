@@ -17,11 +17,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/mendersoftware/go-lib-micro/apiclient"
+	"github.com/mendersoftware/go-lib-micro/requestid"
 	"github.com/pkg/errors"
 )
 
@@ -31,6 +33,9 @@ const (
 	GetTenantsUri   = UriBase + "/tenants"
 	UsersUri        = UriBase + "/users"
 	TenantsUsersUri = UriBase + "/tenants/:tid/users/:uid"
+	HealthUri       = UriBase + "/health"
+	// common request ID header, sent along with requestid.RequestIdHeader
+	RequestIdHeader = "X-Request-Id"
 	// default request timeout, 10s
 	defaultReqTimeout = time.Duration(10) * time.Second
 )
@@ -40,6 +45,18 @@ var (
 	ErrUserNotFound  = errors.New("user not found")
 )
 
+// UnexpectedStatusError is returned when tenantadm responds with a status
+// the request doesn't expect
+type UnexpectedStatusError struct {
+	// method and path of the request
+	Request string
+	Status  int
+}
+
+func (e *UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("%s request failed with unexpected status %v", e.Request, e.Status)
+}
+
 // ClientConfig conveys client configuration
 type Config struct {
 	// tenantadm  service address
@@ -54,6 +71,7 @@ type ClientRunner interface {
 	CreateUser(ctx context.Context, user *User, client apiclient.HttpRunner) error
 	UpdateUser(ctx context.Context, tenantId, userId string, u *UserUpdate, client apiclient.HttpRunner) error
 	DeleteUser(ctx context.Context, tenantId, clientId string, client apiclient.HttpRunner) error
+	CheckHealth(ctx context.Context, client apiclient.HttpRunner) error
 }
 
 // Client is an opaque implementation of tenantadm api client.
@@ -67,6 +85,8 @@ type Tenant struct {
 	ID     string `json:"id"`
 	Name   string `json:"name"`
 	Status string `json:"status"`
+	// subscription plan, gating the tenant's capabilities
+	Plan string `json:"plan,omitempty"`
 }
 
 // User is the tenantadm's api struct
@@ -102,14 +122,14 @@ func (c *Client) GetTenant(ctx context.Context, username string, client apiclien
 	ctx, cancel := context.WithTimeout(ctx, c.conf.Timeout)
 	defer cancel()
 
-	rsp, err := client.Do(req.WithContext(ctx))
+	rsp, err := client.Do(withContext(ctx, req))
 	if err != nil {
 		return nil, errors.Wrap(err, "GET /tenants request failed")
 	}
 	defer rsp.Body.Close()
 
 	if rsp.StatusCode != http.StatusOK {
-		return nil, errors.Errorf("GET /tenants request failed with unexpected status %v", rsp.StatusCode)
+		return nil, &UnexpectedStatusError{Request: "GET /tenants", Status: rsp.StatusCode}
 	}
 
 	tenants := []Tenant{}
@@ -149,7 +169,7 @@ func (c *Client) CreateUser(ctx context.Context, user *User, client apiclient.Ht
 	defer cancel()
 
 	// send
-	rsp, err := client.Do(req.WithContext(ctx))
+	rsp, err := client.Do(withContext(ctx, req))
 	if err != nil {
 		return errors.Wrap(err, "POST /users request failed")
 	}
@@ -161,7 +181,7 @@ func (c *Client) CreateUser(ctx context.Context, user *User, client apiclient.Ht
 	case http.StatusUnprocessableEntity:
 		return ErrDuplicateUser
 	default:
-		return errors.Errorf("POST /users request failed with unexpected status %v", rsp.StatusCode)
+		return &UnexpectedStatusError{Request: "POST /users", Status: rsp.StatusCode}
 	}
 }
 
@@ -190,7 +210,7 @@ func (c *Client) UpdateUser(ctx context.Context, tenantId, userId string, u *Use
 	defer cancel()
 
 	// send
-	rsp, err := client.Do(req.WithContext(ctx))
+	rsp, err := client.Do(withContext(ctx, req))
 	if err != nil {
 		return errors.Wrap(err, "PUT /tenants/:id/users/:id request failed")
 	}
@@ -204,7 +224,7 @@ func (c *Client) UpdateUser(ctx context.Context, tenantId, userId string, u *Use
 	case http.StatusNotFound:
 		return ErrUserNotFound
 	default:
-		return errors.Errorf("PUT /tenants/:id/users/:id request failed with unexpected status %v", rsp.StatusCode)
+		return &UnexpectedStatusError{Request: "PUT /tenants/:id/users/:id", Status: rsp.StatusCode}
 	}
 }
 
@@ -223,16 +243,55 @@ func (c *Client) DeleteUser(ctx context.Context, tenantId, userId string, client
 	defer cancel()
 
 	// send
-	rsp, err := client.Do(req.WithContext(ctx))
+	rsp, err := client.Do(withContext(ctx, req))
 	if err != nil {
 		return errors.Wrapf(err, "DELETE %s request failed", uri)
 	}
 	defer rsp.Body.Close()
 
-	if rsp.StatusCode != http.StatusNoContent {
-		return errors.Errorf("DELETE %s request failed with unexpected status %v", uri, rsp.StatusCode)
+	switch rsp.StatusCode {
+	case http.StatusNoContent:
+		return nil
+	case http.StatusNotFound:
+		return ErrUserNotFound
+	default:
+		return &UnexpectedStatusError{Request: "DELETE " + uri, Status: rsp.StatusCode}
+	}
+}
+
+// CheckHealth verifies that tenantadm is reachable and reports itself healthy
+func (c *Client) CheckHealth(ctx context.Context, client apiclient.HttpRunner) error {
+	req, err := http.NewRequest(http.MethodGet,
+		JoinURL(c.conf.TenantAdmAddr, HealthUri), nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create request for GET %s", HealthUri)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.conf.Timeout)
+	defer cancel()
+
+	rsp, err := client.Do(withContext(ctx, req))
+	if err != nil {
+		return errors.Wrapf(err, "GET %s request failed", HealthUri)
+	}
+	defer rsp.Body.Close()
+
+	switch rsp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return nil
+	default:
+		return &UnexpectedStatusError{Request: "GET " + HealthUri, Status: rsp.StatusCode}
+	}
+}
+
+// withContext binds the request to ctx, passing on the ID of the request
+// being handled, if any, so it can be traced across the services
+func withContext(ctx context.Context, req *http.Request) *http.Request {
+	if reqId := requestid.FromContext(ctx); reqId != "" {
+		req.Header.Set(requestid.RequestIdHeader, reqId)
+		req.Header.Set(RequestIdHeader, reqId)
 	}
-	return nil
+	return req.WithContext(ctx)
 }
 
 func JoinURL(base, url string) string {
@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/mendersoftware/go-lib-micro/apiclient"
+	"github.com/mendersoftware/go-lib-micro/requestid"
 	"github.com/stretchr/testify/assert"
 
 	ct "github.com/mendersoftware/useradm/client/testing"
@@ -83,13 +84,16 @@ func TestGetTenant(t *testing.T) {
 				TenantAdmAddr: s.URL,
 			})
 
-			tenant, err := c.GetTenant(context.Background(), "username", &apiclient.HttpApi{})
+			ctx := requestid.WithContext(context.Background(), "test")
+			tenant, err := c.GetTenant(ctx, "username", &apiclient.HttpApi{})
 			if tc.err != nil {
 				assert.EqualError(t, err, tc.err.Error())
 			} else {
 				assert.NoError(t, err)
 				assert.Equal(t, GetTenantsUri, rd.Url.Path)
 				assert.Equal(t, "GET", rd.Method)
+				assert.Equal(t, "test", rd.Header.Get(requestid.RequestIdHeader))
+				assert.Equal(t, "test", rd.Header.Get(RequestIdHeader))
 				assert.Equal(t, tc.tenant, tenant)
 			}
 			s.Close()
@@ -159,6 +163,10 @@ func TestDeleteUser(t *testing.T) {
 			status: http.StatusNoContent,
 			err:    nil,
 		},
+		"error: not found": {
+			status: http.StatusNotFound,
+			err:    ErrUserNotFound,
+		},
 		"error: generic": {
 			status: http.StatusInternalServerError,
 			err:    errors.New("DELETE /api/internal/v1/tenantadm/tenants/foo/users/bar request failed with unexpected status 500"),
@@ -191,6 +199,49 @@ func TestDeleteUser(t *testing.T) {
 	}
 }
 
+func TestCheckHealth(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		status int
+		err    error
+	}{
+		"ok": {
+			status: http.StatusNoContent,
+		},
+		"ok, 200": {
+			status: http.StatusOK,
+		},
+		"error: unhealthy": {
+			status: http.StatusServiceUnavailable,
+			err:    errors.New("GET /api/internal/v1/tenantadm/health request failed with unexpected status 503"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("name %v", name), func(t *testing.T) {
+			t.Parallel()
+
+			s, rd := ct.NewMockServer(tc.status, nil)
+
+			c := NewClient(Config{
+				TenantAdmAddr: s.URL,
+			})
+
+			err := c.CheckHealth(context.Background(), &apiclient.HttpApi{})
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, HealthUri, rd.Url.Path)
+				assert.Equal(t, "GET", rd.Method)
+			}
+			s.Close()
+		})
+	}
+}
+
 func TestUpdateUser(t *testing.T) {
 	t.Parallel()
 
@@ -24,6 +24,20 @@ type ClientRunner struct {
 	mock.Mock
 }
 
+// CheckHealth provides a mock function with given fields: ctx, client
+func (_m *ClientRunner) CheckHealth(ctx context.Context, client apiclient.HttpRunner) error {
+	ret := _m.Called(ctx, client)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, apiclient.HttpRunner) error); ok {
+		r0 = rf(ctx, client)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // CreateUser provides a mock function with given fields: ctx, user, client
 func (_m *ClientRunner) CreateUser(ctx context.Context, user *tenant.User, client apiclient.HttpRunner) error {
 	ret := _m.Called(ctx, user, client)
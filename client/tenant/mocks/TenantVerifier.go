@@ -0,0 +1,102 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mocks
+
+import context "context"
+import mock "github.com/stretchr/testify/mock"
+import tenant "github.com/mendersoftware/useradm/client/tenant"
+
+// TenantVerifier is an autogenerated mock type for the TenantVerifier type
+type TenantVerifier struct {
+	mock.Mock
+}
+
+// CheckHealth provides a mock function with given fields: ctx
+func (_m *TenantVerifier) CheckHealth(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateUser provides a mock function with given fields: ctx, user
+func (_m *TenantVerifier) CreateUser(ctx context.Context, user *tenant.User) error {
+	ret := _m.Called(ctx, user)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *tenant.User) error); ok {
+		r0 = rf(ctx, user)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUser provides a mock function with given fields: ctx, tenantId, userId
+func (_m *TenantVerifier) DeleteUser(ctx context.Context, tenantId string, userId string) error {
+	ret := _m.Called(ctx, tenantId, userId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, tenantId, userId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetTenant provides a mock function with given fields: ctx, username
+func (_m *TenantVerifier) GetTenant(ctx context.Context, username string) (*tenant.Tenant, error) {
+	ret := _m.Called(ctx, username)
+
+	var r0 *tenant.Tenant
+	if rf, ok := ret.Get(0).(func(context.Context, string) *tenant.Tenant); ok {
+		r0 = rf(ctx, username)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*tenant.Tenant)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateUser provides a mock function with given fields: ctx, tenantId, userId, u
+func (_m *TenantVerifier) UpdateUser(ctx context.Context, tenantId string, userId string, u *tenant.UserUpdate) error {
+	ret := _m.Called(ctx, tenantId, userId, u)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *tenant.UserUpdate) error); ok {
+		r0 = rf(ctx, tenantId, userId, u)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
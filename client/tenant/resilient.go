@@ -0,0 +1,273 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package tenant
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/apiclient"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+)
+
+// number of users whose last known tenant is kept for FailOpen
+const maxKnownTenants = 10000
+
+var (
+	ErrCircuitOpen = errors.New("tenantadm is unavailable, requests to it are suspended")
+)
+
+// ResilienceConfig configures how the requests to tenantadm are retried,
+// and suspended while it's unavailable
+type ResilienceConfig struct {
+	// number of times a request failing transiently is retried,
+	// not applied to user creation, which isn't idempotent
+	Retries int
+	// wait before the first retry, doubled with each of the next ones
+	RetryBackoff time.Duration
+
+	// number of consecutive transient failures after which the requests
+	// are suspended for BreakerCooldown, 0 to never suspend them; once
+	// the time passes, a single request checks if tenantadm is back
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// resolve the tenant of a user to the last one tenantadm returned,
+	// while it's unavailable, instead of failing
+	FailOpen bool
+}
+
+// ResilientClient wraps a tenantadm client, retrying the requests failing
+// with network errors, 5xx and 429 responses, and suspending them while
+// tenantadm keeps failing, so that its outages don't pile up requests
+// waiting for it.
+// Implements ClientRunner interface
+type ResilientClient struct {
+	client  ClientRunner
+	conf    ResilienceConfig
+	breaker *breaker
+
+	mu sync.Mutex
+	// last known tenant of the users, by username
+	tenants map[string]Tenant
+}
+
+func NewResilientClient(client ClientRunner, conf ResilienceConfig) *ResilientClient {
+	return &ResilientClient{
+		client: client,
+		conf:   conf,
+		breaker: &breaker{
+			threshold: conf.BreakerThreshold,
+			cooldown:  conf.BreakerCooldown,
+			now:       time.Now,
+		},
+		tenants: map[string]Tenant{},
+	}
+}
+
+func (c *ResilientClient) GetTenant(ctx context.Context, username string, client apiclient.HttpRunner) (*Tenant, error) {
+	var tenant *Tenant
+	err := c.do(ctx, true, func() error {
+		var err error
+		tenant, err = c.client.GetTenant(ctx, username, client)
+		return err
+	})
+	if err == nil {
+		c.remember(username, tenant)
+		return tenant, nil
+	}
+
+	if c.conf.FailOpen && isUnavailable(err) {
+		if known, ok := c.lastKnown(username); ok {
+			log.FromContext(ctx).Warnf("using the last known tenant of user %s: %v",
+				username, err)
+			return known, nil
+		}
+	}
+	return nil, err
+}
+
+func (c *ResilientClient) CreateUser(ctx context.Context, user *User, client apiclient.HttpRunner) error {
+	return c.do(ctx, false, func() error {
+		return c.client.CreateUser(ctx, user, client)
+	})
+}
+
+func (c *ResilientClient) UpdateUser(ctx context.Context, tenantId, userId string, u *UserUpdate, client apiclient.HttpRunner) error {
+	return c.do(ctx, true, func() error {
+		return c.client.UpdateUser(ctx, tenantId, userId, u, client)
+	})
+}
+
+func (c *ResilientClient) DeleteUser(ctx context.Context, tenantId, userId string, client apiclient.HttpRunner) error {
+	return c.do(ctx, true, func() error {
+		return c.client.DeleteUser(ctx, tenantId, userId, client)
+	})
+}
+
+func (c *ResilientClient) CheckHealth(ctx context.Context, client apiclient.HttpRunner) error {
+	return c.do(ctx, true, func() error {
+		return c.client.CheckHealth(ctx, client)
+	})
+}
+
+// do makes the request, retrying it if allowed, unless the requests are
+// suspended
+func (c *ResilientClient) do(ctx context.Context, retry bool, request func() error) error {
+	attempts := 1
+	if retry {
+		attempts += c.conf.Retries
+	}
+	backoff := c.conf.RetryBackoff
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		if !c.breaker.allow() {
+			return ErrCircuitOpen
+		}
+
+		err = request()
+		if ctx.Err() != nil {
+			// given up by the caller, which tells nothing of tenantadm
+			c.breaker.abandon()
+			return err
+		}
+		transient := isTransient(err)
+		c.breaker.record(transient)
+		if !transient {
+			return err
+		}
+	}
+	return err
+}
+
+func (c *ResilientClient) remember(username string, tenant *Tenant) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if tenant == nil {
+		delete(c.tenants, username)
+		return
+	}
+	if _, ok := c.tenants[username]; !ok && len(c.tenants) >= maxKnownTenants {
+		// make room by forgetting any of the users
+		for other := range c.tenants {
+			delete(c.tenants, other)
+			break
+		}
+	}
+	c.tenants[username] = *tenant
+}
+
+func (c *ResilientClient) lastKnown(username string) (*Tenant, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tenant, ok := c.tenants[username]
+	return &tenant, ok
+}
+
+// isTransient tells if the request failed because tenantadm couldn't
+// serve it at the time, and may succeed if repeated
+func isTransient(err error) bool {
+	switch cause := errors.Cause(err).(type) {
+	case *UnexpectedStatusError:
+		return cause.Status >= http.StatusInternalServerError ||
+			cause.Status == http.StatusTooManyRequests
+	case net.Error:
+		return true
+	default:
+		return false
+	}
+}
+
+// isUnavailable tells if the request failed because of tenantadm
+func isUnavailable(err error) bool {
+	return err == ErrCircuitOpen || isTransient(err)
+}
+
+// breaker counts the consecutive failures of the requests, and suspends
+// them after threshold failures for the cooldown
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	// requests are suspended until then
+	openUntil time.Time
+	// a request checking if tenantadm is back is in progress
+	probing bool
+}
+
+// allow tells if a request may be made
+func (b *breaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record counts the outcome of a request
+func (b *breaker) record(failed bool) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// abandon ends a request without counting it
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
@@ -0,0 +1,230 @@
+// Copyright 2017 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/apiclient"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient returns the errors in turn, then succeeds
+type fakeClient struct {
+	errs   []error
+	tenant *Tenant
+	calls  int
+}
+
+func (c *fakeClient) next() error {
+	c.calls++
+	if len(c.errs) == 0 {
+		return nil
+	}
+	err := c.errs[0]
+	c.errs = c.errs[1:]
+	return err
+}
+
+func (c *fakeClient) GetTenant(ctx context.Context, username string, client apiclient.HttpRunner) (*Tenant, error) {
+	if err := c.next(); err != nil {
+		return nil, err
+	}
+	return c.tenant, nil
+}
+
+func (c *fakeClient) CreateUser(ctx context.Context, user *User, client apiclient.HttpRunner) error {
+	return c.next()
+}
+
+func (c *fakeClient) UpdateUser(ctx context.Context, tenantId, userId string, u *UserUpdate, client apiclient.HttpRunner) error {
+	return c.next()
+}
+
+func (c *fakeClient) DeleteUser(ctx context.Context, tenantId, userId string, client apiclient.HttpRunner) error {
+	return c.next()
+}
+
+func (c *fakeClient) CheckHealth(ctx context.Context, client apiclient.HttpRunner) error {
+	return c.next()
+}
+
+var (
+	errUnavailable = &UnexpectedStatusError{Request: "GET /tenants", Status: 503}
+	errNetwork     = &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+)
+
+func TestResilientClientRetries(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		errs  []error
+		calls int
+		err   error
+	}{
+		"ok": {
+			calls: 1,
+		},
+		"ok, after transient failures": {
+			errs:  []error{errUnavailable, errNetwork},
+			calls: 3,
+		},
+		"error: retries exhausted": {
+			errs:  []error{errUnavailable, errUnavailable, errUnavailable, errUnavailable},
+			calls: 3,
+			err:   errUnavailable,
+		},
+		"error: not transient": {
+			errs:  []error{&UnexpectedStatusError{Request: "GET /tenants", Status: 400}},
+			calls: 1,
+			err:   errors.New("GET /tenants request failed with unexpected status 400"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			fake := &fakeClient{
+				errs:   tc.errs,
+				tenant: &Tenant{ID: "foo"},
+			}
+			c := NewResilientClient(fake, ResilienceConfig{
+				Retries:      2,
+				RetryBackoff: time.Millisecond,
+			})
+
+			tenant, err := c.GetTenant(context.Background(), "foo@bar.com", nil)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, tenant)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, &Tenant{ID: "foo"}, tenant)
+			}
+			assert.Equal(t, tc.calls, fake.calls)
+		})
+	}
+}
+
+func TestResilientClientNoRetryOnCreate(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeClient{errs: []error{errUnavailable}}
+	c := NewResilientClient(fake, ResilienceConfig{
+		Retries:      2,
+		RetryBackoff: time.Millisecond,
+	})
+
+	err := c.CreateUser(context.Background(), &User{}, nil)
+	assert.Equal(t, errUnavailable, err)
+	assert.Equal(t, 1, fake.calls)
+}
+
+func TestResilientClientBreaker(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	fake := &fakeClient{errs: []error{errNetwork, errNetwork, errNetwork}}
+	c := NewResilientClient(fake, ResilienceConfig{
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Minute,
+	})
+	c.breaker.now = func() time.Time { return now }
+
+	ctx := context.Background()
+
+	assert.Equal(t, errNetwork, c.CheckHealth(ctx, nil))
+	assert.Equal(t, errNetwork, c.CheckHealth(ctx, nil))
+
+	// suspended, tenantadm isn't called
+	assert.Equal(t, ErrCircuitOpen, c.CheckHealth(ctx, nil))
+	assert.Equal(t, 2, fake.calls)
+
+	// a single request checks if tenantadm is back, it isn't
+	now = now.Add(time.Minute)
+	assert.Equal(t, errNetwork, c.CheckHealth(ctx, nil))
+	assert.Equal(t, ErrCircuitOpen, c.CheckHealth(ctx, nil))
+	assert.Equal(t, 3, fake.calls)
+
+	// back
+	now = now.Add(time.Minute)
+	assert.NoError(t, c.CheckHealth(ctx, nil))
+	assert.NoError(t, c.CheckHealth(ctx, nil))
+	assert.Equal(t, 5, fake.calls)
+}
+
+func TestResilientClientFailOpen(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		failOpen bool
+		known    bool
+		err      error
+
+		tenant *Tenant
+		outErr error
+	}{
+		"fail open, known user": {
+			failOpen: true,
+			known:    true,
+			err:      errUnavailable,
+			tenant:   &Tenant{ID: "foo", Status: "active"},
+		},
+		"fail open, unknown user": {
+			failOpen: true,
+			err:      errUnavailable,
+			outErr:   errUnavailable,
+		},
+		"fail open, not transient": {
+			failOpen: true,
+			known:    true,
+			err:      errors.New("error parsing GET /tenants response"),
+			outErr:   errors.New("error parsing GET /tenants response"),
+		},
+		"fail closed": {
+			known:  true,
+			err:    errUnavailable,
+			outErr: errUnavailable,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			fake := &fakeClient{tenant: &Tenant{ID: "foo", Status: "active"}}
+			c := NewResilientClient(fake, ResilienceConfig{
+				FailOpen: tc.failOpen,
+			})
+
+			ctx := context.Background()
+
+			if tc.known {
+				_, err := c.GetTenant(ctx, "foo@bar.com", nil)
+				assert.NoError(t, err)
+			}
+
+			fake.errs = []error{tc.err}
+			tenant, err := c.GetTenant(ctx, "foo@bar.com", nil)
+			if tc.outErr != nil {
+				assert.EqualError(t, err, tc.outErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.tenant, tenant)
+		})
+	}
+}
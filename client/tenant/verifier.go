@@ -0,0 +1,126 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package tenant
+
+import (
+	"context"
+
+	"github.com/mendersoftware/go-lib-micro/apiclient"
+)
+
+// TenantVerifier resolves the tenants of the users, and keeps the
+// registry of the users of the tenant service in sync
+type TenantVerifier interface {
+	// GetTenant returns the tenant of the user, nil if there's none
+	GetTenant(ctx context.Context, username string) (*Tenant, error)
+	CreateUser(ctx context.Context, user *User) error
+	UpdateUser(ctx context.Context, tenantId, userId string, u *UserUpdate) error
+	DeleteUser(ctx context.Context, tenantId, userId string) error
+	// CheckHealth verifies the tenant service can be used
+	CheckHealth(ctx context.Context) error
+}
+
+// HTTPVerifier verifies the tenants with tenantadm.
+// Implements TenantVerifier interface
+type HTTPVerifier struct {
+	client     ClientRunner
+	httpClient apiclient.HttpRunner
+}
+
+func NewHTTPVerifier(client ClientRunner) *HTTPVerifier {
+	return &HTTPVerifier{
+		client:     client,
+		httpClient: &apiclient.HttpApi{},
+	}
+}
+
+func (v *HTTPVerifier) GetTenant(ctx context.Context, username string) (*Tenant, error) {
+	return v.client.GetTenant(ctx, username, v.httpClient)
+}
+
+func (v *HTTPVerifier) CreateUser(ctx context.Context, user *User) error {
+	return v.client.CreateUser(ctx, user, v.httpClient)
+}
+
+func (v *HTTPVerifier) UpdateUser(ctx context.Context, tenantId, userId string, u *UserUpdate) error {
+	return v.client.UpdateUser(ctx, tenantId, userId, u, v.httpClient)
+}
+
+func (v *HTTPVerifier) DeleteUser(ctx context.Context, tenantId, userId string) error {
+	return v.client.DeleteUser(ctx, tenantId, userId, v.httpClient)
+}
+
+func (v *HTTPVerifier) CheckHealth(ctx context.Context) error {
+	return v.client.CheckHealth(ctx, v.httpClient)
+}
+
+// StaticVerifier puts all the users in a single tenant set in the
+// configuration, for installations with one tenant which don't run
+// tenantadm; there's no registry of users to keep in sync.
+// Implements TenantVerifier interface
+type StaticVerifier struct {
+	tenant Tenant
+}
+
+func NewStaticVerifier(tenant Tenant) *StaticVerifier {
+	return &StaticVerifier{
+		tenant: tenant,
+	}
+}
+
+func (v *StaticVerifier) GetTenant(ctx context.Context, username string) (*Tenant, error) {
+	tenant := v.tenant
+	return &tenant, nil
+}
+
+func (v *StaticVerifier) CreateUser(ctx context.Context, user *User) error {
+	return nil
+}
+
+func (v *StaticVerifier) UpdateUser(ctx context.Context, tenantId, userId string, u *UserUpdate) error {
+	return nil
+}
+
+func (v *StaticVerifier) DeleteUser(ctx context.Context, tenantId, userId string) error {
+	return nil
+}
+
+func (v *StaticVerifier) CheckHealth(ctx context.Context) error {
+	return nil
+}
+
+// NoopVerifier is used in single-tenant installations: the users belong
+// to no tenant.
+// Implements TenantVerifier interface
+type NoopVerifier struct{}
+
+func (NoopVerifier) GetTenant(ctx context.Context, username string) (*Tenant, error) {
+	return nil, nil
+}
+
+func (NoopVerifier) CreateUser(ctx context.Context, user *User) error {
+	return nil
+}
+
+func (NoopVerifier) UpdateUser(ctx context.Context, tenantId, userId string, u *UserUpdate) error {
+	return nil
+}
+
+func (NoopVerifier) DeleteUser(ctx context.Context, tenantId, userId string) error {
+	return nil
+}
+
+func (NoopVerifier) CheckHealth(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPVerifier(t *testing.T) {
+	t.Parallel()
+
+	c := &fakeClient{
+		errs:   []error{nil, nil, nil, nil, errUnavailable},
+		tenant: &Tenant{ID: "foo", Name: "bar"},
+	}
+	v := NewHTTPVerifier(c)
+	ctx := context.Background()
+
+	tenant, err := v.GetTenant(ctx, "user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, &Tenant{ID: "foo", Name: "bar"}, tenant)
+	assert.NoError(t, v.CreateUser(ctx, &User{ID: "1", TenantID: "foo"}))
+	assert.NoError(t, v.UpdateUser(ctx, "foo", "1", &UserUpdate{}))
+	assert.NoError(t, v.DeleteUser(ctx, "foo", "1"))
+	assert.Equal(t, errUnavailable, v.CheckHealth(ctx))
+	assert.Equal(t, 5, c.calls)
+}
+
+func TestStaticVerifier(t *testing.T) {
+	t.Parallel()
+
+	v := NewStaticVerifier(Tenant{ID: "foo"})
+	ctx := context.Background()
+
+	tenant, err := v.GetTenant(ctx, "user@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, &Tenant{ID: "foo"}, tenant)
+
+	// the configured tenant can't be changed through the returned one
+	tenant.ID = "bar"
+	tenant, _ = v.GetTenant(ctx, "other@example.com")
+	assert.Equal(t, "foo", tenant.ID)
+
+	assert.NoError(t, v.CreateUser(ctx, &User{ID: "1", TenantID: "foo"}))
+	assert.NoError(t, v.UpdateUser(ctx, "foo", "1", &UserUpdate{}))
+	assert.NoError(t, v.DeleteUser(ctx, "foo", "1"))
+	assert.NoError(t, v.CheckHealth(ctx))
+}
+
+func TestNoopVerifier(t *testing.T) {
+	t.Parallel()
+
+	var v TenantVerifier = NoopVerifier{}
+	ctx := context.Background()
+
+	tenant, err := v.GetTenant(ctx, "user@example.com")
+	assert.NoError(t, err)
+	assert.Nil(t, tenant)
+	assert.NoError(t, v.CreateUser(ctx, &User{ID: "1"}))
+	assert.NoError(t, v.CheckHealth(ctx))
+}
@@ -23,6 +23,7 @@ import (
 type TestReqData struct {
 	Url    *url.URL
 	Method string
+	Header http.Header
 }
 
 // return mock http server returning status code 'status' and response 'body'
@@ -32,6 +33,7 @@ func NewMockServer(status int, body interface{}) (*httptest.Server, *TestReqData
 		defer r.Body.Close()
 		rdata.Url = r.URL
 		rdata.Method = r.Method
+		rdata.Header = r.Header
 		json, err := json.Marshal(body)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -15,8 +15,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"text/tabwriter"
+	"time"
 
 	"github.com/mendersoftware/go-lib-micro/config"
 	"github.com/mendersoftware/go-lib-micro/identity"
@@ -24,8 +28,8 @@ import (
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/ssh/terminal"
 
-	"github.com/mendersoftware/useradm/client/tenant"
 	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
 	"github.com/mendersoftware/useradm/store/mongo"
 	"github.com/mendersoftware/useradm/user"
 )
@@ -74,21 +78,9 @@ func commandCreateUser(c config.Reader, username, password, userId, tenantId str
 		return errors.Wrap(err, "user validation failed")
 	}
 
-	db, err := mongo.GetDataStoreMongo(dataStoreMongoConfigFromAppConfig(c))
+	ua, _, err := userAdmFromAppConfig(c)
 	if err != nil {
-		return errors.Wrap(err, "database connection failed")
-	}
-
-	ua := useradm.NewUserAdm(nil, db, mongo.NewTenantStoreMongo(db),
-		useradm.Config{})
-	if tadmAddr := c.GetString(SettingTenantAdmAddr); tadmAddr != "" {
-		l.Infof("setting up tenant verification")
-
-		tc := tenant.NewClient(tenant.Config{
-			TenantAdmAddr: tadmAddr,
-		})
-
-		ua = ua.WithTenantVerification(tc)
+		return err
 	}
 
 	ctx := getTenantContext(tenantId)
@@ -101,6 +93,51 @@ func commandCreateUser(c config.Reader, username, password, userId, tenantId str
 	return nil
 }
 
+// userAdmFromAppConfig sets up the application for the commands managing
+// users; users are kept in sync with the tenant service in multitenant
+// setups
+func userAdmFromAppConfig(c config.Reader) (*useradm.UserAdm, store.DataStore, error) {
+	l := log.NewEmpty()
+
+	db, tenantKeeper, err := dataStoreFromAppConfig(c)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "database connection failed")
+	}
+
+	verifier, err := tenantVerifierFromAppConfig(c)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "tenant verification setup failed")
+	}
+
+	ua := useradm.NewUserAdm(nil, db, tenantKeeper,
+		useradm.Config{})
+	if multitenant(c) {
+		l.Infof("setting up tenant verification")
+	}
+	ua = ua.WithTenantVerification(verifier)
+
+	return ua, db, nil
+}
+
+// getUserByLogin finds the user by the email or the username
+func getUserByLogin(ctx context.Context, db store.DataStore, login string) (*model.User, error) {
+	var user *model.User
+	var err error
+	if model.IsUsername(login) {
+		user, err = db.GetUserByUsername(ctx, login)
+	} else {
+		user, err = db.GetUserByEmail(ctx, model.NormalizeEmail(login))
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get user")
+	}
+	if user == nil {
+		return nil, errors.Errorf("user %s not found", login)
+	}
+
+	return user, nil
+}
+
 func getTenantContext(tenantId string) context.Context {
 	ctx := context.Background()
 	if tenantId != "" {
@@ -114,16 +151,35 @@ func getTenantContext(tenantId string) context.Context {
 	return ctx
 }
 
-func commandMigrate(c config.Reader, tenantId string) error {
+// tenantName names the tenant in messages
+func tenantName(id string) string {
+	if id == "" {
+		return "default tenant"
+	}
+	return "tenant " + id
+}
+
+// migrateOptions are the options of the migrate command
+type migrateOptions struct {
+	// tenant to migrate, the default one if empty
+	tenantId   string
+	allTenants bool
+
+	// version to migrate to, up or down
+	version string
+
+	dryRun bool
+	status bool
+}
+
+func commandMigrate(c config.Reader, opts migrateOptions) error {
 	l := log.New(log.Ctx{})
 
 	l.Printf("User Administration Service, version %s starting up",
 		CreateVersionString())
 
-	if tenantId != "" {
-		l.Printf("migrating tenant %v", tenantId)
-	} else {
-		l.Printf("migrating default tenant")
+	if opts.version == "" {
+		opts.version = mongo.DbVersion
 	}
 
 	db, err := mongo.NewDataStoreMongo(dataStoreMongoConfigFromAppConfig(c))
@@ -137,13 +193,64 @@ func commandMigrate(c config.Reader, tenantId string) error {
 
 	ctx := context.Background()
 
-	err = db.MigrateTenant(ctx, mongo.DbVersion, tenantId)
-	if err != nil {
-		return errors.Wrap(err, "failed to run migrations")
+	tenants := []string{opts.tenantId}
+	if opts.allTenants {
+		if tenants, err = db.GetTenantIDs(ctx); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	if opts.allTenants && !opts.status && !opts.dryRun {
+		if err := db.MigrateTenants(ctx, opts.version, tenants, true); err != nil {
+			return errors.Wrap(err, "failed to run migrations")
+		}
+		return nil
+	}
+
+	for _, tenantId := range tenants {
+		name := "default tenant"
+		if tenantId != "" {
+			name = "tenant " + tenantId
+		}
+
+		if opts.status {
+			status, err := db.GetMigrationStatus(ctx, tenantId)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get migration status of %s", name)
+			}
+			fmt.Printf("%s: version %s, service needs %s\n",
+				name, status.Version, status.Target)
+			for _, step := range status.Steps {
+				applied := "pending"
+				if step.AppliedTs != nil {
+					applied = "applied " + step.AppliedTs.Format(time.RFC3339)
+				}
+				fmt.Printf("  %s %s (%s)\n", step.Version, step.Description, applied)
+			}
+			continue
+		}
+
+		l.Printf("migrating %s to version %s", name, opts.version)
 
+		steps, err := db.MigrateTenantTo(ctx, opts.version, tenantId,
+			mongo.MigrateOptions{DryRun: opts.dryRun, Down: true})
+		if err != nil {
+			return errors.Wrapf(err, "failed to run migrations of %s", name)
+		}
+
+		if opts.dryRun {
+			fmt.Printf("%s: %d steps to version %s\n", name, len(steps), opts.version)
+			for _, step := range steps {
+				action := "apply"
+				if step.Down {
+					action = "revert"
+				}
+				fmt.Printf("  %s %s %s\n", action, step.Version, step.Description)
+			}
+		}
+	}
+
+	return nil
 }
 
 func commandSetPassword(c config.Reader, username, password, tenantId string) error {
@@ -158,12 +265,12 @@ func commandSetPassword(c config.Reader, username, password, tenantId string) er
 		}
 	}
 
-	db, err := mongo.GetDataStoreMongo(dataStoreMongoConfigFromAppConfig(c))
+	db, tenantKeeper, err := dataStoreFromAppConfig(c)
 	if err != nil {
 		return errors.Wrap(err, "database connection failed")
 	}
 
-	ua := useradm.NewUserAdm(nil, db, mongo.NewTenantStoreMongo(db),
+	ua := useradm.NewUserAdm(nil, db, tenantKeeper,
 		useradm.Config{})
 
 	u := model.User{
@@ -188,3 +295,157 @@ func commandSetPassword(c config.Reader, username, password, tenantId string) er
 
 	return nil
 }
+
+func commandListUsers(c config.Reader, w io.Writer, tenantId string) error {
+	ua, _, err := userAdmFromAppConfig(c)
+	if err != nil {
+		return err
+	}
+
+	users, err := ua.GetUsers(getTenantContext(tenantId), model.UserFilter{})
+	if err != nil {
+		return errors.Wrap(err, "listing users failed")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "ID\tEMAIL\tUSERNAME\tSTATUS\n")
+	for _, u := range users {
+		status := model.UserStatusActive
+		if !u.IsActive() {
+			status = model.UserStatusInactive
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", u.ID, u.Email, u.Username, status)
+	}
+
+	return tw.Flush()
+}
+
+func commandDeleteUser(c config.Reader, username, tenantId string) error {
+	ua, db, err := userAdmFromAppConfig(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := getTenantContext(tenantId)
+
+	user, err := getUserByLogin(ctx, db, username)
+	if err != nil {
+		return err
+	}
+
+	if err := ua.DeleteUser(ctx, user.ID, nil); err != nil {
+		return errors.Wrap(err, "deleting user failed")
+	}
+
+	return nil
+}
+
+// commandAssignRole adds the user to the group named after the role,
+// creating the group if there's none yet
+func commandAssignRole(c config.Reader, username, role, tenantId string) error {
+	ua, db, err := userAdmFromAppConfig(c)
+	if err != nil {
+		return err
+	}
+
+	ctx := getTenantContext(tenantId)
+
+	user, err := getUserByLogin(ctx, db, username)
+	if err != nil {
+		return err
+	}
+
+	groups, err := ua.GetGroups(ctx)
+	if err != nil {
+		return errors.Wrap(err, "listing groups failed")
+	}
+
+	var group *model.Group
+	for i := range groups {
+		if groups[i].Name == role {
+			group = &groups[i]
+			break
+		}
+	}
+
+	if group == nil {
+		group = &model.Group{Name: role}
+		if err := group.ValidateNew(); err != nil {
+			return errors.Wrap(err, "role validation failed")
+		}
+		if err := ua.CreateGroup(ctx, group); err != nil {
+			return errors.Wrap(err, "creating group failed")
+		}
+	}
+
+	if err := ua.AddGroupMember(ctx, group.ID, user.ID); err != nil {
+		return errors.Wrap(err, "assigning role failed")
+	}
+
+	return nil
+}
+
+// checkOptions are the options of the check command
+type checkOptions struct {
+	repair bool
+	// report as JSON instead of text
+	json bool
+}
+
+// commandCheck reports the inconsistencies in the data of all the tenants,
+// failing if any are left unrepaired
+func commandCheck(c config.Reader, w io.Writer, opts checkOptions) error {
+	if c.GetString(SettingDbBackend) == DbBackendMemory {
+		return errors.New("nothing to check in the in-memory datastore")
+	}
+
+	db, err := mongo.NewDataStoreMongo(dataStoreMongoConfigFromAppConfig(c))
+	if err != nil {
+		return errors.Wrap(err, "database connection failed")
+	}
+	if multitenant(c) {
+		db = db.WithMultitenant()
+	}
+
+	issues, err := db.CheckConsistency(context.Background(), opts.repair)
+	if err != nil {
+		return err
+	}
+
+	return reportIssues(w, issues, opts.json)
+}
+
+func reportIssues(w io.Writer, issues []mongo.ConsistencyIssue, asJSON bool) error {
+	unrepaired := 0
+	for _, issue := range issues {
+		if !issue.Repaired {
+			unrepaired++
+		}
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err := enc.Encode(struct {
+			Issues     []mongo.ConsistencyIssue `json:"issues"`
+			Unrepaired int                      `json:"unrepaired"`
+		}{issues, unrepaired})
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, issue := range issues {
+			status := "found"
+			if issue.Repaired {
+				status = "repaired"
+			}
+			fmt.Fprintf(w, "%s: %s: %s (%s)\n",
+				tenantName(issue.Tenant), issue.Kind, issue.Detail, status)
+		}
+	}
+
+	if unrepaired > 0 {
+		return errors.Errorf("%d of %d issues left unrepaired", unrepaired, len(issues))
+	}
+	return nil
+}
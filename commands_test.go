@@ -14,19 +14,21 @@
 package main
 
 import (
+	"bytes"
 	"testing"
 
-	cmocks "github.com/mendersoftware/go-lib-micro/config/mocks"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/store/mongo"
 )
 
 func TestCommandCreateUser(t *testing.T) {
-	conf := &cmocks.Reader{}
-	conf.On("GetString", SettingDb).Return("foo")
-	conf.On("GetBool", SettingDbSSL).Return(false)
-	conf.On("GetBool", SettingDbSSLSkipVerify).Return(false)
-	conf.On("GetString", SettingDbUsername).Return("siala")
-	conf.On("GetString", SettingDbPassword).Return("haha")
+	conf := viper.New()
+	conf.Set(SettingDbBackend, DbBackendMongo)
+	conf.Set(SettingDb, "foo")
+	conf.Set(SettingDbUsername, "siala")
+	conf.Set(SettingDbPassword, "haha")
 
 	// not an email, password too short
 	err := commandCreateUser(conf, "foo", "bar", "", "")
@@ -37,3 +39,82 @@ func TestCommandCreateUser(t *testing.T) {
 		assert.Error(t, err)
 	}
 }
+
+func TestCommandListUsers(t *testing.T) {
+	c := viper.New()
+	c.Set(SettingDbBackend, DbBackendMemory)
+
+	var out bytes.Buffer
+	err := commandListUsers(c, &out, "")
+	assert.NoError(t, err)
+	assert.Equal(t, "ID  EMAIL  USERNAME  STATUS\n", out.String())
+}
+
+func TestCommandDeleteUser(t *testing.T) {
+	c := viper.New()
+	c.Set(SettingDbBackend, DbBackendMemory)
+
+	err := commandDeleteUser(c, "foo@bar.com", "")
+	assert.EqualError(t, err, "user foo@bar.com not found")
+}
+
+func TestCommandAssignRole(t *testing.T) {
+	c := viper.New()
+	c.Set(SettingDbBackend, DbBackendMemory)
+
+	err := commandAssignRole(c, "foo", "admin", "")
+	assert.EqualError(t, err, "user foo not found")
+}
+
+func TestCommandCheck(t *testing.T) {
+	c := viper.New()
+	c.Set(SettingDbBackend, DbBackendMemory)
+
+	var out bytes.Buffer
+	err := commandCheck(c, &out, checkOptions{})
+	assert.EqualError(t, err, "nothing to check in the in-memory datastore")
+}
+
+func TestReportIssues(t *testing.T) {
+	issues := []mongo.ConsistencyIssue{
+		{
+			Kind:     mongo.IssueOrphanedTokens,
+			ID:       "1",
+			Detail:   "tokens were issued to user 1, who doesn't exist",
+			Repaired: true,
+		},
+		{
+			Kind:   mongo.IssueDuplicateEmail,
+			Tenant: "foo",
+			ID:     "3",
+			Detail: "email of user 3 is the same as of user 2: foo@bar.com",
+		},
+	}
+
+	var out bytes.Buffer
+	err := reportIssues(&out, issues, false)
+	assert.EqualError(t, err, "1 of 2 issues left unrepaired")
+	assert.Equal(t,
+		"default tenant: orphaned_tokens: tokens were issued to user 1, who doesn't exist (repaired)\n"+
+			"tenant foo: duplicate_email: email of user 3 is the same as of user 2: foo@bar.com (found)\n",
+		out.String())
+
+	out.Reset()
+	err = reportIssues(&out, issues[:1], true)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{
+		"issues": [{
+			"kind": "orphaned_tokens",
+			"tenant": "",
+			"id": "1",
+			"detail": "tokens were issued to user 1, who doesn't exist",
+			"repaired": true
+		}],
+		"unrepaired": 0
+	}`, out.String())
+
+	out.Reset()
+	err = reportIssues(&out, []mongo.ConsistencyIssue{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", out.String())
+}
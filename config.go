@@ -21,6 +21,62 @@ const (
 	SettingListen        = "listen"
 	SettingListenDefault = ":8080"
 
+	// listen address of the internal API, served on
+	// the main listener if not set
+	SettingListenInternal        = "listen_internal"
+	SettingListenInternalDefault = ""
+
+	// serve the pprof profiles at /debug/pprof/ and the runtime stats
+	// at /debug/vars on the internal API listener, which has to be set
+	SettingDebugEndpoints        = "debug_endpoints"
+	SettingDebugEndpointsDefault = false
+
+	// maximum size of request bodies in bytes, not limited if 0
+	SettingHTTPMaxBodySize        = "http_max_body_size"
+	SettingHTTPMaxBodySizeDefault = "10485760" // 10 MiB
+
+	// maximum size of request headers in bytes
+	SettingHTTPMaxHeaderBytes        = "http_max_header_bytes"
+	SettingHTTPMaxHeaderBytesDefault = "1048576" // 1 MiB
+
+	// compress responses with gzip if the client accepts it
+	SettingHTTPGzip        = "http_gzip"
+	SettingHTTPGzipDefault = true
+
+	// timeouts of the HTTP servers in seconds, not limited if 0
+	SettingHTTPReadHeaderTimeout        = "http_read_header_timeout"
+	SettingHTTPReadHeaderTimeoutDefault = "10"
+
+	SettingHTTPReadTimeout        = "http_read_timeout"
+	SettingHTTPReadTimeoutDefault = "60"
+
+	SettingHTTPWriteTimeout        = "http_write_timeout"
+	SettingHTTPWriteTimeoutDefault = "60"
+
+	SettingHTTPIdleTimeout        = "http_idle_timeout"
+	SettingHTTPIdleTimeoutDefault = "120"
+
+	SettingHTTPRequestTimeout        = "http_request_timeout"
+	SettingHTTPRequestTimeoutDefault = "0"
+
+	// start in maintenance mode, in which only reads, logins and token
+	// verification are served; switched at runtime via the internal API
+	SettingMaintenanceMode        = "maintenance_mode"
+	SettingMaintenanceModeDefault = false
+
+	// Retry-After in seconds of the requests rejected in maintenance mode
+	SettingMaintenanceRetryAfter        = "maintenance_retry_after"
+	SettingMaintenanceRetryAfterDefault = "300"
+
+	// interval in seconds between reads of the maintenance mode switched
+	// by the other instances
+	SettingMaintenanceRefreshInterval        = "maintenance_refresh_interval"
+	SettingMaintenanceRefreshIntervalDefault = "10"
+
+	// reloaded on SIGHUP
+	SettingLogLevel        = "log_level"
+	SettingLogLevelDefault = "info"
+
 	SettingMiddleware        = "middleware"
 	SettingMiddlewareDefault = EnvProd
 
@@ -33,32 +89,413 @@ const (
 	SettingJWTExpirationTimeout        = "jwt_exp_timeout"
 	SettingJWTExpirationTimeoutDefault = "604800" //one week
 
+	SettingJWTLeeway        = "jwt_leeway"
+	SettingJWTLeewayDefault = "60"
+
+	SettingImpersonationExpirationTimeout        = "impersonation_exp_timeout"
+	SettingImpersonationExpirationTimeoutDefault = "3600" //one hour
+
+	SettingServiceAccountExpirationTimeout        = "service_account_exp_timeout"
+	SettingServiceAccountExpirationTimeoutDefault = "7776000" //90 days
+
+	SettingTokenFormat        = "token_format"
+	SettingTokenFormatDefault = "jwt"
+
+	// with the opaque token format, reject the JWTs instead of accepting
+	// them until they expire
+	SettingTokenFormatRejectJWT        = "token_format_reject_jwt"
+	SettingTokenFormatRejectJWTDefault = false
+
+	SettingTokenExchangeExpirationTimeout        = "token_exchange_exp_timeout"
+	SettingTokenExchangeExpirationTimeoutDefault = "300"
+
+	SettingOIDCURL        = "oidc_url"
+	SettingOIDCURLDefault = ""
+
+	SettingOIDCCodeExpirationTimeout        = "oidc_code_exp_timeout"
+	SettingOIDCCodeExpirationTimeoutDefault = "60"
+
+	SettingDeviceVerificationURL        = "device_verification_url"
+	SettingDeviceVerificationURLDefault = ""
+
+	SettingDeviceCodeExpirationTimeout        = "device_code_exp_timeout"
+	SettingDeviceCodeExpirationTimeoutDefault = "600"
+
+	SettingDeviceCodeInterval        = "device_code_interval"
+	SettingDeviceCodeIntervalDefault = "5"
+
+	SettingMagicLinkURL        = "magic_link_url"
+	SettingMagicLinkURLDefault = ""
+
+	SettingMagicLinkExpirationTimeout        = "magic_link_exp_timeout"
+	SettingMagicLinkExpirationTimeoutDefault = "900"
+
+	SettingOTPExpirationTimeout        = "otp_exp_timeout"
+	SettingOTPExpirationTimeoutDefault = "300"
+
+	SettingDbBackend        = "db"
+	SettingDbBackendDefault = DbBackendMongo
+
+	SettingDbDSN        = "db_dsn"
+	SettingDbDSNDefault = ""
+
 	SettingDb        = "mongo"
 	SettingDbDefault = "mongo-useradm"
 
+	// how the tenants of the users are resolved, see tenants.go;
+	// tenantadm if its address is set, none otherwise
+	SettingTenantVerification        = "tenant_verification"
+	SettingTenantVerificationDefault = ""
+
+	// the tenant of all the users with the static tenant verification
+	SettingTenantStaticID        = "tenant_static_id"
+	SettingTenantStaticIDDefault = ""
+
+	SettingOperatorTenant        = "operator_tenant"
+	SettingOperatorTenantDefault = ""
+
+	// time in seconds the users of a tenant whose trial expired or whose
+	// payment is overdue may still log in
+	SettingTenantGracePeriod        = "tenant_grace_period"
+	SettingTenantGracePeriodDefault = "604800" // one week
+
 	SettingTenantAdmAddr        = "tenantadm_addr"
 	SettingTenantAdmAddrDefault = ""
 
+	// timeout of the requests to tenantadm, in seconds
+	SettingTenantAdmTimeout        = "tenantadm_timeout"
+	SettingTenantAdmTimeoutDefault = "10"
+
+	// retries of the requests to tenantadm failing transiently, and the
+	// wait before the first one in milliseconds, doubled for each next
+	SettingTenantAdmRetries               = "tenantadm_retries"
+	SettingTenantAdmRetriesDefault        = "2"
+	SettingTenantAdmRetryBackoffMs        = "tenantadm_retry_backoff_ms"
+	SettingTenantAdmRetryBackoffMsDefault = "100"
+
+	// consecutive failures after which the requests to tenantadm are
+	// suspended, and for how long in seconds
+	SettingTenantAdmBreakerThreshold        = "tenantadm_breaker_threshold"
+	SettingTenantAdmBreakerThresholdDefault = "5"
+	SettingTenantAdmBreakerCooldown         = "tenantadm_breaker_cooldown"
+	SettingTenantAdmBreakerCooldownDefault  = "30"
+
+	// resolve the users' tenants to the last known ones while tenantadm
+	// is unavailable
+	SettingTenantAdmFailOpen        = "tenantadm_fail_open"
+	SettingTenantAdmFailOpenDefault = false
+
 	SettingDbSSL        = "mongo_ssl"
 	SettingDbSSLDefault = false
 
 	SettingDbSSLSkipVerify        = "mongo_ssl_skipverify"
 	SettingDbSSLSkipVerifyDefault = false
 
+	SettingDbSSLCAPath        = "mongo_ssl_ca_path"
+	SettingDbSSLCAPathDefault = ""
+
+	SettingDbSSLCertPath        = "mongo_ssl_cert_path"
+	SettingDbSSLCertPathDefault = ""
+
+	SettingDbSSLKeyPath        = "mongo_ssl_key_path"
+	SettingDbSSLKeyPathDefault = ""
+
+	SettingPIIEncryptionKeyringPath        = "pii_encryption_keyring_path"
+	SettingPIIEncryptionKeyringPathDefault = ""
+
 	SettingDbUsername = "mongo_username"
 	SettingDbPassword = "mongo_password"
+
+	SettingDbPoolLimit        = "mongo_pool_limit"
+	SettingDbPoolLimitDefault = "0"
+
+	SettingDbMinPoolSize        = "mongo_min_pool_size"
+	SettingDbMinPoolSizeDefault = "0"
+
+	SettingDbMaxIdleTime        = "mongo_max_idle_time"
+	SettingDbMaxIdleTimeDefault = "0"
+
+	SettingDbTimeout        = "mongo_timeout"
+	SettingDbTimeoutDefault = "10"
+
+	SettingDbOperationTimeout        = "mongo_operation_timeout"
+	SettingDbOperationTimeoutDefault = "60"
+
+	SettingDbMigrationConcurrency        = "mongo_migration_concurrency"
+	SettingDbMigrationConcurrencyDefault = "4"
+
+	SettingDbIndexMode        = "mongo_index_mode"
+	SettingDbIndexModeDefault = "create"
+
+	SettingDeletedUsersRetention        = "deleted_users_retention"
+	SettingDeletedUsersRetentionDefault = "2592000" // 30 days
+
+	SettingDeletedUsersPurgeInterval        = "deleted_users_purge_interval"
+	SettingDeletedUsersPurgeIntervalDefault = "3600" // one hour
+
+	SettingExpiredUsersCheckInterval        = "expired_users_check_interval"
+	SettingExpiredUsersCheckIntervalDefault = "60"
+
+	SettingExpiredTokensCleanupInterval        = "expired_tokens_cleanup_interval"
+	SettingExpiredTokensCleanupIntervalDefault = "3600" // one hour
+
+	SettingPendingUsersTimeout        = "pending_users_timeout"
+	SettingPendingUsersTimeoutDefault = "300"
+
+	SettingPendingUsersReconcileInterval        = "pending_users_reconcile_interval"
+	SettingPendingUsersReconcileIntervalDefault = "60"
+
+	SettingTokenRevocationInterval        = "token_revocation_interval"
+	SettingTokenRevocationIntervalDefault = "5"
+
+	// URL the billing service receives the usage events at; the user
+	// counts aren't reported if not set
+	SettingUsageReportURL        = "usage_report_url"
+	SettingUsageReportURLDefault = ""
+
+	SettingUsageReportInterval        = "usage_report_interval"
+	SettingUsageReportIntervalDefault = "3600" // one hour
+
+	// SMTP server address, host:port; email notifications are disabled
+	// if not set
+	SettingSMTPAddress        = "smtp_address"
+	SettingSMTPAddressDefault = ""
+
+	SettingSMTPUsername = "smtp_username"
+	SettingSMTPPassword = "smtp_password"
+
+	SettingEmailSender        = "email_sender"
+	SettingEmailSenderDefault = "no-reply@mender.io"
+
+	// additional email addresses of the users, verified by the codes
+	// mailed to them; requires the SMTP server
+	SettingAdditionalEmails        = "additional_emails"
+	SettingAdditionalEmailsDefault = false
+
+	// Twilio account the one-time login codes are sent by SMS with;
+	// the codes go by email only if not set
+	SettingTwilioAccountSID        = "twilio_account_sid"
+	SettingTwilioAccountSIDDefault = ""
+
+	SettingTwilioAuthToken = "twilio_auth_token"
+
+	// phone number, or Twilio messaging service SID, the SMS are sent from
+	SettingSMSSender        = "sms_sender"
+	SettingSMSSenderDefault = ""
+
+	// email of the administrator created on startup if there are no
+	// users; single-tenant setups only
+	SettingBootstrapAdminEmail        = "bootstrap_admin_email"
+	SettingBootstrapAdminEmailDefault = ""
+
+	// provision demo users with known credentials on startup, set with
+	// the --demo flag of the server command
+	SettingDemo        = "demo"
+	SettingDemoDefault = false
+
+	// JSON file with the demo tenants and users; built-in ones are used
+	// if not set
+	SettingDemoDataPath        = "demo_data_path"
+	SettingDemoDataPathDefault = ""
+
+	// feature flags on for all tenants, separated with spaces; tenants
+	// can have them switched on or off via the internal API
+	SettingFeatures        = "features"
+	SettingFeaturesDefault = ""
+
+	// path of the JSON Schema the settings of tenants without own schema
+	// are validated against; not validated if not set
+	SettingSettingsSchemaPath        = "settings_schema_path"
+	SettingSettingsSchemaPathDefault = ""
+
+	// serve Swagger UI for the management API
+	// at /api/management/v1/useradm/docs
+	SettingSwaggerUI        = "swagger_ui"
+	SettingSwaggerUIDefault = false
+
+	// addresses or CIDR ranges of the proxies in front of the service,
+	// separated with spaces; the client address is taken from the
+	// X-Forwarded-For and X-Real-IP headers of their requests only
+	SettingTrustedProxies        = "trusted_proxies"
+	SettingTrustedProxiesDefault = ""
+
+	// cross-origin requests allowed to the management API;
+	// lists are separated with spaces
+	SettingCORSAllowedOrigins        = "cors_allowed_origins"
+	SettingCORSAllowedOriginsDefault = "*"
+
+	SettingCORSAllowedMethods        = "cors_allowed_methods"
+	SettingCORSAllowedMethodsDefault = "GET POST PUT PATCH DELETE OPTIONS"
+
+	SettingCORSAllowedHeaders        = "cors_allowed_headers"
+	SettingCORSAllowedHeadersDefault = "Accept Allow Content-Type Origin Authorization " +
+		"Idempotency-Key If-Match If-None-Match Accept-Encoding X-MEN-OTP " +
+		"Access-Control-Request-Headers Header-Access-Control-Request"
+
+	SettingCORSAllowCredentials        = "cors_allow_credentials"
+	SettingCORSAllowCredentialsDefault = false
+
+	SettingCORSMaxAge        = "cors_max_age"
+	SettingCORSMaxAgeDefault = "60"
+
+	// format of the access log, "simple" or "json"
+	SettingAccessLogFormat        = "access_log_format"
+	SettingAccessLogFormatDefault = "simple"
+
+	// fields of the JSON access log entries
+	SettingAccessLogFields        = "access_log_fields"
+	SettingAccessLogFieldsDefault = "time method path status latency_ms " +
+		"subject tenant_id request_id"
+
+	// fraction of the successful verification requests in the JSON
+	// access log
+	SettingAccessLogVerifySampleRate        = "access_log_verify_sample_rate"
+	SettingAccessLogVerifySampleRateDefault = "1"
+
+	// serve the metrics of the HTTP requests in the Prometheus text
+	// format at /api/internal/v1/useradm/metrics
+	SettingMetrics        = "metrics"
+	SettingMetricsDefault = false
+
+	// number of tenants the metrics are labelled with, the requests
+	// of the others are counted together
+	SettingMetricsMaxTenants        = "metrics_max_tenants"
+	SettingMetricsMaxTenantsDefault = "100"
+
+	// serve HTTPS if the certificate and its key are set
+	SettingTLSCertPath        = "tls_cert_path"
+	SettingTLSCertPathDefault = ""
+
+	SettingTLSKeyPath        = "tls_key_path"
+	SettingTLSKeyPathDefault = ""
+
+	SettingTLSMinVersion        = "tls_min_version"
+	SettingTLSMinVersionDefault = "1.2"
+
+	// cipher suites separated with spaces, Go defaults if not set
+	SettingTLSCipherSuites        = "tls_cipher_suites"
+	SettingTLSCipherSuitesDefault = ""
+
+	// interval in seconds between checks for a rotated certificate,
+	// not reloaded if 0
+	SettingTLSCertReloadInterval        = "tls_cert_reload_interval"
+	SettingTLSCertReloadIntervalDefault = "0"
+
+	// CA certificates client certificates on the internal API listener
+	// are verified against; client certificates are not required if not set
+	SettingInternalTLSClientCAPath        = "internal_tls_client_ca_path"
+	SettingInternalTLSClientCAPathDefault = ""
+
+	// subject alternative names and issuer common names of the client
+	// certificates allowed, separated with spaces; any if not set
+	SettingInternalTLSClientAllowedSANs        = "internal_tls_client_allowed_sans"
+	SettingInternalTLSClientAllowedSANsDefault = ""
+
+	SettingInternalTLSClientAllowedIssuers        = "internal_tls_client_allowed_issuers"
+	SettingInternalTLSClientAllowedIssuersDefault = ""
 )
 
 var (
 	configDefaults = []config.Default{
 		{Key: SettingListen, Value: SettingListenDefault},
+		{Key: SettingListenInternal, Value: SettingListenInternalDefault},
+		{Key: SettingDebugEndpoints, Value: SettingDebugEndpointsDefault},
+		{Key: SettingHTTPMaxBodySize, Value: SettingHTTPMaxBodySizeDefault},
+		{Key: SettingHTTPMaxHeaderBytes, Value: SettingHTTPMaxHeaderBytesDefault},
+		{Key: SettingHTTPGzip, Value: SettingHTTPGzipDefault},
+		{Key: SettingHTTPReadHeaderTimeout, Value: SettingHTTPReadHeaderTimeoutDefault},
+		{Key: SettingHTTPReadTimeout, Value: SettingHTTPReadTimeoutDefault},
+		{Key: SettingHTTPWriteTimeout, Value: SettingHTTPWriteTimeoutDefault},
+		{Key: SettingHTTPIdleTimeout, Value: SettingHTTPIdleTimeoutDefault},
+		{Key: SettingHTTPRequestTimeout, Value: SettingHTTPRequestTimeoutDefault},
+		{Key: SettingMaintenanceMode, Value: SettingMaintenanceModeDefault},
+		{Key: SettingMaintenanceRetryAfter, Value: SettingMaintenanceRetryAfterDefault},
+		{Key: SettingMaintenanceRefreshInterval, Value: SettingMaintenanceRefreshIntervalDefault},
+		{Key: SettingLogLevel, Value: SettingLogLevelDefault},
 		{Key: SettingMiddleware, Value: SettingMiddlewareDefault},
 		{Key: SettingPrivKeyPath, Value: SettingPrivKeyPathDefault},
 		{Key: SettingJWTIssuer, Value: SettingJWTIssuerDefault},
 		{Key: SettingJWTExpirationTimeout, Value: SettingJWTExpirationTimeoutDefault},
+		{Key: SettingJWTLeeway, Value: SettingJWTLeewayDefault},
+		{Key: SettingImpersonationExpirationTimeout, Value: SettingImpersonationExpirationTimeoutDefault},
+		{Key: SettingServiceAccountExpirationTimeout, Value: SettingServiceAccountExpirationTimeoutDefault},
+		{Key: SettingTokenFormat, Value: SettingTokenFormatDefault},
+		{Key: SettingTokenFormatRejectJWT, Value: SettingTokenFormatRejectJWTDefault},
+		{Key: SettingTokenExchangeExpirationTimeout, Value: SettingTokenExchangeExpirationTimeoutDefault},
+		{Key: SettingOIDCURL, Value: SettingOIDCURLDefault},
+		{Key: SettingOIDCCodeExpirationTimeout, Value: SettingOIDCCodeExpirationTimeoutDefault},
+		{Key: SettingDeviceVerificationURL, Value: SettingDeviceVerificationURLDefault},
+		{Key: SettingDeviceCodeExpirationTimeout, Value: SettingDeviceCodeExpirationTimeoutDefault},
+		{Key: SettingDeviceCodeInterval, Value: SettingDeviceCodeIntervalDefault},
+		{Key: SettingMagicLinkURL, Value: SettingMagicLinkURLDefault},
+		{Key: SettingMagicLinkExpirationTimeout, Value: SettingMagicLinkExpirationTimeoutDefault},
+		{Key: SettingOTPExpirationTimeout, Value: SettingOTPExpirationTimeoutDefault},
+		{Key: SettingDbBackend, Value: SettingDbBackendDefault},
+		{Key: SettingDbDSN, Value: SettingDbDSNDefault},
 		{Key: SettingDb, Value: SettingDbDefault},
+		{Key: SettingTenantVerification, Value: SettingTenantVerificationDefault},
+		{Key: SettingTenantStaticID, Value: SettingTenantStaticIDDefault},
+		{Key: SettingOperatorTenant, Value: SettingOperatorTenantDefault},
+		{Key: SettingTenantGracePeriod, Value: SettingTenantGracePeriodDefault},
 		{Key: SettingTenantAdmAddr, Value: SettingTenantAdmAddrDefault},
+		{Key: SettingTenantAdmTimeout, Value: SettingTenantAdmTimeoutDefault},
+		{Key: SettingTenantAdmRetries, Value: SettingTenantAdmRetriesDefault},
+		{Key: SettingTenantAdmRetryBackoffMs, Value: SettingTenantAdmRetryBackoffMsDefault},
+		{Key: SettingTenantAdmBreakerThreshold, Value: SettingTenantAdmBreakerThresholdDefault},
+		{Key: SettingTenantAdmBreakerCooldown, Value: SettingTenantAdmBreakerCooldownDefault},
+		{Key: SettingTenantAdmFailOpen, Value: SettingTenantAdmFailOpenDefault},
 		{Key: SettingDbSSL, Value: SettingDbSSLDefault},
 		{Key: SettingDbSSLSkipVerify, Value: SettingDbSSLSkipVerifyDefault},
+		{Key: SettingDbSSLCAPath, Value: SettingDbSSLCAPathDefault},
+		{Key: SettingDbSSLCertPath, Value: SettingDbSSLCertPathDefault},
+		{Key: SettingDbSSLKeyPath, Value: SettingDbSSLKeyPathDefault},
+		{Key: SettingPIIEncryptionKeyringPath, Value: SettingPIIEncryptionKeyringPathDefault},
+		{Key: SettingDbPoolLimit, Value: SettingDbPoolLimitDefault},
+		{Key: SettingDbMinPoolSize, Value: SettingDbMinPoolSizeDefault},
+		{Key: SettingDbMaxIdleTime, Value: SettingDbMaxIdleTimeDefault},
+		{Key: SettingDbTimeout, Value: SettingDbTimeoutDefault},
+		{Key: SettingDbOperationTimeout, Value: SettingDbOperationTimeoutDefault},
+		{Key: SettingDbMigrationConcurrency, Value: SettingDbMigrationConcurrencyDefault},
+		{Key: SettingDbIndexMode, Value: SettingDbIndexModeDefault},
+		{Key: SettingDeletedUsersRetention, Value: SettingDeletedUsersRetentionDefault},
+		{Key: SettingDeletedUsersPurgeInterval, Value: SettingDeletedUsersPurgeIntervalDefault},
+		{Key: SettingExpiredUsersCheckInterval, Value: SettingExpiredUsersCheckIntervalDefault},
+		{Key: SettingExpiredTokensCleanupInterval, Value: SettingExpiredTokensCleanupIntervalDefault},
+		{Key: SettingPendingUsersTimeout, Value: SettingPendingUsersTimeoutDefault},
+		{Key: SettingPendingUsersReconcileInterval, Value: SettingPendingUsersReconcileIntervalDefault},
+		{Key: SettingTokenRevocationInterval, Value: SettingTokenRevocationIntervalDefault},
+		{Key: SettingUsageReportURL, Value: SettingUsageReportURLDefault},
+		{Key: SettingUsageReportInterval, Value: SettingUsageReportIntervalDefault},
+		{Key: SettingSMTPAddress, Value: SettingSMTPAddressDefault},
+		{Key: SettingAdditionalEmails, Value: SettingAdditionalEmailsDefault},
+		{Key: SettingEmailSender, Value: SettingEmailSenderDefault},
+		{Key: SettingTwilioAccountSID, Value: SettingTwilioAccountSIDDefault},
+		{Key: SettingSMSSender, Value: SettingSMSSenderDefault},
+		{Key: SettingBootstrapAdminEmail, Value: SettingBootstrapAdminEmailDefault},
+		{Key: SettingDemo, Value: SettingDemoDefault},
+		{Key: SettingDemoDataPath, Value: SettingDemoDataPathDefault},
+		{Key: SettingFeatures, Value: SettingFeaturesDefault},
+		{Key: SettingSettingsSchemaPath, Value: SettingSettingsSchemaPathDefault},
+		{Key: SettingSwaggerUI, Value: SettingSwaggerUIDefault},
+		{Key: SettingTrustedProxies, Value: SettingTrustedProxiesDefault},
+		{Key: SettingCORSAllowedOrigins, Value: SettingCORSAllowedOriginsDefault},
+		{Key: SettingCORSAllowedMethods, Value: SettingCORSAllowedMethodsDefault},
+		{Key: SettingCORSAllowedHeaders, Value: SettingCORSAllowedHeadersDefault},
+		{Key: SettingCORSAllowCredentials, Value: SettingCORSAllowCredentialsDefault},
+		{Key: SettingCORSMaxAge, Value: SettingCORSMaxAgeDefault},
+		{Key: SettingAccessLogFormat, Value: SettingAccessLogFormatDefault},
+		{Key: SettingAccessLogFields, Value: SettingAccessLogFieldsDefault},
+		{Key: SettingAccessLogVerifySampleRate,
+			Value: SettingAccessLogVerifySampleRateDefault},
+		{Key: SettingMetrics, Value: SettingMetricsDefault},
+		{Key: SettingMetricsMaxTenants, Value: SettingMetricsMaxTenantsDefault},
+		{Key: SettingTLSCertPath, Value: SettingTLSCertPathDefault},
+		{Key: SettingTLSKeyPath, Value: SettingTLSKeyPathDefault},
+		{Key: SettingTLSMinVersion, Value: SettingTLSMinVersionDefault},
+		{Key: SettingTLSCipherSuites, Value: SettingTLSCipherSuitesDefault},
+		{Key: SettingTLSCertReloadInterval, Value: SettingTLSCertReloadIntervalDefault},
+		{Key: SettingInternalTLSClientCAPath, Value: SettingInternalTLSClientCAPathDefault},
+		{Key: SettingInternalTLSClientAllowedSANs, Value: SettingInternalTLSClientAllowedSANsDefault},
+		{Key: SettingInternalTLSClientAllowedIssuers, Value: SettingInternalTLSClientAllowedIssuersDefault},
 	}
 )
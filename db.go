@@ -1,4 +1,4 @@
-// Copyright 2017 Northern.tech AS
+// Copyright 2018 Northern.tech AS
 //
 //    Licensed under the Apache License, Version 2.0 (the "License");
 //    you may not use this file except in compliance with the License.
@@ -11,23 +11,64 @@
 //    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 //    See the License for the specific language governing permissions and
 //    limitations under the License.
-
 package main
 
 import (
+	"time"
+
 	"github.com/mendersoftware/go-lib-micro/config"
+
+	"github.com/mendersoftware/useradm/store"
+	"github.com/mendersoftware/useradm/store/memory"
 	"github.com/mendersoftware/useradm/store/mongo"
 )
 
+const (
+	DbBackendMongo  = mongo.DriverName
+	DbBackendMemory = memory.DriverName
+)
+
 // Helper for mapping application configuration to DataStoreMongoConfig
 func dataStoreMongoConfigFromAppConfig(c config.Reader) mongo.DataStoreMongoConfig {
+	connectionString := c.GetString(SettingDb)
+	if dsn := c.GetString(SettingDbDSN); dsn != "" {
+		connectionString = dsn
+	}
+
 	return mongo.DataStoreMongoConfig{
-		ConnectionString: c.GetString(SettingDb),
+		ConnectionString: connectionString,
 
 		SSL:           c.GetBool(SettingDbSSL),
 		SSLSkipVerify: c.GetBool(SettingDbSSLSkipVerify),
+		SSLCAPath:     c.GetString(SettingDbSSLCAPath),
+		SSLCertPath:   c.GetString(SettingDbSSLCertPath),
+		SSLKeyPath:    c.GetString(SettingDbSSLKeyPath),
+
+		EncryptionKeyringPath: c.GetString(SettingPIIEncryptionKeyringPath),
 
 		Username: c.GetString(SettingDbUsername),
 		Password: c.GetString(SettingDbPassword),
+
+		PoolLimit:   c.GetInt(SettingDbPoolLimit),
+		MinPoolSize: c.GetInt(SettingDbMinPoolSize),
+		MaxIdleTime: time.Duration(c.GetInt(SettingDbMaxIdleTime)) * time.Second,
+
+		Timeout:          time.Duration(c.GetInt(SettingDbTimeout)) * time.Second,
+		OperationTimeout: time.Duration(c.GetInt(SettingDbOperationTimeout)) * time.Second,
+
+		MigrationConcurrency: c.GetInt(SettingDbMigrationConcurrency),
 	}
 }
+
+// Helper for opening the datastore with the driver selected in the
+// application configuration; the mongo datastore is opened with the
+// mongo settings, which don't fit in its data source name
+func dataStoreFromAppConfig(c config.Reader) (store.DataStore, store.TenantDataKeeper, error) {
+	backend, dsn := c.GetString(SettingDbBackend), c.GetString(SettingDbDSN)
+	if backend == mongo.DriverName {
+		d := &mongo.Driver{Config: dataStoreMongoConfigFromAppConfig(c)}
+		return d.Open(dsn)
+	}
+
+	return store.Open(backend, dsn)
+}
@@ -15,6 +15,7 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	cmocks "github.com/mendersoftware/go-lib-micro/config/mocks"
 	"github.com/stretchr/testify/assert"
@@ -23,15 +24,36 @@ import (
 func TestDataStoreMongoConfigFromAppConfig(t *testing.T) {
 	appConf := &cmocks.Reader{}
 	appConf.On("GetString", SettingDb).Return("192.123.123.123")
+	appConf.On("GetString", SettingDbDSN).Return("")
 	appConf.On("GetBool", SettingDbSSL).Return(true)
 	appConf.On("GetBool", SettingDbSSLSkipVerify).Return(false)
+	appConf.On("GetString", SettingDbSSLCAPath).Return("/etc/ca.pem")
+	appConf.On("GetString", SettingDbSSLCertPath).Return("/etc/cert.pem")
+	appConf.On("GetString", SettingDbSSLKeyPath).Return("/etc/key.pem")
+	appConf.On("GetString", SettingPIIEncryptionKeyringPath).Return("/etc/keyring")
 	appConf.On("GetString", SettingDbUsername).Return("Steven")
 	appConf.On("GetString", SettingDbPassword).Return("Shamballa")
+	appConf.On("GetInt", SettingDbPoolLimit).Return(16)
+	appConf.On("GetInt", SettingDbMinPoolSize).Return(2)
+	appConf.On("GetInt", SettingDbMaxIdleTime).Return(300)
+	appConf.On("GetInt", SettingDbTimeout).Return(5)
+	appConf.On("GetInt", SettingDbOperationTimeout).Return(30)
+	appConf.On("GetInt", SettingDbMigrationConcurrency).Return(8)
 
 	dbConf := dataStoreMongoConfigFromAppConfig(appConf)
 	assert.Equal(t, "192.123.123.123", dbConf.ConnectionString)
 	assert.Equal(t, true, dbConf.SSL)
 	assert.Equal(t, false, dbConf.SSLSkipVerify)
+	assert.Equal(t, "/etc/ca.pem", dbConf.SSLCAPath)
+	assert.Equal(t, "/etc/cert.pem", dbConf.SSLCertPath)
+	assert.Equal(t, "/etc/key.pem", dbConf.SSLKeyPath)
+	assert.Equal(t, "/etc/keyring", dbConf.EncryptionKeyringPath)
 	assert.Equal(t, "Steven", dbConf.Username)
 	assert.Equal(t, "Shamballa", dbConf.Password)
+	assert.Equal(t, 16, dbConf.PoolLimit)
+	assert.Equal(t, 2, dbConf.MinPoolSize)
+	assert.Equal(t, 5*time.Minute, dbConf.MaxIdleTime)
+	assert.Equal(t, 5*time.Second, dbConf.Timeout)
+	assert.Equal(t, 30*time.Second, dbConf.OperationTimeout)
+	assert.Equal(t, 8, dbConf.MigrationConcurrency)
 }
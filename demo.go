@@ -0,0 +1,153 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+	useradm "github.com/mendersoftware/useradm/user"
+)
+
+// demoData is the set of tenants and users provisioned in demo mode;
+// it's read from a JSON file with the same layout
+type demoData struct {
+	Tenants []demoTenant `json:"tenants"`
+}
+
+type demoTenant struct {
+	// tenant ID, empty for the default tenant
+	ID    string     `json:"id"`
+	Users []demoUser `json:"users"`
+}
+
+type demoUser struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// defaultDemoData is provisioned if no demo data file is configured
+var defaultDemoData = demoData{
+	Tenants: []demoTenant{
+		{
+			Users: []demoUser{
+				{Email: "admin@demo.mender.io", Password: "demo-admin"},
+				{Email: "user@demo.mender.io", Password: "demo-user"},
+			},
+		},
+	},
+}
+
+func loadDemoData(path string) (*demoData, error) {
+	if path == "" {
+		return &defaultDemoData, nil
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read demo data")
+	}
+
+	data := &demoData{}
+	if err := json.Unmarshal(raw, data); err != nil {
+		return nil, errors.Wrap(err, "failed to parse demo data")
+	}
+
+	return data, nil
+}
+
+// provisionDemoData creates the demo tenants and users which don't exist
+// yet; it refuses to touch a tenant having users other than the demo ones,
+// so that demo mode can't be turned on over real data by accident
+func provisionDemoData(ctx context.Context, ua useradm.App, data *demoData) error {
+	l := log.FromContext(ctx)
+
+	missing := make([][]*model.UserInternal, len(data.Tenants))
+	for i, t := range data.Tenants {
+		tctx := getTenantContext(t.ID)
+
+		if t.ID != "" {
+			if err := ua.CreateTenant(tctx, model.NewTenant{ID: t.ID}); err != nil {
+				return err
+			}
+		}
+
+		users, err := ua.GetUsers(tctx, model.UserFilter{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to get users of %s", tenantName(t.ID))
+		}
+
+		demo := make(map[string]bool, len(t.Users))
+		for _, u := range t.Users {
+			demo[model.NormalizeEmail(u.Email)] = true
+		}
+		existing := make(map[string]bool, len(users))
+		for _, u := range users {
+			if !demo[u.Email] {
+				return errors.Errorf("%s has users other than the demo ones, "+
+					"refusing to provision demo data", tenantName(t.ID))
+			}
+			existing[u.Email] = true
+		}
+
+		for _, u := range t.Users {
+			if !existing[model.NormalizeEmail(u.Email)] {
+				missing[i] = append(missing[i], newDemoUser(u))
+			}
+		}
+	}
+
+	// nothing is created unless all the demo users are valid
+	for _, users := range missing {
+		for _, u := range users {
+			if err := u.ValidateNew(); err != nil {
+				return errors.Wrapf(err, "invalid demo user %s", u.Email)
+			}
+		}
+	}
+
+	for i, t := range data.Tenants {
+		tctx := getTenantContext(t.ID)
+
+		for _, u := range missing[i] {
+			if err := ua.CreateUserInternal(tctx, u); err != nil {
+				return errors.Wrapf(err, "failed to create demo user %s", u.Email)
+			}
+		}
+
+		for _, u := range t.Users {
+			l.Warnf("demo mode: %s: log in as %s with password %s",
+				tenantName(t.ID), u.Email, u.Password)
+		}
+	}
+
+	return nil
+}
+
+func newDemoUser(u demoUser) *model.UserInternal {
+	// tenantadm doesn't know the demo tenants
+	propagate := false
+	return &model.UserInternal{
+		User: model.User{
+			Email:    u.Email,
+			Password: u.Password,
+		},
+		Propagate: &propagate,
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+)
+
+func TestProvisionDemoData(t *testing.T) {
+	data := &demoData{
+		Tenants: []demoTenant{
+			{
+				Users: []demoUser{
+					{Email: "admin@demo.mender.io", Password: "demo-admin"},
+					{Email: "user@demo.mender.io", Password: "demo-user"},
+				},
+			},
+			{
+				ID: "demo",
+				Users: []demoUser{
+					{Email: "admin@tenant.demo.mender.io", Password: "demo-admin"},
+				},
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		data *demoData
+
+		users       []model.User
+		createErr   error
+		tenantErr   error
+		getUsersErr error
+
+		created []string
+		err     error
+	}{
+		"ok": {
+			data: data,
+			created: []string{"admin@demo.mender.io", "user@demo.mender.io",
+				"admin@tenant.demo.mender.io"},
+		},
+		"ok, provisioned already": {
+			data: data,
+			users: []model.User{
+				{Email: "user@demo.mender.io"},
+			},
+			created: []string{"admin@demo.mender.io",
+				"admin@tenant.demo.mender.io"},
+		},
+		"error: real data": {
+			data: data,
+			users: []model.User{
+				{Email: "foo@bar.com"},
+			},
+			err: errors.New("default tenant has users other than the demo ones, " +
+				"refusing to provision demo data"),
+		},
+		"error: invalid user": {
+			data: &demoData{
+				Tenants: []demoTenant{
+					{
+						Users: []demoUser{
+							{Email: "admin@demo.mender.io", Password: "demo-admin"},
+							{Email: "user@demo.mender.io", Password: "short"},
+						},
+					},
+				},
+			},
+			err: errors.New("invalid demo user user@demo.mender.io: " +
+				model.ErrPasswordTooShort.Error()),
+		},
+		"error: tenant": {
+			data:      data,
+			tenantErr: errors.New("failed to apply migrations for tenant demo"),
+			err:       errors.New("failed to apply migrations for tenant demo"),
+		},
+		"error: get users": {
+			data:        data,
+			getUsersErr: errors.New("db connection failed"),
+			err:         errors.New("failed to get users of default tenant: db connection failed"),
+		},
+		"error: create": {
+			data:      data,
+			createErr: errors.New("db connection failed"),
+			created:   []string{"admin@demo.mender.io"},
+			err: errors.New("failed to create demo user admin@demo.mender.io: " +
+				"db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			var created []string
+
+			ua := &museradm.App{}
+			ua.On("CreateTenant", mock.Anything, model.NewTenant{ID: "demo"}).
+				Return(tc.tenantErr)
+			ua.On("GetUsers", mock.Anything, model.UserFilter{}).
+				Return(func(ctx context.Context, fltr model.UserFilter) []model.User {
+					// the demo tenant is empty
+					if identity.FromContext(ctx) != nil {
+						return nil
+					}
+					return tc.users
+				}, tc.getUsersErr)
+			ua.On("CreateUserInternal", mock.Anything,
+				mock.AnythingOfType("*model.UserInternal")).
+				Run(func(args mock.Arguments) {
+					u := args.Get(1).(*model.UserInternal)
+					assert.False(t, u.ShouldPropagate())
+					created = append(created, u.Email)
+				}).
+				Return(tc.createErr)
+
+			err := provisionDemoData(context.Background(), ua, tc.data)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.created, created)
+		})
+	}
+}
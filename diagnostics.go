@@ -0,0 +1,71 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// the diagnostics are served at these paths on the internal listener
+const (
+	uriDebugPprof = "/debug/pprof/"
+	uriDebugVars  = "/debug/vars"
+)
+
+var startedAt = time.Now()
+
+func init() {
+	// memstats and cmdline are published by expvar itself
+	expvar.Publish("runtime", expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"goroutines":     runtime.NumGoroutine(),
+			"gomaxprocs":     runtime.GOMAXPROCS(0),
+			"cpus":           runtime.NumCPU(),
+			"cgo_calls":      runtime.NumCgoCall(),
+			"go_version":     runtime.Version(),
+			"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+		}
+	}))
+}
+
+// diagnosticsHandler serves the pprof profiles at uriDebugPprof and the
+// runtime stats at uriDebugVars, in expvar's JSON format
+func diagnosticsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(uriDebugPprof, pprof.Index)
+	mux.HandleFunc(uriDebugPprof+"cmdline", pprof.Cmdline)
+	mux.HandleFunc(uriDebugPprof+"profile", pprof.Profile)
+	mux.HandleFunc(uriDebugPprof+"symbol", pprof.Symbol)
+	mux.HandleFunc(uriDebugPprof+"trace", pprof.Trace)
+	mux.Handle(uriDebugVars, expvar.Handler())
+	return mux
+}
+
+// withDiagnostics passes on the requests to the diagnostics to their
+// handler, the rest to handler
+func withDiagnostics(handler http.Handler) http.Handler {
+	diagnostics := diagnosticsHandler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, uriDebugPprof) || r.URL.Path == uriDebugVars {
+			diagnostics.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithDiagnostics(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	handler := withDiagnostics(apiFilter(ok, true))
+
+	var tdata = []struct {
+		path   string
+		status int
+	}{
+		{"/api/internal/v1/useradm/auth/verify", http.StatusNoContent},
+		{"/api/management/v1/useradm/users", http.StatusNotFound},
+		{"/debug/pprof/", http.StatusOK},
+		{"/debug/pprof/goroutine?debug=1", http.StatusOK},
+		{"/debug/pprof/foo", http.StatusNotFound},
+		{"/debug/vars", http.StatusOK},
+	}
+
+	for _, td := range tdata {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, td.path, nil))
+		assert.Equal(t, td.status, rec.Code, td.path)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/vars", nil))
+	var vars struct {
+		Runtime map[string]interface{} `json:"runtime"`
+	}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &vars))
+	assert.Contains(t, vars.Runtime, "goroutines")
+	assert.Contains(t, vars.Runtime, "uptime_seconds")
+}
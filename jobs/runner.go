@@ -0,0 +1,133 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/satori/go.uuid"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+// ErrSkipped is returned by the jobs which didn't run this time, e.g.
+// in maintenance mode; the run is recorded as skipped
+var ErrSkipped = errors.New("job skipped")
+
+// Store records the runs of the jobs, and hands out the leases letting
+// a single instance of the service run a job at a time
+type Store interface {
+	SaveJobRun(ctx context.Context, run *model.JobRun) error
+	// AcquireJobLease makes holder the holder of the job's lease until
+	// the given time, unless another holder's lease hasn't expired;
+	// returns false in that case
+	AcquireJobLease(ctx context.Context, name, holder string, until time.Time) (bool, error)
+}
+
+// Job is a task run in the background at an interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Runner runs the jobs in the background of the service, each in its
+// own goroutine, recording every run in the store
+type Runner struct {
+	store Store
+	// lease holder of this instance
+	holder string
+	jobs   []Job
+}
+
+func NewRunner(store Store) *Runner {
+	return &Runner{
+		store:  store,
+		holder: uuid.NewV4().String(),
+	}
+}
+
+// Add schedules the job to run every interval once the runner is
+// started; a job with no interval is disabled
+func (r *Runner) Add(name string, interval time.Duration,
+	run func(ctx context.Context) error) {
+	if interval <= 0 {
+		return
+	}
+	r.jobs = append(r.jobs, Job{
+		Name:     name,
+		Interval: interval,
+		Run:      run,
+	})
+}
+
+// Start runs the jobs until the context is cancelled, each first right
+// away
+func (r *Runner) Start(ctx context.Context) {
+	for _, job := range r.jobs {
+		go r.schedule(ctx, job)
+	}
+}
+
+func (r *Runner) schedule(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.RunOnce(ctx, job)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce runs the job and records the run, unless another instance of
+// the service holds the job's lease for this interval; failures are logged
+func (r *Runner) RunOnce(ctx context.Context, job Job) {
+	l := log.FromContext(ctx)
+
+	now := time.Now().UTC()
+	leased, err := r.store.AcquireJobLease(ctx, job.Name, r.holder, now.Add(job.Interval))
+	if err != nil {
+		l.Errorf("failed to acquire the lease of job %s: %v", job.Name, err)
+		return
+	}
+	if !leased {
+		return
+	}
+
+	run := model.JobRun{
+		Name:      job.Name,
+		StartedTs: now,
+	}
+	err = job.Run(ctx)
+	run.FinishedTs = time.Now().UTC()
+	switch {
+	case err == ErrSkipped:
+		run.Skipped = true
+	case err != nil:
+		run.Error = err.Error()
+		l.Errorf("job %s failed: %v", job.Name, err)
+	}
+
+	if err := r.store.SaveJobRun(ctx, &run); err != nil {
+		l.Warnf("failed to record run of job %s: %v", job.Name, err)
+	}
+}
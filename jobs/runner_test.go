@@ -0,0 +1,148 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/store/memory"
+)
+
+func TestRunnerRunOnce(t *testing.T) {
+	db := memory.NewDataStoreMemory()
+	r := NewRunner(db)
+
+	ctx := context.Background()
+
+	job := Job{
+		Name: "foo",
+		Run: func(ctx context.Context) error {
+			return nil
+		},
+	}
+	r.RunOnce(ctx, job)
+	job.Run = func(ctx context.Context) error {
+		return errors.New("failed")
+	}
+	r.RunOnce(ctx, job)
+
+	statuses, err := db.GetJobStatuses(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 1)
+
+	status := statuses[0]
+	assert.Equal(t, "foo", status.Name)
+	assert.Equal(t, 2, status.Runs)
+	assert.Equal(t, 1, status.Failures)
+	assert.Equal(t, "failed", status.LastError)
+	// the first run succeeded
+	assert.NotNil(t, status.LastSuccessTs)
+	assert.False(t, status.LastSuccessTs.After(status.LastStartedTs))
+}
+
+func TestRunnerRunOnceSkipped(t *testing.T) {
+	db := memory.NewDataStoreMemory()
+	r := NewRunner(db)
+
+	ctx := context.Background()
+
+	r.RunOnce(ctx, Job{
+		Name: "foo",
+		Run: func(ctx context.Context) error {
+			return ErrSkipped
+		},
+	})
+
+	statuses, err := db.GetJobStatuses(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 1)
+
+	status := statuses[0]
+	assert.Equal(t, 0, status.Runs)
+	assert.Equal(t, 0, status.Failures)
+	assert.Equal(t, 1, status.Skips)
+	assert.Nil(t, status.LastSuccessTs)
+	assert.NotNil(t, status.LastSkippedTs)
+}
+
+func TestRunnerRunOnceLeased(t *testing.T) {
+	db := memory.NewDataStoreMemory()
+
+	// instances of the service sharing the store
+	r1 := NewRunner(db)
+	r2 := NewRunner(db)
+
+	ctx := context.Background()
+
+	runs := 0
+	job := Job{
+		Name:     "foo",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			runs++
+			return nil
+		},
+	}
+
+	r1.RunOnce(ctx, job)
+	r2.RunOnce(ctx, job)
+	r1.RunOnce(ctx, job)
+	assert.Equal(t, 2, runs)
+
+	statuses, err := db.GetJobStatuses(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, 2, statuses[0].Runs)
+
+	// the lease of a job without an interval expires right away
+	job.Interval = 0
+	job.Name = "bar"
+	r1.RunOnce(ctx, job)
+	r2.RunOnce(ctx, job)
+	assert.Equal(t, 4, runs)
+}
+
+func TestRunnerStart(t *testing.T) {
+	db := memory.NewDataStoreMemory()
+	r := NewRunner(db)
+
+	runs := make(chan string, 10)
+	r.Add("foo", time.Millisecond, func(ctx context.Context) error {
+		runs <- "foo"
+		return nil
+	})
+	// disabled
+	r.Add("bar", 0, func(ctx context.Context) error {
+		runs <- "bar"
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.Start(ctx)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case name := <-runs:
+			assert.Equal(t, "foo", name)
+		case <-time.After(time.Second):
+			t.Fatal("job not run")
+		}
+	}
+	cancel()
+}
@@ -28,12 +28,44 @@ type Claims struct {
 	Scope     string `json:"scp,omitempty" bson:"scp,omitempty"`
 	Tenant    string `json:"mender.tenant,omitempty" bson:"tenant,omitempty"`
 	User      bool   `json:"mender.user,omitempty" bson:"user,omitempty"`
+	// names of the user's groups
+	Groups []string `json:"mender.groups,omitempty" bson:"groups,omitempty"`
+	// the super-admin acting as the user, for impersonation tokens
+	Impersonator string `json:"mender.impersonator,omitempty" bson:"impersonator,omitempty"`
+	// set for the tokens of the OAuth clients, whose ID is the subject
+	Client bool `json:"mender.client,omitempty" bson:"client,omitempty"`
+	// set for the tokens of the service accounts, whose ID is the subject
+	ServiceAccount bool `json:"mender.service_account,omitempty" bson:"service_account,omitempty"`
+	// the client acting as the user, for the tokens exchanged for the
+	// users', see RFC 8693 4.1
+	Actor *Actor `json:"act,omitempty" bson:"act,omitempty"`
+
+	// OpenID Connect ID token claims, see model.OIDCConfiguration
+	Nonce    string `json:"nonce,omitempty" bson:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty" bson:"auth_time,omitempty"`
+	Email    string `json:"email,omitempty" bson:"email,omitempty"`
+	Name     string `json:"name,omitempty" bson:"name,omitempty"`
+}
+
+// Actor is the party acting on behalf of the token's subject
+type Actor struct {
+	Subject string `json:"sub" bson:"sub"`
+	// the prior actor, for the tokens exchanged more than once
+	Actor *Actor `json:"act,omitempty" bson:"act,omitempty"`
 }
 
 // Valid checks if claims are valid. Returns error if validation fails.
-// Note that for now we're only using iss, exp, sub, scp.
+// Note that for now we're only using iss, exp, nbf, iat, sub, scp.
 // Basic checks are done here, field correctness (e.g. issuer) - at the service level, where this info is available.
 func (c *Claims) Valid() error {
+	return c.ValidAt(time.Now(), 0)
+}
+
+// ValidAt checks the claims at the given time, tolerating the clocks of the
+// issuer and the verifier drifting up to leeway apart: the token is
+// accepted for leeway past its expiration, and as long before it's valid
+// from or issued at
+func (c *Claims) ValidAt(now time.Time, leeway time.Duration) error {
 	if c.Issuer == "" ||
 		c.ExpiresAt == 0 ||
 		c.Subject == "" ||
@@ -41,14 +73,14 @@ func (c *Claims) Valid() error {
 		return ErrTokenInvalid
 	}
 
-	if !verifyExp(c.ExpiresAt) {
+	ts, skew := now.Unix(), int64(leeway/time.Second)
+	if ts > c.ExpiresAt+skew {
 		return ErrTokenExpired
 	}
+	// a token issued in the future is a sure sign of the clocks drifting
+	if ts < c.NotBefore-skew || ts < c.IssuedAt-skew {
+		return ErrTokenNotValidYet
+	}
 
 	return nil
 }
-
-func verifyExp(exp int64) bool {
-	now := time.Now().Unix()
-	return now <= exp
-}
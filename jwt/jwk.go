@@ -0,0 +1,52 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package jwt
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"math/big"
+)
+
+// JWK is the public key in the JSON Web Key format, see RFC 7517
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+// JWKS is a set of keys, as published for the token verifiers
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK describes the RSA key the tokens are signed with; the key ID is
+// derived from the modulus, so it stays the same across restarts
+func NewJWK(pub *rsa.PublicKey) JWK {
+	n := pub.N.Bytes()
+	kid := sha256.Sum256(n)
+
+	return JWK{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: "RS256",
+		KeyID:     base64.RawURLEncoding.EncodeToString(kid[:8]),
+		Modulus:   base64.RawURLEncoding.EncodeToString(n),
+		Exponent:  base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
@@ -14,15 +14,19 @@
 package jwt
 
 import (
+	"context"
 	"crypto/rsa"
+	"sync"
+	"time"
 
 	jwtgo "github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
 )
 
 var (
-	ErrTokenExpired = errors.New("jwt: token expired")
-	ErrTokenInvalid = errors.New("jwt: token invalid")
+	ErrTokenExpired     = errors.New("jwt: token expired")
+	ErrTokenInvalid     = errors.New("jwt: token invalid")
+	ErrTokenNotValidYet = errors.New("jwt: token not valid yet")
 )
 
 // JWTHandler jwt generator/verifier
@@ -31,13 +35,48 @@ type Handler interface {
 	// FromJWT parses the token and does basic validity checks (Claims.Valid().
 	// returns:
 	// ErrTokenExpired when the token is valid but expired
+	// ErrTokenNotValidYet when the token is valid but used before its nbf or iat
 	// ErrTokenInvalid when the token is invalid (malformed, missing required claims, etc.)
 	FromJWT(string) (*Token, error)
+	// PublicKeys returns the keys the tokens are currently verified
+	// with, the current one first
+	PublicKeys() []*rsa.PublicKey
+}
+
+// ContextHandler is a Handler which parses the tokens in the context of
+// the request, e.g. logging with its logger
+type ContextHandler interface {
+	Handler
+	FromJWTWithContext(ctx context.Context, tokstr string) (*Token, error)
+}
+
+// FromJWT parses the token with the handler, in the given context
+// if it's a ContextHandler
+func FromJWT(ctx context.Context, h Handler, tokstr string) (*Token, error) {
+	if ch, ok := h.(ContextHandler); ok {
+		return ch.FromJWTWithContext(ctx, tokstr)
+	}
+	return h.FromJWT(tokstr)
 }
 
 // JWTHandlerRS256 is an RS256-specific JWTHandler
 type JWTHandlerRS256 struct {
+	mu      sync.RWMutex
 	privKey *rsa.PrivateKey
+	// keys replaced by SetPrivateKey, still accepted when verifying
+	// until they retire
+	prevKeys []retiredKey
+	// how long the replaced keys are kept, the longest lifetime of
+	// the tokens they signed
+	keyRetention time.Duration
+	// tolerated drift of the clocks, see Claims.ValidAt
+	leeway time.Duration
+}
+
+// retiredKey is a key replaced by SetPrivateKey
+type retiredKey struct {
+	key   *rsa.PublicKey
+	until time.Time
 }
 
 func NewJWTHandlerRS256(privKey *rsa.PrivateKey) *JWTHandlerRS256 {
@@ -46,22 +85,87 @@ func NewJWTHandlerRS256(privKey *rsa.PrivateKey) *JWTHandlerRS256 {
 	}
 }
 
+// WithLeeway makes the handler tolerate the clocks of the hosts issuing the
+// tokens drifting up to leeway apart from its own
+func (j *JWTHandlerRS256) WithLeeway(leeway time.Duration) *JWTHandlerRS256 {
+	j.leeway = leeway
+	return j
+}
+
+// WithKeyRetention makes the handler accept the tokens signed with
+// the keys replaced by SetPrivateKey for the given time after the
+// replacement; it should be the longest lifetime of the issued tokens
+func (j *JWTHandlerRS256) WithKeyRetention(retention time.Duration) *JWTHandlerRS256 {
+	j.keyRetention = retention
+	return j
+}
+
+// SetPrivateKey makes the handler sign tokens with the given key;
+// the tokens signed with the previous keys remain valid for the key
+// retention time, after which the keys are dropped
+func (j *JWTHandlerRS256) SetPrivateKey(privKey *rsa.PrivateKey) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if privKey.PublicKey.N.Cmp(j.privKey.PublicKey.N) == 0 &&
+		privKey.PublicKey.E == j.privKey.PublicKey.E {
+		return
+	}
+
+	now := time.Now()
+	prevKeys := j.prevKeys[:0]
+	for _, k := range j.prevKeys {
+		if now.Before(k.until) {
+			prevKeys = append(prevKeys, k)
+		}
+	}
+	j.prevKeys = append(prevKeys, retiredKey{
+		key:   &j.privKey.PublicKey,
+		until: now.Add(j.keyRetention + j.leeway),
+	})
+	j.privKey = privKey
+}
+
+// verificationKeys returns the current key and the retired ones
+// still valid at now
+func (j *JWTHandlerRS256) verificationKeys(now time.Time) []*rsa.PublicKey {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	keys := []*rsa.PublicKey{&j.privKey.PublicKey}
+	for _, k := range j.prevKeys {
+		if now.Before(k.until) {
+			keys = append(keys, k.key)
+		}
+	}
+	return keys
+}
+
 func (j *JWTHandlerRS256) ToJWT(token *Token) (string, error) {
+	j.mu.RLock()
+	privKey := j.privKey
+	j.mu.RUnlock()
+
 	//generate
 	jt := jwtgo.NewWithClaims(jwtgo.SigningMethodRS256, &token.Claims)
 
 	//sign
-	data, err := jt.SignedString(j.privKey)
+	data, err := jt.SignedString(privKey)
 	return data, err
 }
 
 func (j *JWTHandlerRS256) FromJWT(tokstr string) (*Token, error) {
-	jwttoken, err := jwtgo.ParseWithClaims(tokstr, &Claims{}, func(token *jwtgo.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwtgo.SigningMethodRSA); !ok {
-			return nil, errors.New("unexpected signing method: " + token.Method.Alg())
+	pubKeys := j.verificationKeys(time.Now())
+
+	var jwttoken *jwtgo.Token
+	var err error
+	for _, pubKey := range pubKeys {
+		jwttoken, err = parseRS256(tokstr, pubKey)
+		if verr, ok := err.(*jwtgo.ValidationError); !ok ||
+			verr.Errors&jwtgo.ValidationErrorSignatureInvalid == 0 {
+			break
 		}
-		return &j.privKey.PublicKey, nil
-	})
+	}
 
 	// our Claims return Mender-specific validation errors
 	// go-jwt will wrap them in a generic ValidationError - unwrap and return directly
@@ -77,6 +181,9 @@ func (j *JWTHandlerRS256) FromJWT(tokstr string) (*Token, error) {
 	token := Token{}
 
 	if claims, ok := jwttoken.Claims.(*Claims); ok && jwttoken.Valid {
+		if err := claims.ValidAt(time.Now(), j.leeway); err != nil {
+			return nil, err
+		}
 		token.Claims = *claims
 		token.Id = claims.ID
 		return &token, nil
@@ -84,3 +191,20 @@ func (j *JWTHandlerRS256) FromJWT(tokstr string) (*Token, error) {
 		return nil, ErrTokenInvalid
 	}
 }
+
+// PublicKeys returns the current key and the replaced ones which
+// haven't retired yet
+func (j *JWTHandlerRS256) PublicKeys() []*rsa.PublicKey {
+	return j.verificationKeys(time.Now())
+}
+
+func parseRS256(tokstr string, pubKey *rsa.PublicKey) (*jwtgo.Token, error) {
+	// the claims are checked by the handler, with its leeway
+	parser := &jwtgo.Parser{SkipClaimsValidation: true}
+	return parser.ParseWithClaims(tokstr, &Claims{}, func(token *jwtgo.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwtgo.SigningMethodRSA); !ok {
+			return nil, errors.New("unexpected signing method: " + token.Method.Alg())
+		}
+		return pubKey, nil
+	})
+}
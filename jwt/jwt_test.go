@@ -14,11 +14,14 @@
 package jwt
 
 import (
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"io/ioutil"
 	"testing"
+	"time"
 
 	jwtgo "github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
@@ -180,6 +183,141 @@ func TestJWTHandlerRS256FromJWT(t *testing.T) {
 	}
 }
 
+func TestJWTHandlerRS256FromJWTLeeway(t *testing.T) {
+	privKey := loadPrivKey("../crypto/private.pem", t)
+	now := time.Now()
+
+	testCases := map[string]struct {
+		claims Claims
+		leeway time.Duration
+
+		outErr error
+	}{
+		"ok: expired within the leeway": {
+			claims: Claims{
+				ExpiresAt: now.Add(-30 * time.Second).Unix(),
+			},
+			leeway: time.Minute,
+		},
+		"ok: issued ahead within the leeway": {
+			claims: Claims{
+				IssuedAt:  now.Add(30 * time.Second).Unix(),
+				NotBefore: now.Add(30 * time.Second).Unix(),
+				ExpiresAt: now.Add(time.Hour).Unix(),
+			},
+			leeway: time.Minute,
+		},
+		"error: expired": {
+			claims: Claims{
+				ExpiresAt: now.Add(-30 * time.Second).Unix(),
+			},
+			outErr: ErrTokenExpired,
+		},
+		"error: expired past the leeway": {
+			claims: Claims{
+				ExpiresAt: now.Add(-2 * time.Minute).Unix(),
+			},
+			leeway: time.Minute,
+			outErr: ErrTokenExpired,
+		},
+		"error: issued ahead": {
+			claims: Claims{
+				IssuedAt:  now.Add(30 * time.Second).Unix(),
+				ExpiresAt: now.Add(time.Hour).Unix(),
+			},
+			outErr: ErrTokenNotValidYet,
+		},
+		"error: not valid before": {
+			claims: Claims{
+				NotBefore: now.Add(2 * time.Minute).Unix(),
+				ExpiresAt: now.Add(time.Hour).Unix(),
+			},
+			leeway: time.Minute,
+			outErr: ErrTokenNotValidYet,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+		jwtHandler := NewJWTHandlerRS256(privKey).WithLeeway(tc.leeway)
+
+		tc.claims.Issuer = "Mender"
+		tc.claims.Subject = "foo"
+		tc.claims.Scope = "mender.*"
+		raw, err := jwtHandler.ToJWT(&Token{Claims: tc.claims})
+		assert.NoError(t, err)
+
+		token, err := jwtHandler.FromJWT(raw)
+		if tc.outErr != nil {
+			assert.Equal(t, tc.outErr, err)
+			assert.Nil(t, token)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, tc.claims, token.Claims)
+		}
+	}
+}
+
+func TestJWTHandlerRS256SetPrivateKey(t *testing.T) {
+	oldKey := loadPrivKey("../crypto/private.pem", t)
+	newKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+
+	token := &Token{
+		Claims: Claims{
+			ID:        "someid",
+			Subject:   "foo",
+			Issuer:    "Mender",
+			ExpiresAt: 2147483647,
+			Scope:     "mender.*",
+		},
+	}
+
+	jwtHandler := NewJWTHandlerRS256(oldKey).WithKeyRetention(time.Hour)
+	oldRaw, err := jwtHandler.ToJWT(token)
+	assert.NoError(t, err)
+
+	// setting the same key again is a no-op
+	jwtHandler.SetPrivateKey(oldKey)
+	assert.Empty(t, jwtHandler.prevKeys)
+
+	jwtHandler.SetPrivateKey(newKey)
+	newRaw, err := jwtHandler.ToJWT(token)
+	assert.NoError(t, err)
+
+	// new tokens are signed with the new key
+	_ = parseGeneratedTokenRS256(t, newRaw, newKey)
+
+	// the tokens signed with either key verify
+	for _, raw := range []string{oldRaw, newRaw} {
+		parsed, err := jwtHandler.FromJWT(raw)
+		if assert.NoError(t, err) {
+			assert.Equal(t, token.Claims, parsed.Claims)
+		}
+	}
+
+	// but not the ones signed with an unknown key
+	otherRaw, err := NewJWTHandlerRS256(otherKey).ToJWT(token)
+	assert.NoError(t, err)
+	_, err = jwtHandler.FromJWT(otherRaw)
+	assert.EqualError(t, err, rsa.ErrVerification.Error())
+
+	// the old key retires after the retention time, and is dropped
+	// on the next replacement
+	jwtHandler.prevKeys[0].until = time.Now().Add(-time.Second)
+	_, err = jwtHandler.FromJWT(oldRaw)
+	assert.EqualError(t, err, rsa.ErrVerification.Error())
+
+	jwtHandler.SetPrivateKey(otherKey)
+	if assert.Len(t, jwtHandler.prevKeys, 1) {
+		assert.Equal(t, &newKey.PublicKey, jwtHandler.prevKeys[0].key)
+	}
+	_, err = jwtHandler.FromJWT(newRaw)
+	assert.NoError(t, err)
+}
+
 func loadPrivKey(path string, t *testing.T) *rsa.PrivateKey {
 	pem_data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -215,3 +353,38 @@ func parseGeneratedTokenRS256(t *testing.T, token string, key *rsa.PrivateKey) *
 
 	return tokenParsed
 }
+
+func TestJWTHandlerRS256PublicKeys(t *testing.T) {
+	privKey := loadPrivKey("../crypto/private.pem", t)
+	jwtHandler := NewJWTHandlerRS256(privKey).WithKeyRetention(time.Hour)
+
+	assert.Equal(t, []*rsa.PublicKey{&privKey.PublicKey}, jwtHandler.PublicKeys())
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	jwtHandler.SetPrivateKey(newKey)
+
+	assert.Equal(t, []*rsa.PublicKey{&newKey.PublicKey, &privKey.PublicKey},
+		jwtHandler.PublicKeys())
+
+	// the retired keys are no longer published
+	jwtHandler.prevKeys[0].until = time.Now().Add(-time.Second)
+	assert.Equal(t, []*rsa.PublicKey{&newKey.PublicKey}, jwtHandler.PublicKeys())
+}
+
+func TestNewJWK(t *testing.T) {
+	privKey := loadPrivKey("../crypto/private.pem", t)
+
+	jwk := NewJWK(&privKey.PublicKey)
+	assert.Equal(t, "RSA", jwk.KeyType)
+	assert.Equal(t, "sig", jwk.Use)
+	assert.Equal(t, "RS256", jwk.Algorithm)
+	assert.Equal(t, "AQAB", jwk.Exponent)
+	assert.NotEmpty(t, jwk.KeyID)
+
+	n, err := base64.RawURLEncoding.DecodeString(jwk.Modulus)
+	assert.NoError(t, err)
+	assert.Equal(t, privKey.PublicKey.N.Bytes(), n)
+
+	assert.Equal(t, jwk, NewJWK(&privKey.PublicKey))
+}
@@ -13,6 +13,7 @@
 //    limitations under the License.
 package mocks
 
+import rsa "crypto/rsa"
 import jwt "github.com/mendersoftware/useradm/jwt"
 import mock "github.com/stretchr/testify/mock"
 
@@ -44,6 +45,22 @@ func (_m *Handler) FromJWT(_a0 string) (*jwt.Token, error) {
 	return r0, r1
 }
 
+// PublicKeys provides a mock function with given fields:
+func (_m *Handler) PublicKeys() []*rsa.PublicKey {
+	ret := _m.Called()
+
+	var r0 []*rsa.PublicKey
+	if rf, ok := ret.Get(0).(func() []*rsa.PublicKey); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]*rsa.PublicKey)
+		}
+	}
+
+	return r0
+}
+
 // ToJWT provides a mock function with given fields: t
 func (_m *Handler) ToJWT(t *jwt.Token) (string, error) {
 	ret := _m.Called(t)
@@ -0,0 +1,120 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package keys
+
+import (
+	"context"
+	"crypto/tls"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ErrMsgCertLoadFailed = "failed to load server certificate"
+)
+
+// CertLoader holds the server TLS certificate and reloads it
+// from its files when they are rotated
+type CertLoader struct {
+	certPath string
+	keyPath  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewCertLoader loads the certificate and its private key
+// from the given PEM files
+func NewCertLoader(certPath, keyPath string) (*CertLoader, error) {
+	l := &CertLoader{
+		certPath: certPath,
+		keyPath:  keyPath,
+	}
+
+	modTime, err := l.lastModified()
+	if err != nil {
+		return nil, errors.Wrap(err, ErrMsgCertLoadFailed)
+	}
+
+	if err := l.load(modTime); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// GetCertificate returns the current certificate,
+// for use in tls.Config.GetCertificate
+func (l *CertLoader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.cert, nil
+}
+
+// Reload loads the certificate again if its files were modified
+// since the last load; the current certificate is kept on errors
+func (l *CertLoader) Reload(ctx context.Context) error {
+	modTime, err := l.lastModified()
+	if err != nil {
+		return errors.Wrap(err, ErrMsgCertLoadFailed)
+	}
+
+	l.mu.RLock()
+	unchanged := !modTime.After(l.modTime)
+	l.mu.RUnlock()
+
+	if unchanged {
+		return nil
+	}
+
+	return l.load(modTime)
+}
+
+func (l *CertLoader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(l.certPath, l.keyPath)
+	if err != nil {
+		return errors.Wrap(err, ErrMsgCertLoadFailed)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.cert = &cert
+	l.modTime = modTime
+
+	return nil
+}
+
+// lastModified returns the modification time
+// of the most recently modified file
+func (l *CertLoader) lastModified() (time.Time, error) {
+	var modTime time.Time
+
+	for _, path := range []string{l.certPath, l.keyPath} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if fi.ModTime().After(modTime) {
+			modTime = fi.ModTime()
+		}
+	}
+
+	return modTime, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package keys
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCertLoader(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		certPath string
+		keyPath  string
+		err      bool
+	}{
+		{
+			certPath: "testdata/cert.pem",
+			keyPath:  "testdata/cert_key.pem",
+		},
+		{
+			certPath: "wrong_path",
+			keyPath:  "testdata/cert_key.pem",
+			err:      true,
+		},
+		{
+			certPath: "testdata/cert.pem",
+			keyPath:  "testdata/cert_rotated_key.pem",
+			err:      true,
+		},
+		{
+			certPath: "testdata/cert.pem",
+			keyPath:  "testdata/private_broken.pem",
+			err:      true,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			l, err := NewCertLoader(tc.certPath, tc.keyPath)
+			if tc.err {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), ErrMsgCertLoadFailed)
+			} else {
+				assert.NoError(t, err)
+				cert, err := l.GetCertificate(nil)
+				assert.NoError(t, err)
+				assert.NotNil(t, cert)
+			}
+		})
+	}
+}
+
+func TestCertLoaderReload(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "useradm-cert")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+
+	install := func(cert, key string, modTime time.Time) {
+		for src, dst := range map[string]string{cert: certPath, key: keyPath} {
+			data, err := ioutil.ReadFile(src)
+			assert.NoError(t, err)
+			assert.NoError(t, ioutil.WriteFile(dst, data, 0600))
+			assert.NoError(t, os.Chtimes(dst, modTime, modTime))
+		}
+	}
+
+	now := time.Now()
+	install("testdata/cert.pem", "testdata/cert_key.pem", now.Add(-time.Hour))
+
+	l, err := NewCertLoader(certPath, keyPath)
+	assert.NoError(t, err)
+	first, _ := l.GetCertificate(nil)
+
+	// unchanged files
+	assert.NoError(t, l.Reload(context.Background()))
+	cert, _ := l.GetCertificate(nil)
+	assert.Equal(t, first, cert)
+
+	// rotation in progress, the certificate doesn't match the key yet
+	install("testdata/cert_rotated.pem", "testdata/cert_key.pem", now)
+	assert.Error(t, l.Reload(context.Background()))
+	cert, _ = l.GetCertificate(nil)
+	assert.Equal(t, first, cert)
+
+	// rotated
+	install("testdata/cert_rotated.pem", "testdata/cert_rotated_key.pem", now.Add(time.Minute))
+	assert.NoError(t, l.Reload(context.Background()))
+	cert, _ = l.GetCertificate(nil)
+	assert.NotEqual(t, first.Certificate[0], cert.Certificate[0])
+}
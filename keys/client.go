@@ -0,0 +1,110 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package keys
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ErrMsgCAReadFailed      = "failed to read CA certificates file"
+	ErrMsgCANotPEMEncoded   = "no PEM-encoded CA certificates found"
+	ErrMsgClientCertMissing = "client certificate missing"
+	ErrMsgClientNotAllowed  = "client certificate not allowed"
+)
+
+// LoadCertPool reads the PEM encoded CA certificates from the given file
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrMsgCAReadFailed)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, errors.New(ErrMsgCANotPEMEncoded)
+	}
+
+	return pool, nil
+}
+
+// ClientCertVerifier restricts the client certificates accepted, on top of
+// their verification against the CA; empty lists allow any value
+type ClientCertVerifier struct {
+	// subject alternative names, DNS names, URIs, emails or IPs,
+	// one of which the certificate must have
+	AllowedSANs []string
+
+	// common names of the issuers allowed
+	AllowedIssuers []string
+}
+
+// VerifyPeerCertificate checks the client certificate of the verified
+// chains, for use in tls.Config.VerifyPeerCertificate
+func (v *ClientCertVerifier) VerifyPeerCertificate(rawCerts [][]byte,
+	verifiedChains [][]*x509.Certificate) error {
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+		return errors.New(ErrMsgClientCertMissing)
+	}
+
+	cert := verifiedChains[0][0]
+
+	if len(v.AllowedIssuers) > 0 && !contains(v.AllowedIssuers, cert.Issuer.CommonName) {
+		return errors.Errorf("%s: issuer %s", ErrMsgClientNotAllowed,
+			cert.Issuer.CommonName)
+	}
+
+	if len(v.AllowedSANs) > 0 && !containsAny(v.AllowedSANs, subjectAltNames(cert)) {
+		return errors.Errorf("%s: subject %s", ErrMsgClientNotAllowed,
+			cert.Subject.CommonName)
+	}
+
+	return nil
+}
+
+func subjectAltNames(cert *x509.Certificate) []string {
+	names := []string{}
+
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+
+	return names
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list []string, values []string) bool {
+	for _, v := range values {
+		if contains(list, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package keys
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadCertPool(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		path string
+		err  string
+	}{
+		{
+			path: "testdata/ca.pem",
+		},
+		{
+			path: "wrong_path",
+			err:  ErrMsgCAReadFailed + ": open wrong_path: no such file or directory",
+		},
+		{
+			path: "testdata/private_broken.pem",
+			err:  ErrMsgCANotPEMEncoded,
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			pool, err := LoadCertPool(tc.path)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, pool)
+			}
+		})
+	}
+}
+
+func TestClientCertVerifier(t *testing.T) {
+	t.Parallel()
+
+	pemData, err := ioutil.ReadFile("testdata/client.pem")
+	assert.NoError(t, err)
+	block, _ := pem.Decode(pemData)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+
+	chains := [][]*x509.Certificate{{cert}}
+
+	testCases := map[string]struct {
+		verifier ClientCertVerifier
+		chains   [][]*x509.Certificate
+
+		err string
+	}{
+		"ok, any": {
+			chains: chains,
+		},
+		"ok, dns name": {
+			verifier: ClientCertVerifier{
+				AllowedSANs: []string{"deployments.internal", "tenantadm.internal"},
+			},
+			chains: chains,
+		},
+		"ok, uri and issuer": {
+			verifier: ClientCertVerifier{
+				AllowedSANs:    []string{"spiffe://mender/tenantadm"},
+				AllowedIssuers: []string{"Test Internal CA"},
+			},
+			chains: chains,
+		},
+		"error, san": {
+			verifier: ClientCertVerifier{
+				AllowedSANs: []string{"deployments.internal"},
+			},
+			chains: chains,
+			err:    ErrMsgClientNotAllowed + ": subject tenantadm",
+		},
+		"error, issuer": {
+			verifier: ClientCertVerifier{
+				AllowedIssuers: []string{"Other CA"},
+			},
+			chains: chains,
+			err:    ErrMsgClientNotAllowed + ": issuer Test Internal CA",
+		},
+		"error, no certificate": {
+			err: ErrMsgClientCertMissing,
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.verifier.VerifyPeerCertificate(nil, tc.chains)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
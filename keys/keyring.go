@@ -0,0 +1,96 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package keys
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ErrMsgKeyringReadFailed = "failed to read keyring file"
+	ErrMsgKeyringEmpty      = "no keys found in keyring"
+
+	// size of the keyring keys, for AES-256
+	KeyringKeySize = 32
+)
+
+// Keyring holds the keys data is encrypted with, by their ID; new data is
+// encrypted with the primary key, the others are kept to decrypt the data
+// encrypted before it was rotated
+type Keyring struct {
+	Primary string
+	Keys    map[string][]byte
+}
+
+// PrimaryKey returns the key new data is encrypted with
+func (k *Keyring) PrimaryKey() []byte {
+	return k.Keys[k.Primary]
+}
+
+// LoadKeyring reads the keys from the given file, one per line as
+// "<id> <base64 encoded 256-bit key>"; the first one is the primary key,
+// empty lines and the ones starting with '#' are ignored
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, ErrMsgKeyringReadFailed)
+	}
+
+	keyring := &Keyring{
+		Keys: map[string][]byte{},
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errors.Errorf("keyring line %d: want \"<id> <key>\"", n)
+		}
+		id := fields[0]
+
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "keyring line %d: key not base64 encoded", n)
+		}
+		if len(key) != KeyringKeySize {
+			return nil, errors.Errorf("keyring line %d: key must be %d bytes, got %d",
+				n, KeyringKeySize, len(key))
+		}
+		if _, ok := keyring.Keys[id]; ok {
+			return nil, errors.Errorf("keyring line %d: duplicate key ID %s", n, id)
+		}
+
+		keyring.Keys[id] = key
+		if keyring.Primary == "" {
+			keyring.Primary = id
+		}
+	}
+
+	if keyring.Primary == "" {
+		return nil, errors.New(ErrMsgKeyringEmpty)
+	}
+
+	return keyring, nil
+}
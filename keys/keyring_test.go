@@ -0,0 +1,69 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package keys
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadKeyring(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		path string
+
+		primary string
+		ids     []string
+		err     string
+	}{
+		{
+			path:    "testdata/keyring",
+			primary: "2018-06",
+			ids:     []string{"2018-01", "2018-06"},
+		},
+		{
+			path: "wrong_path",
+			err:  ErrMsgKeyringReadFailed + ": open wrong_path: no such file or directory",
+		},
+		{
+			path: "testdata/keyring_broken",
+			err:  "keyring line 2: key must be 32 bytes, got 5",
+		},
+		{
+			path: "testdata/ca.pem",
+			err:  "keyring line 1: key not base64 encoded: illegal base64 data at input byte 11",
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %d", i), func(t *testing.T) {
+			t.Parallel()
+
+			keyring, err := LoadKeyring(tc.path)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.primary, keyring.Primary)
+				assert.Len(t, keyring.PrimaryKey(), KeyringKeySize)
+				for _, id := range tc.ids {
+					assert.Contains(t, keyring.Keys, id)
+				}
+			}
+		})
+	}
+}
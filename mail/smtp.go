@@ -0,0 +1,121 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// number of messages waiting for delivery, above which
+	// new messages are rejected
+	smtpQueueSize = 100
+)
+
+var (
+	ErrQueueFull = errors.New("mail queue is full")
+)
+
+type SMTPConfig struct {
+	// SMTP server address, host:port
+	Address string
+
+	// credentials, optional
+	Username string
+	Password string
+
+	// sender address
+	From string
+}
+
+type sendMailFunc func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+// SMTPMailer delivers messages through an SMTP server
+type SMTPMailer struct {
+	config   SMTPConfig
+	queue    chan Message
+	sendMail sendMailFunc
+}
+
+// NewSMTPMailer returns a mailer delivering messages in the background
+func NewSMTPMailer(config SMTPConfig) *SMTPMailer {
+	m := newSMTPMailer(config, smtp.SendMail)
+	go m.run()
+	return m
+}
+
+func newSMTPMailer(config SMTPConfig, sendMail sendMailFunc) *SMTPMailer {
+	return &SMTPMailer{
+		config:   config,
+		queue:    make(chan Message, smtpQueueSize),
+		sendMail: sendMail,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	select {
+	case m.queue <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (m *SMTPMailer) run() {
+	l := log.NewEmpty()
+
+	for msg := range m.queue {
+		if err := m.deliver(msg); err != nil {
+			l.Errorf("failed to send email to %s: %v", msg.To, err)
+		}
+	}
+}
+
+func (m *SMTPMailer) deliver(msg Message) error {
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		host, _, err := net.SplitHostPort(m.config.Address)
+		if err != nil {
+			return errors.Wrap(err, "invalid SMTP server address")
+		}
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, host)
+	}
+
+	return m.sendMail(m.config.Address, auth, m.config.From,
+		[]string{msg.To}, m.format(msg))
+}
+
+func (m *SMTPMailer) format(msg Message) []byte {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "From: %s\r\n", m.config.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Body)
+
+	return b.Bytes()
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mail
+
+import (
+	"context"
+	"errors"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMTPMailerDeliver(t *testing.T) {
+	testCases := map[string]struct {
+		config  SMTPConfig
+		sendErr error
+
+		auth bool
+		err  error
+	}{
+		"ok": {
+			config: SMTPConfig{
+				Address: "localhost:25",
+				From:    "no-reply@mender.io",
+			},
+		},
+		"ok, with auth": {
+			config: SMTPConfig{
+				Address:  "localhost:25",
+				Username: "user",
+				Password: "secret",
+				From:     "no-reply@mender.io",
+			},
+			auth: true,
+		},
+		"error, invalid address": {
+			config: SMTPConfig{
+				Address:  "localhost",
+				Username: "user",
+				Password: "secret",
+				From:     "no-reply@mender.io",
+			},
+			err: errors.New("invalid SMTP server address: address localhost: missing port in address"),
+		},
+		"error, send": {
+			config: SMTPConfig{
+				Address: "localhost:25",
+				From:    "no-reply@mender.io",
+			},
+			sendErr: errors.New("connection refused"),
+			err:     errors.New("connection refused"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		var sent []byte
+		m := newSMTPMailer(tc.config,
+			func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+				assert.Equal(t, tc.config.Address, addr)
+				assert.Equal(t, tc.auth, a != nil)
+				assert.Equal(t, tc.config.From, from)
+				assert.Equal(t, []string{"foo@bar.com"}, to)
+				sent = msg
+				return tc.sendErr
+			})
+
+		err := m.deliver(Message{
+			To:      "foo@bar.com",
+			Subject: "Password changed",
+			Body:    "Your password was changed.",
+		})
+
+		if tc.err != nil {
+			assert.EqualError(t, err, tc.err.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Contains(t, string(sent), "To: foo@bar.com\r\n")
+			assert.Contains(t, string(sent), "Subject: Password changed\r\n")
+			assert.True(t, strings.HasSuffix(string(sent),
+				"\r\n\r\nYour password was changed."))
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	m := newSMTPMailer(SMTPConfig{}, nil)
+
+	for i := 0; i < smtpQueueSize; i++ {
+		assert.NoError(t, m.Send(context.Background(), Message{To: "foo@bar.com"}))
+	}
+
+	assert.Equal(t, ErrQueueFull, m.Send(context.Background(), Message{To: "foo@bar.com"}))
+	assert.Len(t, m.queue, smtpQueueSize)
+}
@@ -46,6 +46,10 @@ func doMain(args []string) {
 			Name:  "dev",
 			Usage: "Use development setup",
 		},
+		cli.StringFlag{
+			Name:  "db",
+			Usage: "Datastore `DRIVER`, mongo or memory; overrides the configuration.",
+		},
 		cli.BoolFlag{
 			Name:        "debug",
 			Usage:       "Enable debug logging",
@@ -61,6 +65,10 @@ func doMain(args []string) {
 					Name:  "automigrate",
 					Usage: "Run database migrations before starting.",
 				},
+				cli.BoolFlag{
+					Name:  "demo",
+					Usage: "Provision demo users with known credentials.",
+				},
 			},
 
 			Action: runServer,
@@ -115,10 +123,132 @@ func doMain(args []string) {
 					Name:  "tenant",
 					Usage: "Takes ID of specific tenant to migrate.",
 				},
+				cli.BoolFlag{
+					Name:  "all-tenants",
+					Usage: "Migrate the databases of all the tenants.",
+				},
+				cli.StringFlag{
+					Name: "version",
+					Usage: "Version to migrate to, reverting the newer migrations " +
+						"if the database is past it.",
+					Value: mongo.DbVersion,
+				},
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "List the migrations to apply or revert, without running them.",
+				},
+				cli.BoolFlag{
+					Name:  "status",
+					Usage: "List the migrations applied and pending.",
+				},
 			},
 
 			Action: runMigrate,
 		},
+		{
+			Name:  "check",
+			Usage: "Check the data of all the tenants for inconsistencies",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "repair",
+					Usage: "Repair the inconsistencies which can be repaired automatically.",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Report as JSON.",
+				},
+			},
+			Action: runCheck,
+		},
+		{
+			Name:  "backup",
+			Usage: "Export users, groups and settings as JSON",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tenant-id",
+					Usage: "Tenant ID, if running a multitenant setup (optional).",
+				},
+				cli.BoolFlag{
+					Name:  "all-tenants",
+					Usage: "Back up all the tenants.",
+				},
+				cli.BoolFlag{
+					Name:  "with-password-hashes",
+					Usage: "Include the password hashes; users have to get new passwords otherwise.",
+				},
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "File to write the backup to, stdout if not set.",
+				},
+			},
+			Action: runBackup,
+		},
+		{
+			Name:  "restore",
+			Usage: "Import a backup into empty tenants; a failed restore can be run again",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tenant-id",
+					Usage: "Tenant to restore a single tenant backup to, e.g. to clone it (optional).",
+				},
+				cli.StringFlag{
+					Name:  "input",
+					Usage: "File to read the backup from, stdin if not set.",
+				},
+			},
+			Action: runRestore,
+		},
+		{
+			Name:  "list-users",
+			Usage: "List users",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "tenant-id",
+					Usage: "Tenant ID, if running a multitenant setup (optional).",
+				},
+			},
+			Action: runListUsers,
+		},
+		{
+			Name:  "delete-user",
+			Usage: "Delete user",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "username",
+					Usage: "Email or username of the user to delete",
+				},
+				cli.StringFlag{
+					Name:  "tenant-id",
+					Usage: "Tenant ID, if running a multitenant setup (optional).",
+				},
+			},
+			Action: runDeleteUser,
+		},
+		{
+			Name:  "assign-role",
+			Usage: "Add user to the group of the role, creating the group if needed",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "username",
+					Usage: "Email or username of the user",
+				},
+				cli.StringFlag{
+					Name:  "role",
+					Usage: "Name of the group granting the role",
+				},
+				cli.StringFlag{
+					Name:  "tenant-id",
+					Usage: "Tenant ID, if running a multitenant setup (optional).",
+				},
+			},
+			Action: runAssignRole,
+		},
+		{
+			Name: "check-config",
+			Usage: "Validate the configuration, key material and connectivity " +
+				"to the database and tenantadm",
+			Action: runCheckConfig,
+		},
 	}
 
 	app.Action = runServer
@@ -136,6 +266,21 @@ func doMain(args []string) {
 		config.Config.SetEnvPrefix("USERADM")
 		config.Config.AutomaticEnv()
 
+		if err := loadSecretFiles(config.Config); err != nil {
+			return cli.NewExitError(
+				fmt.Sprintf("error loading configuration: %s", err),
+				1)
+		}
+
+		if debug {
+			config.Config.Set(SettingLogLevel, "debug")
+		}
+		if err := setupLogLevel(config.Config); err != nil {
+			return cli.NewExitError(
+				fmt.Sprintf("error loading configuration: %s", err),
+				1)
+		}
+
 		return nil
 	}
 	app.Run(args)
@@ -151,9 +296,34 @@ func runServer(args *cli.Context) error {
 		config.Config.Set(SettingMiddleware, EnvDev)
 	}
 
+	if backend := args.GlobalString("db"); backend != "" {
+		config.Config.Set(SettingDbBackend, backend)
+	}
+
+	if args.Bool("demo") {
+		config.Config.Set(SettingDemo, true)
+	}
+
 	l.Printf("User Administration Service, version %s starting up",
 		CreateVersionString())
 
+	switch config.Config.GetString(SettingDbBackend) {
+	case DbBackendMongo:
+		if err := migrateMongo(args); err != nil {
+			return err
+		}
+	case DbBackendMemory:
+		l.Warnf("using in-memory datastore, all data will be lost on exit")
+	}
+
+	err := RunServer(config.Config)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 4)
+	}
+	return nil
+}
+
+func migrateMongo(args *cli.Context) error {
 	ctx := context.Background()
 
 	db, err := mongo.NewDataStoreMongo(dataStoreMongoConfigFromAppConfig(config.Config))
@@ -167,7 +337,7 @@ func runServer(args *cli.Context) error {
 		db = db.WithAutomigrate()
 	}
 
-	if config.Config.Get(SettingTenantAdmAddr) != "" {
+	if multitenant(config.Config) {
 		db = db.WithMultitenant()
 	}
 
@@ -178,10 +348,13 @@ func runServer(args *cli.Context) error {
 			3)
 	}
 
-	err = RunServer(config.Config)
+	err = db.SyncIndexes(ctx, config.Config.GetString(SettingDbIndexMode))
 	if err != nil {
-		return cli.NewExitError(err.Error(), 4)
+		return cli.NewExitError(
+			fmt.Sprintf("failed to sync indexes: %v", err),
+			3)
 	}
+
 	return nil
 }
 
@@ -195,7 +368,13 @@ func runCreateUser(args *cli.Context) error {
 }
 
 func runMigrate(args *cli.Context) error {
-	err := commandMigrate(config.Config, args.String("tenant"))
+	err := commandMigrate(config.Config, migrateOptions{
+		tenantId:   args.String("tenant"),
+		allTenants: args.Bool("all-tenants"),
+		version:    args.String("version"),
+		dryRun:     args.Bool("dry-run"),
+		status:     args.Bool("status"),
+	})
 	if err != nil {
 		return cli.NewExitError(err.Error(), 6)
 	}
@@ -210,3 +389,97 @@ func runSetPassword(args *cli.Context) error {
 	}
 	return nil
 }
+
+func runCheckConfig(args *cli.Context) error {
+	if args.GlobalBool("dev") {
+		config.Config.Set(SettingMiddleware, EnvDev)
+	}
+	if backend := args.GlobalString("db"); backend != "" {
+		config.Config.Set(SettingDbBackend, backend)
+	}
+
+	err := commandCheckConfig(config.Config, os.Stdout)
+	if err != nil {
+		return cli.NewExitError(err.Error(), 8)
+	}
+	return nil
+}
+
+func runListUsers(args *cli.Context) error {
+	err := commandListUsers(config.Config, os.Stdout, args.String("tenant-id"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 9)
+	}
+	return nil
+}
+
+func runDeleteUser(args *cli.Context) error {
+	err := commandDeleteUser(config.Config,
+		args.String("username"), args.String("tenant-id"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 10)
+	}
+	return nil
+}
+
+func runAssignRole(args *cli.Context) error {
+	err := commandAssignRole(config.Config,
+		args.String("username"), args.String("role"), args.String("tenant-id"))
+	if err != nil {
+		return cli.NewExitError(err.Error(), 11)
+	}
+	return nil
+}
+
+func runBackup(args *cli.Context) error {
+	w := os.Stdout
+	if path := args.String("output"); path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 12)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	err := commandBackup(config.Config, w, backupOptions{
+		tenantId:           args.String("tenant-id"),
+		allTenants:         args.Bool("all-tenants"),
+		withPasswordHashes: args.Bool("with-password-hashes"),
+	})
+	if err != nil {
+		return cli.NewExitError(err.Error(), 12)
+	}
+	return nil
+}
+
+func runRestore(args *cli.Context) error {
+	r := os.Stdin
+	if path := args.String("input"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return cli.NewExitError(err.Error(), 13)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	err := commandRestore(config.Config, r, backupOptions{
+		tenantId: args.String("tenant-id"),
+	})
+	if err != nil {
+		return cli.NewExitError(err.Error(), 13)
+	}
+	return nil
+}
+
+func runCheck(args *cli.Context) error {
+	err := commandCheck(config.Config, os.Stdout, checkOptions{
+		repair: args.Bool("repair"),
+		json:   args.Bool("json"),
+	})
+	if err != nil {
+		return cli.NewExitError(err.Error(), 14)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package metrics keeps counters and histograms in memory, exposed in
+// the Prometheus text format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the media type of the text format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Collector is a metric family written in the text format
+type Collector interface {
+	writeText(w *bufio.Writer)
+}
+
+// Registry holds the metrics exposed together
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) Register(c ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c...)
+}
+
+// WriteText writes all the metrics in the text format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]Collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.writeText(bw)
+	}
+	return bw.Flush()
+}
+
+// series keeps the values of a metric for one set of label values
+type series struct {
+	labels []string
+	value  float64
+
+	// histograms only
+	buckets []uint64
+	count   uint64
+}
+
+type family struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func newFamily(name, help string, labels []string) family {
+	return family{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: map[string]*series{},
+	}
+}
+
+// get returns the series of the label values, created by init
+// if there's none yet; the family has to be locked
+func (f *family) get(values []string, init func(*series)) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values",
+			f.name, len(f.labels), len(values)))
+	}
+
+	key := seriesKey(values)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labels: append([]string{}, values...)}
+		if init != nil {
+			init(s)
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// seriesKey identifies the series of the label values, ordering them
+// by the values
+func seriesKey(values []string) string {
+	return strings.Join(values, "\x00")
+}
+
+// sorted returns the series in a stable order; the family has to be locked
+func (f *family) sorted() []*series {
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	series := make([]*series, len(keys))
+	for i, k := range keys {
+		series[i] = f.series[k]
+	}
+	return series
+}
+
+func (f *family) writeHeader(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, typ)
+}
+
+// writeSample writes a sample with the label values, and the extra
+// label if set, e.g. the bucket bound of histograms
+func (f *family) writeSample(w *bufio.Writer, name string, values []string,
+	extraLabel, extraValue string, v float64) {
+
+	w.WriteString(name)
+	if len(values) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, l := range f.labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, l, values[i])
+		}
+		if extraLabel != "" {
+			if len(values) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeLabel(w *bufio.Writer, name, value string) {
+	w.WriteString(name)
+	w.WriteString(`="`)
+	labelValueEscaper.WriteString(w, value)
+	w.WriteByte('"')
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// CounterVec is a counter partitioned by the label values
+type CounterVec struct {
+	family
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{family: newFamily(name, help, labels)}
+}
+
+// Inc increments the counter of the label values, given in the
+// order of the labels
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) Add(v float64, values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(values, nil).value += v
+}
+
+// Value returns the counter of the label values
+func (c *CounterVec) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.series[seriesKey(values)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *CounterVec) writeText(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writeHeader(w, "counter")
+	for _, s := range c.sorted() {
+		c.writeSample(w, c.name, s.labels, "", "", s.value)
+	}
+}
+
+// DefaultBuckets are the upper bounds of the histogram buckets
+// of request latencies, in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HistogramVec is a histogram partitioned by the label values
+type HistogramVec struct {
+	family
+	bounds []float64
+}
+
+// NewHistogramVec returns a histogram with the buckets' upper bounds,
+// in increasing order; the +Inf bucket is implied
+func NewHistogramVec(name, help string, bounds []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{
+		family: newFamily(name, help, labels),
+		bounds: bounds,
+	}
+}
+
+// Observe adds v to the histogram of the label values, given in the
+// order of the labels
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := h.get(values, func(s *series) {
+		s.buckets = make([]uint64, len(h.bounds))
+	})
+	for i, b := range h.bounds {
+		if v <= b {
+			s.buckets[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+func (h *HistogramVec) writeText(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w, "histogram")
+	for _, s := range h.sorted() {
+		for i, b := range h.bounds {
+			h.writeSample(w, h.name+"_bucket", s.labels,
+				"le", formatFloat(b), float64(s.buckets[i]))
+		}
+		h.writeSample(w, h.name+"_bucket", s.labels,
+			"le", "+Inf", float64(s.count))
+		h.writeSample(w, h.name+"_sum", s.labels, "", "", s.value)
+		h.writeSample(w, h.name+"_count", s.labels, "", "", float64(s.count))
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package metrics
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryWriteText(t *testing.T) {
+	t.Parallel()
+
+	requests := NewCounterVec("requests_total", "Number of requests.",
+		"route", "status")
+	duration := NewHistogramVec("request_duration_seconds", "Duration of requests.",
+		[]float64{0.1, 1}, "route")
+
+	r := NewRegistry()
+	r.Register(requests, duration)
+
+	requests.Inc("/users", "200")
+	requests.Inc("/users", "200")
+	requests.Add(3, "/users/:id", "404")
+	requests.Inc(`/a"b\c`, "500")
+	duration.Observe(0.05, "/users")
+	duration.Observe(0.5, "/users")
+	duration.Observe(2, "/users")
+
+	assert.Equal(t, float64(2), requests.Value("/users", "200"))
+	assert.Equal(t, float64(0), requests.Value("/users", "500"))
+
+	var out bytes.Buffer
+	assert.NoError(t, r.WriteText(&out))
+	assert.Equal(t, `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{route="/a\"b\\c",status="500"} 1
+requests_total{route="/users",status="200"} 2
+requests_total{route="/users/:id",status="404"} 3
+# HELP request_duration_seconds Duration of requests.
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{route="/users",le="0.1"} 1
+request_duration_seconds_bucket{route="/users",le="1"} 2
+request_duration_seconds_bucket{route="/users",le="+Inf"} 3
+request_duration_seconds_sum{route="/users"} 2.55
+request_duration_seconds_count{route="/users"} 3
+`, out.String())
+}
+
+func TestCounterVecLabelValues(t *testing.T) {
+	t.Parallel()
+
+	c := NewCounterVec("requests_total", "Number of requests.", "route")
+	assert.Panics(t, func() {
+		c.Inc("/users", "200")
+	})
+}
+
+func TestTenantLabels(t *testing.T) {
+	t.Parallel()
+
+	l := NewTenantLabels(2)
+	assert.Equal(t, "", l.Label(""))
+	assert.Equal(t, "foo", l.Label("foo"))
+	assert.Equal(t, "bar", l.Label("bar"))
+	assert.Equal(t, OtherTenants, l.Label("baz"))
+	assert.Equal(t, "foo", l.Label("foo"))
+
+	l = NewTenantLabels(0)
+	assert.Equal(t, OtherTenants, l.Label("foo"))
+}
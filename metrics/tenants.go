@@ -0,0 +1,65 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package metrics
+
+import (
+	"sync"
+)
+
+// OtherTenants labels the metrics of the tenants over the limit
+const OtherTenants = "other"
+
+// TenantLabels limits the number of distinct tenant label values: the
+// first tenants seen get their own, the rest share OtherTenants, so
+// the number of series stays bounded however many tenants there are
+type TenantLabels struct {
+	max int
+
+	mu   sync.RWMutex
+	seen map[string]struct{}
+}
+
+// NewTenantLabels returns the labels of at most max tenants; tenants
+// aren't told apart if max is 0
+func NewTenantLabels(max int) *TenantLabels {
+	return &TenantLabels{
+		max:  max,
+		seen: map[string]struct{}{},
+	}
+}
+
+// Label returns the label value of the tenant, empty if there's none
+func (t *TenantLabels) Label(tenant string) string {
+	if tenant == "" {
+		return ""
+	}
+
+	t.mu.RLock()
+	_, ok := t.seen[tenant]
+	t.mu.RUnlock()
+	if ok {
+		return tenant
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.seen[tenant]; ok {
+		return tenant
+	}
+	if len(t.seen) >= t.max {
+		return OtherTenants
+	}
+	t.seen[tenant] = struct{}{}
+	return tenant
+}
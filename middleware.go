@@ -15,7 +15,8 @@ package main
 
 import (
 	"fmt"
-	"net/http"
+	"os"
+	"time"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/mendersoftware/go-lib-micro/accesslog"
@@ -25,6 +26,8 @@ import (
 	"github.com/mendersoftware/go-lib-micro/requestid"
 	"github.com/mendersoftware/go-lib-micro/requestlog"
 
+	"github.com/pkg/errors"
+
 	api_http "github.com/mendersoftware/useradm/api/http"
 	"github.com/mendersoftware/useradm/authz"
 	"github.com/mendersoftware/useradm/jwt"
@@ -33,16 +36,19 @@ import (
 const (
 	EnvProd = "prod"
 	EnvDev  = "dev"
+
+	// access log formats, see AccessLogConfig
+	AccessLogFormatSimple = "simple"
+	AccessLogFormatJSON   = "json"
 )
 
 var (
-	commonLoggingAccessStack = []rest.Middleware{
+	commonLoggingStack = []rest.Middleware{
 
 		// logging
 		&requestlog.RequestLogMiddleware{},
-		&accesslog.AccessLogMiddleware{Format: accesslog.SimpleLogFormat},
-		&rest.TimerMiddleware{},
-		&rest.RecorderMiddleware{},
+		// before anything that may log or fail the request
+		&api_http.RequestIdMiddleware{},
 	}
 
 	defaultDevStack = []rest.Middleware{
@@ -58,73 +64,140 @@ var (
 	defaultProdStack = []rest.Middleware{
 		// catches the panic errors
 		&rest.RecoverMiddleware{},
-
-		// response compression
-		&rest.GzipMiddleware{},
 	}
 
 	commonStack = []rest.Middleware{
-		// CORS
-		&rest.CorsMiddleware{
-			RejectNonCorsRequests: false,
-
-			// Should be tested with some list
-			OriginValidator: func(origin string, request *rest.Request) bool {
-				// Accept all requests
-				return true
-			},
-
-			// Preflight request cache length
-			AccessControlMaxAge: 60,
-
-			// Allow authentication requests
-			AccessControlAllowCredentials: true,
-
-			// Allowed headers
-			AllowedMethods: []string{
-				http.MethodGet,
-				http.MethodPost,
-				http.MethodPut,
-				http.MethodDelete,
-				http.MethodOptions,
-			},
-
-			// Allowed headers
-			AllowedHeaders: []string{
-				"Accept",
-				"Allow",
-				"Content-Type",
-				"Origin",
-				"Authorization",
-				"Accept-Encoding",
-				"Access-Control-Request-Headers",
-				"Header-Access-Control-Request",
-			},
-
-			// Headers that can be exposed to JS
-			AccessControlExposeHeaders: []string{
-				"Location",
-				"Link",
-			},
-		},
+		// drops anything the handlers write after their response
+		&api_http.SingleResponseMiddleware{},
 
 		// verifies the request Content-Type header
 		// The expected Content-Type is 'application/json'
-		// if the content is non-null
-		&rest.ContentTypeCheckerMiddleware{},
-		&requestid.RequestIdMiddleware{},
+		// if the content is non-null, merge patches, CSV
+		// imports and OAuth forms have their own media types
+		// and are checked by the handlers
+		&rest.IfMiddleware{
+			Condition: func(r *rest.Request) bool {
+				return !api_http.ChecksOwnContentType(r)
+			},
+			IfTrue: &rest.ContentTypeCheckerMiddleware{},
+		},
 		&identity.IdentityMiddleware{
 			UpdateLogger: true,
 		},
 	}
 
+	// headers that can be exposed to JS
+	corsExposeHeaders = []string{
+		"Location",
+		"Link",
+		"ETag",
+		"X-Total-Count",
+		requestid.RequestIdHeader,
+		api_http.RequestIdHeader,
+	}
+
 	middlewareMap = map[string][]rest.Middleware{
 		EnvProd: defaultProdStack,
 		EnvDev:  defaultDevStack,
 	}
 )
 
-func SetupMiddleware(api *rest.Api, mwtype string, authorizer authz.Authorizer, jwth jwt.Handler) error {
+// MiddlewareConfig holds the configurable parts of the middleware stack
+type MiddlewareConfig struct {
+	CORS CORSConfig
+
+	// maximum size of request bodies in bytes, not limited if 0
+	MaxBodySize int64
+
+	// compress responses with gzip if the client accepts it
+	Gzip bool
+
+	// deadline of the requests' contexts, not limited if 0
+	RequestTimeout time.Duration
+
+	// rejects requests modifying data while enabled, if set
+	Maintenance *api_http.Maintenance
+
+	AccessLog AccessLogConfig
+
+	// records the metrics of the requests, if set
+	Metrics *api_http.Metrics
+}
+
+// AccessLogConfig selects the format of the access log
+type AccessLogConfig struct {
+	// AccessLogFormatSimple, the default, for lines in the format of the
+	// service logs, AccessLogFormatJSON for JSON lines on stderr
+	Format string
+
+	// fields of the JSON entries, see api_http.AccessLogFields
+	Fields []string
+
+	// fraction of the successful verification requests logged in
+	// the JSON format
+	VerifySampleRate float64
+}
+
+// newAccessLogMiddleware sets up the access log; the status code and
+// the response time are recorded by the middlewares run after it
+func newAccessLogMiddleware(c AccessLogConfig) (rest.Middleware, error) {
+	switch c.Format {
+	case "", AccessLogFormatSimple:
+		return &accesslog.AccessLogMiddleware{Format: accesslog.SimpleLogFormat}, nil
+	case AccessLogFormatJSON:
+		return api_http.NewAccessLogMiddleware(os.Stderr, c.Fields, c.VerifySampleRate)
+	default:
+		return nil, errors.Errorf("unknown access log format %q, expected %q or %q",
+			c.Format, AccessLogFormatSimple, AccessLogFormatJSON)
+	}
+}
+
+// CORSConfig lists the cross-origin requests allowed to the management API
+type CORSConfig struct {
+	// origins allowed to make requests, "*" allows all
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+
+	// allow requests with credentials
+	AllowCredentials bool
+
+	// preflight request cache length, in seconds
+	MaxAge int
+}
+
+// newCORSMiddleware sets up CORS handling for the management API only,
+// the internal API is not meant to be called from browsers
+func newCORSMiddleware(c CORSConfig) rest.Middleware {
+	return &rest.IfMiddleware{
+		Condition: api_http.IsManagementEndpoint,
+		IfTrue: &rest.CorsMiddleware{
+			RejectNonCorsRequests: false,
+
+			OriginValidator: func(origin string, request *rest.Request) bool {
+				return corsOriginAllowed(c.AllowedOrigins, origin)
+			},
+
+			AccessControlMaxAge:           c.MaxAge,
+			AccessControlAllowCredentials: c.AllowCredentials,
+			AllowedMethods:                c.AllowedMethods,
+			AllowedHeaders:                c.AllowedHeaders,
+			AccessControlExposeHeaders:    corsExposeHeaders,
+		},
+	}
+}
+
+func corsOriginAllowed(allowed []string, origin string) bool {
+	for _, o := range allowed {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func SetupMiddleware(api *rest.Api, mwtype string, mwconfig MiddlewareConfig,
+	authorizer authz.Authorizer, jwth jwt.Handler) error {
 
 	l := log.New(log.Ctx{})
 
@@ -135,7 +208,17 @@ func SetupMiddleware(api *rest.Api, mwtype string, authorizer authz.Authorizer,
 
 	l.Infof("setting up %s middleware", mwtype)
 
-	api.Use(commonLoggingAccessStack...)
+	accesslogmw, err := newAccessLogMiddleware(mwconfig.AccessLog)
+	if err != nil {
+		return err
+	}
+
+	api.Use(commonLoggingStack...)
+	api.Use(accesslogmw)
+	if mwconfig.Metrics != nil {
+		api.Use(&api_http.MetricsMiddleware{Metrics: mwconfig.Metrics})
+	}
+	api.Use(&rest.TimerMiddleware{}, &rest.RecorderMiddleware{})
 
 	mwstack, ok := middlewareMap[mwtype]
 	if !ok {
@@ -144,8 +227,34 @@ func SetupMiddleware(api *rest.Api, mwtype string, authorizer authz.Authorizer,
 
 	api.Use(mwstack...)
 
+	// response compression, negotiated via Accept-Encoding
+	if mwconfig.Gzip {
+		api.Use(&rest.GzipMiddleware{})
+	}
+
+	api.Use(newCORSMiddleware(mwconfig.CORS))
+
 	api.Use(commonStack...)
 
+	if mwconfig.MaxBodySize > 0 {
+		api.Use(&api_http.BodyLimitMiddleware{Limit: mwconfig.MaxBodySize})
+	}
+
+	if mwconfig.RequestTimeout > 0 {
+		api.Use(&api_http.RequestTimeoutMiddleware{Timeout: mwconfig.RequestTimeout})
+	}
+
+	if mwconfig.Maintenance != nil {
+		api.Use(&api_http.MaintenanceMiddleware{Maintenance: mwconfig.Maintenance})
+	}
+
+	api.Use(&api_http.OpaqueTokenIdentityMiddleware{JWTHandler: jwth})
+
+	api.Use(&rest.IfMiddleware{
+		Condition: api_http.IsManagementEndpoint,
+		IfTrue:    &api_http.OperatorTenantMiddleware{JWTHandler: jwth},
+	})
+
 	authzmw := &authz.AuthzMiddleware{
 		Authz:      authorizer,
 		ResFunc:    api_http.ExtractResourceAction,
@@ -14,9 +14,21 @@
 package main
 
 import (
+	"net/http"
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/ant0ine/go-json-rest/rest"
+	"github.com/ant0ine/go-json-rest/rest/test"
+	"github.com/stretchr/testify/assert"
+
+	api_http "github.com/mendersoftware/useradm/api/http"
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	useradm "github.com/mendersoftware/useradm/user"
+	museradm "github.com/mendersoftware/useradm/user/mocks"
+	mtesting "github.com/mendersoftware/useradm/utils/testing"
 )
 
 func TestSetupMiddleware(t *testing.T) {
@@ -33,7 +45,7 @@ func TestSetupMiddleware(t *testing.T) {
 	for _, td := range tdata {
 		api := rest.NewApi()
 
-		err := SetupMiddleware(api, td.mwtype, nil, nil)
+		err := SetupMiddleware(api, td.mwtype, MiddlewareConfig{}, nil, nil)
 		if err != nil && !td.experr {
 			t.Errorf("dod not expect error: %s", err)
 		} else if err == nil && td.experr {
@@ -41,3 +53,188 @@ func TestSetupMiddleware(t *testing.T) {
 		}
 	}
 }
+
+func TestCORSOriginAllowed(t *testing.T) {
+
+	var tdata = []struct {
+		allowed []string
+		origin  string
+		exp     bool
+	}{
+		{[]string{"*"}, "https://ui.example.com", true},
+		{[]string{"https://ui.example.com"}, "https://ui.example.com", true},
+		{[]string{"https://a.example.com", "https://ui.example.com"}, "https://ui.example.com", true},
+		{[]string{"https://ui.example.com"}, "https://evil.example.com", false},
+		{[]string{}, "https://ui.example.com", false},
+	}
+
+	for _, td := range tdata {
+		if corsOriginAllowed(td.allowed, td.origin) != td.exp {
+			t.Errorf("origin %s, allowed %v: expected %v", td.origin, td.allowed, td.exp)
+		}
+	}
+}
+
+// the OAuth endpoints take form-encoded bodies, which must get past
+// the common Content-Type check to the handlers
+func TestSetupMiddlewareOAuthForms(t *testing.T) {
+
+	token := &jwt.Token{
+		Claims: jwt.Claims{
+			IssuedAt:  1500000000,
+			ExpiresAt: 1500003600,
+			Client:    true,
+		},
+	}
+
+	var tdata = map[string]struct {
+		path  string
+		form  url.Values
+		setup func(uadm *museradm.App)
+
+		status int
+	}{
+		"client credentials": {
+			path: "/api/management/v1/useradm/auth/token",
+			form: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {"client-1"},
+				"client_secret": {"secret"},
+			},
+			setup: func(uadm *museradm.App) {
+				uadm.On("IssueClientToken", mtesting.ContextMatcher(),
+					"client-1", "secret", "").Return(token, nil)
+				uadm.On("SignToken", mtesting.ContextMatcher(), token).
+					Return("signed", nil)
+			},
+
+			status: http.StatusOK,
+		},
+		"client credentials, invalid client": {
+			path: "/api/management/v1/useradm/auth/token",
+			form: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {"client-1"},
+				"client_secret": {"wrong"},
+			},
+			setup: func(uadm *museradm.App) {
+				uadm.On("IssueClientToken", mtesting.ContextMatcher(),
+					"client-1", "wrong", "").Return(nil, useradm.ErrInvalidClient)
+			},
+
+			status: http.StatusUnauthorized,
+		},
+		"authorization code": {
+			path: "/api/management/v1/useradm/auth/token",
+			form: url.Values{
+				"grant_type":    {model.GrantTypeAuthorizationCode},
+				"client_id":     {"client-1"},
+				"client_secret": {"secret"},
+				"code":          {"code-1"},
+				"redirect_uri":  {"https://tool.example.com/callback"},
+				"code_verifier": {"verifier"},
+			},
+			setup: func(uadm *museradm.App) {
+				uadm.On("ExchangeAuthCode", mtesting.ContextMatcher(),
+					model.AuthCodeExchange{
+						ClientID:     "client-1",
+						ClientSecret: "secret",
+						Code:         "code-1",
+						RedirectURI:  "https://tool.example.com/callback",
+						CodeVerifier: "verifier",
+					}).
+					Return(&model.AccessToken{
+						AccessToken: "signed",
+						TokenType:   model.TokenTypeBearer,
+						IDToken:     "signed.id",
+					}, nil)
+			},
+
+			status: http.StatusOK,
+		},
+		"token exchange": {
+			path: "/api/management/v1/useradm/auth/token",
+			form: url.Values{
+				"grant_type":         {model.GrantTypeTokenExchange},
+				"client_id":          {"client-1"},
+				"client_secret":      {"secret"},
+				"subject_token":      {"user.token"},
+				"subject_token_type": {model.TokenTypeJWT},
+				"scope":              {"mender.users:read"},
+			},
+			setup: func(uadm *museradm.App) {
+				uadm.On("ExchangeToken", mtesting.ContextMatcher(),
+					model.TokenExchange{
+						ClientID:         "client-1",
+						ClientSecret:     "secret",
+						SubjectToken:     "user.token",
+						SubjectTokenType: model.TokenTypeJWT,
+						Scope:            "mender.users:read",
+					}).
+					Return(&model.AccessToken{
+						AccessToken:     "signed",
+						TokenType:       model.TokenTypeBearer,
+						IssuedTokenType: model.TokenTypeAccessToken,
+					}, nil)
+			},
+
+			status: http.StatusOK,
+		},
+		"device code": {
+			path: "/api/management/v1/useradm/auth/device/code",
+			form: url.Values{
+				"client_id": {"mender-cli"},
+			},
+			setup: func(uadm *museradm.App) {
+				uadm.On("StartDeviceAuthorization", mtesting.ContextMatcher(),
+					"mender-cli", "").
+					Return(&model.DeviceAuthorizationResponse{
+						DeviceCode: "device-code",
+						UserCode:   "ABCD-EFGH",
+					}, nil)
+			},
+
+			status: http.StatusOK,
+		},
+		"device token, pending": {
+			path: "/api/management/v1/useradm/auth/device/token",
+			form: url.Values{
+				"grant_type":  {model.GrantTypeDeviceCode},
+				"client_id":   {"mender-cli"},
+				"device_code": {"device-code"},
+			},
+			setup: func(uadm *museradm.App) {
+				uadm.On("IssueDeviceToken", mtesting.ContextMatcher(),
+					"mender-cli", "device-code").
+					Return(nil, useradm.ErrAuthorizationPending)
+			},
+
+			status: http.StatusBadRequest,
+		},
+	}
+
+	for name, td := range tdata {
+		t.Run(name, func(t *testing.T) {
+			uadm := &museradm.App{}
+			td.setup(uadm)
+
+			api := rest.NewApi()
+			err := SetupMiddleware(api, EnvProd, MiddlewareConfig{}, nil, nil)
+			assert.NoError(t, err)
+
+			app, err := api_http.NewUserAdmApiHandlers(uadm, nil).GetApp()
+			assert.NoError(t, err)
+			api.SetApp(app)
+
+			req, _ := http.NewRequest(http.MethodPost,
+				"http://1.2.3.4"+td.path,
+				strings.NewReader(td.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			recorded := test.RunRequest(t, api.MakeHandler(), req)
+			recorded.CodeIs(td.status)
+
+			uadm.AssertExpectations(t)
+		})
+	}
+}
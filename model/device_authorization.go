@@ -0,0 +1,141 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	// the grant of the device token endpoint, see RFC 8628 3.4
+	GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	DeviceAuthorizationPending  = "pending"
+	DeviceAuthorizationApproved = "approved"
+	DeviceAuthorizationDenied   = "denied"
+
+	// user codes are 8 letters out of the 20 consonants, without the
+	// vowels so that no words are spelled, see RFC 8628 6.1
+	UserCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+	UserCodeLength  = 8
+
+	MaxDeviceClientIDLength = 256
+)
+
+var (
+	ErrInvalidDeviceClientID = NewFieldError("client_id", "must be 1-256 characters long")
+	ErrInvalidUserCode       = NewFieldError("user_code", "must be 8 letters")
+	ErrMissingDeviceApproval = NewFieldError("approve", "is required")
+)
+
+// DeviceAuthorization is the pending login of a device, e.g. of the
+// mender-cli, which the user approves or denies out of the device
+type DeviceAuthorization struct {
+	// SHA-256 of the device code
+	ID string `bson:"_id"`
+	// normalized, see NormalizeUserCode
+	UserCode string `bson:"user_code"`
+	// identifies the tool logging in, shown to the user
+	ClientID string `bson:"client_id"`
+	// requested scopes; once approved, the scopes granted to the token
+	Scope  string `bson:"scope"`
+	Status string `bson:"status"`
+
+	// the approving user
+	TenantID string `bson:"tenant_id,omitempty"`
+	UserID   string `bson:"user_id,omitempty"`
+
+	// minimum time in seconds between the polls of the device
+	Interval  int       `bson:"interval"`
+	PolledTs  time.Time `bson:"polled_ts,omitempty"`
+	ExpiresTs time.Time `bson:"expires_ts"`
+}
+
+// DeviceAuthorizationResolution is the user's decision on the login
+type DeviceAuthorizationResolution struct {
+	Status   string
+	TenantID string
+	UserID   string
+	Scope    string
+}
+
+// DeviceAuthorizationResponse is the response of the device authorization
+// endpoint, see RFC 8628 3.2
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceAuthorizationInfo is what the user is shown before approving
+// the login
+type DeviceAuthorizationInfo struct {
+	UserCode  string    `json:"user_code"`
+	ClientID  string    `json:"client_id"`
+	Scope     string    `json:"scope"`
+	ExpiresTs time.Time `json:"expires_ts"`
+}
+
+// DeviceVerification is the user's approval or denial of the login
+type DeviceVerification struct {
+	UserCode string `json:"user_code"`
+	Approve  *bool  `json:"approve"`
+}
+
+func (v DeviceVerification) Validate() error {
+	if !IsUserCode(v.UserCode) {
+		return ErrInvalidUserCode
+	}
+	if v.Approve == nil {
+		return ErrMissingDeviceApproval
+	}
+	return nil
+}
+
+// NormalizeUserCode removes the separators and the case, as the users
+// may type the code in any, see RFC 8628 6.1
+func NormalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
+
+// FormatUserCode formats the normalized code for display, e.g. BDFH-JKLM
+func FormatUserCode(code string) string {
+	if len(code) != UserCodeLength {
+		return code
+	}
+	return code[:UserCodeLength/2] + "-" + code[UserCodeLength/2:]
+}
+
+// IsUserCode checks the code, in any format, could have been issued
+func IsUserCode(code string) bool {
+	code = NormalizeUserCode(code)
+	if len(code) != UserCodeLength {
+		return false
+	}
+	for _, r := range code {
+		if !strings.ContainsRune(UserCodeCharset, r) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserCode(t *testing.T) {
+	assert.Equal(t, "BCDFGHJK", NormalizeUserCode("bcdf-ghjk"))
+	assert.Equal(t, "BCDFGHJK", NormalizeUserCode("BCDF GHJK"))
+	assert.Equal(t, "BCDF-GHJK", FormatUserCode("BCDFGHJK"))
+
+	assert.True(t, IsUserCode("bcdf-ghjk"))
+	assert.True(t, IsUserCode("BCDFGHJK"))
+	assert.False(t, IsUserCode("BCDF-GHJ"))
+	assert.False(t, IsUserCode("BCDF-GHJA"))
+	assert.False(t, IsUserCode(""))
+}
+
+func TestDeviceVerificationValidate(t *testing.T) {
+	approve := true
+
+	testCases := map[string]struct {
+		verification DeviceVerification
+		outErr       error
+	}{
+		"ok": {
+			verification: DeviceVerification{
+				UserCode: "BCDF-GHJK",
+				Approve:  &approve,
+			},
+		},
+		"error: invalid user code": {
+			verification: DeviceVerification{
+				UserCode: "1234-5678",
+				Approve:  &approve,
+			},
+			outErr: ErrInvalidUserCode,
+		},
+		"error: no decision": {
+			verification: DeviceVerification{UserCode: "BCDF-GHJK"},
+			outErr:       ErrMissingDeviceApproval,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case %s", name)
+
+		err := tc.verification.Validate()
+
+		if tc.outErr == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.outErr.Error())
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"strings"
+)
+
+// domains of well-known disposable email providers, blocked if
+// the tenant enables SettingBlockDisposableEmails
+var disposableEmailDomains = map[string]bool{
+	"10minutemail.com":       true,
+	"discard.email":          true,
+	"dispostable.com":        true,
+	"emailondeck.com":        true,
+	"fakeinbox.com":          true,
+	"getairmail.com":         true,
+	"getnada.com":            true,
+	"guerrillamail.com":      true,
+	"guerrillamail.net":      true,
+	"guerrillamailblock.com": true,
+	"mailcatch.com":          true,
+	"maildrop.cc":            true,
+	"mailinator.com":         true,
+	"mailnesia.com":          true,
+	"mintemail.com":          true,
+	"mohmal.com":             true,
+	"sharklasers.com":        true,
+	"spambog.com":            true,
+	"spamgourmet.com":        true,
+	"temp-mail.org":          true,
+	"tempail.com":            true,
+	"tempmail.net":           true,
+	"tempmailo.com":          true,
+	"throwawaymail.com":      true,
+	"trashmail.com":          true,
+	"trashmail.net":          true,
+	"yopmail.com":            true,
+	"yopmail.net":            true,
+}
+
+// isDisposableEmailDomain tells if the domain, or one of its parent
+// domains, belongs to a disposable email provider
+func isDisposableEmailDomain(domain string) bool {
+	for {
+		if disposableEmailDomains[domain] {
+			return true
+		}
+		i := strings.Index(domain, ".")
+		if i < 0 {
+			return false
+		}
+		domain = domain[i+1:]
+	}
+}
+
+// isSubdomain tells if the domain is the parent domain or one of its subdomains
+func isSubdomain(domain, parent string) bool {
+	return domain == parent || strings.HasSuffix(domain, "."+parent)
+}
@@ -0,0 +1,28 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// ErasureReceipt confirms that all personal data of a user was erased
+type ErasureReceipt struct {
+	UserID   string    `json:"user_id"`
+	TenantID string    `json:"tenant_id,omitempty"`
+	ErasedTs time.Time `json:"erased_ts"`
+
+	// the above, signed with the service's key as a JWT
+	Signature string `json:"signature"`
+}
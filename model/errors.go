@@ -0,0 +1,76 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+)
+
+// FieldError describes an invalid field of a request
+type FieldError struct {
+	// JSON name of the field
+	Field string `json:"field"`
+
+	// what is wrong with the field
+	Message string `json:"message"`
+}
+
+func NewFieldError(field, msg string) *FieldError {
+	return &FieldError{
+		Field:   field,
+		Message: msg,
+	}
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// FieldErrors is a list of invalid fields of a request
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// validateStruct runs the struct tag validators, reporting
+// the failures as field errors
+func validateStruct(s interface{}) error {
+	_, err := govalidator.ValidateStruct(s)
+	if err == nil {
+		return nil
+	}
+
+	errs, ok := err.(govalidator.Errors)
+	if !ok {
+		return err
+	}
+
+	fieldErrs := FieldErrors{}
+	for _, e := range errs.Errors() {
+		if ve, ok := e.(govalidator.Error); ok {
+			fieldErrs = append(fieldErrs, NewFieldError(ve.Name, ve.Err.Error()))
+		} else {
+			return err
+		}
+	}
+
+	return fieldErrs
+}
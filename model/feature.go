@@ -0,0 +1,40 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"regexp"
+)
+
+var (
+	ErrInvalidFeatureName = NewFieldError("name", "must be 1-64 characters long, "+
+		"start with a letter and consist of lower case letters, digits, '_' and '-'")
+
+	featureNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
+)
+
+// Feature is a tenant's override of a feature flag, which switches
+// a capability of the service on or off; the flags of tenants without
+// an override are on if enabled in the service's configuration
+type Feature struct {
+	Name    string `json:"name" bson:"_id"`
+	Enabled bool   `json:"enabled" bson:"enabled"`
+}
+
+func (f Feature) Validate() error {
+	if !featureNameRegexp.MatchString(f.Name) {
+		return ErrInvalidFeatureName
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"regexp"
+	"time"
+)
+
+const (
+	MaxGroupDescriptionLength = 1024
+)
+
+var (
+	ErrInvalidGroupName = NewFieldError("name", "must be 1-64 characters long "+
+		"and consist of letters, digits, '_', '-' and '.'")
+	ErrInvalidGroupDescription = NewFieldError("description", "too long")
+
+	groupNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+)
+
+type Group struct {
+	// system-generated group ID
+	ID string `json:"id" bson:"_id" readonly:"true"`
+
+	// unique group name, included in the members' tokens
+	Name string `json:"name" bson:"name"`
+
+	// free-form group description
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+
+	// timestamp of the group creation
+	CreatedTs *time.Time `json:"created_ts,omitempty" bson:"created_ts,omitempty" readonly:"true"`
+}
+
+func (g Group) ValidateNew() error {
+	if !groupNameRegexp.MatchString(g.Name) {
+		return ErrInvalidGroupName
+	}
+
+	if len(g.Description) > MaxGroupDescriptionLength {
+		return ErrInvalidGroupDescription
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupValidateNew(t *testing.T) {
+	testCases := map[string]struct {
+		inGroup Group
+		outErr  error
+	}{
+		"ok": {
+			inGroup: Group{
+				Name:        "dev-ops_1.0",
+				Description: "DevOps team",
+			},
+		},
+		"error: no name": {
+			inGroup: Group{},
+			outErr:  ErrInvalidGroupName,
+		},
+		"error: invalid name": {
+			inGroup: Group{Name: "dev ops"},
+			outErr:  ErrInvalidGroupName,
+		},
+		"error: name too long": {
+			inGroup: Group{Name: strings.Repeat("a", 65)},
+			outErr:  ErrInvalidGroupName,
+		},
+		"error: description too long": {
+			inGroup: Group{
+				Name:        "devops",
+				Description: strings.Repeat("a", MaxGroupDescriptionLength+1),
+			},
+			outErr: ErrInvalidGroupDescription,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case %s", name)
+
+		err := tc.inGroup.ValidateNew()
+
+		if tc.outErr == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.outErr.Error())
+		}
+	}
+}
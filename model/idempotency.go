@@ -0,0 +1,34 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// IdempotencyKey records the outcome of a request sent with an
+// Idempotency-Key header, so that retries of it are not executed again
+type IdempotencyKey struct {
+	// key as sent by the client
+	Key string `json:"key" bson:"_id"`
+
+	// email of the user created by the request, a retry must match it
+	Email string `json:"email" bson:"email"`
+
+	// ID of the created user, empty while the request is in progress
+	UserID string `json:"user_id,omitempty" bson:"user_id,omitempty"`
+
+	// time of the first request with the key
+	CreatedTs time.Time `json:"created_ts" bson:"created_ts"`
+}
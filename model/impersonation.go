@@ -0,0 +1,55 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"strings"
+)
+
+const (
+	// token issued to a super-admin acting as the user
+	LoginMethodImpersonation = "impersonation"
+)
+
+var (
+	ErrEmptyImpersonationActor  = NewFieldError("actor", "can't be empty")
+	ErrEmptyImpersonationReason = NewFieldError("reason", "can't be empty")
+	ErrInvalidExpiresIn         = NewFieldError("expires_in", "must be positive")
+)
+
+// Impersonation is a request of a super-admin for a token acting
+// as a user, e.g. to debug the user's issue
+type Impersonation struct {
+	// who impersonates the user, e.g. the support engineer's email
+	Actor string `json:"actor" bson:"actor"`
+
+	// why the user is impersonated, e.g. the support ticket
+	Reason string `json:"reason" bson:"reason"`
+
+	// lifetime of the token in seconds, the configured maximum if 0
+	ExpiresIn int64 `json:"expires_in,omitempty" bson:"-"`
+}
+
+func (i Impersonation) Validate() error {
+	if strings.TrimSpace(i.Actor) == "" {
+		return ErrEmptyImpersonationActor
+	}
+	if strings.TrimSpace(i.Reason) == "" {
+		return ErrEmptyImpersonationReason
+	}
+	if i.ExpiresIn < 0 {
+		return ErrInvalidExpiresIn
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// JobRun is a finished run of a background job
+type JobRun struct {
+	Name       string
+	StartedTs  time.Time
+	FinishedTs time.Time
+	// empty if the run succeeded
+	Error string
+	// the job didn't do anything this time, e.g. in maintenance mode
+	Skipped bool
+}
+
+// JobStatus is the status of a background job, with the metrics of its
+// runs by all the instances of the service
+type JobStatus struct {
+	Name string `json:"name" bson:"_id"`
+
+	// number of runs so far, and of the ones which failed
+	Runs     int `json:"runs" bson:"runs"`
+	Failures int `json:"failures" bson:"failures"`
+	// number of the runs skipped, not counted as runs
+	Skips int `json:"skips" bson:"skips"`
+
+	LastStartedTs  time.Time `json:"last_started_ts" bson:"last_started_ts"`
+	LastFinishedTs time.Time `json:"last_finished_ts" bson:"last_finished_ts"`
+	LastDurationMs int64     `json:"last_duration_ms" bson:"last_duration_ms"`
+	// error of the last run, empty if it succeeded
+	LastError string `json:"last_error,omitempty" bson:"last_error"`
+	// not set if the job never succeeded
+	LastSuccessTs *time.Time `json:"last_success_ts,omitempty" bson:"last_success_ts,omitempty"`
+	// not set if the job was never skipped
+	LastSkippedTs *time.Time `json:"last_skipped_ts,omitempty" bson:"last_skipped_ts,omitempty"`
+}
+
+// Apply updates the status with the outcome of the run
+func (s *JobStatus) Apply(run *JobRun) {
+	s.Name = run.Name
+	if run.Skipped {
+		s.Skips++
+		skipped := run.StartedTs
+		s.LastSkippedTs = &skipped
+		return
+	}
+	s.Runs++
+	s.LastStartedTs = run.StartedTs
+	s.LastFinishedTs = run.FinishedTs
+	s.LastDurationMs = int64(run.FinishedTs.Sub(run.StartedTs) / time.Millisecond)
+	s.LastError = run.Error
+	if run.Error != "" {
+		s.Failures++
+	} else {
+		finished := run.FinishedTs
+		s.LastSuccessTs = &finished
+	}
+}
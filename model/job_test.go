@@ -0,0 +1,78 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobStatusApply(t *testing.T) {
+	started := time.Date(2018, 6, 1, 10, 0, 0, 0, time.UTC)
+	finished := started.Add(1500 * time.Millisecond)
+
+	var s JobStatus
+	s.Apply(&JobRun{
+		Name:       "foo",
+		StartedTs:  started,
+		FinishedTs: finished,
+	})
+	assert.Equal(t, JobStatus{
+		Name:           "foo",
+		Runs:           1,
+		LastStartedTs:  started,
+		LastFinishedTs: finished,
+		LastDurationMs: 1500,
+		LastSuccessTs:  &finished,
+	}, s)
+
+	later := finished.Add(time.Hour)
+	s.Apply(&JobRun{
+		Name:       "foo",
+		StartedTs:  later,
+		FinishedTs: later,
+		Error:      "failed",
+	})
+	assert.Equal(t, JobStatus{
+		Name:           "foo",
+		Runs:           2,
+		Failures:       1,
+		LastStartedTs:  later,
+		LastFinishedTs: later,
+		LastError:      "failed",
+		LastSuccessTs:  &finished,
+	}, s)
+
+	// skipped runs are counted apart
+	skipped := later.Add(time.Hour)
+	s.Apply(&JobRun{
+		Name:       "foo",
+		StartedTs:  skipped,
+		FinishedTs: skipped,
+		Skipped:    true,
+	})
+	assert.Equal(t, JobStatus{
+		Name:           "foo",
+		Runs:           2,
+		Failures:       1,
+		Skips:          1,
+		LastStartedTs:  later,
+		LastFinishedTs: later,
+		LastError:      "failed",
+		LastSuccessTs:  &finished,
+		LastSkippedTs:  &skipped,
+	}, s)
+}
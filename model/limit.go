@@ -0,0 +1,57 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	// maximum number of users of the tenant
+	LimitMaxUsers = "max_users"
+)
+
+var (
+	ErrUnknownLimit = errors.New("unknown limit")
+
+	knownLimits = []string{LimitMaxUsers}
+)
+
+// Limit is a tenant's quota on some resource, zero means no limit
+type Limit struct {
+	Name  string `json:"name" bson:"_id"`
+	Value int    `json:"value" bson:"value"`
+}
+
+func (l Limit) Validate() error {
+	known := false
+	for _, name := range knownLimits {
+		known = known || l.Name == name
+	}
+	if !known {
+		return ErrUnknownLimit
+	}
+
+	if l.Value < 0 {
+		return NewFieldError("value", "must not be negative")
+	}
+
+	return nil
+}
+
+// LimitUsage tells how much of the limited resource is in use
+type LimitUsage struct {
+	Limit
+	Usage int `json:"usage"`
+}
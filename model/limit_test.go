@@ -0,0 +1,54 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitValidate(t *testing.T) {
+	testCases := map[string]struct {
+		limit  Limit
+		outErr error
+	}{
+		"ok": {
+			limit: Limit{Name: LimitMaxUsers, Value: 10},
+		},
+		"ok, no limit": {
+			limit: Limit{Name: LimitMaxUsers},
+		},
+		"error: unknown limit": {
+			limit:  Limit{Name: "max_devices", Value: 10},
+			outErr: ErrUnknownLimit,
+		},
+		"error: negative value": {
+			limit:  Limit{Name: LimitMaxUsers, Value: -1},
+			outErr: NewFieldError("value", "must not be negative"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case %s", name)
+
+		err := tc.limit.Validate()
+
+		if tc.outErr == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.outErr.Error())
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package model
+
+import (
+	"time"
+)
+
+const (
+	// login with email and password
+	LoginMethodPassword = "password"
+)
+
+// LoginInfo describes where a login attempt comes from
+type LoginInfo struct {
+	// client IP address
+	IP string
+
+	// client user agent
+	UserAgent string
+
+	// scopes requested for the token, space separated; the token is
+	// granted all the user's scopes if empty
+	Scope string
+
+	// one-time code of the second factor, if the tenant requires one
+	OTP string
+}
+
+// LoginEvent is an entry of the user's login history
+type LoginEvent struct {
+	// system-generated event ID
+	ID string `json:"id" bson:"_id"`
+
+	// ID of the user logging in
+	UserID string `json:"user_id" bson:"user_id"`
+
+	// time of the login attempt
+	Timestamp time.Time `json:"ts" bson:"ts"`
+
+	// client IP address
+	IP string `json:"ip,omitempty" bson:"ip,omitempty"`
+
+	// client user agent
+	UserAgent string `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+
+	// true if the login attempt was successful
+	Success bool `json:"success" bson:"success"`
+
+	// authentication method used
+	Method string `json:"method" bson:"method"`
+
+	// the super-admin acting as the user, for the impersonation method
+	Impersonation *Impersonation `json:"impersonation,omitempty" bson:"impersonation,omitempty"`
+}
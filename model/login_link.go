@@ -0,0 +1,69 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+
+	"github.com/asaskevich/govalidator"
+)
+
+const (
+	// login with a link mailed to the user
+	LoginMethodMagicLink = "magic_link"
+
+	// time after sending a link to a user before another one is sent
+	LoginLinkResendInterval = time.Minute
+)
+
+var (
+	ErrInvalidLoginLinkEmail = NewFieldError("email", "must be a valid email address")
+	ErrMissingLoginLinkCode  = NewFieldError("code", "can't be empty")
+)
+
+// LoginLink is a login link mailed to the user, which can be used once
+type LoginLink struct {
+	// SHA-256 of the link's code
+	ID       string `bson:"_id"`
+	TenantID string `bson:"tenant_id"`
+	UserID   string `bson:"user_id"`
+	// the address the link was sent to
+	Email     string    `bson:"email"`
+	CreatedTs time.Time `bson:"created_ts"`
+	ExpiresTs time.Time `bson:"expires_ts"`
+}
+
+// LoginLinkRequest asks for a login link to be mailed to the address
+type LoginLinkRequest struct {
+	Email string `json:"email"`
+}
+
+func (r LoginLinkRequest) Validate() error {
+	if !govalidator.IsEmail(r.Email) {
+		return ErrInvalidLoginLinkEmail
+	}
+	return nil
+}
+
+// LoginLinkExchange is the login with the code of the link
+type LoginLinkExchange struct {
+	Code string `json:"code"`
+}
+
+func (e LoginLinkExchange) Validate() error {
+	if e.Code == "" {
+		return ErrMissingLoginLinkCode
+	}
+	return nil
+}
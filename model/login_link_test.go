@@ -0,0 +1,55 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginLinkRequestValidate(t *testing.T) {
+	testCases := map[string]struct {
+		request LoginLinkRequest
+		outErr  error
+	}{
+		"ok": {
+			request: LoginLinkRequest{Email: "foo@bar.com"},
+		},
+		"error: not an email": {
+			request: LoginLinkRequest{Email: "foo"},
+			outErr:  ErrInvalidLoginLinkEmail,
+		},
+		"error: empty": {
+			outErr: ErrInvalidLoginLinkEmail,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case %s", name)
+
+		err := tc.request.Validate()
+
+		if tc.outErr == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.outErr.Error())
+		}
+	}
+}
+
+func TestLoginLinkExchangeValidate(t *testing.T) {
+	assert.NoError(t, LoginLinkExchange{Code: "code"}.Validate())
+	assert.EqualError(t, LoginLinkExchange{}.Validate(), ErrMissingLoginLinkCode.Error())
+}
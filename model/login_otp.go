@@ -0,0 +1,50 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+const (
+	// channels the one-time codes of the second factor are sent over
+	SecondFactorEmail = "email"
+	SecondFactorSMS   = "sms"
+
+	// number of digits of the one-time codes
+	LoginOTPLength = 6
+	// wrong codes entered, after which the code no longer works; they
+	// count across the codes resent until the last one expires
+	MaxLoginOTPAttempts = 5
+	// time after sending a code before another one is sent
+	LoginOTPResendInterval = time.Minute
+)
+
+// LoginOTP is the one-time code sent to the user to complete the login,
+// one per user
+type LoginOTP struct {
+	UserID string `bson:"_id"`
+	// SHA-256 of the code
+	Code string `bson:"code"`
+	// the channel the code was sent over
+	Channel   string    `bson:"channel"`
+	Attempts  int       `bson:"attempts"`
+	SentTs    time.Time `bson:"sent_ts"`
+	ExpiresTs time.Time `bson:"expires_ts"`
+}
+
+// IsSecondFactor tells whether the value is a known second factor channel
+func IsSecondFactor(v string) bool {
+	return v == SecondFactorEmail || v == SecondFactorSMS
+}
@@ -0,0 +1,45 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"strconv"
+	"time"
+)
+
+// longest Retry-After a client can be told to wait, in seconds
+const MaxMaintenanceRetryAfter = 24 * 3600
+
+var ErrInvalidRetryAfter = NewFieldError("retry_after",
+	"must be an integer between 0 and "+strconv.Itoa(MaxMaintenanceRetryAfter))
+
+// MaintenanceState describes the maintenance mode of the service,
+// shared by all its instances
+type MaintenanceState struct {
+	Enabled bool `json:"enabled" bson:"enabled"`
+
+	// time in seconds clients are advised to retry rejected requests in,
+	// the configured default if 0
+	RetryAfter int `json:"retry_after" bson:"retry_after"`
+
+	// time the maintenance mode was enabled at
+	Since *time.Time `json:"since,omitempty" bson:"since,omitempty"`
+}
+
+func (s MaintenanceState) Validate() error {
+	if s.RetryAfter < 0 || s.RetryAfter > MaxMaintenanceRetryAfter {
+		return ErrInvalidRetryAfter
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// MigrationStep is a versioned change of the database schema
+type MigrationStep struct {
+	Version     string `json:"version"`
+	Description string `json:"description"`
+
+	// true if the step reverts the change, in a migration to
+	// an older version
+	Down bool `json:"down,omitempty"`
+
+	// time the change was applied, not set if it's pending
+	AppliedTs *time.Time `json:"applied_ts,omitempty"`
+}
+
+// MigrationStatus is the state of the schema of a tenant's database
+type MigrationStatus struct {
+	TenantID string `json:"tenant_id,omitempty"`
+
+	// version of the schema, and the one the service needs
+	Version string `json:"version"`
+	Target  string `json:"target"`
+
+	// all the known steps, applied or not
+	Steps []MigrationStep `json:"steps"`
+}
+
+// MigrationProgress is the progress of migrating all the tenants'
+// databases to a version
+type MigrationProgress struct {
+	Version string `json:"version" bson:"_id"`
+
+	// number of tenants to migrate, and of the ones done so far:
+	// migrated, already at the version, or failed
+	Total    int `json:"total" bson:"total"`
+	Migrated int `json:"migrated" bson:"migrated"`
+	Skipped  int `json:"skipped" bson:"skipped"`
+	Failed   int `json:"failed" bson:"failed"`
+
+	FailedTenants []string `json:"failed_tenants,omitempty" bson:"failed_tenants,omitempty"`
+
+	StartedTs time.Time `json:"started_ts" bson:"started_ts"`
+	UpdatedTs time.Time `json:"updated_ts" bson:"updated_ts"`
+	// not set while the migration runs, or if it was interrupted
+	FinishedTs *time.Time `json:"finished_ts,omitempty" bson:"finished_ts,omitempty"`
+}
+
+// Done returns the number of tenants done so far
+func (p *MigrationProgress) Done() int {
+	return p.Migrated + p.Skipped + p.Failed
+}
@@ -0,0 +1,102 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"net/url"
+	"time"
+)
+
+const (
+	// the grant of the machine-to-machine access
+	GrantTypeClientCredentials = "client_credentials"
+
+	TokenTypeBearer = "Bearer"
+
+	MaxOAuthClientNameLength = 256
+)
+
+var (
+	ErrInvalidOAuthClientName   = NewFieldError("name", "must be 1-256 characters long")
+	ErrInvalidOAuthRedirectURIs = NewFieldError("redirect_uris",
+		"must be absolute http(s) URLs without a fragment")
+)
+
+// OAuthClient is a client registered for machine-to-machine access to the
+// tenant's API, authenticated by the client ID and secret
+type OAuthClient struct {
+	ID       string `json:"client_id" bson:"_id"`
+	TenantID string `json:"-" bson:"tenant_id"`
+
+	Name string `json:"name" bson:"name"`
+	// scopes the client's tokens may be granted, space-separated
+	Scope string `json:"scope" bson:"scope"`
+
+	// where the users may be sent back with the authorization codes,
+	// for the OpenID Connect clients
+	RedirectURIs []string `json:"redirect_uris,omitempty" bson:"redirect_uris,omitempty"`
+
+	// SHA-256 of the secret, the secret itself is shown only once
+	SecretHash string `json:"-" bson:"secret_hash"`
+
+	CreatedTs time.Time `json:"created_ts" bson:"created_ts"`
+}
+
+// OAuthClientNew is the registration of a client
+type OAuthClientNew struct {
+	Name string `json:"name"`
+	// all the tenant admin's scopes if empty
+	Scope        string   `json:"scope"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+func (c OAuthClientNew) Validate() error {
+	if len(c.Name) == 0 || len(c.Name) > MaxOAuthClientNameLength {
+		return ErrInvalidOAuthClientName
+	}
+	for _, uri := range c.RedirectURIs {
+		if !isRedirectURI(uri) {
+			return ErrInvalidOAuthRedirectURIs
+		}
+	}
+	return nil
+}
+
+// isRedirectURI checks the redirect URI is as required by RFC 6749 3.1.2
+func isRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "https" || u.Scheme == "http") &&
+		u.Host != "" && u.Fragment == ""
+}
+
+// OAuthClientCredentials is the registered client along with its secret
+type OAuthClientCredentials struct {
+	OAuthClient
+	Secret string `json:"client_secret"`
+}
+
+// AccessToken is the response of the token endpoint, see RFC 6749 5.1
+type AccessToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+	// for the authorization code grant of OpenID Connect
+	IDToken string `json:"id_token,omitempty"`
+	// for the token exchange grant
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
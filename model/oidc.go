@@ -0,0 +1,141 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	GrantTypeAuthorizationCode = "authorization_code"
+
+	ResponseTypeCode = "code"
+
+	CodeChallengeMethodS256 = "S256"
+
+	// OpenID Connect scopes, besides which the mender scopes of the
+	// access token may be requested
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+var (
+	ErrInvalidResponseType  = NewFieldError("response_type", "must be 'code'")
+	ErrMissingOpenIDScope   = NewFieldError("scope", "must include 'openid'")
+	ErrInvalidCodeChallenge = NewFieldError("code_challenge",
+		"an S256 code challenge is required")
+)
+
+// AuthorizationRequest is the OpenID Connect authentication request of
+// the authorization code flow, always with PKCE (RFC 7636)
+type AuthorizationRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+func (r AuthorizationRequest) Validate() error {
+	if r.ResponseType != ResponseTypeCode {
+		return ErrInvalidResponseType
+	}
+	if !r.HasScope(ScopeOpenID) {
+		return ErrMissingOpenIDScope
+	}
+	if r.CodeChallenge == "" || r.CodeChallengeMethod != CodeChallengeMethodS256 {
+		return ErrInvalidCodeChallenge
+	}
+	return nil
+}
+
+func (r AuthorizationRequest) HasScope(s string) bool {
+	for _, f := range strings.Fields(r.Scope) {
+		if f == s {
+			return true
+		}
+	}
+	return false
+}
+
+// MenderScope returns the requested scopes other than the OpenID Connect ones
+func (r AuthorizationRequest) MenderScope() string {
+	scopes := []string{}
+	for _, f := range strings.Fields(r.Scope) {
+		if f != ScopeOpenID && f != ScopeProfile && f != ScopeEmail {
+			scopes = append(scopes, f)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// OAuthCode is an issued authorization code, which can be exchanged for
+// the tokens once
+type OAuthCode struct {
+	// SHA-256 of the code
+	ID       string `bson:"_id"`
+	ClientID string `bson:"client_id"`
+	TenantID string `bson:"tenant_id"`
+	UserID   string `bson:"user_id"`
+
+	RedirectURI   string `bson:"redirect_uri"`
+	Scope         string `bson:"scope"`
+	Nonce         string `bson:"nonce,omitempty"`
+	CodeChallenge string `bson:"code_challenge"`
+
+	// scope of the access token, out of the requested ones
+	AccessScope string `bson:"access_scope"`
+
+	AuthTime  time.Time `bson:"auth_time"`
+	ExpiresTs time.Time `bson:"expires_ts"`
+}
+
+// AuthCodeExchange is the token request of the authorization code grant
+type AuthCodeExchange struct {
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+}
+
+// OIDCConfiguration is the OpenID Provider metadata, served at the
+// discovery endpoint
+type OIDCConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// UserInfo is the response of the userinfo endpoint
+type UserInfo struct {
+	Subject string `json:"sub"`
+	Email   string `json:"email,omitempty"`
+	Name    string `json:"name,omitempty"`
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizationRequestValidate(t *testing.T) {
+	testCases := map[string]struct {
+		request AuthorizationRequest
+		outErr  error
+	}{
+		"ok": {
+			request: AuthorizationRequest{
+				ResponseType:        ResponseTypeCode,
+				Scope:               "openid email",
+				CodeChallenge:       "challenge",
+				CodeChallengeMethod: CodeChallengeMethodS256,
+			},
+		},
+		"error: implicit flow": {
+			request: AuthorizationRequest{
+				ResponseType:        "token",
+				Scope:               "openid",
+				CodeChallenge:       "challenge",
+				CodeChallengeMethod: CodeChallengeMethodS256,
+			},
+			outErr: ErrInvalidResponseType,
+		},
+		"error: no openid scope": {
+			request: AuthorizationRequest{
+				ResponseType:        ResponseTypeCode,
+				Scope:               "email",
+				CodeChallenge:       "challenge",
+				CodeChallengeMethod: CodeChallengeMethodS256,
+			},
+			outErr: ErrMissingOpenIDScope,
+		},
+		"error: plain code challenge": {
+			request: AuthorizationRequest{
+				ResponseType:        ResponseTypeCode,
+				Scope:               "openid",
+				CodeChallenge:       "challenge",
+				CodeChallengeMethod: "plain",
+			},
+			outErr: ErrInvalidCodeChallenge,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case %s", name)
+
+		err := tc.request.Validate()
+
+		if tc.outErr == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.outErr.Error())
+		}
+	}
+}
+
+func TestAuthorizationRequestMenderScope(t *testing.T) {
+	r := AuthorizationRequest{Scope: "openid mender.users.read profile email"}
+	assert.Equal(t, "mender.users.read", r.MenderScope())
+	assert.True(t, r.HasScope(ScopeProfile))
+
+	r = AuthorizationRequest{Scope: "openid"}
+	assert.Equal(t, "", r.MenderScope())
+	assert.False(t, r.HasScope(ScopeEmail))
+}
+
+func TestOAuthClientNewValidate(t *testing.T) {
+	testCases := map[string]struct {
+		client OAuthClientNew
+		outErr error
+	}{
+		"ok": {
+			client: OAuthClientNew{
+				Name:         "tool",
+				RedirectURIs: []string{"https://tool.example.com/callback?a=1"},
+			},
+		},
+		"error: relative redirect URI": {
+			client: OAuthClientNew{
+				Name:         "tool",
+				RedirectURIs: []string{"/callback"},
+			},
+			outErr: ErrInvalidOAuthRedirectURIs,
+		},
+		"error: redirect URI with fragment": {
+			client: OAuthClientNew{
+				Name:         "tool",
+				RedirectURIs: []string{"https://tool.example.com/callback#a"},
+			},
+			outErr: ErrInvalidOAuthRedirectURIs,
+		},
+		"error: redirect URI scheme": {
+			client: OAuthClientNew{
+				Name:         "tool",
+				RedirectURIs: []string{"javascript://tool.example.com/alert(1)"},
+			},
+			outErr: ErrInvalidOAuthRedirectURIs,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case %s", name)
+
+		err := tc.client.Validate()
+
+		if tc.outErr == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.outErr.Error())
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// user fields which can be modified with a merge patch, mapped to
+// their database names; all other fields are read-only
+var userPatchFields = map[string]string{
+	"email":      "email",
+	"username":   "username",
+	"password":   "password",
+	"name":       "name",
+	"phone":      "phone",
+	"locale":     "locale",
+	"timezone":   "timezone",
+	"attributes": "attributes",
+	"status":     "status",
+	"expires_at": "expires_at",
+}
+
+// MergePatch applies a JSON merge patch (RFC 7396) to the target document,
+// both given as decoded JSON values
+func MergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = MergePatch(t[k], v)
+		}
+	}
+
+	return t
+}
+
+// MergePatch applies a JSON merge patch to the modifiable fields of the user,
+// validates the resulting state and returns the update leading to it
+func (u User) MergePatch(patch map[string]interface{}) (*UserUpdate, error) {
+	for k := range patch {
+		if _, ok := userPatchFields[k]; !ok {
+			return nil, NewFieldError(k, "field can't be modified")
+		}
+	}
+
+	current := UserUpdate{
+		Email:      u.Email,
+		Username:   u.Username,
+		Name:       u.Name,
+		Phone:      u.Phone,
+		Locale:     u.Locale,
+		Timezone:   u.Timezone,
+		Attributes: u.Attributes,
+		Status:     u.Status,
+		ExpiresAt:  u.ExpiresAt,
+	}
+
+	var doc interface{}
+	data, _ := json.Marshal(current)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "failed to decode user")
+	}
+
+	data, _ = json.Marshal(MergePatch(doc, patch))
+	patched := UserUpdate{}
+	if err := json.Unmarshal(data, &patched); err != nil {
+		return nil, errors.Wrap(err, "failed to apply patch")
+	}
+
+	if err := patched.validatePatched(patch); err != nil {
+		return nil, err
+	}
+
+	return current.diff(patched), nil
+}
+
+// validatePatched checks the user state resulting from a merge patch
+func (u UserUpdate) validatePatched(patch map[string]interface{}) error {
+	if u.Email == "" {
+		return NewFieldError("email", "can't be empty")
+	}
+
+	if err := validateStruct(u); err != nil {
+		return err
+	}
+
+	if err := checkEmail(u.Email); err != nil {
+		return err
+	}
+
+	if err := checkUsername(u.Username); err != nil {
+		return err
+	}
+
+	if u.Password != "" {
+		if err := checkPwd(u.Password); err != nil {
+			return err
+		}
+	}
+
+	if err := checkStatus(u.Status); err != nil {
+		return err
+	}
+
+	// an expiry time in the past is only rejected when it's being set,
+	// so that other fields of expired accounts can still be modified
+	if _, ok := patch["expires_at"]; ok {
+		if err := checkExpiresAt(u.ExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	if err := checkProfile(u.Name, u.Phone, u.Locale, u.Timezone); err != nil {
+		return err
+	}
+
+	return checkAttributes(u.Attributes)
+}
+
+// diff returns the update turning u into the patched state
+func (u UserUpdate) diff(patched UserUpdate) *UserUpdate {
+	update := &UserUpdate{
+		Password: patched.Password,
+	}
+
+	setString := func(field string, old, updated string, dst *string) {
+		if old == updated {
+			return
+		}
+		if updated == "" {
+			update.Clear = append(update.Clear, userPatchFields[field])
+		} else {
+			*dst = updated
+		}
+	}
+
+	setString("email", u.Email, patched.Email, &update.Email)
+	setString("username", u.Username, patched.Username, &update.Username)
+	setString("name", u.Name, patched.Name, &update.Name)
+	setString("phone", u.Phone, patched.Phone, &update.Phone)
+	setString("locale", u.Locale, patched.Locale, &update.Locale)
+	setString("timezone", u.Timezone, patched.Timezone, &update.Timezone)
+	setString("status", u.Status, patched.Status, &update.Status)
+
+	if !reflect.DeepEqual(u.Attributes, patched.Attributes) {
+		if len(patched.Attributes) == 0 {
+			update.Clear = append(update.Clear, userPatchFields["attributes"])
+		} else {
+			update.Attributes = patched.Attributes
+		}
+	}
+
+	switch {
+	case patched.ExpiresAt == nil && u.ExpiresAt != nil:
+		update.Clear = append(update.Clear, userPatchFields["expires_at"])
+	case patched.ExpiresAt != nil &&
+		(u.ExpiresAt == nil || !u.ExpiresAt.Equal(*patched.ExpiresAt)):
+		update.ExpiresAt = patched.ExpiresAt
+	}
+
+	return update
+}
@@ -0,0 +1,204 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergePatch(t *testing.T) {
+	// examples from RFC 7396, appendix A
+	testCases := []struct {
+		target string
+		patch  string
+		result string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tc := range testCases {
+		t.Logf("test case %s + %s", tc.target, tc.patch)
+
+		var target, patch interface{}
+		assert.NoError(t, json.Unmarshal([]byte(tc.target), &target))
+		assert.NoError(t, json.Unmarshal([]byte(tc.patch), &patch))
+
+		out, err := json.Marshal(MergePatch(target, patch))
+		assert.NoError(t, err)
+		assert.JSONEq(t, tc.result, string(out))
+	}
+}
+
+func TestUserMergePatch(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	past := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+
+	user := User{
+		ID:       "1",
+		Email:    "foo@bar.com",
+		Password: "passwordhash",
+		Name:     "Foo Bar",
+		Locale:   "en-US",
+		Attributes: map[string]string{
+			"department": "rnd",
+			"floor":      "2",
+		},
+		Status: UserStatusActive,
+	}
+
+	testCases := map[string]struct {
+		inUser  User
+		inPatch string
+
+		outUpdate *UserUpdate
+		outErr    string
+	}{
+		"ok, single field": {
+			inUser:  user,
+			inPatch: `{"name":"Foo Baz"}`,
+
+			outUpdate: &UserUpdate{
+				Name: "Foo Baz",
+			},
+		},
+		"ok, remove fields": {
+			inUser:  user,
+			inPatch: `{"name":null,"locale":"","attributes":{"floor":null}}`,
+
+			outUpdate: &UserUpdate{
+				Attributes: map[string]string{"department": "rnd"},
+				Clear:      []string{"name", "locale"},
+			},
+		},
+		"ok, remove all attributes": {
+			inUser:  user,
+			inPatch: `{"attributes":null}`,
+
+			outUpdate: &UserUpdate{
+				Clear: []string{"attributes"},
+			},
+		},
+		"ok, password and expiry": {
+			inUser: user,
+			inPatch: `{"password":"correcthorsebatterystaple",` +
+				`"expires_at":"` + future.Format(time.RFC3339) + `"}`,
+
+			outUpdate: &UserUpdate{
+				Password:  "correcthorsebatterystaple",
+				ExpiresAt: &future,
+			},
+		},
+		"ok, expired user": {
+			inUser: User{
+				ID:        "1",
+				Email:     "foo@bar.com",
+				ExpiresAt: &past,
+			},
+			inPatch: `{"phone":"+47 123 45 678"}`,
+
+			outUpdate: &UserUpdate{
+				Phone: "+47 123 45 678",
+			},
+		},
+		"ok, no changes": {
+			inUser:  user,
+			inPatch: `{"email":"foo@bar.com"}`,
+
+			outUpdate: &UserUpdate{},
+		},
+		"error: read-only field": {
+			inUser:  user,
+			inPatch: `{"id":"2"}`,
+
+			outErr: "id: field can't be modified",
+		},
+		"error: remove email": {
+			inUser:  user,
+			inPatch: `{"email":null}`,
+
+			outErr: "email: can't be empty",
+		},
+		"error: invalid email": {
+			inUser:  user,
+			inPatch: `{"email":"foo"}`,
+
+			outErr: "email: foo does not validate as email",
+		},
+		"error: password too short": {
+			inUser:  user,
+			inPatch: `{"password":"foo"}`,
+
+			outErr: ErrPasswordTooShort.Error(),
+		},
+		"error: invalid status": {
+			inUser:  user,
+			inPatch: `{"status":"foo"}`,
+
+			outErr: ErrInvalidStatus.Error(),
+		},
+		"error: expiry in the past": {
+			inUser:  user,
+			inPatch: `{"expires_at":"` + past.Format(time.RFC3339) + `"}`,
+
+			outErr: ErrInvalidExpiresAt.Error(),
+		},
+		"error: invalid attribute": {
+			inUser:  user,
+			inPatch: `{"attributes":{"foo bar":"baz"}}`,
+
+			outErr: ErrInvalidAttributeKey.Error(),
+		},
+		"error: wrong type": {
+			inUser:  user,
+			inPatch: `{"name":1}`,
+
+			outErr: "failed to apply patch: json: cannot unmarshal number " +
+				"into Go struct field UserUpdate.name of type string",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case %s", name)
+
+		patch := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(tc.inPatch), &patch))
+
+		update, err := tc.inUser.MergePatch(patch)
+
+		if tc.outErr == "" {
+			assert.NoError(t, err)
+			assert.Equal(t, tc.outUpdate, update)
+		} else {
+			assert.EqualError(t, err, tc.outErr)
+		}
+	}
+}
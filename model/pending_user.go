@@ -0,0 +1,32 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// PendingUser records the creation of a user propagated to tenantadm
+// until it's complete; one left behind by a failed creation means
+// the user may exist in tenantadm only, and has to be reconciled
+type PendingUser struct {
+	// ID of the user being created
+	UserID string `json:"user_id" bson:"_id"`
+
+	// tenant of the user, for the tenantadm calls
+	TenantID string `json:"tenant_id" bson:"tenant_id"`
+
+	// time the creation started
+	CreatedTs time.Time `json:"created_ts" bson:"created_ts"`
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"github.com/pkg/errors"
+)
+
+const (
+	// plans of the hosted tenants
+	PlanOpenSource   = "os"
+	PlanProfessional = "professional"
+	PlanEnterprise   = "enterprise"
+
+	// capabilities available in some plans only
+	CapabilityGroups = "groups"
+)
+
+var (
+	ErrUnknownPlan = errors.New("unknown plan")
+
+	// capabilities of the plans; tenants without a plan, e.g. of
+	// the single-tenant setups, aren't limited, while tenants of an
+	// unknown plan get the capabilities of the most restrictive one
+	plans = map[string]PlanCapabilities{
+		PlanOpenSource: {
+			MaxUsers:         5,
+			LoginHistoryDays: 7,
+		},
+		PlanProfessional: {
+			MaxUsers:         50,
+			LoginHistoryDays: 30,
+			Capabilities:     []string{CapabilityGroups},
+		},
+		PlanEnterprise: {
+			Capabilities: []string{CapabilityGroups},
+		},
+	}
+)
+
+// Plan is the tenant's subscription plan, gating its capabilities
+type Plan struct {
+	Name string `json:"name" bson:"name"`
+}
+
+func (p Plan) Validate() error {
+	if _, ok := plans[p.Name]; !ok {
+		return ErrUnknownPlan
+	}
+	return nil
+}
+
+// PlanInfo describes the tenant's plan and what it allows
+type PlanInfo struct {
+	// empty for tenants without a plan
+	Name string `json:"name,omitempty"`
+
+	PlanCapabilities
+}
+
+// PlanCapabilities lists what the tenants of a plan can do
+type PlanCapabilities struct {
+	// maximum number of users, 0 means no limit
+	MaxUsers int `json:"max_users"`
+
+	// how long the login history is kept visible, 0 means no limit
+	LoginHistoryDays int `json:"login_history_days"`
+
+	// capabilities beyond the basic ones
+	Capabilities []string `json:"capabilities"`
+}
+
+// Capabilities returns the capabilities of the plan; no plan at all
+// isn't limited, unknown plans fail closed to the open source plan
+func (p *Plan) Capabilities() PlanCapabilities {
+	if p == nil {
+		return PlanCapabilities{
+			Capabilities: []string{CapabilityGroups},
+		}
+	}
+	if c, ok := plans[p.Name]; ok {
+		return c
+	}
+	return plans[PlanOpenSource]
+}
+
+// Has tells if the plan includes the capability
+func (c PlanCapabilities) Has(capability string) bool {
+	for _, name := range c.Capabilities {
+		if name == capability {
+			return true
+		}
+	}
+	return false
+}
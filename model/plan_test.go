@@ -0,0 +1,44 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanValidate(t *testing.T) {
+	assert.NoError(t, Plan{Name: PlanProfessional}.Validate())
+	assert.Equal(t, ErrUnknownPlan, Plan{Name: "gold"}.Validate())
+	assert.Equal(t, ErrUnknownPlan, Plan{}.Validate())
+}
+
+func TestPlanCapabilities(t *testing.T) {
+	var noPlan *Plan
+	assert.True(t, noPlan.Capabilities().Has(CapabilityGroups))
+	assert.Zero(t, noPlan.Capabilities().MaxUsers)
+
+	os := &Plan{Name: PlanOpenSource}
+	assert.False(t, os.Capabilities().Has(CapabilityGroups))
+	assert.Equal(t, 5, os.Capabilities().MaxUsers)
+
+	enterprise := &Plan{Name: PlanEnterprise}
+	assert.True(t, enterprise.Capabilities().Has(CapabilityGroups))
+	assert.Zero(t, enterprise.Capabilities().LoginHistoryDays)
+
+	unknown := &Plan{Name: "gold"}
+	assert.False(t, unknown.Capabilities().Has(CapabilityGroups))
+	assert.Equal(t, 5, unknown.Capabilities().MaxUsers)
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"regexp"
+	"time"
+)
+
+const (
+	MaxServiceAccountDescriptionLength = 1024
+)
+
+var (
+	ErrInvalidServiceAccountName = NewFieldError("name", "must be 1-64 characters long "+
+		"and consist of letters, digits, '_', '-' and '.'")
+	ErrInvalidServiceAccountDescription = NewFieldError("description", "too long")
+	ErrInvalidServiceAccountOwner       = NewFieldError("owner", "user not found")
+
+	serviceAccountNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+)
+
+// ServiceAccount is a non-human principal of the tenant, e.g. a CI
+// pipeline; it can't log in and authenticates with the tokens issued to it
+type ServiceAccount struct {
+	// system-generated service account ID
+	ID string `json:"id" bson:"_id"`
+
+	// unique name of the account
+	Name string `json:"name" bson:"name"`
+
+	// free-form description of what the account is used for
+	Description string `json:"description,omitempty" bson:"description,omitempty"`
+
+	// scopes granted to the account's tokens, space-separated
+	Scope string `json:"scope" bson:"scope"`
+
+	// ID of the user responsible for the account
+	Owner string `json:"owner" bson:"owner"`
+
+	CreatedTs time.Time `json:"created_ts" bson:"created_ts"`
+	UpdatedTs time.Time `json:"updated_ts" bson:"updated_ts"`
+}
+
+// ServiceAccountNew is the request to create a service account
+type ServiceAccountNew struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// all the tenant admin's scopes if empty
+	Scope string `json:"scope"`
+	// the user creating the account if empty
+	Owner string `json:"owner"`
+}
+
+func (a ServiceAccountNew) Validate() error {
+	if !serviceAccountNameRegexp.MatchString(a.Name) {
+		return ErrInvalidServiceAccountName
+	}
+
+	if len(a.Description) > MaxServiceAccountDescriptionLength {
+		return ErrInvalidServiceAccountDescription
+	}
+
+	return nil
+}
+
+// ServiceAccountUpdate changes the fields given
+type ServiceAccountUpdate struct {
+	Description *string `json:"description"`
+	Scope       *string `json:"scope"`
+	Owner       *string `json:"owner"`
+}
+
+func (u ServiceAccountUpdate) Validate() error {
+	if u.Description != nil && len(*u.Description) > MaxServiceAccountDescriptionLength {
+		return ErrInvalidServiceAccountDescription
+	}
+
+	if u.Owner != nil && *u.Owner == "" {
+		return ErrInvalidServiceAccountOwner
+	}
+
+	return nil
+}
+
+// ServiceAccountTokenRequest is the request for a service account's token
+type ServiceAccountTokenRequest struct {
+	// lifetime of the token in seconds, the configured maximum if 0
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+func (r ServiceAccountTokenRequest) Validate() error {
+	if r.ExpiresIn < 0 {
+		return ErrInvalidExpiresIn
+	}
+	return nil
+}
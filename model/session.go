@@ -0,0 +1,31 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// Session is the server-side state of an opaque token, kept along with
+// the sessions of all the tenants, as the tenant isn't known from the
+// reference the client holds
+type Session struct {
+	// SHA-256 of the reference
+	ID       string `bson:"_id"`
+	TenantID string `bson:"tenant_id"`
+	// the token the reference stands for, which the session is valid
+	// as long as
+	TokenID   string    `bson:"token_id"`
+	ExpiresTs time.Time `bson:"expires_ts"`
+}
@@ -0,0 +1,237 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+)
+
+// tenant-wide settings enforced by the service, the remaining
+// settings are UI preferences stored as they are
+const (
+	// minimum length of users' passwords, at least MinPasswordLength
+	SettingPasswordMinLength = "password_min_length"
+	// lifetime of issued tokens in seconds, overrides the
+	// service's configuration
+	SettingSessionLength = "session_length"
+	// domains the emails of new users have to be in, any if empty;
+	// subdomains of the listed domains are allowed too
+	SettingAllowedEmailDomains = "allowed_email_domains"
+	// rejects emails of known disposable email providers
+	SettingBlockDisposableEmails = "block_disposable_emails"
+	// lets the users log in with links mailed to them, if the service
+	// has login links configured; not allowed together with the second
+	// factor, which the links would bypass
+	SettingMagicLinkLogin = "magic_link_login"
+	// requires a one-time code on password logins, sent over the channel
+	// given, "email" or "sms"
+	SettingSecondFactor = "second_factor"
+
+	MaxPasswordMinLength   = 128
+	MinSessionLength       = 60
+	MaxSessionLength       = 30 * 24 * 3600
+	MaxAllowedEmailDomains = 100
+)
+
+// TenantSettings are the tenant-wide settings, zero values mean the
+// service's defaults
+type TenantSettings struct {
+	PasswordMinLength     int
+	SessionLength         int64
+	AllowedEmailDomains   []string
+	BlockDisposableEmails bool
+	MagicLinkLogin        bool
+	SecondFactor          string
+}
+
+// NewTenantSettings extracts the tenant-wide settings out of all settings,
+// invalid values are ignored
+func NewTenantSettings(settings map[string]interface{}) TenantSettings {
+	ts := TenantSettings{}
+
+	if n, ok := settingInt(settings[SettingPasswordMinLength]); ok &&
+		n >= MinPasswordLength && n <= MaxPasswordMinLength {
+		ts.PasswordMinLength = int(n)
+	}
+	if n, ok := settingInt(settings[SettingSessionLength]); ok &&
+		n >= MinSessionLength && n <= MaxSessionLength {
+		ts.SessionLength = n
+	}
+	if domains, ok := settingDomains(settings[SettingAllowedEmailDomains]); ok {
+		ts.AllowedEmailDomains = domains
+	}
+	if block, ok := settings[SettingBlockDisposableEmails].(bool); ok {
+		ts.BlockDisposableEmails = block
+	}
+	if enabled, ok := settings[SettingMagicLinkLogin].(bool); ok {
+		ts.MagicLinkLogin = enabled
+	}
+	if channel, ok := settings[SettingSecondFactor].(string); ok && IsSecondFactor(channel) {
+		ts.SecondFactor = channel
+	}
+	// the second factor wins over the login links, for the settings
+	// saved before they were exclusive
+	if ts.SecondFactor != "" {
+		ts.MagicLinkLogin = false
+	}
+
+	return ts
+}
+
+// ValidateTenantSettings checks the tenant-wide settings, if present
+func ValidateTenantSettings(settings map[string]interface{}) error {
+	errs := FieldErrors{}
+
+	limits := []struct {
+		key      string
+		min, max int64
+	}{
+		{SettingPasswordMinLength, MinPasswordLength, MaxPasswordMinLength},
+		{SettingSessionLength, MinSessionLength, MaxSessionLength},
+	}
+	for _, l := range limits {
+		v, ok := settings[l.key]
+		if !ok {
+			continue
+		}
+		if n, ok := settingInt(v); !ok || n < l.min || n > l.max {
+			errs = append(errs, NewFieldError(l.key,
+				fmt.Sprintf("must be an integer between %d and %d", l.min, l.max)))
+		}
+	}
+
+	if v, ok := settings[SettingAllowedEmailDomains]; ok {
+		if _, ok := settingDomains(v); !ok {
+			errs = append(errs, NewFieldError(SettingAllowedEmailDomains,
+				fmt.Sprintf("must be a list of at most %d domain names",
+					MaxAllowedEmailDomains)))
+		}
+	}
+	for _, key := range []string{SettingBlockDisposableEmails, SettingMagicLinkLogin} {
+		if v, ok := settings[key]; ok {
+			if _, ok := v.(bool); !ok {
+				errs = append(errs, NewFieldError(key, "must be a boolean"))
+			}
+		}
+	}
+	if v, ok := settings[SettingSecondFactor]; ok {
+		if channel, ok := v.(string); !ok || !IsSecondFactor(channel) {
+			errs = append(errs, NewFieldError(SettingSecondFactor,
+				fmt.Sprintf("must be one of: %s, %s", SecondFactorEmail, SecondFactorSMS)))
+		}
+	}
+	if err := TenantSettingsConflict(settings); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// TenantSettingsConflict checks the tenant-wide settings which can't
+// be combined, returns nil if there's no conflict
+func TenantSettingsConflict(settings map[string]interface{}) *FieldError {
+	enabled, _ := settings[SettingMagicLinkLogin].(bool)
+	channel, _ := settings[SettingSecondFactor].(string)
+	if enabled && channel != "" {
+		return NewFieldError(SettingMagicLinkLogin,
+			"can't be enabled together with "+SettingSecondFactor)
+	}
+	return nil
+}
+
+// settingInt converts a number decoded from JSON or BSON
+func settingInt(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		if n != math.Trunc(n) || math.Abs(n) > math.MaxInt32 {
+			return 0, false
+		}
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
+// settingDomains converts a list of domain names decoded from JSON or BSON,
+// the domains are returned lower case
+func settingDomains(v interface{}) ([]string, bool) {
+	list, ok := v.([]interface{})
+	if !ok || len(list) > MaxAllowedEmailDomains {
+		return nil, false
+	}
+
+	domains := make([]string, 0, len(list))
+	for _, d := range list {
+		domain, ok := d.(string)
+		if !ok || !strings.Contains(domain, ".") || !govalidator.IsDNSName(domain) {
+			return nil, false
+		}
+		domains = append(domains, strings.ToLower(domain))
+	}
+	return domains, true
+}
+
+// CheckPassword returns ErrPasswordTooShort if the password
+// doesn't satisfy the tenant's policy
+func (ts TenantSettings) CheckPassword(password string) error {
+	if len(password) < ts.PasswordMinLength {
+		return ErrPasswordTooShort
+	}
+	return nil
+}
+
+// CheckEmail returns ErrEmailDomainNotAllowed if the domain of the email
+// doesn't satisfy the tenant's policy
+func (ts TenantSettings) CheckEmail(email string) error {
+	domain := EmailDomain(email)
+
+	if ts.BlockDisposableEmails && isDisposableEmailDomain(domain) {
+		return ErrEmailDomainNotAllowed
+	}
+	if len(ts.AllowedEmailDomains) == 0 {
+		return nil
+	}
+	for _, allowed := range ts.AllowedEmailDomains {
+		if isSubdomain(domain, allowed) {
+			return nil
+		}
+	}
+	return ErrEmailDomainNotAllowed
+}
+
+// SettingsVersion is a replaced version of the tenant settings,
+// which can be rolled back to
+type SettingsVersion struct {
+	// the ETag of the settings version
+	ETag string `json:"etag" bson:"_id"`
+
+	// time the version was replaced at
+	ReplacedTs time.Time `json:"replaced_ts" bson:"replaced_ts"`
+
+	Settings map[string]interface{} `json:"settings" bson:"settings"`
+}
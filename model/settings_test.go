@@ -0,0 +1,256 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTenantSettings(t *testing.T) {
+	testCases := map[string]struct {
+		settings map[string]interface{}
+		out      TenantSettings
+	}{
+		"ok": {
+			settings: map[string]interface{}{
+				SettingPasswordMinLength: float64(12),
+				SettingSessionLength:     int64(3600),
+				"foo":                    "bar",
+			},
+			out: TenantSettings{
+				PasswordMinLength: 12,
+				SessionLength:     3600,
+			},
+		},
+		"ok, not set": {
+			settings: map[string]interface{}{"foo": "bar"},
+		},
+		"ok, nil": {},
+		"invalid values are ignored": {
+			settings: map[string]interface{}{
+				SettingPasswordMinLength: float64(12.5),
+				SettingSessionLength:     "1h",
+			},
+		},
+		"out of range values are ignored": {
+			settings: map[string]interface{}{
+				SettingPasswordMinLength: 4,
+				SettingSessionLength:     MaxSessionLength + 1,
+			},
+		},
+		"ok, email domain policy": {
+			settings: map[string]interface{}{
+				SettingAllowedEmailDomains:   []interface{}{"Acme.com", "acme.co.uk"},
+				SettingBlockDisposableEmails: true,
+			},
+			out: TenantSettings{
+				AllowedEmailDomains:   []string{"acme.com", "acme.co.uk"},
+				BlockDisposableEmails: true,
+			},
+		},
+		"invalid email domains are ignored": {
+			settings: map[string]interface{}{
+				SettingAllowedEmailDomains:   []interface{}{"acme.com", "foo bar"},
+				SettingBlockDisposableEmails: "yes",
+			},
+		},
+		"ok, magic link login": {
+			settings: map[string]interface{}{
+				SettingMagicLinkLogin: true,
+			},
+			out: TenantSettings{MagicLinkLogin: true},
+		},
+		"ok, second factor": {
+			settings: map[string]interface{}{
+				SettingSecondFactor: SecondFactorSMS,
+			},
+			out: TenantSettings{SecondFactor: SecondFactorSMS},
+		},
+		"unknown second factor is ignored": {
+			settings: map[string]interface{}{
+				SettingSecondFactor: "totp",
+			},
+		},
+		"magic link login is off with the second factor": {
+			settings: map[string]interface{}{
+				SettingMagicLinkLogin: true,
+				SettingSecondFactor:   SecondFactorEmail,
+			},
+			out: TenantSettings{SecondFactor: SecondFactorEmail},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case %s", name)
+
+		assert.Equal(t, tc.out, NewTenantSettings(tc.settings))
+	}
+}
+
+func TestValidateTenantSettings(t *testing.T) {
+	testCases := map[string]struct {
+		settings map[string]interface{}
+		outErr   error
+	}{
+		"ok": {
+			settings: map[string]interface{}{
+				SettingPasswordMinLength: float64(MinPasswordLength),
+				SettingSessionLength:     float64(MaxSessionLength),
+			},
+		},
+		"ok, not set": {
+			settings: map[string]interface{}{"foo": "bar"},
+		},
+		"error: out of range": {
+			settings: map[string]interface{}{
+				SettingPasswordMinLength: float64(MaxPasswordMinLength + 1),
+				SettingSessionLength:     float64(MinSessionLength - 1),
+			},
+			outErr: FieldErrors{
+				NewFieldError(SettingPasswordMinLength,
+					"must be an integer between 8 and 128"),
+				NewFieldError(SettingSessionLength,
+					"must be an integer between 60 and 2592000"),
+			},
+		},
+		"ok, email domain policy": {
+			settings: map[string]interface{}{
+				SettingAllowedEmailDomains:   []interface{}{"acme.com"},
+				SettingBlockDisposableEmails: false,
+			},
+		},
+		"error: invalid email domain policy": {
+			settings: map[string]interface{}{
+				SettingAllowedEmailDomains:   []interface{}{"acme.com", "localhost"},
+				SettingBlockDisposableEmails: "true",
+			},
+			outErr: FieldErrors{
+				NewFieldError(SettingAllowedEmailDomains,
+					"must be a list of at most 100 domain names"),
+				NewFieldError(SettingBlockDisposableEmails, "must be a boolean"),
+			},
+		},
+		"error: magic link login not a boolean": {
+			settings: map[string]interface{}{
+				SettingMagicLinkLogin: "on",
+			},
+			outErr: FieldErrors{
+				NewFieldError(SettingMagicLinkLogin, "must be a boolean"),
+			},
+		},
+		"ok, second factor": {
+			settings: map[string]interface{}{
+				SettingSecondFactor: SecondFactorEmail,
+			},
+		},
+		"error: magic link login with the second factor": {
+			settings: map[string]interface{}{
+				SettingMagicLinkLogin: true,
+				SettingSecondFactor:   SecondFactorSMS,
+			},
+			outErr: FieldErrors{
+				NewFieldError(SettingMagicLinkLogin,
+					"can't be enabled together with second_factor"),
+			},
+		},
+		"error: unknown second factor": {
+			settings: map[string]interface{}{
+				SettingSecondFactor: "totp",
+			},
+			outErr: FieldErrors{
+				NewFieldError(SettingSecondFactor, "must be one of: email, sms"),
+			},
+		},
+		"error: not an integer": {
+			settings: map[string]interface{}{
+				SettingSessionLength: float64(3600.5),
+			},
+			outErr: FieldErrors{
+				NewFieldError(SettingSessionLength,
+					"must be an integer between 60 and 2592000"),
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case %s", name)
+
+		err := ValidateTenantSettings(tc.settings)
+		if tc.outErr == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.outErr.Error())
+		}
+	}
+}
+
+func TestTenantSettingsCheckPassword(t *testing.T) {
+	assert.NoError(t, TenantSettings{}.CheckPassword("correcthorse"))
+	assert.NoError(t, TenantSettings{PasswordMinLength: 12}.CheckPassword("correcthorse"))
+	assert.EqualError(t,
+		TenantSettings{PasswordMinLength: 16}.CheckPassword("correcthorse"),
+		ErrPasswordTooShort.Error())
+}
+
+func TestTenantSettingsCheckEmail(t *testing.T) {
+	testCases := map[string]struct {
+		settings TenantSettings
+		email    string
+		outErr   error
+	}{
+		"ok, no policy": {
+			email: "foo@mailinator.com",
+		},
+		"ok, allowed domain": {
+			settings: TenantSettings{AllowedEmailDomains: []string{"acme.com"}},
+			email:    "foo@Acme.com",
+		},
+		"ok, allowed subdomain": {
+			settings: TenantSettings{AllowedEmailDomains: []string{"acme.com"}},
+			email:    "foo@eu.acme.com",
+		},
+		"ok, not disposable": {
+			settings: TenantSettings{BlockDisposableEmails: true},
+			email:    "foo@acme.com",
+		},
+		"error: domain not allowed": {
+			settings: TenantSettings{AllowedEmailDomains: []string{"acme.com"}},
+			email:    "foo@notacme.com",
+			outErr:   ErrEmailDomainNotAllowed,
+		},
+		"error: disposable": {
+			settings: TenantSettings{BlockDisposableEmails: true},
+			email:    "foo@mailinator.com",
+			outErr:   ErrEmailDomainNotAllowed,
+		},
+		"error: disposable subdomain": {
+			settings: TenantSettings{BlockDisposableEmails: true},
+			email:    "foo@x.yopmail.com",
+			outErr:   ErrEmailDomainNotAllowed,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case %s", name)
+
+		err := tc.settings.CheckEmail(tc.email)
+		if tc.outErr == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.outErr.Error())
+		}
+	}
+}
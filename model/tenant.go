@@ -14,6 +14,45 @@
 
 package model
 
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// statuses of the tenants' accounts reported by tenantadm
+	TenantStatusActive         = "active"
+	TenantStatusSuspended      = "suspended"
+	TenantStatusTrialExpired   = "trial_expired"
+	TenantStatusPaymentOverdue = "payment_overdue"
+)
+
+var (
+	ErrUnknownTenantStatus = errors.New("unknown tenant status")
+)
+
 type NewTenant struct {
 	ID string
+
+	// email of the tenant's first administrator, invited by email
+	// along with the creation of the tenant; optional
+	AdminEmail string
+}
+
+// TenantStatus is the last known status of the tenant's account
+type TenantStatus struct {
+	Status string `json:"status" bson:"status"`
+	// when the tenant got the status, the grace period starts then
+	UpdatedTs time.Time `json:"updated_ts" bson:"updated_ts"`
+}
+
+func (s TenantStatus) Validate() error {
+	switch s.Status {
+	case TenantStatusActive, TenantStatusSuspended,
+		TenantStatusTrialExpired, TenantStatusPaymentOverdue:
+		return nil
+	default:
+		return ErrUnknownTenantStatus
+	}
 }
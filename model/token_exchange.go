@@ -0,0 +1,44 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+const (
+	// the grant of the token exchange, see RFC 8693
+	GrantTypeTokenExchange = "urn:ietf:params:oauth:grant-type:token-exchange"
+
+	// the types of the tokens exchanged, see RFC 8693 3
+	TokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token"
+	TokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"
+)
+
+// TokenExchange is the token request of the token exchange grant, by which
+// a client trades the user's token for a narrower one it acts with on the
+// user's behalf
+type TokenExchange struct {
+	ClientID     string
+	ClientSecret string
+
+	SubjectToken     string
+	SubjectTokenType string
+	// the access token type if empty
+	RequestedTokenType string
+	// all the subject token's scopes if empty
+	Scope string
+}
+
+// IsExchangeTokenType checks the token type is one the tokens are exchanged
+// from and to; the access tokens are JWTs, so both types are the same
+func IsExchangeTokenType(t string) bool {
+	return t == TokenTypeAccessToken || t == TokenTypeJWT
+}
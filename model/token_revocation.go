@@ -0,0 +1,44 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// Statuses of a token revocation
+const (
+	RevocationStatusPending = "pending"
+	RevocationStatusRunning = "running"
+	RevocationStatusDone    = "done"
+	RevocationStatusFailed  = "failed"
+)
+
+// TokenRevocation is a job removing the tokens of a tenant, or of one of
+// its users. The tokens are rejected from the time it's created, their
+// removal happens in the background.
+type TokenRevocation struct {
+	ID       string `json:"id" bson:"_id"`
+	TenantID string `json:"tenant_id" bson:"tenant_id"`
+	// all the users of the tenant if empty
+	UserID string `json:"user_id,omitempty" bson:"user_id,omitempty"`
+
+	Status string `json:"status" bson:"status"`
+	// set if the revocation failed
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+
+	CreatedTs  time.Time  `json:"created_ts" bson:"created_ts"`
+	StartedTs  *time.Time `json:"started_ts,omitempty" bson:"started_ts,omitempty"`
+	FinishedTs *time.Time `json:"finished_ts,omitempty" bson:"finished_ts,omitempty"`
+}
@@ -0,0 +1,35 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+const (
+	// users who logged in within the period count as active, unless
+	// they were disabled since
+	ActiveUsersPeriod = 30 * 24 * time.Hour
+)
+
+// UserCount is the number of users of a tenant, reported for billing
+type UserCount struct {
+	// tenant ID, empty for the default database
+	TenantID string `json:"tenant_id"`
+	// number of users
+	Total int `json:"total"`
+	// number of users who logged in within ActiveUsersPeriod and are
+	// not inactive (disabled or expired)
+	Active int `json:"active"`
+}
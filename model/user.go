@@ -15,37 +15,132 @@
 package model
 
 import (
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/asaskevich/govalidator"
 	"github.com/pkg/errors"
+	"golang.org/x/text/unicode/norm"
 )
 
 const (
 	MinPasswordLength = 8
+	MaxNameLength     = 256
+
+	// limits of the custom user attributes
+	MaxAttributes           = 32
+	MaxAttributeValueLength = 256
+
+	// user account is enabled
+	UserStatusActive = "active"
+	// user account is suspended, the user can't log in
+	UserStatusInactive = "inactive"
 )
 
 var (
-	ErrPasswordTooShort = errors.New("password too short")
-	ErrEmptyUpdate      = errors.New("no update information provided")
+	ErrPasswordTooShort      = errors.New("password too short")
+	ErrEmailDomainNotAllowed = errors.New("email domain is not allowed")
+	ErrEmptyUpdate           = errors.New("no update information provided")
+	ErrInvalidStatus         = NewFieldError("status", "must be one of: "+
+		UserStatusActive+", "+UserStatusInactive)
+	ErrInvalidExpiresAt = NewFieldError("expires_at", "must be in the future")
+	ErrInvalidName      = NewFieldError("name", "too long")
+	ErrInvalidUsername  = NewFieldError("username", "must be 1-64 characters long, "+
+		"start with a letter or digit and consist of letters, digits, '.', '_' and '-'")
+	ErrInvalidPhone      = NewFieldError("phone", "invalid phone number")
+	ErrInvalidLocale     = NewFieldError("locale", "invalid locale, expected e.g. 'en' or 'en-US'")
+	ErrInvalidTimezone   = NewFieldError("timezone", "unknown time zone")
+	ErrTooManyAttributes = NewFieldError("attributes", "too many attributes, the limit is "+
+		strconv.Itoa(MaxAttributes))
+	ErrInvalidAttributeKey = NewFieldError("attributes", "keys must be 1-64 characters long "+
+		"and consist of letters, digits, '_' and '-'")
+	ErrInvalidAttributeValue = NewFieldError("attributes", "values must be at most "+
+		strconv.Itoa(MaxAttributeValueLength)+" characters long")
+
+	phoneRegexp   = regexp.MustCompile(`^\+?[0-9(][0-9 ()-]{2,30}$`)
+	localeRegexp  = regexp.MustCompile(`^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8})*$`)
+	attrKeyRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+	// usernames can't contain '@', to tell them from emails at login
+	usernameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
 )
 
 type User struct {
 	// system-generated user ID
-	ID string `json:"id" bson:"_id"`
+	ID string `json:"id" bson:"_id" readonly:"true"`
 
 	// user email address
 	Email string `json:"email" bson:",omitempty" valid:"email,ascii"`
 
+	// optional login name, an alternative to the email
+	Username string `json:"username,omitempty" bson:"username,omitempty"`
+
 	// user password
 	Password string `json:"password,omitempty" bson:"password"`
 
+	// user's full name
+	Name string `json:"name,omitempty" bson:"name,omitempty"`
+
+	// user's phone number
+	Phone string `json:"phone,omitempty" bson:"phone,omitempty"`
+
+	// user's preferred locale, e.g. en-US
+	Locale string `json:"locale,omitempty" bson:"locale,omitempty"`
+
+	// user's time zone, e.g. Europe/Oslo
+	Timezone string `json:"timezone,omitempty" bson:"timezone,omitempty"`
+
+	// custom attributes, e.g. department or cost center
+	Attributes map[string]string `json:"attributes,omitempty" bson:"attributes,omitempty"`
+
+	// IDs of the groups the user belongs to
+	Groups []string `json:"groups,omitempty" bson:"groups,omitempty"`
+
+	// additional email addresses, managed apart from the other fields
+	Emails []UserEmail `json:"emails,omitempty" bson:"emails,omitempty" readonly:"true"`
+
+	// user account status, users created before statuses were
+	// introduced have none and are considered active
+	Status string `json:"status,omitempty" bson:"status,omitempty"`
+
+	// time after which the user account is disabled, not set for
+	// permanent accounts
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+
 	// timestamp of the user creation
-	CreatedTs *time.Time `json:"created_ts,omitempty" bson:"created_ts,omitempty"`
+	CreatedTs *time.Time `json:"created_ts,omitempty" bson:"created_ts,omitempty" readonly:"true"`
 
 	// timestamp of the last user information update
-	UpdatedTs *time.Time `json:"updated_ts,omitempty" bson:"updated_ts,omitempty"`
+	UpdatedTs *time.Time `json:"updated_ts,omitempty" bson:"updated_ts,omitempty" readonly:"true"`
+
+	// timestamp of the last successful login
+	LastLoginTs *time.Time `json:"last_login_ts,omitempty" bson:"last_login_ts,omitempty" readonly:"true"`
+
+	// IP address of the last successful login
+	LastLoginIP string `json:"last_login_ip,omitempty" bson:"last_login_ip,omitempty" readonly:"true"`
+
+	// number of failed login attempts since the last successful login
+	FailedLoginAttempts int `json:"failed_login_attempts" bson:"failed_login_attempts,omitempty" readonly:"true"`
+
+	// timestamp of the user removal, set only on deleted users
+	DeletedTs *time.Time `json:"-" bson:"deleted_ts,omitempty"`
+
+	// version of the user information, changes on every modification
+	ETag string `json:"-" bson:"etag,omitempty"`
+
+	// blind index of the email, set by the store when the email
+	// is stored encrypted
+	EmailIndex string `json:"-" bson:"email_index,omitempty"`
+}
+
+// IsActive returns false if the user account is suspended or expired
+func (u User) IsActive() bool {
+	return u.Status != UserStatusInactive && !u.IsExpired()
+}
+
+// IsExpired returns true if the user account expiry time has passed
+func (u User) IsExpired() bool {
+	return u.ExpiresAt != nil && !u.ExpiresAt.After(time.Now())
 }
 
 type UserInternal struct {
@@ -56,10 +151,10 @@ type UserInternal struct {
 
 func (u *UserInternal) ValidateNew() error {
 	if u.Email == "" {
-		return errors.New("email can't be empty")
+		return NewFieldError("email", "can't be empty")
 	}
 
-	if _, err := govalidator.ValidateStruct(u); err != nil {
+	if err := validateStruct(u); err != nil {
 		return err
 	}
 
@@ -67,6 +162,10 @@ func (u *UserInternal) ValidateNew() error {
 		return err
 	}
 
+	if err := checkUsername(u.Username); err != nil {
+		return err
+	}
+
 	if u.Password == "" && u.PasswordHash == "" ||
 		u.Password != "" && u.PasswordHash != "" {
 		return errors.New("password *or* password_hash must be provided")
@@ -82,6 +181,22 @@ func (u *UserInternal) ValidateNew() error {
 		return errors.New("password_hash is not supported with 'propagate'; use 'password' instead")
 	}
 
+	if err := checkStatus(u.Status); err != nil {
+		return err
+	}
+
+	if err := checkExpiresAt(u.ExpiresAt); err != nil {
+		return err
+	}
+
+	if err := checkProfile(u.Name, u.Phone, u.Locale, u.Timezone); err != nil {
+		return err
+	}
+
+	if err := checkAttributes(u.Attributes); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -94,39 +209,104 @@ type UserUpdate struct {
 	// user email address
 	Email string `json:"email,omitempty" bson:",omitempty" valid:"email"`
 
+	// login name
+	Username string `json:"username,omitempty" bson:"username,omitempty"`
+
 	// user password
 	Password string `json:"password,omitempty" bson:"password,omitempty"`
 
+	// user's full name
+	Name string `json:"name,omitempty" bson:"name,omitempty"`
+
+	// user's phone number
+	Phone string `json:"phone,omitempty" bson:"phone,omitempty"`
+
+	// user's preferred locale
+	Locale string `json:"locale,omitempty" bson:"locale,omitempty"`
+
+	// user's time zone
+	Timezone string `json:"timezone,omitempty" bson:"timezone,omitempty"`
+
+	// custom attributes, replace the existing ones
+	Attributes map[string]string `json:"attributes,omitempty" bson:"attributes,omitempty"`
+
+	// user account status
+	Status string `json:"status,omitempty" bson:"status,omitempty"`
+
+	// time after which the user account is disabled
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+
 	// timestamp of the last user information update
 	UpdatedTs *time.Time `json:"-" bson:"updated_ts,omitempty"`
+
+	// new version of the user information, set by the store
+	ETag string `json:"-" bson:"etag,omitempty"`
+
+	// blind index of the new email, set by the store
+	EmailIndex string `json:"-" bson:"email_index,omitempty"`
+
+	// database names of the fields to be removed
+	Clear []string `json:"-" bson:"-"`
+
+	// if set, the update is applied only if the current version
+	// of the user information is one of the given ones
+	IfMatch []string `json:"-" bson:"-"`
 }
 
 func (u User) ValidateNew() error {
 	if u.Email == "" {
-		return errors.New("email can't be empty")
+		return NewFieldError("email", "can't be empty")
 	}
 
-	if _, err := govalidator.ValidateStruct(u); err != nil {
+	if err := validateStruct(u); err != nil {
 		return err
 	}
 
 	if u.Password == "" {
-		return errors.New("password can't be empty")
+		return NewFieldError("password", "can't be empty")
 	}
 
 	if err := checkEmail(u.Email); err != nil {
 		return err
 	}
 
+	if err := checkUsername(u.Username); err != nil {
+		return err
+	}
+
 	if err := checkPwd(u.Password); err != nil {
 		return err
 	}
 
+	if err := checkStatus(u.Status); err != nil {
+		return err
+	}
+
+	if err := checkExpiresAt(u.ExpiresAt); err != nil {
+		return err
+	}
+
+	if err := checkProfile(u.Name, u.Phone, u.Locale, u.Timezone); err != nil {
+		return err
+	}
+
+	if err := checkAttributes(u.Attributes); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// IsEmpty returns true if the update modifies nothing
+func (u UserUpdate) IsEmpty() bool {
+	return u.Email == "" && u.Username == "" && u.Password == "" && u.Status == "" &&
+		u.ExpiresAt == nil && u.Name == "" && u.Phone == "" &&
+		u.Locale == "" && u.Timezone == "" && u.Attributes == nil &&
+		len(u.Clear) == 0
+}
+
 func (u UserUpdate) Validate() error {
-	if u.Email == "" && u.Password == "" {
+	if u.IsEmpty() {
 		return ErrEmptyUpdate
 	}
 
@@ -136,6 +316,26 @@ func (u UserUpdate) Validate() error {
 		}
 	}
 
+	if err := checkUsername(u.Username); err != nil {
+		return err
+	}
+
+	if err := checkStatus(u.Status); err != nil {
+		return err
+	}
+
+	if err := checkExpiresAt(u.ExpiresAt); err != nil {
+		return err
+	}
+
+	if err := checkProfile(u.Name, u.Phone, u.Locale, u.Timezone); err != nil {
+		return err
+	}
+
+	if err := checkAttributes(u.Attributes); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -148,9 +348,177 @@ func checkPwd(password string) error {
 	return nil
 }
 
+func checkStatus(status string) error {
+	switch status {
+	case "", UserStatusActive, UserStatusInactive:
+		return nil
+	default:
+		return ErrInvalidStatus
+	}
+}
+
+func checkExpiresAt(expiresAt *time.Time) error {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return ErrInvalidExpiresAt
+	}
+
+	return nil
+}
+
+// check the optional profile fields
+func checkProfile(name, phone, locale, timezone string) error {
+	if len(name) > MaxNameLength {
+		return ErrInvalidName
+	}
+
+	if phone != "" && !phoneRegexp.MatchString(phone) {
+		return ErrInvalidPhone
+	}
+
+	if locale != "" && !localeRegexp.MatchString(locale) {
+		return ErrInvalidLocale
+	}
+
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+			return ErrInvalidTimezone
+		}
+	}
+
+	return nil
+}
+
+func checkAttributes(attrs map[string]string) error {
+	if len(attrs) > MaxAttributes {
+		return ErrTooManyAttributes
+	}
+
+	for k, v := range attrs {
+		if !attrKeyRegexp.MatchString(k) {
+			return ErrInvalidAttributeKey
+		}
+		if len(v) > MaxAttributeValueLength {
+			return ErrInvalidAttributeValue
+		}
+	}
+
+	return nil
+}
+
+// NormalizeEmail returns the email in the form it's stored and looked up
+// in: NFC normalized and lower case, so that emails differing only by case
+// or by the unicode composition of their characters are the same
+func NormalizeEmail(email string) string {
+	return strings.ToLower(norm.NFC.String(email))
+}
+
+// EmailDomain returns the lower case domain part of the email
+func EmailDomain(email string) string {
+	return strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+}
+
+// NormalizeUsername returns the username in the form it's stored and
+// looked up in, lower case
+func NormalizeUsername(username string) string {
+	return strings.ToLower(username)
+}
+
+// IsUsername tells a username from an email, given as the login
+// identity of a user
+func IsUsername(login string) bool {
+	return !strings.Contains(login, "@")
+}
+
+func checkUsername(username string) error {
+	if username != "" && !usernameRegexp.MatchString(username) {
+		return ErrInvalidUsername
+	}
+	return nil
+}
+
 func checkEmail(email string) error {
 	if strings.Contains(email, "+") {
-		return errors.New("email: invalid character '+' in email address")
+		return NewFieldError("email", "invalid character '+' in email address")
+	}
+
+	return nil
+}
+
+// UserLookup tells which tenant a user belongs to
+type UserLookup struct {
+	ID       string `json:"id"`
+	Email    string `json:"email"`
+	Username string `json:"username,omitempty"`
+	TenantID string `json:"tenant_id,omitempty"`
+}
+
+// UserFilter narrows down the list of users
+type UserFilter struct {
+	// users having all of the given attribute values
+	Attributes map[string]string
+
+	// members of the group with the given ID
+	Group string
+
+	// the user with the given ID only
+	ID string
+
+	// only the active users, see User.IsActive
+	Active bool
+
+	// paging, users are then ordered by email;
+	// a zero Limit returns all users
+	Skip  int
+	Limit int
+
+	// fields of the users returned, by their JSON names,
+	// see UserFields; all if empty
+	Fields []string
+}
+
+// UsersVersion summarizes the state of the users matching a filter;
+// it changes whenever such a user is added, modified, removed or logs in
+type UsersVersion struct {
+	Count int `bson:"count"`
+
+	// latest modification and login of the users
+	UpdatedTs   time.Time `bson:"updated_ts"`
+	LastLoginTs time.Time `bson:"last_login_ts"`
+
+	// total failed login attempts, not reflected in the timestamps
+	FailedLoginAttempts int `bson:"failed_login_attempts"`
+}
+
+// UserFields lists the fields users can be fetched with
+var UserFields = []string{
+	"id", "email", "username", "name", "phone", "locale", "timezone", "attributes",
+	"groups", "emails", "status", "expires_at", "created_ts", "updated_ts",
+	"last_login_ts", "last_login_ip", "failed_login_attempts",
+}
+
+func (f UserFilter) Validate() error {
+	for k := range f.Attributes {
+		if !attrKeyRegexp.MatchString(k) {
+			return ErrInvalidAttributeKey
+		}
+	}
+
+	return ValidateUserFields(f.Fields)
+}
+
+// ValidateUserFields checks that all the fields are listed in UserFields
+func ValidateUserFields(fields []string) error {
+	for _, f := range fields {
+		known := false
+		for _, uf := range UserFields {
+			if f == uf {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return NewFieldError("fields", "unknown field: "+f)
+		}
 	}
 
 	return nil
@@ -0,0 +1,58 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+// UserData gathers everything stored about a user, returned
+// on data subject access requests
+type UserData struct {
+	// the user profile, without the password
+	User User `json:"user"`
+
+	// groups the user belongs to
+	Groups []Group `json:"groups"`
+
+	// metadata of the tokens issued to the user
+	Tokens []TokenInfo `json:"tokens"`
+
+	// login history, most recent first
+	LoginHistory []LoginEvent `json:"login_history"`
+
+	// the user's entries of the tenant settings
+	Settings UserDataSettings `json:"settings"`
+
+	// time of the export
+	ExportedTs time.Time `json:"exported_ts"`
+}
+
+// TokenInfo describes a token issued to the user, without the token itself
+type TokenInfo struct {
+	ID        string    `json:"id"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// the super-admin acting as the user, for impersonation tokens
+	Impersonator string `json:"impersonator,omitempty"`
+}
+
+// UserDataSettings are the tenant settings concerning the user
+type UserDataSettings struct {
+	// true if the user opted out of email notifications
+	NotificationsOptOut bool `json:"email_notifications_opt_out"`
+
+	// the user's own settings
+	Preferences map[string]interface{} `json:"preferences"`
+}
@@ -0,0 +1,100 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"time"
+)
+
+const (
+	// additional email addresses a user can have, besides the primary one
+	MaxUserEmails = 10
+)
+
+var (
+	ErrTooManyEmails = NewFieldError("email", "too many email addresses, the limit is 10")
+	ErrEmptyCode     = NewFieldError("code", "can't be empty")
+)
+
+// UserEmail is an additional email address of the user; once verified,
+// the user can log in with it, and it can become the primary address
+type UserEmail struct {
+	Email string `json:"email" bson:"email"`
+
+	Verified bool `json:"verified" bson:"verified"`
+
+	// timestamp of the address addition
+	CreatedTs *time.Time `json:"created_ts,omitempty" bson:"created_ts,omitempty"`
+
+	// timestamp of the address verification
+	VerifiedTs *time.Time `json:"verified_ts,omitempty" bson:"verified_ts,omitempty"`
+
+	// hash of the code sent to the address to verify it
+	CodeHash string `json:"-" bson:"code_hash,omitempty"`
+
+	// blind index of the email, set by the store when the email
+	// is stored encrypted
+	EmailIndex string `json:"-" bson:"email_index,omitempty"`
+}
+
+// UserEmailNew is an email address to add to the user
+type UserEmailNew struct {
+	Email string `json:"email" valid:"email,ascii"`
+}
+
+func (e UserEmailNew) Validate() error {
+	if e.Email == "" {
+		return NewFieldError("email", "can't be empty")
+	}
+
+	if err := validateStruct(e); err != nil {
+		return err
+	}
+
+	return checkEmail(e.Email)
+}
+
+// EmailVerification carries the code sent to an email address
+// of the user, to prove the user owns it
+type EmailVerification struct {
+	Code string `json:"code"`
+}
+
+func (v EmailVerification) Validate() error {
+	if v.Code == "" {
+		return ErrEmptyCode
+	}
+	return nil
+}
+
+// FindEmail returns the additional email address of the user,
+// nil if the user has no such address
+func (u *User) FindEmail(email string) *UserEmail {
+	for i := range u.Emails {
+		if u.Emails[i].Email == email {
+			return &u.Emails[i]
+		}
+	}
+	return nil
+}
+
+// CanLoginWith tells if the user can log in with the email, the primary
+// one or a verified additional one
+func (u *User) CanLoginWith(email string) bool {
+	if u.Email == email {
+		return true
+	}
+	e := u.FindEmail(email)
+	return e != nil && e.Verified
+}
@@ -0,0 +1,89 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserEmailNewValidate(t *testing.T) {
+	testCases := map[string]struct {
+		email  UserEmailNew
+		outErr string
+	}{
+		"ok": {
+			email: UserEmailNew{Email: "foo@bar.com"},
+		},
+		"error: empty": {
+			outErr: "email: can't be empty",
+		},
+		"error: invalid": {
+			email:  UserEmailNew{Email: "foobar"},
+			outErr: "email: foobar does not validate as email",
+		},
+		"error: invalid(+)": {
+			email:  UserEmailNew{Email: "foo+bar@bar.com"},
+			outErr: "email: invalid character '+' in email address",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		err := tc.email.Validate()
+		if tc.outErr != "" {
+			assert.EqualError(t, err, tc.outErr)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestUserCanLoginWith(t *testing.T) {
+	user := User{
+		Email: "foo@bar.com",
+		Emails: []UserEmail{
+			{Email: "foo@baz.com", Verified: true},
+			{Email: "foo@qux.com"},
+		},
+	}
+
+	testCases := map[string]struct {
+		email string
+		ok    bool
+	}{
+		"primary": {
+			email: "foo@bar.com",
+			ok:    true,
+		},
+		"verified": {
+			email: "foo@baz.com",
+			ok:    true,
+		},
+		"not verified": {
+			email: "foo@qux.com",
+		},
+		"unknown": {
+			email: "bar@bar.com",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		assert.Equal(t, tc.ok, user.CanLoginWith(tc.email))
+	}
+}
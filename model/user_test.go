@@ -14,12 +14,18 @@
 package model
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestValidateNew(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
 	testCases := map[string]struct {
 		inUser User
 
@@ -37,7 +43,7 @@ func TestValidateNew(t *testing.T) {
 				Email:    "foobar",
 				Password: "correcthorsebatterystaple",
 			},
-			outErr: "email: foobar does not validate as email;",
+			outErr: "email: foobar does not validate as email",
 		},
 		"email invalid(+) pass ok": {
 			inUser: User{
@@ -51,14 +57,14 @@ func TestValidateNew(t *testing.T) {
 				Email:    "ąę@org.com",
 				Password: "correcthorsebatterystaple",
 			},
-			outErr: "email: ąę@org.com does not validate as ascii;",
+			outErr: "email: ąę@org.com does not validate as ascii",
 		},
 		"email ok, pass invalid (empty)": {
 			inUser: User{
 				Email:    "foo@bar.com",
 				Password: "",
 			},
-			outErr: "password can't be empty",
+			outErr: "password: can't be empty",
 		},
 		"email ok, pass invalid (too short)": {
 			inUser: User{
@@ -67,6 +73,97 @@ func TestValidateNew(t *testing.T) {
 			},
 			outErr: "password too short",
 		},
+		"email ok, pass ok, status ok": {
+			inUser: User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+				Status:   UserStatusInactive,
+			},
+			outErr: "",
+		},
+		"username ok": {
+			inUser: User{
+				Email:    "foo@bar.com",
+				Username: "foo.bar_1",
+				Password: "correcthorsebatterystaple",
+			},
+			outErr: "",
+		},
+		"username invalid": {
+			inUser: User{
+				Email:    "foo@bar.com",
+				Username: "-foo bar",
+				Password: "correcthorsebatterystaple",
+			},
+			outErr: ErrInvalidUsername.Error(),
+		},
+		"email ok, pass ok, status invalid": {
+			inUser: User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+				Status:   "suspended",
+			},
+			outErr: ErrInvalidStatus.Error(),
+		},
+		"email ok, pass ok, expires_at ok": {
+			inUser: User{
+				Email:     "foo@bar.com",
+				Password:  "correcthorsebatterystaple",
+				ExpiresAt: &future,
+			},
+			outErr: "",
+		},
+		"email ok, pass ok, expires_at in the past": {
+			inUser: User{
+				Email:     "foo@bar.com",
+				Password:  "correcthorsebatterystaple",
+				ExpiresAt: &past,
+			},
+			outErr: ErrInvalidExpiresAt.Error(),
+		},
+		"email ok, pass ok, profile ok": {
+			inUser: User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+				Name:     "Foo Bar",
+				Phone:    "+47 123 45 678",
+				Locale:   "nb-NO",
+				Timezone: "Europe/Oslo",
+			},
+			outErr: "",
+		},
+		"email ok, pass ok, name too long": {
+			inUser: User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+				Name:     strings.Repeat("a", MaxNameLength+1),
+			},
+			outErr: ErrInvalidName.Error(),
+		},
+		"email ok, pass ok, phone invalid": {
+			inUser: User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+				Phone:    "call me maybe",
+			},
+			outErr: ErrInvalidPhone.Error(),
+		},
+		"email ok, pass ok, locale invalid": {
+			inUser: User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+				Locale:   "english",
+			},
+			outErr: ErrInvalidLocale.Error(),
+		},
+		"email ok, pass ok, timezone invalid": {
+			inUser: User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+				Timezone: "Europe/Atlantis",
+			},
+			outErr: ErrInvalidTimezone.Error(),
+		},
 	}
 
 	for name, tc := range testCases {
@@ -81,3 +178,175 @@ func TestValidateNew(t *testing.T) {
 		}
 	}
 }
+
+func TestUserUpdateValidate(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	testCases := map[string]struct {
+		inUpdate UserUpdate
+
+		outErr error
+	}{
+		"ok, email": {
+			inUpdate: UserUpdate{
+				Email: "foo@bar.com",
+			},
+		},
+		"ok, status": {
+			inUpdate: UserUpdate{
+				Status: UserStatusActive,
+			},
+		},
+		"ok, expires_at": {
+			inUpdate: UserUpdate{
+				ExpiresAt: &future,
+			},
+		},
+		"ok, profile": {
+			inUpdate: UserUpdate{
+				Name:     "Foo Bar",
+				Phone:    "(555) 123-4567",
+				Locale:   "en_US",
+				Timezone: "America/New_York",
+			},
+		},
+		"error, empty": {
+			inUpdate: UserUpdate{},
+			outErr:   ErrEmptyUpdate,
+		},
+		"error, password too short": {
+			inUpdate: UserUpdate{
+				Password: "asdf",
+			},
+			outErr: ErrPasswordTooShort,
+		},
+		"error, status invalid": {
+			inUpdate: UserUpdate{
+				Status: "suspended",
+			},
+			outErr: ErrInvalidStatus,
+		},
+		"error, expires_at in the past": {
+			inUpdate: UserUpdate{
+				ExpiresAt: &past,
+			},
+			outErr: ErrInvalidExpiresAt,
+		},
+		"error, timezone invalid": {
+			inUpdate: UserUpdate{
+				Timezone: "Local",
+			},
+			outErr: ErrInvalidTimezone,
+		},
+		"ok, attributes": {
+			inUpdate: UserUpdate{
+				Attributes: map[string]string{"department": "rnd"},
+			},
+		},
+		"error, too many attributes": {
+			inUpdate: UserUpdate{
+				Attributes: func() map[string]string {
+					attrs := map[string]string{}
+					for i := 0; i <= MaxAttributes; i++ {
+						attrs[fmt.Sprintf("attr%d", i)] = "value"
+					}
+					return attrs
+				}(),
+			},
+			outErr: ErrTooManyAttributes,
+		},
+		"error, invalid attribute key": {
+			inUpdate: UserUpdate{
+				Attributes: map[string]string{"cost.center": "42"},
+			},
+			outErr: ErrInvalidAttributeKey,
+		},
+		"error, attribute value too long": {
+			inUpdate: UserUpdate{
+				Attributes: map[string]string{"department": strings.Repeat("a", MaxAttributeValueLength+1)},
+			},
+			outErr: ErrInvalidAttributeValue,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case %s", name)
+
+		err := tc.inUpdate.Validate()
+
+		if tc.outErr == nil {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, tc.outErr.Error())
+		}
+	}
+}
+
+func TestUserIsActive(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	testCases := map[string]struct {
+		user   User
+		active bool
+	}{
+		"no status": {
+			user:   User{},
+			active: true,
+		},
+		"active": {
+			user:   User{Status: UserStatusActive},
+			active: true,
+		},
+		"inactive": {
+			user:   User{Status: UserStatusInactive},
+			active: false,
+		},
+		"not expired yet": {
+			user:   User{Status: UserStatusActive, ExpiresAt: &future},
+			active: true,
+		},
+		"expired": {
+			user:   User{Status: UserStatusActive, ExpiresAt: &past},
+			active: false,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case %s", name)
+
+		assert.Equal(t, tc.active, tc.user.IsActive())
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	testCases := map[string]struct {
+		email string
+		out   string
+	}{
+		"lower case": {
+			email: "foo@bar.com",
+			out:   "foo@bar.com",
+		},
+		"mixed case": {
+			email: "Foo@BAR.com",
+			out:   "foo@bar.com",
+		},
+		"decomposed": {
+			// e followed by a combining acute accent
+			email: "Jose\u0301@bar.com",
+			out:   "jos\u00e9@bar.com",
+		},
+		"composed, upper case": {
+			email: "JOS\u00c9@bar.com",
+			out:   "jos\u00e9@bar.com",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.out, NormalizeEmail(tc.email))
+		})
+	}
+}
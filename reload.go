@@ -0,0 +1,95 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/keys"
+)
+
+// configFileReader is implemented by the configuration handlers backed
+// by a file, which can be read again
+type configFileReader interface {
+	ConfigFileUsed() string
+	ReadInConfig() error
+}
+
+// setupLogLevel applies the configured log level to the global logger
+func setupLogLevel(c config.Reader) error {
+	level, err := logrus.ParseLevel(strings.ToLower(c.GetString(SettingLogLevel)))
+	if err != nil {
+		return errors.Wrapf(err, "invalid %s", SettingLogLevel)
+	}
+	log.Log.Level = level
+	return nil
+}
+
+// reloadConfig reads the configuration file again and applies the settings
+// which don't need a restart: the log level, the JWT signing key and
+// the TLS certificate
+func reloadConfig(c config.Reader, jwth *jwt.JWTHandlerRS256,
+	certLoader *keys.CertLoader) error {
+	if f, ok := c.(configFileReader); ok && f.ConfigFileUsed() != "" {
+		if err := f.ReadInConfig(); err != nil {
+			return errors.Wrap(err, "failed to read configuration")
+		}
+	}
+
+	if err := setupLogLevel(c); err != nil {
+		return err
+	}
+
+	privKey, err := keys.LoadRSAPrivate(c.GetString(SettingPrivKeyPath))
+	if err != nil {
+		return errors.Wrap(err, "failed to read rsa private key")
+	}
+	jwth.SetPrivateKey(privKey)
+
+	if certLoader != nil {
+		if err := certLoader.Reload(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reloadOnSignal calls reload on every SIGHUP; a failed reload keeps
+// the settings in effect before it
+func reloadOnSignal(reload func() error) {
+	l := log.New(log.Ctx{})
+
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	for range sighup {
+		l.Infof("reloading configuration")
+		if err := reload(); err != nil {
+			l.Errorf("failed to reload configuration: %v", err)
+			continue
+		}
+		l.Infof("configuration reloaded")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	cmocks "github.com/mendersoftware/go-lib-micro/config/mocks"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/keys"
+)
+
+func TestSetupLogLevel(t *testing.T) {
+	defer func(level logrus.Level) {
+		log.Log.Level = level
+	}(log.Log.Level)
+
+	testCases := map[string]struct {
+		level string
+
+		outLevel logrus.Level
+		err      string
+	}{
+		"ok": {
+			level:    "debug",
+			outLevel: logrus.DebugLevel,
+		},
+		"ok, upper case": {
+			level:    "WARNING",
+			outLevel: logrus.WarnLevel,
+		},
+		"error: invalid": {
+			level:    "foo",
+			outLevel: logrus.WarnLevel,
+			err:      `invalid log_level: not a valid logrus Level: "foo"`,
+		},
+	}
+
+	for _, name := range []string{"ok", "ok, upper case", "error: invalid"} {
+		tc := testCases[name]
+		t.Logf("test case: %s", name)
+
+		conf := &cmocks.Reader{}
+		conf.On("GetString", SettingLogLevel).Return(tc.level)
+
+		err := setupLogLevel(conf)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err)
+		} else {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, tc.outLevel, log.Log.Level)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	defer func(level logrus.Level) {
+		log.Log.Level = level
+	}(log.Log.Level)
+
+	privKey, err := keys.LoadRSAPrivate("crypto/private.pem")
+	assert.NoError(t, err)
+	jwth := jwt.NewJWTHandlerRS256(privKey)
+
+	conf := &cmocks.Reader{}
+	conf.On("GetString", SettingLogLevel).Return("error")
+	conf.On("GetString", SettingPrivKeyPath).Return("crypto/private.pem")
+
+	assert.NoError(t, reloadConfig(conf, jwth, nil))
+	assert.Equal(t, logrus.ErrorLevel, log.Log.Level)
+
+	conf = &cmocks.Reader{}
+	conf.On("GetString", SettingLogLevel).Return("info")
+	conf.On("GetString", SettingPrivKeyPath).Return("crypto/missing.pem")
+
+	err = reloadConfig(conf, jwth, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read rsa private key")
+}
@@ -0,0 +1,331 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package schema validates JSON documents against a JSON Schema.
+//
+// Only the subset of JSON Schema (draft 4) useful for describing settings
+// is supported: the type, properties, required, additionalProperties
+// (boolean only), items (a single schema), enum, minimum, maximum,
+// minLength, maxLength, minItems, maxItems and pattern (RE2 syntax)
+// keywords; schemas using other keywords are rejected rather than
+// silently not enforced.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+const (
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeInteger = "integer"
+	TypeBoolean = "boolean"
+	TypeNull    = "null"
+
+	// field name of errors concerning the whole document
+	rootField = "(root)"
+)
+
+// Schema is a parsed JSON Schema
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+
+	// annotations, not validated
+	SchemaURI   string      `json:"$schema,omitempty"`
+	ID          string      `json:"id,omitempty"`
+	Title       string      `json:"title,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+// Parse parses the JSON encoded schema, unsupported keywords are an error
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		if strings.HasPrefix(err.Error(), "json: unknown field") {
+			return nil, errors.Errorf("unsupported keyword %s",
+				strings.TrimPrefix(err.Error(), "json: unknown field "))
+		}
+		return nil, errors.Wrap(err, "failed to decode schema")
+	}
+
+	if err := s.compile(""); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Load parses the schema from the file at the given path
+func Load(path string) (*Schema, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read schema")
+	}
+
+	return Parse(data)
+}
+
+// compile checks the keywords and compiles the patterns of the schema
+// found at the given path
+func (s *Schema) compile(path string) error {
+	switch s.Type {
+	case "", TypeObject, TypeArray, TypeString, TypeNumber,
+		TypeInteger, TypeBoolean, TypeNull:
+	default:
+		return errors.Errorf("%s: unknown type %q", pathOrRoot(path), s.Type)
+	}
+
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return errors.Wrapf(err, "%s: invalid pattern", pathOrRoot(path))
+		}
+		s.pattern = re
+	}
+
+	for name, p := range s.Properties {
+		if p == nil {
+			return errors.Errorf("%s: empty schema", joinPath(path, name))
+		}
+		if err := p.compile(joinPath(path, name)); err != nil {
+			return err
+		}
+	}
+
+	if s.Items != nil {
+		if err := s.Items.compile(path + "[]"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Property returns the schema of the object's property, nil if any value
+// is allowed; ok is false if the property is not allowed at all
+func (s *Schema) Property(name string) (property *Schema, ok bool) {
+	if p, found := s.Properties[name]; found {
+		return p, true
+	}
+
+	return nil, s.AdditionalProperties == nil || *s.AdditionalProperties
+}
+
+// Requires tells if the object's property is required
+func (s *Schema) Requires(name string) bool {
+	for _, r := range s.Required {
+		if r == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate checks the value decoded from JSON against the schema; the
+// returned model.FieldErrors name the invalid values by their path
+// within the value, prefixed with field
+func (s *Schema) Validate(field string, v interface{}) error {
+	errs := s.validate(field, v)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *Schema) validate(path string, v interface{}) model.FieldErrors {
+	errs := model.FieldErrors{}
+	fail := func(format string, args ...interface{}) model.FieldErrors {
+		return append(errs, model.NewFieldError(pathOrRoot(path),
+			fmt.Sprintf(format, args...)))
+	}
+
+	if s.Type != "" && !hasType(v, s.Type) {
+		return fail("must be of type %s", s.Type)
+	}
+
+	if len(s.Enum) > 0 && !inEnum(v, s.Enum) {
+		return fail("must be one of the allowed values")
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for _, r := range s.Required {
+			if _, ok := value[r]; !ok {
+				errs = append(errs, model.NewFieldError(joinPath(path, r),
+					"is required"))
+			}
+		}
+		for _, name := range sortedKeys(value) {
+			p, ok := s.Property(name)
+			if !ok {
+				errs = append(errs, model.NewFieldError(joinPath(path, name),
+					"is not allowed"))
+			} else if p != nil {
+				errs = append(errs, p.validate(joinPath(path, name), value[name])...)
+			}
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			return fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			return fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range value {
+				errs = append(errs,
+					s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+
+	case string:
+		n := utf8.RuneCountInString(value)
+		if s.MinLength != nil && n < *s.MinLength {
+			return fail("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fail("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			return fail("must match the pattern %s", s.Pattern)
+		}
+
+	default:
+		if n, ok := toFloat(v); ok {
+			if s.Minimum != nil && n < *s.Minimum {
+				return fail("must be at least %v", *s.Minimum)
+			}
+			if s.Maximum != nil && n > *s.Maximum {
+				return fail("must be at most %v", *s.Maximum)
+			}
+		}
+	}
+
+	return errs
+}
+
+func hasType(v interface{}, t string) bool {
+	switch t {
+	case TypeObject:
+		_, ok := v.(map[string]interface{})
+		return ok
+	case TypeArray:
+		_, ok := v.([]interface{})
+		return ok
+	case TypeString:
+		_, ok := v.(string)
+		return ok
+	case TypeNumber:
+		_, ok := toFloat(v)
+		return ok
+	case TypeInteger:
+		n, ok := toFloat(v)
+		return ok && n == math.Trunc(n)
+	case TypeBoolean:
+		_, ok := v.(bool)
+		return ok
+	case TypeNull:
+		return v == nil
+	}
+	return false
+}
+
+func inEnum(v interface{}, enum []interface{}) bool {
+	n, isNumber := toFloat(v)
+	for _, e := range enum {
+		if en, ok := toFloat(e); ok && isNumber {
+			if n == en {
+				return true
+			}
+		} else if reflect.DeepEqual(v, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// toFloat converts a number decoded from JSON or BSON
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return rootField
+	}
+	return path
+}
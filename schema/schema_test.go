@@ -0,0 +1,215 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package schema
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSchema = `{
+	"$schema": "http://json-schema.org/draft-04/schema#",
+	"title": "UI settings",
+	"type": "object",
+	"properties": {
+		"theme": {"type": "string", "enum": ["light", "dark"]},
+		"page_size": {"type": "integer", "minimum": 10, "maximum": 500},
+		"name": {"type": "string", "minLength": 2, "maxLength": 5, "pattern": "^[a-z]+$"},
+		"columns": {
+			"type": "array",
+			"minItems": 1,
+			"maxItems": 3,
+			"items": {"type": "string"}
+		},
+		"layout": {
+			"type": "object",
+			"properties": {
+				"compact": {"type": "boolean"}
+			},
+			"required": ["compact"],
+			"additionalProperties": false
+		},
+		"anything": {}
+	},
+	"required": ["theme"]
+}`
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		schema string
+		err    string
+	}{
+		"ok": {
+			schema: testSchema,
+		},
+		"ok, empty": {
+			schema: `{}`,
+		},
+		"error: unsupported keyword": {
+			schema: `{"type": "object", "oneOf": []}`,
+			err:    `unsupported keyword "oneOf"`,
+		},
+		"error: unsupported nested keyword": {
+			schema: `{"properties": {"foo": {"format": "email"}}}`,
+			err:    `unsupported keyword "format"`,
+		},
+		"error: unknown type": {
+			schema: `{"properties": {"foo": {"type": "text"}}}`,
+			err:    `foo: unknown type "text"`,
+		},
+		"error: invalid pattern": {
+			schema: `{"pattern": "(["}`,
+			err: "(root): invalid pattern: error parsing regexp: " +
+				"missing closing ]: `[`",
+		},
+		"error: not json": {
+			schema: `foo`,
+			err:    "failed to decode schema: invalid character 'o' in literal false (expecting 'a')",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			s, err := Parse([]byte(tc.schema))
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, s)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	f, err := ioutil.TempFile("", "schema")
+	assert.NoError(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(testSchema)
+	assert.NoError(t, err)
+	f.Close()
+
+	s, err := Load(f.Name())
+	assert.NoError(t, err)
+	assert.True(t, s.Requires("theme"))
+
+	_, err = Load(f.Name() + "-missing")
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	s, err := Parse([]byte(testSchema))
+	assert.NoError(t, err)
+
+	testCases := map[string]struct {
+		value interface{}
+		err   string
+	}{
+		"ok": {
+			value: map[string]interface{}{
+				"theme":     "dark",
+				"page_size": float64(20),
+				"name":      "foo",
+				"columns":   []interface{}{"email"},
+				"layout":    map[string]interface{}{"compact": true},
+				"anything":  []interface{}{1, "a", nil},
+				"other":     "not described",
+			},
+		},
+		"ok, bson ints": {
+			value: map[string]interface{}{
+				"theme":     "light",
+				"page_size": int64(20),
+			},
+		},
+		"error: not an object": {
+			value: "foo",
+			err:   "settings: must be of type object",
+		},
+		"error: missing required": {
+			value: map[string]interface{}{},
+			err:   "settings.theme: is required",
+		},
+		"error: values": {
+			value: map[string]interface{}{
+				"theme":     "blue",
+				"page_size": 10.5,
+				"name":      "Foo",
+				"columns":   []interface{}{"email", 1},
+				"layout": map[string]interface{}{
+					"wide": true,
+				},
+			},
+			err: "settings.columns[1]: must be of type string; " +
+				"settings.layout.compact: is required; " +
+				"settings.layout.wide: is not allowed; " +
+				"settings.name: must match the pattern ^[a-z]+$; " +
+				"settings.page_size: must be of type integer; " +
+				"settings.theme: must be one of the allowed values",
+		},
+		"error: bounds": {
+			value: map[string]interface{}{
+				"theme":     "dark",
+				"page_size": float64(1000),
+				"name":      "foobarbaz",
+				"columns":   []interface{}{},
+			},
+			err: "settings.columns: must have at least 1 items; " +
+				"settings.name: must be at most 5 characters long; " +
+				"settings.page_size: must be at most 500",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			err := s.Validate("settings", tc.value)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestProperty(t *testing.T) {
+	t.Parallel()
+
+	s, err := Parse([]byte(testSchema))
+	assert.NoError(t, err)
+
+	p, ok := s.Property("theme")
+	assert.True(t, ok)
+	assert.Equal(t, TypeString, p.Type)
+
+	p, ok = s.Property("other")
+	assert.True(t, ok)
+	assert.Nil(t, p)
+
+	p, ok = s.Properties["layout"].Property("other")
+	assert.False(t, ok)
+	assert.Nil(t, p)
+
+	assert.Error(t, s.Validate("", "foo"))
+	assert.EqualError(t, s.Validate("", "foo"), "(root): must be of type object")
+}
@@ -13,9 +13,76 @@
 //    limitations under the License.
 package scope
 
+import (
+	"errors"
+	"strings"
+)
+
 var (
 	// inital user creation
 	InitialUserCreate = "mender.users.initial.create"
+	// receipts of user data erasure, not valid for authentication
+	UserErasure = "mender.users.erasure"
 	// full permissions for the tenant admin
 	All = "mender.*"
+	// hosted operators, addressing any tenant with the tenant header;
+	// not granted by the full permissions
+	Operator = "mender.operator"
+
+	// users and groups
+	UsersRead  = "mender.users:read"
+	UsersWrite = "mender.users:write"
+	// tenant settings
+	SettingsRead  = "mender.settings:read"
+	SettingsWrite = "mender.settings:write"
 )
+
+const (
+	suffixRead  = ":read"
+	suffixWrite = ":write"
+)
+
+var (
+	ErrScopeInvalid = errors.New("invalid scope")
+
+	// scopes which may be requested for the tokens
+	known = map[string]bool{
+		All:           true,
+		UsersRead:     true,
+		UsersWrite:    true,
+		SettingsRead:  true,
+		SettingsWrite: true,
+		Operator:      true,
+	}
+)
+
+// Allows checks if the token's scope, a space-separated list of scopes,
+// grants the required one; the write scopes grant the reads too
+func Allows(tokenScope, required string) bool {
+	for _, s := range strings.Fields(tokenScope) {
+		if (s == All && required != Operator) || s == required {
+			return true
+		}
+		if strings.HasSuffix(required, suffixRead) &&
+			s == strings.TrimSuffix(required, suffixRead)+suffixWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// Narrow returns the scope of a token limited to the requested scopes,
+// which must be known and granted; the granted scope is returned as is
+// if none are requested
+func Narrow(granted, requested string) (string, error) {
+	scopes := strings.Fields(requested)
+	if len(scopes) == 0 {
+		return granted, nil
+	}
+	for _, s := range scopes {
+		if !known[s] || !Allows(granted, s) {
+			return "", ErrScopeInvalid
+		}
+	}
+	return strings.Join(scopes, " "), nil
+}
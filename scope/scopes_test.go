@@ -0,0 +1,104 @@
+// Copyright 2017 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package scope
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllows(t *testing.T) {
+	testCases := map[string]struct {
+		tokenScope string
+		required   string
+
+		allowed bool
+	}{
+		"all":             {All, UsersWrite, true},
+		"same":            {UsersRead, UsersRead, true},
+		"write for read":  {UsersWrite, UsersRead, true},
+		"read for write":  {UsersRead, UsersWrite, false},
+		"one of many":     {SettingsRead + " " + UsersWrite, UsersWrite, true},
+		"other resource":  {SettingsWrite, UsersRead, false},
+		"erasure receipt": {UserErasure, UsersRead, false},
+		"empty":           {"", UsersRead, false},
+		"operator":        {All + " " + Operator, Operator, true},
+		"all, operator":   {All, Operator, false},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.allowed, Allows(tc.tokenScope, tc.required))
+		})
+	}
+}
+
+func TestNarrow(t *testing.T) {
+	testCases := map[string]struct {
+		granted   string
+		requested string
+
+		scope string
+		err   error
+	}{
+		"none requested": {
+			granted: All,
+			scope:   All,
+		},
+		"narrowed": {
+			granted:   All,
+			requested: UsersRead + "  " + SettingsWrite,
+			scope:     UsersRead + " " + SettingsWrite,
+		},
+		"read of granted write": {
+			granted:   UsersWrite,
+			requested: UsersRead,
+			scope:     UsersRead,
+		},
+		"error: not granted": {
+			granted:   UsersRead,
+			requested: UsersWrite,
+			err:       ErrScopeInvalid,
+		},
+		"error: unknown": {
+			granted:   All,
+			requested: "mender.devices:read",
+			err:       ErrScopeInvalid,
+		},
+		"operator": {
+			granted:   All + " " + Operator,
+			requested: UsersRead + " " + Operator,
+			scope:     UsersRead + " " + Operator,
+		},
+		"error: operator not granted": {
+			granted:   All,
+			requested: Operator,
+			err:       ErrScopeInvalid,
+		},
+		"error: erasure": {
+			granted:   All,
+			requested: UserErasure,
+			err:       ErrScopeInvalid,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			scope, err := Narrow(tc.granted, tc.requested)
+			assert.Equal(t, tc.err, err)
+			assert.Equal(t, tc.scope, scope)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	// suffix of the settings naming the file a secret is read from,
+	// e.g. mongo_password_file or USERADM_MONGO_PASSWORD_FILE
+	secretFileSuffix = "_file"
+)
+
+// secretSettings are the settings which can be read from a file, e.g.
+// a Docker or Kubernetes secret, instead of being set directly
+var secretSettings = []string{
+	SettingDbDSN,
+	SettingDbUsername,
+	SettingDbPassword,
+	SettingSMTPUsername,
+	SettingSMTPPassword,
+	SettingTwilioAuthToken,
+}
+
+// loadSecretFiles sets the secret settings from the files named by their
+// *_file variants; setting both a secret and its file is an error
+func loadSecretFiles(c config.Handler) error {
+	for _, setting := range secretSettings {
+		path := c.GetString(setting + secretFileSuffix)
+		if path == "" {
+			continue
+		}
+		if c.GetString(setting) != "" {
+			return errors.Errorf("both %s and %s are set",
+				setting, setting+secretFileSuffix)
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", setting+secretFileSuffix)
+		}
+		// files written with an editor or echo end with a newline
+		c.Set(setting, strings.TrimRight(string(data), "\r\n"))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadSecretFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "useradm-secrets")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	secret := filepath.Join(dir, "secret")
+	assert.NoError(t, ioutil.WriteFile(secret, []byte("s3cr3t\n"), 0600))
+
+	testCases := map[string]struct {
+		settings map[string]string
+
+		password string
+		err      string
+	}{
+		"ok": {
+			settings: map[string]string{
+				"mongo_password_file": secret,
+			},
+			password: "s3cr3t",
+		},
+		"ok, no file": {
+			settings: map[string]string{
+				"mongo_password": "secret",
+			},
+			password: "secret",
+		},
+		"error: both set": {
+			settings: map[string]string{
+				"mongo_password":      "secret",
+				"mongo_password_file": secret,
+			},
+			err: "both mongo_password and mongo_password_file are set",
+		},
+		"error: no file": {
+			settings: map[string]string{
+				"mongo_password_file": filepath.Join(dir, "missing"),
+			},
+			err: "failed to read mongo_password_file: open " +
+				filepath.Join(dir, "missing") + ": no such file or directory",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		c := viper.New()
+		for k, v := range tc.settings {
+			c.Set(k, v)
+		}
+
+		err := loadSecretFiles(c)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err)
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, tc.password, c.GetString(SettingDbPassword))
+		}
+	}
+}
@@ -14,7 +14,12 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/ant0ine/go-json-rest/rest"
 	"github.com/mendersoftware/go-lib-micro/config"
@@ -23,16 +28,21 @@ import (
 
 	api_http "github.com/mendersoftware/useradm/api/http"
 	"github.com/mendersoftware/useradm/authz"
-	"github.com/mendersoftware/useradm/client/tenant"
+	"github.com/mendersoftware/useradm/client/billing"
+	"github.com/mendersoftware/useradm/jobs"
 	"github.com/mendersoftware/useradm/jwt"
 	"github.com/mendersoftware/useradm/keys"
-	"github.com/mendersoftware/useradm/store/mongo"
+	"github.com/mendersoftware/useradm/mail"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/schema"
+	"github.com/mendersoftware/useradm/sms"
 	"github.com/mendersoftware/useradm/user"
 )
 
-func SetupAPI(stacktype string, authz authz.Authorizer, jwth jwt.Handler) (*rest.Api, error) {
+func SetupAPI(stacktype string, mwconfig MiddlewareConfig,
+	authz authz.Authorizer, jwth jwt.Handler) (*rest.Api, error) {
 	api := rest.NewApi()
-	if err := SetupMiddleware(api, stacktype, authz, jwth); err != nil {
+	if err := SetupMiddleware(api, stacktype, mwconfig, authz, jwth); err != nil {
 		return nil, errors.Wrap(err, "failed to setup middleware")
 	}
 
@@ -45,6 +55,26 @@ func SetupAPI(stacktype string, authz authz.Authorizer, jwth jwt.Handler) (*rest
 	return api, nil
 }
 
+// settings of the lifetimes of the issued tokens
+var tokenLifetimeSettings = []string{
+	SettingJWTExpirationTimeout,
+	SettingImpersonationExpirationTimeout,
+	SettingServiceAccountExpirationTimeout,
+	SettingTokenExchangeExpirationTimeout,
+}
+
+// maxTokenLifetime returns the longest lifetime of the issued tokens,
+// for which the replaced signing keys have to remain valid
+func maxTokenLifetime(c config.Reader) time.Duration {
+	lifetime := 0
+	for _, setting := range tokenLifetimeSettings {
+		if t := c.GetInt(setting); t > lifetime {
+			lifetime = t
+		}
+	}
+	return time.Duration(lifetime) * time.Second
+}
+
 func RunServer(c config.Reader) error {
 
 	l := log.New(log.Ctx{})
@@ -55,32 +85,185 @@ func RunServer(c config.Reader) error {
 	}
 
 	authz := &SimpleAuthz{}
-	jwth := jwt.NewJWTHandlerRS256(privKey)
+	leeway := c.GetInt(SettingJWTLeeway)
+	jwth := jwt.NewJWTHandlerRS256(privKey).
+		WithLeeway(time.Duration(leeway) * time.Second).
+		WithKeyRetention(maxTokenLifetime(c))
+
+	if err := checkTokenFormat(c); err != nil {
+		return err
+	}
+	if err := checkTokenLifetimes(c); err != nil {
+		return err
+	}
+	if err := checkCORS(c); err != nil {
+		return err
+	}
+	if err := checkMail(c); err != nil {
+		return err
+	}
 
-	db, err := mongo.GetDataStoreMongo(dataStoreMongoConfigFromAppConfig(c))
+	db, tenantKeeper, err := dataStoreFromAppConfig(c)
 	if err != nil {
 		return errors.Wrap(err, "database connection failed")
 	}
 
-	ua := useradm.NewUserAdm(jwth, db, mongo.NewTenantStoreMongo(db),
+	ua := useradm.NewUserAdm(jwth, db, tenantKeeper,
 		useradm.Config{
-			Issuer:         c.GetString(SettingJWTIssuer),
-			ExpirationTime: int64(c.GetInt(SettingJWTExpirationTimeout)),
+			Issuer:                c.GetString(SettingJWTIssuer),
+			ExpirationTime:        int64(c.GetInt(SettingJWTExpirationTimeout)),
+			Leeway:                int64(leeway),
+			DeletedUsersRetention: int64(c.GetInt(SettingDeletedUsersRetention)),
+			PendingUsersTimeout:   int64(c.GetInt(SettingPendingUsersTimeout)),
+			Features:              c.GetStringSlice(SettingFeatures),
+			ImpersonationExpirationTime: int64(
+				c.GetInt(SettingImpersonationExpirationTimeout)),
+			ServiceAccountExpirationTime: int64(
+				c.GetInt(SettingServiceAccountExpirationTimeout)),
+			TokenFormat: c.GetString(SettingTokenFormat),
+			RejectJWT:   c.GetBool(SettingTokenFormatRejectJWT),
+			TokenExchangeExpirationTime: int64(
+				c.GetInt(SettingTokenExchangeExpirationTimeout)),
+			OIDCURL: c.GetString(SettingOIDCURL),
+			AuthCodeExpirationTime: int64(
+				c.GetInt(SettingOIDCCodeExpirationTimeout)),
+			DeviceVerificationURL: c.GetString(SettingDeviceVerificationURL),
+			DeviceCodeExpirationTime: int64(
+				c.GetInt(SettingDeviceCodeExpirationTimeout)),
+			DeviceCodeInterval: c.GetInt(SettingDeviceCodeInterval),
+			MagicLinkURL:       c.GetString(SettingMagicLinkURL),
+			MagicLinkExpirationTime: int64(
+				c.GetInt(SettingMagicLinkExpirationTimeout)),
+			OTPExpirationTime: int64(c.GetInt(SettingOTPExpirationTimeout)),
+			OperatorTenant:    c.GetString(SettingOperatorTenant),
+			TenantGracePeriod: int64(c.GetInt(SettingTenantGracePeriod)),
+			AdditionalEmails:  c.GetBool(SettingAdditionalEmails),
 		})
 
-	if tadmAddr := c.GetString(SettingTenantAdmAddr); tadmAddr != "" {
+	verifier, err := tenantVerifierFromAppConfig(c)
+	if err != nil {
+		return errors.Wrap(err, "tenant verification setup failed")
+	}
+	if multitenant(c) {
 		l.Infof("settting up tenant verification")
+	}
+	ua = ua.WithTenantVerification(verifier)
 
-		tc := tenant.NewClient(tenant.Config{
-			TenantAdmAddr: tadmAddr,
-		})
+	if reportURL := c.GetString(SettingUsageReportURL); reportURL != "" {
+		l.Infof("setting up user count reports")
+
+		ua = ua.WithUsageReporter(billing.NewClient(billing.Config{
+			URL: reportURL,
+		}))
+	}
+
+	if smtpAddr := c.GetString(SettingSMTPAddress); smtpAddr != "" {
+		l.Infof("setting up email notifications")
+
+		ua = ua.WithMailer(mail.NewSMTPMailer(mail.SMTPConfig{
+			Address:  smtpAddr,
+			Username: c.GetString(SettingSMTPUsername),
+			Password: c.GetString(SettingSMTPPassword),
+			From:     c.GetString(SettingEmailSender),
+		}))
+	}
+
+	if sid := c.GetString(SettingTwilioAccountSID); sid != "" {
+		l.Infof("setting up SMS login codes")
+
+		ua = ua.WithSMSSender(sms.NewTwilioSender(sms.TwilioConfig{
+			AccountSID: sid,
+			AuthToken:  c.GetString(SettingTwilioAuthToken),
+			From:       c.GetString(SettingSMSSender),
+		}))
+	}
+
+	if schemaPath := c.GetString(SettingSettingsSchemaPath); schemaPath != "" {
+		l.Infof("setting up settings validation")
+
+		s, err := schema.Load(schemaPath)
+		if err != nil {
+			return errors.Wrap(err, "failed to load settings schema")
+		}
+		ua = ua.WithSettingsSchema(s)
+	}
+
+	if email := c.GetString(SettingBootstrapAdminEmail); email != "" {
+		if multitenant(c) {
+			l.Warnf("%s is ignored in multitenant setups", SettingBootstrapAdminEmail)
+		} else if err := ua.BootstrapAdmin(context.Background(), email); err != nil {
+			return errors.Wrap(err, "failed to create the administrator")
+		}
+	}
+
+	if c.GetBool(SettingDemo) {
+		l.Warnf("running in demo mode")
+
+		data, err := loadDemoData(c.GetString(SettingDemoDataPath))
+		if err != nil {
+			return err
+		}
+		if err := provisionDemoData(context.Background(), ua, data); err != nil {
+			return errors.Wrap(err, "failed to provision demo data")
+		}
+	}
+
+	// the configured mode enables the maintenance mode of all the
+	// instances, otherwise the stored one is followed
+	maintenance := api_http.NewMaintenance(db, c.GetInt(SettingMaintenanceRetryAfter))
+	if c.GetBool(SettingMaintenanceMode) {
+		err = maintenance.Set(context.Background(), model.MaintenanceState{Enabled: true})
+	} else {
+		err = maintenance.Load(context.Background())
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to set up maintenance mode")
+	}
+	if maintenance.Enabled() {
+		l.Warnf("starting in maintenance mode")
+	}
+	go runPeriodically(context.Background(), "refresh maintenance mode",
+		time.Duration(c.GetInt(SettingMaintenanceRefreshInterval))*time.Second,
+		maintenance.Load)
+
+	useradmapi := api_http.NewUserAdmApiHandlers(ua, db).WithMaintenance(maintenance)
+	if c.GetBool(SettingSwaggerUI) {
+		useradmapi = useradmapi.WithSwaggerUI()
+	}
+
+	proxies, err := api_http.ParseTrustedProxies(c.GetStringSlice(SettingTrustedProxies))
+	if err != nil {
+		return errors.Wrapf(err, "failed to parse %s", SettingTrustedProxies)
+	}
+	useradmapi = useradmapi.WithTrustedProxies(proxies)
 
-		ua = ua.WithTenantVerification(tc)
+	var httpMetrics *api_http.Metrics
+	if c.GetBool(SettingMetrics) {
+		httpMetrics = api_http.NewMetrics(c.GetInt(SettingMetricsMaxTenants))
+		useradmapi = useradmapi.WithMetrics(httpMetrics)
+		ua = ua.WithMetrics(httpMetrics.Registry())
 	}
 
-	useradmapi := api_http.NewUserAdmApiHandlers(ua, db)
+	mwconfig := MiddlewareConfig{
+		CORS: CORSConfig{
+			AllowedOrigins:   c.GetStringSlice(SettingCORSAllowedOrigins),
+			AllowedMethods:   c.GetStringSlice(SettingCORSAllowedMethods),
+			AllowedHeaders:   c.GetStringSlice(SettingCORSAllowedHeaders),
+			AllowCredentials: c.GetBool(SettingCORSAllowCredentials),
+			MaxAge:           c.GetInt(SettingCORSMaxAge),
+		},
+		MaxBodySize: int64(c.GetInt(SettingHTTPMaxBodySize)),
+		Gzip:        c.GetBool(SettingHTTPGzip),
+		RequestTimeout: time.Duration(c.GetInt(SettingHTTPRequestTimeout)) *
+			time.Second,
+		Maintenance: maintenance,
+		AccessLog:   accessLogConfigFromAppConfig(c),
+		Metrics:     httpMetrics,
+	}
 
-	api, err := SetupAPI(c.GetString(SettingMiddleware), authz, jwth)
+	// the middlewares resolve the opaque tokens along with the JWTs
+	api, err := SetupAPI(c.GetString(SettingMiddleware), mwconfig, authz,
+		ua.TokenHandler())
 	if err != nil {
 		return errors.Wrap(err, "API setup failed")
 	}
@@ -91,8 +274,215 @@ func RunServer(c config.Reader) error {
 	}
 	api.SetApp(apph)
 
+	runner := jobs.NewRunner(db)
+	runner.Add("purge deleted users",
+		time.Duration(c.GetInt(SettingDeletedUsersPurgeInterval))*time.Second,
+		unlessInMaintenance(maintenance, ua.PurgeDeletedUsers))
+	runner.Add("disable expired users",
+		time.Duration(c.GetInt(SettingExpiredUsersCheckInterval))*time.Second,
+		unlessInMaintenance(maintenance, ua.DisableExpiredUsers))
+	runner.Add("delete expired tokens",
+		time.Duration(c.GetInt(SettingExpiredTokensCleanupInterval))*time.Second,
+		unlessInMaintenance(maintenance, ua.DeleteExpiredTokens))
+	runner.Add("reconcile pending users",
+		time.Duration(c.GetInt(SettingPendingUsersReconcileInterval))*time.Second,
+		unlessInMaintenance(maintenance, ua.ReconcilePendingUsers))
+	runner.Add("remove revoked tokens",
+		time.Duration(c.GetInt(SettingTokenRevocationInterval))*time.Second,
+		unlessInMaintenance(maintenance, ua.ProcessTokenRevocations))
+	if c.GetString(SettingUsageReportURL) != "" {
+		// the lease of the runner keeps the replicas from reporting
+		// the counts more than once per interval
+		runner.Add("report user counts",
+			time.Duration(c.GetInt(SettingUsageReportInterval))*time.Second,
+			unlessInMaintenance(maintenance, ua.ReportUserCounts))
+	}
+	runner.Start(context.Background())
+
+	tlsConfig, certLoader, err := tlsConfigFromAppConfig(c)
+	if err != nil {
+		return errors.Wrap(err, "TLS setup failed")
+	}
+
+	go reloadOnSignal(func() error {
+		return reloadConfig(c, jwth, certLoader)
+	})
+
+	if certLoader != nil {
+		if interval := c.GetInt(SettingTLSCertReloadInterval); interval > 0 {
+			go runPeriodically(context.Background(), "reload TLS certificate",
+				time.Duration(interval)*time.Second,
+				certLoader.Reload)
+		}
+	}
+
+	handler := api.MakeHandler()
+
 	addr := c.GetString(SettingListen)
-	l.Printf("listening on %s", addr)
 
-	return http.ListenAndServe(addr, api.MakeHandler())
+	internalAddr := c.GetString(SettingListenInternal)
+	if internalAddr == "" {
+		if c.GetString(SettingInternalTLSClientCAPath) != "" {
+			return errors.Errorf("%s requires %s to be set",
+				SettingInternalTLSClientCAPath, SettingListenInternal)
+		}
+		if c.GetBool(SettingDebugEndpoints) {
+			return errors.Errorf("%s requires %s to be set",
+				SettingDebugEndpoints, SettingListenInternal)
+		}
+		return serve(httpServerFromAppConfig(c, addr, handler, tlsConfig))
+	}
+
+	internalTLSConfig, err := internalTLSConfigFromAppConfig(c, tlsConfig)
+	if err != nil {
+		return errors.Wrap(err, "internal API TLS setup failed")
+	}
+
+	// the internal API is served on its own listener only,
+	// so it can be firewalled off
+	internalHandler := apiFilter(handler, true)
+	if c.GetBool(SettingDebugEndpoints) {
+		l.Warnf("serving the pprof profiles and runtime stats on %s", internalAddr)
+		internalHandler = withDiagnostics(internalHandler)
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		errs <- serve(httpServerFromAppConfig(c, internalAddr,
+			internalHandler, internalTLSConfig))
+	}()
+	go func() {
+		errs <- serve(httpServerFromAppConfig(c, addr,
+			apiFilter(handler, false), tlsConfig))
+	}()
+
+	return <-errs
+}
+
+// Helper for mapping application configuration to the access log setup
+func accessLogConfigFromAppConfig(c config.Reader) AccessLogConfig {
+	return AccessLogConfig{
+		Format:           c.GetString(SettingAccessLogFormat),
+		Fields:           c.GetStringSlice(SettingAccessLogFields),
+		VerifySampleRate: c.GetFloat64(SettingAccessLogVerifySampleRate),
+	}
+}
+
+// Helper for mapping application configuration to the HTTP server
+// serving the handler on addr, over HTTPS if tlsConfig is set
+func httpServerFromAppConfig(c config.Reader, addr string, handler http.Handler,
+	tlsConfig *tls.Config) *http.Server {
+	seconds := func(key string) time.Duration {
+		return time.Duration(c.GetInt(key)) * time.Second
+	}
+
+	conns := &serverConns{conns: map[string]net.Conn{}}
+
+	return &http.Server{
+		Addr:      addr,
+		Handler:   conns.exportsWithoutWriteTimeout(handler),
+		TLSConfig: tlsConfig,
+		ConnState: conns.track,
+
+		ReadHeaderTimeout: seconds(SettingHTTPReadHeaderTimeout),
+		ReadTimeout:       seconds(SettingHTTPReadTimeout),
+		WriteTimeout:      seconds(SettingHTTPWriteTimeout),
+		IdleTimeout:       seconds(SettingHTTPIdleTimeout),
+		MaxHeaderBytes:    c.GetInt(SettingHTTPMaxHeaderBytes),
+	}
+}
+
+// serverConns keeps the open connections of a server by the remote
+// address, for setting the deadlines of the requests they carry
+type serverConns struct {
+	sync.Mutex
+	conns map[string]net.Conn
+}
+
+func (s *serverConns) track(c net.Conn, state http.ConnState) {
+	s.Lock()
+	defer s.Unlock()
+
+	switch state {
+	case http.StateNew:
+		s.conns[c.RemoteAddr().String()] = c
+	case http.StateHijacked, http.StateClosed:
+		delete(s.conns, c.RemoteAddr().String())
+	}
+}
+
+// exportsWithoutWriteTimeout lifts the server's write timeout, set
+// when the request is read, from the users exports, which stream
+// responses that take as long as the users are many
+func (s *serverConns) exportsWithoutWriteTimeout(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if api_http.IsExportPath(r.URL.Path) {
+			s.Lock()
+			c, ok := s.conns[r.RemoteAddr]
+			s.Unlock()
+			if ok {
+				c.SetWriteDeadline(time.Time{})
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func serve(server *http.Server) error {
+	l := log.New(log.Ctx{})
+
+	if server.TLSConfig == nil {
+		l.Printf("listening on %s", server.Addr)
+
+		return server.ListenAndServe()
+	}
+
+	l.Printf("listening on %s (HTTPS)", server.Addr)
+
+	return server.ListenAndServeTLS("", "")
+}
+
+// apiFilter passes on the requests to the internal API only, or to the
+// other APIs only, responding with 404 to the rest
+func apiFilter(handler http.Handler, internal bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if api_http.IsInternalPath(r.URL.Path) != internal {
+			http.NotFound(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// unlessInMaintenance wraps the periodic job, so it's skipped
+// while in maintenance mode
+func unlessInMaintenance(m *api_http.Maintenance,
+	job func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if m.Enabled() {
+			return jobs.ErrSkipped
+		}
+		return job(ctx)
+	}
+}
+
+// runPeriodically runs a maintenance job every interval until ctx is done
+func runPeriodically(ctx context.Context, name string, interval time.Duration,
+	job func(ctx context.Context) error) {
+	l := log.FromContext(ctx)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(ctx); err != nil {
+			l.Errorf("failed to %s: %v", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
 }
@@ -14,18 +14,96 @@
 package main
 
 import (
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
 func TestSetupApi(t *testing.T) {
 	// expecting an error
-	api, err := SetupAPI("foo", nil, nil)
+	api, err := SetupAPI("foo", MiddlewareConfig{}, nil, nil)
 	assert.Nil(t, api)
 	assert.Error(t, err)
 
-	api, err = SetupAPI(EnvDev, nil, nil)
+	api, err = SetupAPI(EnvDev, MiddlewareConfig{}, nil, nil)
 	assert.NotNil(t, api)
 	assert.Nil(t, err)
 }
+
+func TestAPIFilter(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	var tdata = []struct {
+		internal bool
+		path     string
+		status   int
+	}{
+		{true, "/api/internal/v1/useradm/auth/verify", http.StatusNoContent},
+		{true, "/api/management/v1/useradm/users", http.StatusNotFound},
+		{false, "/api/internal/v1/useradm/auth/verify", http.StatusNotFound},
+		{false, "/api/management/v1/useradm/users", http.StatusNoContent},
+	}
+
+	for _, td := range tdata {
+		rec := httptest.NewRecorder()
+		apiFilter(ok, td.internal).ServeHTTP(rec,
+			httptest.NewRequest(http.MethodGet, td.path, nil))
+		assert.Equal(t, td.status, rec.Code, td.path)
+	}
+}
+
+// deadlineConn records the write deadline set on the connection
+type deadlineConn struct {
+	net.Conn
+	writeDeadline *time.Time
+}
+
+func (c *deadlineConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1234}
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline = &t
+	return nil
+}
+
+func TestExportsWithoutWriteTimeout(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	var tdata = []struct {
+		path    string
+		state   http.ConnState
+		cleared bool
+	}{
+		{"/api/management/v1/useradm/users/export", http.StateNew, true},
+		{"/api/management/v1/useradm/users/export", http.StateClosed, false},
+		{"/api/management/v1/useradm/users", http.StateNew, false},
+	}
+
+	for _, td := range tdata {
+		conns := &serverConns{conns: map[string]net.Conn{}}
+		c := &deadlineConn{}
+		conns.track(c, http.StateNew)
+		conns.track(c, td.state)
+
+		rec := httptest.NewRecorder()
+		conns.exportsWithoutWriteTimeout(ok).ServeHTTP(rec,
+			httptest.NewRequest(http.MethodGet, td.path, nil))
+		assert.Equal(t, http.StatusNoContent, rec.Code, td.path)
+		if td.cleared {
+			if assert.NotNil(t, c.writeDeadline, td.path) {
+				assert.True(t, c.writeDeadline.IsZero(), td.path)
+			}
+		} else {
+			assert.Nil(t, c.writeDeadline, td.path)
+		}
+	}
+}
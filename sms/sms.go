@@ -0,0 +1,31 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package sms
+
+import (
+	"context"
+)
+
+// Message is a text message to a phone number
+type Message struct {
+	// phone number in E.164 format, e.g. +4712345678
+	To   string
+	Body string
+}
+
+// Sender delivers text messages through an SMS gateway
+type Sender interface {
+	// Send hands the message over to the gateway
+	Send(ctx context.Context, msg Message) error
+}
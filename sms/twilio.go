@@ -0,0 +1,112 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package sms
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/apiclient"
+	"github.com/pkg/errors"
+)
+
+const (
+	TwilioDefaultURL = "https://api.twilio.com"
+
+	twilioMessagesURI = "/2010-04-01/Accounts/%s/Messages.json"
+
+	// default request timeout, 10s
+	defaultReqTimeout = time.Duration(10) * time.Second
+)
+
+// UnexpectedStatusError is returned when Twilio responds with
+// a status other than 2xx
+type UnexpectedStatusError struct {
+	Status int
+}
+
+func (e *UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("POST message request failed with unexpected status %v",
+		e.Status)
+}
+
+type TwilioConfig struct {
+	// Twilio API address, TwilioDefaultURL if empty
+	URL string
+
+	// credentials of the Twilio account
+	AccountSID string
+	AuthToken  string
+
+	// sender phone number, or messaging service SID
+	From string
+
+	// request timeout
+	Timeout time.Duration
+}
+
+// TwilioSender delivers messages through the Twilio API
+type TwilioSender struct {
+	conf       TwilioConfig
+	httpClient apiclient.HttpRunner
+}
+
+func NewTwilioSender(conf TwilioConfig) *TwilioSender {
+	if conf.URL == "" {
+		conf.URL = TwilioDefaultURL
+	}
+	if conf.Timeout == 0 {
+		conf.Timeout = defaultReqTimeout
+	}
+
+	return &TwilioSender{
+		conf:       conf,
+		httpClient: &apiclient.HttpApi{},
+	}
+}
+
+func (s *TwilioSender) Send(ctx context.Context, msg Message) error {
+	form := url.Values{
+		"To":   {msg.To},
+		"From": {s.conf.From},
+		"Body": {msg.Body},
+	}
+
+	req, err := http.NewRequest(http.MethodPost,
+		strings.TrimRight(s.conf.URL, "/")+fmt.Sprintf(twilioMessagesURI, s.conf.AccountSID),
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request for POST message")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(s.conf.AccountSID, s.conf.AuthToken)
+
+	ctx, cancel := context.WithTimeout(ctx, s.conf.Timeout)
+	defer cancel()
+
+	rsp, err := s.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "POST message request failed")
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		return &UnexpectedStatusError{Status: rsp.StatusCode}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTwilioSenderSend(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		status int
+		err    error
+	}{
+		"ok": {
+			status: http.StatusCreated,
+		},
+		"error: invalid number": {
+			status: http.StatusBadRequest,
+			err:    errors.New("POST message request failed with unexpected status 400"),
+		},
+		"error: unauthorized": {
+			status: http.StatusUnauthorized,
+			err:    errors.New("POST message request failed with unexpected status 401"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("name %v", name), func(t *testing.T) {
+			t.Parallel()
+
+			s := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					assert.Equal(t, http.MethodPost, r.Method)
+					assert.Equal(t, "/2010-04-01/Accounts/AC123/Messages.json", r.URL.Path)
+
+					user, pass, ok := r.BasicAuth()
+					assert.True(t, ok)
+					assert.Equal(t, "AC123", user)
+					assert.Equal(t, "secret", pass)
+
+					assert.NoError(t, r.ParseForm())
+					assert.Equal(t, "+4712345678", r.PostForm.Get("To"))
+					assert.Equal(t, "+4787654321", r.PostForm.Get("From"))
+					assert.Equal(t, "hello", r.PostForm.Get("Body"))
+					w.WriteHeader(tc.status)
+				}))
+			defer s.Close()
+
+			sender := NewTwilioSender(TwilioConfig{
+				URL:        s.URL,
+				AccountSID: "AC123",
+				AuthToken:  "secret",
+				From:       "+4787654321",
+			})
+
+			err := sender.Send(context.Background(), Message{
+				To:   "+4712345678",
+				Body: "hello",
+			})
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
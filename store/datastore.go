@@ -17,6 +17,7 @@ package store
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/mendersoftware/useradm/jwt"
 	"github.com/mendersoftware/useradm/model"
@@ -29,29 +30,353 @@ var (
 	ErrTokenNotFound = errors.New("token not found")
 	// duplicated email address
 	ErrDuplicateEmail = errors.New("user with a given email already exists")
+	// no such additional email address of the user
+	ErrUserEmailNotFound = errors.New("user email address not found")
+	// duplicated username
+	ErrDuplicateUsername = errors.New("user with a given username already exists")
+	// group not found
+	ErrGroupNotFound = errors.New("group not found")
+	// duplicated group name
+	ErrDuplicateGroupName = errors.New("group with a given name already exists")
+	// user modified since it was read
+	ErrETagMismatch = errors.New("user has been modified, ETag does not match")
+	// idempotency key already used
+	ErrDuplicateIdempotencyKey = errors.New("idempotency key already exists")
+	// the tenant has as many users as allowed
+	ErrUserLimitReached = errors.New("the limit of users has been reached")
+	// settings modified since they were read
+	ErrSettingsETagMismatch = errors.New("settings have been modified, ETag does not match")
+	// no such key in the settings
+	ErrSettingNotFound = errors.New("setting not found")
+	// no such version in the settings history
+	ErrSettingsVersionNotFound = errors.New("settings version not found")
+	// no such OAuth client of the tenant
+	ErrOAuthClientNotFound = errors.New("client not found")
+	// no such service account
+	ErrServiceAccountNotFound = errors.New("service account not found")
+	// duplicated service account name
+	ErrDuplicateServiceAccountName = errors.New("service account with a given name already exists")
+	// device login not found, or not pending anymore
+	ErrDeviceAuthorizationNotFound = errors.New("device authorization not found")
+	// user code of a device login already taken
+	ErrDuplicateUserCode = errors.New("user code already exists")
+	// one-time login code not found, or used already
+	ErrLoginOTPNotFound = errors.New("login code not found")
 )
 
 type DataStore interface {
 	// CreateUser persists the user
+	// returns ErrUserLimitReached if the tenant would have more users
+	// than its model.LimitMaxUsers allows
 	CreateUser(ctx context.Context, u *model.User) error
 	// Update user information - password or/and email address
 	UpdateUser(ctx context.Context, id string, u *model.UserUpdate) error
-	//GetUserByEmail returns nil,nil if not found
+	// GetUserByEmail finds the user by the primary or any of the
+	// additional email addresses, returns nil,nil if not found
 	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	// GetUserByUsername returns nil,nil if not found
+	GetUserByUsername(ctx context.Context, username string) (*model.User, error)
 	GetUserById(ctx context.Context, id string) (*model.User, error)
-	GetUsers(ctx context.Context) ([]model.User, error)
-	DeleteUser(ctx context.Context, id string) error
+	GetUsers(ctx context.Context, fltr model.UserFilter) ([]model.User, error)
+	// CountUsers returns the number of users matching the filter
+	CountUsers(ctx context.Context, fltr model.UserFilter) (int, error)
+	// GetUsersVersion returns the version of the users matching the filter
+	GetUsersVersion(ctx context.Context, fltr model.UserFilter) (*model.UsersVersion, error)
+	// ForEachUser calls fn for every user matching the filter, ordered
+	// by email, without loading all of them at once; stops on the first
+	// error returned by fn
+	ForEachUser(ctx context.Context, fltr model.UserFilter, fn func(u *model.User) error) error
+	// DeleteUser marks the user as deleted, the user is no longer
+	// returned by other calls but can be restored until purged;
+	// if ifMatch is not empty and contains none of the user's ETags
+	// ErrETagMismatch is returned, ErrUserNotFound if there's no user
+	DeleteUser(ctx context.Context, id string, ifMatch []string) error
+	// RestoreUser brings back a deleted user
+	// returns ErrUserNotFound if there's no deleted user with given id,
+	// ErrUserLimitReached like CreateUser
+	RestoreUser(ctx context.Context, id string) error
+	// EraseUser permanently removes the user, whether deleted or not,
+	// together with its tokens, sessions, login history, login codes,
+	// login links, device logins and idempotency keys
+	// returns ErrUserNotFound if there's no such user
+	EraseUser(ctx context.Context, id string) error
+	// PurgeDeletedUsers permanently removes users deleted before the
+	// given time, in all tenants
+	PurgeDeletedUsers(ctx context.Context, before time.Time) error
+
+	// AddUserEmail adds an additional email address to the user
+	// returns ErrDuplicateEmail if any user has the address already,
+	// as the primary or an additional one
+	AddUserEmail(ctx context.Context, id string, e *model.UserEmail) error
+	// VerifyUserEmail marks the additional email address of the user
+	// as verified
+	// returns ErrUserEmailNotFound if the user has no such address
+	VerifyUserEmail(ctx context.Context, id, email string) error
+	// DeleteUserEmail removes the additional email address of the user
+	// returns ErrUserEmailNotFound if the user has no such address
+	DeleteUserEmail(ctx context.Context, id, email string) error
+	// SetPrimaryEmail makes the additional email address the primary one
+	// of the user, the former primary address becomes a verified
+	// additional one
+	// returns ErrUserEmailNotFound if the user has no such address
+	SetPrimaryEmail(ctx context.Context, id, email string) error
+
+	// SetLastLogin records a successful login of the user and resets
+	// the failed login counter
+	SetLastLogin(ctx context.Context, id string, ts time.Time, ip string) error
+
+	// IncFailedLogins increments the failed login counter of the user
+	IncFailedLogins(ctx context.Context, id string) error
+
+	// SaveLoginEvent appends an entry to the user's login history
+	SaveLoginEvent(ctx context.Context, event *model.LoginEvent) error
+
+	// GetLoginEvents returns the user's login history, most recent first
+	GetLoginEvents(ctx context.Context, userID string) ([]model.LoginEvent, error)
+
+	// CreateGroup persists the group
+	CreateGroup(ctx context.Context, g *model.Group) error
+
+	// GetGroups returns all groups
+	GetGroups(ctx context.Context) ([]model.Group, error)
+
+	// GetGroupById returns nil,nil if not found
+	GetGroupById(ctx context.Context, id string) (*model.Group, error)
+
+	// GetGroupsByIds returns the existing groups out of the given ones
+	GetGroupsByIds(ctx context.Context, ids []string) ([]model.Group, error)
+
+	// DeleteGroup removes the group and all memberships in it
+	DeleteGroup(ctx context.Context, id string) error
+
+	// AddUserToGroup makes the user a member of the group
+	AddUserToGroup(ctx context.Context, userID, groupID string) error
+
+	// RemoveUserFromGroup removes the user from the group
+	RemoveUserFromGroup(ctx context.Context, userID, groupID string) error
+
+	// DisableExpiredUsers sets the inactive status on users of all tenants
+	// that expired before the given time
+	DisableExpiredUsers(ctx context.Context, now time.Time) error
+
+	// CountUsersByTenant returns the number of users of every tenant,
+	// counting as active the ones who logged in after activeSince
+	CountUsersByTenant(ctx context.Context,
+		activeSince time.Time) ([]model.UserCount, error)
 	SaveToken(ctx context.Context, token *jwt.Token) error
 	GetTokenById(ctx context.Context, id string) (*jwt.Token, error)
 
 	// deletes all tenant's tokens (identity in context)
 	DeleteTokens(ctx context.Context) error
 
+	// GetTokensByUserId returns the tokens issued to the user
+	GetTokensByUserId(ctx context.Context, userId string) ([]jwt.Token, error)
+
 	// deletes user tokens
 	DeleteTokensByUserId(ctx context.Context, userId string) error
 
-	SaveSettings(ctx context.Context, s map[string]interface{}) error
+	// DeleteExpiredTokens removes the tokens of all tenants that expired
+	// before the given time, returns the number of tokens removed
+	DeleteExpiredTokens(ctx context.Context, now time.Time) (int, error)
+
+	// CreateIdempotencyKey persists the key, returns
+	// ErrDuplicateIdempotencyKey if it's already there
+	CreateIdempotencyKey(ctx context.Context, k *model.IdempotencyKey) error
+
+	// GetIdempotencyKey returns nil,nil if not found
+	GetIdempotencyKey(ctx context.Context, key string) (*model.IdempotencyKey, error)
+
+	// SetIdempotencyKeyUser records the ID of the user created
+	// by the request with given key
+	SetIdempotencyKeyUser(ctx context.Context, key, userID string) error
+
+	// DeleteIdempotencyKey removes the key, allowing it to be reused
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+
+	// CreatePendingUser records the start of a user creation
+	CreatePendingUser(ctx context.Context, p *model.PendingUser) error
+
+	// DeletePendingUser removes the record of a user creation,
+	// once it's complete or rolled back
+	DeletePendingUser(ctx context.Context, userID string) error
+
+	// GetPendingUsers returns the user creations of all tenants
+	// started before the given time and not yet complete
+	GetPendingUsers(ctx context.Context, before time.Time) ([]model.PendingUser, error)
+
+	// SetLimit creates or updates the tenant's limit
+	SetLimit(ctx context.Context, l *model.Limit) error
+
+	// GetLimit returns nil,nil if the limit wasn't set
+	GetLimit(ctx context.Context, name string) (*model.Limit, error)
+
+	// SetPlan sets the tenant's subscription plan
+	SetPlan(ctx context.Context, p *model.Plan) error
+
+	// GetPlan returns nil,nil if the tenant has no plan
+	GetPlan(ctx context.Context) (*model.Plan, error)
+
+	// SetTenantStatus records the status of the tenant's account
+	SetTenantStatus(ctx context.Context, st *model.TenantStatus) error
+	// GetTenantStatus returns nil,nil if no status was recorded
+	GetTenantStatus(ctx context.Context) (*model.TenantStatus, error)
+
+	// SetFeature creates or updates the tenant's feature flag override
+	SetFeature(ctx context.Context, f *model.Feature) error
+
+	// DeleteFeature removes the tenant's feature flag override,
+	// if there is one
+	DeleteFeature(ctx context.Context, name string) error
+
+	// GetFeatures returns the tenant's feature flag overrides
+	GetFeatures(ctx context.Context) ([]model.Feature, error)
+
+	// SaveSettings replaces the settings, keeping the replaced version
+	// in the history, and returns the new ETag; if ifMatch is not empty
+	// and contains none of the current ETags ErrSettingsETagMismatch
+	// is returned
+	SaveSettings(ctx context.Context, s map[string]interface{}, ifMatch []string) (string, error)
 	GetSettings(ctx context.Context) (map[string]interface{}, error)
+	// SaveSetting sets a single key of the settings, see SaveSettings
+	SaveSetting(ctx context.Context, key string, value interface{}, ifMatch []string) (string, error)
+	// DeleteSetting removes a single key of the settings, see SaveSettings;
+	// returns ErrSettingNotFound if there's no such key
+	DeleteSetting(ctx context.Context, key string, ifMatch []string) (string, error)
+	// GetSettingsHistory returns the replaced settings versions,
+	// most recent first
+	GetSettingsHistory(ctx context.Context) ([]model.SettingsVersion, error)
+	// RollbackSettings replaces the settings with the version having the
+	// given ETag, returns ErrSettingsVersionNotFound if there's none
+	RollbackSettings(ctx context.Context, etag string, ifMatch []string) (string, error)
+	// SaveSettingsSchema sets the JSON Schema the tenant's settings are
+	// validated against
+	SaveSettingsSchema(ctx context.Context, schema string) error
+	// GetSettingsSchema returns an empty string if the schema wasn't set
+	GetSettingsSchema(ctx context.Context) (string, error)
+	DeleteSettingsSchema(ctx context.Context) error
+
+	// SaveUserSettings replaces the settings of the given user
+	SaveUserSettings(ctx context.Context, userID string, s map[string]interface{}) error
+	// GetUserSettings returns an empty map if the user has no settings
+	GetUserSettings(ctx context.Context, userID string) (map[string]interface{}, error)
+
+	// SaveJobRun records the run of the background job in its status
+	SaveJobRun(ctx context.Context, run *model.JobRun) error
+	// AcquireJobLease makes holder the holder of the job's lease until
+	// the given time, unless another holder's lease hasn't expired;
+	// returns false in that case
+	AcquireJobLease(ctx context.Context, name, holder string, until time.Time) (bool, error)
+	// GetJobStatuses returns the status of the background jobs which
+	// have run, by name
+	GetJobStatuses(ctx context.Context) ([]model.JobStatus, error)
+
+	// SaveMaintenance stores the maintenance mode of the service
+	SaveMaintenance(ctx context.Context, s *model.MaintenanceState) error
+	// GetMaintenance returns nil,nil if the maintenance mode was never set
+	GetMaintenance(ctx context.Context) (*model.MaintenanceState, error)
+
+	// RevokeTokens makes the tokens of the user, or of all the users if
+	// userId is empty, issued up to the given time invalid
+	RevokeTokens(ctx context.Context, userId string, ts time.Time) error
+	// GetTokensRevokedTs returns the time up to which the tokens of the
+	// user are revoked, the zero time if they never were
+	GetTokensRevokedTs(ctx context.Context, userId string) (time.Time, error)
+	// SaveTokenRevocation inserts or replaces the revocation job; the
+	// jobs of all the tenants are kept together
+	SaveTokenRevocation(ctx context.Context, r *model.TokenRevocation) error
+	// GetTokenRevocation returns nil,nil if not found
+	GetTokenRevocation(ctx context.Context, id string) (*model.TokenRevocation, error)
+	// ClaimTokenRevocation marks the oldest pending revocation, or one
+	// running since before staleBefore, as running and returns it;
+	// nil,nil if there's none
+	ClaimTokenRevocation(ctx context.Context, now, staleBefore time.Time) (*model.TokenRevocation, error)
+
+	// CreateOAuthClient persists the client; the clients of all the
+	// tenants are kept together, so they can be found by ID alone
+	CreateOAuthClient(ctx context.Context, c *model.OAuthClient) error
+	// GetOAuthClientById returns the client of any tenant,
+	// nil,nil if not found
+	GetOAuthClientById(ctx context.Context, id string) (*model.OAuthClient, error)
+	// GetOAuthClients returns the clients of the tenant
+	GetOAuthClients(ctx context.Context) ([]model.OAuthClient, error)
+	// DeleteOAuthClient removes the tenant's client,
+	// returns ErrOAuthClientNotFound if there's no such client
+	DeleteOAuthClient(ctx context.Context, id string) error
+
+	// SaveOAuthCode persists the authorization code; the codes of all the
+	// tenants are kept together, as the clients are
+	SaveOAuthCode(ctx context.Context, c *model.OAuthCode) error
+	// TakeOAuthCode removes the code and returns it, so that it can be
+	// used only once; nil,nil if not found
+	TakeOAuthCode(ctx context.Context, id string) (*model.OAuthCode, error)
+
+	// SaveLoginLink persists the login link; the links of all the tenants
+	// are kept together, as the tenant isn't known when the link is used
+	SaveLoginLink(ctx context.Context, l *model.LoginLink) error
+	// TakeLoginLink removes the link and returns it, so that it can be
+	// used only once; nil,nil if not found
+	TakeLoginLink(ctx context.Context, id string) (*model.LoginLink, error)
+	// GetLatestLoginLink returns the link created last for the user of
+	// the tenant, still unused; nil,nil if there's none
+	GetLatestLoginLink(ctx context.Context, tenantID, userID string) (*model.LoginLink, error)
+
+	// CreateDeviceAuthorization persists the pending device login, kept
+	// in the default database until the user's tenant is known; returns
+	// ErrDuplicateUserCode if the user code is taken
+	CreateDeviceAuthorization(ctx context.Context, a *model.DeviceAuthorization) error
+	// GetDeviceAuthorization returns nil,nil if not found
+	GetDeviceAuthorization(ctx context.Context, id string) (*model.DeviceAuthorization, error)
+	// GetDeviceAuthorizationByUserCode returns nil,nil if not found
+	GetDeviceAuthorizationByUserCode(ctx context.Context,
+		userCode string) (*model.DeviceAuthorization, error)
+	// ResolveDeviceAuthorization records the user's decision, returns
+	// ErrDeviceAuthorizationNotFound unless the login is pending
+	ResolveDeviceAuthorization(ctx context.Context, id string,
+		r model.DeviceAuthorizationResolution) error
+	// SetDeviceAuthorizationPolled records the time of the device's poll
+	// and the interval it must keep from now on
+	SetDeviceAuthorizationPolled(ctx context.Context, id string,
+		ts time.Time, interval int) error
+	// DeleteDeviceAuthorization returns ErrDeviceAuthorizationNotFound
+	// if there's no such login
+	DeleteDeviceAuthorization(ctx context.Context, id string) error
+
+	// SaveSession persists the session of an opaque token; the sessions
+	// of all the tenants are kept together, as the tenant isn't known when
+	// the token is used
+	SaveSession(ctx context.Context, s *model.Session) error
+	// GetSession returns nil,nil if not found
+	GetSession(ctx context.Context, id string) (*model.Session, error)
+
+	// SaveLoginOTP persists the user's one-time login code, replacing
+	// the previous one
+	SaveLoginOTP(ctx context.Context, otp *model.LoginOTP) error
+	// GetLoginOTP returns nil,nil if not found
+	GetLoginOTP(ctx context.Context, userID string) (*model.LoginOTP, error)
+	// TakeLoginOTPAttempt counts an attempt at the user's code, as one
+	// operation with checking that the code is valid at now and has
+	// attempts left, and returns the code as it was before;
+	// nil,nil if there's no such code
+	TakeLoginOTPAttempt(ctx context.Context, userID string,
+		now time.Time) (*model.LoginOTP, error)
+	// DeleteLoginOTP returns ErrLoginOTPNotFound if there's no code,
+	// e.g. when it was used concurrently
+	DeleteLoginOTP(ctx context.Context, userID string) error
+
+	// CreateServiceAccount persists the service account,
+	// returns ErrDuplicateServiceAccountName if the name is taken
+	CreateServiceAccount(ctx context.Context, a *model.ServiceAccount) error
+	// GetServiceAccounts returns all service accounts, by name
+	GetServiceAccounts(ctx context.Context) ([]model.ServiceAccount, error)
+	// GetServiceAccountById returns nil,nil if not found
+	GetServiceAccountById(ctx context.Context, id string) (*model.ServiceAccount, error)
+	// UpdateServiceAccount applies the update and returns the account,
+	// ErrServiceAccountNotFound if there's no such account
+	UpdateServiceAccount(ctx context.Context, id string,
+		u *model.ServiceAccountUpdate) (*model.ServiceAccount, error)
+	// DeleteServiceAccount removes the service account,
+	// returns ErrServiceAccountNotFound if there's no such account
+	DeleteServiceAccount(ctx context.Context, id string) error
 }
 
 // TenantDataKeeper is an interface for executing administrative opeartions on
@@ -59,4 +384,14 @@ type DataStore interface {
 type TenantDataKeeper interface {
 	// MigrateTenant migrates given tenant to the latest DB version
 	MigrateTenant(ctx context.Context, id string) error
+	// DeleteTenant removes all data of given tenant
+	DeleteTenant(ctx context.Context, id string) error
+	// TenantExists tells whether there is any data of given tenant
+	TenantExists(ctx context.Context, id string) (bool, error)
+	// GetMigrationStatus returns the DB version of given tenant and
+	// the migrations applied and pending
+	GetMigrationStatus(ctx context.Context, id string) (*model.MigrationStatus, error)
+	// GetMigrationProgress returns the progress of the latest migration
+	// of all the tenants, nil if there was none
+	GetMigrationProgress(ctx context.Context) (*model.MigrationProgress, error)
 }
@@ -0,0 +1,78 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package store
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]Driver{}
+)
+
+// Driver opens the datastore of a backend
+type Driver interface {
+	// Open connects to the datastore described by the data source name,
+	// whose format depends on the backend
+	Open(dsn string) (DataStore, TenantDataKeeper, error)
+}
+
+// Register makes the driver available under the given name, once;
+// backends register from their init functions
+func Register(name string, driver Driver) error {
+	if driver == nil {
+		panic("store: Register driver is nil")
+	}
+
+	driversMu.Lock()
+	defer driversMu.Unlock()
+
+	if _, ok := drivers[name]; ok {
+		return fmt.Errorf("datastore driver %q already registered", name)
+	}
+	drivers[name] = driver
+
+	return nil
+}
+
+// Drivers returns the names of the registered drivers, sorted
+func Drivers() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+
+	names := make([]string, 0, len(drivers))
+	for name := range drivers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Open opens the datastore with the driver registered under the given name
+func Open(driver, dsn string) (DataStore, TenantDataKeeper, error) {
+	driversMu.RLock()
+	d, ok := drivers[driver]
+	driversMu.RUnlock()
+
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown datastore driver %q (registered: %v)",
+			driver, Drivers())
+	}
+
+	return d.Open(dsn)
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDriver struct {
+	dsn string
+}
+
+func (d *testDriver) Open(dsn string) (DataStore, TenantDataKeeper, error) {
+	if dsn == "" {
+		return nil, nil, errors.New("dsn required")
+	}
+	d.dsn = dsn
+	return nil, nil, nil
+}
+
+func TestOpen(t *testing.T) {
+	d := &testDriver{}
+	assert.NoError(t, Register("test", d))
+	assert.Contains(t, Drivers(), "test")
+
+	err := Register("test", &testDriver{})
+	assert.EqualError(t, err, `datastore driver "test" already registered`)
+
+	testCases := map[string]struct {
+		driver string
+		dsn    string
+
+		err string
+	}{
+		"ok": {
+			driver: "test",
+			dsn:    "test://foo",
+		},
+		"error, driver": {
+			driver: "test",
+			err:    "dsn required",
+		},
+		"error, unknown driver": {
+			driver: "nope",
+			dsn:    "test://foo",
+			err:    `unknown datastore driver "nope"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			_, _, err := Open(tc.driver, tc.dsn)
+			if tc.err != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.dsn, d.dsn)
+			}
+		})
+	}
+
+	assert.Panics(t, func() {
+		Register("test", nil)
+	})
+}
@@ -0,0 +1,2057 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+)
+
+const (
+	// login history entries older than this are dropped
+	LoginEventsTTL = 90 * 24 * time.Hour
+
+	// idempotency keys older than this are dropped,
+	// retries coming later are executed again
+	IdempotencyTTL = 24 * time.Hour
+
+	// number of replaced settings versions kept in the history
+	SettingsHistoryLength = 10
+
+	settingsCreatedTs = "created_ts"
+	settingsUpdatedTs = "updated_ts"
+	settingsETag      = "etag"
+)
+
+// DataStoreMemory keeps all the data in the memory of the process,
+// for development, demos and integration tests of other services;
+// it behaves like the mongo datastore, but nothing outlives the process
+type DataStoreMemory struct {
+	mu          sync.Mutex
+	tenants     map[string]*tenantData
+	jobs        map[string]*model.JobStatus
+	jobLeases   map[string]jobLease
+	maintenance *model.MaintenanceState
+	revocations map[string]*model.TokenRevocation
+	clients     map[string]*model.OAuthClient
+	codes       map[string]*model.OAuthCode
+	devices     map[string]*model.DeviceAuthorization
+	loginLinks  map[string]*model.LoginLink
+	sessions    map[string]*model.Session
+}
+
+// tenantData holds what the mongo datastore keeps in a tenant's database
+type tenantData struct {
+	users           map[string]*model.User
+	deletedUsers    map[string]*model.User
+	tokens          map[string]*jwt.Token
+	loginEvents     []model.LoginEvent
+	groups          map[string]*model.Group
+	serviceAccounts map[string]*model.ServiceAccount
+	idempotencyKeys map[string]*model.IdempotencyKey
+	loginOTPs       map[string]*model.LoginOTP
+	pendingUsers    map[string]model.PendingUser
+	limits          map[string]model.Limit
+	features        map[string]model.Feature
+	plan            *model.Plan
+	status          *model.TenantStatus
+	settings        bson.M
+	settingsHistory []model.SettingsVersion
+	settingsSchema  string
+	userSettings    map[string]bson.M
+	tokensRevoked   map[string]time.Time
+}
+
+func newTenantData() *tenantData {
+	return &tenantData{
+		users:           map[string]*model.User{},
+		deletedUsers:    map[string]*model.User{},
+		tokens:          map[string]*jwt.Token{},
+		groups:          map[string]*model.Group{},
+		serviceAccounts: map[string]*model.ServiceAccount{},
+		idempotencyKeys: map[string]*model.IdempotencyKey{},
+		loginOTPs:       map[string]*model.LoginOTP{},
+		pendingUsers:    map[string]model.PendingUser{},
+		limits:          map[string]model.Limit{},
+		features:        map[string]model.Feature{},
+		userSettings:    map[string]bson.M{},
+		tokensRevoked:   map[string]time.Time{},
+	}
+}
+
+func NewDataStoreMemory() *DataStoreMemory {
+	return &DataStoreMemory{
+		tenants:     map[string]*tenantData{},
+		jobs:        map[string]*model.JobStatus{},
+		jobLeases:   map[string]jobLease{},
+		revocations: map[string]*model.TokenRevocation{},
+		clients:     map[string]*model.OAuthClient{},
+		codes:       map[string]*model.OAuthCode{},
+		devices:     map[string]*model.DeviceAuthorization{},
+		loginLinks:  map[string]*model.LoginLink{},
+		sessions:    map[string]*model.Session{},
+	}
+}
+
+// tenantID returns the tenant from the identity in the context
+func tenantID(ctx context.Context) string {
+	if id := identity.FromContext(ctx); id != nil {
+		return id.Tenant
+	}
+	return ""
+}
+
+// tenant returns the data of the tenant from the identity in the context,
+// must be called with the lock held
+func (db *DataStoreMemory) tenant(ctx context.Context) *tenantData {
+	name := tenantID(ctx)
+
+	t, ok := db.tenants[name]
+	if !ok {
+		t = newTenantData()
+		db.tenants[name] = t
+	}
+	return t
+}
+
+func (db *DataStoreMemory) CreateUser(ctx context.Context, u *model.User) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.users[u.ID]; ok {
+		return errors.Errorf("failed to insert user: duplicate ID %s", u.ID)
+	}
+	if t.userByEmail(u.Email) != nil {
+		return store.ErrDuplicateEmail
+	}
+	if u.Username != "" && t.userByUsername(u.Username) != nil {
+		return store.ErrDuplicateUsername
+	}
+	if t.overUserLimit() {
+		return store.ErrUserLimitReached
+	}
+
+	now := time.Now().UTC()
+
+	u.CreatedTs = &now
+	u.UpdatedTs = &now
+	u.ETag = newETag()
+
+	// login information is maintained by the service
+	u.LastLoginTs = nil
+	u.LastLoginIP = ""
+	u.FailedLoginAttempts = 0
+
+	// group membership is managed through the groups
+	u.Groups = nil
+
+	// additional email addresses are added one by one
+	u.Emails = nil
+
+	var user model.User
+	if err := copyDoc(u, &user); err != nil {
+		return errors.Wrap(err, "failed to insert user")
+	}
+	t.users[u.ID] = &user
+
+	return nil
+}
+
+func (db *DataStoreMemory) UpdateUser(ctx context.Context, id string, u *model.UserUpdate) error {
+	//compute/set password hash
+	if u.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return errors.Wrap(err, "failed to generate password hash")
+		}
+		u.Password = string(hash)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	user, ok := t.users[id]
+	if !ok {
+		return store.ErrUserNotFound
+	}
+	if len(u.IfMatch) > 0 && !containsString(u.IfMatch, user.ETag) {
+		return store.ErrETagMismatch
+	}
+	if u.Email != "" {
+		if other := t.userByEmail(u.Email); other != nil &&
+			(other.ID != id || other.Email != model.NormalizeEmail(u.Email)) {
+			return store.ErrDuplicateEmail
+		}
+	}
+	if u.Username != "" {
+		if other := t.userByUsername(u.Username); other != nil && other.ID != id {
+			return store.ErrDuplicateUsername
+		}
+	}
+
+	now := time.Now().UTC()
+	u.UpdatedTs = &now
+	u.ETag = newETag()
+
+	// the update is applied to the documents, the same as in mongo
+	doc := bson.M{}
+	if err := copyDoc(user, &doc); err != nil {
+		return errors.Wrap(err, "failed to update user")
+	}
+	update := bson.M{}
+	if err := copyDoc(u, &update); err != nil {
+		return errors.Wrap(err, "failed to update user")
+	}
+	for k, v := range update {
+		doc[k] = v
+	}
+	for _, field := range u.Clear {
+		delete(doc, field)
+	}
+
+	var updated model.User
+	if err := copyDoc(doc, &updated); err != nil {
+		return errors.Wrap(err, "failed to update user")
+	}
+	t.users[id] = &updated
+
+	return nil
+}
+
+func (db *DataStoreMemory) SetLastLogin(ctx context.Context, id string, ts time.Time, ip string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, ok := db.tenant(ctx).users[id]
+	if !ok {
+		return store.ErrUserNotFound
+	}
+
+	ts = ts.UTC()
+	user.LastLoginTs = &ts
+	user.LastLoginIP = ip
+	user.FailedLoginAttempts = 0
+
+	return nil
+}
+
+func (db *DataStoreMemory) IncFailedLogins(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, ok := db.tenant(ctx).users[id]
+	if !ok {
+		return store.ErrUserNotFound
+	}
+
+	user.FailedLoginAttempts++
+
+	return nil
+}
+
+func (db *DataStoreMemory) SaveLoginEvent(ctx context.Context, event *model.LoginEvent) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+	t.loginEvents = append(t.loginEvents, *event)
+
+	return nil
+}
+
+func (db *DataStoreMemory) GetLoginEvents(ctx context.Context, userID string) ([]model.LoginEvent, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	expired := time.Now().Add(-LoginEventsTTL)
+	kept := t.loginEvents[:0]
+	events := []model.LoginEvent{}
+	for _, e := range t.loginEvents {
+		if e.Timestamp.Before(expired) {
+			continue
+		}
+		kept = append(kept, e)
+		if e.UserID == userID {
+			events = append(events, e)
+		}
+	}
+	t.loginEvents = kept
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.After(events[j].Timestamp)
+	})
+
+	return events, nil
+}
+
+func (db *DataStoreMemory) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user := db.tenant(ctx).userByEmail(email)
+	if user == nil {
+		return nil, nil
+	}
+
+	var u model.User
+	if err := copyDoc(user, &u); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch user")
+	}
+
+	return &u, nil
+}
+
+// userByEmail finds the user by the primary or an additional email
+// regardless of case, like the unique indexes of the mongo store
+func (t *tenantData) userByEmail(email string) *model.User {
+	email = model.NormalizeEmail(email)
+	for _, u := range t.users {
+		if model.NormalizeEmail(u.Email) == email {
+			return u
+		}
+		for _, e := range u.Emails {
+			if model.NormalizeEmail(e.Email) == email {
+				return u
+			}
+		}
+	}
+	return nil
+}
+
+func (db *DataStoreMemory) AddUserEmail(ctx context.Context, id string, e *model.UserEmail) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	user, ok := t.users[id]
+	if !ok {
+		return store.ErrUserNotFound
+	}
+	if t.userByEmail(e.Email) != nil {
+		return store.ErrDuplicateEmail
+	}
+
+	now := time.Now().UTC()
+	e.CreatedTs = &now
+
+	user.Emails = append(user.Emails, *e)
+	user.UpdatedTs = &now
+	user.ETag = newETag()
+
+	return nil
+}
+
+func (db *DataStoreMemory) VerifyUserEmail(ctx context.Context, id, email string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, err := db.tenant(ctx).userWithEmail(id, email)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	e := user.FindEmail(email)
+	e.Verified = true
+	e.VerifiedTs = &now
+	e.CodeHash = ""
+
+	user.UpdatedTs = &now
+	user.ETag = newETag()
+
+	return nil
+}
+
+func (db *DataStoreMemory) DeleteUserEmail(ctx context.Context, id, email string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, err := db.tenant(ctx).userWithEmail(id, email)
+	if err != nil {
+		return err
+	}
+
+	emails := []model.UserEmail{}
+	for _, e := range user.Emails {
+		if e.Email != email {
+			emails = append(emails, e)
+		}
+	}
+	if len(emails) == 0 {
+		emails = nil
+	}
+
+	now := time.Now().UTC()
+	user.Emails = emails
+	user.UpdatedTs = &now
+	user.ETag = newETag()
+
+	return nil
+}
+
+func (db *DataStoreMemory) SetPrimaryEmail(ctx context.Context, id, email string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, err := db.tenant(ctx).userWithEmail(id, email)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	e := user.FindEmail(email)
+	*e = model.UserEmail{
+		Email:      user.Email,
+		Verified:   true,
+		CreatedTs:  user.CreatedTs,
+		VerifiedTs: &now,
+	}
+	user.Email = email
+	user.UpdatedTs = &now
+	user.ETag = newETag()
+
+	return nil
+}
+
+// userWithEmail returns the user having the additional email address
+func (t *tenantData) userWithEmail(id, email string) (*model.User, error) {
+	user, ok := t.users[id]
+	if !ok {
+		return nil, store.ErrUserNotFound
+	}
+	if user.FindEmail(email) == nil {
+		return nil, store.ErrUserEmailNotFound
+	}
+	return user, nil
+}
+
+func (db *DataStoreMemory) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user := db.tenant(ctx).userByUsername(username)
+	if user == nil {
+		return nil, nil
+	}
+
+	var u model.User
+	if err := copyDoc(user, &u); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch user")
+	}
+
+	return &u, nil
+}
+
+func (t *tenantData) userByUsername(username string) *model.User {
+	for _, u := range t.users {
+		if u.Username == username {
+			return u
+		}
+	}
+	return nil
+}
+
+// overUserLimit tells if another user would exceed the tenant's limit
+func (t *tenantData) overUserLimit() bool {
+	limit, ok := t.limits[model.LimitMaxUsers]
+	return ok && limit.Value > 0 && len(t.users) >= limit.Value
+}
+
+func (db *DataStoreMemory) GetUserById(ctx context.Context, id string) (*model.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	user, ok := db.tenant(ctx).users[id]
+	if !ok {
+		return nil, nil
+	}
+
+	u, err := projectUser(user, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch user")
+	}
+
+	return u, nil
+}
+
+func (db *DataStoreMemory) GetTokenById(ctx context.Context, id string) (*jwt.Token, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	token, ok := db.tenant(ctx).tokens[id]
+	if !ok {
+		return nil, nil
+	}
+
+	var tok jwt.Token
+	if err := copyDoc(token, &tok); err != nil {
+		return nil, errors.Wrap(err, "failed to fetch token")
+	}
+
+	return &tok, nil
+}
+
+func (db *DataStoreMemory) GetUsers(ctx context.Context, fltr model.UserFilter) ([]model.User, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	matching := db.tenant(ctx).filterUsers(fltr)
+	if fltr.Limit > 0 {
+		if fltr.Skip >= len(matching) {
+			matching = nil
+		} else {
+			matching = matching[fltr.Skip:]
+		}
+		if len(matching) > fltr.Limit {
+			matching = matching[:fltr.Limit]
+		}
+	}
+
+	users := []model.User{}
+	for _, user := range matching {
+		u, err := projectUser(user, fltr.Fields)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to fetch users")
+		}
+		users = append(users, *u)
+	}
+
+	return users, nil
+}
+
+func (db *DataStoreMemory) CountUsers(ctx context.Context, fltr model.UserFilter) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return len(db.tenant(ctx).filterUsers(fltr)), nil
+}
+
+func (db *DataStoreMemory) GetUsersVersion(ctx context.Context,
+	fltr model.UserFilter) (*model.UsersVersion, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var v model.UsersVersion
+
+	for _, u := range db.tenant(ctx).filterUsers(fltr) {
+		v.Count++
+		if u.UpdatedTs != nil && u.UpdatedTs.After(v.UpdatedTs) {
+			v.UpdatedTs = *u.UpdatedTs
+		}
+		if u.LastLoginTs != nil && u.LastLoginTs.After(v.LastLoginTs) {
+			v.LastLoginTs = *u.LastLoginTs
+		}
+		v.FailedLoginAttempts += u.FailedLoginAttempts
+	}
+
+	return &v, nil
+}
+
+func (db *DataStoreMemory) ForEachUser(ctx context.Context, fltr model.UserFilter,
+	fn func(u *model.User) error) error {
+	db.mu.Lock()
+	users := []*model.User{}
+	for _, user := range db.tenant(ctx).filterUsers(fltr) {
+		u, err := projectUser(user, fltr.Fields)
+		if err != nil {
+			db.mu.Unlock()
+			return errors.Wrap(err, "failed to fetch users")
+		}
+		users = append(users, u)
+	}
+	db.mu.Unlock()
+
+	// fn is called without the lock, it may use the datastore
+	for _, u := range users {
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// filterUsers returns the users matching the filter, ordered by email
+func (t *tenantData) filterUsers(fltr model.UserFilter) []*model.User {
+	users := []*model.User{}
+	for _, u := range t.users {
+		if matchesFilter(u, fltr) {
+			users = append(users, u)
+		}
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Email < users[j].Email
+	})
+
+	return users
+}
+
+func matchesFilter(u *model.User, fltr model.UserFilter) bool {
+	for k, v := range fltr.Attributes {
+		if attr, ok := u.Attributes[k]; !ok || attr != v {
+			return false
+		}
+	}
+	if fltr.Group != "" && !containsString(u.Groups, fltr.Group) {
+		return false
+	}
+	if fltr.ID != "" && u.ID != fltr.ID {
+		return false
+	}
+	if fltr.Active && !u.IsActive() {
+		return false
+	}
+	return true
+}
+
+// projectUser returns a copy of the user with the given fields, along
+// with the ETag, or all but the password; the JSON names of the fields
+// match the document keys except for the ID
+func projectUser(user *model.User, fields []string) (*model.User, error) {
+	doc := bson.M{}
+	if err := copyDoc(user, &doc); err != nil {
+		return nil, err
+	}
+
+	if len(fields) == 0 {
+		delete(doc, "password")
+	} else {
+		selected := bson.M{}
+		if etag, ok := doc["etag"]; ok {
+			selected["etag"] = etag
+		}
+		for _, f := range fields {
+			if f == "id" {
+				f = "_id"
+			}
+			if v, ok := doc[f]; ok {
+				selected[f] = v
+			}
+		}
+		doc = selected
+	}
+
+	var u model.User
+	if err := copyDoc(doc, &u); err != nil {
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+func (db *DataStoreMemory) DeleteUser(ctx context.Context, id string, ifMatch []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	user, ok := t.users[id]
+	if !ok {
+		if len(ifMatch) > 0 {
+			return store.ErrUserNotFound
+		}
+		return nil
+	}
+	if len(ifMatch) > 0 && !containsString(ifMatch, user.ETag) {
+		return store.ErrETagMismatch
+	}
+
+	now := time.Now().UTC()
+	user.DeletedTs = &now
+
+	// keep a tombstone, so that the user can be restored
+	t.deletedUsers[id] = user
+	delete(t.users, id)
+
+	return nil
+}
+
+func (db *DataStoreMemory) RestoreUser(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	user, ok := t.deletedUsers[id]
+	if !ok {
+		return store.ErrUserNotFound
+	}
+	if t.userByEmail(user.Email) != nil {
+		return store.ErrDuplicateEmail
+	}
+	for _, e := range user.Emails {
+		if t.userByEmail(e.Email) != nil {
+			return store.ErrDuplicateEmail
+		}
+	}
+	if user.Username != "" && t.userByUsername(user.Username) != nil {
+		return store.ErrDuplicateUsername
+	}
+	if t.overUserLimit() {
+		return store.ErrUserLimitReached
+	}
+
+	user.DeletedTs = nil
+	t.users[id] = user
+	delete(t.deletedUsers, id)
+
+	return nil
+}
+
+func (db *DataStoreMemory) EraseUser(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	_, active := t.users[id]
+	_, deleted := t.deletedUsers[id]
+	if !active && !deleted {
+		return store.ErrUserNotFound
+	}
+
+	tenant := tenantID(ctx)
+	for sid, s := range db.sessions {
+		if token, ok := t.tokens[s.TokenID]; ok && s.TenantID == tenant &&
+			token.Claims.Subject == id {
+			delete(db.sessions, sid)
+		}
+	}
+	for lid, l := range db.loginLinks {
+		if l.TenantID == tenant && l.UserID == id {
+			delete(db.loginLinks, lid)
+		}
+	}
+	for did, d := range db.devices {
+		if d.TenantID == tenant && d.UserID == id {
+			delete(db.devices, did)
+		}
+	}
+
+	for tid, token := range t.tokens {
+		if token.Claims.Subject == id {
+			delete(t.tokens, tid)
+		}
+	}
+	delete(t.tokensRevoked, id)
+
+	events := t.loginEvents[:0]
+	for _, e := range t.loginEvents {
+		if e.UserID != id {
+			events = append(events, e)
+		}
+	}
+	t.loginEvents = events
+
+	for key, k := range t.idempotencyKeys {
+		if k.UserID == id {
+			delete(t.idempotencyKeys, key)
+		}
+	}
+
+	delete(t.loginOTPs, id)
+	delete(t.userSettings, id)
+	delete(t.deletedUsers, id)
+	delete(t.users, id)
+
+	return nil
+}
+
+func (db *DataStoreMemory) PurgeDeletedUsers(ctx context.Context, before time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, t := range db.tenants {
+		for id, u := range t.deletedUsers {
+			if u.DeletedTs.Before(before) {
+				delete(t.deletedUsers, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (db *DataStoreMemory) CreateGroup(ctx context.Context, g *model.Group) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.groups[g.ID]; ok {
+		return errors.Errorf("failed to insert group: duplicate ID %s", g.ID)
+	}
+	for _, other := range t.groups {
+		if other.Name == g.Name {
+			return store.ErrDuplicateGroupName
+		}
+	}
+
+	now := time.Now().UTC()
+	g.CreatedTs = &now
+
+	group := *g
+	t.groups[g.ID] = &group
+
+	return nil
+}
+
+func (db *DataStoreMemory) GetGroups(ctx context.Context) ([]model.Group, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	groups := []model.Group{}
+	for _, g := range db.tenant(ctx).groups {
+		groups = append(groups, *g)
+	}
+	sortGroups(groups)
+
+	return groups, nil
+}
+
+func (db *DataStoreMemory) GetGroupById(ctx context.Context, id string) (*model.Group, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	g, ok := db.tenant(ctx).groups[id]
+	if !ok {
+		return nil, nil
+	}
+
+	group := *g
+	return &group, nil
+}
+
+func (db *DataStoreMemory) GetGroupsByIds(ctx context.Context, ids []string) ([]model.Group, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	groups := []model.Group{}
+	for id, g := range t.groups {
+		if containsString(ids, id) {
+			groups = append(groups, *g)
+		}
+	}
+	sortGroups(groups)
+
+	return groups, nil
+}
+
+func sortGroups(groups []model.Group) {
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+}
+
+func (db *DataStoreMemory) DeleteGroup(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	for _, u := range t.users {
+		if containsString(u.Groups, id) {
+			u.Groups = removeString(u.Groups, id)
+			touchUser(u)
+		}
+	}
+
+	delete(t.groups, id)
+
+	return nil
+}
+
+func (db *DataStoreMemory) AddUserToGroup(ctx context.Context, userID, groupID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u, ok := db.tenant(ctx).users[userID]
+	if !ok {
+		return store.ErrUserNotFound
+	}
+
+	if !containsString(u.Groups, groupID) {
+		u.Groups = append(u.Groups, groupID)
+	}
+	touchUser(u)
+
+	return nil
+}
+
+func (db *DataStoreMemory) RemoveUserFromGroup(ctx context.Context, userID, groupID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	u, ok := db.tenant(ctx).users[userID]
+	if !ok {
+		return store.ErrUserNotFound
+	}
+
+	u.Groups = removeString(u.Groups, groupID)
+	touchUser(u)
+
+	return nil
+}
+
+func (db *DataStoreMemory) DisableExpiredUsers(ctx context.Context, now time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, t := range db.tenants {
+		for _, u := range t.users {
+			if u.ExpiresAt == nil || u.ExpiresAt.After(now) ||
+				u.Status == model.UserStatusInactive {
+				continue
+			}
+			u.Status = model.UserStatusInactive
+			u.ETag = newETag()
+			ts := now.UTC()
+			u.UpdatedTs = &ts
+		}
+	}
+
+	return nil
+}
+
+func (db *DataStoreMemory) CountUsersByTenant(ctx context.Context,
+	activeSince time.Time) ([]model.UserCount, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	names := make([]string, 0, len(db.tenants))
+	for name := range db.tenants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	counts := []model.UserCount{}
+	for _, name := range names {
+		c := model.UserCount{TenantID: name}
+		for _, u := range db.tenants[name].users {
+			c.Total++
+			if u.LastLoginTs != nil && u.LastLoginTs.After(activeSince) &&
+				u.Status != model.UserStatusInactive {
+				c.Active++
+			}
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, nil
+}
+
+// touchUser marks the user as modified
+func touchUser(u *model.User) {
+	now := time.Now().UTC()
+	u.UpdatedTs = &now
+	u.ETag = newETag()
+}
+
+func (db *DataStoreMemory) SaveToken(ctx context.Context, token *jwt.Token) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.tokens[token.Id]; ok {
+		return errors.Errorf("failed to store token: duplicate ID %s", token.Id)
+	}
+
+	var tok jwt.Token
+	if err := copyDoc(token, &tok); err != nil {
+		return errors.Wrap(err, "failed to store token")
+	}
+	t.tokens[token.Id] = &tok
+
+	return nil
+}
+
+// deletes all tenant's tokens (identity in context)
+func (db *DataStoreMemory) DeleteTokens(ctx context.Context) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	if len(t.tokens) == 0 {
+		return store.ErrTokenNotFound
+	}
+	t.tokens = map[string]*jwt.Token{}
+
+	return nil
+}
+
+func (db *DataStoreMemory) GetTokensByUserId(ctx context.Context, userId string) ([]jwt.Token, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tokens := []jwt.Token{}
+	for _, token := range db.tenant(ctx).tokens {
+		if token.Claims.Subject == userId {
+			tokens = append(tokens, *token)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].Claims.IssuedAt < tokens[j].Claims.IssuedAt
+	})
+
+	return tokens, nil
+}
+
+func (db *DataStoreMemory) DeleteTokensByUserId(ctx context.Context, userId string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	removed := 0
+	for id, token := range t.tokens {
+		if token.Claims.Subject == userId {
+			delete(t.tokens, id)
+			removed++
+		}
+	}
+
+	if removed == 0 {
+		return store.ErrTokenNotFound
+	}
+
+	return nil
+}
+
+func (db *DataStoreMemory) DeleteExpiredTokens(ctx context.Context, now time.Time) (int, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	removed := 0
+	for _, t := range db.tenants {
+		for id, token := range t.tokens {
+			if token.Claims.ExpiresAt > 0 && token.Claims.ExpiresAt < now.Unix() {
+				delete(t.tokens, id)
+				removed++
+			}
+		}
+	}
+
+	return removed, nil
+}
+
+func (db *DataStoreMemory) CreateIdempotencyKey(ctx context.Context, k *model.IdempotencyKey) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	if existing := t.idempotencyKey(k.Key); existing != nil {
+		return store.ErrDuplicateIdempotencyKey
+	}
+
+	key := *k
+	t.idempotencyKeys[k.Key] = &key
+
+	return nil
+}
+
+func (db *DataStoreMemory) GetIdempotencyKey(ctx context.Context, key string) (*model.IdempotencyKey, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	k := db.tenant(ctx).idempotencyKey(key)
+	if k == nil {
+		return nil, nil
+	}
+
+	ret := *k
+	return &ret, nil
+}
+
+// idempotencyKey returns the key unless it expired, in which case
+// it's removed
+func (t *tenantData) idempotencyKey(key string) *model.IdempotencyKey {
+	k, ok := t.idempotencyKeys[key]
+	if !ok {
+		return nil
+	}
+	if k.CreatedTs.Before(time.Now().Add(-IdempotencyTTL)) {
+		delete(t.idempotencyKeys, key)
+		return nil
+	}
+	return k
+}
+
+func (db *DataStoreMemory) SetIdempotencyKeyUser(ctx context.Context, key, userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if k := db.tenant(ctx).idempotencyKey(key); k != nil {
+		k.UserID = userID
+	}
+
+	return nil
+}
+
+func (db *DataStoreMemory) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.tenant(ctx).idempotencyKeys, key)
+
+	return nil
+}
+
+func (db *DataStoreMemory) CreatePendingUser(ctx context.Context, p *model.PendingUser) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.pendingUsers[p.UserID]; ok {
+		return errors.New("failed to insert pending user: duplicate key")
+	}
+	t.pendingUsers[p.UserID] = *p
+
+	return nil
+}
+
+func (db *DataStoreMemory) DeletePendingUser(ctx context.Context, userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.tenant(ctx).pendingUsers, userID)
+
+	return nil
+}
+
+func (db *DataStoreMemory) GetPendingUsers(ctx context.Context, before time.Time) ([]model.PendingUser, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	pending := []model.PendingUser{}
+	for _, t := range db.tenants {
+		for _, p := range t.pendingUsers {
+			if p.CreatedTs.Before(before) {
+				pending = append(pending, p)
+			}
+		}
+	}
+
+	return pending, nil
+}
+
+func (db *DataStoreMemory) SetLimit(ctx context.Context, l *model.Limit) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.tenant(ctx).limits[l.Name] = *l
+
+	return nil
+}
+
+func (db *DataStoreMemory) GetLimit(ctx context.Context, name string) (*model.Limit, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	limit, ok := db.tenant(ctx).limits[name]
+	if !ok {
+		return nil, nil
+	}
+
+	return &limit, nil
+}
+
+func (db *DataStoreMemory) SetPlan(ctx context.Context, p *model.Plan) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	plan := *p
+	db.tenant(ctx).plan = &plan
+
+	return nil
+}
+
+func (db *DataStoreMemory) GetPlan(ctx context.Context) (*model.Plan, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.tenant(ctx).plan == nil {
+		return nil, nil
+	}
+	plan := *db.tenant(ctx).plan
+
+	return &plan, nil
+}
+
+func (db *DataStoreMemory) SetTenantStatus(ctx context.Context, st *model.TenantStatus) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	status := *st
+	db.tenant(ctx).status = &status
+
+	return nil
+}
+
+func (db *DataStoreMemory) GetTenantStatus(ctx context.Context) (*model.TenantStatus, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.tenant(ctx).status == nil {
+		return nil, nil
+	}
+	status := *db.tenant(ctx).status
+
+	return &status, nil
+}
+
+func (db *DataStoreMemory) SetFeature(ctx context.Context, f *model.Feature) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.tenant(ctx).features[f.Name] = *f
+
+	return nil
+}
+
+func (db *DataStoreMemory) DeleteFeature(ctx context.Context, name string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.tenant(ctx).features, name)
+
+	return nil
+}
+
+func (db *DataStoreMemory) GetFeatures(ctx context.Context) ([]model.Feature, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	features := []model.Feature{}
+	for _, f := range db.tenant(ctx).features {
+		features = append(features, f)
+	}
+	sort.Slice(features, func(i, j int) bool {
+		return features[i].Name < features[j].Name
+	})
+
+	return features, nil
+}
+
+func (db *DataStoreMemory) SaveSettings(ctx context.Context, s map[string]interface{},
+	ifMatch []string) (string, error) {
+	return db.replaceSettings(ctx, ifMatch,
+		func(map[string]interface{}) (map[string]interface{}, error) {
+			return s, nil
+		})
+}
+
+func (db *DataStoreMemory) SaveSetting(ctx context.Context, key string, value interface{},
+	ifMatch []string) (string, error) {
+	return db.replaceSettings(ctx, ifMatch,
+		func(current map[string]interface{}) (map[string]interface{}, error) {
+			current[key] = value
+			return current, nil
+		})
+}
+
+func (db *DataStoreMemory) DeleteSetting(ctx context.Context, key string,
+	ifMatch []string) (string, error) {
+	return db.replaceSettings(ctx, ifMatch,
+		func(current map[string]interface{}) (map[string]interface{}, error) {
+			if _, ok := current[key]; !ok {
+				return nil, store.ErrSettingNotFound
+			}
+			delete(current, key)
+			return current, nil
+		})
+}
+
+// replaceSettings replaces the settings with the ones returned by fn for
+// the current settings (without the keys maintained here), keeping the
+// replaced version in the history
+func (db *DataStoreMemory) replaceSettings(ctx context.Context, ifMatch []string,
+	fn func(current map[string]interface{}) (map[string]interface{}, error)) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	existingETag, _ := t.settings[settingsETag].(string)
+	if len(ifMatch) > 0 && (t.settings == nil || !containsString(ifMatch, existingETag)) {
+		return "", store.ErrSettingsETagMismatch
+	}
+
+	current := map[string]interface{}{}
+	for k, v := range t.settings {
+		switch k {
+		case settingsCreatedTs, settingsUpdatedTs, settingsETag:
+		default:
+			current[k] = v
+		}
+	}
+
+	s, err := fn(current)
+	if err != nil {
+		return "", err
+	}
+
+	// timestamps and ETag are maintained here, the creation time is
+	// carried over from the settings being replaced
+	now := time.Now().UTC()
+	etag := newETag()
+
+	doc := bson.M{}
+	if err := copyDoc(s, &doc); err != nil {
+		return "", errors.Wrapf(err, "failed to store settings %v", s)
+	}
+	doc[settingsCreatedTs] = now
+	doc[settingsUpdatedTs] = now
+	doc[settingsETag] = etag
+
+	if t.settings != nil {
+		if createdTs, ok := t.settings[settingsCreatedTs].(time.Time); ok {
+			doc[settingsCreatedTs] = createdTs
+		}
+		t.addSettingsVersion(t.settings, now)
+	}
+	t.settings = doc
+
+	return etag, nil
+}
+
+// addSettingsVersion stores the replaced settings in the history,
+// dropping the oldest versions over SettingsHistoryLength
+func (t *tenantData) addSettingsVersion(settings bson.M, replaced time.Time) {
+	version := model.SettingsVersion{
+		ETag:       newETag(),
+		ReplacedTs: replaced,
+		Settings:   map[string]interface{}{},
+	}
+	for k, v := range settings {
+		if k == settingsETag {
+			if etag, ok := v.(string); ok {
+				version.ETag = etag
+			}
+			continue
+		}
+		version.Settings[k] = v
+	}
+
+	t.settingsHistory = append([]model.SettingsVersion{version}, t.settingsHistory...)
+	if len(t.settingsHistory) > SettingsHistoryLength {
+		t.settingsHistory = t.settingsHistory[:SettingsHistoryLength]
+	}
+}
+
+func (db *DataStoreMemory) GetSettings(ctx context.Context) (map[string]interface{}, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	settings := map[string]interface{}{}
+	if err := copyDoc(db.tenant(ctx).settings, &settings); err != nil {
+		return nil, errors.Wrap(err, "failed to get settings")
+	}
+
+	return settings, nil
+}
+
+func (db *DataStoreMemory) GetSettingsHistory(ctx context.Context) ([]model.SettingsVersion, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	versions := []model.SettingsVersion{}
+	for _, v := range db.tenant(ctx).settingsHistory {
+		var version model.SettingsVersion
+		if err := copyDoc(v, &version); err != nil {
+			return nil, errors.Wrap(err, "failed to get settings history")
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+func (db *DataStoreMemory) RollbackSettings(ctx context.Context, etag string,
+	ifMatch []string) (string, error) {
+	db.mu.Lock()
+	var settings map[string]interface{}
+	for _, v := range db.tenant(ctx).settingsHistory {
+		if v.ETag == etag {
+			settings = v.Settings
+			break
+		}
+	}
+	db.mu.Unlock()
+
+	if settings == nil {
+		return "", store.ErrSettingsVersionNotFound
+	}
+
+	return db.SaveSettings(ctx, settings, ifMatch)
+}
+
+func (db *DataStoreMemory) SaveSettingsSchema(ctx context.Context, schema string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.tenant(ctx).settingsSchema = schema
+
+	return nil
+}
+
+func (db *DataStoreMemory) GetSettingsSchema(ctx context.Context) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.tenant(ctx).settingsSchema, nil
+}
+
+func (db *DataStoreMemory) DeleteSettingsSchema(ctx context.Context) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.tenant(ctx).settingsSchema = ""
+
+	return nil
+}
+
+func (db *DataStoreMemory) SaveUserSettings(ctx context.Context, userID string,
+	s map[string]interface{}) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	now := time.Now().UTC()
+
+	doc := bson.M{}
+	if err := copyDoc(s, &doc); err != nil {
+		return errors.Wrapf(err, "failed to store settings of user %s", userID)
+	}
+	doc[settingsCreatedTs] = now
+	doc[settingsUpdatedTs] = now
+
+	if existing, ok := t.userSettings[userID]; ok {
+		if createdTs, ok := existing[settingsCreatedTs].(time.Time); ok {
+			doc[settingsCreatedTs] = createdTs
+		}
+	}
+	t.userSettings[userID] = doc
+
+	return nil
+}
+
+func (db *DataStoreMemory) GetUserSettings(ctx context.Context,
+	userID string) (map[string]interface{}, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	settings := map[string]interface{}{}
+	if err := copyDoc(db.tenant(ctx).userSettings[userID], &settings); err != nil {
+		return nil, errors.Wrapf(err, "failed to get settings of user %s", userID)
+	}
+
+	return settings, nil
+}
+
+// MigrateTenant has nothing to migrate, the data is created on first use
+func (db *DataStoreMemory) MigrateTenant(ctx context.Context, id string) error {
+	return nil
+}
+
+// GetMigrationStatus reports no migrations, there's no schema
+func (db *DataStoreMemory) GetMigrationStatus(ctx context.Context, id string) (*model.MigrationStatus, error) {
+	return &model.MigrationStatus{
+		TenantID: id,
+		Steps:    []model.MigrationStep{},
+	}, nil
+}
+
+// GetMigrationProgress reports no migration, there's nothing to migrate
+func (db *DataStoreMemory) GetMigrationProgress(ctx context.Context) (*model.MigrationProgress, error) {
+	return nil, nil
+}
+
+// TenantExists tells whether any data of the tenant was stored
+func (db *DataStoreMemory) TenantExists(ctx context.Context, id string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	_, ok := db.tenants[id]
+	return ok, nil
+}
+
+// DeleteTenant removes all data of given tenant
+func (db *DataStoreMemory) DeleteTenant(ctx context.Context, id string) error {
+	if id == "" {
+		return errors.New("tenant ID must be provided")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	delete(db.tenants, id)
+
+	return nil
+}
+
+// copyDoc copies in to out through their BSON representation, so that
+// the stored data is not shared with the callers and reads the same
+// as from mongo
+func copyDoc(in, out interface{}) error {
+	if in == nil {
+		return nil
+	}
+	data, err := bson.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(data, out)
+}
+
+// newETag generates a new version of the user information
+func newETag() string {
+	return uuid.NewV4().String()
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(list []string, s string) []string {
+	ret := []string{}
+	for _, e := range list {
+		if e != s {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
+
+func (db *DataStoreMemory) SaveJobRun(ctx context.Context, run *model.JobRun) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	status, ok := db.jobs[run.Name]
+	if !ok {
+		status = &model.JobStatus{}
+		db.jobs[run.Name] = status
+	}
+	status.Apply(run)
+	return nil
+}
+
+// jobLease is held by an instance of the service until the given time
+type jobLease struct {
+	holder string
+	until  time.Time
+}
+
+func (db *DataStoreMemory) AcquireJobLease(ctx context.Context, name, holder string,
+	until time.Time) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	lease, ok := db.jobLeases[name]
+	if ok && lease.holder != holder && lease.until.After(time.Now()) {
+		return false, nil
+	}
+	db.jobLeases[name] = jobLease{holder: holder, until: until}
+	return true, nil
+}
+
+func (db *DataStoreMemory) GetJobStatuses(ctx context.Context) ([]model.JobStatus, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	statuses := []model.JobStatus{}
+	for _, status := range db.jobs {
+		statuses = append(statuses, *status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses, nil
+}
+
+func (db *DataStoreMemory) SaveMaintenance(ctx context.Context, s *model.MaintenanceState) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored := *s
+	db.maintenance = &stored
+	return nil
+}
+
+func (db *DataStoreMemory) GetMaintenance(ctx context.Context) (*model.MaintenanceState, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.maintenance == nil {
+		return nil, nil
+	}
+	s := *db.maintenance
+	return &s, nil
+}
+
+func (db *DataStoreMemory) RevokeTokens(ctx context.Context, userId string, ts time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+	if ts.After(t.tokensRevoked[userId]) {
+		t.tokensRevoked[userId] = ts
+	}
+	return nil
+}
+
+func (db *DataStoreMemory) GetTokensRevokedTs(ctx context.Context, userId string) (time.Time, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+	ts := t.tokensRevoked[""]
+	if userTs := t.tokensRevoked[userId]; userTs.After(ts) {
+		ts = userTs
+	}
+	return ts, nil
+}
+
+func (db *DataStoreMemory) SaveTokenRevocation(ctx context.Context, r *model.TokenRevocation) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	saved := *r
+	db.revocations[r.ID] = &saved
+	return nil
+}
+
+func (db *DataStoreMemory) GetTokenRevocation(ctx context.Context, id string) (*model.TokenRevocation, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	r, ok := db.revocations[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *r
+	return &found, nil
+}
+
+func (db *DataStoreMemory) ClaimTokenRevocation(ctx context.Context,
+	now, staleBefore time.Time) (*model.TokenRevocation, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var oldest *model.TokenRevocation
+	for _, r := range db.revocations {
+		claimable := r.Status == model.RevocationStatusPending ||
+			(r.Status == model.RevocationStatusRunning &&
+				r.StartedTs != nil && r.StartedTs.Before(staleBefore))
+		if claimable && (oldest == nil || r.CreatedTs.Before(oldest.CreatedTs)) {
+			oldest = r
+		}
+	}
+	if oldest == nil {
+		return nil, nil
+	}
+
+	oldest.Status = model.RevocationStatusRunning
+	oldest.StartedTs = &now
+	claimed := *oldest
+	return &claimed, nil
+}
+
+func (db *DataStoreMemory) CreateOAuthClient(ctx context.Context, c *model.OAuthClient) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	saved := *c
+	saved.TenantID = tenantID(ctx)
+	db.clients[c.ID] = &saved
+	return nil
+}
+
+func (db *DataStoreMemory) GetOAuthClientById(ctx context.Context,
+	id string) (*model.OAuthClient, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c, ok := db.clients[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *c
+	return &found, nil
+}
+
+func (db *DataStoreMemory) GetOAuthClients(ctx context.Context) ([]model.OAuthClient, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tenant := tenantID(ctx)
+	clients := []model.OAuthClient{}
+	for _, c := range db.clients {
+		if c.TenantID == tenant {
+			clients = append(clients, *c)
+		}
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CreatedTs.Before(clients[j].CreatedTs)
+	})
+	return clients, nil
+}
+
+func (db *DataStoreMemory) DeleteOAuthClient(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c, ok := db.clients[id]
+	if !ok || c.TenantID != tenantID(ctx) {
+		return store.ErrOAuthClientNotFound
+	}
+	delete(db.clients, id)
+	return nil
+}
+
+func (db *DataStoreMemory) SaveOAuthCode(ctx context.Context, c *model.OAuthCode) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	saved := *c
+	db.codes[c.ID] = &saved
+	return nil
+}
+
+func (db *DataStoreMemory) TakeOAuthCode(ctx context.Context,
+	id string) (*model.OAuthCode, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	c, ok := db.codes[id]
+	if !ok {
+		return nil, nil
+	}
+	delete(db.codes, id)
+	return c, nil
+}
+
+func (db *DataStoreMemory) SaveLoginLink(ctx context.Context, l *model.LoginLink) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	saved := *l
+	db.loginLinks[l.ID] = &saved
+	return nil
+}
+
+func (db *DataStoreMemory) TakeLoginLink(ctx context.Context,
+	id string) (*model.LoginLink, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	l, ok := db.loginLinks[id]
+	if !ok {
+		return nil, nil
+	}
+	delete(db.loginLinks, id)
+	return l, nil
+}
+
+func (db *DataStoreMemory) GetLatestLoginLink(ctx context.Context,
+	tenantID, userID string) (*model.LoginLink, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var latest *model.LoginLink
+	for _, l := range db.loginLinks {
+		if l.TenantID == tenantID && l.UserID == userID &&
+			(latest == nil || l.CreatedTs.After(latest.CreatedTs)) {
+			latest = l
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	found := *latest
+	return &found, nil
+}
+
+func (db *DataStoreMemory) CreateDeviceAuthorization(ctx context.Context,
+	a *model.DeviceAuthorization) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, d := range db.devices {
+		if d.UserCode == a.UserCode {
+			return store.ErrDuplicateUserCode
+		}
+	}
+
+	saved := *a
+	db.devices[a.ID] = &saved
+	return nil
+}
+
+func (db *DataStoreMemory) GetDeviceAuthorization(ctx context.Context,
+	id string) (*model.DeviceAuthorization, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	a, ok := db.devices[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *a
+	return &found, nil
+}
+
+func (db *DataStoreMemory) GetDeviceAuthorizationByUserCode(ctx context.Context,
+	userCode string) (*model.DeviceAuthorization, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	for _, a := range db.devices {
+		if a.UserCode == userCode {
+			found := *a
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (db *DataStoreMemory) ResolveDeviceAuthorization(ctx context.Context, id string,
+	r model.DeviceAuthorizationResolution) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	a, ok := db.devices[id]
+	if !ok || a.Status != model.DeviceAuthorizationPending {
+		return store.ErrDeviceAuthorizationNotFound
+	}
+	a.Status = r.Status
+	a.TenantID = r.TenantID
+	a.UserID = r.UserID
+	a.Scope = r.Scope
+	return nil
+}
+
+func (db *DataStoreMemory) SetDeviceAuthorizationPolled(ctx context.Context, id string,
+	ts time.Time, interval int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if a, ok := db.devices[id]; ok {
+		a.PolledTs = ts
+		a.Interval = interval
+	}
+	return nil
+}
+
+func (db *DataStoreMemory) DeleteDeviceAuthorization(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.devices[id]; !ok {
+		return store.ErrDeviceAuthorizationNotFound
+	}
+	delete(db.devices, id)
+	return nil
+}
+
+func (db *DataStoreMemory) SaveSession(ctx context.Context, s *model.Session) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	saved := *s
+	db.sessions[s.ID] = &saved
+	return nil
+}
+
+func (db *DataStoreMemory) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	s, ok := db.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *s
+	return &found, nil
+}
+
+func (db *DataStoreMemory) SaveLoginOTP(ctx context.Context, otp *model.LoginOTP) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	saved := *otp
+	db.tenant(ctx).loginOTPs[otp.UserID] = &saved
+	return nil
+}
+
+func (db *DataStoreMemory) GetLoginOTP(ctx context.Context,
+	userID string) (*model.LoginOTP, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	otp, ok := db.tenant(ctx).loginOTPs[userID]
+	if !ok {
+		return nil, nil
+	}
+	found := *otp
+	return &found, nil
+}
+
+func (db *DataStoreMemory) TakeLoginOTPAttempt(ctx context.Context, userID string,
+	now time.Time) (*model.LoginOTP, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	otp, ok := db.tenant(ctx).loginOTPs[userID]
+	if !ok || otp.Attempts >= model.MaxLoginOTPAttempts || !now.Before(otp.ExpiresTs) {
+		return nil, nil
+	}
+	found := *otp
+	otp.Attempts++
+	return &found, nil
+}
+
+func (db *DataStoreMemory) DeleteLoginOTP(ctx context.Context, userID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+	if _, ok := t.loginOTPs[userID]; !ok {
+		return store.ErrLoginOTPNotFound
+	}
+	delete(t.loginOTPs, userID)
+	return nil
+}
+
+func (db *DataStoreMemory) CreateServiceAccount(ctx context.Context,
+	a *model.ServiceAccount) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.serviceAccounts[a.ID]; ok {
+		return errors.Errorf("failed to insert service account: duplicate ID %s", a.ID)
+	}
+	for _, other := range t.serviceAccounts {
+		if other.Name == a.Name {
+			return store.ErrDuplicateServiceAccountName
+		}
+	}
+
+	account := *a
+	t.serviceAccounts[a.ID] = &account
+
+	return nil
+}
+
+func (db *DataStoreMemory) GetServiceAccounts(ctx context.Context) ([]model.ServiceAccount, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	accounts := []model.ServiceAccount{}
+	for _, a := range db.tenant(ctx).serviceAccounts {
+		accounts = append(accounts, *a)
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].Name < accounts[j].Name
+	})
+
+	return accounts, nil
+}
+
+func (db *DataStoreMemory) GetServiceAccountById(ctx context.Context,
+	id string) (*model.ServiceAccount, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	a, ok := db.tenant(ctx).serviceAccounts[id]
+	if !ok {
+		return nil, nil
+	}
+
+	account := *a
+	return &account, nil
+}
+
+func (db *DataStoreMemory) UpdateServiceAccount(ctx context.Context, id string,
+	u *model.ServiceAccountUpdate) (*model.ServiceAccount, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	a, ok := db.tenant(ctx).serviceAccounts[id]
+	if !ok {
+		return nil, store.ErrServiceAccountNotFound
+	}
+
+	if u.Description != nil {
+		a.Description = *u.Description
+	}
+	if u.Scope != nil {
+		a.Scope = *u.Scope
+	}
+	if u.Owner != nil {
+		a.Owner = *u.Owner
+	}
+	a.UpdatedTs = time.Now().UTC()
+
+	account := *a
+	return &account, nil
+}
+
+func (db *DataStoreMemory) DeleteServiceAccount(ctx context.Context, id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	t := db.tenant(ctx)
+
+	if _, ok := t.serviceAccounts[id]; !ok {
+		return store.ErrServiceAccountNotFound
+	}
+	delete(t.serviceAccounts, id)
+
+	return nil
+}
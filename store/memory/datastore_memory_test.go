@@ -0,0 +1,915 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+)
+
+var (
+	_ store.DataStore        = &DataStoreMemory{}
+	_ store.TenantDataKeeper = &DataStoreMemory{}
+)
+
+func tenantContext(tenant string) context.Context {
+	return identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: tenant,
+	})
+}
+
+func TestDataStoreMemoryUsers(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreMemory()
+
+	for _, u := range []model.User{
+		{ID: "1", Email: "b@foo.com", Username: "bob", Password: "hash",
+			Attributes: map[string]string{"team": "a"}},
+		{ID: "2", Email: "a@foo.com", Password: "hash",
+			Attributes: map[string]string{"team": "b"}},
+		{ID: "3", Email: "c@foo.com", Password: "hash",
+			Attributes: map[string]string{"team": "a"}},
+	} {
+		u := u
+		assert.NoError(t, db.CreateUser(ctx, &u))
+		assert.NotEmpty(t, u.ETag)
+	}
+
+	err := db.CreateUser(ctx, &model.User{ID: "4", Email: "a@foo.com"})
+	assert.Equal(t, store.ErrDuplicateEmail, err)
+
+	// emails are unique regardless of case
+	err = db.CreateUser(ctx, &model.User{ID: "4", Email: "A@Foo.com"})
+	assert.Equal(t, store.ErrDuplicateEmail, err)
+
+	err = db.CreateUser(ctx, &model.User{ID: "4", Email: "d@foo.com", Username: "bob"})
+	assert.Equal(t, store.ErrDuplicateUsername, err)
+
+	err = db.UpdateUser(ctx, "2", &model.UserUpdate{Username: "bob"})
+	assert.Equal(t, store.ErrDuplicateUsername, err)
+
+	u, err := db.GetUserByUsername(ctx, "bob")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", u.ID)
+
+	u, err = db.GetUserByUsername(ctx, "alice")
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+
+	users, err := db.GetUsers(ctx, model.UserFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, users, 3)
+	assert.Equal(t, "a@foo.com", users[0].Email)
+	assert.Empty(t, users[0].Password)
+
+	users, err = db.GetUsers(ctx, model.UserFilter{
+		Attributes: map[string]string{"team": "a"},
+		Skip:       1,
+		Limit:      5,
+		Fields:     []string{"id"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.NotEmpty(t, users[0].ETag)
+		users[0].ETag = ""
+		assert.Equal(t, model.User{ID: "3"}, users[0])
+	}
+
+	users, err = db.GetUsers(ctx, model.UserFilter{
+		ID:     "2",
+		Fields: []string{"email"},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.NotEmpty(t, users[0].ETag)
+		users[0].ETag = ""
+		assert.Equal(t, model.User{Email: "a@foo.com"}, users[0])
+	}
+
+	n, err := db.CountUsers(ctx, model.UserFilter{
+		Attributes: map[string]string{"team": "a"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	u, err = db.GetUserByEmail(ctx, "b@foo.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "hash", u.Password)
+
+	// the update is checked against the ETag and applied field by field
+	err = db.UpdateUser(ctx, "1", &model.UserUpdate{
+		Name:    "Bob",
+		IfMatch: []string{"stale"},
+	})
+	assert.Equal(t, store.ErrETagMismatch, err)
+
+	err = db.UpdateUser(ctx, "1", &model.UserUpdate{
+		Name:    "Bob",
+		Clear:   []string{"attributes"},
+		IfMatch: []string{u.ETag},
+	})
+	assert.NoError(t, err)
+
+	err = db.UpdateUser(ctx, "1", &model.UserUpdate{Email: "c@foo.com"})
+	assert.Equal(t, store.ErrDuplicateEmail, err)
+
+	err = db.UpdateUser(ctx, "nope", &model.UserUpdate{Name: "Bob"})
+	assert.Equal(t, store.ErrUserNotFound, err)
+
+	u, err = db.GetUserById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Bob", u.Name)
+	assert.Equal(t, "b@foo.com", u.Email)
+	assert.Nil(t, u.Attributes)
+	assert.Empty(t, u.Password)
+
+	// login information
+	assert.NoError(t, db.IncFailedLogins(ctx, "2"))
+	assert.NoError(t, db.IncFailedLogins(ctx, "2"))
+	version, err := db.GetUsersVersion(ctx, model.UserFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, version.Count)
+	assert.Equal(t, 2, version.FailedLoginAttempts)
+
+	now := time.Now()
+	assert.NoError(t, db.SetLastLogin(ctx, "2", now, "1.2.3.4"))
+	u, err = db.GetUserById(ctx, "2")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, u.FailedLoginAttempts)
+	assert.Equal(t, "1.2.3.4", u.LastLoginIP)
+
+	// other tenants don't see the users
+	users, err = db.GetUsers(tenantContext("tenant1"), model.UserFilter{})
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+
+	// removal
+	assert.Equal(t, store.ErrETagMismatch, db.DeleteUser(ctx, "3", []string{"v0"}))
+	assert.NoError(t, db.DeleteUser(ctx, "3", nil))
+	u, err = db.GetUserById(ctx, "3")
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+
+	assert.NoError(t, db.RestoreUser(ctx, "3"))
+	assert.Equal(t, store.ErrUserNotFound, db.RestoreUser(ctx, "3"))
+
+	assert.Equal(t, store.ErrUserNotFound, db.DeleteUser(ctx, "4", []string{"v0"}))
+	assert.NoError(t, db.DeleteUser(ctx, "3", nil))
+	assert.NoError(t, db.PurgeDeletedUsers(ctx, time.Now().Add(time.Minute)))
+	assert.Equal(t, store.ErrUserNotFound, db.RestoreUser(ctx, "3"))
+
+	assert.NoError(t, db.SaveToken(ctx, &jwt.Token{
+		Id:     "t1",
+		Claims: jwt.Claims{Subject: "2"},
+	}))
+	assert.NoError(t, db.SaveSession(ctx, &model.Session{ID: "s1", TokenID: "t1"}))
+	assert.NoError(t, db.SaveLoginLink(ctx, &model.LoginLink{ID: "l1", UserID: "2"}))
+	assert.NoError(t, db.CreateDeviceAuthorization(ctx, &model.DeviceAuthorization{
+		ID:       "d1",
+		UserCode: "ABCDEFGH",
+		UserID:   "2",
+	}))
+	assert.NoError(t, db.RevokeTokens(ctx, "2", time.Now()))
+	assert.NoError(t, db.EraseUser(ctx, "2"))
+	assert.Equal(t, store.ErrUserNotFound, db.EraseUser(ctx, "2"))
+	tokens, err := db.GetTokensByUserId(ctx, "2")
+	assert.NoError(t, err)
+	assert.Empty(t, tokens)
+	session, err := db.GetSession(ctx, "s1")
+	assert.NoError(t, err)
+	assert.Nil(t, session)
+	link, err := db.GetLatestLoginLink(ctx, "", "2")
+	assert.NoError(t, err)
+	assert.Nil(t, link)
+	device, err := db.GetDeviceAuthorization(ctx, "d1")
+	assert.NoError(t, err)
+	assert.Nil(t, device)
+	revokedTs, err := db.GetTokensRevokedTs(ctx, "2")
+	assert.NoError(t, err)
+	assert.True(t, revokedTs.IsZero())
+}
+
+func TestDataStoreMemoryUserEmails(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreMemory()
+
+	for _, u := range []model.User{
+		{ID: "1", Email: "a@foo.com", Password: "hash"},
+		{ID: "2", Email: "b@foo.com", Password: "hash"},
+	} {
+		u := u
+		assert.NoError(t, db.CreateUser(ctx, &u))
+	}
+
+	err := db.AddUserEmail(ctx, "1", &model.UserEmail{Email: "a@bar.com"})
+	assert.NoError(t, err)
+
+	// unique among the primary and the additional emails
+	err = db.AddUserEmail(ctx, "2", &model.UserEmail{Email: "A@Bar.com"})
+	assert.Equal(t, store.ErrDuplicateEmail, err)
+	err = db.AddUserEmail(ctx, "2", &model.UserEmail{Email: "a@foo.com"})
+	assert.Equal(t, store.ErrDuplicateEmail, err)
+	err = db.UpdateUser(ctx, "2", &model.UserUpdate{Email: "a@bar.com"})
+	assert.Equal(t, store.ErrDuplicateEmail, err)
+	err = db.AddUserEmail(ctx, "3", &model.UserEmail{Email: "c@bar.com"})
+	assert.Equal(t, store.ErrUserNotFound, err)
+
+	u, err := db.GetUserByEmail(ctx, "a@bar.com")
+	assert.NoError(t, err)
+	if assert.NotNil(t, u) {
+		assert.Equal(t, "1", u.ID)
+		assert.False(t, u.Emails[0].Verified)
+	}
+
+	err = db.VerifyUserEmail(ctx, "1", "b@bar.com")
+	assert.Equal(t, store.ErrUserEmailNotFound, err)
+	err = db.VerifyUserEmail(ctx, "1", "a@bar.com")
+	assert.NoError(t, err)
+
+	// the former primary email becomes a verified additional one
+	err = db.SetPrimaryEmail(ctx, "1", "a@bar.com")
+	assert.NoError(t, err)
+	u, err = db.GetUserById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "a@bar.com", u.Email)
+	if assert.Len(t, u.Emails, 1) {
+		assert.Equal(t, "a@foo.com", u.Emails[0].Email)
+		assert.True(t, u.Emails[0].Verified)
+	}
+
+	err = db.DeleteUserEmail(ctx, "1", "a@foo.com")
+	assert.NoError(t, err)
+	err = db.DeleteUserEmail(ctx, "1", "a@foo.com")
+	assert.Equal(t, store.ErrUserEmailNotFound, err)
+
+	u, err = db.GetUserByEmail(ctx, "a@foo.com")
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+}
+
+func TestDataStoreMemoryDeleteExpiredTokens(t *testing.T) {
+	db := NewDataStoreMemory()
+	now := time.Now()
+
+	for _, ctx := range []context.Context{context.Background(), tenantContext("tenant1")} {
+		for _, token := range []jwt.Token{
+			{Id: "1", Claims: jwt.Claims{ExpiresAt: now.Add(-time.Hour).Unix()}},
+			{Id: "2", Claims: jwt.Claims{ExpiresAt: now.Add(time.Hour).Unix()}},
+			{Id: "3"},
+		} {
+			token := token
+			assert.NoError(t, db.SaveToken(ctx, &token))
+		}
+	}
+
+	n, err := db.DeleteExpiredTokens(context.Background(), now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	token, err := db.GetTokenById(tenantContext("tenant1"), "1")
+	assert.NoError(t, err)
+	assert.Nil(t, token)
+	token, err = db.GetTokenById(tenantContext("tenant1"), "3")
+	assert.NoError(t, err)
+	assert.NotNil(t, token)
+}
+
+func TestDataStoreMemoryUserLimit(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreMemory()
+
+	assert.NoError(t, db.SetLimit(ctx, &model.Limit{
+		Name:  model.LimitMaxUsers,
+		Value: 1,
+	}))
+
+	assert.NoError(t, db.CreateUser(ctx, &model.User{ID: "1", Email: "a@foo.com"}))
+	err := db.CreateUser(ctx, &model.User{ID: "2", Email: "b@foo.com"})
+	assert.Equal(t, store.ErrUserLimitReached, err)
+
+	// deleted users are restored within the limit only
+	assert.NoError(t, db.DeleteUser(ctx, "1", nil))
+	assert.NoError(t, db.CreateUser(ctx, &model.User{ID: "2", Email: "b@foo.com"}))
+	assert.Equal(t, store.ErrUserLimitReached, db.RestoreUser(ctx, "1"))
+
+	assert.NoError(t, db.DeleteUser(ctx, "2", nil))
+	assert.NoError(t, db.RestoreUser(ctx, "1"))
+}
+
+func TestDataStoreMemoryFeatures(t *testing.T) {
+	ctx := identity.WithContext(context.Background(), &identity.Identity{Tenant: "foo"})
+	db := NewDataStoreMemory()
+
+	assert.NoError(t, db.SetFeature(ctx, &model.Feature{Name: "foo", Enabled: true}))
+	assert.NoError(t, db.SetFeature(ctx, &model.Feature{Name: "bar"}))
+
+	features, err := db.GetFeatures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Feature{{Name: "bar"}, {Name: "foo", Enabled: true}}, features)
+
+	// other tenants are not affected
+	features, err = db.GetFeatures(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, features)
+
+	assert.NoError(t, db.DeleteFeature(ctx, "bar"))
+	assert.NoError(t, db.DeleteFeature(ctx, "baz"))
+
+	features, err = db.GetFeatures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Feature{{Name: "foo", Enabled: true}}, features)
+}
+
+func TestDataStoreMemoryTenantStatus(t *testing.T) {
+	ctx := tenantContext("foo")
+	db := NewDataStoreMemory()
+
+	status, err := db.GetTenantStatus(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+
+	ts := time.Now().UTC()
+	assert.NoError(t, db.SetTenantStatus(ctx, &model.TenantStatus{
+		Status:    model.TenantStatusPaymentOverdue,
+		UpdatedTs: ts,
+	}))
+
+	status, err = db.GetTenantStatus(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.TenantStatus{
+		Status:    model.TenantStatusPaymentOverdue,
+		UpdatedTs: ts,
+	}, status)
+
+	status, err = db.GetTenantStatus(tenantContext("bar"))
+	assert.NoError(t, err)
+	assert.Nil(t, status)
+}
+
+func TestDataStoreMemoryCountUsersByTenant(t *testing.T) {
+	db := NewDataStoreMemory()
+
+	recently := time.Now().Add(-time.Hour)
+	longAgo := time.Now().AddDate(0, -2, 0)
+
+	foo := identity.WithContext(context.Background(), &identity.Identity{Tenant: "foo"})
+	bar := identity.WithContext(context.Background(), &identity.Identity{Tenant: "bar"})
+	for i, u := range []struct {
+		ctx       context.Context
+		lastLogin *time.Time
+		status    string
+	}{
+		{foo, &recently, ""},
+		{foo, &longAgo, ""},
+		{foo, nil, ""},
+		{foo, &recently, model.UserStatusInactive},
+		{bar, &longAgo, ""},
+	} {
+		id := fmt.Sprintf("%d", i)
+		assert.NoError(t, db.CreateUser(u.ctx, &model.User{
+			ID:     id,
+			Email:  fmt.Sprintf("user-%d@foo.com", i),
+			Status: u.status,
+		}))
+		if u.lastLogin != nil {
+			assert.NoError(t, db.SetLastLogin(u.ctx, id, *u.lastLogin, "1.2.3.4"))
+		}
+	}
+
+	counts, err := db.CountUsersByTenant(context.Background(),
+		time.Now().Add(-model.ActiveUsersPeriod))
+	assert.NoError(t, err)
+	assert.Equal(t, []model.UserCount{
+		{TenantID: "bar", Total: 1, Active: 0},
+		{TenantID: "foo", Total: 4, Active: 1},
+	}, counts)
+}
+
+func TestDataStoreMemoryPlan(t *testing.T) {
+	ctx := identity.WithContext(context.Background(), &identity.Identity{Tenant: "foo"})
+	db := NewDataStoreMemory()
+
+	plan, err := db.GetPlan(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, plan)
+
+	assert.NoError(t, db.SetPlan(ctx, &model.Plan{Name: model.PlanOpenSource}))
+	assert.NoError(t, db.SetPlan(ctx, &model.Plan{Name: model.PlanEnterprise}))
+
+	plan, err = db.GetPlan(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Plan{Name: model.PlanEnterprise}, plan)
+
+	// other tenants are not affected
+	plan, err = db.GetPlan(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, plan)
+}
+
+func TestDataStoreMemoryGroups(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreMemory()
+
+	assert.NoError(t, db.CreateUser(ctx, &model.User{ID: "1", Email: "a@foo.com"}))
+	assert.NoError(t, db.CreateGroup(ctx, &model.Group{ID: "g2", Name: "ops"}))
+	assert.NoError(t, db.CreateGroup(ctx, &model.Group{ID: "g1", Name: "dev"}))
+	assert.Equal(t, store.ErrDuplicateGroupName,
+		db.CreateGroup(ctx, &model.Group{ID: "g3", Name: "dev"}))
+
+	groups, err := db.GetGroups(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 2)
+	assert.Equal(t, "dev", groups[0].Name)
+
+	assert.NoError(t, db.AddUserToGroup(ctx, "1", "g1"))
+	assert.NoError(t, db.AddUserToGroup(ctx, "1", "g2"))
+	assert.Equal(t, store.ErrUserNotFound, db.AddUserToGroup(ctx, "2", "g1"))
+
+	n, err := db.CountUsers(ctx, model.UserFilter{Group: "g1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.NoError(t, db.DeleteGroup(ctx, "g1"))
+	u, err := db.GetUserById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"g2"}, u.Groups)
+}
+
+func TestDataStoreMemorySettings(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreMemory()
+
+	settings, err := db.GetSettings(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, settings)
+
+	_, err = db.SaveSettings(ctx, map[string]interface{}{"foo": "bar"}, []string{"any"})
+	assert.Equal(t, store.ErrSettingsETagMismatch, err)
+
+	etag1, err := db.SaveSettings(ctx, map[string]interface{}{
+		"foo":  "bar",
+		"list": []string{"a", "b"},
+	}, nil)
+	assert.NoError(t, err)
+
+	etag2, err := db.SaveSetting(ctx, "foo", "baz", []string{etag1})
+	assert.NoError(t, err)
+
+	_, err = db.DeleteSetting(ctx, "nope", nil)
+	assert.Equal(t, store.ErrSettingNotFound, err)
+
+	settings, err = db.GetSettings(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "baz", settings["foo"])
+	assert.Equal(t, etag2, settings["etag"])
+
+	history, err := db.GetSettingsHistory(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, etag1, history[0].ETag)
+	assert.Equal(t, []interface{}{"a", "b"}, history[0].Settings["list"])
+
+	_, err = db.RollbackSettings(ctx, "nope", nil)
+	assert.Equal(t, store.ErrSettingsVersionNotFound, err)
+
+	_, err = db.RollbackSettings(ctx, etag1, nil)
+	assert.NoError(t, err)
+	settings, err = db.GetSettings(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", settings["foo"])
+
+	for i := 0; i < SettingsHistoryLength+2; i++ {
+		_, err := db.SaveSetting(ctx, "n", i, nil)
+		assert.NoError(t, err)
+	}
+	history, err = db.GetSettingsHistory(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, history, SettingsHistoryLength)
+}
+
+func TestDataStoreMemoryIdempotencyKeys(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreMemory()
+
+	testCases := map[string]struct {
+		createdTs time.Time
+		found     bool
+	}{
+		"ok": {
+			createdTs: time.Now(),
+			found:     true,
+		},
+		"expired": {
+			createdTs: time.Now().Add(-IdempotencyTTL - time.Minute),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			assert.NoError(t, db.CreateIdempotencyKey(ctx, &model.IdempotencyKey{
+				Key:       name,
+				Email:     "a@foo.com",
+				CreatedTs: tc.createdTs,
+			}))
+			assert.NoError(t, db.SetIdempotencyKeyUser(ctx, name, "1"))
+
+			k, err := db.GetIdempotencyKey(ctx, name)
+			assert.NoError(t, err)
+			if tc.found {
+				assert.Equal(t, "1", k.UserID)
+				assert.Equal(t, store.ErrDuplicateIdempotencyKey,
+					db.CreateIdempotencyKey(ctx, &model.IdempotencyKey{Key: name}))
+			} else {
+				assert.Nil(t, k)
+			}
+		})
+	}
+}
+
+func TestDataStoreMemoryPendingUsers(t *testing.T) {
+	db := NewDataStoreMemory()
+	now := time.Now()
+
+	assert.NoError(t, db.CreatePendingUser(tenantContext("tenant1"), &model.PendingUser{
+		UserID:    "1",
+		TenantID:  "tenant1",
+		CreatedTs: now.Add(-time.Hour),
+	}))
+	assert.NoError(t, db.CreatePendingUser(tenantContext("tenant2"), &model.PendingUser{
+		UserID:    "2",
+		TenantID:  "tenant2",
+		CreatedTs: now,
+	}))
+
+	pending, err := db.GetPendingUsers(context.Background(), now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "1", pending[0].UserID)
+	assert.Equal(t, "tenant1", pending[0].TenantID)
+
+	assert.NoError(t, db.DeletePendingUser(tenantContext("tenant1"), "1"))
+	pending, err = db.GetPendingUsers(context.Background(), now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "2", pending[0].UserID)
+}
+
+func TestDataStoreMemoryTenants(t *testing.T) {
+	db := NewDataStoreMemory()
+
+	ctx := tenantContext("tenant1")
+	expiresAt := time.Now().Add(-time.Minute)
+	assert.NoError(t, db.CreateUser(ctx, &model.User{
+		ID:        "1",
+		Email:     "a@foo.com",
+		ExpiresAt: &expiresAt,
+	}))
+
+	assert.NoError(t, db.DisableExpiredUsers(context.Background(), time.Now()))
+	u, err := db.GetUserById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, model.UserStatusInactive, u.Status)
+
+	assert.Error(t, db.DeleteTenant(ctx, ""))
+	assert.NoError(t, db.DeleteTenant(ctx, "tenant1"))
+	u, err = db.GetUserById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Nil(t, u)
+}
+
+func TestDataStoreMemoryTokenRevocations(t *testing.T) {
+	db := NewDataStoreMemory()
+
+	ctx := tenantContext("tenant1")
+	now := time.Now()
+
+	assert.NoError(t, db.RevokeTokens(ctx, "", now))
+	assert.NoError(t, db.RevokeTokens(ctx, "1", now.Add(-time.Hour)))
+	ts, err := db.GetTokensRevokedTs(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, now, ts)
+	ts, err = db.GetTokensRevokedTs(tenantContext("tenant2"), "1")
+	assert.NoError(t, err)
+	assert.True(t, ts.IsZero())
+
+	assert.NoError(t, db.SaveTokenRevocation(ctx, &model.TokenRevocation{
+		ID:        "1",
+		Status:    model.RevocationStatusPending,
+		CreatedTs: now,
+	}))
+	r, err := db.ClaimTokenRevocation(ctx, now, now.Add(-time.Minute))
+	assert.NoError(t, err)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, model.RevocationStatusRunning, r.Status)
+	}
+	r, err = db.ClaimTokenRevocation(ctx, now, now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	r, err = db.GetTokenRevocation(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, model.RevocationStatusRunning, r.Status)
+}
+
+func TestDataStoreMemoryOAuthClients(t *testing.T) {
+	foo := tenantContext("foo")
+	bar := tenantContext("bar")
+	db := NewDataStoreMemory()
+
+	ts := time.Now().UTC()
+	assert.NoError(t, db.CreateOAuthClient(foo, &model.OAuthClient{
+		ID:        "1",
+		Name:      "ci",
+		CreatedTs: ts,
+	}))
+	assert.NoError(t, db.CreateOAuthClient(foo, &model.OAuthClient{
+		ID:        "2",
+		Name:      "backup",
+		CreatedTs: ts.Add(time.Second),
+	}))
+
+	// looked up across the tenants
+	client, err := db.GetOAuthClientById(bar, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", client.TenantID)
+
+	client, err = db.GetOAuthClientById(foo, "3")
+	assert.NoError(t, err)
+	assert.Nil(t, client)
+
+	clients, err := db.GetOAuthClients(foo)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 2)
+	assert.Equal(t, "1", clients[0].ID)
+	assert.Equal(t, "2", clients[1].ID)
+
+	clients, err = db.GetOAuthClients(bar)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 0)
+
+	assert.Equal(t, store.ErrOAuthClientNotFound, db.DeleteOAuthClient(bar, "1"))
+	assert.NoError(t, db.DeleteOAuthClient(foo, "1"))
+	assert.Equal(t, store.ErrOAuthClientNotFound, db.DeleteOAuthClient(foo, "1"))
+}
+
+func TestDataStoreMemoryOAuthCodes(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreMemory()
+
+	code := &model.OAuthCode{
+		ID:        "hash",
+		ClientID:  "client-1",
+		TenantID:  "foo",
+		UserID:    "user-1",
+		ExpiresTs: time.Now().Add(time.Minute),
+	}
+	assert.NoError(t, db.SaveOAuthCode(ctx, code))
+
+	// a code can only be taken once
+	taken, err := db.TakeOAuthCode(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, code, taken)
+
+	taken, err = db.TakeOAuthCode(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, taken)
+}
+
+func TestDataStoreMemoryDeviceAuthorizations(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreMemory()
+
+	a := &model.DeviceAuthorization{
+		ID:        "hash",
+		UserCode:  "BCDFGHJK",
+		ClientID:  "mender-cli",
+		Status:    model.DeviceAuthorizationPending,
+		Interval:  5,
+		ExpiresTs: time.Now().Add(time.Minute),
+	}
+	assert.NoError(t, db.CreateDeviceAuthorization(ctx, a))
+	assert.Equal(t, store.ErrDuplicateUserCode, db.CreateDeviceAuthorization(ctx,
+		&model.DeviceAuthorization{ID: "other", UserCode: "BCDFGHJK"}))
+
+	found, err := db.GetDeviceAuthorizationByUserCode(ctx, "BCDFGHJK")
+	assert.NoError(t, err)
+	assert.Equal(t, a, found)
+
+	ts := time.Now().UTC()
+	assert.NoError(t, db.SetDeviceAuthorizationPolled(ctx, "hash", ts, 10))
+
+	r := model.DeviceAuthorizationResolution{
+		Status:   model.DeviceAuthorizationApproved,
+		TenantID: "foo",
+		UserID:   "user-1",
+		Scope:    "mender.*",
+	}
+	assert.NoError(t, db.ResolveDeviceAuthorization(ctx, "hash", r))
+	// decided only once
+	assert.Equal(t, store.ErrDeviceAuthorizationNotFound,
+		db.ResolveDeviceAuthorization(ctx, "hash", r))
+
+	found, err = db.GetDeviceAuthorization(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, model.DeviceAuthorizationApproved, found.Status)
+	assert.Equal(t, "foo", found.TenantID)
+	assert.Equal(t, "user-1", found.UserID)
+	assert.Equal(t, "mender.*", found.Scope)
+	assert.Equal(t, ts, found.PolledTs)
+	assert.Equal(t, 10, found.Interval)
+
+	assert.NoError(t, db.DeleteDeviceAuthorization(ctx, "hash"))
+	assert.Equal(t, store.ErrDeviceAuthorizationNotFound,
+		db.DeleteDeviceAuthorization(ctx, "hash"))
+
+	found, err = db.GetDeviceAuthorization(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+}
+
+func TestDataStoreMemoryLoginLinks(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreMemory()
+
+	link := &model.LoginLink{
+		ID:        "hash",
+		TenantID:  "foo",
+		UserID:    "user-1",
+		Email:     "foo@bar.com",
+		CreatedTs: time.Now().Add(-time.Second),
+		ExpiresTs: time.Now().Add(time.Minute),
+	}
+	assert.NoError(t, db.SaveLoginLink(ctx, link))
+	latest := *link
+	latest.ID = "latest"
+	latest.CreatedTs = time.Now()
+	assert.NoError(t, db.SaveLoginLink(ctx, &latest))
+
+	found, err := db.GetLatestLoginLink(ctx, "foo", "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, &latest, found)
+	found, err = db.GetLatestLoginLink(ctx, "bar", "user-1")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+
+	// a link can only be taken once
+	taken, err := db.TakeLoginLink(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, link, taken)
+
+	taken, err = db.TakeLoginLink(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, taken)
+}
+
+func TestDataStoreMemorySessions(t *testing.T) {
+	ctx := context.Background()
+	db := NewDataStoreMemory()
+
+	s := &model.Session{
+		ID:        "hash",
+		TenantID:  "foo",
+		TokenID:   "token-1",
+		ExpiresTs: time.Now().Add(time.Hour),
+	}
+	assert.NoError(t, db.SaveSession(ctx, s))
+
+	found, err := db.GetSession(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, s, found)
+
+	found, err = db.GetSession(ctx, "other")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+}
+
+func TestDataStoreMemoryLoginOTPs(t *testing.T) {
+	ctx := tenantContext("foo")
+	db := NewDataStoreMemory()
+
+	otp := &model.LoginOTP{
+		UserID:    "user-1",
+		Code:      "hash",
+		Channel:   model.SecondFactorEmail,
+		ExpiresTs: time.Now().Add(time.Minute),
+	}
+	assert.NoError(t, db.SaveLoginOTP(ctx, otp))
+
+	found, err := db.GetLoginOTP(ctx, "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, otp, found)
+
+	// kept apart from the other tenants
+	found, err = db.GetLoginOTP(tenantContext("bar"), "user-1")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+
+	// the code is returned as it was before the attempt
+	for i := 0; i < model.MaxLoginOTPAttempts; i++ {
+		found, err = db.TakeLoginOTPAttempt(ctx, "user-1", time.Now())
+		assert.NoError(t, err)
+		if assert.NotNil(t, found) {
+			assert.Equal(t, i, found.Attempts)
+		}
+	}
+	found, err = db.TakeLoginOTPAttempt(ctx, "user-1", time.Now())
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+	found, err = db.GetLoginOTP(ctx, "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, model.MaxLoginOTPAttempts, found.Attempts)
+
+	// a new code replaces the previous one
+	otp.Code = "other"
+	assert.NoError(t, db.SaveLoginOTP(ctx, otp))
+	found, err = db.GetLoginOTP(ctx, "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, "other", found.Code)
+	assert.Equal(t, 0, found.Attempts)
+
+	assert.NoError(t, db.DeleteLoginOTP(ctx, "user-1"))
+	assert.Equal(t, store.ErrLoginOTPNotFound, db.DeleteLoginOTP(ctx, "user-1"))
+
+	// expired, or gone
+	assert.NoError(t, db.SaveLoginOTP(ctx, otp))
+	found, err = db.TakeLoginOTPAttempt(ctx, "user-1", otp.ExpiresTs)
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+	assert.NoError(t, db.DeleteLoginOTP(ctx, "user-1"))
+	found, err = db.TakeLoginOTPAttempt(ctx, "user-1", time.Now())
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+}
+
+func TestDataStoreMemoryServiceAccounts(t *testing.T) {
+	ctx := tenantContext("foo")
+	db := NewDataStoreMemory()
+
+	ts := time.Now().UTC()
+	assert.NoError(t, db.CreateServiceAccount(ctx, &model.ServiceAccount{
+		ID:        "1",
+		Name:      "deploy",
+		Scope:     "mender.*",
+		Owner:     "user-1",
+		CreatedTs: ts,
+		UpdatedTs: ts,
+	}))
+	assert.NoError(t, db.CreateServiceAccount(ctx, &model.ServiceAccount{
+		ID:   "2",
+		Name: "backup",
+	}))
+	assert.Equal(t, store.ErrDuplicateServiceAccountName,
+		db.CreateServiceAccount(ctx, &model.ServiceAccount{ID: "3", Name: "deploy"}))
+
+	accounts, err := db.GetServiceAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 2)
+	assert.Equal(t, "backup", accounts[0].Name)
+	assert.Equal(t, "deploy", accounts[1].Name)
+
+	accounts, err = db.GetServiceAccounts(tenantContext("bar"))
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 0)
+
+	scope := "mender.users:read"
+	account, err := db.UpdateServiceAccount(ctx, "1",
+		&model.ServiceAccountUpdate{Scope: &scope})
+	assert.NoError(t, err)
+	assert.Equal(t, scope, account.Scope)
+	assert.Equal(t, "user-1", account.Owner)
+	assert.False(t, account.UpdatedTs.Before(ts))
+
+	account, err = db.GetServiceAccountById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, scope, account.Scope)
+
+	_, err = db.UpdateServiceAccount(ctx, "3", &model.ServiceAccountUpdate{})
+	assert.Equal(t, store.ErrServiceAccountNotFound, err)
+
+	assert.NoError(t, db.DeleteServiceAccount(ctx, "1"))
+	assert.Equal(t, store.ErrServiceAccountNotFound, db.DeleteServiceAccount(ctx, "1"))
+
+	account, err = db.GetServiceAccountById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Nil(t, account)
+}
@@ -0,0 +1,35 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package memory
+
+import (
+	"github.com/mendersoftware/useradm/store"
+)
+
+const DriverName = "memory"
+
+func init() {
+	if err := store.Register(DriverName, Driver{}); err != nil {
+		panic(err)
+	}
+}
+
+// Driver opens a new, empty in-memory datastore; the data source name
+// is not used
+type Driver struct{}
+
+func (Driver) Open(dsn string) (store.DataStore, store.TenantDataKeeper, error) {
+	db := NewDataStoreMemory()
+	return db, db, nil
+}
@@ -17,19 +17,1383 @@ import context "context"
 import jwt "github.com/mendersoftware/useradm/jwt"
 import mock "github.com/stretchr/testify/mock"
 import model "github.com/mendersoftware/useradm/model"
+import time "time"
 
 // DataStore is an autogenerated mock type for the DataStore type
 type DataStore struct {
 	mock.Mock
 }
 
+// AcquireJobLease provides a mock function with given fields: ctx, name, holder, until
+func (_m *DataStore) AcquireJobLease(ctx context.Context, name string, holder string, until time.Time) (bool, error) {
+	ret := _m.Called(ctx, name, holder, until)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, time.Time) bool); ok {
+		r0 = rf(ctx, name, holder, until)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, time.Time) error); ok {
+		r1 = rf(ctx, name, holder, until)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AddUserEmail provides a mock function with given fields: ctx, id, e
+func (_m *DataStore) AddUserEmail(ctx context.Context, id string, e *model.UserEmail) error {
+	ret := _m.Called(ctx, id, e)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, *model.UserEmail) error); ok {
+		r0 = rf(ctx, id, e)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AddUserToGroup provides a mock function with given fields: ctx, userID, groupID
+func (_m *DataStore) AddUserToGroup(ctx context.Context, userID string, groupID string) error {
+	ret := _m.Called(ctx, userID, groupID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, userID, groupID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ClaimTokenRevocation provides a mock function with given fields: ctx, now, staleBefore
+func (_m *DataStore) ClaimTokenRevocation(ctx context.Context, now time.Time, staleBefore time.Time) (*model.TokenRevocation, error) {
+	ret := _m.Called(ctx, now, staleBefore)
+
+	var r0 *model.TokenRevocation
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time, time.Time) *model.TokenRevocation); ok {
+		r0 = rf(ctx, now, staleBefore)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.TokenRevocation)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time, time.Time) error); ok {
+		r1 = rf(ctx, now, staleBefore)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountUsers provides a mock function with given fields: ctx, fltr
+func (_m *DataStore) CountUsers(ctx context.Context, fltr model.UserFilter) (int, error) {
+	ret := _m.Called(ctx, fltr)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, model.UserFilter) int); ok {
+		r0 = rf(ctx, fltr)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.UserFilter) error); ok {
+		r1 = rf(ctx, fltr)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CountUsersByTenant provides a mock function with given fields: ctx, activeSince
+func (_m *DataStore) CountUsersByTenant(ctx context.Context, activeSince time.Time) ([]model.UserCount, error) {
+	ret := _m.Called(ctx, activeSince)
+
+	var r0 []model.UserCount
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) []model.UserCount); ok {
+		r0 = rf(ctx, activeSince)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.UserCount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, activeSince)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateDeviceAuthorization provides a mock function with given fields: ctx, a
+func (_m *DataStore) CreateDeviceAuthorization(ctx context.Context, a *model.DeviceAuthorization) error {
+	ret := _m.Called(ctx, a)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.DeviceAuthorization) error); ok {
+		r0 = rf(ctx, a)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateGroup provides a mock function with given fields: ctx, g
+func (_m *DataStore) CreateGroup(ctx context.Context, g *model.Group) error {
+	ret := _m.Called(ctx, g)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Group) error); ok {
+		r0 = rf(ctx, g)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateIdempotencyKey provides a mock function with given fields: ctx, k
+func (_m *DataStore) CreateIdempotencyKey(ctx context.Context, k *model.IdempotencyKey) error {
+	ret := _m.Called(ctx, k)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.IdempotencyKey) error); ok {
+		r0 = rf(ctx, k)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateOAuthClient provides a mock function with given fields: ctx, c
+func (_m *DataStore) CreateOAuthClient(ctx context.Context, c *model.OAuthClient) error {
+	ret := _m.Called(ctx, c)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.OAuthClient) error); ok {
+		r0 = rf(ctx, c)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreatePendingUser provides a mock function with given fields: ctx, p
+func (_m *DataStore) CreatePendingUser(ctx context.Context, p *model.PendingUser) error {
+	ret := _m.Called(ctx, p)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.PendingUser) error); ok {
+		r0 = rf(ctx, p)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateServiceAccount provides a mock function with given fields: ctx, a
+func (_m *DataStore) CreateServiceAccount(ctx context.Context, a *model.ServiceAccount) error {
+	ret := _m.Called(ctx, a)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.ServiceAccount) error); ok {
+		r0 = rf(ctx, a)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // CreateUser provides a mock function with given fields: ctx, u
 func (_m *DataStore) CreateUser(ctx context.Context, u *model.User) error {
 	ret := _m.Called(ctx, u)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, *model.User) error); ok {
-		r0 = rf(ctx, u)
+	if rf, ok := ret.Get(0).(func(context.Context, *model.User) error); ok {
+		r0 = rf(ctx, u)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteDeviceAuthorization provides a mock function with given fields: ctx, id
+func (_m *DataStore) DeleteDeviceAuthorization(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteExpiredTokens provides a mock function with given fields: ctx, now
+func (_m *DataStore) DeleteExpiredTokens(ctx context.Context, now time.Time) (int, error) {
+	ret := _m.Called(ctx, now)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) int); ok {
+		r0 = rf(ctx, now)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, now)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteFeature provides a mock function with given fields: ctx, name
+func (_m *DataStore) DeleteFeature(ctx context.Context, name string) error {
+	ret := _m.Called(ctx, name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteGroup provides a mock function with given fields: ctx, id
+func (_m *DataStore) DeleteGroup(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteIdempotencyKey provides a mock function with given fields: ctx, key
+func (_m *DataStore) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	ret := _m.Called(ctx, key)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, key)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteLoginOTP provides a mock function with given fields: ctx, userID
+func (_m *DataStore) DeleteLoginOTP(ctx context.Context, userID string) error {
+	ret := _m.Called(ctx, userID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteOAuthClient provides a mock function with given fields: ctx, id
+func (_m *DataStore) DeleteOAuthClient(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeletePendingUser provides a mock function with given fields: ctx, userID
+func (_m *DataStore) DeletePendingUser(ctx context.Context, userID string) error {
+	ret := _m.Called(ctx, userID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteServiceAccount provides a mock function with given fields: ctx, id
+func (_m *DataStore) DeleteServiceAccount(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteSetting provides a mock function with given fields: ctx, key, ifMatch
+func (_m *DataStore) DeleteSetting(ctx context.Context, key string, ifMatch []string) (string, error) {
+	ret := _m.Called(ctx, key, ifMatch)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) string); ok {
+		r0 = rf(ctx, key, ifMatch)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string) error); ok {
+		r1 = rf(ctx, key, ifMatch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteSettingsSchema provides a mock function with given fields: ctx
+func (_m *DataStore) DeleteSettingsSchema(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteTokens provides a mock function with given fields: ctx
+func (_m *DataStore) DeleteTokens(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteTokensByUserId provides a mock function with given fields: ctx, userId
+func (_m *DataStore) DeleteTokensByUserId(ctx context.Context, userId string) error {
+	ret := _m.Called(ctx, userId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, userId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUser provides a mock function with given fields: ctx, id, ifMatch
+func (_m *DataStore) DeleteUser(ctx context.Context, id string, ifMatch []string) error {
+	ret := _m.Called(ctx, id, ifMatch)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) error); ok {
+		r0 = rf(ctx, id, ifMatch)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUserEmail provides a mock function with given fields: ctx, id, email
+func (_m *DataStore) DeleteUserEmail(ctx context.Context, id string, email string) error {
+	ret := _m.Called(ctx, id, email)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, id, email)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DisableExpiredUsers provides a mock function with given fields: ctx, now
+func (_m *DataStore) DisableExpiredUsers(ctx context.Context, now time.Time) error {
+	ret := _m.Called(ctx, now)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) error); ok {
+		r0 = rf(ctx, now)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// EraseUser provides a mock function with given fields: ctx, id
+func (_m *DataStore) EraseUser(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ForEachUser provides a mock function with given fields: ctx, fltr, fn
+func (_m *DataStore) ForEachUser(ctx context.Context, fltr model.UserFilter, fn func(u *model.User) error) error {
+	ret := _m.Called(ctx, fltr, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.UserFilter, func(u *model.User) error) error); ok {
+		r0 = rf(ctx, fltr, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetDeviceAuthorization provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetDeviceAuthorization(ctx context.Context, id string) (*model.DeviceAuthorization, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.DeviceAuthorization
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.DeviceAuthorization); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeviceAuthorization)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetDeviceAuthorizationByUserCode provides a mock function with given fields: ctx, userCode
+func (_m *DataStore) GetDeviceAuthorizationByUserCode(ctx context.Context, userCode string) (*model.DeviceAuthorization, error) {
+	ret := _m.Called(ctx, userCode)
+
+	var r0 *model.DeviceAuthorization
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.DeviceAuthorization); ok {
+		r0 = rf(ctx, userCode)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeviceAuthorization)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userCode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFeatures provides a mock function with given fields: ctx
+func (_m *DataStore) GetFeatures(ctx context.Context) ([]model.Feature, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.Feature
+	if rf, ok := ret.Get(0).(func(context.Context) []model.Feature); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Feature)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroupById provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetGroupById(ctx context.Context, id string) (*model.Group, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.Group
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Group); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Group)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroups provides a mock function with given fields: ctx
+func (_m *DataStore) GetGroups(ctx context.Context) ([]model.Group, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.Group
+	if rf, ok := ret.Get(0).(func(context.Context) []model.Group); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Group)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroupsByIds provides a mock function with given fields: ctx, ids
+func (_m *DataStore) GetGroupsByIds(ctx context.Context, ids []string) ([]model.Group, error) {
+	ret := _m.Called(ctx, ids)
+
+	var r0 []model.Group
+	if rf, ok := ret.Get(0).(func(context.Context, []string) []model.Group); ok {
+		r0 = rf(ctx, ids)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Group)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []string) error); ok {
+		r1 = rf(ctx, ids)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetIdempotencyKey provides a mock function with given fields: ctx, key
+func (_m *DataStore) GetIdempotencyKey(ctx context.Context, key string) (*model.IdempotencyKey, error) {
+	ret := _m.Called(ctx, key)
+
+	var r0 *model.IdempotencyKey
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.IdempotencyKey); ok {
+		r0 = rf(ctx, key)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.IdempotencyKey)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, key)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJobStatuses provides a mock function with given fields: ctx
+func (_m *DataStore) GetJobStatuses(ctx context.Context) ([]model.JobStatus, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.JobStatus
+	if rf, ok := ret.Get(0).(func(context.Context) []model.JobStatus); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.JobStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLatestLoginLink provides a mock function with given fields: ctx, tenantID, userID
+func (_m *DataStore) GetLatestLoginLink(ctx context.Context, tenantID string, userID string) (*model.LoginLink, error) {
+	ret := _m.Called(ctx, tenantID, userID)
+
+	var r0 *model.LoginLink
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *model.LoginLink); ok {
+		r0 = rf(ctx, tenantID, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.LoginLink)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, tenantID, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLimit provides a mock function with given fields: ctx, name
+func (_m *DataStore) GetLimit(ctx context.Context, name string) (*model.Limit, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 *model.Limit
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Limit); ok {
+		r0 = rf(ctx, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Limit)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLoginEvents provides a mock function with given fields: ctx, userID
+func (_m *DataStore) GetLoginEvents(ctx context.Context, userID string) ([]model.LoginEvent, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 []model.LoginEvent
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.LoginEvent); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.LoginEvent)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLoginOTP provides a mock function with given fields: ctx, userID
+func (_m *DataStore) GetLoginOTP(ctx context.Context, userID string) (*model.LoginOTP, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 *model.LoginOTP
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.LoginOTP); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.LoginOTP)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetMaintenance provides a mock function with given fields: ctx
+func (_m *DataStore) GetMaintenance(ctx context.Context) (*model.MaintenanceState, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.MaintenanceState
+	if rf, ok := ret.Get(0).(func(context.Context) *model.MaintenanceState); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.MaintenanceState)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOAuthClientById provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetOAuthClientById(ctx context.Context, id string) (*model.OAuthClient, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.OAuthClient
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.OAuthClient); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.OAuthClient)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOAuthClients provides a mock function with given fields: ctx
+func (_m *DataStore) GetOAuthClients(ctx context.Context) ([]model.OAuthClient, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.OAuthClient
+	if rf, ok := ret.Get(0).(func(context.Context) []model.OAuthClient); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.OAuthClient)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPendingUsers provides a mock function with given fields: ctx, before
+func (_m *DataStore) GetPendingUsers(ctx context.Context, before time.Time) ([]model.PendingUser, error) {
+	ret := _m.Called(ctx, before)
+
+	var r0 []model.PendingUser
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) []model.PendingUser); ok {
+		r0 = rf(ctx, before)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.PendingUser)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, time.Time) error); ok {
+		r1 = rf(ctx, before)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPlan provides a mock function with given fields: ctx
+func (_m *DataStore) GetPlan(ctx context.Context) (*model.Plan, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.Plan
+	if rf, ok := ret.Get(0).(func(context.Context) *model.Plan); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Plan)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetServiceAccountById provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetServiceAccountById(ctx context.Context, id string) (*model.ServiceAccount, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.ServiceAccount
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.ServiceAccount); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.ServiceAccount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetServiceAccounts provides a mock function with given fields: ctx
+func (_m *DataStore) GetServiceAccounts(ctx context.Context) ([]model.ServiceAccount, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.ServiceAccount
+	if rf, ok := ret.Get(0).(func(context.Context) []model.ServiceAccount); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ServiceAccount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSession provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.Session
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Session); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Session)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSettings provides a mock function with given fields: ctx
+func (_m *DataStore) GetSettings(ctx context.Context) (map[string]interface{}, error) {
+	ret := _m.Called(ctx)
+
+	var r0 map[string]interface{}
+	if rf, ok := ret.Get(0).(func(context.Context) map[string]interface{}); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]interface{})
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSettingsHistory provides a mock function with given fields: ctx
+func (_m *DataStore) GetSettingsHistory(ctx context.Context) ([]model.SettingsVersion, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.SettingsVersion
+	if rf, ok := ret.Get(0).(func(context.Context) []model.SettingsVersion); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.SettingsVersion)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSettingsSchema provides a mock function with given fields: ctx
+func (_m *DataStore) GetSettingsSchema(ctx context.Context) (string, error) {
+	ret := _m.Called(ctx)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context) string); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTenantStatus provides a mock function with given fields: ctx
+func (_m *DataStore) GetTenantStatus(ctx context.Context) (*model.TenantStatus, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.TenantStatus
+	if rf, ok := ret.Get(0).(func(context.Context) *model.TenantStatus); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.TenantStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTokenById provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetTokenById(ctx context.Context, id string) (*jwt.Token, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *jwt.Token
+	if rf, ok := ret.Get(0).(func(context.Context, string) *jwt.Token); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*jwt.Token)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTokenRevocation provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetTokenRevocation(ctx context.Context, id string) (*model.TokenRevocation, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.TokenRevocation
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.TokenRevocation); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.TokenRevocation)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTokensByUserId provides a mock function with given fields: ctx, userId
+func (_m *DataStore) GetTokensByUserId(ctx context.Context, userId string) ([]jwt.Token, error) {
+	ret := _m.Called(ctx, userId)
+
+	var r0 []jwt.Token
+	if rf, ok := ret.Get(0).(func(context.Context, string) []jwt.Token); ok {
+		r0 = rf(ctx, userId)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]jwt.Token)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTokensRevokedTs provides a mock function with given fields: ctx, userId
+func (_m *DataStore) GetTokensRevokedTs(ctx context.Context, userId string) (time.Time, error) {
+	ret := _m.Called(ctx, userId)
+
+	var r0 time.Time
+	if rf, ok := ret.Get(0).(func(context.Context, string) time.Time); ok {
+		r0 = rf(ctx, userId)
+	} else {
+		r0 = ret.Get(0).(time.Time)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userId)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserByEmail provides a mock function with given fields: ctx, email
+func (_m *DataStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	ret := _m.Called(ctx, email)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = rf(ctx, email)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, email)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserById provides a mock function with given fields: ctx, id
+func (_m *DataStore) GetUserById(ctx context.Context, id string) (*model.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserByUsername provides a mock function with given fields: ctx, username
+func (_m *DataStore) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	ret := _m.Called(ctx, username)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = rf(ctx, username)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, username)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserSettings provides a mock function with given fields: ctx, userID
+func (_m *DataStore) GetUserSettings(ctx context.Context, userID string) (map[string]interface{}, error) {
+	ret := _m.Called(ctx, userID)
+
+	var r0 map[string]interface{}
+	if rf, ok := ret.Get(0).(func(context.Context, string) map[string]interface{}); ok {
+		r0 = rf(ctx, userID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]interface{})
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUsers provides a mock function with given fields: ctx, fltr
+func (_m *DataStore) GetUsers(ctx context.Context, fltr model.UserFilter) ([]model.User, error) {
+	ret := _m.Called(ctx, fltr)
+
+	var r0 []model.User
+	if rf, ok := ret.Get(0).(func(context.Context, model.UserFilter) []model.User); ok {
+		r0 = rf(ctx, fltr)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.UserFilter) error); ok {
+		r1 = rf(ctx, fltr)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUsersVersion provides a mock function with given fields: ctx, fltr
+func (_m *DataStore) GetUsersVersion(ctx context.Context, fltr model.UserFilter) (*model.UsersVersion, error) {
+	ret := _m.Called(ctx, fltr)
+
+	var r0 *model.UsersVersion
+	if rf, ok := ret.Get(0).(func(context.Context, model.UserFilter) *model.UsersVersion); ok {
+		r0 = rf(ctx, fltr)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.UsersVersion)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.UserFilter) error); ok {
+		r1 = rf(ctx, fltr)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IncFailedLogins provides a mock function with given fields: ctx, id
+func (_m *DataStore) IncFailedLogins(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// PurgeDeletedUsers provides a mock function with given fields: ctx, before
+func (_m *DataStore) PurgeDeletedUsers(ctx context.Context, before time.Time) error {
+	ret := _m.Called(ctx, before)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, time.Time) error); ok {
+		r0 = rf(ctx, before)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RemoveUserFromGroup provides a mock function with given fields: ctx, userID, groupID
+func (_m *DataStore) RemoveUserFromGroup(ctx context.Context, userID string, groupID string) error {
+	ret := _m.Called(ctx, userID, groupID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, userID, groupID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ResolveDeviceAuthorization provides a mock function with given fields: ctx, id, r
+func (_m *DataStore) ResolveDeviceAuthorization(ctx context.Context, id string, r model.DeviceAuthorizationResolution) error {
+	ret := _m.Called(ctx, id, r)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.DeviceAuthorizationResolution) error); ok {
+		r0 = rf(ctx, id, r)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RestoreUser provides a mock function with given fields: ctx, id
+func (_m *DataStore) RestoreUser(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeTokens provides a mock function with given fields: ctx, userId, ts
+func (_m *DataStore) RevokeTokens(ctx context.Context, userId string, ts time.Time) error {
+	ret := _m.Called(ctx, userId, ts)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) error); ok {
+		r0 = rf(ctx, userId, ts)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RollbackSettings provides a mock function with given fields: ctx, etag, ifMatch
+func (_m *DataStore) RollbackSettings(ctx context.Context, etag string, ifMatch []string) (string, error) {
+	ret := _m.Called(ctx, etag, ifMatch)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) string); ok {
+		r0 = rf(ctx, etag, ifMatch)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string) error); ok {
+		r1 = rf(ctx, etag, ifMatch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SaveJobRun provides a mock function with given fields: ctx, run
+func (_m *DataStore) SaveJobRun(ctx context.Context, run *model.JobRun) error {
+	ret := _m.Called(ctx, run)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.JobRun) error); ok {
+		r0 = rf(ctx, run)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -37,13 +1401,13 @@ func (_m *DataStore) CreateUser(ctx context.Context, u *model.User) error {
 	return r0
 }
 
-// DeleteTokens provides a mock function with given fields: ctx
-func (_m *DataStore) DeleteTokens(ctx context.Context) error {
-	ret := _m.Called(ctx)
+// SaveLoginEvent provides a mock function with given fields: ctx, event
+func (_m *DataStore) SaveLoginEvent(ctx context.Context, event *model.LoginEvent) error {
+	ret := _m.Called(ctx, event)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
-		r0 = rf(ctx)
+	if rf, ok := ret.Get(0).(func(context.Context, *model.LoginEvent) error); ok {
+		r0 = rf(ctx, event)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -51,13 +1415,13 @@ func (_m *DataStore) DeleteTokens(ctx context.Context) error {
 	return r0
 }
 
-// DeleteTokensByUserId provides a mock function with given fields: ctx, userId
-func (_m *DataStore) DeleteTokensByUserId(ctx context.Context, userId string) error {
-	ret := _m.Called(ctx, userId)
+// SaveLoginLink provides a mock function with given fields: ctx, l
+func (_m *DataStore) SaveLoginLink(ctx context.Context, l *model.LoginLink) error {
+	ret := _m.Called(ctx, l)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, userId)
+	if rf, ok := ret.Get(0).(func(context.Context, *model.LoginLink) error); ok {
+		r0 = rf(ctx, l)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -65,13 +1429,13 @@ func (_m *DataStore) DeleteTokensByUserId(ctx context.Context, userId string) er
 	return r0
 }
 
-// DeleteUser provides a mock function with given fields: ctx, id
-func (_m *DataStore) DeleteUser(ctx context.Context, id string) error {
-	ret := _m.Called(ctx, id)
+// SaveLoginOTP provides a mock function with given fields: ctx, otp
+func (_m *DataStore) SaveLoginOTP(ctx context.Context, otp *model.LoginOTP) error {
+	ret := _m.Called(ctx, otp)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
-		r0 = rf(ctx, id)
+	if rf, ok := ret.Get(0).(func(context.Context, *model.LoginOTP) error); ok {
+		r0 = rf(ctx, otp)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -79,22 +1443,62 @@ func (_m *DataStore) DeleteUser(ctx context.Context, id string) error {
 	return r0
 }
 
-// GetSettings provides a mock function with given fields: ctx
-func (_m *DataStore) GetSettings(ctx context.Context) (map[string]interface{}, error) {
-	ret := _m.Called(ctx)
+// SaveMaintenance provides a mock function with given fields: ctx, s
+func (_m *DataStore) SaveMaintenance(ctx context.Context, s *model.MaintenanceState) error {
+	ret := _m.Called(ctx, s)
 
-	var r0 map[string]interface{}
-	if rf, ok := ret.Get(0).(func(context.Context) map[string]interface{}); ok {
-		r0 = rf(ctx)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.MaintenanceState) error); ok {
+		r0 = rf(ctx, s)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(map[string]interface{})
-		}
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveOAuthCode provides a mock function with given fields: ctx, c
+func (_m *DataStore) SaveOAuthCode(ctx context.Context, c *model.OAuthCode) error {
+	ret := _m.Called(ctx, c)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.OAuthCode) error); ok {
+		r0 = rf(ctx, c)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveSession provides a mock function with given fields: ctx, s
+func (_m *DataStore) SaveSession(ctx context.Context, s *model.Session) error {
+	ret := _m.Called(ctx, s)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Session) error); ok {
+		r0 = rf(ctx, s)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveSetting provides a mock function with given fields: ctx, key, value, ifMatch
+func (_m *DataStore) SaveSetting(ctx context.Context, key string, value interface{}, ifMatch []string) (string, error) {
+	ret := _m.Called(ctx, key, value, ifMatch)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, interface{}, []string) string); ok {
+		r0 = rf(ctx, key, value, ifMatch)
+	} else {
+		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
+	if rf, ok := ret.Get(1).(func(context.Context, string, interface{}, []string) error); ok {
+		r1 = rf(ctx, key, value, ifMatch)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -102,16 +1506,205 @@ func (_m *DataStore) GetSettings(ctx context.Context) (map[string]interface{}, e
 	return r0, r1
 }
 
-// GetTokenById provides a mock function with given fields: ctx, id
-func (_m *DataStore) GetTokenById(ctx context.Context, id string) (*jwt.Token, error) {
+// SaveSettings provides a mock function with given fields: ctx, s, ifMatch
+func (_m *DataStore) SaveSettings(ctx context.Context, s map[string]interface{}, ifMatch []string) (string, error) {
+	ret := _m.Called(ctx, s, ifMatch)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]interface{}, []string) string); ok {
+		r0 = rf(ctx, s, ifMatch)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, map[string]interface{}, []string) error); ok {
+		r1 = rf(ctx, s, ifMatch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SaveSettingsSchema provides a mock function with given fields: ctx, schema
+func (_m *DataStore) SaveSettingsSchema(ctx context.Context, schema string) error {
+	ret := _m.Called(ctx, schema)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, schema)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveToken provides a mock function with given fields: ctx, token
+func (_m *DataStore) SaveToken(ctx context.Context, token *jwt.Token) error {
+	ret := _m.Called(ctx, token)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *jwt.Token) error); ok {
+		r0 = rf(ctx, token)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveTokenRevocation provides a mock function with given fields: ctx, r
+func (_m *DataStore) SaveTokenRevocation(ctx context.Context, r *model.TokenRevocation) error {
+	ret := _m.Called(ctx, r)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.TokenRevocation) error); ok {
+		r0 = rf(ctx, r)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveUserSettings provides a mock function with given fields: ctx, userID, s
+func (_m *DataStore) SaveUserSettings(ctx context.Context, userID string, s map[string]interface{}) error {
+	ret := _m.Called(ctx, userID, s)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, map[string]interface{}) error); ok {
+		r0 = rf(ctx, userID, s)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetDeviceAuthorizationPolled provides a mock function with given fields: ctx, id, ts, interval
+func (_m *DataStore) SetDeviceAuthorizationPolled(ctx context.Context, id string, ts time.Time, interval int) error {
+	ret := _m.Called(ctx, id, ts, interval)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time, int) error); ok {
+		r0 = rf(ctx, id, ts, interval)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetFeature provides a mock function with given fields: ctx, f
+func (_m *DataStore) SetFeature(ctx context.Context, f *model.Feature) error {
+	ret := _m.Called(ctx, f)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Feature) error); ok {
+		r0 = rf(ctx, f)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetIdempotencyKeyUser provides a mock function with given fields: ctx, key, userID
+func (_m *DataStore) SetIdempotencyKeyUser(ctx context.Context, key string, userID string) error {
+	ret := _m.Called(ctx, key, userID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, key, userID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetLastLogin provides a mock function with given fields: ctx, id, ts, ip
+func (_m *DataStore) SetLastLogin(ctx context.Context, id string, ts time.Time, ip string) error {
+	ret := _m.Called(ctx, id, ts, ip)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time, string) error); ok {
+		r0 = rf(ctx, id, ts, ip)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetLimit provides a mock function with given fields: ctx, l
+func (_m *DataStore) SetLimit(ctx context.Context, l *model.Limit) error {
+	ret := _m.Called(ctx, l)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Limit) error); ok {
+		r0 = rf(ctx, l)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetPlan provides a mock function with given fields: ctx, p
+func (_m *DataStore) SetPlan(ctx context.Context, p *model.Plan) error {
+	ret := _m.Called(ctx, p)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Plan) error); ok {
+		r0 = rf(ctx, p)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetPrimaryEmail provides a mock function with given fields: ctx, id, email
+func (_m *DataStore) SetPrimaryEmail(ctx context.Context, id string, email string) error {
+	ret := _m.Called(ctx, id, email)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, id, email)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetTenantStatus provides a mock function with given fields: ctx, st
+func (_m *DataStore) SetTenantStatus(ctx context.Context, st *model.TenantStatus) error {
+	ret := _m.Called(ctx, st)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.TenantStatus) error); ok {
+		r0 = rf(ctx, st)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// TakeLoginLink provides a mock function with given fields: ctx, id
+func (_m *DataStore) TakeLoginLink(ctx context.Context, id string) (*model.LoginLink, error) {
 	ret := _m.Called(ctx, id)
 
-	var r0 *jwt.Token
-	if rf, ok := ret.Get(0).(func(context.Context, string) *jwt.Token); ok {
+	var r0 *model.LoginLink
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.LoginLink); ok {
 		r0 = rf(ctx, id)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*jwt.Token)
+			r0 = ret.Get(0).(*model.LoginLink)
 		}
 	}
 
@@ -125,22 +1718,22 @@ func (_m *DataStore) GetTokenById(ctx context.Context, id string) (*jwt.Token, e
 	return r0, r1
 }
 
-// GetUserByEmail provides a mock function with given fields: ctx, email
-func (_m *DataStore) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
-	ret := _m.Called(ctx, email)
+// TakeLoginOTPAttempt provides a mock function with given fields: ctx, userID, now
+func (_m *DataStore) TakeLoginOTPAttempt(ctx context.Context, userID string, now time.Time) (*model.LoginOTP, error) {
+	ret := _m.Called(ctx, userID, now)
 
-	var r0 *model.User
-	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
-		r0 = rf(ctx, email)
+	var r0 *model.LoginOTP
+	if rf, ok := ret.Get(0).(func(context.Context, string, time.Time) *model.LoginOTP); ok {
+		r0 = rf(ctx, userID, now)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.User)
+			r0 = ret.Get(0).(*model.LoginOTP)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, email)
+	if rf, ok := ret.Get(1).(func(context.Context, string, time.Time) error); ok {
+		r1 = rf(ctx, userID, now)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -148,16 +1741,16 @@ func (_m *DataStore) GetUserByEmail(ctx context.Context, email string) (*model.U
 	return r0, r1
 }
 
-// GetUserById provides a mock function with given fields: ctx, id
-func (_m *DataStore) GetUserById(ctx context.Context, id string) (*model.User, error) {
+// TakeOAuthCode provides a mock function with given fields: ctx, id
+func (_m *DataStore) TakeOAuthCode(ctx context.Context, id string) (*model.OAuthCode, error) {
 	ret := _m.Called(ctx, id)
 
-	var r0 *model.User
-	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+	var r0 *model.OAuthCode
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.OAuthCode); ok {
 		r0 = rf(ctx, id)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.User)
+			r0 = ret.Get(0).(*model.OAuthCode)
 		}
 	}
 
@@ -171,22 +1764,22 @@ func (_m *DataStore) GetUserById(ctx context.Context, id string) (*model.User, e
 	return r0, r1
 }
 
-// GetUsers provides a mock function with given fields: ctx
-func (_m *DataStore) GetUsers(ctx context.Context) ([]model.User, error) {
-	ret := _m.Called(ctx)
+// UpdateServiceAccount provides a mock function with given fields: ctx, id, u
+func (_m *DataStore) UpdateServiceAccount(ctx context.Context, id string, u *model.ServiceAccountUpdate) (*model.ServiceAccount, error) {
+	ret := _m.Called(ctx, id, u)
 
-	var r0 []model.User
-	if rf, ok := ret.Get(0).(func(context.Context) []model.User); ok {
-		r0 = rf(ctx)
+	var r0 *model.ServiceAccount
+	if rf, ok := ret.Get(0).(func(context.Context, string, *model.ServiceAccountUpdate) *model.ServiceAccount); ok {
+		r0 = rf(ctx, id, u)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]model.User)
+			r0 = ret.Get(0).(*model.ServiceAccount)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
+	if rf, ok := ret.Get(1).(func(context.Context, string, *model.ServiceAccountUpdate) error); ok {
+		r1 = rf(ctx, id, u)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -194,27 +1787,13 @@ func (_m *DataStore) GetUsers(ctx context.Context) ([]model.User, error) {
 	return r0, r1
 }
 
-// SaveSettings provides a mock function with given fields: ctx, s
-func (_m *DataStore) SaveSettings(ctx context.Context, s map[string]interface{}) error {
-	ret := _m.Called(ctx, s)
-
-	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, map[string]interface{}) error); ok {
-		r0 = rf(ctx, s)
-	} else {
-		r0 = ret.Error(0)
-	}
-
-	return r0
-}
-
-// SaveToken provides a mock function with given fields: ctx, token
-func (_m *DataStore) SaveToken(ctx context.Context, token *jwt.Token) error {
-	ret := _m.Called(ctx, token)
+// UpdateUser provides a mock function with given fields: ctx, id, u
+func (_m *DataStore) UpdateUser(ctx context.Context, id string, u *model.UserUpdate) error {
+	ret := _m.Called(ctx, id, u)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, *jwt.Token) error); ok {
-		r0 = rf(ctx, token)
+	if rf, ok := ret.Get(0).(func(context.Context, string, *model.UserUpdate) error); ok {
+		r0 = rf(ctx, id, u)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -222,13 +1801,13 @@ func (_m *DataStore) SaveToken(ctx context.Context, token *jwt.Token) error {
 	return r0
 }
 
-// UpdateUser provides a mock function with given fields: ctx, id, u
-func (_m *DataStore) UpdateUser(ctx context.Context, id string, u *model.UserUpdate) error {
-	ret := _m.Called(ctx, id, u)
+// VerifyUserEmail provides a mock function with given fields: ctx, id, email
+func (_m *DataStore) VerifyUserEmail(ctx context.Context, id string, email string) error {
+	ret := _m.Called(ctx, id, email)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, *model.UserUpdate) error); ok {
-		r0 = rf(ctx, id, u)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, id, email)
 	} else {
 		r0 = ret.Error(0)
 	}
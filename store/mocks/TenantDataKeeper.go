@@ -15,6 +15,7 @@ package mocks
 
 import context "context"
 import mock "github.com/stretchr/testify/mock"
+import model "github.com/mendersoftware/useradm/model"
 import store "github.com/mendersoftware/useradm/store"
 
 // TenantDataKeeper is an autogenerated mock type for the TenantDataKeeper type
@@ -22,6 +23,66 @@ type TenantDataKeeper struct {
 	mock.Mock
 }
 
+// DeleteTenant provides a mock function with given fields: ctx, id
+func (_m *TenantDataKeeper) DeleteTenant(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetMigrationProgress provides a mock function with given fields: ctx
+func (_m *TenantDataKeeper) GetMigrationProgress(ctx context.Context) (*model.MigrationProgress, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.MigrationProgress
+	if rf, ok := ret.Get(0).(func(context.Context) *model.MigrationProgress); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.MigrationProgress)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetMigrationStatus provides a mock function with given fields: ctx, id
+func (_m *TenantDataKeeper) GetMigrationStatus(ctx context.Context, id string) (*model.MigrationStatus, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.MigrationStatus
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.MigrationStatus); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.MigrationStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // MigrateTenant provides a mock function with given fields: ctx, id
 func (_m *TenantDataKeeper) MigrateTenant(ctx context.Context, id string) error {
 	ret := _m.Called(ctx, id)
@@ -36,4 +97,25 @@ func (_m *TenantDataKeeper) MigrateTenant(ctx context.Context, id string) error
 	return r0
 }
 
+// TenantExists provides a mock function with given fields: ctx, id
+func (_m *TenantDataKeeper) TenantExists(ctx context.Context, id string) (bool, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, string) bool); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 var _ store.TenantDataKeeper = (*TenantDataKeeper)(nil)
@@ -0,0 +1,211 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	mstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+// Kinds of the issues found by CheckConsistency
+const (
+	// an index the service relies on is missing; repaired by creating it
+	IssueMissingIndex = "missing_index"
+	// users whose emails are equal once normalized; can't be repaired
+	// automatically, one of the accounts has to be removed or changed
+	IssueDuplicateEmail = "duplicate_email"
+	// a user in the default database of a multitenant setup, which
+	// belongs to no tenant; can't be repaired automatically
+	IssueUserWithoutTenant = "user_without_tenant"
+	// tokens issued to a user who doesn't exist anymore; repaired by
+	// removing the tokens. The tokens of the OAuth clients and of the
+	// service accounts aren't users' and are skipped
+	IssueOrphanedTokens = "orphaned_tokens"
+)
+
+// ConsistencyIssue is an anomaly found in the data of a tenant
+type ConsistencyIssue struct {
+	Kind string `json:"kind"`
+	// tenant ID, empty for the default tenant
+	Tenant string `json:"tenant"`
+	// ID of the affected entity, e.g. the user or the index name
+	ID       string `json:"id"`
+	Detail   string `json:"detail"`
+	Repaired bool   `json:"repaired"`
+}
+
+// CheckConsistency scans the databases of all the tenants for anomalies,
+// repairing the ones it can if repair is set
+func (db *DataStoreMongo) CheckConsistency(ctx context.Context, repair bool) ([]ConsistencyIssue, error) {
+	tenants, err := db.allTenants(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if db.multitenant {
+		// users in the default database belong to no tenant
+		tenants = append([]string{""}, tenants...)
+	}
+
+	issues := []ConsistencyIssue{}
+	for _, tenant := range tenants {
+		tenantCtx := ctx
+		if tenant != "" {
+			tenantCtx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tenant,
+			})
+		}
+
+		found, err := db.checkTenantConsistency(tenantCtx, repair)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to check tenant %q", tenant)
+		}
+		for i := range found {
+			found[i].Tenant = tenant
+		}
+		issues = append(issues, found...)
+	}
+
+	return issues, nil
+}
+
+func (db *DataStoreMongo) checkTenantConsistency(ctx context.Context, repair bool) ([]ConsistencyIssue, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+	issues := []ConsistencyIssue{}
+
+	if db.multitenant && identity.FromContext(ctx) == nil {
+		// the default database isn't used, it's only expected
+		// to be empty
+		users, err := db.GetUsers(ctx, model.UserFilter{Fields: []string{"id", "email"}})
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			issues = append(issues, ConsistencyIssue{
+				Kind:   IssueUserWithoutTenant,
+				ID:     u.ID,
+				Detail: fmt.Sprintf("user %s belongs to no tenant", u.Email),
+			})
+		}
+		return issues, nil
+	}
+
+	missing, _, err := db.checkIndexes(database)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to check indexes")
+	}
+	for _, ci := range missing {
+		issue := ConsistencyIssue{
+			Kind:   IssueMissingIndex,
+			ID:     ci.index.Name,
+			Detail: fmt.Sprintf("index %s on %s is missing", ci.index.Name, ci.coll),
+		}
+		if repair {
+			err := database.C(ci.coll).EnsureIndex(ci.index)
+			switch {
+			case mgo.IsDup(err):
+				// the duplicates have to be resolved first
+				issue.Detail += ", and can't be created because of duplicate values"
+			case err != nil:
+				return nil, errors.Wrapf(err, "failed to create index %s on %s",
+					ci.index.Name, ci.coll)
+			default:
+				issue.Repaired = true
+			}
+		}
+		issues = append(issues, issue)
+	}
+
+	users, err := db.GetUsers(ctx, model.UserFilter{Fields: []string{"id", "email"}})
+	if err != nil {
+		return nil, err
+	}
+
+	byEmail := map[string][]string{}
+	userIDs := map[string]bool{}
+	for _, u := range users {
+		email := model.NormalizeEmail(u.Email)
+		byEmail[email] = append(byEmail[email], u.ID)
+		userIDs[u.ID] = true
+	}
+	emails := make([]string, 0, len(byEmail))
+	for email := range byEmail {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	for _, email := range emails {
+		ids := byEmail[email]
+		if len(ids) < 2 {
+			continue
+		}
+		sort.Strings(ids)
+		for _, id := range ids[1:] {
+			issues = append(issues, ConsistencyIssue{
+				Kind: IssueDuplicateEmail,
+				ID:   id,
+				Detail: fmt.Sprintf("email of user %s is the same as of user %s: %s",
+					id, ids[0], email),
+			})
+		}
+	}
+
+	// the subjects of the clients' and service accounts' tokens are
+	// their IDs
+	userTokens := bson.M{
+		DbTokenClient:         bson.M{"$ne": true},
+		DbTokenServiceAccount: bson.M{"$ne": true},
+	}
+
+	var subjects []string
+	err = database.C(DbTokensColl).Find(userTokens).Distinct(DbTokenSub, &subjects)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get token subjects")
+	}
+	sort.Strings(subjects)
+	for _, sub := range subjects {
+		if userIDs[sub] {
+			continue
+		}
+		issue := ConsistencyIssue{
+			Kind:   IssueOrphanedTokens,
+			ID:     sub,
+			Detail: fmt.Sprintf("tokens were issued to user %s, who doesn't exist", sub),
+		}
+		if repair {
+			_, err := database.C(DbTokensColl).RemoveAll(bson.M{
+				DbTokenSub:            sub,
+				DbTokenClient:         userTokens[DbTokenClient],
+				DbTokenServiceAccount: userTokens[DbTokenServiceAccount],
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to remove tokens of user %s", sub)
+			}
+			issue.Repaired = true
+		}
+		issues = append(issues, issue)
+	}
+
+	return issues, nil
+}
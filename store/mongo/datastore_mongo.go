@@ -16,8 +16,7 @@ package mongo
 
 import (
 	"context"
-	"crypto/tls"
-	"net"
+	"strings"
 	"sync"
 	"time"
 
@@ -28,22 +27,175 @@ import (
 	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
 	mstore "github.com/mendersoftware/go-lib-micro/store"
 	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/keys"
 	"github.com/mendersoftware/useradm/model"
 	"github.com/mendersoftware/useradm/store"
 )
 
 const (
-	DbVersion      = "0.1.0"
-	DbName         = "useradm"
-	DbUsersColl    = "users"
-	DbTokensColl   = "tokens"
-	DbSettingsColl = "settings"
-
-	DbUserEmail = "email"
-	DbUserPass  = "password"
+	DbVersion             = "1.2.0"
+	DbName                = "useradm"
+	DbUsersColl           = "users"
+	DbDeletedUsersColl    = "deleted_users"
+	DbTokensColl          = "tokens"
+	DbLoginEventsColl     = "login_events"
+	DbGroupsColl          = "groups"
+	DbSettingsColl        = "settings"
+	DbIdempotencyColl     = "idempotency_keys"
+	DbLimitsColl          = "limits"
+	DbFeaturesColl        = "features"
+	DbPlanColl            = "plan"
+	DbTenantStatusColl    = "tenant_status"
+	DbUserSettingsColl    = "user_settings"
+	DbSettingsHistColl    = "settings_history"
+	DbSettingsSchemaColl  = "settings_schema"
+	DbPendingUsersColl    = "pending_users"
+	DbEncryptionKeysColl  = "encryption_keys"
+	DbJobsColl            = "jobs"
+	DbJobLeasesColl       = "job_leases"
+	DbMaintenanceColl     = "maintenance"
+	DbServiceAccountsColl = "service_accounts"
+	DbLoginOTPsColl       = "login_otps"
+	// revocation jobs, kept in the default database
+	DbTokenRevocationsColl = "token_revocations"
+	// times up to which the tokens of the users are revoked
+	DbTokensRevokedColl = "tokens_revoked"
+	// OAuth clients of all the tenants, kept in the default database
+	DbOAuthClientsColl = "oauth_clients"
+	// authorization codes, kept in the default database
+	DbOAuthCodesColl = "oauth_codes"
+	// login links, kept in the default database
+	DbLoginLinksColl = "login_links"
+	// pending device logins, kept in the default database
+	DbDeviceAuthorizationsColl = "device_authorizations"
+	// sessions of the opaque tokens, kept in the default database
+	DbSessionsColl = "sessions"
+
+	DbUserEmail      = "email"
+	DbUserEmailIndex = "email_index"
+	DbUserEmails     = "emails"
+	DbUserUsername   = "username"
+	DbUserName       = "name"
+	DbUserPhone      = "phone"
+	DbUserPass       = "password"
+	DbUserDeletedTs  = "deleted_ts"
+	DbUserExpiresAt  = "expires_at"
+	DbUserStatus     = "status"
+	DbUserAttributes = "attributes"
+	DbUserGroups     = "groups"
+	DbUserETag       = "etag"
+	DbUserCreatedTs  = "created_ts"
+	DbUserUpdatedTs  = "updated_ts"
+
+	DbGroupName = "name"
+
+	DbServiceAccountName        = "name"
+	DbServiceAccountDescription = "description"
+	DbServiceAccountScope       = "scope"
+	DbServiceAccountOwner       = "owner"
+	DbServiceAccountUpdatedTs   = "updated_ts"
+
+	DbSettingsCreatedTs = "created_ts"
+	DbSettingsUpdatedTs = "updated_ts"
+	DbSettingsETag      = "etag"
+
+	DbSettingsVersionReplacedTs = "replaced_ts"
+	DbSettingsVersionSettings   = "settings"
+
+	// the schema is kept as a string, as its keywords may start with '$'
+	DbSettingsSchemaID     = "settings"
+	DbSettingsSchemaSchema = "schema"
+
+	// number of replaced settings versions kept in the history
+	SettingsHistoryLength = 10
+
+	// times a settings update is retried on concurrent modification
+	settingsReplaceRetries = 3
+
+	DbUserEmailsEmail      = "emails.email"
+	DbUserEmailsEmailIndex = "emails.email_index"
+
+	// keys of all the email addresses of the user, see userDoc
+	DbUserEmailKeys = "email_keys"
+
+	// times a change of the user's email addresses is retried
+	// on concurrent modification
+	userEmailsRetries = 3
+
+	DbUserLastLoginTs         = "last_login_ts"
+	DbUserLastLoginIP         = "last_login_ip"
+	DbUserFailedLoginAttempts = "failed_login_attempts"
+
+	DbLoginEventUserID = "user_id"
+	DbLoginEventTs     = "ts"
+
+	// login history entries are removed by mongo after this time
+	DbLoginEventsTTL = 90 * 24 * time.Hour
+
+	// expiry of the token as a date, for the TTL index
+	DbTokenExpiresTs      = "expires_ts"
+	DbTokenExp            = "claims.exp"
+	DbTokenSub            = "claims.sub"
+	DbTokenClient         = "claims.client"
+	DbTokenServiceAccount = "claims.service_account"
+
+	DbIdempotencyUserID    = "user_id"
+	DbIdempotencyCreatedTs = "created_ts"
+
+	// idempotency keys are removed by mongo after this time,
+	// retries coming later are executed again
+	DbIdempotencyTTL = 24 * time.Hour
+
+	DbPendingUserCreatedTs = "created_ts"
+
+	DbJobRuns           = "runs"
+	DbJobFailures       = "failures"
+	DbJobLastStartedTs  = "last_started_ts"
+	DbJobLastFinishedTs = "last_finished_ts"
+	DbJobLastDurationMs = "last_duration_ms"
+	DbJobLastError      = "last_error"
+	DbJobLastSuccessTs  = "last_success_ts"
+	DbJobSkips          = "skips"
+	DbJobLastSkippedTs  = "last_skipped_ts"
+
+	DbJobLeaseHolder = "holder"
+	DbJobLeaseUntil  = "until"
+
+	DbTokensRevokedTs = "revoked_ts"
+
+	DbTokenRevocationStatus    = "status"
+	DbTokenRevocationCreatedTs = "created_ts"
+	DbTokenRevocationStartedTs = "started_ts"
+
+	DbOAuthClientTenantID  = "tenant_id"
+	DbOAuthClientCreatedTs = "created_ts"
+
+	DbOAuthCodeExpiresTs = "expires_ts"
+
+	DbLoginLinkTenantID  = "tenant_id"
+	DbLoginLinkUserID    = "user_id"
+	DbLoginLinkCreatedTs = "created_ts"
+	DbLoginLinkExpiresTs = "expires_ts"
+
+	DbSessionTenantID  = "tenant_id"
+	DbSessionTokenID   = "token_id"
+	DbSessionExpiresTs = "expires_ts"
+
+	DbLoginOTPAttempts  = "attempts"
+	DbLoginOTPExpiresTs = "expires_ts"
+
+	DbDeviceAuthorizationUserCode  = "user_code"
+	DbDeviceAuthorizationScope     = "scope"
+	DbDeviceAuthorizationStatus    = "status"
+	DbDeviceAuthorizationTenantID  = "tenant_id"
+	DbDeviceAuthorizationUserID    = "user_id"
+	DbDeviceAuthorizationInterval  = "interval"
+	DbDeviceAuthorizationPolledTs  = "polled_ts"
+	DbDeviceAuthorizationExpiresTs = "expires_ts"
 )
 
 var (
@@ -53,6 +205,12 @@ var (
 
 	// once ensures mgoMaster is created only once
 	once sync.Once
+
+	// settings replaced concurrently
+	errSettingsModified = errors.New("settings modified concurrently")
+
+	// email addresses of the user changed concurrently
+	errUserEmailsModified = errors.New("user email addresses modified concurrently")
 )
 
 type DataStoreMongoConfig struct {
@@ -63,15 +221,50 @@ type DataStoreMongoConfig struct {
 	SSL           bool
 	SSLSkipVerify bool
 
+	// PEM file with the CAs to verify the servers against,
+	// the system CAs if empty
+	SSLCAPath string
+
+	// client certificate and key PEM files, for x.509 authentication
+	SSLCertPath string
+	SSLKeyPath  string
+
 	// Overwrites credentials provided in connection string if provided
 	Username string
 	Password string
+
+	// maximum and minimum number of connections per server,
+	// mgo defaults if 0
+	PoolLimit   int
+	MinPoolSize int
+
+	// idle connections are closed after this time, never if 0
+	MaxIdleTime time.Duration
+
+	// time to wait for a server to connect to, and for a usable server
+	// to run an operation on; 10s if 0
+	Timeout time.Duration
+
+	// time to wait for a server's response, or to send it a request;
+	// mgo default if 0
+	OperationTimeout time.Duration
+
+	// keyring file with the keys encrypting the email, name and phone
+	// of users, see keys.LoadKeyring; not encrypted if empty
+	EncryptionKeyringPath string
+
+	// number of tenant databases migrated at a time, 1 if 0
+	MigrationConcurrency int
 }
 
 type DataStoreMongo struct {
 	session     *mgo.Session
 	automigrate bool
 	multitenant bool
+	// encrypts the personal data of users, nil if it's not encrypted
+	cipher *fieldCipher
+	// number of tenants migrated at a time, 1 if 0
+	migrationConcurrency int
 }
 
 func GetDataStoreMongo(config DataStoreMongoConfig) (*DataStoreMongo, error) {
@@ -98,33 +291,11 @@ func NewDataStoreMongo(config DataStoreMongoConfig) (*DataStoreMongo, error) {
 	once.Do(func() {
 
 		var dialInfo *mgo.DialInfo
-		dialInfo, err = mgo.ParseURL(config.ConnectionString)
+		dialInfo, err = dialInfoFromConfig(config)
 		if err != nil {
 			return
 		}
 
-		// Set 10s timeout - same as set by Dial
-		dialInfo.Timeout = 10 * time.Second
-
-		if config.Username != "" {
-			dialInfo.Username = config.Username
-		}
-		if config.Password != "" {
-			dialInfo.Password = config.Password
-		}
-
-		if config.SSL {
-			dialInfo.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
-
-				// Setup TLS
-				tlsConfig := &tls.Config{}
-				tlsConfig.InsecureSkipVerify = config.SSLSkipVerify
-
-				conn, err := tls.Dial("tcp", addr.String(), tlsConfig)
-				return conn, err
-			}
-		}
-
 		masterSession, err = mgo.DialWithInfo(dialInfo)
 		if err != nil {
 			return
@@ -151,11 +322,55 @@ func NewDataStoreMongo(config DataStoreMongoConfig) (*DataStoreMongo, error) {
 		return nil, err
 	}
 
+	if config.EncryptionKeyringPath != "" {
+		keyring, err := keys.LoadKeyring(config.EncryptionKeyringPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load encryption keys")
+		}
+		db = db.WithEncryption(keyring)
+	}
+
+	if config.MigrationConcurrency > 0 {
+		db = db.WithMigrationConcurrency(config.MigrationConcurrency)
+	}
+
 	return db, nil
 }
 
-func (db *DataStoreMongo) CreateUser(ctx context.Context, u *model.User) error {
+// copySession returns a session for the call; mgo can't cancel operations,
+// so the deadline of the context, if any, bounds the wait for a server
+// while the operations themselves are bounded by the socket timeouts
+func (db *DataStoreMongo) copySession(ctx context.Context) *mgo.Session {
 	s := db.session.Copy()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := time.Until(deadline)
+		// a zero timeout would mean waiting forever
+		if timeout < time.Millisecond {
+			timeout = time.Millisecond
+		}
+		s.SetSyncTimeout(timeout)
+	}
+
+	return s
+}
+
+// userDoc is the document of a user; the keys of all the user's email
+// addresses, primary and additional, are kept unique among the users by
+// uniqueEmailKeysIndex, see userCipher.emailKeys
+type userDoc struct {
+	model.User `bson:",inline"`
+	EmailKeys  []string `bson:"email_keys,omitempty"`
+}
+
+// userUpdateDoc is the update of a user's document, see userDoc
+type userUpdateDoc struct {
+	model.UserUpdate `bson:",inline"`
+	EmailKeys        []string `bson:"email_keys,omitempty"`
+}
+
+func (db *DataStoreMongo) CreateUser(ctx context.Context, u *model.User) error {
+	s := db.copySession(ctx)
 	defer s.Close()
 
 	if err := db.EnsureIndexes(ctx, s); err != nil {
@@ -166,21 +381,86 @@ func (db *DataStoreMongo) CreateUser(ctx context.Context, u *model.User) error {
 
 	u.CreatedTs = &now
 	u.UpdatedTs = &now
+	u.ETag = newETag()
+
+	// login information is maintained by the service
+	u.LastLoginTs = nil
+	u.LastLoginIP = ""
+	u.FailedLoginAttempts = 0
+
+	// group membership is managed through the groups
+	u.Groups = nil
+
+	// additional email addresses are added one by one
+	u.Emails = nil
+
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+
+	uc, err := db.userCipher(database)
+	if err != nil {
+		return err
+	}
+
+	if err := db.checkUserLimit(database, 1); err != nil {
+		return err
+	}
+
+	doc := userDoc{User: *u, EmailKeys: uc.emailKeys(u.Email, nil)}
+	uc.encryptUser(&doc.User)
 
-	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).Insert(u)
+	err = database.C(DbUsersColl).Insert(&doc)
 	if err != nil {
 		if mgo.IsDup(err) {
-			return store.ErrDuplicateEmail
+			return duplicateUserError(err)
 		}
 
 		return errors.Wrap(err, "failed to insert user")
 	}
 
+	return db.rollbackOverUserLimit(database, u.ID)
+}
+
+// checkUserLimit returns ErrUserLimitReached if adding the given number
+// of users would put more users in the database than the limit allows
+func (db *DataStoreMongo) checkUserLimit(database *mgo.Database, adding int) error {
+	var limit model.Limit
+	err := database.C(DbLimitsColl).FindId(model.LimitMaxUsers).One(&limit)
+	switch {
+	case err == mgo.ErrNotFound:
+		return nil
+	case err != nil:
+		return errors.Wrap(err, "failed to fetch user limit")
+	case limit.Value == 0:
+		return nil
+	}
+
+	n, err := database.C(DbUsersColl).Count()
+	if err != nil {
+		return errors.Wrap(err, "failed to count users")
+	}
+	if n+adding > limit.Value {
+		return store.ErrUserLimitReached
+	}
+
+	return nil
+}
+
+// rollbackOverUserLimit removes the user just inserted if that put the
+// database over the limit; checking before inserting alone would let
+// concurrent requests exceed it
+func (db *DataStoreMongo) rollbackOverUserLimit(database *mgo.Database, id string) error {
+	err := db.checkUserLimit(database, 0)
+	if err != nil {
+		if rerr := database.C(DbUsersColl).RemoveId(id); rerr != nil {
+			return errors.Wrapf(err, "failed to remove user over the limit: %v", rerr)
+		}
+		return err
+	}
 	return nil
 }
 
 func (db *DataStoreMongo) UpdateUser(ctx context.Context, id string, u *model.UserUpdate) error {
-	s := db.session.Copy()
+	s := db.copySession(ctx)
 	defer s.Close()
 
 	//compute/set password hash
@@ -194,293 +474,2725 @@ func (db *DataStoreMongo) UpdateUser(ctx context.Context, id string, u *model.Us
 
 	now := time.Now().UTC()
 	u.UpdatedTs = &now
+	u.ETag = newETag()
 
-	c := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl)
-	err := c.UpdateId(id, bson.M{"$set": u})
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+
+	uc, err := db.userCipher(database)
 	if err != nil {
-		if err == mgo.ErrNotFound {
-			return store.ErrUserNotFound
+		return err
+	}
+
+	for i := 0; ; i++ {
+		err := tryUpdateUser(database.C(DbUsersColl), uc, id, u)
+		if err != errUserEmailsModified {
+			return err
 		}
-		if mgo.IsDup(err) {
-			return store.ErrDuplicateEmail
+		if i >= userEmailsRetries {
+			return errors.Wrap(err, "failed to update user")
 		}
+	}
+}
 
-		return errors.Wrap(err, "failed to update user")
+// tryUpdateUser updates the user; the keys of the email addresses are
+// replaced along with the primary one, provided the additional ones
+// didn't change meanwhile, errUserEmailsModified is returned otherwise
+func tryUpdateUser(c *mgo.Collection, uc *userCipher, id string, u *model.UserUpdate) error {
+	query := bson.M{"_id": id}
+	if len(u.IfMatch) > 0 {
+		query[DbUserETag] = etagQuery(u.IfMatch)
 	}
 
-	return nil
-}
+	doc := userUpdateDoc{UserUpdate: *u}
+	if u.Email != "" {
+		var user model.User
+		err := c.FindId(id).Select(bson.M{DbUserEmails: 1, DbUserETag: 1}).One(&user)
+		switch err {
+		case nil:
+		case mgo.ErrNotFound:
+			return store.ErrUserNotFound
+		default:
+			return errors.Wrap(err, "failed to fetch user")
+		}
+		if len(u.IfMatch) > 0 && !containsETag(u.IfMatch, user.ETag) {
+			return store.ErrETagMismatch
+		}
 
-func (db *DataStoreMongo) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
-	s := db.session.Copy()
-	defer s.Close()
+		etag := user.ETag
+		if err := uc.decryptUser(&user); err != nil {
+			return err
+		}
+		doc.EmailKeys = uc.emailKeys(u.Email, user.Emails)
 
-	var user model.User
+		// users created before versioning have no ETag
+		query[DbUserETag] = etag
+		if etag == "" {
+			query[DbUserETag] = bson.M{"$exists": false}
+		}
+	}
+	uc.encryptUserUpdate(id, &doc.UserUpdate)
 
-	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).Find(bson.M{DbUserEmail: email}).One(&user)
+	update := bson.M{"$set": &doc}
+	if len(u.Clear) > 0 {
+		unset := bson.M{}
+		for _, field := range u.Clear {
+			unset[field] = ""
+		}
+		update["$unset"] = unset
+	}
 
+	err := c.Update(query, update)
 	if err != nil {
 		if err == mgo.ErrNotFound {
-			return nil, nil
-		} else {
-			return nil, errors.Wrap(err, "failed to fetch user")
+			if u.Email != "" {
+				return errUserEmailsModified
+			}
+			if len(u.IfMatch) > 0 {
+				if n, err := c.FindId(id).Count(); err == nil && n > 0 {
+					return store.ErrETagMismatch
+				}
+			}
+			return store.ErrUserNotFound
+		}
+		if mgo.IsDup(err) {
+			return duplicateUserError(err)
 		}
+
+		return errors.Wrap(err, "failed to update user")
 	}
 
-	return &user, nil
+	return nil
 }
 
-func (db *DataStoreMongo) GetUserById(ctx context.Context, id string) (*model.User, error) {
-	s := db.session.Copy()
+func (db *DataStoreMongo) SetLastLogin(ctx context.Context, id string, ts time.Time, ip string) error {
+	s := db.copySession(ctx)
 	defer s.Close()
 
-	var user model.User
-
-	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).
-		FindId(id).
-		Select(bson.M{DbUserPass: 0}).
-		One(&user)
-
+	c := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl)
+	err := c.UpdateId(id, bson.M{
+		"$set": bson.M{
+			DbUserLastLoginTs:         ts.UTC(),
+			DbUserLastLoginIP:         ip,
+			DbUserFailedLoginAttempts: 0,
+		},
+	})
 	if err != nil {
 		if err == mgo.ErrNotFound {
-			return nil, nil
-		} else {
-			return nil, errors.Wrap(err, "failed to fetch user")
+			return store.ErrUserNotFound
 		}
+		return errors.Wrap(err, "failed to update user login information")
 	}
 
-	return &user, nil
+	return nil
 }
 
-func (db *DataStoreMongo) GetTokenById(ctx context.Context, id string) (*jwt.Token, error) {
-	s := db.session.Copy()
+func (db *DataStoreMongo) IncFailedLogins(ctx context.Context, id string) error {
+	s := db.copySession(ctx)
 	defer s.Close()
 
-	var token jwt.Token
-
-	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).
-		FindId(id).
-		One(&token)
-
+	c := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl)
+	err := c.UpdateId(id, bson.M{
+		"$inc": bson.M{
+			DbUserFailedLoginAttempts: 1,
+		},
+	})
 	if err != nil {
 		if err == mgo.ErrNotFound {
-			return nil, nil
-		} else {
-			return nil, errors.Wrap(err, "failed to fetch token")
+			return store.ErrUserNotFound
 		}
+		return errors.Wrap(err, "failed to update user login information")
 	}
 
-	return &token, nil
+	return nil
 }
 
-func (db *DataStoreMongo) GetUsers(ctx context.Context) ([]model.User, error) {
-	s := db.session.Copy()
+func (db *DataStoreMongo) SaveLoginEvent(ctx context.Context, event *model.LoginEvent) error {
+	s := db.copySession(ctx)
 	defer s.Close()
 
-	users := []model.User{}
+	c := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbLoginEventsColl)
 
-	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).
-		Find(nil).
-		Select(bson.M{DbUserPass: 0}).
-		All(&users)
+	if err := c.EnsureIndex(loginEventsTTLIndex); err != nil {
+		return errors.Wrap(err, "failed to ensure login history index")
+	}
 
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to fetch users")
+	if err := c.Insert(event); err != nil {
+		return errors.Wrap(err, "failed to store login event")
 	}
 
-	return users, nil
+	return nil
 }
 
-func (db *DataStoreMongo) DeleteUser(ctx context.Context, id string) error {
-	s := db.session.Copy()
+func (db *DataStoreMongo) GetLoginEvents(ctx context.Context, userID string) ([]model.LoginEvent, error) {
+	s := db.copySession(ctx)
 	defer s.Close()
 
-	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).RemoveId(id)
+	events := []model.LoginEvent{}
 
-	switch err {
-	case nil, mgo.ErrNotFound:
-		return nil
-	default:
-		return err
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbLoginEventsColl).
+		Find(bson.M{DbLoginEventUserID: userID}).
+		Sort("-" + DbLoginEventTs).
+		All(&events)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch login events")
 	}
+
+	return events, nil
 }
 
-func (db *DataStoreMongo) SaveToken(ctx context.Context, token *jwt.Token) error {
-	s := db.session.Copy()
+func (db *DataStoreMongo) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	s := db.copySession(ctx)
 	defer s.Close()
 
-	c := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
-
-	if err := c.Insert(token); err != nil {
-		return errors.Wrap(err, "failed to store token")
-	}
+	var user model.User
 
-	return nil
-}
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
 
-func (db *DataStoreMongo) MigrateTenant(ctx context.Context, version string, tenant string) error {
-	ver, err := migrate.NewVersion(version)
+	uc, err := db.userCipher(database)
 	if err != nil {
-		return errors.Wrap(err, "failed to parse service version")
+		return nil, err
 	}
 
-	tenantCtx := identity.WithContext(ctx, &identity.Identity{
-		Tenant: tenant,
-	})
+	err = database.C(DbUsersColl).Find(uc.emailQuery(email)).
+		Collation(emailCollation).
+		One(&user)
 
-	m := migrate.DummyMigrator{
-		Session:     db.session,
-		Db:          mstore.DbFromContext(tenantCtx, DbName),
-		Automigrate: db.automigrate,
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		} else {
+			return nil, errors.Wrap(err, "failed to fetch user")
+		}
 	}
 
-	err = m.Apply(tenantCtx, *ver, nil)
-	if err != nil {
-		return errors.Wrap(err, "failed to apply migrations")
+	if err := uc.decryptUser(&user); err != nil {
+		return nil, err
 	}
-	return nil
-}
 
-func (db *DataStoreMongo) Migrate(ctx context.Context, version string, migrations []migrate.Migration) error {
-	l := log.FromContext(ctx)
+	return &user, nil
+}
 
-	dbs := []string{DbName}
+func (db *DataStoreMongo) GetUserByUsername(ctx context.Context, username string) (*model.User, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
 
-	if db.multitenant {
-		l.Infof("running migrations in multitenant mode")
+	var user model.User
 
-		tdbs, err := migrate.GetTenantDbs(db.session, mstore.IsTenantDb(DbName))
-		if err != nil {
-			return errors.Wrap(err, "failed go retrieve tenant DBs")
-		}
-		dbs = tdbs
-	} else {
-		l.Infof("running migrations in single tenant mode")
-	}
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
 
-	if db.automigrate {
-		l.Infof("automigrate is ON, will apply migrations")
-	} else {
-		l.Infof("automigrate is OFF, will check db version compatibility")
+	uc, err := db.userCipher(database)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, d := range dbs {
-		l.Infof("migrating %s", d)
+	err = database.C(DbUsersColl).Find(bson.M{DbUserUsername: username}).One(&user)
 
-		// if not in multi tenant, then tenant will be "" and identity
-		// will be the same as default
-		tenant := mstore.TenantFromDbName(d, DbName)
-
-		if err := db.MigrateTenant(ctx, version, tenant); err != nil {
-			return err
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
 		}
+		return nil, errors.Wrap(err, "failed to fetch user")
 	}
 
-	return nil
-}
-
-func (db *DataStoreMongo) EnsureIndexes(ctx context.Context, s *mgo.Session) error {
-
-	uniqueEmailIndex := mgo.Index{
-		Key:        []string{"email"},
-		Unique:     true,
-		Name:       "uniqueEmail",
-		Background: false,
+	if err := uc.decryptUser(&user); err != nil {
+		return nil, err
 	}
 
-	return s.DB(mstore.DbFromContext(ctx, DbName)).
-		C(DbUsersColl).EnsureIndex(uniqueEmailIndex)
+	return &user, nil
 }
 
-// WithMultitenant enables multitenant support and returns a new datastore based
-// on current one
-func (db *DataStoreMongo) WithMultitenant() *DataStoreMongo {
-	return &DataStoreMongo{
-		session:     db.session,
-		automigrate: db.automigrate,
-		multitenant: true,
+// duplicateUserError tells which unique field of the user the duplicate
+// key error is about
+func duplicateUserError(err error) error {
+	if strings.Contains(err.Error(), uniqueUsernameIndex.Name) {
+		return store.ErrDuplicateUsername
 	}
+	return store.ErrDuplicateEmail
 }
 
-// WithAutomigrate enables automatic migration and returns a new datastore based
-// on current one
-func (db *DataStoreMongo) WithAutomigrate() *DataStoreMongo {
-	return &DataStoreMongo{
-		session:     db.session,
-		automigrate: true,
-		multitenant: db.multitenant,
-	}
+func (db *DataStoreMongo) AddUserEmail(ctx context.Context, id string, e *model.UserEmail) error {
+	now := time.Now().UTC()
+	e.CreatedTs = &now
+
+	return db.updateUserEmails(ctx, id,
+		func(database *mgo.Database, uc *userCipher, u *model.User) error {
+			u.Emails = append(u.Emails, *e)
+			return nil
+		})
 }
 
-// deletes all tenant's tokens (identity in context)
-func (db *DataStoreMongo) DeleteTokens(ctx context.Context) error {
-	s := db.session.Copy()
-	defer s.Close()
+func (db *DataStoreMongo) VerifyUserEmail(ctx context.Context, id, email string) error {
+	return db.updateUserEmails(ctx, id,
+		func(database *mgo.Database, uc *userCipher, u *model.User) error {
+			e := u.FindEmail(email)
+			if e == nil {
+				return store.ErrUserEmailNotFound
+			}
 
-	c := db.session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
-	ci, err := c.RemoveAll(nil)
+			now := time.Now().UTC()
+			e.Verified = true
+			e.VerifiedTs = &now
+			e.CodeHash = ""
+			return nil
+		})
+}
 
-	if ci.Removed == 0 {
-		return store.ErrTokenNotFound
-	}
+func (db *DataStoreMongo) DeleteUserEmail(ctx context.Context, id, email string) error {
+	return db.updateUserEmails(ctx, id,
+		func(database *mgo.Database, uc *userCipher, u *model.User) error {
+			if u.FindEmail(email) == nil {
+				return store.ErrUserEmailNotFound
+			}
 
-	return err
+			emails := []model.UserEmail{}
+			for _, e := range u.Emails {
+				if e.Email != email {
+					emails = append(emails, e)
+				}
+			}
+			u.Emails = emails
+			return nil
+		})
 }
 
-// deletes all user's tokens
-func (db *DataStoreMongo) DeleteTokensByUserId(ctx context.Context, userId string) error {
-	s := db.session.Copy()
+func (db *DataStoreMongo) SetPrimaryEmail(ctx context.Context, id, email string) error {
+	return db.updateUserEmails(ctx, id,
+		func(database *mgo.Database, uc *userCipher, u *model.User) error {
+			e := u.FindEmail(email)
+			if e == nil {
+				return store.ErrUserEmailNotFound
+			}
+
+			now := time.Now().UTC()
+			*e = model.UserEmail{
+				Email:      u.Email,
+				Verified:   true,
+				CreatedTs:  u.CreatedTs,
+				VerifiedTs: &now,
+			}
+			u.Email = email
+			return nil
+		})
+}
+
+// updateUserEmails applies the change to the primary and additional email
+// addresses of the user, decrypted; the change is retried if the user is
+// modified in the meantime
+func (db *DataStoreMongo) updateUserEmails(ctx context.Context, id string,
+	change func(database *mgo.Database, uc *userCipher, u *model.User) error) error {
+	s := db.copySession(ctx)
 	defer s.Close()
 
-	c := db.session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
-	filter := bson.M{
-		"claims.sub": userId,
+	if err := db.EnsureIndexes(ctx, s); err != nil {
+		return err
 	}
-	ci, err := c.RemoveAll(filter)
 
-	if ci.Removed == 0 {
-		return store.ErrTokenNotFound
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+
+	uc, err := db.userCipher(database)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		err := tryUpdateUserEmails(database, uc, id, change)
+		if err != errUserEmailsModified {
+			return err
+		}
+		if i >= userEmailsRetries {
+			return errors.Wrap(err, "failed to update user")
+		}
+	}
+}
+
+func tryUpdateUserEmails(database *mgo.Database, uc *userCipher, id string,
+	change func(database *mgo.Database, uc *userCipher, u *model.User) error) error {
+	c := database.C(DbUsersColl)
+
+	var user model.User
+	err := c.FindId(id).
+		Select(bson.M{
+			DbUserEmail:     1,
+			DbUserEmails:    1,
+			DbUserCreatedTs: 1,
+			DbUserETag:      1,
+		}).
+		One(&user)
+	switch err {
+	case nil:
+	case mgo.ErrNotFound:
+		return store.ErrUserNotFound
+	default:
+		return errors.Wrap(err, "failed to fetch user")
+	}
+
+	etag := user.ETag
+	if err := uc.decryptUser(&user); err != nil {
+		return err
+	}
+
+	if err := change(database, uc, &user); err != nil {
+		return err
+	}
+
+	keys := uc.emailKeys(user.Email, user.Emails)
+	uc.encryptUser(&user)
+
+	set := bson.M{
+		DbUserEmail:     user.Email,
+		DbUserETag:      newETag(),
+		DbUserUpdatedTs: time.Now().UTC(),
+	}
+	unset := bson.M{}
+	if user.EmailIndex != "" {
+		set[DbUserEmailIndex] = user.EmailIndex
+	}
+	if len(user.Emails) > 0 {
+		set[DbUserEmails] = user.Emails
+	} else {
+		unset[DbUserEmails] = ""
+	}
+	// the index would take empty lists of keys for duplicates
+	if len(keys) > 0 {
+		set[DbUserEmailKeys] = keys
+	} else {
+		unset[DbUserEmailKeys] = ""
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	// users created before versioning have no ETag
+	query := bson.M{"_id": id, DbUserETag: etag}
+	if etag == "" {
+		query[DbUserETag] = bson.M{"$exists": false}
+	}
+
+	err = c.Update(query, update)
+	switch {
+	case err == nil:
+		return nil
+	case err == mgo.ErrNotFound:
+		return errUserEmailsModified
+	case mgo.IsDup(err):
+		return duplicateUserError(err)
+	default:
+		return errors.Wrap(err, "failed to update user")
+	}
+}
+
+func (db *DataStoreMongo) GetUserById(ctx context.Context, id string) (*model.User, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	var user model.User
+
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+	c := database.C(DbUsersColl)
+
+	uc, err := db.userCipher(database)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.FindId(id).
+		Select(bson.M{DbUserPass: 0}).
+		One(&user)
+
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		} else {
+			return nil, errors.Wrap(err, "failed to fetch user")
+		}
+	}
+
+	if err := uc.decryptUser(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (db *DataStoreMongo) GetTokenById(ctx context.Context, id string) (*jwt.Token, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	var token jwt.Token
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).
+		FindId(id).
+		One(&token)
+
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		} else {
+			return nil, errors.Wrap(err, "failed to fetch token")
+		}
+	}
+
+	return &token, nil
+}
+
+func (db *DataStoreMongo) GetUsers(ctx context.Context, fltr model.UserFilter) ([]model.User, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	users := []model.User{}
+
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+
+	uc, err := db.userCipher(database)
+	if err != nil {
+		return nil, err
+	}
+
+	q := database.C(DbUsersColl).
+		Find(userFilterQuery(fltr)).
+		Select(userProjection(fltr.Fields))
+	if fltr.Limit > 0 {
+		q = q.Sort(DbUserEmail).Collation(emailCollation).
+			Skip(fltr.Skip).Limit(fltr.Limit)
+	}
+
+	err = q.All(&users)
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch users")
+	}
+
+	for i := range users {
+		if err := uc.decryptUser(&users[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
+
+func (db *DataStoreMongo) CountUsers(ctx context.Context, fltr model.UserFilter) (int, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	n, err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).
+		Find(userFilterQuery(fltr)).
+		Count()
+	if err != nil {
+		return 0, errors.Wrap(err, "failed to count users")
+	}
+
+	return n, nil
+}
+
+func (db *DataStoreMongo) GetUsersVersion(ctx context.Context,
+	fltr model.UserFilter) (*model.UsersVersion, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	var v model.UsersVersion
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).
+		Pipe([]bson.M{
+			{"$match": userFilterQuery(fltr)},
+			{"$group": bson.M{
+				"_id":                     nil,
+				"count":                   bson.M{"$sum": 1},
+				DbUserUpdatedTs:           bson.M{"$max": "$" + DbUserUpdatedTs},
+				DbUserLastLoginTs:         bson.M{"$max": "$" + DbUserLastLoginTs},
+				DbUserFailedLoginAttempts: bson.M{"$sum": "$" + DbUserFailedLoginAttempts},
+			}},
+		}).
+		One(&v)
+	if err != nil && err != mgo.ErrNotFound {
+		return nil, errors.Wrap(err, "failed to get users version")
+	}
+
+	return &v, nil
+}
+
+func (db *DataStoreMongo) ForEachUser(ctx context.Context, fltr model.UserFilter,
+	fn func(u *model.User) error) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+
+	uc, err := db.userCipher(database)
+	if err != nil {
+		return err
+	}
+
+	iter := database.C(DbUsersColl).
+		Find(userFilterQuery(fltr)).
+		Select(userProjection(fltr.Fields)).
+		Sort(DbUserEmail).
+		Collation(emailCollation).
+		Iter()
+
+	var user model.User
+	for iter.Next(&user) {
+		if err := uc.decryptUser(&user); err != nil {
+			iter.Close()
+			return err
+		}
+		if err := fn(&user); err != nil {
+			iter.Close()
+			return err
+		}
+		// fields missing in the next document would keep their values
+		user = model.User{}
+	}
+
+	if err := iter.Close(); err != nil {
+		return errors.Wrap(err, "failed to fetch users")
+	}
+
+	return nil
+}
+
+// userProjection selects the given fields of the users, along with
+// the ETag, or all but the password; the JSON names of the fields match
+// the document keys except for the ID
+func userProjection(fields []string) bson.M {
+	if len(fields) == 0 {
+		return bson.M{DbUserPass: 0}
+	}
+
+	projection := bson.M{DbUserETag: 1}
+	for _, f := range fields {
+		if f == "id" {
+			f = "_id"
+		}
+		projection[f] = 1
+	}
+
+	return projection
+}
+
+func userFilterQuery(fltr model.UserFilter) bson.M {
+	query := bson.M{}
+	for k, v := range fltr.Attributes {
+		query[DbUserAttributes+"."+k] = v
+	}
+	if fltr.Group != "" {
+		query[DbUserGroups] = fltr.Group
+	}
+	if fltr.ID != "" {
+		query["_id"] = fltr.ID
+	}
+	if fltr.Active {
+		query[DbUserStatus] = bson.M{"$ne": model.UserStatusInactive}
+		query["$or"] = []bson.M{
+			{DbUserExpiresAt: nil},
+			{DbUserExpiresAt: bson.M{"$gt": time.Now().UTC()}},
+		}
+	}
+
+	return query
+}
+
+func (db *DataStoreMongo) DeleteUser(ctx context.Context, id string, ifMatch []string) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+	c := database.C(DbUsersColl)
+
+	query := bson.M{"_id": id}
+	if len(ifMatch) > 0 {
+		query[DbUserETag] = etagQuery(ifMatch)
+	}
+
+	// the version check and the removal are a single operation
+	var user userDoc
+	_, err := c.Find(query).Apply(mgo.Change{Remove: true}, &user)
+	switch err {
+	case nil:
+	case mgo.ErrNotFound:
+		if len(ifMatch) == 0 {
+			return nil
+		}
+		if n, err := c.FindId(id).Count(); err == nil && n > 0 {
+			return store.ErrETagMismatch
+		}
+		return store.ErrUserNotFound
+	default:
+		return errors.Wrap(err, "failed to delete user")
+	}
+
+	now := time.Now().UTC()
+	user.DeletedTs = &now
+
+	// keep a tombstone, so that the user can be restored
+	if _, err := database.C(DbDeletedUsersColl).UpsertId(id, &user); err != nil {
+		user.DeletedTs = nil
+		if insertErr := c.Insert(&user); insertErr != nil {
+			err = errors.Wrap(err, insertErr.Error())
+		}
+		return errors.Wrap(err, "failed to store deleted user")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) RestoreUser(ctx context.Context, id string) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	if err := db.EnsureIndexes(ctx, s); err != nil {
+		return err
+	}
+
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+
+	var user userDoc
+
+	err := database.C(DbDeletedUsersColl).FindId(id).One(&user)
+	switch err {
+	case nil:
+	case mgo.ErrNotFound:
+		return store.ErrUserNotFound
+	default:
+		return errors.Wrap(err, "failed to fetch deleted user")
+	}
+
+	user.DeletedTs = nil
+
+	// users deleted before the keys were kept have none
+	if user.EmailKeys, err = db.restoredEmailKeys(database, &user.User); err != nil {
+		return err
+	}
+
+	if err := db.checkUserLimit(database, 1); err != nil {
+		return err
+	}
+
+	if err := database.C(DbUsersColl).Insert(&user); err != nil {
+		if mgo.IsDup(err) {
+			return duplicateUserError(err)
+		}
+		return errors.Wrap(err, "failed to insert user")
+	}
+
+	// the deleted user is kept until the restored one is within the limit
+	if err := db.rollbackOverUserLimit(database, id); err != nil {
+		return err
+	}
+
+	err = database.C(DbDeletedUsersColl).RemoveId(id)
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrap(err, "failed to remove deleted user")
+	}
+
+	return nil
+}
+
+// restoredEmailKeys returns the keys of the deleted user's email
+// addresses; the index rejects the user if other users took any of
+// them in the meantime
+func (db *DataStoreMongo) restoredEmailKeys(database *mgo.Database,
+	user *model.User) ([]string, error) {
+	uc, err := db.userCipher(database)
+	if err != nil {
+		return nil, err
+	}
+
+	plain := *user
+	plain.Emails = append([]model.UserEmail(nil), user.Emails...)
+	if err := uc.decryptUser(&plain); err != nil {
+		return nil, err
+	}
+
+	return uc.emailKeys(plain.Email, plain.Emails), nil
+}
+
+func (db *DataStoreMongo) EraseUser(ctx context.Context, id string) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+
+	found := false
+	for _, coll := range []string{DbUsersColl, DbDeletedUsersColl} {
+		n, err := database.C(coll).FindId(id).Count()
+		if err != nil {
+			return errors.Wrapf(err, "failed to fetch user from %s", coll)
+		}
+		found = found || n > 0
+	}
+
+	if !found {
+		return store.ErrUserNotFound
+	}
+
+	// the sessions only refer to the tokens, which go right after them
+	tokenIDs := []string{}
+	err := database.C(DbTokensColl).Find(bson.M{DbTokenSub: id}).Distinct("_id", &tokenIDs)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch user tokens")
+	}
+
+	// the device logins of single tenant setups have no tenant at all
+	var deviceTenantID interface{}
+	if tenant := tenantID(ctx); tenant != "" {
+		deviceTenantID = tenant
+	}
+
+	// the user's documents go last, so that a failed erasure can be retried
+	related := []struct {
+		database *mgo.Database
+		coll     string
+		filter   bson.M
+	}{
+		{s.DB(DbName), DbSessionsColl, bson.M{
+			DbSessionTenantID: tenantID(ctx),
+			DbSessionTokenID:  bson.M{"$in": tokenIDs},
+		}},
+		{s.DB(DbName), DbLoginLinksColl, bson.M{
+			DbLoginLinkTenantID: tenantID(ctx),
+			DbLoginLinkUserID:   id,
+		}},
+		{s.DB(DbName), DbDeviceAuthorizationsColl, bson.M{
+			DbDeviceAuthorizationTenantID: deviceTenantID,
+			DbDeviceAuthorizationUserID:   id,
+		}},
+		{database, DbTokensColl, bson.M{DbTokenSub: id}},
+		{database, DbTokensRevokedColl, bson.M{"_id": id}},
+		{database, DbLoginEventsColl, bson.M{DbLoginEventUserID: id}},
+		{database, DbIdempotencyColl, bson.M{DbIdempotencyUserID: id}},
+		{database, DbLoginOTPsColl, bson.M{"_id": id}},
+		{database, DbUserSettingsColl, bson.M{"_id": id}},
+		{database, DbDeletedUsersColl, bson.M{"_id": id}},
+		{database, DbUsersColl, bson.M{"_id": id}},
+	}
+	for _, r := range related {
+		if _, err := r.database.C(r.coll).RemoveAll(r.filter); err != nil {
+			return errors.Wrapf(err, "failed to remove user data from %s", r.coll)
+		}
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) PurgeDeletedUsers(ctx context.Context, before time.Time) error {
+	return db.forEachTenant(ctx, func(ctx context.Context) error {
+		s := db.copySession(ctx)
+		defer s.Close()
+
+		_, err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbDeletedUsersColl).
+			RemoveAll(bson.M{DbUserDeletedTs: bson.M{"$lt": before}})
+		if err != nil {
+			return errors.Wrapf(err, "failed to purge deleted users from %s",
+				mstore.DbFromContext(ctx, DbName))
+		}
+		return nil
+	})
+}
+
+func (db *DataStoreMongo) CreateGroup(ctx context.Context, g *model.Group) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	if err := db.EnsureIndexes(ctx, s); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	g.CreatedTs = &now
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbGroupsColl).Insert(g)
+	if err != nil {
+		if mgo.IsDup(err) {
+			return store.ErrDuplicateGroupName
+		}
+
+		return errors.Wrap(err, "failed to insert group")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetGroups(ctx context.Context) ([]model.Group, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	groups := []model.Group{}
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbGroupsColl).
+		Find(nil).
+		Sort(DbGroupName).
+		All(&groups)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch groups")
+	}
+
+	return groups, nil
+}
+
+func (db *DataStoreMongo) GetGroupById(ctx context.Context, id string) (*model.Group, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	var group model.Group
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbGroupsColl).
+		FindId(id).
+		One(&group)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to fetch group")
+	}
+
+	return &group, nil
+}
+
+func (db *DataStoreMongo) GetGroupsByIds(ctx context.Context, ids []string) ([]model.Group, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	groups := []model.Group{}
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbGroupsColl).
+		Find(bson.M{"_id": bson.M{"$in": ids}}).
+		Sort(DbGroupName).
+		All(&groups)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch groups")
+	}
+
+	return groups, nil
+}
+
+func (db *DataStoreMongo) DeleteGroup(ctx context.Context, id string) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+
+	_, err := database.C(DbUsersColl).UpdateAll(
+		bson.M{DbUserGroups: id},
+		bson.M{
+			"$pull": bson.M{DbUserGroups: id},
+			"$set": bson.M{
+				DbUserETag:      newETag(),
+				DbUserUpdatedTs: time.Now().UTC(),
+			},
+		})
+	if err != nil {
+		return errors.Wrap(err, "failed to remove group members")
+	}
+
+	err = database.C(DbGroupsColl).RemoveId(id)
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrap(err, "failed to remove group")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) AddUserToGroup(ctx context.Context, userID, groupID string) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).
+		UpdateId(userID, bson.M{
+			"$addToSet": bson.M{DbUserGroups: groupID},
+			"$set": bson.M{
+				DbUserETag:      newETag(),
+				DbUserUpdatedTs: time.Now().UTC(),
+			},
+		})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrUserNotFound
+		}
+		return errors.Wrap(err, "failed to add user to group")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) RemoveUserFromGroup(ctx context.Context, userID, groupID string) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).
+		UpdateId(userID, bson.M{
+			"$pull": bson.M{DbUserGroups: groupID},
+			"$set": bson.M{
+				DbUserETag:      newETag(),
+				DbUserUpdatedTs: time.Now().UTC(),
+			},
+		})
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return store.ErrUserNotFound
+		}
+		return errors.Wrap(err, "failed to remove user from group")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) DisableExpiredUsers(ctx context.Context, now time.Time) error {
+	return db.forEachTenant(ctx, func(ctx context.Context) error {
+		s := db.copySession(ctx)
+		defer s.Close()
+
+		_, err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).
+			UpdateAll(
+				bson.M{
+					DbUserExpiresAt: bson.M{"$lte": now},
+					DbUserStatus:    bson.M{"$ne": model.UserStatusInactive},
+				},
+				bson.M{
+					"$set": bson.M{
+						DbUserStatus:    model.UserStatusInactive,
+						DbUserETag:      newETag(),
+						DbUserUpdatedTs: now.UTC(),
+					},
+				})
+		if err != nil {
+			return errors.Wrapf(err, "failed to disable expired users in %s",
+				mstore.DbFromContext(ctx, DbName))
+		}
+		return nil
+	})
+}
+
+func (db *DataStoreMongo) CountUsersByTenant(ctx context.Context,
+	activeSince time.Time) ([]model.UserCount, error) {
+	counts := []model.UserCount{}
+	err := db.forEachTenant(ctx, func(ctx context.Context) error {
+		s := db.copySession(ctx)
+		defer s.Close()
+
+		c := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl)
+
+		count := model.UserCount{}
+		if id := identity.FromContext(ctx); id != nil {
+			count.TenantID = id.Tenant
+		}
+
+		var err error
+		count.Total, err = c.Find(nil).Count()
+		if err != nil {
+			return errors.Wrapf(err, "failed to count users in %s",
+				mstore.DbFromContext(ctx, DbName))
+		}
+		count.Active, err = c.Find(bson.M{
+			DbUserLastLoginTs: bson.M{"$gt": activeSince.UTC()},
+			DbUserStatus:      bson.M{"$ne": model.UserStatusInactive},
+		}).Count()
+		if err != nil {
+			return errors.Wrapf(err, "failed to count active users in %s",
+				mstore.DbFromContext(ctx, DbName))
+		}
+
+		counts = append(counts, count)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// forEachTenant calls f for the default database and every tenant database,
+// with the tenant's identity set in the passed context
+func (db *DataStoreMongo) forEachTenant(ctx context.Context, f func(ctx context.Context) error) error {
+	tdbs, err := migrate.GetTenantDbs(db.session, mstore.IsTenantDb(DbName))
+	if err != nil {
+		return errors.Wrap(err, "failed to retrieve tenant DBs")
+	}
+
+	for _, d := range append([]string{DbName}, tdbs...) {
+		tenantCtx := ctx
+		if tenant := mstore.TenantFromDbName(d, DbName); tenant != "" {
+			tenantCtx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tenant,
+			})
+		}
+
+		if err := f(tenantCtx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newETag generates a new version of the user information
+func newETag() string {
+	return uuid.NewV4().String()
+}
+
+// etagQuery matches the documents in any of the given versions; users
+// created before versioning have no ETag until their first update and
+// are matched by the empty one
+func etagQuery(etags []string) bson.M {
+	tags := make([]interface{}, len(etags))
+	for i, tag := range etags {
+		if tag == "" {
+			tags[i] = nil
+		} else {
+			tags[i] = tag
+		}
+	}
+	return bson.M{"$in": tags}
+}
+
+func containsETag(etags []string, etag string) bool {
+	for _, tag := range etags {
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func (db *DataStoreMongo) SaveToken(ctx context.Context, token *jwt.Token) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	c := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
+
+	if err := c.EnsureIndex(tokensTTLIndex); err != nil {
+		return errors.Wrap(err, "failed to ensure tokens index")
+	}
+
+	doc := struct {
+		jwt.Token `bson:",inline"`
+		ExpiresTs *time.Time `bson:"expires_ts,omitempty"`
+	}{
+		Token: *token,
+	}
+	if token.Claims.ExpiresAt > 0 {
+		exp := time.Unix(token.Claims.ExpiresAt, 0).UTC()
+		doc.ExpiresTs = &exp
+	}
+
+	if err := c.Insert(doc); err != nil {
+		return errors.Wrap(err, "failed to store token")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteExpiredTokens(ctx context.Context, now time.Time) (int, error) {
+	removed := 0
+
+	err := db.forEachTenant(ctx, func(ctx context.Context) error {
+		s := db.copySession(ctx)
+		defer s.Close()
+
+		// the TTL index misses tokens stored without the expiry date
+		info, err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).
+			RemoveAll(bson.M{DbTokenExp: bson.M{"$lt": now.Unix()}})
+		if err != nil {
+			return errors.Wrapf(err, "failed to remove expired tokens from %s",
+				mstore.DbFromContext(ctx, DbName))
+		}
+		removed += info.Removed
+		return nil
+	})
+
+	return removed, err
+}
+
+// MigrateTenant migrates the database of the tenant up to the given
+// version, see MigrateTenantTo
+func (db *DataStoreMongo) MigrateTenant(ctx context.Context, version string, tenant string) error {
+	_, err := db.migrateTenant(ctx, version, tenant, false)
+	return err
+}
+
+// migrateTenant migrates the database of the tenant to the given version,
+// down too if asked, and returns the number of migrations run
+func (db *DataStoreMongo) migrateTenant(ctx context.Context, version string, tenant string, down bool) (int, error) {
+	steps, err := db.MigrateTenantTo(ctx, version, tenant, MigrateOptions{Down: down})
+	if err != nil {
+		return len(steps), errors.Wrap(err, "failed to apply migrations")
+	}
+	return len(steps), nil
+}
+
+// encryptUsers encrypts the users stored in plain text, including the
+// deleted ones
+func (db *DataStoreMongo) encryptUsers(ctx context.Context) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	if err := db.EnsureIndexes(ctx, s); err != nil {
+		return err
+	}
+
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+
+	uc, err := db.userCipher(database)
+	if err != nil {
+		return err
+	}
+
+	for _, coll := range []string{DbUsersColl, DbDeletedUsersColl} {
+		c := database.C(coll)
+		iter := c.Find(bson.M{DbUserEmailIndex: bson.M{"$exists": false}}).
+			Select(bson.M{DbUserEmail: 1, DbUserName: 1, DbUserPhone: 1, DbUserEmails: 1}).
+			Iter()
+
+		var user model.User
+		for iter.Next(&user) {
+			keys := uc.emailKeys(user.Email, user.Emails)
+			uc.encryptUser(&user)
+			set := bson.M{
+				DbUserEmail:      user.Email,
+				DbUserEmailIndex: user.EmailIndex,
+			}
+			if len(keys) > 0 {
+				set[DbUserEmailKeys] = keys
+			}
+			if user.Name != "" {
+				set[DbUserName] = user.Name
+			}
+			if user.Phone != "" {
+				set[DbUserPhone] = user.Phone
+			}
+			if len(user.Emails) > 0 {
+				set[DbUserEmails] = user.Emails
+			}
+			err := c.Update(
+				bson.M{"_id": user.ID, DbUserEmailIndex: bson.M{"$exists": false}},
+				bson.M{"$set": set})
+			if err != nil && err != mgo.ErrNotFound {
+				iter.Close()
+				return errors.Wrapf(err, "failed to encrypt user %s", user.ID)
+			}
+			user = model.User{}
+		}
+
+		if err := iter.Close(); err != nil {
+			return errors.Wrap(err, "failed to fetch users")
+		}
+	}
+
+	return nil
+}
+
+// DeleteTenant drops the database of given tenant, with all the users,
+// tokens, settings and login history in it
+func (db *DataStoreMongo) DeleteTenant(ctx context.Context, tenant string) error {
+	if tenant == "" {
+		return errors.New("tenant ID must be provided")
+	}
+
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	err := s.DB(mstore.DbNameForTenant(tenant, DbName)).DropDatabase()
+	if err != nil {
+		return errors.Wrapf(err, "failed to drop database of tenant %s", tenant)
+	}
+
+	// its data key went with it
+	if db.cipher != nil {
+		db.cipher.forget(mstore.DbNameForTenant(tenant, DbName))
+	}
+	return nil
+}
+
+// allTenants returns the IDs of the tenants with a database, or only the
+// default tenant, "", if not in multitenant mode
+func (db *DataStoreMongo) allTenants(ctx context.Context) ([]string, error) {
+	if !db.multitenant {
+		return []string{""}, nil
+	}
+	return db.GetTenantIDs(ctx)
+}
+
+func (db *DataStoreMongo) Migrate(ctx context.Context, version string, migrations []migrate.Migration) error {
+	l := log.FromContext(ctx)
+
+	if db.multitenant {
+		l.Infof("running migrations in multitenant mode")
+	} else {
+		l.Infof("running migrations in single tenant mode")
+	}
+
+	tenants, err := db.allTenants(ctx)
+	if err != nil {
+		return err
+	}
+
+	if db.automigrate {
+		l.Infof("automigrate is ON, will apply migrations")
+	} else {
+		l.Infof("automigrate is OFF, will check db version compatibility")
+	}
+
+	return db.MigrateTenants(ctx, version, tenants, false)
+}
+
+func (db *DataStoreMongo) CreateIdempotencyKey(ctx context.Context, k *model.IdempotencyKey) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	c := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbIdempotencyColl)
+
+	if err := c.EnsureIndex(idempotencyKeysTTLIndex); err != nil {
+		return errors.Wrap(err, "failed to ensure idempotency keys index")
+	}
+
+	if err := c.Insert(k); err != nil {
+		if mgo.IsDup(err) {
+			return store.ErrDuplicateIdempotencyKey
+		}
+		return errors.Wrap(err, "failed to insert idempotency key")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetIdempotencyKey(ctx context.Context, key string) (*model.IdempotencyKey, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	var k model.IdempotencyKey
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbIdempotencyColl).
+		FindId(key).One(&k)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to fetch idempotency key")
+	}
+
+	return &k, nil
+}
+
+func (db *DataStoreMongo) SetIdempotencyKeyUser(ctx context.Context, key, userID string) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbIdempotencyColl).
+		UpdateId(key, bson.M{"$set": bson.M{DbIdempotencyUserID: userID}})
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrap(err, "failed to update idempotency key")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbIdempotencyColl).
+		RemoveId(key)
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrap(err, "failed to remove idempotency key")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) CreatePendingUser(ctx context.Context, p *model.PendingUser) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbPendingUsersColl).
+		Insert(p)
+	if err != nil {
+		return errors.Wrap(err, "failed to insert pending user")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) DeletePendingUser(ctx context.Context, userID string) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbPendingUsersColl).
+		RemoveId(userID)
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrap(err, "failed to remove pending user")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetPendingUsers(ctx context.Context, before time.Time) ([]model.PendingUser, error) {
+	pending := []model.PendingUser{}
+
+	err := db.forEachTenant(ctx, func(ctx context.Context) error {
+		s := db.copySession(ctx)
+		defer s.Close()
+
+		var p []model.PendingUser
+		err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbPendingUsersColl).
+			Find(bson.M{DbPendingUserCreatedTs: bson.M{"$lt": before}}).All(&p)
+		if err != nil {
+			return errors.Wrapf(err, "failed to fetch pending users from %s",
+				mstore.DbFromContext(ctx, DbName))
+		}
+		pending = append(pending, p...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pending, nil
+}
+
+func (db *DataStoreMongo) EnsureIndexes(ctx context.Context, s *mgo.Session) error {
+	database := s.DB(mstore.DbFromContext(ctx, DbName))
+
+	if err := database.C(DbUsersColl).EnsureIndex(uniqueEmailIndex); err != nil {
+		return err
+	}
+
+	if err := database.C(DbUsersColl).EnsureIndex(uniqueUserEmailsIndex); err != nil {
+		return err
+	}
+
+	if err := database.C(DbUsersColl).EnsureIndex(uniqueUsernameIndex); err != nil {
+		return err
+	}
+
+	if db.cipher != nil {
+		if err := database.C(DbUsersColl).EnsureIndex(uniqueEmailBlindIndex); err != nil {
+			return err
+		}
+		if err := database.C(DbUsersColl).EnsureIndex(uniqueUserEmailsBlindIndex); err != nil {
+			return err
+		}
+	}
+
+	if err := database.C(DbGroupsColl).EnsureIndex(uniqueGroupNameIndex); err != nil {
+		return err
+	}
+
+	return database.C(DbServiceAccountsColl).EnsureIndex(uniqueServiceAccountNameIndex)
+}
+
+// WithMultitenant enables multitenant support and returns a new datastore based
+// on current one
+func (db *DataStoreMongo) WithMultitenant() *DataStoreMongo {
+	return &DataStoreMongo{
+		session:              db.session,
+		automigrate:          db.automigrate,
+		multitenant:          true,
+		cipher:               db.cipher,
+		migrationConcurrency: db.migrationConcurrency,
+	}
+}
+
+// WithAutomigrate enables automatic migration and returns a new datastore based
+// on current one
+func (db *DataStoreMongo) WithAutomigrate() *DataStoreMongo {
+	return &DataStoreMongo{
+		session:              db.session,
+		automigrate:          true,
+		multitenant:          db.multitenant,
+		cipher:               db.cipher,
+		migrationConcurrency: db.migrationConcurrency,
+	}
+}
+
+// WithEncryption enables the encryption of the users' personal data with
+// the keyring and returns a new datastore based on current one
+func (db *DataStoreMongo) WithEncryption(keyring *keys.Keyring) *DataStoreMongo {
+	return &DataStoreMongo{
+		session:              db.session,
+		automigrate:          db.automigrate,
+		multitenant:          db.multitenant,
+		cipher:               newFieldCipher(keyring),
+		migrationConcurrency: db.migrationConcurrency,
+	}
+}
+
+// WithMigrationConcurrency sets the number of tenants migrated at a time
+// and returns a new datastore based on current one
+func (db *DataStoreMongo) WithMigrationConcurrency(n int) *DataStoreMongo {
+	return &DataStoreMongo{
+		session:              db.session,
+		automigrate:          db.automigrate,
+		multitenant:          db.multitenant,
+		cipher:               db.cipher,
+		migrationConcurrency: n,
+	}
+}
+
+// userCipher returns the cipher of the users in the database,
+// nil if they're not encrypted
+func (db *DataStoreMongo) userCipher(database *mgo.Database) (*userCipher, error) {
+	if db.cipher == nil {
+		return nil, nil
+	}
+	return db.cipher.forDatabase(database)
+}
+
+// deletes all tenant's tokens (identity in context)
+func (db *DataStoreMongo) DeleteTokens(ctx context.Context) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	c := db.session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
+	ci, err := c.RemoveAll(nil)
+
+	if ci.Removed == 0 {
+		return store.ErrTokenNotFound
+	}
+
+	return err
+}
+
+// deletes all user's tokens
+func (db *DataStoreMongo) GetTokensByUserId(ctx context.Context, userId string) ([]jwt.Token, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	tokens := []jwt.Token{}
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).
+		Find(bson.M{DbTokenSub: userId}).
+		Sort("claims.iat").
+		All(&tokens)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch tokens")
+	}
+
+	return tokens, nil
+}
+
+func (db *DataStoreMongo) DeleteTokensByUserId(ctx context.Context, userId string) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	c := db.session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl)
+	filter := bson.M{
+		DbTokenSub: userId,
+	}
+	ci, err := c.RemoveAll(filter)
+
+	if ci.Removed == 0 {
+		return store.ErrTokenNotFound
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "failed to remove tokens")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) SetLimit(ctx context.Context, l *model.Limit) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	_, err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbLimitsColl).
+		UpsertId(l.Name, l)
+	if err != nil {
+		return errors.Wrap(err, "failed to store limit")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetLimit(ctx context.Context, name string) (*model.Limit, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	var limit model.Limit
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbLimitsColl).
+		FindId(name).One(&limit)
+	switch err {
+	case nil:
+		return &limit, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(err, "failed to fetch limit")
+	}
+}
+
+// the plan collection holds a single document
+const dbPlanId = "plan"
+
+func (db *DataStoreMongo) SetPlan(ctx context.Context, p *model.Plan) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	_, err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbPlanColl).
+		UpsertId(dbPlanId, p)
+	if err != nil {
+		return errors.Wrap(err, "failed to store plan")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetPlan(ctx context.Context) (*model.Plan, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	var plan model.Plan
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbPlanColl).
+		FindId(dbPlanId).One(&plan)
+	switch err {
+	case nil:
+		return &plan, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(err, "failed to fetch plan")
+	}
+}
+
+// the tenant status collection holds a single document
+const dbTenantStatusId = "status"
+
+func (db *DataStoreMongo) SetTenantStatus(ctx context.Context, st *model.TenantStatus) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	_, err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbTenantStatusColl).
+		UpsertId(dbTenantStatusId, st)
+	if err != nil {
+		return errors.Wrap(err, "failed to store tenant status")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetTenantStatus(ctx context.Context) (*model.TenantStatus, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	var status model.TenantStatus
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbTenantStatusColl).
+		FindId(dbTenantStatusId).One(&status)
+	switch err {
+	case nil:
+		return &status, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(err, "failed to fetch tenant status")
+	}
+}
+
+func (db *DataStoreMongo) SetFeature(ctx context.Context, f *model.Feature) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	_, err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbFeaturesColl).
+		UpsertId(f.Name, f)
+	if err != nil {
+		return errors.Wrap(err, "failed to store feature")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteFeature(ctx context.Context, name string) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbFeaturesColl).
+		RemoveId(name)
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrap(err, "failed to remove feature")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetFeatures(ctx context.Context) ([]model.Feature, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	features := []model.Feature{}
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbFeaturesColl).
+		Find(nil).Sort("_id").All(&features)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch features")
+	}
+
+	return features, nil
+}
+
+func (db *DataStoreMongo) SaveSettings(ctx context.Context, s map[string]interface{},
+	ifMatch []string) (string, error) {
+	return db.replaceSettings(ctx, ifMatch,
+		func(map[string]interface{}) (map[string]interface{}, error) {
+			return s, nil
+		})
+}
+
+func (db *DataStoreMongo) SaveSetting(ctx context.Context, key string, value interface{},
+	ifMatch []string) (string, error) {
+	return db.replaceSettings(ctx, ifMatch,
+		func(current map[string]interface{}) (map[string]interface{}, error) {
+			current[key] = value
+			return current, nil
+		})
+}
+
+func (db *DataStoreMongo) DeleteSetting(ctx context.Context, key string,
+	ifMatch []string) (string, error) {
+	return db.replaceSettings(ctx, ifMatch,
+		func(current map[string]interface{}) (map[string]interface{}, error) {
+			if _, ok := current[key]; !ok {
+				return nil, store.ErrSettingNotFound
+			}
+			delete(current, key)
+			return current, nil
+		})
+}
+
+// replaceSettings replaces the settings with the ones returned by fn for
+// the current settings (without the keys maintained here), keeping the
+// replaced version in the history; concurrent modifications are retried
+// unless ifMatch is given
+func (db *DataStoreMongo) replaceSettings(ctx context.Context, ifMatch []string,
+	fn func(current map[string]interface{}) (map[string]interface{}, error)) (string, error) {
+	for i := 0; ; i++ {
+		etag, err := db.tryReplaceSettings(ctx, ifMatch, fn)
+		if err != errSettingsModified {
+			return etag, err
+		}
+		if len(ifMatch) > 0 || i >= settingsReplaceRetries {
+			return "", store.ErrSettingsETagMismatch
+		}
+	}
+}
+
+func (db *DataStoreMongo) tryReplaceSettings(ctx context.Context, ifMatch []string,
+	fn func(current map[string]interface{}) (map[string]interface{}, error)) (string, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	database := sess.DB(mstore.DbFromContext(ctx, DbName))
+	c := database.C(DbSettingsColl)
+
+	var existing bson.M
+	err := c.Find(nil).One(&existing)
+	switch err {
+	case nil:
+	case mgo.ErrNotFound:
+		existing = nil
+	default:
+		return "", errors.Wrap(err, "failed to get settings")
+	}
+
+	// settings predating versioning match no ETag
+	existingETag, _ := existing[DbSettingsETag].(string)
+	if len(ifMatch) > 0 && (existing == nil || !containsETag(ifMatch, existingETag)) {
+		return "", store.ErrSettingsETagMismatch
+	}
+
+	current := map[string]interface{}{}
+	for k, v := range existing {
+		switch k {
+		case "_id", DbSettingsCreatedTs, DbSettingsUpdatedTs, DbSettingsETag:
+		default:
+			current[k] = v
+		}
+	}
+
+	s, err := fn(current)
+	if err != nil {
+		return "", err
+	}
+
+	// timestamps and ETag are maintained here, the creation time is
+	// carried over from the settings being replaced
+	now := time.Now().UTC()
+	etag := newETag()
+
+	doc := bson.M{}
+	for k, v := range s {
+		doc[k] = v
+	}
+	doc[DbSettingsCreatedTs] = now
+	doc[DbSettingsUpdatedTs] = now
+	doc[DbSettingsETag] = etag
+
+	if existing == nil {
+		_, err = c.Upsert(bson.M{}, doc)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to store settings %v", s)
+		}
+		return etag, nil
+	}
+
+	if createdTs, ok := existing[DbSettingsCreatedTs].(time.Time); ok {
+		doc[DbSettingsCreatedTs] = createdTs.UTC()
+	}
+
+	// replace only the version read above, so that none is missing
+	// from the history
+	query := bson.M{"_id": existing["_id"], DbSettingsETag: existingETag}
+	if existingETag == "" {
+		query[DbSettingsETag] = bson.M{"$exists": false}
+	}
+	err = c.Update(query, doc)
+	switch err {
+	case nil:
+	case mgo.ErrNotFound:
+		return "", errSettingsModified
+	default:
+		return "", errors.Wrapf(err, "failed to store settings %v", s)
+	}
+
+	if err := db.addSettingsVersion(database, existing, now); err != nil {
+		return "", err
+	}
+
+	return etag, nil
+}
+
+// addSettingsVersion stores the replaced settings in the history,
+// dropping the oldest versions over SettingsHistoryLength
+func (db *DataStoreMongo) addSettingsVersion(database *mgo.Database,
+	settings bson.M, replaced time.Time) error {
+	c := database.C(DbSettingsHistColl)
+
+	version := model.SettingsVersion{
+		ETag:       newETag(),
+		ReplacedTs: replaced,
+		Settings:   map[string]interface{}{},
+	}
+	for k, v := range settings {
+		switch k {
+		case "_id":
+		case DbSettingsETag:
+			if etag, ok := v.(string); ok {
+				version.ETag = etag
+			}
+		default:
+			version.Settings[k] = v
+		}
+	}
+
+	if err := c.Insert(version); err != nil {
+		return errors.Wrap(err, "failed to store settings version")
+	}
+
+	var old []struct {
+		ID string `bson:"_id"`
+	}
+	err := c.Find(nil).
+		Sort("-" + DbSettingsVersionReplacedTs).
+		Skip(SettingsHistoryLength).
+		Select(bson.M{"_id": 1}).
+		All(&old)
+	if err != nil {
+		return errors.Wrap(err, "failed to get old settings versions")
+	}
+
+	if len(old) > 0 {
+		ids := make([]string, len(old))
+		for i, v := range old {
+			ids[i] = v.ID
+		}
+		_, err = c.RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return errors.Wrap(err, "failed to remove old settings versions")
+		}
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetSettings(ctx context.Context) (map[string]interface{}, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	c := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsColl)
+
+	var settings map[string]interface{}
+
+	err := c.Find(nil).
+		Select(bson.M{"_id": 0}).
+		One(&settings)
+
+	switch err {
+	case nil:
+	case mgo.ErrNotFound:
+		return map[string]interface{}{}, nil
+	default:
+		return nil, errors.Wrapf(err, "failed to get settings")
+	}
+
+	return settings, nil
+}
+
+func (db *DataStoreMongo) GetSettingsHistory(ctx context.Context) ([]model.SettingsVersion, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	versions := []model.SettingsVersion{}
+
+	err := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsHistColl).
+		Find(nil).
+		Sort("-" + DbSettingsVersionReplacedTs).
+		All(&versions)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get settings history")
+	}
+
+	return versions, nil
+}
+
+func (db *DataStoreMongo) RollbackSettings(ctx context.Context, etag string,
+	ifMatch []string) (string, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var version model.SettingsVersion
+
+	err := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsHistColl).
+		FindId(etag).
+		One(&version)
+	switch err {
+	case nil:
+	case mgo.ErrNotFound:
+		return "", store.ErrSettingsVersionNotFound
+	default:
+		return "", errors.Wrap(err, "failed to get settings version")
+	}
+
+	return db.SaveSettings(ctx, version.Settings, ifMatch)
+}
+
+func (db *DataStoreMongo) SaveSettingsSchema(ctx context.Context, schema string) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	_, err := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsSchemaColl).
+		UpsertId(DbSettingsSchemaID, bson.M{DbSettingsSchemaSchema: schema})
+	if err != nil {
+		return errors.Wrap(err, "failed to store settings schema")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetSettingsSchema(ctx context.Context) (string, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var doc struct {
+		Schema string `bson:"schema"`
+	}
+
+	err := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsSchemaColl).
+		FindId(DbSettingsSchemaID).
+		One(&doc)
+	switch err {
+	case nil:
+		return doc.Schema, nil
+	case mgo.ErrNotFound:
+		return "", nil
+	default:
+		return "", errors.Wrap(err, "failed to get settings schema")
+	}
+}
+
+func (db *DataStoreMongo) DeleteSettingsSchema(ctx context.Context) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	err := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsSchemaColl).
+		RemoveId(DbSettingsSchemaID)
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrap(err, "failed to remove settings schema")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) SaveUserSettings(ctx context.Context, userID string,
+	s map[string]interface{}) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	c := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbUserSettingsColl)
+
+	now := time.Now().UTC()
+
+	doc := bson.M{}
+	for k, v := range s {
+		doc[k] = v
+	}
+	doc["_id"] = userID
+	doc[DbSettingsCreatedTs] = now
+	doc[DbSettingsUpdatedTs] = now
+
+	var existing struct {
+		CreatedTs *time.Time `bson:"created_ts"`
+	}
+	err := c.FindId(userID).Select(bson.M{DbSettingsCreatedTs: 1}).One(&existing)
+	switch {
+	case err == nil && existing.CreatedTs != nil:
+		doc[DbSettingsCreatedTs] = existing.CreatedTs.UTC()
+	case err != nil && err != mgo.ErrNotFound:
+		return errors.Wrap(err, "failed to get user settings")
+	}
+
+	_, err = c.UpsertId(userID, doc)
+	if err != nil {
+		return errors.Wrapf(err, "failed to store settings of user %s", userID)
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetUserSettings(ctx context.Context,
+	userID string) (map[string]interface{}, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	c := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbUserSettingsColl)
+
+	var settings map[string]interface{}
+
+	err := c.FindId(userID).
+		Select(bson.M{"_id": 0}).
+		One(&settings)
+
+	switch err {
+	case nil:
+		return settings, nil
+	case mgo.ErrNotFound:
+		return map[string]interface{}{}, nil
+	default:
+		return nil, errors.Wrapf(err, "failed to get settings of user %s", userID)
+	}
+}
+
+// SaveJobRun records the run of the background job in its status, kept
+// in the default database for all the instances of the service
+func (db *DataStoreMongo) SaveJobRun(ctx context.Context, run *model.JobRun) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var status model.JobStatus
+	status.Apply(run)
+
+	c := sess.DB(DbName).C(DbJobsColl)
+
+	if run.Skipped {
+		_, err := c.UpsertId(run.Name, bson.M{
+			"$set": bson.M{DbJobLastSkippedTs: status.LastSkippedTs},
+			"$inc": bson.M{DbJobSkips: 1},
+		})
+		if err != nil {
+			return errors.Wrapf(err, "failed to record skipped run of job %s", run.Name)
+		}
+		return nil
+	}
+
+	set := bson.M{
+		DbJobLastStartedTs:  status.LastStartedTs,
+		DbJobLastFinishedTs: status.LastFinishedTs,
+		DbJobLastDurationMs: status.LastDurationMs,
+		DbJobLastError:      status.LastError,
+	}
+	if status.LastSuccessTs != nil {
+		set[DbJobLastSuccessTs] = status.LastSuccessTs
+	}
+
+	_, err := c.UpsertId(run.Name, bson.M{
+		"$set": set,
+		"$inc": bson.M{
+			DbJobRuns:     status.Runs,
+			DbJobFailures: status.Failures,
+		},
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to record run of job %s", run.Name)
+	}
+	return nil
+}
+
+// AcquireJobLease makes holder the holder of the job's lease, kept in the
+// default database for all the instances of the service; the lease
+// document is created, or taken over from its holder once it expired
+func (db *DataStoreMongo) AcquireJobLease(ctx context.Context, name, holder string,
+	until time.Time) (bool, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	_, err := sess.DB(DbName).C(DbJobLeasesColl).Upsert(
+		bson.M{
+			"_id": name,
+			"$or": []bson.M{
+				{DbJobLeaseHolder: holder},
+				{DbJobLeaseUntil: bson.M{"$lte": time.Now().UTC()}},
+			},
+		},
+		bson.M{"$set": bson.M{
+			DbJobLeaseHolder: holder,
+			DbJobLeaseUntil:  until.UTC(),
+		}})
+	switch {
+	case err == nil:
+		return true, nil
+	case mgo.IsDup(err):
+		// held by another instance, the upsert collided with it
+		return false, nil
+	default:
+		return false, errors.Wrapf(err, "failed to acquire lease of job %s", name)
+	}
+}
+
+// GetJobStatuses returns the status of the background jobs which have
+// run, by name
+func (db *DataStoreMongo) GetJobStatuses(ctx context.Context) ([]model.JobStatus, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	statuses := []model.JobStatus{}
+	err := sess.DB(DbName).C(DbJobsColl).Find(nil).Sort("_id").All(&statuses)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch job statuses")
+	}
+	return statuses, nil
+}
+
+// SaveMaintenance stores the maintenance mode in the default database,
+// as a single document shared by all the instances of the service
+func (db *DataStoreMongo) SaveMaintenance(ctx context.Context, s *model.MaintenanceState) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	_, err := sess.DB(DbName).C(DbMaintenanceColl).UpsertId(DbMaintenanceColl, s)
+	if err != nil {
+		return errors.Wrap(err, "failed to store maintenance mode")
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) GetMaintenance(ctx context.Context) (*model.MaintenanceState, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var s model.MaintenanceState
+	err := sess.DB(DbName).C(DbMaintenanceColl).FindId(DbMaintenanceColl).One(&s)
+	switch err {
+	case nil:
+		return &s, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(err, "failed to fetch maintenance mode")
+	}
+}
+
+// RevokeTokens makes the tokens of the user, or of all the users if
+// userId is empty, issued up to the given time invalid
+func (db *DataStoreMongo) RevokeTokens(ctx context.Context, userId string, ts time.Time) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	_, err := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensRevokedColl).
+		UpsertId(userId, bson.M{"$max": bson.M{DbTokensRevokedTs: ts}})
+	if err != nil {
+		return errors.Wrap(err, "failed to revoke tokens")
+	}
+	return nil
+}
+
+// GetTokensRevokedTs returns the time up to which the tokens of the user
+// are revoked, for the user or for all the users; the zero time if they
+// never were
+func (db *DataStoreMongo) GetTokensRevokedTs(ctx context.Context, userId string) (time.Time, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var revoked []struct {
+		Ts time.Time `bson:"revoked_ts"`
+	}
+	err := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensRevokedColl).
+		Find(bson.M{"_id": bson.M{"$in": []string{"", userId}}}).
+		All(&revoked)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to get token revocation time")
+	}
+
+	var ts time.Time
+	for _, r := range revoked {
+		if r.Ts.After(ts) {
+			ts = r.Ts
+		}
 	}
+	return ts, nil
+}
+
+// SaveTokenRevocation inserts or replaces the revocation job
+func (db *DataStoreMongo) SaveTokenRevocation(ctx context.Context, r *model.TokenRevocation) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
 
+	_, err := sess.DB(DbName).C(DbTokenRevocationsColl).UpsertId(r.ID, r)
 	if err != nil {
-		return errors.Wrap(err, "failed to remove tokens")
+		return errors.Wrapf(err, "failed to store token revocation %s", r.ID)
+	}
+	return nil
+}
+
+// GetTokenRevocation returns nil,nil if not found
+func (db *DataStoreMongo) GetTokenRevocation(ctx context.Context, id string) (*model.TokenRevocation, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var r model.TokenRevocation
+	err := sess.DB(DbName).C(DbTokenRevocationsColl).FindId(id).One(&r)
+	switch err {
+	case nil:
+		return &r, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrapf(err, "failed to fetch token revocation %s", id)
+	}
+}
+
+// ClaimTokenRevocation marks the oldest pending revocation, or one
+// running since before staleBefore, e.g. by an instance which was
+// stopped, as running and returns it; nil,nil if there's none
+func (db *DataStoreMongo) ClaimTokenRevocation(ctx context.Context,
+	now, staleBefore time.Time) (*model.TokenRevocation, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var r model.TokenRevocation
+	_, err := sess.DB(DbName).C(DbTokenRevocationsColl).
+		Find(bson.M{"$or": []bson.M{
+			{DbTokenRevocationStatus: model.RevocationStatusPending},
+			{
+				DbTokenRevocationStatus:    model.RevocationStatusRunning,
+				DbTokenRevocationStartedTs: bson.M{"$lt": staleBefore},
+			},
+		}}).
+		Sort(DbTokenRevocationCreatedTs).
+		Apply(mgo.Change{
+			Update: bson.M{"$set": bson.M{
+				DbTokenRevocationStatus:    model.RevocationStatusRunning,
+				DbTokenRevocationStartedTs: now,
+			}},
+			ReturnNew: true,
+		}, &r)
+	switch err {
+	case nil:
+		return &r, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(err, "failed to claim token revocation")
+	}
+}
+
+// tenantID returns the tenant from the identity in the context
+func tenantID(ctx context.Context) string {
+	if id := identity.FromContext(ctx); id != nil {
+		return id.Tenant
 	}
+	return ""
+}
+
+func (db *DataStoreMongo) CreateOAuthClient(ctx context.Context, c *model.OAuthClient) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
 
+	c.TenantID = tenantID(ctx)
+	if err := sess.DB(DbName).C(DbOAuthClientsColl).Insert(c); err != nil {
+		return errors.Wrapf(err, "failed to store client %s", c.ID)
+	}
 	return nil
 }
 
-func (db *DataStoreMongo) SaveSettings(ctx context.Context, s map[string]interface{}) error {
-	sess := db.session.Copy()
+// GetOAuthClientById returns nil,nil if not found
+func (db *DataStoreMongo) GetOAuthClientById(ctx context.Context,
+	id string) (*model.OAuthClient, error) {
+	sess := db.copySession(ctx)
 	defer sess.Close()
 
-	c := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsColl)
+	var c model.OAuthClient
+	err := sess.DB(DbName).C(DbOAuthClientsColl).FindId(id).One(&c)
+	switch err {
+	case nil:
+		return &c, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrapf(err, "failed to fetch client %s", id)
+	}
+}
+
+func (db *DataStoreMongo) GetOAuthClients(ctx context.Context) ([]model.OAuthClient, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
 
-	_, err := c.Upsert(bson.M{}, s)
+	clients := []model.OAuthClient{}
+	err := sess.DB(DbName).C(DbOAuthClientsColl).
+		Find(bson.M{DbOAuthClientTenantID: tenantID(ctx)}).
+		Sort(DbOAuthClientCreatedTs).
+		All(&clients)
 	if err != nil {
-		return errors.Wrapf(err, "failed to store settings %v", s)
+		return nil, errors.Wrap(err, "failed to fetch clients")
+	}
+	return clients, nil
+}
+
+func (db *DataStoreMongo) DeleteOAuthClient(ctx context.Context, id string) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	err := sess.DB(DbName).C(DbOAuthClientsColl).Remove(bson.M{
+		"_id":                 id,
+		DbOAuthClientTenantID: tenantID(ctx),
+	})
+	switch err {
+	case nil:
+		return nil
+	case mgo.ErrNotFound:
+		return store.ErrOAuthClientNotFound
+	default:
+		return errors.Wrapf(err, "failed to remove client %s", id)
+	}
+}
+
+func (db *DataStoreMongo) SaveOAuthCode(ctx context.Context, c *model.OAuthCode) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	coll := sess.DB(DbName).C(DbOAuthCodesColl)
+	if err := coll.EnsureIndex(oauthCodesTTLIndex); err != nil {
+		return errors.Wrap(err, "failed to create authorization codes index")
 	}
 
+	if err := coll.Insert(c); err != nil {
+		return errors.Wrap(err, "failed to store authorization code")
+	}
 	return nil
 }
 
-func (db *DataStoreMongo) GetSettings(ctx context.Context) (map[string]interface{}, error) {
-	sess := db.session.Copy()
+// TakeOAuthCode returns nil,nil if not found
+func (db *DataStoreMongo) TakeOAuthCode(ctx context.Context,
+	id string) (*model.OAuthCode, error) {
+	sess := db.copySession(ctx)
 	defer sess.Close()
 
-	c := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsColl)
+	var c model.OAuthCode
+	_, err := sess.DB(DbName).C(DbOAuthCodesColl).
+		FindId(id).
+		Apply(mgo.Change{Remove: true}, &c)
+	switch err {
+	case nil:
+		return &c, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(err, "failed to fetch authorization code")
+	}
+}
 
-	var settings map[string]interface{}
+func (db *DataStoreMongo) SaveLoginLink(ctx context.Context, l *model.LoginLink) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
 
-	err := c.Find(nil).
-		Select(bson.M{"_id": 0}).
-		One(&settings)
+	coll := sess.DB(DbName).C(DbLoginLinksColl)
+	for _, idx := range []mgo.Index{loginLinksTTLIndex, loginLinksUserIndex} {
+		if err := coll.EnsureIndex(idx); err != nil {
+			return errors.Wrap(err, "failed to create login links index")
+		}
+	}
 
+	if err := coll.Insert(l); err != nil {
+		return errors.Wrap(err, "failed to store login link")
+	}
+	return nil
+}
+
+// TakeLoginLink returns nil,nil if not found
+func (db *DataStoreMongo) TakeLoginLink(ctx context.Context,
+	id string) (*model.LoginLink, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var l model.LoginLink
+	_, err := sess.DB(DbName).C(DbLoginLinksColl).
+		FindId(id).
+		Apply(mgo.Change{Remove: true}, &l)
 	switch err {
 	case nil:
-		return settings, nil
+		return &l, nil
 	case mgo.ErrNotFound:
-		return map[string]interface{}{}, nil
+		return nil, nil
 	default:
-		return nil, errors.Wrapf(err, "failed to get settings")
+		return nil, errors.Wrap(err, "failed to fetch login link")
+	}
+}
+
+// GetLatestLoginLink returns nil,nil if not found
+func (db *DataStoreMongo) GetLatestLoginLink(ctx context.Context,
+	tenantID, userID string) (*model.LoginLink, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var l model.LoginLink
+	err := sess.DB(DbName).C(DbLoginLinksColl).
+		Find(bson.M{
+			DbLoginLinkTenantID: tenantID,
+			DbLoginLinkUserID:   userID,
+		}).
+		Sort("-" + DbLoginLinkCreatedTs).
+		One(&l)
+	switch err {
+	case nil:
+		return &l, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(err, "failed to fetch login link")
+	}
+}
+
+func (db *DataStoreMongo) CreateDeviceAuthorization(ctx context.Context,
+	a *model.DeviceAuthorization) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	coll := sess.DB(DbName).C(DbDeviceAuthorizationsColl)
+	for _, idx := range []mgo.Index{deviceAuthorizationsTTLIndex, uniqueUserCodeIndex} {
+		if err := coll.EnsureIndex(idx); err != nil {
+			return errors.Wrap(err, "failed to create device authorizations index")
+		}
+	}
+
+	if err := coll.Insert(a); err != nil {
+		if mgo.IsDup(err) {
+			return store.ErrDuplicateUserCode
+		}
+		return errors.Wrap(err, "failed to store device authorization")
+	}
+	return nil
+}
+
+// GetDeviceAuthorization returns nil,nil if not found
+func (db *DataStoreMongo) GetDeviceAuthorization(ctx context.Context,
+	id string) (*model.DeviceAuthorization, error) {
+	return db.findDeviceAuthorization(ctx, bson.M{"_id": id})
+}
+
+// GetDeviceAuthorizationByUserCode returns nil,nil if not found
+func (db *DataStoreMongo) GetDeviceAuthorizationByUserCode(ctx context.Context,
+	userCode string) (*model.DeviceAuthorization, error) {
+	return db.findDeviceAuthorization(ctx, bson.M{DbDeviceAuthorizationUserCode: userCode})
+}
+
+func (db *DataStoreMongo) findDeviceAuthorization(ctx context.Context,
+	q bson.M) (*model.DeviceAuthorization, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var a model.DeviceAuthorization
+	err := sess.DB(DbName).C(DbDeviceAuthorizationsColl).Find(q).One(&a)
+	switch err {
+	case nil:
+		return &a, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(err, "failed to fetch device authorization")
+	}
+}
+
+func (db *DataStoreMongo) ResolveDeviceAuthorization(ctx context.Context, id string,
+	r model.DeviceAuthorizationResolution) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	err := sess.DB(DbName).C(DbDeviceAuthorizationsColl).Update(
+		bson.M{
+			"_id":                       id,
+			DbDeviceAuthorizationStatus: model.DeviceAuthorizationPending,
+		},
+		bson.M{"$set": bson.M{
+			DbDeviceAuthorizationStatus:   r.Status,
+			DbDeviceAuthorizationTenantID: r.TenantID,
+			DbDeviceAuthorizationUserID:   r.UserID,
+			DbDeviceAuthorizationScope:    r.Scope,
+		}})
+	switch err {
+	case nil:
+		return nil
+	case mgo.ErrNotFound:
+		return store.ErrDeviceAuthorizationNotFound
+	default:
+		return errors.Wrap(err, "failed to update device authorization")
+	}
+}
+
+func (db *DataStoreMongo) SetDeviceAuthorizationPolled(ctx context.Context, id string,
+	ts time.Time, interval int) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	err := sess.DB(DbName).C(DbDeviceAuthorizationsColl).UpdateId(id,
+		bson.M{"$set": bson.M{
+			DbDeviceAuthorizationPolledTs: ts,
+			DbDeviceAuthorizationInterval: interval,
+		}})
+	if err != nil && err != mgo.ErrNotFound {
+		return errors.Wrap(err, "failed to update device authorization")
+	}
+	return nil
+}
+
+func (db *DataStoreMongo) DeleteDeviceAuthorization(ctx context.Context, id string) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	err := sess.DB(DbName).C(DbDeviceAuthorizationsColl).RemoveId(id)
+	switch err {
+	case nil:
+		return nil
+	case mgo.ErrNotFound:
+		return store.ErrDeviceAuthorizationNotFound
+	default:
+		return errors.Wrap(err, "failed to remove device authorization")
+	}
+}
+
+func (db *DataStoreMongo) SaveSession(ctx context.Context, s *model.Session) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	coll := sess.DB(DbName).C(DbSessionsColl)
+	if err := coll.EnsureIndex(sessionsTTLIndex); err != nil {
+		return errors.Wrap(err, "failed to create sessions index")
+	}
+
+	if err := coll.Insert(s); err != nil {
+		return errors.Wrap(err, "failed to store session")
+	}
+	return nil
+}
+
+// GetSession returns nil,nil if not found
+func (db *DataStoreMongo) GetSession(ctx context.Context, id string) (*model.Session, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var s model.Session
+	err := sess.DB(DbName).C(DbSessionsColl).FindId(id).One(&s)
+	switch err {
+	case nil:
+		return &s, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(err, "failed to fetch session")
+	}
+}
+
+func (db *DataStoreMongo) SaveLoginOTP(ctx context.Context, otp *model.LoginOTP) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	coll := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbLoginOTPsColl)
+	if err := coll.EnsureIndex(loginOTPsTTLIndex); err != nil {
+		return errors.Wrap(err, "failed to create login codes index")
+	}
+
+	if _, err := coll.UpsertId(otp.UserID, otp); err != nil {
+		return errors.Wrap(err, "failed to store login code")
+	}
+	return nil
+}
+
+// GetLoginOTP returns nil,nil if not found
+func (db *DataStoreMongo) GetLoginOTP(ctx context.Context,
+	userID string) (*model.LoginOTP, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var otp model.LoginOTP
+	err := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbLoginOTPsColl).
+		FindId(userID).One(&otp)
+	switch err {
+	case nil:
+		return &otp, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(err, "failed to fetch login code")
+	}
+}
+
+func (db *DataStoreMongo) TakeLoginOTPAttempt(ctx context.Context, userID string,
+	now time.Time) (*model.LoginOTP, error) {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	var otp model.LoginOTP
+	_, err := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbLoginOTPsColl).
+		Find(bson.M{
+			"_id":               userID,
+			DbLoginOTPAttempts:  bson.M{"$lt": model.MaxLoginOTPAttempts},
+			DbLoginOTPExpiresTs: bson.M{"$gt": now},
+		}).
+		Apply(mgo.Change{
+			Update: bson.M{"$inc": bson.M{DbLoginOTPAttempts: 1}},
+		}, &otp)
+	switch err {
+	case nil:
+		return &otp, nil
+	case mgo.ErrNotFound:
+		return nil, nil
+	default:
+		return nil, errors.Wrap(err, "failed to update login code")
+	}
+}
+
+func (db *DataStoreMongo) DeleteLoginOTP(ctx context.Context, userID string) error {
+	sess := db.copySession(ctx)
+	defer sess.Close()
+
+	err := sess.DB(mstore.DbFromContext(ctx, DbName)).C(DbLoginOTPsColl).
+		RemoveId(userID)
+	switch err {
+	case nil:
+		return nil
+	case mgo.ErrNotFound:
+		return store.ErrLoginOTPNotFound
+	default:
+		return errors.Wrap(err, "failed to remove login code")
+	}
+}
+
+func (db *DataStoreMongo) CreateServiceAccount(ctx context.Context,
+	a *model.ServiceAccount) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	if err := db.EnsureIndexes(ctx, s); err != nil {
+		return err
+	}
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbServiceAccountsColl).Insert(a)
+	if err != nil {
+		if mgo.IsDup(err) {
+			return store.ErrDuplicateServiceAccountName
+		}
+
+		return errors.Wrap(err, "failed to insert service account")
+	}
+
+	return nil
+}
+
+func (db *DataStoreMongo) GetServiceAccounts(ctx context.Context) ([]model.ServiceAccount, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	accounts := []model.ServiceAccount{}
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbServiceAccountsColl).
+		Find(nil).
+		Sort(DbServiceAccountName).
+		All(&accounts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch service accounts")
+	}
+
+	return accounts, nil
+}
+
+func (db *DataStoreMongo) GetServiceAccountById(ctx context.Context,
+	id string) (*model.ServiceAccount, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	var account model.ServiceAccount
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbServiceAccountsColl).
+		FindId(id).
+		One(&account)
+	if err != nil {
+		if err == mgo.ErrNotFound {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to fetch service account")
+	}
+
+	return &account, nil
+}
+
+func (db *DataStoreMongo) UpdateServiceAccount(ctx context.Context, id string,
+	u *model.ServiceAccountUpdate) (*model.ServiceAccount, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	set := bson.M{
+		DbServiceAccountUpdatedTs: time.Now().UTC(),
+	}
+	if u.Description != nil {
+		set[DbServiceAccountDescription] = *u.Description
+	}
+	if u.Scope != nil {
+		set[DbServiceAccountScope] = *u.Scope
+	}
+	if u.Owner != nil {
+		set[DbServiceAccountOwner] = *u.Owner
+	}
+
+	var account model.ServiceAccount
+
+	_, err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbServiceAccountsColl).
+		FindId(id).
+		Apply(mgo.Change{
+			Update:    bson.M{"$set": set},
+			ReturnNew: true,
+		}, &account)
+	switch err {
+	case nil:
+		return &account, nil
+	case mgo.ErrNotFound:
+		return nil, store.ErrServiceAccountNotFound
+	default:
+		return nil, errors.Wrap(err, "failed to update service account")
+	}
+}
+
+func (db *DataStoreMongo) DeleteServiceAccount(ctx context.Context, id string) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	err := s.DB(mstore.DbFromContext(ctx, DbName)).C(DbServiceAccountsColl).RemoveId(id)
+	switch err {
+	case nil:
+		return nil
+	case mgo.ErrNotFound:
+		return store.ErrServiceAccountNotFound
+	default:
+		return errors.Wrapf(err, "failed to remove service account %s", id)
 	}
 }
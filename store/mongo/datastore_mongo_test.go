@@ -16,6 +16,7 @@ package mongo
 import (
 	"context"
 	"fmt"
+	"sort"
 	"testing"
 	"time"
 	"unsafe"
@@ -143,6 +144,14 @@ func TestMongoUpdateUser(t *testing.T) {
 			Email:    "bar@bar.com",
 			Password: "pretenditsahash",
 		},
+		model.User{
+			ID:         "3",
+			Email:      "baz@bar.com",
+			Password:   "pretenditsahash",
+			Name:       "Baz",
+			Locale:     "en-US",
+			Attributes: map[string]string{"department": "rnd"},
+		},
 	}
 
 	testCases := map[string]struct {
@@ -173,6 +182,21 @@ func TestMongoUpdateUser(t *testing.T) {
 			inUserId: "1",
 			outErr:   "",
 		},
+		"update status: ok": {
+			inUserUpdate: model.UserUpdate{
+				Status: model.UserStatusInactive,
+			},
+			inUserId: "1",
+			outErr:   "",
+		},
+		"update and clear fields: ok": {
+			inUserUpdate: model.UserUpdate{
+				Locale: "nb-NO",
+				Clear:  []string{"name", "attributes"},
+			},
+			inUserId: "3",
+			outErr:   "",
+		},
 		"ok with tenant": {
 			inUserUpdate: model.UserUpdate{
 				Email:    "baz@bar.com",
@@ -226,6 +250,20 @@ func TestMongoUpdateUser(t *testing.T) {
 				if tc.inUserUpdate.Email != "" {
 					assert.Equal(t, user.Email, tc.inUserUpdate.Email)
 				}
+				if tc.inUserUpdate.Status != "" {
+					assert.Equal(t, user.Status, tc.inUserUpdate.Status)
+				}
+				if tc.inUserUpdate.Locale != "" {
+					assert.Equal(t, user.Locale, tc.inUserUpdate.Locale)
+				}
+				for _, field := range tc.inUserUpdate.Clear {
+					n, err := session.DB(mstore.DbFromContext(ctx, DbName)).
+						C(DbUsersColl).
+						Find(bson.M{"_id": tc.inUserId, field: bson.M{"$exists": true}}).
+						Count()
+					assert.NoError(t, err)
+					assert.Equal(t, 0, n, field)
+				}
 			} else {
 				assert.EqualError(t, err, tc.outErr)
 			}
@@ -235,6 +273,83 @@ func TestMongoUpdateUser(t *testing.T) {
 	}
 }
 
+func TestMongoUserETag(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	err = store.CreateUser(ctx, &model.User{
+		ID:       "1",
+		Email:    "foo@bar.com",
+		Password: "passwordhash12345",
+	})
+	assert.NoError(t, err)
+
+	user, err := store.GetUserById(ctx, "1")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, user.ETag)
+	etag := user.ETag
+
+	// stale version
+	err = store.UpdateUser(ctx, "1", &model.UserUpdate{
+		Name:    "Foo",
+		IfMatch: []string{"stale"},
+	})
+	assert.EqualError(t, err, "user has been modified, ETag does not match")
+
+	err = store.UpdateUser(ctx, "2", &model.UserUpdate{
+		Name:    "Foo",
+		IfMatch: []string{etag},
+	})
+	assert.EqualError(t, err, "user not found")
+
+	update := &model.UserUpdate{
+		Name:    "Foo",
+		IfMatch: []string{"stale", etag},
+	}
+	err = store.UpdateUser(ctx, "1", update)
+	assert.NoError(t, err)
+
+	user, err = store.GetUserById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Foo", user.Name)
+	assert.Equal(t, update.ETag, user.ETag)
+	assert.NotEqual(t, etag, user.ETag)
+
+	// users created before versioning get an ETag on their first update
+	err = session.DB(DbName).C(DbUsersColl).Insert(bson.M{
+		"_id":   "3",
+		"email": "bar@bar.com",
+	})
+	assert.NoError(t, err)
+
+	user, err = store.GetUserById(ctx, "3")
+	assert.NoError(t, err)
+	assert.Empty(t, user.ETag)
+
+	update = &model.UserUpdate{
+		Name:    "Bar",
+		IfMatch: []string{user.ETag},
+	}
+	err = store.UpdateUser(ctx, "3", update)
+	assert.NoError(t, err)
+
+	user, err = store.GetUserById(ctx, "3")
+	assert.NoError(t, err)
+	assert.Equal(t, update.ETag, user.ETag)
+	assert.NotEmpty(t, user.ETag)
+}
+
 func TestMongoGetUserByEmail(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping in short mode.")
@@ -325,6 +440,146 @@ func TestMongoGetUserByEmail(t *testing.T) {
 	}
 }
 
+func TestMongoGetUserByUsername(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	ctx := context.Background()
+
+	session := db.Session()
+	defer session.Close()
+
+	ds, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+	err = ds.EnsureIndexes(ctx, session)
+	assert.NoError(t, err)
+
+	for _, u := range []model.User{
+		{ID: "1", Email: "foo@bar.com", Username: "foo", Password: "passwordhash12345"},
+		{ID: "2", Email: "bar@bar.com", Password: "passwordhashqwerty"},
+		// users without a username don't clash
+		{ID: "3", Email: "baz@bar.com", Password: "passwordhashqwerty"},
+	} {
+		u := u
+		assert.NoError(t, ds.CreateUser(ctx, &u))
+	}
+
+	err = ds.CreateUser(ctx, &model.User{
+		ID:       "4",
+		Email:    "qux@bar.com",
+		Username: "foo",
+		Password: "passwordhashqwerty",
+	})
+	assert.Equal(t, store.ErrDuplicateUsername, err)
+
+	err = ds.CreateUser(ctx, &model.User{
+		ID:       "4",
+		Email:    "foo@bar.com",
+		Username: "qux",
+		Password: "passwordhashqwerty",
+	})
+	assert.Equal(t, store.ErrDuplicateEmail, err)
+
+	user, err := ds.GetUserByUsername(ctx, "foo")
+	assert.NoError(t, err)
+	if assert.NotNil(t, user) {
+		assert.Equal(t, "1", user.ID)
+		assert.Equal(t, "foo@bar.com", user.Email)
+	}
+
+	user, err = ds.GetUserByUsername(ctx, "bar")
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+}
+
+func TestMongoUserEmails(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	for _, encrypted := range []bool{false, true} {
+		t.Run(fmt.Sprintf("encrypted %t", encrypted), func(t *testing.T) {
+			db.Wipe()
+
+			ctx := context.Background()
+
+			session := db.Session()
+			defer session.Close()
+
+			ds, err := NewDataStoreMongoWithSession(session)
+			assert.NoError(t, err)
+			if encrypted {
+				ds = ds.WithEncryption(testKeyring("a"))
+			}
+
+			for _, u := range []model.User{
+				{ID: "1", Email: "a@foo.com", Password: "passwordhash"},
+				{ID: "2", Email: "b@foo.com", Password: "passwordhash"},
+			} {
+				u := u
+				assert.NoError(t, ds.CreateUser(ctx, &u))
+			}
+
+			err = ds.AddUserEmail(ctx, "1", &model.UserEmail{Email: "a@bar.com"})
+			assert.NoError(t, err)
+
+			// unique among the primary and the additional emails
+			err = ds.AddUserEmail(ctx, "2", &model.UserEmail{Email: "a@bar.com"})
+			assert.Equal(t, store.ErrDuplicateEmail, err)
+			err = ds.AddUserEmail(ctx, "2", &model.UserEmail{Email: "a@foo.com"})
+			assert.Equal(t, store.ErrDuplicateEmail, err)
+			err = ds.UpdateUser(ctx, "2", &model.UserUpdate{Email: "a@bar.com"})
+			assert.Equal(t, store.ErrDuplicateEmail, err)
+			err = ds.CreateUser(ctx, &model.User{
+				ID:       "3",
+				Email:    "a@bar.com",
+				Password: "passwordhash",
+			})
+			assert.Equal(t, store.ErrDuplicateEmail, err)
+			err = ds.AddUserEmail(ctx, "3", &model.UserEmail{Email: "c@bar.com"})
+			assert.Equal(t, store.ErrUserNotFound, err)
+
+			user, err := ds.GetUserByEmail(ctx, "a@bar.com")
+			assert.NoError(t, err)
+			if assert.NotNil(t, user) {
+				assert.Equal(t, "1", user.ID)
+				assert.Equal(t, "a@bar.com", user.Emails[0].Email)
+				assert.False(t, user.Emails[0].Verified)
+			}
+
+			err = ds.VerifyUserEmail(ctx, "1", "b@bar.com")
+			assert.Equal(t, store.ErrUserEmailNotFound, err)
+			err = ds.VerifyUserEmail(ctx, "1", "a@bar.com")
+			assert.NoError(t, err)
+
+			// the former primary email becomes a verified additional one
+			err = ds.SetPrimaryEmail(ctx, "1", "a@bar.com")
+			assert.NoError(t, err)
+			user, err = ds.GetUserByEmail(ctx, "a@bar.com")
+			assert.NoError(t, err)
+			if assert.NotNil(t, user) {
+				assert.Equal(t, "a@bar.com", user.Email)
+				if assert.Len(t, user.Emails, 1) {
+					assert.Equal(t, "a@foo.com", user.Emails[0].Email)
+					assert.True(t, user.Emails[0].Verified)
+				}
+			}
+
+			err = ds.DeleteUserEmail(ctx, "1", "a@foo.com")
+			assert.NoError(t, err)
+			err = ds.DeleteUserEmail(ctx, "1", "a@foo.com")
+			assert.Equal(t, store.ErrUserEmailNotFound, err)
+
+			user, err = ds.GetUserByEmail(ctx, "a@foo.com")
+			assert.NoError(t, err)
+			assert.Nil(t, user)
+		})
+	}
+}
+
 func TestMongoGetUserById(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping in short mode.")
@@ -564,9 +819,140 @@ func TestMongoGetUsers(t *testing.T) {
 
 	testCases := map[string]struct {
 		inUsers  []interface{}
+		fltr     model.UserFilter
 		outUsers []model.User
 		tenant   string
 	}{
+		"ok: paged": {
+			inUsers: []interface{}{
+				model.User{
+					ID:       "1",
+					Email:    "foo@bar.com",
+					Password: "passwordhash12345",
+				},
+				model.User{
+					ID:       "2",
+					Email:    "bar@bar.com",
+					Password: "passwordhashqwerty",
+				},
+				model.User{
+					ID:       "3",
+					Email:    "baz@bar.com",
+					Password: "passwordhashqwerty",
+				},
+			},
+			fltr: model.UserFilter{Skip: 1, Limit: 1},
+			outUsers: []model.User{
+				{
+					ID:    "3",
+					Email: "baz@bar.com",
+				},
+			},
+		},
+		"ok: selected fields": {
+			inUsers: []interface{}{
+				model.User{
+					ID:         "1",
+					Email:      "foo@bar.com",
+					Password:   "passwordhash12345",
+					Name:       "Foo",
+					Attributes: map[string]string{"department": "rnd"},
+				},
+			},
+			fltr: model.UserFilter{Fields: []string{"email", "name"}},
+			outUsers: []model.User{
+				{
+					ID:    "1",
+					Email: "foo@bar.com",
+					Name:  "Foo",
+				},
+			},
+		},
+		"ok: by ID, selected fields": {
+			inUsers: []interface{}{
+				model.User{
+					ID:       "1",
+					Email:    "foo@bar.com",
+					Password: "passwordhash12345",
+					Name:     "Foo",
+					ETag:     "v1",
+				},
+				model.User{
+					ID:       "2",
+					Email:    "bar@bar.com",
+					Password: "passwordhashqwerty",
+					Name:     "Bar",
+					ETag:     "v1",
+				},
+			},
+			fltr: model.UserFilter{ID: "2", Fields: []string{"name"}},
+			outUsers: []model.User{
+				{
+					ID:   "2",
+					Name: "Bar",
+					ETag: "v1",
+				},
+			},
+		},
+		"ok: filter by attributes": {
+			inUsers: []interface{}{
+				model.User{
+					ID:         "1",
+					Email:      "foo@bar.com",
+					Password:   "passwordhash12345",
+					Attributes: map[string]string{"department": "rnd", "site": "oslo"},
+				},
+				model.User{
+					ID:         "2",
+					Email:      "bar@bar.com",
+					Password:   "passwordhashqwerty",
+					Attributes: map[string]string{"department": "rnd", "site": "wroclaw"},
+				},
+				model.User{
+					ID:       "3",
+					Email:    "baz@bar.com",
+					Password: "passwordhashqwerty",
+				},
+			},
+			fltr: model.UserFilter{
+				Attributes: map[string]string{"department": "rnd", "site": "oslo"},
+			},
+			outUsers: []model.User{
+				{
+					ID:         "1",
+					Email:      "foo@bar.com",
+					Attributes: map[string]string{"department": "rnd", "site": "oslo"},
+				},
+			},
+		},
+		"ok: active users": {
+			inUsers: []interface{}{
+				model.User{
+					ID:       "1",
+					Email:    "foo@bar.com",
+					Password: "passwordhash12345",
+					Status:   model.UserStatusInactive,
+				},
+				model.User{
+					ID:        "2",
+					Email:     "bar@bar.com",
+					Password:  "passwordhashqwerty",
+					ExpiresAt: &ts,
+				},
+				model.User{
+					ID:       "3",
+					Email:    "baz@bar.com",
+					Password: "passwordhashqwerty",
+				},
+			},
+			fltr: model.UserFilter{Active: true},
+			outUsers: []model.User{
+				{
+					ID:    "3",
+					Email: "baz@bar.com",
+				},
+			},
+		},
 		"ok: list": {
 			inUsers: []interface{}{
 				model.User{
@@ -632,7 +1018,7 @@ func TestMongoGetUsers(t *testing.T) {
 				err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).Insert(tc.inUsers...)
 			}
 
-			users, err := store.GetUsers(ctx)
+			users, err := store.GetUsers(ctx, tc.fltr)
 			assert.NoError(t, err)
 
 			// transform times to utc
@@ -651,6 +1037,24 @@ func TestMongoGetUsers(t *testing.T) {
 
 			assert.Equal(t, tc.outUsers, users)
 
+			n, err := store.CountUsers(ctx, tc.fltr)
+			assert.NoError(t, err)
+			assert.Equal(t, len(tc.outUsers), n)
+
+			version, err := store.GetUsersVersion(ctx, tc.fltr)
+			assert.NoError(t, err)
+			assert.Equal(t, n, version.Count)
+
+			var emails []string
+			err = store.ForEachUser(ctx, tc.fltr, func(u *model.User) error {
+				assert.Empty(t, u.Password)
+				emails = append(emails, u.Email)
+				return nil
+			})
+			assert.NoError(t, err)
+			assert.Len(t, emails, len(tc.outUsers))
+			assert.True(t, sort.StringsAreSorted(emails))
+
 			session.Close()
 		})
 	}
@@ -666,6 +1070,7 @@ func TestMongoDeleteUser(t *testing.T) {
 			ID:       "1",
 			Email:    "foo@bar.com",
 			Password: "passwordhash12345",
+			ETag:     "v1",
 		},
 		model.User{
 			ID:       "2",
@@ -675,9 +1080,12 @@ func TestMongoDeleteUser(t *testing.T) {
 	}
 
 	testCases := map[string]struct {
-		inId     string
-		tenant   string
-		outUsers []model.User
+		inId       string
+		inIfMatch  []string
+		tenant     string
+		outUsers   []model.User
+		outDeleted []string
+		outErr     error
 	}{
 		"ok": {
 			inId: "1",
@@ -688,6 +1096,7 @@ func TestMongoDeleteUser(t *testing.T) {
 					Password: "passwordhashqwerty",
 				},
 			},
+			outDeleted: []string{"1"},
 		},
 		"ok - with tenant": {
 			inId:   "1",
@@ -699,6 +1108,7 @@ func TestMongoDeleteUser(t *testing.T) {
 					Password: "passwordhashqwerty",
 				},
 			},
+			outDeleted: []string{"1"},
 		},
 		"ok - not found": {
 			inId: "3",
@@ -707,6 +1117,49 @@ func TestMongoDeleteUser(t *testing.T) {
 					ID:       "1",
 					Email:    "foo@bar.com",
 					Password: "passwordhash12345",
+					ETag:     "v1",
+				},
+				{
+					ID:       "2",
+					Email:    "bar@bar.com",
+					Password: "passwordhashqwerty",
+				},
+			},
+		},
+		"ok - etag matches": {
+			inId:      "1",
+			inIfMatch: []string{"v0", "v1"},
+			outUsers: []model.User{
+				{
+					ID:       "2",
+					Email:    "bar@bar.com",
+					Password: "passwordhashqwerty",
+				},
+			},
+			outDeleted: []string{"1"},
+		},
+		"ok - no etag yet": {
+			inId:      "2",
+			inIfMatch: []string{""},
+			outUsers: []model.User{
+				{
+					ID:       "1",
+					Email:    "foo@bar.com",
+					Password: "passwordhash12345",
+					ETag:     "v1",
+				},
+			},
+			outDeleted: []string{"2"},
+		},
+		"error - etag mismatch": {
+			inId:      "1",
+			inIfMatch: []string{"v0"},
+			outUsers: []model.User{
+				{
+					ID:       "1",
+					Email:    "foo@bar.com",
+					Password: "passwordhash12345",
+					ETag:     "v1",
 				},
 				{
 					ID:       "2",
@@ -714,6 +1167,25 @@ func TestMongoDeleteUser(t *testing.T) {
 					Password: "passwordhashqwerty",
 				},
 			},
+			outErr: store.ErrETagMismatch,
+		},
+		"error - not found with etag": {
+			inId:      "3",
+			inIfMatch: []string{"v1"},
+			outUsers: []model.User{
+				{
+					ID:       "1",
+					Email:    "foo@bar.com",
+					Password: "passwordhash12345",
+					ETag:     "v1",
+				},
+				{
+					ID:       "2",
+					Email:    "bar@bar.com",
+					Password: "passwordhashqwerty",
+				},
+			},
+			outErr: store.ErrUserNotFound,
 		},
 	}
 
@@ -736,8 +1208,8 @@ func TestMongoDeleteUser(t *testing.T) {
 		err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).Insert(existingUsers...)
 		assert.NoError(t, err)
 
-		err = store.DeleteUser(ctx, tc.inId)
-		assert.NoError(t, err)
+		err = store.DeleteUser(ctx, tc.inId, tc.inIfMatch)
+		assert.Equal(t, tc.outErr, err)
 
 		var users []model.User
 		err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).Find(nil).All(&users)
@@ -745,66 +1217,63 @@ func TestMongoDeleteUser(t *testing.T) {
 
 		assert.Equal(t, tc.outUsers, users)
 
+		var deleted []model.User
+		err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbDeletedUsersColl).Find(nil).All(&deleted)
+		assert.NoError(t, err)
+
+		assert.Len(t, deleted, len(tc.outDeleted))
+		for i, id := range tc.outDeleted {
+			assert.Equal(t, id, deleted[i].ID)
+			assert.NotNil(t, deleted[i].DeletedTs)
+		}
+
 		session.Close()
 	}
 }
 
-func TestMongoSaveToken(t *testing.T) {
+func TestMongoEraseUser(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping in short mode.")
 	}
 
+	deletedTs := time.Now().UTC()
+
 	testCases := map[string]struct {
-		token  *jwt.Token
-		tenant string
+		inId         string
+		tenant       string
+		users        []interface{}
+		deletedUsers []interface{}
+
+		outUsers []model.User
+		outErr   error
 	}{
-		"ok 1": {
-			token: &jwt.Token{
-				Id: "id-3",
-				Claims: jwt.Claims{
-					Audience:  "audience",
-					ExpiresAt: 1234,
-					ID:        "id-3",
-					IssuedAt:  5678,
-					Issuer:    "iss-3",
-					NotBefore: 7890,
-					Subject:   "sub-3",
-					Scope:     "scope-3",
-					Tenant:    "tenant-3",
-					User:      true,
-				},
+		"ok": {
+			inId: "1",
+			users: []interface{}{
+				model.User{ID: "1", Email: "foo@bar.com"},
+				model.User{ID: "2", Email: "bar@bar.com"},
+			},
+			outUsers: []model.User{
+				{ID: "2", Email: "bar@bar.com"},
 			},
 		},
-		"ok 2": {
-			token: &jwt.Token{
-				Id: "id-4",
-				Claims: jwt.Claims{
-					ExpiresAt: 1234,
-					ID:        "id-4",
-					IssuedAt:  5678,
-					Subject:   "sub-4",
-					Tenant:    "tenant-4",
-					User:      true,
-				},
+		"ok - deleted user, with tenant": {
+			inId:   "1",
+			tenant: "foo",
+			deletedUsers: []interface{}{
+				model.User{ID: "1", Email: "foo@bar.com", DeletedTs: &deletedTs},
 			},
+			outUsers: []model.User{},
 		},
-		"ok 3, MT": {
-			token: &jwt.Token{
-				Id: "id-3",
-				Claims: jwt.Claims{
-					Audience:  "audience",
-					ExpiresAt: 1234,
-					ID:        "id-3",
-					IssuedAt:  5678,
-					Issuer:    "iss-3",
-					NotBefore: 7890,
-					Subject:   "sub-3",
-					Scope:     "scope-3",
-					Tenant:    "tenant-3",
-					User:      true,
-				},
+		"error - not found": {
+			inId: "1",
+			users: []interface{}{
+				model.User{ID: "2", Email: "bar@bar.com"},
 			},
-			tenant: "tenant-1",
+			outUsers: []model.User{
+				{ID: "2", Email: "bar@bar.com"},
+			},
+			outErr: store.ErrUserNotFound,
 		},
 	}
 
@@ -813,7 +1282,6 @@ func TestMongoSaveToken(t *testing.T) {
 
 		db.Wipe()
 
-		//setup
 		ctx := context.Background()
 		if tc.tenant != "" {
 			ctx = identity.WithContext(ctx, &identity.Identity{
@@ -825,122 +1293,290 @@ func TestMongoSaveToken(t *testing.T) {
 		store, err := NewDataStoreMongoWithSession(session)
 		assert.NoError(t, err)
 
-		//test
-		err = store.SaveToken(ctx, tc.token)
-		assert.NoError(t, err)
+		database := session.DB(mstore.DbFromContext(ctx, DbName))
+		if len(tc.users) > 0 {
+			assert.NoError(t, database.C(DbUsersColl).Insert(tc.users...))
+		}
+		if len(tc.deletedUsers) > 0 {
+			assert.NoError(t, database.C(DbDeletedUsersColl).Insert(tc.deletedUsers...))
+		}
+		for _, id := range []string{"1", "2"} {
+			assert.NoError(t, database.C(DbTokensColl).Insert(jwt.Token{
+				Id:     "token-" + id,
+				Claims: jwt.Claims{Subject: id},
+			}))
+			assert.NoError(t, database.C(DbTokensRevokedColl).Insert(bson.M{
+				"_id":             id,
+				DbTokensRevokedTs: deletedTs,
+			}))
+			assert.NoError(t, database.C(DbLoginEventsColl).Insert(model.LoginEvent{
+				ID:     "event-" + id,
+				UserID: id,
+			}))
+			assert.NoError(t, session.DB(DbName).C(DbSessionsColl).Insert(model.Session{
+				ID:       "session-" + id,
+				TenantID: tc.tenant,
+				TokenID:  "token-" + id,
+			}))
+			assert.NoError(t, session.DB(DbName).C(DbLoginLinksColl).Insert(model.LoginLink{
+				ID:       "link-" + id,
+				TenantID: tc.tenant,
+				UserID:   id,
+			}))
+			assert.NoError(t, session.DB(DbName).C(DbDeviceAuthorizationsColl).Insert(
+				model.DeviceAuthorization{
+					ID:       "device-" + id,
+					UserCode: "CODE" + id,
+					TenantID: tc.tenant,
+					UserID:   id,
+				}))
+		}
 
-		var token jwt.Token
-		err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).FindId(tc.token.Claims.ID).One(&token)
-		assert.NoError(t, err)
+		err = store.EraseUser(ctx, tc.inId)
+		if tc.outErr != nil {
+			assert.EqualError(t, err, tc.outErr.Error())
+		} else {
+			assert.NoError(t, err)
+		}
 
-		assert.Equal(t, *tc.token, token)
+		var users []model.User
+		assert.NoError(t, database.C(DbUsersColl).Find(nil).All(&users))
+		assert.Len(t, users, len(tc.outUsers))
+		for i := range tc.outUsers {
+			assert.Equal(t, tc.outUsers[i].ID, users[i].ID)
+		}
+
+		n, err := database.C(DbDeletedUsersColl).FindId(tc.inId).Count()
+		assert.NoError(t, err)
+		assert.Equal(t, 0, n)
+
+		for coll, filter := range map[string]bson.M{
+			DbTokensColl:        {"claims.sub": tc.inId},
+			DbTokensRevokedColl: {"_id": tc.inId},
+			DbLoginEventsColl:   {DbLoginEventUserID: tc.inId},
+		} {
+			n, err := database.C(coll).Find(filter).Count()
+			assert.NoError(t, err)
+			if tc.outErr != nil {
+				assert.Equal(t, 1, n, coll)
+			} else {
+				assert.Equal(t, 0, n, coll)
+			}
+		}
+		for coll, filter := range map[string]bson.M{
+			DbSessionsColl:             {DbSessionTokenID: "token-" + tc.inId},
+			DbLoginLinksColl:           {DbLoginLinkUserID: tc.inId},
+			DbDeviceAuthorizationsColl: {DbDeviceAuthorizationUserID: tc.inId},
+		} {
+			n, err := session.DB(DbName).C(coll).Find(filter).Count()
+			assert.NoError(t, err)
+			if tc.outErr != nil {
+				assert.Equal(t, 1, n, coll)
+			} else {
+				assert.Equal(t, 0, n, coll)
+			}
+		}
 
 		session.Close()
 	}
 }
 
-func TestMigrate(t *testing.T) {
+func TestMongoDeleteTenant(t *testing.T) {
 	if testing.Short() {
-		t.Skip("skipping TestMigrate in short mode.")
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	for _, tenant := range []string{"foo", "bar"} {
+		ctx := identity.WithContext(context.Background(), &identity.Identity{
+			Tenant: tenant,
+		})
+		err := store.CreateUser(ctx, &model.User{
+			ID:       "1",
+			Email:    "foo@bar.com",
+			Password: "passwordhash12345",
+		})
+		assert.NoError(t, err)
+	}
+
+	err = store.DeleteTenant(context.Background(), "foo")
+	assert.NoError(t, err)
+
+	dbs, err := session.DatabaseNames()
+	assert.NoError(t, err)
+	assert.NotContains(t, dbs, mstore.DbNameForTenant("foo", DbName))
+	assert.Contains(t, dbs, mstore.DbNameForTenant("bar", DbName))
+
+	// deleting a tenant without data is not an error
+	err = store.DeleteTenant(context.Background(), "baz")
+	assert.NoError(t, err)
+
+	// the default database is never dropped
+	err = store.DeleteTenant(context.Background(), "")
+	assert.EqualError(t, err, "tenant ID must be provided")
+}
+
+func TestMongoRestoreUser(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
 	}
 
+	deletedTs := time.Now().UTC()
+
 	testCases := map[string]struct {
-		tenantDbs   []string
-		automigrate bool
+		inId         string
+		tenant       string
+		users        []interface{}
+		deletedUsers []interface{}
 
-		version string
-		err     string
+		outUsers []model.User
+		outErr   error
 	}{
-		"0.1.0": {
-			automigrate: true,
-			version:     "0.1.0",
-			err:         "",
-		},
-		"0.1.0, no automigrate": {
-			automigrate: false,
-			version:     "0.1.0",
-			err:         "",
-		},
-		"1.2.3": {
-			automigrate: true,
-			version:     "1.2.3",
-			err:         "",
+		"ok": {
+			inId: "1",
+			deletedUsers: []interface{}{
+				model.User{
+					ID:        "1",
+					Email:     "foo@bar.com",
+					Password:  "passwordhash12345",
+					DeletedTs: &deletedTs,
+				},
+			},
+			outUsers: []model.User{
+				{
+					ID:       "1",
+					Email:    "foo@bar.com",
+					Password: "passwordhash12345",
+				},
+			},
 		},
-		"0.1 error": {
-			automigrate: true,
-			version:     "0.1",
-			err:         "failed to parse service version: failed to parse Version: unexpected EOF",
+		"ok - with tenant": {
+			inId:   "1",
+			tenant: "foo",
+			deletedUsers: []interface{}{
+				model.User{
+					ID:        "1",
+					Email:     "foo@bar.com",
+					Password:  "passwordhash12345",
+					DeletedTs: &deletedTs,
+				},
+			},
+			outUsers: []model.User{
+				{
+					ID:       "1",
+					Email:    "foo@bar.com",
+					Password: "passwordhash12345",
+				},
+			},
 		},
-		"0.1.0, automigrate, multitenant": {
-			tenantDbs:   []string{"useradm-tenant1", "useradm-tenant2"},
-			automigrate: true,
-			version:     "0.1.0",
-			err:         "",
+		"error - not found": {
+			inId:   "1",
+			outErr: store.ErrUserNotFound,
 		},
-		"0.1.0, no automigrate, multitenant": {
-			tenantDbs:   []string{"useradm-tenant1", "useradm-tenant2"},
-			automigrate: true,
-			version:     "0.1.0",
-			err:         "",
+		"error - email taken": {
+			inId: "1",
+			users: []interface{}{
+				model.User{
+					ID:       "2",
+					Email:    "foo@bar.com",
+					Password: "passwordhashqwerty",
+				},
+			},
+			deletedUsers: []interface{}{
+				model.User{
+					ID:        "1",
+					Email:     "foo@bar.com",
+					Password:  "passwordhash12345",
+					DeletedTs: &deletedTs,
+				},
+			},
+			outUsers: []model.User{
+				{
+					ID:       "2",
+					Email:    "foo@bar.com",
+					Password: "passwordhashqwerty",
+				},
+			},
+			outErr: store.ErrDuplicateEmail,
 		},
 	}
 
 	for name, tc := range testCases {
-		t.Logf("case: %s", name)
+		t.Logf("test case: %s", name)
+
 		db.Wipe()
 
-		store, err := NewDataStoreMongoWithSession(db.Session())
+		ctx := context.Background()
+		if tc.tenant != "" {
+			ctx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tc.tenant,
+			})
+		}
+
+		session := db.Session()
+		store, err := NewDataStoreMongoWithSession(session)
 		assert.NoError(t, err)
 
-		// set up automigration
-		if tc.automigrate {
-			store = store.WithAutomigrate()
+		database := session.DB(mstore.DbFromContext(ctx, DbName))
+		if len(tc.users) > 0 {
+			err = database.C(DbUsersColl).Insert(tc.users...)
+			assert.NoError(t, err)
+		}
+		if len(tc.deletedUsers) > 0 {
+			err = database.C(DbDeletedUsersColl).Insert(tc.deletedUsers...)
+			assert.NoError(t, err)
 		}
 
-		// set up multitenancy/tenant dbs
-		if len(tc.tenantDbs) != 0 {
-			store = store.WithMultitenant()
+		err = store.RestoreUser(ctx, tc.inId)
+		if tc.outErr != nil {
+			assert.EqualError(t, err, tc.outErr.Error())
+		} else {
+			assert.NoError(t, err)
 
-			for _, d := range tc.tenantDbs {
-				err := store.session.DB(d).C("foo").Insert(bson.M{"foo": "bar"})
-				assert.NoError(t, err)
-			}
+			n, err := database.C(DbDeletedUsersColl).Count()
+			assert.NoError(t, err)
+			assert.Equal(t, 0, n)
 		}
 
-		ctx := context.Background()
-
-		err = store.Migrate(ctx, tc.version, nil)
+		var users []model.User
+		err = database.C(DbUsersColl).Find(nil).All(&users)
+		assert.NoError(t, err)
 
-		if tc.err != "" {
-			assert.EqualError(t, err, tc.err)
-		} else {
+		assert.Equal(t, tc.outUsers, users)
 
-			// verify migration entry in all databases (>1 if multitenant)
-			dbs := []string{DbName}
-			if len(tc.tenantDbs) > 0 {
-				dbs = tc.tenantDbs
-			}
+		session.Close()
+	}
+}
 
-			for _, d := range dbs {
-				var out []migrate.MigrationEntry
-				err = store.session.DB(d).C(migrate.DbMigrationsColl).Find(nil).All(&out)
-				if tc.automigrate {
-					assert.Len(t, out, 1)
-					assert.NoError(t, err)
+func TestMongoPurgeDeletedUsers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
 
-					v, _ := migrate.NewVersion(tc.version)
-					assert.Equal(t, *v, out[0].Version)
-				} else {
-					assert.Len(t, out, 0)
-				}
-			}
-		}
+	now := time.Now().UTC()
+	old := now.Add(-48 * time.Hour)
+	recent := now.Add(-1 * time.Hour)
 
-		store.session.Close()
+	deletedUsers := []interface{}{
+		model.User{
+			ID:        "1",
+			Email:     "foo@bar.com",
+			DeletedTs: &old,
+		},
+		model.User{
+			ID:        "2",
+			Email:     "bar@bar.com",
+			DeletedTs: &recent,
+		},
 	}
-}
 
-func TestWithAutomigrate(t *testing.T) {
 	db.Wipe()
 
 	session := db.Session()
@@ -949,522 +1585,2477 @@ func TestWithAutomigrate(t *testing.T) {
 	store, err := NewDataStoreMongoWithSession(session)
 	assert.NoError(t, err)
 
-	new_store := store.WithAutomigrate()
-
-	assert.NotEqual(t, unsafe.Pointer(store), unsafe.Pointer(new_store))
-	store.session.Close()
-}
-
-func TestWithMultitenant(t *testing.T) {
-	db.Wipe()
+	ctx := context.Background()
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{
+		Tenant: "foo",
+	})
 
-	session := db.Session()
-	defer session.Close()
+	for _, c := range []context.Context{ctx, tenantCtx} {
+		err = session.DB(mstore.DbFromContext(c, DbName)).C(DbDeletedUsersColl).
+			Insert(deletedUsers...)
+		assert.NoError(t, err)
+	}
 
-	store, err := NewDataStoreMongoWithSession(session)
+	err = store.PurgeDeletedUsers(ctx, now.Add(-24*time.Hour))
 	assert.NoError(t, err)
 
-	new_store := store.WithMultitenant()
+	for _, c := range []context.Context{ctx, tenantCtx} {
+		var users []model.User
+		err = session.DB(mstore.DbFromContext(c, DbName)).C(DbDeletedUsersColl).
+			Find(nil).All(&users)
+		assert.NoError(t, err)
 
-	assert.NotEqual(t, unsafe.Pointer(store), unsafe.Pointer(new_store))
+		assert.Len(t, users, 1)
+		assert.Equal(t, "2", users[0].ID)
+	}
 }
 
-func TestMongoDeleteTokens(t *testing.T) {
+func TestMongoCountUsersByTenant(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping in short mode.")
 	}
 
-	testCases := map[string]struct {
-		tenant   string
-		inTokens []interface{}
+	recently := time.Now().UTC().Add(-time.Hour)
+	longAgo := time.Now().UTC().AddDate(0, -2, 0)
 
-		outError string
-	}{
-		"ok": {
-			inTokens: []interface{}{
-				jwt.Token{
-					Id: "id-1",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-1",
-						IssuedAt:  5678,
-						Issuer:    "iss-1",
-						NotBefore: 7890,
-						Subject:   "sub-1",
-						Scope:     "scope-1",
-						User:      true,
-					},
-				},
-				jwt.Token{
-					Id: "id-2",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-2",
-						IssuedAt:  5678,
-						Issuer:    "iss-1",
-						NotBefore: 7890,
-						Subject:   "sub-1",
-						Scope:     "scope-1",
-						User:      true,
-					},
-				},
-				jwt.Token{
-					Id: "id-3",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-2",
-						IssuedAt:  5678,
-						Issuer:    "iss-2",
-						NotBefore: 7890,
-						Subject:   "sub-2",
-						Scope:     "scope-2",
-						User:      true,
-					},
-				},
-			},
+	users := []interface{}{
+		model.User{ID: "1", Email: "foo@bar.com", LastLoginTs: &recently},
+		model.User{ID: "2", Email: "bar@bar.com", LastLoginTs: &longAgo},
+		model.User{ID: "3", Email: "baz@bar.com"},
+		model.User{
+			ID:          "4",
+			Email:       "qux@bar.com",
+			Status:      model.UserStatusInactive,
+			LastLoginTs: &recently,
 		},
-		"ok - tenant": {
-			tenant: "tenant-1",
-			inTokens: []interface{}{
-				jwt.Token{
-					Id: "id-1",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-1",
-						IssuedAt:  5678,
-						Issuer:    "iss-1",
-						NotBefore: 7890,
-						Subject:   "sub-1",
-						Scope:     "scope-1",
-						Tenant:    "tenant-1",
-						User:      true,
-					},
-				},
-				jwt.Token{
-					Id: "id-2",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-2",
-						IssuedAt:  5678,
-						Issuer:    "iss-1",
-						NotBefore: 7890,
-						Subject:   "sub-1",
-						Scope:     "scope-1",
-						Tenant:    "tenant-1",
-						User:      true,
-					},
-				},
-			},
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{
+		Tenant: "foo",
+	})
+
+	err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbUsersColl).
+		Insert(users[2])
+	assert.NoError(t, err)
+	err = session.DB(mstore.DbFromContext(tenantCtx, DbName)).C(DbUsersColl).
+		Insert(users...)
+	assert.NoError(t, err)
+
+	counts, err := store.CountUsersByTenant(ctx,
+		time.Now().Add(-model.ActiveUsersPeriod))
+	assert.NoError(t, err)
+	assert.Equal(t, []model.UserCount{
+		{TenantID: "", Total: 1, Active: 0},
+		{TenantID: "foo", Total: 4, Active: 1},
+	}, counts)
+}
+
+func TestMongoDisableExpiredUsers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	now := time.Now().UTC()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	users := []interface{}{
+		model.User{
+			ID:        "1",
+			Email:     "foo@bar.com",
+			Status:    model.UserStatusActive,
+			ExpiresAt: &past,
 		},
-		"tenant, no tokens": {
-			tenant:   "tenant-2",
-			outError: store.ErrTokenNotFound.Error(),
+		model.User{
+			ID:        "2",
+			Email:     "bar@bar.com",
+			Status:    model.UserStatusActive,
+			ExpiresAt: &future,
+		},
+		model.User{
+			ID:     "3",
+			Email:  "baz@bar.com",
+			Status: model.UserStatusActive,
 		},
 	}
 
-	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
+	db.Wipe()
 
-		db.Wipe()
+	session := db.Session()
+	defer session.Close()
 
-		ctx := context.Background()
-		if tc.tenant != "" {
-			ctx = identity.WithContext(ctx, &identity.Identity{
-				Tenant: tc.tenant,
-			})
-		}
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
 
-		session := db.Session()
-		store, err := NewDataStoreMongoWithSession(session)
-		assert.NoError(t, err)
+	ctx := context.Background()
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{
+		Tenant: "foo",
+	})
 
-		if len(tc.inTokens) > 0 {
-			err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).Insert(tc.inTokens...)
-			assert.NoError(t, err)
-		}
+	for _, c := range []context.Context{ctx, tenantCtx} {
+		err = session.DB(mstore.DbFromContext(c, DbName)).C(DbUsersColl).
+			Insert(users...)
+		assert.NoError(t, err)
+	}
 
-		err = store.DeleteTokens(ctx)
-		if tc.outError != "" {
-			assert.EqualError(t, err, tc.outError)
-		} else {
-			assert.NoError(t, err)
-		}
+	err = store.DisableExpiredUsers(ctx, now)
+	assert.NoError(t, err)
 
-		var tokens []jwt.Token
-		err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).Find(nil).All(&tokens)
+	for _, c := range []context.Context{ctx, tenantCtx} {
+		var out []model.User
+		err = session.DB(mstore.DbFromContext(c, DbName)).C(DbUsersColl).
+			Find(nil).Sort("_id").All(&out)
 		assert.NoError(t, err)
-		assert.Nil(t, tokens)
 
-		session.Close()
+		assert.Len(t, out, 3)
+		assert.Equal(t, model.UserStatusInactive, out[0].Status)
+		assert.NotNil(t, out[0].UpdatedTs)
+		assert.Equal(t, model.UserStatusActive, out[1].Status)
+		assert.Equal(t, model.UserStatusActive, out[2].Status)
 	}
 }
 
-func TestMongoDeleteTokensByUserId(t *testing.T) {
+func TestMongoDeleteExpiredTokens(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping in short mode.")
 	}
 
-	testCases := map[string]struct {
-		tenant   string
-		user     string
-		inTokens []interface{}
+	now := time.Now()
 
-		outTokens []jwt.Token
-		outError  string
-	}{
-		"ok": {
-			user: "user-1",
-			inTokens: []interface{}{
-				jwt.Token{
-					Id: "id-1",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-1",
-						IssuedAt:  5678,
-						Issuer:    "iss-1",
-						NotBefore: 7890,
-						Subject:   "user-1",
-						Scope:     "scope-1",
-						User:      true,
-					},
-				},
-				jwt.Token{
-					Id: "id-2",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-2",
-						IssuedAt:  5678,
-						Issuer:    "iss-1",
-						NotBefore: 7890,
-						Subject:   "user-1",
-						Scope:     "scope-1",
-						User:      true,
-					},
-				},
-				jwt.Token{
-					Id: "id-3",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-1",
-						IssuedAt:  5678,
-						Issuer:    "iss-1",
-						NotBefore: 7890,
-						Subject:   "user-2",
-						Scope:     "scope-1",
-						User:      true,
-					},
-				},
-			},
-			outTokens: []jwt.Token{
-				jwt.Token{
-					Id: "id-3",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-1",
-						IssuedAt:  5678,
-						Issuer:    "iss-1",
-						NotBefore: 7890,
-						Subject:   "user-2",
-						Scope:     "scope-1",
-						User:      true,
-					},
-				},
-			},
+	tokens := []interface{}{
+		jwt.Token{
+			Id:     "1",
+			Claims: jwt.Claims{ExpiresAt: now.Add(-time.Hour).Unix()},
 		},
-		"ok - tenant": {
-			user:   "user-1",
-			tenant: "tenant-1",
-			inTokens: []interface{}{
-				jwt.Token{
-					Id: "id-1",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-1",
-						IssuedAt:  5678,
-						Issuer:    "iss-1",
-						NotBefore: 7890,
-						Subject:   "user-1",
-						Scope:     "scope-1",
-						User:      true,
-					},
-				},
-				jwt.Token{
-					Id: "id-2",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-2",
-						IssuedAt:  5678,
-						Issuer:    "iss-1",
-						NotBefore: 7890,
-						Subject:   "user-1",
-						Scope:     "scope-1",
-						User:      true,
-					},
-				},
-				jwt.Token{
-					Id: "id-3",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-1",
-						IssuedAt:  5678,
-						Issuer:    "iss-1",
-						NotBefore: 7890,
-						Subject:   "user-2",
-						Scope:     "scope-1",
-						User:      true,
-					},
+		jwt.Token{
+			Id:     "2",
+			Claims: jwt.Claims{ExpiresAt: now.Add(time.Hour).Unix()},
+		},
+		jwt.Token{
+			Id: "3",
+		},
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{
+		Tenant: "foo",
+	})
+
+	for _, c := range []context.Context{ctx, tenantCtx} {
+		err = session.DB(mstore.DbFromContext(c, DbName)).C(DbTokensColl).
+			Insert(tokens...)
+		assert.NoError(t, err)
+	}
+
+	n, err := store.DeleteExpiredTokens(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	for _, c := range []context.Context{ctx, tenantCtx} {
+		var out []jwt.Token
+		err = session.DB(mstore.DbFromContext(c, DbName)).C(DbTokensColl).
+			Find(nil).Sort("_id").All(&out)
+		assert.NoError(t, err)
+
+		assert.Len(t, out, 2)
+		assert.Equal(t, "2", out[0].Id)
+		assert.Equal(t, "3", out[1].Id)
+	}
+}
+
+func TestMongoPendingUsers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{
+		Tenant: "foo",
+	})
+
+	old := model.PendingUser{
+		UserID:    "1",
+		TenantID:  "foo",
+		CreatedTs: now.Add(-time.Hour),
+	}
+	assert.NoError(t, store.CreatePendingUser(tenantCtx, &old))
+	assert.NoError(t, store.CreatePendingUser(ctx, &model.PendingUser{
+		UserID:    "2",
+		CreatedTs: now,
+	}))
+
+	pending, err := store.GetPendingUsers(ctx, now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []model.PendingUser{old}, pending)
+
+	assert.NoError(t, store.DeletePendingUser(tenantCtx, "1"))
+	assert.NoError(t, store.DeletePendingUser(tenantCtx, "1"))
+
+	pending, err = store.GetPendingUsers(ctx, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "2", pending[0].UserID)
+}
+
+func TestMongoLoginInfo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	err = store.CreateUser(ctx, &model.User{
+		ID:       "1",
+		Email:    "foo@bar.com",
+		Password: "passwordhash12345",
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		err = store.IncFailedLogins(ctx, "1")
+		assert.NoError(t, err)
+	}
+
+	user, err := store.GetUserById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, user.FailedLoginAttempts)
+	assert.Nil(t, user.LastLoginTs)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	err = store.SetLastLogin(ctx, "1", now, "1.2.3.4")
+	assert.NoError(t, err)
+
+	user, err = store.GetUserById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, user.FailedLoginAttempts)
+	assert.Equal(t, "1.2.3.4", user.LastLoginIP)
+	if assert.NotNil(t, user.LastLoginTs) {
+		assert.True(t, now.Equal(*user.LastLoginTs))
+	}
+
+	err = store.IncFailedLogins(ctx, "2")
+	assert.EqualError(t, err, "user not found")
+}
+
+func TestMongoLoginEvents(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	events := []model.LoginEvent{
+		{
+			ID:        "event-1",
+			UserID:    "1",
+			Timestamp: now.Add(-2 * time.Hour),
+			IP:        "1.2.3.4",
+			Success:   false,
+			Method:    model.LoginMethodPassword,
+		},
+		{
+			ID:        "event-2",
+			UserID:    "1",
+			Timestamp: now.Add(-1 * time.Hour),
+			IP:        "1.2.3.4",
+			UserAgent: "curl/7.58.0",
+			Success:   true,
+			Method:    model.LoginMethodPassword,
+		},
+		{
+			ID:        "event-3",
+			UserID:    "2",
+			Timestamp: now,
+			Success:   true,
+			Method:    model.LoginMethodPassword,
+		},
+	}
+
+	for i := range events {
+		err = store.SaveLoginEvent(ctx, &events[i])
+		assert.NoError(t, err)
+	}
+
+	out, err := store.GetLoginEvents(ctx, "1")
+	assert.NoError(t, err)
+	if assert.Len(t, out, 2) {
+		assert.Equal(t, "event-2", out[0].ID)
+		assert.Equal(t, "curl/7.58.0", out[0].UserAgent)
+		assert.Equal(t, "event-1", out[1].ID)
+	}
+
+	out, err = store.GetLoginEvents(ctx, "3")
+	assert.NoError(t, err)
+	assert.Len(t, out, 0)
+}
+
+func TestMongoGroups(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	for _, g := range []*model.Group{
+		{ID: "group-1", Name: "qa"},
+		{ID: "group-2", Name: "devops"},
+	} {
+		err = store.CreateGroup(ctx, g)
+		assert.NoError(t, err)
+		assert.NotNil(t, g.CreatedTs)
+	}
+
+	err = store.CreateGroup(ctx, &model.Group{ID: "group-3", Name: "qa"})
+	assert.EqualError(t, err, "group with a given name already exists")
+
+	groups, err := store.GetGroups(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, "devops", groups[0].Name)
+		assert.Equal(t, "qa", groups[1].Name)
+	}
+
+	group, err := store.GetGroupById(ctx, "group-1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, group) {
+		assert.Equal(t, "qa", group.Name)
+	}
+
+	group, err = store.GetGroupById(ctx, "group-3")
+	assert.NoError(t, err)
+	assert.Nil(t, group)
+
+	for _, u := range []*model.User{
+		{ID: "1", Email: "foo@bar.com", Password: "passwordhash12345"},
+		{ID: "2", Email: "bar@bar.com", Password: "passwordhash12345"},
+	} {
+		err = store.CreateUser(ctx, u)
+		assert.NoError(t, err)
+	}
+
+	assert.NoError(t, store.AddUserToGroup(ctx, "1", "group-1"))
+	assert.NoError(t, store.AddUserToGroup(ctx, "1", "group-2"))
+	assert.NoError(t, store.AddUserToGroup(ctx, "1", "group-2"))
+	assert.NoError(t, store.AddUserToGroup(ctx, "2", "group-1"))
+	assert.EqualError(t, store.AddUserToGroup(ctx, "3", "group-1"),
+		"user not found")
+
+	user, err := store.GetUserById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"group-1", "group-2"}, user.Groups)
+
+	groups, err = store.GetGroupsByIds(ctx, user.Groups)
+	assert.NoError(t, err)
+	assert.Len(t, groups, 2)
+
+	users, err := store.GetUsers(ctx, model.UserFilter{Group: "group-1"})
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+
+	assert.NoError(t, store.RemoveUserFromGroup(ctx, "2", "group-1"))
+	assert.EqualError(t, store.RemoveUserFromGroup(ctx, "3", "group-1"),
+		"user not found")
+
+	users, err = store.GetUsers(ctx, model.UserFilter{Group: "group-1"})
+	assert.NoError(t, err)
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, "1", users[0].ID)
+	}
+
+	err = store.DeleteGroup(ctx, "group-1")
+	assert.NoError(t, err)
+
+	group, err = store.GetGroupById(ctx, "group-1")
+	assert.NoError(t, err)
+	assert.Nil(t, group)
+
+	user, err = store.GetUserById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"group-2"}, user.Groups)
+}
+
+func TestMongoIdempotencyKeys(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	k, err := store.GetIdempotencyKey(ctx, "key-1")
+	assert.NoError(t, err)
+	assert.Nil(t, k)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	err = store.CreateIdempotencyKey(ctx, &model.IdempotencyKey{
+		Key:       "key-1",
+		Email:     "foo@bar.com",
+		CreatedTs: now,
+	})
+	assert.NoError(t, err)
+
+	err = store.CreateIdempotencyKey(ctx, &model.IdempotencyKey{
+		Key:       "key-1",
+		Email:     "bar@bar.com",
+		CreatedTs: now,
+	})
+	assert.EqualError(t, err, "idempotency key already exists")
+
+	err = store.SetIdempotencyKeyUser(ctx, "key-1", "1234")
+	assert.NoError(t, err)
+
+	k, err = store.GetIdempotencyKey(ctx, "key-1")
+	assert.NoError(t, err)
+	if assert.NotNil(t, k) {
+		assert.Equal(t, "foo@bar.com", k.Email)
+		assert.Equal(t, "1234", k.UserID)
+		assert.Equal(t, now, k.CreatedTs.UTC())
+	}
+
+	// keys are per tenant
+	k, err = store.GetIdempotencyKey(context.Background(), "key-1")
+	assert.NoError(t, err)
+	assert.Nil(t, k)
+
+	err = store.DeleteIdempotencyKey(ctx, "key-1")
+	assert.NoError(t, err)
+
+	k, err = store.GetIdempotencyKey(ctx, "key-1")
+	assert.NoError(t, err)
+	assert.Nil(t, k)
+
+	err = store.DeleteIdempotencyKey(ctx, "key-1")
+	assert.NoError(t, err)
+}
+
+func TestMongoSaveToken(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	testCases := map[string]struct {
+		token  *jwt.Token
+		tenant string
+	}{
+		"ok 1": {
+			token: &jwt.Token{
+				Id: "id-3",
+				Claims: jwt.Claims{
+					Audience:  "audience",
+					ExpiresAt: 1234,
+					ID:        "id-3",
+					IssuedAt:  5678,
+					Issuer:    "iss-3",
+					NotBefore: 7890,
+					Subject:   "sub-3",
+					Scope:     "scope-3",
+					Tenant:    "tenant-3",
+					User:      true,
 				},
 			},
-			outTokens: []jwt.Token{
-				jwt.Token{
-					Id: "id-3",
-					Claims: jwt.Claims{
-						Audience:  "audience",
-						ExpiresAt: 1234,
-						ID:        "id-1",
-						IssuedAt:  5678,
-						Issuer:    "iss-1",
-						NotBefore: 7890,
-						Subject:   "user-2",
-						Scope:     "scope-1",
-						User:      true,
-					},
+		},
+		"ok 2": {
+			token: &jwt.Token{
+				Id: "id-4",
+				Claims: jwt.Claims{
+					ExpiresAt: 1234,
+					ID:        "id-4",
+					IssuedAt:  5678,
+					Subject:   "sub-4",
+					Tenant:    "tenant-4",
+					User:      true,
 				},
 			},
 		},
-		"ok - no tokens": {
-			user:     "user2",
-			outError: store.ErrTokenNotFound.Error(),
+		"ok 3, MT": {
+			token: &jwt.Token{
+				Id: "id-3",
+				Claims: jwt.Claims{
+					Audience:  "audience",
+					ExpiresAt: 1234,
+					ID:        "id-3",
+					IssuedAt:  5678,
+					Issuer:    "iss-3",
+					NotBefore: 7890,
+					Subject:   "sub-3",
+					Scope:     "scope-3",
+					Tenant:    "tenant-3",
+					User:      true,
+				},
+			},
+			tenant: "tenant-1",
 		},
 	}
 
-	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		db.Wipe()
+
+		//setup
+		ctx := context.Background()
+		if tc.tenant != "" {
+			ctx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tc.tenant,
+			})
+		}
+
+		session := db.Session()
+		store, err := NewDataStoreMongoWithSession(session)
+		assert.NoError(t, err)
+
+		//test
+		err = store.SaveToken(ctx, tc.token)
+		assert.NoError(t, err)
+
+		var token jwt.Token
+		err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).FindId(tc.token.Claims.ID).One(&token)
+		assert.NoError(t, err)
+
+		assert.Equal(t, *tc.token, token)
+
+		session.Close()
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigrate in short mode.")
+	}
+
+	testCases := map[string]struct {
+		tenantDbs   []string
+		automigrate bool
+
+		version string
+
+		// versions recorded in each database
+		applied []string
+		err     string
+	}{
+		"0.1.0": {
+			automigrate: true,
+			version:     "0.1.0",
+			applied:     []string{"0.1.0"},
+		},
+		"0.1.0, no automigrate": {
+			automigrate: false,
+			version:     "0.1.0",
+			err: "failed to apply migrations: db needs migration: " +
+				"useradm has version 0.0.0, needs version 0.1.0",
+		},
+		"1.0.0": {
+			automigrate: true,
+			version:     "1.0.0",
+			applied:     []string{"0.1.0", "1.0.0"},
+		},
+		"1.2.3": {
+			automigrate: true,
+			version:     "1.2.3",
+			applied:     []string{"0.1.0", "1.0.0", "1.1.0", "1.2.0", "1.2.3"},
+		},
+		"0.1 error": {
+			automigrate: true,
+			version:     "0.1",
+			err:         "failed to parse service version: failed to parse Version: unexpected EOF",
+		},
+		"0.1.0, automigrate, multitenant": {
+			tenantDbs:   []string{"useradm-tenant1", "useradm-tenant2"},
+			automigrate: true,
+			version:     "0.1.0",
+			applied:     []string{"0.1.0"},
+		},
+		"1.0.0, automigrate, multitenant": {
+			tenantDbs:   []string{"useradm-tenant1", "useradm-tenant2"},
+			automigrate: true,
+			version:     "1.0.0",
+			applied:     []string{"0.1.0", "1.0.0"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("case: %s", name)
+		db.Wipe()
+
+		store, err := NewDataStoreMongoWithSession(db.Session())
+		assert.NoError(t, err)
+
+		// set up automigration
+		if tc.automigrate {
+			store = store.WithAutomigrate()
+		}
+
+		// set up multitenancy/tenant dbs
+		if len(tc.tenantDbs) != 0 {
+			store = store.WithMultitenant()
+
+			for _, d := range tc.tenantDbs {
+				err := store.session.DB(d).C("foo").Insert(bson.M{"foo": "bar"})
+				assert.NoError(t, err)
+			}
+		}
+
+		ctx := context.Background()
+
+		err = store.Migrate(ctx, tc.version, nil)
+
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err)
+		} else {
+			assert.NoError(t, err)
+
+			// verify migration entries in all databases (>1 if multitenant)
+			dbs := []string{DbName}
+			if len(tc.tenantDbs) > 0 {
+				dbs = tc.tenantDbs
+			}
+
+			for _, d := range dbs {
+				var out []migrate.MigrationEntry
+				err = store.session.DB(d).C(migrate.DbMigrationsColl).
+					Find(nil).Sort("version.major", "version.minor", "version.patch").
+					All(&out)
+				assert.NoError(t, err)
+
+				applied := []string{}
+				for _, e := range out {
+					applied = append(applied, e.Version.String())
+				}
+				assert.Equal(t, tc.applied, applied)
+			}
+		}
+
+		store.session.Close()
+	}
+}
+
+func TestWithAutomigrate(t *testing.T) {
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	new_store := store.WithAutomigrate()
+
+	assert.NotEqual(t, unsafe.Pointer(store), unsafe.Pointer(new_store))
+	store.session.Close()
+}
+
+func TestWithMultitenant(t *testing.T) {
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	new_store := store.WithMultitenant()
+
+	assert.NotEqual(t, unsafe.Pointer(store), unsafe.Pointer(new_store))
+}
+
+func TestMongoDeleteTokens(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	testCases := map[string]struct {
+		tenant   string
+		inTokens []interface{}
+
+		outError string
+	}{
+		"ok": {
+			inTokens: []interface{}{
+				jwt.Token{
+					Id: "id-1",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-1",
+						IssuedAt:  5678,
+						Issuer:    "iss-1",
+						NotBefore: 7890,
+						Subject:   "sub-1",
+						Scope:     "scope-1",
+						User:      true,
+					},
+				},
+				jwt.Token{
+					Id: "id-2",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-2",
+						IssuedAt:  5678,
+						Issuer:    "iss-1",
+						NotBefore: 7890,
+						Subject:   "sub-1",
+						Scope:     "scope-1",
+						User:      true,
+					},
+				},
+				jwt.Token{
+					Id: "id-3",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-2",
+						IssuedAt:  5678,
+						Issuer:    "iss-2",
+						NotBefore: 7890,
+						Subject:   "sub-2",
+						Scope:     "scope-2",
+						User:      true,
+					},
+				},
+			},
+		},
+		"ok - tenant": {
+			tenant: "tenant-1",
+			inTokens: []interface{}{
+				jwt.Token{
+					Id: "id-1",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-1",
+						IssuedAt:  5678,
+						Issuer:    "iss-1",
+						NotBefore: 7890,
+						Subject:   "sub-1",
+						Scope:     "scope-1",
+						Tenant:    "tenant-1",
+						User:      true,
+					},
+				},
+				jwt.Token{
+					Id: "id-2",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-2",
+						IssuedAt:  5678,
+						Issuer:    "iss-1",
+						NotBefore: 7890,
+						Subject:   "sub-1",
+						Scope:     "scope-1",
+						Tenant:    "tenant-1",
+						User:      true,
+					},
+				},
+			},
+		},
+		"tenant, no tokens": {
+			tenant:   "tenant-2",
+			outError: store.ErrTokenNotFound.Error(),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		db.Wipe()
+
+		ctx := context.Background()
+		if tc.tenant != "" {
+			ctx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tc.tenant,
+			})
+		}
+
+		session := db.Session()
+		store, err := NewDataStoreMongoWithSession(session)
+		assert.NoError(t, err)
+
+		if len(tc.inTokens) > 0 {
+			err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).Insert(tc.inTokens...)
+			assert.NoError(t, err)
+		}
+
+		err = store.DeleteTokens(ctx)
+		if tc.outError != "" {
+			assert.EqualError(t, err, tc.outError)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		var tokens []jwt.Token
+		err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).Find(nil).All(&tokens)
+		assert.NoError(t, err)
+		assert.Nil(t, tokens)
+
+		session.Close()
+	}
+}
+
+func TestMongoDeleteTokensByUserId(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	testCases := map[string]struct {
+		tenant   string
+		user     string
+		inTokens []interface{}
+
+		outTokens []jwt.Token
+		outError  string
+	}{
+		"ok": {
+			user: "user-1",
+			inTokens: []interface{}{
+				jwt.Token{
+					Id: "id-1",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-1",
+						IssuedAt:  5678,
+						Issuer:    "iss-1",
+						NotBefore: 7890,
+						Subject:   "user-1",
+						Scope:     "scope-1",
+						User:      true,
+					},
+				},
+				jwt.Token{
+					Id: "id-2",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-2",
+						IssuedAt:  5678,
+						Issuer:    "iss-1",
+						NotBefore: 7890,
+						Subject:   "user-1",
+						Scope:     "scope-1",
+						User:      true,
+					},
+				},
+				jwt.Token{
+					Id: "id-3",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-1",
+						IssuedAt:  5678,
+						Issuer:    "iss-1",
+						NotBefore: 7890,
+						Subject:   "user-2",
+						Scope:     "scope-1",
+						User:      true,
+					},
+				},
+			},
+			outTokens: []jwt.Token{
+				jwt.Token{
+					Id: "id-3",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-1",
+						IssuedAt:  5678,
+						Issuer:    "iss-1",
+						NotBefore: 7890,
+						Subject:   "user-2",
+						Scope:     "scope-1",
+						User:      true,
+					},
+				},
+			},
+		},
+		"ok - tenant": {
+			user:   "user-1",
+			tenant: "tenant-1",
+			inTokens: []interface{}{
+				jwt.Token{
+					Id: "id-1",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-1",
+						IssuedAt:  5678,
+						Issuer:    "iss-1",
+						NotBefore: 7890,
+						Subject:   "user-1",
+						Scope:     "scope-1",
+						User:      true,
+					},
+				},
+				jwt.Token{
+					Id: "id-2",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-2",
+						IssuedAt:  5678,
+						Issuer:    "iss-1",
+						NotBefore: 7890,
+						Subject:   "user-1",
+						Scope:     "scope-1",
+						User:      true,
+					},
+				},
+				jwt.Token{
+					Id: "id-3",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-1",
+						IssuedAt:  5678,
+						Issuer:    "iss-1",
+						NotBefore: 7890,
+						Subject:   "user-2",
+						Scope:     "scope-1",
+						User:      true,
+					},
+				},
+			},
+			outTokens: []jwt.Token{
+				jwt.Token{
+					Id: "id-3",
+					Claims: jwt.Claims{
+						Audience:  "audience",
+						ExpiresAt: 1234,
+						ID:        "id-1",
+						IssuedAt:  5678,
+						Issuer:    "iss-1",
+						NotBefore: 7890,
+						Subject:   "user-2",
+						Scope:     "scope-1",
+						User:      true,
+					},
+				},
+			},
+		},
+		"ok - no tokens": {
+			user:     "user2",
+			outError: store.ErrTokenNotFound.Error(),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		db.Wipe()
+
+		ctx := context.Background()
+		if tc.tenant != "" {
+			ctx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tc.tenant,
+			})
+		}
+
+		session := db.Session()
+		store, err := NewDataStoreMongoWithSession(session)
+		assert.NoError(t, err)
+
+		if len(tc.inTokens) > 0 {
+			err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).Insert(tc.inTokens...)
+			assert.NoError(t, err)
+		}
+
+		err = store.DeleteTokensByUserId(ctx, tc.user)
+		if tc.outError != "" {
+			assert.EqualError(t, err, tc.outError)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		var tokens []jwt.Token
+		if tc.outTokens != nil {
+			err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).Find(nil).All(&tokens)
+			assert.NoError(t, err)
+		}
+
+		assert.Equal(t, tc.outTokens, tokens)
+
+		session.Close()
+	}
+}
+
+func TestMongoGetTokensByUserId(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	inTokens := []interface{}{
+		jwt.Token{
+			Id: "id-1",
+			Claims: jwt.Claims{
+				ID:       "id-1",
+				IssuedAt: 5678,
+				Subject:  "user-1",
+			},
+		},
+		jwt.Token{
+			Id: "id-2",
+			Claims: jwt.Claims{
+				ID:       "id-2",
+				IssuedAt: 1234,
+				Subject:  "user-1",
+			},
+		},
+		jwt.Token{
+			Id: "id-3",
+			Claims: jwt.Claims{
+				ID:       "id-3",
+				IssuedAt: 1234,
+				Subject:  "user-2",
+			},
+		},
+	}
+
+	testCases := map[string]struct {
+		tenant string
+		user   string
+
+		outTokens []jwt.Token
+	}{
+		"ok": {
+			user: "user-1",
+			outTokens: []jwt.Token{
+				{
+					Id: "id-2",
+					Claims: jwt.Claims{
+						ID:       "id-2",
+						IssuedAt: 1234,
+						Subject:  "user-1",
+					},
+				},
+				{
+					Id: "id-1",
+					Claims: jwt.Claims{
+						ID:       "id-1",
+						IssuedAt: 5678,
+						Subject:  "user-1",
+					},
+				},
+			},
+		},
+		"ok - tenant": {
+			tenant: "tenant-1",
+			user:   "user-2",
+			outTokens: []jwt.Token{
+				{
+					Id: "id-3",
+					Claims: jwt.Claims{
+						ID:       "id-3",
+						IssuedAt: 1234,
+						Subject:  "user-2",
+					},
+				},
+			},
+		},
+		"ok - no tokens": {
+			user:      "user-3",
+			outTokens: []jwt.Token{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		db.Wipe()
+
+		ctx := context.Background()
+		if tc.tenant != "" {
+			ctx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tc.tenant,
+			})
+		}
+
+		session := db.Session()
+		store, err := NewDataStoreMongoWithSession(session)
+		assert.NoError(t, err)
+
+		err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).Insert(inTokens...)
+		assert.NoError(t, err)
+
+		tokens, err := store.GetTokensByUserId(ctx, tc.user)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.outTokens, tokens)
+
+		session.Close()
+	}
+}
+
+func TestMongoFeatures(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	ds, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	features, err := ds.GetFeatures(ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, features)
+
+	assert.NoError(t, ds.SetFeature(ctx, &model.Feature{Name: "foo", Enabled: true}))
+	assert.NoError(t, ds.SetFeature(ctx, &model.Feature{Name: "bar", Enabled: true}))
+	assert.NoError(t, ds.SetFeature(ctx, &model.Feature{Name: "bar"}))
+
+	features, err = ds.GetFeatures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Feature{{Name: "bar"}, {Name: "foo", Enabled: true}}, features)
+
+	// other tenants are not affected
+	features, err = ds.GetFeatures(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, features)
+
+	assert.NoError(t, ds.DeleteFeature(ctx, "bar"))
+	assert.NoError(t, ds.DeleteFeature(ctx, "baz"))
+
+	features, err = ds.GetFeatures(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Feature{{Name: "foo", Enabled: true}}, features)
+}
+
+func TestMongoPlan(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	plan, err := store.GetPlan(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, plan)
+
+	assert.NoError(t, store.SetPlan(ctx, &model.Plan{Name: model.PlanOpenSource}))
+	assert.NoError(t, store.SetPlan(ctx, &model.Plan{Name: model.PlanEnterprise}))
+
+	plan, err = store.GetPlan(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Plan{Name: model.PlanEnterprise}, plan)
+
+	// other tenants are not affected
+	plan, err = store.GetPlan(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, plan)
+}
+
+func TestMongoLimits(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	errLimitReached := store.ErrUserLimitReached
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	limit, err := store.GetLimit(ctx, model.LimitMaxUsers)
+	assert.NoError(t, err)
+	assert.Nil(t, limit)
+
+	// no limit set
+	for _, id := range []string{"1", "2"} {
+		err := store.CreateUser(ctx, &model.User{
+			ID:       id,
+			Email:    id + "@bar.com",
+			Password: "passwordhash12345",
+		})
+		assert.NoError(t, err)
+	}
+
+	err = store.SetLimit(ctx, &model.Limit{Name: model.LimitMaxUsers, Value: 3})
+	assert.NoError(t, err)
+
+	limit, err = store.GetLimit(ctx, model.LimitMaxUsers)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Limit{Name: model.LimitMaxUsers, Value: 3}, limit)
+
+	err = store.CreateUser(ctx, &model.User{
+		ID:       "3",
+		Email:    "3@bar.com",
+		Password: "passwordhash12345",
+	})
+	assert.NoError(t, err)
+
+	err = store.CreateUser(ctx, &model.User{
+		ID:       "4",
+		Email:    "4@bar.com",
+		Password: "passwordhash12345",
+	})
+	assert.Equal(t, errLimitReached, err)
+
+	user, err := store.GetUserById(ctx, "4")
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+
+	// the limit is per tenant
+	err = store.CreateUser(context.Background(), &model.User{
+		ID:       "4",
+		Email:    "4@bar.com",
+		Password: "passwordhash12345",
+	})
+	assert.NoError(t, err)
+
+	// deleted users are restored within the limit only
+	assert.NoError(t, store.DeleteUser(ctx, "3", nil))
+	err = store.CreateUser(ctx, &model.User{
+		ID:       "5",
+		Email:    "5@bar.com",
+		Password: "passwordhash12345",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, errLimitReached, store.RestoreUser(ctx, "3"))
+
+	user, err = store.GetUserById(ctx, "3")
+	assert.NoError(t, err)
+	assert.Nil(t, user)
+
+	// zero lifts the limit
+	err = store.SetLimit(ctx, &model.Limit{Name: model.LimitMaxUsers, Value: 0})
+	assert.NoError(t, err)
+
+	err = store.CreateUser(ctx, &model.User{
+		ID:       "4",
+		Email:    "4@bar.com",
+		Password: "passwordhash12345",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, store.RestoreUser(ctx, "3"))
+}
+
+func TestMongoSaveSettings(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	created := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// we'll preset settings _id for easy 1:1 comparison on test (normally autogenerated)
+	testCases := map[string]struct {
+		settingsIn       map[string]interface{}
+		settingsExisting map[string]interface{}
+		settingsOut      map[string]interface{}
+		createdTs        *time.Time
+		tenant           string
+		err              string
+	}{
+		"ok: insert": {
+			settingsIn: map[string]interface{}{
+				"_id": "1",
+				"foo": "foo-val",
+				"bar": 42,
+			},
+			settingsOut: map[string]interface{}{
+				"_id": "1",
+				"foo": "foo-val",
+				"bar": 42,
+			},
+		},
+		"ok: insert, tenant": {
+			settingsIn: map[string]interface{}{
+				"_id": "1",
+				"foo": "foo-val",
+				"bar": 42,
+			},
+			settingsOut: map[string]interface{}{
+				"_id": "1",
+				"foo": "foo-val",
+				"bar": 42,
+			},
+			tenant: "acme",
+		},
+		"ok: overwrite with exact same fields": {
+			settingsIn: map[string]interface{}{
+				"_id": "1",
+				"foo": "foo-val",
+				"bar": 42,
+			},
+			settingsExisting: map[string]interface{}{
+				"_id": "1",
+				"foo": "foo-val-old",
+				"bar": 0,
+			},
+			settingsOut: map[string]interface{}{
+				"_id": "1",
+				"foo": "foo-val",
+				"bar": 42,
+			},
+		},
+		"ok: overwrite, keep creation time": {
+			settingsIn: map[string]interface{}{
+				"_id":        "1",
+				"foo":        "foo-val",
+				"created_ts": "bogus",
+			},
+			settingsExisting: map[string]interface{}{
+				"_id":        "1",
+				"foo":        "foo-val-old",
+				"created_ts": created,
+				"updated_ts": created,
+			},
+			settingsOut: map[string]interface{}{
+				"_id": "1",
+				"foo": "foo-val",
+			},
+			createdTs: &created,
+		},
+		"ok: overwrite with different fields": {
+			settingsIn: map[string]interface{}{
+				"_id":  "1",
+				"baz1": "baz",
+				"baz2": 420,
+			},
+			settingsExisting: map[string]interface{}{
+				"_id": "1",
+				"foo": "foo-val-old",
+				"bar": 0,
+			},
+			settingsOut: map[string]interface{}{
+				"_id":  "1",
+				"baz1": "baz",
+				"baz2": 420,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		db.Wipe()
+
+		ctx := context.Background()
+		if tc.tenant != "" {
+			ctx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tc.tenant,
+			})
+		}
+
+		session := db.Session()
+		store, err := NewDataStoreMongoWithSession(session)
+		assert.NoError(t, err)
+
+		if tc.settingsExisting != nil {
+			err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsColl).Insert(tc.settingsExisting)
+			assert.NoError(t, err)
+		}
+
+		before := time.Now().UTC().Truncate(time.Millisecond)
+		etag, err := store.SaveSettings(ctx, tc.settingsIn, nil)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		var settings map[string]interface{}
+
+		err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsColl).Find(nil).One(&settings)
+		assert.NoError(t, err)
+
+		createdTs, _ := settings[DbSettingsCreatedTs].(time.Time)
+		updatedTs, _ := settings[DbSettingsUpdatedTs].(time.Time)
+		if tc.createdTs != nil {
+			assert.True(t, tc.createdTs.Equal(createdTs))
+		} else {
+			assert.True(t, createdTs.Equal(updatedTs))
+		}
+		assert.False(t, updatedTs.Before(before))
+
+		assert.Equal(t, etag, settings[DbSettingsETag])
+
+		delete(settings, DbSettingsCreatedTs)
+		delete(settings, DbSettingsUpdatedTs)
+		delete(settings, DbSettingsETag)
+		assert.Equal(t, tc.settingsOut, settings)
+
+		session.Close()
+	}
+}
+
+func TestMongoGetSettings(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	testCases := map[string]struct {
+		settingsExisting map[string]interface{}
+		settingsOut      map[string]interface{}
+		tenant           string
+		err              string
+	}{
+		"ok": {
+			settingsExisting: map[string]interface{}{
+				"foo": "foo-val",
+				"bar": 42,
+			},
+			settingsOut: map[string]interface{}{
+				"foo": "foo-val",
+				"bar": 42,
+			},
+		},
+		"ok, tenant": {
+			settingsExisting: map[string]interface{}{
+				"foo": "foo-val",
+				"bar": 42,
+			},
+			settingsOut: map[string]interface{}{
+				"foo": "foo-val",
+				"bar": 42,
+			},
+			tenant: "tenant-foo",
+		},
+		"ok, empty": {
+			settingsOut: map[string]interface{}{},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		db.Wipe()
+
+		ctx := context.Background()
+		if tc.tenant != "" {
+			ctx = identity.WithContext(ctx, &identity.Identity{
+				Tenant: tc.tenant,
+			})
+		}
+
+		session := db.Session()
+		store, err := NewDataStoreMongoWithSession(session)
+		assert.NoError(t, err)
+
+		if tc.settingsExisting != nil {
+			err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsColl).Insert(tc.settingsExisting)
+			assert.NoError(t, err)
+		}
+
+		out, err := store.GetSettings(ctx)
+
+		assert.NoError(t, err)
+		// settings saved before versioning get an ETag on the next save
+		assert.Equal(t, tc.settingsOut, out)
+
+		session.Close()
+	}
+}
+
+func TestMongoUserSettings(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "tenant-foo",
+	})
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	out, err := store.GetUserSettings(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, out)
+
+	err = store.SaveUserSettings(ctx, "foo", map[string]interface{}{"theme": "dark"})
+	assert.NoError(t, err)
+
+	out, err = store.GetUserSettings(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "dark", out["theme"])
+	createdTs := out[DbSettingsCreatedTs]
+	assert.NotNil(t, createdTs)
+
+	// settings are replaced, the creation time is kept
+	err = store.SaveUserSettings(ctx, "foo", map[string]interface{}{"language": "en"})
+	assert.NoError(t, err)
+
+	out, err = store.GetUserSettings(ctx, "foo")
+	assert.NoError(t, err)
+	assert.Nil(t, out["theme"])
+	assert.Equal(t, "en", out["language"])
+	assert.Equal(t, createdTs, out[DbSettingsCreatedTs])
+
+	// other users don't share the settings
+	out, err = store.GetUserSettings(ctx, "bar")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{}, out)
+}
+
+func TestMongoSettingsVersions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	errMismatch := store.ErrSettingsETagMismatch
+	errVersionNotFound := store.ErrSettingsVersionNotFound
+
+	db.Wipe()
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "tenant-foo",
+	})
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	// nothing to match yet
+	_, err = store.SaveSettings(ctx, map[string]interface{}{"foo": 1}, []string{"bogus"})
+	assert.Equal(t, errMismatch, err)
+
+	first, err := store.SaveSettings(ctx, map[string]interface{}{"foo": 1}, nil)
+	assert.NoError(t, err)
+
+	second, err := store.SaveSettings(ctx, map[string]interface{}{"foo": 2}, []string{first})
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	// a concurrent update based on the first version is rejected
+	_, err = store.SaveSettings(ctx, map[string]interface{}{"foo": 3}, []string{first})
+	assert.Equal(t, errMismatch, err)
+
+	history, err := store.GetSettingsHistory(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, history, 1)
+	assert.Equal(t, first, history[0].ETag)
+	assert.Equal(t, 1, history[0].Settings["foo"])
+
+	_, err = store.RollbackSettings(ctx, "bogus", nil)
+	assert.Equal(t, errVersionNotFound, err)
+
+	_, err = store.RollbackSettings(ctx, first, []string{first})
+	assert.Equal(t, errMismatch, err)
+
+	third, err := store.RollbackSettings(ctx, first, []string{second})
+	assert.NoError(t, err)
+
+	settings, err := store.GetSettings(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, settings["foo"])
+	assert.Equal(t, third, settings[DbSettingsETag])
+
+	history, err = store.GetSettingsHistory(ctx)
+	assert.NoError(t, err)
+	etags := []string{}
+	for _, v := range history {
+		etags = append(etags, v.ETag)
+	}
+	assert.Len(t, etags, 2)
+	assert.Contains(t, etags, first)
+	assert.Contains(t, etags, second)
+
+	// the history is bounded
+	for i := 0; i < SettingsHistoryLength+5; i++ {
+		_, err = store.SaveSettings(ctx, map[string]interface{}{"foo": i}, nil)
+		assert.NoError(t, err)
+	}
+	history, err = store.GetSettingsHistory(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, history, SettingsHistoryLength)
+}
+
+func TestMongoSaveDeleteSetting(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	errMismatch := store.ErrSettingsETagMismatch
+	errNotFound := store.ErrSettingNotFound
+
+	db.Wipe()
+
+	ctx := context.Background()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	first, err := store.SaveSetting(ctx, "foo", "foo-val", nil)
+	assert.NoError(t, err)
+
+	second, err := store.SaveSetting(ctx, "bar", 42, []string{first})
+	assert.NoError(t, err)
+
+	_, err = store.SaveSetting(ctx, "bar", 43, []string{first})
+	assert.Equal(t, errMismatch, err)
+
+	settings, err := store.GetSettings(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo-val", settings["foo"])
+	assert.Equal(t, 42, settings["bar"])
+	assert.Equal(t, second, settings[DbSettingsETag])
+
+	_, err = store.DeleteSetting(ctx, "baz", nil)
+	assert.Equal(t, errNotFound, err)
+
+	_, err = store.DeleteSetting(ctx, "foo", nil)
+	assert.NoError(t, err)
+
+	settings, err = store.GetSettings(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, settings["foo"])
+	assert.Equal(t, 42, settings["bar"])
+
+	// every change is kept in the history
+	history, err := store.GetSettingsHistory(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func TestMongoSettingsSchema(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "tenant-foo",
+	})
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	schema, err := store.GetSettingsSchema(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "", schema)
+
+	err = store.SaveSettingsSchema(ctx, `{"$schema": "foo"}`)
+	assert.NoError(t, err)
+	err = store.SaveSettingsSchema(ctx, `{"type": "object"}`)
+	assert.NoError(t, err)
+
+	schema, err = store.GetSettingsSchema(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"type": "object"}`, schema)
+
+	// other tenants are not affected
+	schema, err = store.GetSettingsSchema(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "", schema)
+
+	assert.NoError(t, store.DeleteSettingsSchema(ctx))
+	assert.NoError(t, store.DeleteSettingsSchema(ctx))
+
+	schema, err = store.GetSettingsSchema(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "", schema)
+}
+
+func TestMongoCheckConsistency(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	ctx := context.Background()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	// inserted directly, without the indexes
+	database := session.DB(DbName)
+	assert.NoError(t, database.C(DbUsersColl).Insert(
+		model.User{ID: "1", Email: "foo@bar.com"},
+		model.User{ID: "2", Email: "FOO@bar.com"},
+		model.User{ID: "3", Email: "baz@bar.com"},
+	))
+	for _, sub := range []string{"1", "4"} {
+		assert.NoError(t, database.C(DbTokensColl).Insert(jwt.Token{
+			Id:     "token-" + sub,
+			Claims: jwt.Claims{Subject: sub},
+		}))
+	}
+	// issued to an OAuth client and a service account, not users
+	assert.NoError(t, database.C(DbTokensColl).Insert(jwt.Token{
+		Id:     "token-client",
+		Claims: jwt.Claims{Subject: "client-1", Client: true},
+	}, jwt.Token{
+		Id:     "token-account",
+		Claims: jwt.Claims{Subject: "account-1", ServiceAccount: true},
+	}))
+
+	kinds := func(issues []ConsistencyIssue) map[string]int {
+		found := map[string]int{}
+		for _, issue := range issues {
+			assert.Equal(t, "", issue.Tenant)
+			if !issue.Repaired {
+				found[issue.Kind]++
+			}
+		}
+		return found
+	}
+
+	issues, err := store.CheckConsistency(ctx, false)
+	assert.NoError(t, err)
+	found := kinds(issues)
+	assert.Equal(t, len(store.indexes()), found[IssueMissingIndex])
+	assert.Equal(t, 1, found[IssueDuplicateEmail])
+	assert.Equal(t, 1, found[IssueOrphanedTokens])
+	for _, issue := range issues {
+		switch issue.Kind {
+		case IssueDuplicateEmail:
+			assert.Equal(t, "2", issue.ID)
+		case IssueOrphanedTokens:
+			assert.Equal(t, "4", issue.ID)
+		}
+	}
+
+	// the email index can't be created until the duplicate is resolved
+	issues, err = store.CheckConsistency(ctx, true)
+	assert.NoError(t, err)
+	found = kinds(issues)
+	assert.Equal(t, 1, found[IssueMissingIndex])
+	assert.Equal(t, 1, found[IssueDuplicateEmail])
+	assert.Equal(t, 0, found[IssueOrphanedTokens])
+
+	n, err := database.C(DbTokensColl).Find(bson.M{DbTokenSub: "4"}).Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	for _, sub := range []string{"1", "client-1", "account-1"} {
+		n, err = database.C(DbTokensColl).Find(bson.M{DbTokenSub: sub}).Count()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, n)
+	}
+
+	issues, err = store.CheckConsistency(ctx, false)
+	assert.NoError(t, err)
+	assert.Len(t, issues, 2)
+}
+
+func TestMongoJobStatuses(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	ctx := context.Background()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	statuses, err := store.GetJobStatuses(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 0)
+
+	started := time.Now().UTC().Truncate(time.Millisecond)
+	assert.NoError(t, store.SaveJobRun(ctx, &model.JobRun{
+		Name:       "foo",
+		StartedTs:  started,
+		FinishedTs: started.Add(time.Second),
+	}))
+	assert.NoError(t, store.SaveJobRun(ctx, &model.JobRun{
+		Name:       "foo",
+		StartedTs:  started.Add(time.Minute),
+		FinishedTs: started.Add(time.Minute),
+		Error:      "failed",
+	}))
+	assert.NoError(t, store.SaveJobRun(ctx, &model.JobRun{
+		Name:       "bar",
+		StartedTs:  started,
+		FinishedTs: started,
+	}))
+	assert.NoError(t, store.SaveJobRun(ctx, &model.JobRun{
+		Name:       "bar",
+		StartedTs:  started.Add(time.Minute),
+		FinishedTs: started.Add(time.Minute),
+		Skipped:    true,
+	}))
+
+	statuses, err = store.GetJobStatuses(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+
+	assert.Equal(t, "bar", statuses[0].Name)
+	assert.Equal(t, 1, statuses[0].Runs)
+	assert.Equal(t, 1, statuses[0].Skips)
+	if assert.NotNil(t, statuses[0].LastSkippedTs) {
+		assert.True(t, started.Add(time.Minute).Equal(*statuses[0].LastSkippedTs))
+	}
+	assert.True(t, started.Equal(statuses[0].LastStartedTs))
+
+	foo := statuses[1]
+	assert.Equal(t, "foo", foo.Name)
+	assert.Equal(t, 2, foo.Runs)
+	assert.Equal(t, 1, foo.Failures)
+	assert.Equal(t, "failed", foo.LastError)
+	assert.Equal(t, int64(0), foo.LastDurationMs)
+	if assert.NotNil(t, foo.LastSuccessTs) {
+		assert.True(t, started.Add(time.Second).Equal(*foo.LastSuccessTs))
+	}
+}
+
+func TestMongoAcquireJobLease(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	ctx := context.Background()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	now := time.Now()
+
+	leased, err := store.AcquireJobLease(ctx, "foo", "a", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, leased)
+
+	// held by a
+	leased, err = store.AcquireJobLease(ctx, "foo", "b", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.False(t, leased)
+
+	// renewed by a, expired right away
+	leased, err = store.AcquireJobLease(ctx, "foo", "a", now.Add(-time.Second))
+	assert.NoError(t, err)
+	assert.True(t, leased)
+
+	// taken over by b
+	leased, err = store.AcquireJobLease(ctx, "foo", "b", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, leased)
+
+	// other jobs have their own leases
+	leased, err = store.AcquireJobLease(ctx, "bar", "a", now.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, leased)
+}
+
+func TestMongoMaintenance(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	ctx := context.Background()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	s, err := store.GetMaintenance(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+
+	since := time.Now().UTC().Truncate(time.Millisecond)
+	enabled := &model.MaintenanceState{Enabled: true, RetryAfter: 60, Since: &since}
+	assert.NoError(t, store.SaveMaintenance(ctx, enabled))
+
+	s, err = store.GetMaintenance(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, enabled.Enabled, s.Enabled)
+	assert.Equal(t, enabled.RetryAfter, s.RetryAfter)
+	assert.WithinDuration(t, since, *s.Since, time.Millisecond)
+
+	// replaced, not merged
+	assert.NoError(t, store.SaveMaintenance(ctx, &model.MaintenanceState{RetryAfter: 60}))
+
+	s, err = store.GetMaintenance(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.MaintenanceState{RetryAfter: 60}, s)
+}
+
+func TestMongoTokensRevoked(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ts, err := store.GetTokensRevokedTs(ctx, "1")
+	assert.NoError(t, err)
+	assert.True(t, ts.IsZero())
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	assert.NoError(t, store.RevokeTokens(ctx, "", now))
+	// an earlier revocation doesn't move the time back
+	assert.NoError(t, store.RevokeTokens(ctx, "", now.Add(-time.Hour)))
+	assert.NoError(t, store.RevokeTokens(ctx, "1", now.Add(time.Minute)))
+
+	ts, err = store.GetTokensRevokedTs(ctx, "1")
+	assert.NoError(t, err)
+	assert.True(t, now.Add(time.Minute).Equal(ts))
+
+	ts, err = store.GetTokensRevokedTs(ctx, "2")
+	assert.NoError(t, err)
+	assert.True(t, now.Equal(ts))
+
+	// other tenants are not affected
+	ts, err = store.GetTokensRevokedTs(context.Background(), "1")
+	assert.NoError(t, err)
+	assert.True(t, ts.IsZero())
+}
+
+func TestMongoTokenRevocations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	ctx := context.Background()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	r, err := store.ClaimTokenRevocation(ctx, now, now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	for i, id := range []string{"2", "1"} {
+		assert.NoError(t, store.SaveTokenRevocation(ctx, &model.TokenRevocation{
+			ID:        id,
+			TenantID:  "foo",
+			Status:    model.RevocationStatusPending,
+			CreatedTs: now.Add(-time.Duration(i) * time.Second),
+		}))
+	}
+
+	// oldest first
+	r, err = store.ClaimTokenRevocation(ctx, now, now.Add(-time.Minute))
+	assert.NoError(t, err)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "1", r.ID)
+		assert.Equal(t, model.RevocationStatusRunning, r.Status)
+		assert.True(t, now.Equal(*r.StartedTs))
+	}
+
+	r, err = store.ClaimTokenRevocation(ctx, now, now.Add(-time.Minute))
+	assert.NoError(t, err)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "2", r.ID)
+		r.Status = model.RevocationStatusDone
+		r.FinishedTs = &now
+		assert.NoError(t, store.SaveTokenRevocation(ctx, r))
+	}
+
+	r, err = store.ClaimTokenRevocation(ctx, now, now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	// revocations running for too long are taken over
+	later := now.Add(time.Hour)
+	r, err = store.ClaimTokenRevocation(ctx, later, later.Add(-time.Minute))
+	assert.NoError(t, err)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, "1", r.ID)
+	}
+
+	r, err = store.GetTokenRevocation(ctx, "2")
+	assert.NoError(t, err)
+	if assert.NotNil(t, r) {
+		assert.Equal(t, model.RevocationStatusDone, r.Status)
+	}
+
+	r, err = store.GetTokenRevocation(ctx, "3")
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+}
+
+func TestMongoOAuthClients(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	foo := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+	bar := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "bar",
+	})
+
+	ts := time.Now().UTC().Round(time.Millisecond)
+	assert.NoError(t, store.CreateOAuthClient(foo, &model.OAuthClient{
+		ID:         "1",
+		Name:       "ci",
+		Scope:      "mender.*",
+		SecretHash: "hash",
+		CreatedTs:  ts,
+	}))
+	assert.NoError(t, store.CreateOAuthClient(foo, &model.OAuthClient{
+		ID:        "2",
+		Name:      "backup",
+		CreatedTs: ts.Add(time.Second),
+	}))
+
+	client, err := store.GetOAuthClientById(bar, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, &model.OAuthClient{
+		ID:         "1",
+		TenantID:   "foo",
+		Name:       "ci",
+		Scope:      "mender.*",
+		SecretHash: "hash",
+		CreatedTs:  ts,
+	}, client)
+
+	client, err = store.GetOAuthClientById(foo, "3")
+	assert.NoError(t, err)
+	assert.Nil(t, client)
+
+	clients, err := store.GetOAuthClients(foo)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 2)
+	assert.Equal(t, "1", clients[0].ID)
+	assert.Equal(t, "2", clients[1].ID)
+
+	clients, err = store.GetOAuthClients(bar)
+	assert.NoError(t, err)
+	assert.Len(t, clients, 0)
+
+	assert.EqualError(t, store.DeleteOAuthClient(bar, "1"), "client not found")
+	assert.NoError(t, store.DeleteOAuthClient(foo, "1"))
+	assert.EqualError(t, store.DeleteOAuthClient(foo, "1"), "client not found")
+}
+
+func TestMongoOAuthCodes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	ts := time.Now().UTC().Round(time.Millisecond)
+	code := &model.OAuthCode{
+		ID:            "hash",
+		ClientID:      "client-1",
+		TenantID:      "foo",
+		UserID:        "user-1",
+		RedirectURI:   "https://tool.example.com/callback",
+		Scope:         "openid",
+		CodeChallenge: "challenge",
+		AccessScope:   "mender.*",
+		AuthTime:      ts,
+		ExpiresTs:     ts.Add(time.Minute),
+	}
+	assert.NoError(t, store.SaveOAuthCode(ctx, code))
+
+	// a code can only be taken once
+	taken, err := store.TakeOAuthCode(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, code, taken)
 
-		db.Wipe()
+	taken, err = store.TakeOAuthCode(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, taken)
+}
 
-		ctx := context.Background()
-		if tc.tenant != "" {
-			ctx = identity.WithContext(ctx, &identity.Identity{
-				Tenant: tc.tenant,
-			})
-		}
+func TestMongoDeviceAuthorizations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
 
-		session := db.Session()
-		store, err := NewDataStoreMongoWithSession(session)
-		assert.NoError(t, err)
+	db.Wipe()
 
-		if len(tc.inTokens) > 0 {
-			err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).Insert(tc.inTokens...)
-			assert.NoError(t, err)
-		}
+	session := db.Session()
+	defer session.Close()
 
-		err = store.DeleteTokensByUserId(ctx, tc.user)
-		if tc.outError != "" {
-			assert.EqualError(t, err, tc.outError)
-		} else {
-			assert.NoError(t, err)
-		}
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
 
-		var tokens []jwt.Token
-		if tc.outTokens != nil {
-			err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbTokensColl).Find(nil).All(&tokens)
-			assert.NoError(t, err)
-		}
+	ctx := context.Background()
 
-		assert.Equal(t, tc.outTokens, tokens)
+	a := &model.DeviceAuthorization{
+		ID:        "hash",
+		UserCode:  "BCDFGHJK",
+		ClientID:  "mender-cli",
+		Scope:     "mender.users:read",
+		Status:    model.DeviceAuthorizationPending,
+		Interval:  5,
+		ExpiresTs: time.Now().UTC().Round(time.Millisecond).Add(time.Minute),
+	}
+	assert.NoError(t, store.CreateDeviceAuthorization(ctx, a))
+	assert.EqualError(t, store.CreateDeviceAuthorization(ctx,
+		&model.DeviceAuthorization{ID: "other", UserCode: "BCDFGHJK"}),
+		"user code already exists")
 
-		session.Close()
+	found, err := store.GetDeviceAuthorizationByUserCode(ctx, "BCDFGHJK")
+	assert.NoError(t, err)
+	assert.Equal(t, a, found)
+
+	found, err = store.GetDeviceAuthorizationByUserCode(ctx, "ZZZZZZZZ")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+
+	ts := time.Now().UTC().Round(time.Millisecond)
+	assert.NoError(t, store.SetDeviceAuthorizationPolled(ctx, "hash", ts, 10))
+
+	r := model.DeviceAuthorizationResolution{
+		Status:   model.DeviceAuthorizationApproved,
+		TenantID: "foo",
+		UserID:   "user-1",
+		Scope:    "mender.users:read",
 	}
+	assert.NoError(t, store.ResolveDeviceAuthorization(ctx, "hash", r))
+	// decided only once
+	assert.EqualError(t, store.ResolveDeviceAuthorization(ctx, "hash", r),
+		"device authorization not found")
+
+	found, err = store.GetDeviceAuthorization(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, model.DeviceAuthorizationApproved, found.Status)
+	assert.Equal(t, "foo", found.TenantID)
+	assert.Equal(t, "user-1", found.UserID)
+	assert.Equal(t, ts, found.PolledTs)
+	assert.Equal(t, 10, found.Interval)
+
+	assert.NoError(t, store.DeleteDeviceAuthorization(ctx, "hash"))
+	assert.EqualError(t, store.DeleteDeviceAuthorization(ctx, "hash"),
+		"device authorization not found")
 }
 
-func TestMongoSaveSettings(t *testing.T) {
+func TestMongoLoginLinks(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping in short mode.")
 	}
 
-	// we'll preset settings _id for easy 1:1 comparison on test (normally autogenerated)
-	testCases := map[string]struct {
-		settingsIn       map[string]interface{}
-		settingsExisting map[string]interface{}
-		settingsOut      map[string]interface{}
-		tenant           string
-		err              string
-	}{
-		"ok: insert": {
-			settingsIn: map[string]interface{}{
-				"_id": "1",
-				"foo": "foo-val",
-				"bar": 42,
-			},
-			settingsOut: map[string]interface{}{
-				"_id": "1",
-				"foo": "foo-val",
-				"bar": 42,
-			},
-		},
-		"ok: insert, tenant": {
-			settingsIn: map[string]interface{}{
-				"_id": "1",
-				"foo": "foo-val",
-				"bar": 42,
-			},
-			settingsOut: map[string]interface{}{
-				"_id": "1",
-				"foo": "foo-val",
-				"bar": 42,
-			},
-			tenant: "acme",
-		},
-		"ok: overwrite with exact same fields": {
-			settingsIn: map[string]interface{}{
-				"_id": "1",
-				"foo": "foo-val",
-				"bar": 42,
-			},
-			settingsExisting: map[string]interface{}{
-				"_id": "1",
-				"foo": "foo-val-old",
-				"bar": 0,
-			},
-			settingsOut: map[string]interface{}{
-				"_id": "1",
-				"foo": "foo-val",
-				"bar": 42,
-			},
-		},
-		"ok: overwrite with different fields": {
-			settingsIn: map[string]interface{}{
-				"_id":  "1",
-				"baz1": "baz",
-				"baz2": 420,
-			},
-			settingsExisting: map[string]interface{}{
-				"_id": "1",
-				"foo": "foo-val-old",
-				"bar": 0,
-			},
-			settingsOut: map[string]interface{}{
-				"_id":  "1",
-				"baz1": "baz",
-				"baz2": 420,
-			},
-		},
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	link := &model.LoginLink{
+		ID:        "hash",
+		TenantID:  "foo",
+		UserID:    "user-1",
+		Email:     "foo@bar.com",
+		CreatedTs: time.Now().UTC().Round(time.Millisecond).Add(-time.Second),
+		ExpiresTs: time.Now().UTC().Round(time.Millisecond).Add(time.Minute),
 	}
+	assert.NoError(t, store.SaveLoginLink(ctx, link))
+	latest := *link
+	latest.ID = "latest"
+	latest.CreatedTs = time.Now().UTC().Round(time.Millisecond)
+	assert.NoError(t, store.SaveLoginLink(ctx, &latest))
 
-	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
+	found, err := store.GetLatestLoginLink(ctx, "foo", "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, &latest, found)
+	found, err = store.GetLatestLoginLink(ctx, "bar", "user-1")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
 
-		db.Wipe()
+	// a link can only be taken once
+	taken, err := store.TakeLoginLink(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, link, taken)
 
-		ctx := context.Background()
-		if tc.tenant != "" {
-			ctx = identity.WithContext(ctx, &identity.Identity{
-				Tenant: tc.tenant,
-			})
-		}
+	taken, err = store.TakeLoginLink(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Nil(t, taken)
+}
 
-		session := db.Session()
-		store, err := NewDataStoreMongoWithSession(session)
-		assert.NoError(t, err)
+func TestMongoSessions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
 
-		if tc.settingsExisting != nil {
-			err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsColl).Insert(tc.settingsExisting)
-			assert.NoError(t, err)
-		}
+	db.Wipe()
 
-		err = store.SaveSettings(ctx, tc.settingsIn)
-		if tc.err != "" {
-			assert.EqualError(t, err, tc.err)
-		} else {
-			assert.NoError(t, err)
-		}
+	session := db.Session()
+	defer session.Close()
 
-		var settings map[string]interface{}
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
 
-		err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsColl).Find(nil).One(&settings)
-		assert.NoError(t, err)
-		assert.Equal(t, tc.settingsOut, settings)
+	ctx := context.Background()
 
-		session.Close()
+	s := &model.Session{
+		ID:        "hash",
+		TenantID:  "foo",
+		TokenID:   "token-1",
+		ExpiresTs: time.Now().UTC().Round(time.Millisecond).Add(time.Hour),
 	}
+	assert.NoError(t, store.SaveSession(ctx, s))
+
+	found, err := store.GetSession(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, s, found)
+
+	found, err = store.GetSession(ctx, "other")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
 }
 
-func TestMongoGetSettings(t *testing.T) {
+func TestMongoLoginOTPs(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping in short mode.")
 	}
 
-	testCases := map[string]struct {
-		settingsExisting map[string]interface{}
-		settingsOut      map[string]interface{}
-		tenant           string
-		err              string
-	}{
-		"ok": {
-			settingsExisting: map[string]interface{}{
-				"foo": "foo-val",
-				"bar": 42,
-			},
-			settingsOut: map[string]interface{}{
-				"foo": "foo-val",
-				"bar": 42,
-			},
-		},
-		"ok, tenant": {
-			settingsExisting: map[string]interface{}{
-				"foo": "foo-val",
-				"bar": 42,
-			},
-			settingsOut: map[string]interface{}{
-				"foo": "foo-val",
-				"bar": 42,
-			},
-			tenant: "tenant-foo",
-		},
-		"ok, empty": {
-			settingsOut: map[string]interface{}{},
-		},
-	}
+	db.Wipe()
 
-	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
+	session := db.Session()
+	defer session.Close()
 
-		db.Wipe()
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
 
-		ctx := context.Background()
-		if tc.tenant != "" {
-			ctx = identity.WithContext(ctx, &identity.Identity{
-				Tenant: tc.tenant,
-			})
-		}
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
 
-		session := db.Session()
-		store, err := NewDataStoreMongoWithSession(session)
-		assert.NoError(t, err)
+	otp := &model.LoginOTP{
+		UserID:    "user-1",
+		Code:      "hash",
+		Channel:   model.SecondFactorEmail,
+		ExpiresTs: time.Now().UTC().Round(time.Millisecond).Add(time.Minute),
+	}
+	assert.NoError(t, store.SaveLoginOTP(ctx, otp))
 
-		if tc.settingsExisting != nil {
-			err = session.DB(mstore.DbFromContext(ctx, DbName)).C(DbSettingsColl).Insert(tc.settingsExisting)
-			assert.NoError(t, err)
+	found, err := store.GetLoginOTP(ctx, "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, otp, found)
+
+	// the code is returned as it was before the attempt
+	for i := 0; i < model.MaxLoginOTPAttempts; i++ {
+		found, err = store.TakeLoginOTPAttempt(ctx, "user-1", time.Now())
+		assert.NoError(t, err)
+		if assert.NotNil(t, found) {
+			assert.Equal(t, i, found.Attempts)
 		}
+	}
+	found, err = store.TakeLoginOTPAttempt(ctx, "user-1", time.Now())
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+	found, err = store.GetLoginOTP(ctx, "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, model.MaxLoginOTPAttempts, found.Attempts)
 
-		out, err := store.GetSettings(ctx)
+	// a new code replaces the previous one
+	otp.Code = "other"
+	assert.NoError(t, store.SaveLoginOTP(ctx, otp))
+	found, err = store.GetLoginOTP(ctx, "user-1")
+	assert.NoError(t, err)
+	assert.Equal(t, otp, found)
 
-		assert.NoError(t, err)
-		assert.Equal(t, tc.settingsOut, out)
+	assert.NoError(t, store.DeleteLoginOTP(ctx, "user-1"))
+	assert.EqualError(t, store.DeleteLoginOTP(ctx, "user-1"), "login code not found")
+	found, err = store.TakeLoginOTPAttempt(ctx, "user-1", time.Now())
+	assert.NoError(t, err)
+	assert.Nil(t, found)
 
-		session.Close()
+	found, err = store.GetLoginOTP(ctx, "user-1")
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+}
+
+func TestMongoServiceAccounts(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
 	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+
+	ts := time.Now().UTC().Round(time.Millisecond)
+	assert.NoError(t, store.CreateServiceAccount(ctx, &model.ServiceAccount{
+		ID:        "1",
+		Name:      "deploy",
+		Scope:     "mender.*",
+		Owner:     "user-1",
+		CreatedTs: ts,
+		UpdatedTs: ts,
+	}))
+	assert.NoError(t, store.CreateServiceAccount(ctx, &model.ServiceAccount{
+		ID:   "2",
+		Name: "backup",
+	}))
+	err = store.CreateServiceAccount(ctx, &model.ServiceAccount{ID: "3", Name: "deploy"})
+	assert.EqualError(t, err, "service account with a given name already exists")
+
+	accounts, err := store.GetServiceAccounts(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, accounts, 2)
+	assert.Equal(t, "backup", accounts[0].Name)
+	assert.Equal(t, "deploy", accounts[1].Name)
+
+	owner := "user-2"
+	account, err := store.UpdateServiceAccount(ctx, "1",
+		&model.ServiceAccountUpdate{Owner: &owner})
+	assert.NoError(t, err)
+	assert.Equal(t, owner, account.Owner)
+	assert.Equal(t, "mender.*", account.Scope)
+
+	account, err = store.GetServiceAccountById(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, owner, account.Owner)
+
+	_, err = store.UpdateServiceAccount(ctx, "3", &model.ServiceAccountUpdate{})
+	assert.EqualError(t, err, "service account not found")
+
+	assert.NoError(t, store.DeleteServiceAccount(ctx, "1"))
+	assert.EqualError(t, store.DeleteServiceAccount(ctx, "1"), "service account not found")
 }
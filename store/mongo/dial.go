@@ -0,0 +1,228 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/keys"
+)
+
+const (
+	schemeSRV = "mongodb+srv://"
+
+	authMechanismX509 = "MONGODB-X509"
+	authSourceX509    = "$external"
+)
+
+var (
+	// DNS lookups, replaced in tests
+	lookupSRV = net.LookupSRV
+	lookupTXT = net.LookupTXT
+)
+
+// dialInfoFromConfig maps the configuration to the mgo dial options
+func dialInfoFromConfig(config DataStoreMongoConfig) (*mgo.DialInfo, error) {
+	connectionString := config.ConnectionString
+	if strings.HasPrefix(connectionString, schemeSRV) {
+		var err error
+		connectionString, err = resolveSRV(connectionString)
+		if err != nil {
+			return nil, err
+		}
+		// TLS is implied by the SRV records
+		config.SSL = true
+	}
+
+	dialInfo, err := mgo.ParseURL(connectionString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set 10s timeout - same as set by Dial
+	dialInfo.Timeout = 10 * time.Second
+	if config.Timeout > 0 {
+		dialInfo.Timeout = config.Timeout
+	}
+
+	if config.PoolLimit > 0 {
+		dialInfo.PoolLimit = config.PoolLimit
+	}
+	if config.MinPoolSize > 0 {
+		dialInfo.MinPoolSize = config.MinPoolSize
+	}
+	if config.MaxIdleTime > 0 {
+		dialInfo.MaxIdleTimeMS = int(config.MaxIdleTime / time.Millisecond)
+	}
+	if config.OperationTimeout > 0 {
+		dialInfo.ReadTimeout = config.OperationTimeout
+		dialInfo.WriteTimeout = config.OperationTimeout
+	}
+
+	if config.Username != "" {
+		dialInfo.Username = config.Username
+	}
+	if config.Password != "" {
+		dialInfo.Password = config.Password
+	}
+
+	// mgo implements SCRAM with SHA-1 only, other mechanisms would
+	// need the cgo SASL library
+	if strings.HasPrefix(dialInfo.Mechanism, "SCRAM-") &&
+		dialInfo.Mechanism != "SCRAM-SHA-1" {
+		return nil, errors.Errorf("unsupported auth mechanism: %s", dialInfo.Mechanism)
+	}
+
+	// ssl=true in the connection string is configured the same way
+	if config.SSL || dialInfo.DialServer != nil {
+		tlsConfig, err := tlsConfigFromConfig(config)
+		if err != nil {
+			return nil, err
+		}
+
+		dialInfo.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return tls.Dial("tcp", addr.String(), tlsConfig)
+		}
+
+		if dialInfo.Mechanism == authMechanismX509 {
+			if dialInfo.Source == "" {
+				dialInfo.Source = authSourceX509
+			}
+			// the user is the subject of the client certificate
+			if dialInfo.Username == "" && len(tlsConfig.Certificates) > 0 {
+				cert, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+				if err != nil {
+					return nil, errors.Wrap(err, "failed to parse client certificate")
+				}
+				dialInfo.Username = cert.Subject.String()
+			}
+		}
+	}
+
+	if dialInfo.Mechanism == authMechanismX509 && dialInfo.Username == "" {
+		return nil, errors.Errorf("%s requires SSL with a client certificate",
+			authMechanismX509)
+	}
+
+	return dialInfo, nil
+}
+
+// tlsConfigFromConfig returns the TLS configuration of the connections
+func tlsConfigFromConfig(config DataStoreMongoConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.SSLSkipVerify,
+	}
+
+	if config.SSLCAPath != "" {
+		pool, err := keys.LoadCertPool(config.SSLCAPath)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.SSLCertPath != "" || config.SSLKeyPath != "" {
+		cert, err := tls.LoadX509KeyPair(config.SSLCertPath, config.SSLKeyPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// resolveSRV turns a mongodb+srv:// connection string into a mongodb://
+// one, with the hosts from the SRV records of the given host name and
+// the options from its TXT record, overridden by the ones given
+func resolveSRV(connectionString string) (string, error) {
+	s := strings.TrimPrefix(connectionString, schemeSRV)
+
+	options := ""
+	if i := strings.Index(s, "?"); i != -1 {
+		options = s[i+1:]
+		s = s[:i]
+	}
+	path := ""
+	if i := strings.Index(s, "/"); i != -1 {
+		path = s[i:]
+		s = s[:i]
+	}
+	credentials := ""
+	if i := strings.LastIndex(s, "@"); i != -1 {
+		credentials = s[:i+1]
+		s = s[i+1:]
+	}
+	host := s
+
+	if strings.Contains(host, ",") || strings.Contains(host, ":") {
+		return "", errors.Errorf("%s requires a single host name without a port",
+			schemeSRV)
+	}
+
+	_, records, err := lookupSRV("mongodb", "tcp", host)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to look up SRV records of %s", host)
+	}
+	if len(records) == 0 {
+		return "", errors.Errorf("no SRV records found for %s", host)
+	}
+
+	// the servers must be in the domain of the host name
+	domain := host[strings.Index(host, ".")+1:]
+	addrs := []string{}
+	for _, r := range records {
+		target := strings.TrimSuffix(r.Target, ".")
+		if !strings.HasSuffix(target, "."+domain) {
+			return "", errors.Errorf("SRV record %s not in the domain %s", target, domain)
+		}
+		addrs = append(addrs, net.JoinHostPort(target, strconv.Itoa(int(r.Port))))
+	}
+
+	txt, err := lookupTXT(host)
+	if dnsErr, ok := err.(*net.DNSError); err != nil && !(ok && dnsErr.Err == "no such host") {
+		return "", errors.Wrapf(err, "failed to look up TXT record of %s", host)
+	}
+	if len(txt) > 1 {
+		return "", errors.Errorf("multiple TXT records found for %s", host)
+	}
+
+	opts := []string{}
+	if len(txt) == 1 && txt[0] != "" {
+		opts = append(opts, strings.Split(txt[0], "&")...)
+	}
+	if options != "" {
+		opts = append(opts, strings.Split(options, "&")...)
+	}
+
+	url := "mongodb://" + credentials + strings.Join(addrs, ",")
+	if path != "" {
+		url += path
+	} else if len(opts) > 0 {
+		url += "/"
+	}
+	if len(opts) > 0 {
+		url += "?" + strings.Join(opts, "&")
+	}
+
+	return url, nil
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"github.com/mendersoftware/useradm/store"
+)
+
+const DriverName = "mongo"
+
+func init() {
+	if err := store.Register(DriverName, &Driver{}); err != nil {
+		panic(err)
+	}
+}
+
+// Driver opens the mongo datastore; the data source name is the
+// connection string, the other options are taken from Config
+type Driver struct {
+	Config DataStoreMongoConfig
+}
+
+func (d *Driver) Open(dsn string) (store.DataStore, store.TenantDataKeeper, error) {
+	config := d.Config
+	if dsn != "" {
+		config.ConnectionString = dsn
+	}
+
+	db, err := GetDataStoreMongo(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return db, NewTenantStoreMongo(db), nil
+}
@@ -0,0 +1,350 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"sync"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/keys"
+	"github.com/mendersoftware/useradm/model"
+)
+
+const (
+	// ID of the key the users of a database are encrypted with
+	dataKeyID = "users"
+
+	// prefix of the encrypted values, the others are in plain text
+	encryptedPrefix = "$enc1$"
+)
+
+// dataKey is the key the personal data of a tenant's users is encrypted
+// with; it's kept encrypted with a keyring key (envelope encryption), so
+// that rotating the keyring only needs the data keys to be encrypted again
+type dataKey struct {
+	ID string `bson:"_id"`
+
+	// ID of the keyring key encrypting the data key
+	KeyID string `bson:"key_id"`
+
+	Key []byte `bson:"key"`
+}
+
+// fieldCipher encrypts the personal data of users with the data keys of
+// their databases, which it caches
+type fieldCipher struct {
+	keyring *keys.Keyring
+
+	mu      sync.Mutex
+	ciphers map[string]*userCipher
+}
+
+func newFieldCipher(keyring *keys.Keyring) *fieldCipher {
+	return &fieldCipher{
+		keyring: keyring,
+		ciphers: map[string]*userCipher{},
+	}
+}
+
+// forDatabase returns the cipher of the users in the database, creating
+// its data key if there's none yet, and encrypting it with the primary
+// keyring key if it's encrypted with another one
+func (c *fieldCipher) forDatabase(database *mgo.Database) (*userCipher, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if uc, ok := c.ciphers[database.Name]; ok {
+		return uc, nil
+	}
+
+	coll := database.C(DbEncryptionKeysColl)
+
+	var dk dataKey
+	err := coll.FindId(dataKeyID).One(&dk)
+	switch err {
+	case nil:
+	case mgo.ErrNotFound:
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, errors.Wrap(err, "failed to generate data key")
+		}
+		dk = dataKey{
+			ID:    dataKeyID,
+			KeyID: c.keyring.Primary,
+			Key:   seal(c.keyring.PrimaryKey(), key, []byte(dataKeyID)),
+		}
+		if err := coll.Insert(&dk); err != nil {
+			if !mgo.IsDup(err) {
+				return nil, errors.Wrap(err, "failed to store data key")
+			}
+			// created concurrently
+			if err := coll.FindId(dataKeyID).One(&dk); err != nil {
+				return nil, errors.Wrap(err, "failed to fetch data key")
+			}
+		}
+	default:
+		return nil, errors.Wrap(err, "failed to fetch data key")
+	}
+
+	kek, ok := c.keyring.Keys[dk.KeyID]
+	if !ok {
+		return nil, errors.Errorf("data key encrypted with unknown key %s", dk.KeyID)
+	}
+	key, err := open(kek, dk.Key, []byte(dataKeyID))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decrypt data key")
+	}
+
+	if dk.KeyID != c.keyring.Primary {
+		err := coll.Update(
+			bson.M{"_id": dataKeyID, "key_id": dk.KeyID},
+			bson.M{"$set": bson.M{
+				"key_id": c.keyring.Primary,
+				"key":    seal(c.keyring.PrimaryKey(), key, []byte(dataKeyID)),
+			}})
+		if err != nil && err != mgo.ErrNotFound {
+			return nil, errors.Wrap(err, "failed to rotate data key")
+		}
+	}
+
+	uc, err := newUserCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	c.ciphers[database.Name] = uc
+
+	return uc, nil
+}
+
+// forget drops the cached data key of the database, once it's dropped
+func (c *fieldCipher) forget(database string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.ciphers, database)
+}
+
+// userCipher encrypts the email, name and phone of users; the email gets
+// a blind index, a keyed hash, so that users can still be found by email
+// and the emails kept unique. A nil userCipher leaves the users as they are.
+type userCipher struct {
+	aead     cipher.AEAD
+	indexKey []byte
+}
+
+func newUserCipher(key []byte) (*userCipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set up data key")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to set up data key")
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("email index"))
+
+	return &userCipher{
+		aead:     aead,
+		indexKey: mac.Sum(nil),
+	}, nil
+}
+
+// emailIndex returns the blind index of the email
+func (uc *userCipher) emailIndex(email string) string {
+	mac := hmac.New(sha256.New, uc.indexKey)
+	mac.Write([]byte(email))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// encrypt encrypts the value of the user's field; the ciphertext
+// can't be moved to another field or user
+func (uc *userCipher) encrypt(id, field, value string) string {
+	if value == "" {
+		return value
+	}
+	ciphertext := sealAEAD(uc.aead, []byte(value), []byte(id+"/"+field))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(ciphertext)
+}
+
+// decrypt returns the values stored in plain text as they are
+func (uc *userCipher) decrypt(id, field, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(
+		strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to decrypt %s", field)
+	}
+	plaintext, err := openAEAD(uc.aead, ciphertext, []byte(id+"/"+field))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to decrypt %s", field)
+	}
+	return string(plaintext), nil
+}
+
+func (uc *userCipher) encryptUser(u *model.User) {
+	if uc == nil {
+		return
+	}
+	if u.Email != "" {
+		u.EmailIndex = uc.emailIndex(u.Email)
+	}
+	u.Email = uc.encrypt(u.ID, DbUserEmail, u.Email)
+	u.Name = uc.encrypt(u.ID, DbUserName, u.Name)
+	u.Phone = uc.encrypt(u.ID, DbUserPhone, u.Phone)
+	if len(u.Emails) > 0 {
+		// the callers encrypt a copy of the user, the addresses
+		// are copied as well
+		emails := make([]model.UserEmail, len(u.Emails))
+		for i, e := range u.Emails {
+			e.EmailIndex = uc.emailIndex(e.Email)
+			e.Email = uc.encrypt(u.ID, DbUserEmails, e.Email)
+			emails[i] = e
+		}
+		u.Emails = emails
+	}
+}
+
+func (uc *userCipher) encryptUserUpdate(id string, u *model.UserUpdate) {
+	if uc == nil {
+		return
+	}
+	if u.Email != "" {
+		u.EmailIndex = uc.emailIndex(u.Email)
+	}
+	u.Email = uc.encrypt(id, DbUserEmail, u.Email)
+	u.Name = uc.encrypt(id, DbUserName, u.Name)
+	u.Phone = uc.encrypt(id, DbUserPhone, u.Phone)
+}
+
+func (uc *userCipher) decryptUser(u *model.User) error {
+	if uc == nil {
+		return nil
+	}
+	var err error
+	if u.Email, err = uc.decrypt(u.ID, DbUserEmail, u.Email); err != nil {
+		return err
+	}
+	if u.Name, err = uc.decrypt(u.ID, DbUserName, u.Name); err != nil {
+		return err
+	}
+	if u.Phone, err = uc.decrypt(u.ID, DbUserPhone, u.Phone); err != nil {
+		return err
+	}
+	for i := range u.Emails {
+		e := &u.Emails[i]
+		if e.Email, err = uc.decrypt(u.ID, DbUserEmails, e.Email); err != nil {
+			return err
+		}
+		e.EmailIndex = ""
+	}
+	u.EmailIndex = ""
+	return nil
+}
+
+// emailQuery matches the user with the email, primary or additional,
+// whether it's encrypted or stored in plain text
+func (uc *userCipher) emailQuery(email string) bson.M {
+	if uc == nil {
+		return bson.M{"$or": []bson.M{
+			{DbUserEmail: email},
+			{DbUserEmailsEmail: email},
+		}}
+	}
+	index := uc.emailIndex(email)
+	return bson.M{"$or": []bson.M{
+		{DbUserEmailIndex: index},
+		{DbUserEmail: email},
+		{DbUserEmailsEmailIndex: index},
+		{DbUserEmailsEmail: email},
+	}}
+}
+
+// emailKeys returns the keys of the user's email addresses, primary and
+// additional, which uniqueEmailKeysIndex keeps unique among the users;
+// the blind indexes of the addresses if they're encrypted
+func (uc *userCipher) emailKeys(email string, emails []model.UserEmail) []string {
+	key := func(email string) string {
+		email = model.NormalizeEmail(email)
+		if uc == nil {
+			return email
+		}
+		return uc.emailIndex(email)
+	}
+
+	keys := []string{}
+	if email != "" {
+		keys = append(keys, key(email))
+	}
+	for _, e := range emails {
+		keys = append(keys, key(e.Email))
+	}
+	return keys
+}
+
+// seal encrypts the plaintext with AES-256-GCM, the nonce is prepended
+// to the ciphertext
+func seal(key, plaintext, additionalData []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		// the keyring keys have the right size
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return sealAEAD(aead, plaintext, additionalData)
+}
+
+func open(key, ciphertext, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return openAEAD(aead, ciphertext, additionalData)
+}
+
+func sealAEAD(aead cipher.AEAD, plaintext, additionalData []byte) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData)
+}
+
+func openAEAD(aead cipher.AEAD, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(nil, nonce, ciphertext[aead.NonceSize():], additionalData)
+}
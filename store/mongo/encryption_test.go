@@ -0,0 +1,188 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	mstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/keys"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+)
+
+func testKeyring(ids ...string) *keys.Keyring {
+	keyring := &keys.Keyring{
+		Primary: ids[0],
+		Keys:    map[string][]byte{},
+	}
+	for _, id := range ids {
+		keyring.Keys[id] = bytes.Repeat([]byte(id[:1]), keys.KeyringKeySize)
+	}
+	return keyring
+}
+
+func TestUserCipher(t *testing.T) {
+	uc, err := newUserCipher(bytes.Repeat([]byte{1}, 32))
+	assert.NoError(t, err)
+
+	user := model.User{
+		ID:    "1",
+		Email: "foo@bar.com",
+		Name:  "Foo Bar",
+		Phone: "+4712345678",
+		Emails: []model.UserEmail{
+			{Email: "foo@baz.com", Verified: true},
+		},
+	}
+
+	encrypted := user
+	uc.encryptUser(&encrypted)
+	for _, v := range []string{encrypted.Email, encrypted.Name, encrypted.Phone,
+		encrypted.Emails[0].Email} {
+		assert.True(t, strings.HasPrefix(v, encryptedPrefix))
+	}
+	assert.Equal(t, uc.emailIndex("foo@bar.com"), encrypted.EmailIndex)
+	assert.Equal(t, uc.emailIndex("foo@baz.com"), encrypted.Emails[0].EmailIndex)
+	// the user itself is left as it is
+	assert.Equal(t, "foo@baz.com", user.Emails[0].Email)
+	assert.NotEqual(t, uc.emailIndex("bar@bar.com"), encrypted.EmailIndex)
+
+	// randomized, but the index is not
+	again := user
+	uc.encryptUser(&again)
+	assert.NotEqual(t, encrypted.Email, again.Email)
+	assert.Equal(t, encrypted.EmailIndex, again.EmailIndex)
+
+	decrypted := encrypted
+	assert.NoError(t, uc.decryptUser(&decrypted))
+	assert.Equal(t, user, decrypted)
+
+	// plain text is read as it is
+	plain := user
+	assert.NoError(t, uc.decryptUser(&plain))
+	assert.Equal(t, user, plain)
+
+	// ciphertexts can't be moved to another user or field
+	moved := encrypted
+	moved.ID = "2"
+	assert.EqualError(t, uc.decryptUser(&moved),
+		"failed to decrypt email: cipher: message authentication failed")
+	moved = encrypted
+	moved.Name = encrypted.Phone
+	assert.EqualError(t, uc.decryptUser(&moved),
+		"failed to decrypt name: cipher: message authentication failed")
+
+	// a nil cipher leaves users in plain text
+	var none *userCipher
+	plain = user
+	none.encryptUser(&plain)
+	assert.Equal(t, user, plain)
+	assert.Equal(t,
+		bson.M{"$or": []bson.M{
+			{DbUserEmail: "foo@bar.com"},
+			{DbUserEmailsEmail: "foo@bar.com"},
+		}},
+		none.emailQuery("foo@bar.com"))
+}
+
+func TestMongoEncryption(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	plain, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+	ds := plain.WithEncryption(testKeyring("a"))
+
+	ctx := identity.WithContext(context.Background(), &identity.Identity{
+		Tenant: "foo",
+	})
+	database := session.DB(mstore.DbFromContext(ctx, DbName))
+
+	err = ds.CreateUser(ctx, &model.User{
+		ID:       "1",
+		Email:    "foo@bar.com",
+		Password: "passwordhash",
+		Name:     "Foo Bar",
+	})
+	assert.NoError(t, err)
+
+	// stored encrypted
+	var raw model.User
+	assert.NoError(t, database.C(DbUsersColl).FindId("1").One(&raw))
+	assert.True(t, strings.HasPrefix(raw.Email, encryptedPrefix))
+	assert.True(t, strings.HasPrefix(raw.Name, encryptedPrefix))
+	assert.NotEmpty(t, raw.EmailIndex)
+
+	user, err := ds.GetUserByEmail(ctx, "foo@bar.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "foo@bar.com", user.Email)
+	assert.Equal(t, "Foo Bar", user.Name)
+
+	err = ds.CreateUser(ctx, &model.User{
+		ID:       "2",
+		Email:    "foo@bar.com",
+		Password: "passwordhash",
+	})
+	assert.Equal(t, store.ErrDuplicateEmail, err)
+
+	// users stored in plain text are found, and encrypted by the migration
+	assert.NoError(t, plain.CreateUser(ctx, &model.User{
+		ID:       "3",
+		Email:    "baz@bar.com",
+		Password: "passwordhash",
+		Phone:    "+4712345678",
+	}))
+	user, err = ds.GetUserByEmail(ctx, "baz@bar.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "3", user.ID)
+
+	assert.NoError(t, ds.WithAutomigrate().MigrateTenant(context.Background(), DbVersion, "foo"))
+	assert.NoError(t, database.C(DbUsersColl).FindId("3").One(&raw))
+	assert.True(t, strings.HasPrefix(raw.Phone, encryptedPrefix))
+
+	err = ds.UpdateUser(ctx, "3", &model.UserUpdate{Email: "qux@bar.com"})
+	assert.NoError(t, err)
+	user, err = ds.GetUserById(ctx, "3")
+	assert.NoError(t, err)
+	assert.Equal(t, "qux@bar.com", user.Email)
+	assert.Equal(t, "+4712345678", user.Phone)
+
+	// rotating the keyring encrypts the data key with the new key
+	rotated := plain.WithEncryption(testKeyring("b", "a"))
+	users, err := rotated.GetUsers(ctx, model.UserFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+
+	var dk dataKey
+	assert.NoError(t, database.C(DbEncryptionKeysColl).FindId(dataKeyID).One(&dk))
+	assert.Equal(t, "b", dk.KeyID)
+
+	user, err = plain.WithEncryption(testKeyring("b")).GetUserByEmail(ctx, "foo@bar.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", user.ID)
+}
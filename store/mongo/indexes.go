@@ -0,0 +1,343 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	mstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
+)
+
+// How the indexes are managed at startup, see SyncIndexes
+const (
+	// create the missing indexes, blocking the collections meanwhile
+	IndexModeCreate = "create"
+	// create the missing indexes without blocking the collections
+	IndexModeBackground = "background"
+	// only report the missing and extra indexes, e.g. on read-only
+	// replicas
+	IndexModeCheck = "check"
+	// leave the indexes alone
+	IndexModeSkip = "skip"
+)
+
+// emailCollation compares emails regardless of case; queries by email
+// need it to use the email index
+var emailCollation = &mgo.Collation{Locale: "en", Strength: 2}
+
+var (
+	uniqueEmailIndex = mgo.Index{
+		Key:        []string{DbUserEmail},
+		Unique:     true,
+		Name:       "uniqueEmailCI",
+		Collation:  emailCollation,
+		Background: false,
+	}
+
+	// encrypted emails are unique by their blind index
+	uniqueEmailBlindIndex = mgo.Index{
+		Key:        []string{DbUserEmailIndex},
+		Unique:     true,
+		Sparse:     true,
+		Name:       "uniqueEmailIndex",
+		Background: false,
+	}
+
+	// additional emails are unique among themselves by the index,
+	// and against the primary ones by uniqueEmailKeysIndex
+	uniqueUserEmailsIndex = mgo.Index{
+		Key:        []string{DbUserEmailsEmail},
+		Unique:     true,
+		Sparse:     true,
+		Name:       "uniqueEmailsCI",
+		Collation:  emailCollation,
+		Background: false,
+	}
+
+	uniqueUserEmailsBlindIndex = mgo.Index{
+		Key:        []string{DbUserEmailsEmailIndex},
+		Unique:     true,
+		Sparse:     true,
+		Name:       "uniqueEmailsIndex",
+		Background: false,
+	}
+
+	// all the email addresses of the users, primary and additional,
+	// are unique by their keys, see userDoc
+	uniqueEmailKeysIndex = mgo.Index{
+		Key:        []string{DbUserEmailKeys},
+		Unique:     true,
+		Sparse:     true,
+		Name:       "uniqueEmailKeys",
+		Background: false,
+	}
+
+	uniqueUsernameIndex = mgo.Index{
+		Key:        []string{DbUserUsername},
+		Unique:     true,
+		Sparse:     true,
+		Name:       "uniqueUsername",
+		Background: false,
+	}
+
+	uniqueGroupNameIndex = mgo.Index{
+		Key:        []string{DbGroupName},
+		Unique:     true,
+		Name:       "uniqueGroupName",
+		Background: false,
+	}
+
+	uniqueServiceAccountNameIndex = mgo.Index{
+		Key:        []string{DbServiceAccountName},
+		Unique:     true,
+		Name:       "uniqueServiceAccountName",
+		Background: false,
+	}
+
+	// tokens are removed by mongo once expired
+	tokensTTLIndex = mgo.Index{
+		Key:         []string{DbTokenExpiresTs},
+		Name:        "tokensTTL",
+		ExpireAfter: time.Second,
+		Background:  true,
+	}
+
+	tokensByUserIndex = mgo.Index{
+		Key:  []string{DbTokenSub},
+		Name: "tokensByUser",
+	}
+
+	// authorization codes are removed by mongo once expired
+	oauthCodesTTLIndex = mgo.Index{
+		Key:         []string{DbOAuthCodeExpiresTs},
+		Name:        "oauthCodesTTL",
+		ExpireAfter: time.Second,
+		Background:  true,
+	}
+
+	// login links are removed by mongo once expired
+	loginLinksTTLIndex = mgo.Index{
+		Key:         []string{DbLoginLinkExpiresTs},
+		Name:        "loginLinksTTL",
+		ExpireAfter: time.Second,
+		Background:  true,
+	}
+
+	// the latest login link of a user, see GetLatestLoginLink
+	loginLinksUserIndex = mgo.Index{
+		Key: []string{DbLoginLinkTenantID, DbLoginLinkUserID,
+			"-" + DbLoginLinkCreatedTs},
+		Name:       "loginLinksUser",
+		Background: true,
+	}
+
+	// device logins are removed by mongo once expired
+	deviceAuthorizationsTTLIndex = mgo.Index{
+		Key:         []string{DbDeviceAuthorizationExpiresTs},
+		Name:        "deviceAuthorizationsTTL",
+		ExpireAfter: time.Second,
+		Background:  true,
+	}
+
+	// sessions are removed by mongo once their tokens expired
+	sessionsTTLIndex = mgo.Index{
+		Key:         []string{DbSessionExpiresTs},
+		Name:        "sessionsTTL",
+		ExpireAfter: time.Second,
+		Background:  true,
+	}
+
+	uniqueUserCodeIndex = mgo.Index{
+		Key:        []string{DbDeviceAuthorizationUserCode},
+		Unique:     true,
+		Name:       "uniqueUserCode",
+		Background: false,
+	}
+
+	loginEventsTTLIndex = mgo.Index{
+		Key:         []string{DbLoginEventTs},
+		Name:        "loginEventsTTL",
+		ExpireAfter: DbLoginEventsTTL,
+		Background:  true,
+	}
+
+	loginEventsByUserIndex = mgo.Index{
+		Key:  []string{DbLoginEventUserID, "-" + DbLoginEventTs},
+		Name: "loginEventsByUser",
+	}
+
+	idempotencyKeysTTLIndex = mgo.Index{
+		Key:         []string{DbIdempotencyCreatedTs},
+		Name:        "idempotencyKeysTTL",
+		ExpireAfter: DbIdempotencyTTL,
+		Background:  true,
+	}
+
+	// login codes are removed by mongo once expired
+	loginOTPsTTLIndex = mgo.Index{
+		Key:         []string{DbLoginOTPExpiresTs},
+		Name:        "loginOTPsTTL",
+		ExpireAfter: time.Second,
+		Background:  true,
+	}
+)
+
+// mongo error code of a missing collection
+const errCodeNamespaceNotFound = 26
+
+// listIndexes returns the indexes of the collection,
+// none if it doesn't exist
+func listIndexes(c *mgo.Collection) ([]mgo.Index, error) {
+	indexes, err := c.Indexes()
+	if qerr, ok := err.(*mgo.QueryError); ok && qerr.Code == errCodeNamespaceNotFound {
+		return nil, nil
+	}
+	return indexes, err
+}
+
+// collectionIndex is an index of a collection
+type collectionIndex struct {
+	coll  string
+	index mgo.Index
+}
+
+// indexes returns the indexes a tenant's database should have
+func (db *DataStoreMongo) indexes() []collectionIndex {
+	indexes := []collectionIndex{
+		{DbUsersColl, uniqueEmailIndex},
+		{DbUsersColl, uniqueUserEmailsIndex},
+		{DbUsersColl, uniqueEmailKeysIndex},
+		{DbUsersColl, uniqueUsernameIndex},
+		{DbGroupsColl, uniqueGroupNameIndex},
+		{DbServiceAccountsColl, uniqueServiceAccountNameIndex},
+		{DbTokensColl, tokensTTLIndex},
+		{DbTokensColl, tokensByUserIndex},
+		{DbLoginEventsColl, loginEventsTTLIndex},
+		{DbLoginEventsColl, loginEventsByUserIndex},
+		{DbIdempotencyColl, idempotencyKeysTTLIndex},
+		{DbLoginOTPsColl, loginOTPsTTLIndex},
+	}
+	if db.cipher != nil {
+		indexes = append(indexes,
+			collectionIndex{DbUsersColl, uniqueEmailBlindIndex},
+			collectionIndex{DbUsersColl, uniqueUserEmailsBlindIndex})
+	}
+	return indexes
+}
+
+// checkIndexes returns the indexes missing from the database, and the
+// names of the ones it has besides, by collection
+func (db *DataStoreMongo) checkIndexes(database *mgo.Database) ([]collectionIndex, map[string][]string, error) {
+	missing := []collectionIndex{}
+	extra := map[string][]string{}
+
+	expected := map[string]map[string]bool{}
+	for _, ci := range db.indexes() {
+		if expected[ci.coll] == nil {
+			expected[ci.coll] = map[string]bool{}
+		}
+		expected[ci.coll][ci.index.Name] = true
+	}
+
+	existing := map[string]map[string]bool{}
+	for coll, names := range expected {
+		indexes, err := listIndexes(database.C(coll))
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to list indexes of %s", coll)
+		}
+
+		existing[coll] = map[string]bool{}
+		for _, idx := range indexes {
+			existing[coll][idx.Name] = true
+			if idx.Name != "_id_" && !names[idx.Name] {
+				extra[coll] = append(extra[coll], idx.Name)
+			}
+		}
+	}
+
+	for _, ci := range db.indexes() {
+		if !existing[ci.coll][ci.index.Name] {
+			missing = append(missing, ci)
+		}
+	}
+
+	return missing, extra, nil
+}
+
+// SyncIndexes checks the indexes of all the tenants' databases, logging
+// the missing and extra ones, and creates the missing ones unless the mode
+// is IndexModeCheck. Extra indexes are left in place.
+func (db *DataStoreMongo) SyncIndexes(ctx context.Context, mode string) error {
+	l := log.FromContext(ctx)
+
+	switch mode {
+	case IndexModeSkip:
+		l.Infof("index management is off")
+		return nil
+	case IndexModeCreate, IndexModeBackground, IndexModeCheck:
+	default:
+		return errors.Errorf("unknown index mode: %s", mode)
+	}
+
+	tenants, err := db.allTenants(ctx)
+	if err != nil {
+		return err
+	}
+
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	for _, tenant := range tenants {
+		tenantCtx := identity.WithContext(ctx, &identity.Identity{
+			Tenant: tenant,
+		})
+		dbName := mstore.DbFromContext(tenantCtx, DbName)
+		database := s.DB(dbName)
+
+		missing, extra, err := db.checkIndexes(database)
+		if err != nil {
+			return errors.Wrapf(err, "failed to check indexes of %s", dbName)
+		}
+
+		for coll, names := range extra {
+			for _, name := range names {
+				l.Warnf("unexpected index %s on %s.%s", name, dbName, coll)
+			}
+		}
+
+		for _, ci := range missing {
+			if mode == IndexModeCheck {
+				l.Warnf("missing index %s on %s.%s", ci.index.Name, dbName, ci.coll)
+				continue
+			}
+
+			l.Infof("creating index %s on %s.%s", ci.index.Name, dbName, ci.coll)
+			index := ci.index
+			if mode == IndexModeBackground {
+				index.Background = true
+			}
+			if err := database.C(ci.coll).EnsureIndex(index); err != nil {
+				return errors.Wrapf(err, "failed to create index %s on %s.%s",
+					index.Name, dbName, ci.coll)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/globalsign/mgo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncIndexesUnknownMode(t *testing.T) {
+	store, err := NewDataStoreMongoWithSession(nil)
+	assert.NoError(t, err)
+
+	err = store.SyncIndexes(context.Background(), "foo")
+	assert.EqualError(t, err, "unknown index mode: foo")
+
+	assert.NoError(t, store.SyncIndexes(context.Background(), IndexModeSkip))
+}
+
+func TestSyncIndexes(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestSyncIndexes in short mode.")
+	}
+
+	testCases := map[string]struct {
+		mode string
+
+		missing int
+	}{
+		"create": {
+			mode: IndexModeCreate,
+		},
+		"background": {
+			mode: IndexModeBackground,
+		},
+		"check": {
+			mode:    IndexModeCheck,
+			missing: 10,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db.Wipe()
+
+			session := db.Session()
+			defer session.Close()
+
+			store, err := NewDataStoreMongoWithSession(session)
+			assert.NoError(t, err)
+
+			database := session.DB(DbName)
+
+			// left by an older version, or created by hand
+			err = database.C(DbUsersColl).EnsureIndex(mgo.Index{
+				Key:  []string{"foo"},
+				Name: "foo",
+			})
+			assert.NoError(t, err)
+
+			err = store.SyncIndexes(context.Background(), tc.mode)
+			assert.NoError(t, err)
+
+			missing, extra, err := store.checkIndexes(database)
+			assert.NoError(t, err)
+			assert.Len(t, missing, tc.missing)
+			assert.Equal(t, map[string][]string{DbUsersColl: {"foo"}}, extra)
+		})
+	}
+}
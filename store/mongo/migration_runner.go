@@ -0,0 +1,222 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+const (
+	DbMigrationProgressColl = "migration_progress"
+
+	DbMigrationProgressStartedTs  = "started_ts"
+	DbMigrationProgressUpdatedTs  = "updated_ts"
+	DbMigrationProgressFinishedTs = "finished_ts"
+	DbMigrationProgressFailed     = "failed_tenants"
+)
+
+// migrationProgressLogs is the number of times the progress is logged
+// during a run, besides the start and the end
+const migrationProgressLogs = 20
+
+// MigrateTenants migrates the databases of the tenants to the given
+// version, down too if asked, MigrationConcurrency of them at a time.
+// It stops at the first failure; the tenants done are skipped when it's
+// run again. The progress is recorded in the default database, see
+// GetMigrationProgress.
+func (db *DataStoreMongo) MigrateTenants(ctx context.Context, version string, tenants []string, down bool) error {
+	l := log.FromContext(ctx)
+
+	if _, err := migrate.NewVersion(version); err != nil {
+		return errors.Wrap(err, "failed to parse service version")
+	}
+
+	concurrency := db.migrationConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	now := time.Now().UTC()
+	progress := model.MigrationProgress{
+		Version:   version,
+		Total:     len(tenants),
+		StartedTs: now,
+		UpdatedTs: now,
+	}
+	if err := db.startMigrationProgress(ctx, &progress); err != nil {
+		return err
+	}
+
+	l.Infof("migrating %d tenant databases to version %s, %d at a time",
+		len(tenants), version, concurrency)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	logEvery := len(tenants) / migrationProgressLogs
+	if logEvery < 1 {
+		logEvery = 1
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+
+	work := make(chan string)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for tenant := range work {
+				steps, err := db.migrateTenant(ctx, version, tenant, down)
+				if err != nil && tenant != "" {
+					err = errors.Wrapf(err, "failed to migrate tenant %s", tenant)
+				}
+
+				mu.Lock()
+				switch {
+				case err != nil:
+					progress.Failed++
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				case steps > 0:
+					progress.Migrated++
+				default:
+					progress.Skipped++
+				}
+				done := progress.Done()
+				mu.Unlock()
+
+				if err != nil {
+					l.Errorf("%s", err.Error())
+				}
+				if uerr := db.updateMigrationProgress(version, tenant, steps, err); uerr != nil {
+					l.Warnf("failed to record migration progress: %s", uerr.Error())
+				}
+				if done%logEvery == 0 && done < len(tenants) {
+					l.Infof("migrated %d/%d tenant databases to version %s",
+						done, len(tenants), version)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, tenant := range tenants {
+		select {
+		case work <- tenant:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	if firstErr != nil {
+		l.Errorf("migration to version %s stopped after %d/%d tenant databases",
+			version, progress.Done(), len(tenants))
+		return firstErr
+	}
+
+	if err := db.finishMigrationProgress(version); err != nil {
+		return err
+	}
+
+	l.Infof("migrated %d tenant databases to version %s: %d migrated, %d up to date",
+		len(tenants), version, progress.Migrated, progress.Skipped)
+
+	return nil
+}
+
+func (db *DataStoreMongo) startMigrationProgress(ctx context.Context, p *model.MigrationProgress) error {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	_, err := s.DB(DbName).C(DbMigrationProgressColl).UpsertId(p.Version, p)
+	if err != nil {
+		return errors.Wrap(err, "failed to record migration progress")
+	}
+	return nil
+}
+
+// updateMigrationProgress records a tenant done; it doesn't take the
+// context of the run, to record the tenants done once it's canceled
+func (db *DataStoreMongo) updateMigrationProgress(version, tenant string, steps int, err error) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	update := bson.M{
+		"$set": bson.M{DbMigrationProgressUpdatedTs: time.Now().UTC()},
+	}
+	switch {
+	case err != nil:
+		update["$inc"] = bson.M{"failed": 1}
+		update["$push"] = bson.M{DbMigrationProgressFailed: tenant}
+	case steps > 0:
+		update["$inc"] = bson.M{"migrated": 1}
+	default:
+		update["$inc"] = bson.M{"skipped": 1}
+	}
+
+	return s.DB(DbName).C(DbMigrationProgressColl).UpdateId(version, update)
+}
+
+func (db *DataStoreMongo) finishMigrationProgress(version string) error {
+	s := db.session.Copy()
+	defer s.Close()
+
+	now := time.Now().UTC()
+	err := s.DB(DbName).C(DbMigrationProgressColl).UpdateId(version,
+		bson.M{"$set": bson.M{
+			DbMigrationProgressUpdatedTs:  now,
+			DbMigrationProgressFinishedTs: now,
+		}})
+	if err != nil {
+		return errors.Wrap(err, "failed to record migration progress")
+	}
+	return nil
+}
+
+// GetMigrationProgress returns the progress of the latest migration of
+// the tenants' databases, nil if there was none
+func (db *DataStoreMongo) GetMigrationProgress(ctx context.Context) (*model.MigrationProgress, error) {
+	s := db.copySession(ctx)
+	defer s.Close()
+
+	var p model.MigrationProgress
+	err := s.DB(DbName).C(DbMigrationProgressColl).Find(nil).
+		Sort("-" + DbMigrationProgressStartedTs).
+		One(&p)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch migration progress")
+	}
+
+	return &p, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateTenants(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigrateTenants in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+	store = store.WithMultitenant().WithAutomigrate().WithMigrationConcurrency(3)
+
+	tenants := []string{}
+	for i := 0; i < 10; i++ {
+		tenant := fmt.Sprintf("tenant%d", i)
+		err := session.DB(DbName + "-" + tenant).C("foo").Insert(bson.M{"foo": "bar"})
+		assert.NoError(t, err)
+		tenants = append(tenants, tenant)
+	}
+
+	ctx := context.Background()
+
+	progress, err := store.GetMigrationProgress(ctx)
+	assert.NoError(t, err)
+	assert.Nil(t, progress)
+
+	// a run interrupted after the first tenants
+	err = store.MigrateTenants(ctx, DbVersion, tenants[:4], false)
+	assert.NoError(t, err)
+
+	err = store.Migrate(ctx, DbVersion, nil)
+	assert.NoError(t, err)
+
+	progress, err = store.GetMigrationProgress(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, DbVersion, progress.Version)
+	assert.Equal(t, 10, progress.Total)
+	assert.Equal(t, 6, progress.Migrated)
+	assert.Equal(t, 4, progress.Skipped)
+	assert.Equal(t, 0, progress.Failed)
+	assert.NotNil(t, progress.FinishedTs)
+
+	for _, tenant := range tenants {
+		status, err := store.GetMigrationStatus(ctx, tenant)
+		assert.NoError(t, err)
+		assert.Equal(t, DbVersion, status.Version)
+	}
+
+	err = store.MigrateTenants(ctx, "1.0", tenants, false)
+	assert.EqualError(t, err, "failed to parse service version: failed to parse Version: unexpected EOF")
+}
+
+func TestMigrateTenantsFailure(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigrateTenantsFailure in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+	store = store.WithMigrationConcurrency(2)
+
+	ctx := context.Background()
+
+	// without automigrate the databases must be up to date
+	err = store.MigrateTenants(ctx, DbVersion, []string{"tenant1"}, false)
+	assert.EqualError(t, err, "failed to migrate tenant tenant1: failed to apply migrations: "+
+		"db needs migration: useradm-tenant1 has version 0.0.0, needs version "+DbVersion)
+
+	progress, err := store.GetMigrationProgress(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, progress.Failed)
+	assert.Equal(t, []string{"tenant1"}, progress.FailedTenants)
+	assert.Nil(t, progress.FinishedTs)
+}
@@ -0,0 +1,479 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+	mstore "github.com/mendersoftware/go-lib-micro/store"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+// migration is a versioned change of the schema; Down reverts Up
+type migration struct {
+	version     migrate.Version
+	description string
+	up          func(db *DataStoreMongo, database *mgo.Database) error
+	down        func(db *DataStoreMongo, database *mgo.Database) error
+}
+
+// migrations lists the schema changes in version order,
+// DbVersion is the version of the last one
+var migrations = []migration{
+	{
+		version:     migrate.MakeVersion(0, 1, 0),
+		description: "initial schema",
+		up:          func(*DataStoreMongo, *mgo.Database) error { return nil },
+		down:        func(*DataStoreMongo, *mgo.Database) error { return nil },
+	},
+	{
+		version:     migrate.MakeVersion(1, 0, 0),
+		description: "index tokens and login history by user",
+		up: func(db *DataStoreMongo, database *mgo.Database) error {
+			err := database.C(DbTokensColl).EnsureIndex(mgo.Index{
+				Key:  []string{DbTokenSub},
+				Name: "tokensByUser",
+			})
+			if err != nil {
+				return err
+			}
+			return database.C(DbLoginEventsColl).EnsureIndex(mgo.Index{
+				Key:  []string{DbLoginEventUserID, "-" + DbLoginEventTs},
+				Name: "loginEventsByUser",
+			})
+		},
+		down: func(db *DataStoreMongo, database *mgo.Database) error {
+			if err := dropIndex(database.C(DbTokensColl), "tokensByUser"); err != nil {
+				return err
+			}
+			return dropIndex(database.C(DbLoginEventsColl), "loginEventsByUser")
+		},
+	},
+	{
+		version:     migrate.MakeVersion(1, 1, 0),
+		description: "normalize emails, unique regardless of case",
+		up: func(db *DataStoreMongo, database *mgo.Database) error {
+			if err := normalizeEmails(db, database.C(DbUsersColl), true); err != nil {
+				return err
+			}
+			if err := normalizeEmails(db, database.C(DbDeletedUsersColl), false); err != nil {
+				return err
+			}
+			err := database.C(DbUsersColl).EnsureIndex(mgo.Index{
+				Key:       []string{DbUserEmail},
+				Unique:    true,
+				Name:      "uniqueEmailCI",
+				Collation: emailCollation,
+			})
+			if err != nil {
+				return err
+			}
+			return dropIndex(database.C(DbUsersColl), "uniqueEmail")
+		},
+		// the emails stay normalized
+		down: func(db *DataStoreMongo, database *mgo.Database) error {
+			err := database.C(DbUsersColl).EnsureIndex(mgo.Index{
+				Key:    []string{DbUserEmail},
+				Unique: true,
+				Name:   "uniqueEmail",
+			})
+			if err != nil {
+				return err
+			}
+			return dropIndex(database.C(DbUsersColl), "uniqueEmailCI")
+		},
+	},
+	{
+		version:     migrate.MakeVersion(1, 2, 0),
+		description: "index the primary and additional emails together",
+		up: func(db *DataStoreMongo, database *mgo.Database) error {
+			if err := database.C(DbUsersColl).EnsureIndex(uniqueEmailKeysIndex); err != nil {
+				return err
+			}
+			return keyEmails(db, database.C(DbUsersColl))
+		},
+		down: func(db *DataStoreMongo, database *mgo.Database) error {
+			if err := dropIndex(database.C(DbUsersColl), uniqueEmailKeysIndex.Name); err != nil {
+				return err
+			}
+			_, err := database.C(DbUsersColl).UpdateAll(nil,
+				bson.M{"$unset": bson.M{DbUserEmailKeys: ""}})
+			return err
+		},
+	},
+}
+
+// keyEmails sets the keys of the email addresses of the users in the
+// collection, see userDoc; it fails on the first user whose addresses
+// are taken by another one, to be resolved by hand
+func keyEmails(db *DataStoreMongo, c *mgo.Collection) error {
+	uc, err := db.userCipher(c.Database)
+	if err != nil {
+		return err
+	}
+
+	var user model.User
+	iter := c.Find(nil).Select(bson.M{DbUserEmail: 1, DbUserEmails: 1}).Iter()
+	for iter.Next(&user) {
+		if err := uc.decryptUser(&user); err != nil {
+			iter.Close()
+			return err
+		}
+
+		keys := uc.emailKeys(user.Email, user.Emails)
+		if len(keys) > 0 {
+			err := c.UpdateId(user.ID, bson.M{"$set": bson.M{DbUserEmailKeys: keys}})
+			if err != nil && err != mgo.ErrNotFound {
+				iter.Close()
+				if mgo.IsDup(err) {
+					return errors.Errorf("user %s has an email of another user", user.ID)
+				}
+				return errors.Wrapf(err, "failed to index emails of user %s", user.ID)
+			}
+		}
+		user = model.User{}
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Wrapf(err, "failed to fetch users from %s", c.Name)
+	}
+
+	return nil
+}
+
+// normalizeEmails normalizes the emails of the users in the collection,
+// see model.NormalizeEmail; if they must be unique, it fails without
+// changes when two users' emails differ only by case, to be resolved by
+// hand
+func normalizeEmails(db *DataStoreMongo, c *mgo.Collection, unique bool) error {
+	uc, err := db.userCipher(c.Database)
+	if err != nil {
+		return err
+	}
+
+	normalized := map[string]string{}
+	byEmail := map[string]string{}
+	clashes := []string{}
+
+	var user model.User
+	iter := c.Find(nil).Select(bson.M{DbUserEmail: 1}).Iter()
+	for iter.Next(&user) {
+		email := user.Email
+		if uc != nil {
+			if email, err = uc.decrypt(user.ID, DbUserEmail, email); err != nil {
+				iter.Close()
+				return err
+			}
+		}
+
+		norm := model.NormalizeEmail(email)
+		if other, ok := byEmail[norm]; ok && unique {
+			clashes = append(clashes, other+" and "+user.ID)
+		}
+		byEmail[norm] = user.ID
+		if norm != email {
+			normalized[user.ID] = norm
+		}
+		user = model.User{}
+	}
+	if err := iter.Close(); err != nil {
+		return errors.Wrapf(err, "failed to fetch users from %s", c.Name)
+	}
+
+	if len(clashes) > 0 {
+		sort.Strings(clashes)
+		return errors.Errorf("users with the same email regardless of case: %s",
+			strings.Join(clashes, ", "))
+	}
+
+	for id, email := range normalized {
+		update := model.UserUpdate{Email: email}
+		uc.encryptUserUpdate(id, &update)
+
+		set := bson.M{DbUserEmail: update.Email}
+		if update.EmailIndex != "" {
+			set[DbUserEmailIndex] = update.EmailIndex
+		}
+		if err := c.UpdateId(id, bson.M{"$set": set}); err != nil && err != mgo.ErrNotFound {
+			return errors.Wrapf(err, "failed to normalize email of user %s", id)
+		}
+	}
+
+	return nil
+}
+
+// dropIndex drops the index if it exists
+func dropIndex(c *mgo.Collection, name string) error {
+	indexes, err := listIndexes(c)
+	if err != nil {
+		return err
+	}
+	for _, idx := range indexes {
+		if idx.Name == name {
+			return c.DropIndexName(name)
+		}
+	}
+	return nil
+}
+
+// appliedMigrations returns the versions recorded in the database,
+// with the time they were applied, and the latest one
+func (db *DataStoreMongo) appliedMigrations(database string) (map[migrate.Version]migrate.MigrationEntry, migrate.Version, error) {
+	entries, err := migrate.GetMigrationInfo(db.session, database)
+	if err != nil {
+		return nil, migrate.Version{}, errors.Wrap(err, "failed to list applied migrations")
+	}
+
+	applied := map[migrate.Version]migrate.MigrationEntry{}
+	last := migrate.Version{}
+	for _, e := range entries {
+		applied[e.Version] = e
+		if migrate.VersionIsLess(last, e.Version) {
+			last = e.Version
+		}
+	}
+
+	return applied, last, nil
+}
+
+// MigrateOptions tune MigrateTenantTo
+type MigrateOptions struct {
+	// list the steps without taking them
+	DryRun bool
+
+	// revert the migrations after the version, when the database is
+	// newer; otherwise it's left as is
+	Down bool
+}
+
+// MigrateTenantTo migrates the database of the tenant to the given
+// version and returns the steps taken; the users stored in plain text are
+// encrypted too if encryption is enabled. Without automigrate it only
+// checks the database isn't older, unless it's a dry run.
+func (db *DataStoreMongo) MigrateTenantTo(ctx context.Context, version string,
+	tenant string, opts MigrateOptions) ([]model.MigrationStep, error) {
+	target, err := migrate.NewVersion(version)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse service version")
+	}
+
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{
+		Tenant: tenant,
+	})
+	dbName := mstore.DbFromContext(tenantCtx, DbName)
+	l := log.FromContext(ctx).F(log.Ctx{"db": dbName})
+
+	applied, last, err := db.appliedMigrations(dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !db.automigrate && !opts.DryRun {
+		if migrate.VersionIsLess(last, *target) {
+			return nil, fmt.Errorf(migrate.ErrNeedsMigration+": %s has version %s, needs version %s",
+				dbName, last, target)
+		}
+		return nil, nil
+	}
+
+	if migrate.VersionIsLess(*target, last) && !opts.Down {
+		l.Infof("migration to version %s skipped", target)
+		if opts.DryRun {
+			return nil, nil
+		}
+		return nil, db.encryptPlainUsers(tenantCtx)
+	}
+
+	s := db.copySession(ctx)
+	defer s.Close()
+	database := s.DB(dbName)
+
+	steps := []model.MigrationStep{}
+
+	// up, in version order
+	for _, m := range migrations {
+		if !migrate.VersionIsLess(last, m.version) || migrate.VersionIsLess(*target, m.version) {
+			continue
+		}
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+
+		steps = append(steps, model.MigrationStep{
+			Version:     m.version.String(),
+			Description: m.description,
+		})
+		if opts.DryRun {
+			continue
+		}
+
+		l.Infof("applying migration to version %s: %s", m.version, m.description)
+		if err := m.up(db, database); err != nil {
+			return steps, errors.Wrapf(err, "failed to apply migration to version %s", m.version)
+		}
+		if err := migrate.UpdateMigrationInfo(m.version, db.session, dbName); err != nil {
+			return steps, errors.Wrapf(err, "failed to record migration to version %s", m.version)
+		}
+	}
+
+	// down, in reverse version order; versions recorded without
+	// a migration have nothing to revert
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if !migrate.VersionIsLess(*target, m.version) {
+			break
+		}
+		if _, ok := applied[m.version]; !ok {
+			continue
+		}
+
+		steps = append(steps, model.MigrationStep{
+			Version:     m.version.String(),
+			Description: m.description,
+			Down:        true,
+		})
+		if opts.DryRun {
+			continue
+		}
+
+		l.Infof("reverting migration to version %s: %s", m.version, m.description)
+		if err := m.down(db, database); err != nil {
+			return steps, errors.Wrapf(err, "failed to revert migration to version %s", m.version)
+		}
+		if err := removeMigrationInfo(database, m.version); err != nil {
+			return steps, err
+		}
+	}
+
+	if opts.DryRun {
+		return steps, nil
+	}
+
+	// the version reached is recorded even without a migration to it
+	if migrate.VersionIsLess(*target, last) {
+		for v := range applied {
+			if migrate.VersionIsLess(*target, v) {
+				if err := removeMigrationInfo(database, v); err != nil {
+					return steps, err
+				}
+			}
+		}
+	}
+	if _, ok := applied[*target]; !ok && !isMigration(*target) {
+		if err := migrate.UpdateMigrationInfo(*target, db.session, dbName); err != nil {
+			return steps, errors.Wrapf(err, "failed to record migration to version %s", target)
+		}
+	}
+
+	l.Infof("DB migrated to version %s", target)
+
+	return steps, db.encryptPlainUsers(tenantCtx)
+}
+
+// encryptPlainUsers encrypts the users stored in plain text,
+// if encryption is enabled
+func (db *DataStoreMongo) encryptPlainUsers(ctx context.Context) error {
+	if db.cipher == nil {
+		return nil
+	}
+	if err := db.encryptUsers(ctx); err != nil {
+		return errors.Wrap(err, "failed to encrypt users")
+	}
+	return nil
+}
+
+func isMigration(v migrate.Version) bool {
+	for _, m := range migrations {
+		if m.version == v {
+			return true
+		}
+	}
+	return false
+}
+
+func removeMigrationInfo(database *mgo.Database, v migrate.Version) error {
+	_, err := database.C(migrate.DbMigrationsColl).RemoveAll(bson.M{"version": v})
+	if err != nil {
+		return errors.Wrapf(err, "failed to remove migration to version %s", v)
+	}
+	return nil
+}
+
+// GetMigrationStatus returns the version of the tenant's database and
+// the migrations applied to it or pending
+func (db *DataStoreMongo) GetMigrationStatus(ctx context.Context, tenant string) (*model.MigrationStatus, error) {
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{
+		Tenant: tenant,
+	})
+
+	applied, last, err := db.appliedMigrations(mstore.DbFromContext(tenantCtx, DbName))
+	if err != nil {
+		return nil, err
+	}
+
+	status := &model.MigrationStatus{
+		TenantID: tenant,
+		Version:  last.String(),
+		Target:   DbVersion,
+		Steps:    []model.MigrationStep{},
+	}
+	for _, m := range migrations {
+		step := model.MigrationStep{
+			Version:     m.version.String(),
+			Description: m.description,
+		}
+		if e, ok := applied[m.version]; ok {
+			ts := e.Timestamp.UTC()
+			step.AppliedTs = &ts
+		}
+		status.Steps = append(status.Steps, step)
+	}
+
+	return status, nil
+}
+
+// GetTenantIDs returns the IDs of the tenants having a database
+func (db *DataStoreMongo) GetTenantIDs(ctx context.Context) ([]string, error) {
+	dbs, err := migrate.GetTenantDbs(db.session, mstore.IsTenantDb(DbName))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to retrieve tenant DBs")
+	}
+
+	ids := []string{}
+	for _, d := range dbs {
+		ids = append(ids, mstore.TenantFromDbName(d, DbName))
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// TenantExists tells whether the tenant has a database
+func (db *DataStoreMongo) TenantExists(ctx context.Context, tenant string) (bool, error) {
+	ids, err := db.GetTenantIDs(ctx)
+	if err != nil {
+		return false, err
+	}
+	i := sort.SearchStrings(ids, tenant)
+	return i < len(ids) && ids[i] == tenant, nil
+}
@@ -0,0 +1,297 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package mongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/mendersoftware/go-lib-micro/mongo/migrate"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+)
+
+func TestMigrateTenantTo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigrateTenantTo in short mode.")
+	}
+
+	testCases := map[string]struct {
+		// version the database is at
+		from string
+
+		version string
+		opts    MigrateOptions
+
+		steps   []model.MigrationStep
+		applied []string
+	}{
+		"up from scratch": {
+			version: "1.0.0",
+			steps: []model.MigrationStep{
+				{Version: "0.1.0", Description: "initial schema"},
+				{Version: "1.0.0", Description: "index tokens and login history by user"},
+			},
+			applied: []string{"0.1.0", "1.0.0"},
+		},
+		"up from 0.1.0": {
+			from:    "0.1.0",
+			version: "1.0.0",
+			steps: []model.MigrationStep{
+				{Version: "1.0.0", Description: "index tokens and login history by user"},
+			},
+			applied: []string{"0.1.0", "1.0.0"},
+		},
+		"up, dry run": {
+			from:    "0.1.0",
+			version: "1.0.0",
+			opts:    MigrateOptions{DryRun: true},
+			steps: []model.MigrationStep{
+				{Version: "1.0.0", Description: "index tokens and login history by user"},
+			},
+			applied: []string{"0.1.0"},
+		},
+		"down": {
+			from:    "1.0.0",
+			version: "0.1.0",
+			opts:    MigrateOptions{Down: true},
+			steps: []model.MigrationStep{
+				{Version: "1.0.0", Description: "index tokens and login history by user", Down: true},
+			},
+			applied: []string{"0.1.0"},
+		},
+		"down, dry run": {
+			from:    "1.0.0",
+			version: "0.1.0",
+			opts:    MigrateOptions{Down: true, DryRun: true},
+			steps: []model.MigrationStep{
+				{Version: "1.0.0", Description: "index tokens and login history by user", Down: true},
+			},
+			applied: []string{"0.1.0", "1.0.0"},
+		},
+		"down not allowed": {
+			from:    "1.0.0",
+			version: "0.1.0",
+			applied: []string{"0.1.0", "1.0.0"},
+		},
+		"up to date": {
+			from:    "1.0.0",
+			version: "1.0.0",
+			steps:   []model.MigrationStep{},
+			applied: []string{"0.1.0", "1.0.0"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db.Wipe()
+
+			session := db.Session()
+			defer session.Close()
+
+			store, err := NewDataStoreMongoWithSession(session)
+			assert.NoError(t, err)
+			store = store.WithAutomigrate()
+
+			ctx := context.Background()
+
+			if tc.from != "" {
+				_, err := store.MigrateTenantTo(ctx, tc.from, "", MigrateOptions{})
+				assert.NoError(t, err)
+			}
+
+			steps, err := store.MigrateTenantTo(ctx, tc.version, "", tc.opts)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.steps, steps)
+
+			status, err := store.GetMigrationStatus(ctx, "")
+			assert.NoError(t, err)
+
+			applied := []string{}
+			for _, step := range status.Steps {
+				if step.AppliedTs != nil {
+					applied = append(applied, step.Version)
+				}
+			}
+			assert.Equal(t, tc.applied, applied)
+			assert.Equal(t, tc.applied[len(tc.applied)-1], status.Version)
+			assert.Equal(t, DbVersion, status.Target)
+		})
+	}
+}
+
+func TestMigrateTenantToNoAutomigrate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigrateTenantToNoAutomigrate in short mode.")
+	}
+
+	db.Wipe()
+
+	session := db.Session()
+	defer session.Close()
+
+	store, err := NewDataStoreMongoWithSession(session)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+
+	_, err = store.MigrateTenantTo(ctx, "1.0.0", "tenant1", MigrateOptions{})
+	assert.EqualError(t, err, "db needs migration: useradm-tenant1 has version 0.0.0, needs version 1.0.0")
+	assert.True(t, migrate.IsErrNeedsMigration(err))
+
+	// a dry run lists the steps anyway
+	steps, err := store.MigrateTenantTo(ctx, "1.0.0", "tenant1", MigrateOptions{DryRun: true})
+	assert.NoError(t, err)
+	assert.Len(t, steps, 2)
+
+	ids, err := store.GetTenantIDs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, ids)
+}
+
+func TestMigrateNormalizeEmails(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigrateNormalizeEmails in short mode.")
+	}
+
+	testCases := map[string]struct {
+		users []interface{}
+
+		emails map[string]string
+		err    string
+	}{
+		"ok": {
+			users: []interface{}{
+				bson.M{"_id": "1", DbUserEmail: "Foo@Bar.com"},
+				bson.M{"_id": "2", DbUserEmail: "baz@bar.com"},
+				bson.M{"_id": "3", DbUserEmail: "JOSÉ@bar.com"},
+			},
+			emails: map[string]string{
+				"1": "foo@bar.com",
+				"2": "baz@bar.com",
+				"3": "josé@bar.com",
+			},
+		},
+		"error: same email regardless of case": {
+			users: []interface{}{
+				bson.M{"_id": "1", DbUserEmail: "Foo@Bar.com"},
+				bson.M{"_id": "2", DbUserEmail: "foo@bar.com"},
+			},
+			err: "failed to apply migration to version 1.1.0: " +
+				"users with the same email regardless of case: 1 and 2",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db.Wipe()
+
+			session := db.Session()
+			defer session.Close()
+
+			ds, err := NewDataStoreMongoWithSession(session)
+			assert.NoError(t, err)
+			ds = ds.WithAutomigrate()
+
+			ctx := context.Background()
+
+			_, err = ds.MigrateTenantTo(ctx, "1.0.0", "", MigrateOptions{})
+			assert.NoError(t, err)
+
+			err = session.DB(DbName).C(DbUsersColl).Insert(tc.users...)
+			assert.NoError(t, err)
+
+			_, err = ds.MigrateTenantTo(ctx, "1.1.0", "", MigrateOptions{})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+
+			for id, email := range tc.emails {
+				u, err := ds.GetUserById(ctx, id)
+				assert.NoError(t, err)
+				assert.Equal(t, email, u.Email)
+			}
+
+			// emails differing by case are now duplicates
+			err = ds.CreateUser(ctx, &model.User{ID: "4", Email: "FOO@bar.com"})
+			assert.Equal(t, store.ErrDuplicateEmail, err)
+		})
+	}
+}
+
+func TestMigrateKeyEmails(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping TestMigrateKeyEmails in short mode.")
+	}
+
+	testCases := map[string]struct {
+		users []interface{}
+
+		err string
+	}{
+		"ok": {
+			users: []interface{}{
+				bson.M{"_id": "1", DbUserEmail: "foo@bar.com",
+					DbUserEmails: []bson.M{{"email": "foo@baz.com"}}},
+				bson.M{"_id": "2", DbUserEmail: "baz@bar.com"},
+			},
+		},
+		"error: primary email of another user": {
+			users: []interface{}{
+				bson.M{"_id": "1", DbUserEmail: "foo@bar.com",
+					DbUserEmails: []bson.M{{"email": "baz@bar.com"}}},
+				bson.M{"_id": "2", DbUserEmail: "baz@bar.com"},
+			},
+			err: "failed to apply migration to version 1.2.0: " +
+				"user 2 has an email of another user",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			db.Wipe()
+
+			session := db.Session()
+			defer session.Close()
+
+			ds, err := NewDataStoreMongoWithSession(session)
+			assert.NoError(t, err)
+			ds = ds.WithAutomigrate()
+
+			ctx := context.Background()
+
+			_, err = ds.MigrateTenantTo(ctx, "1.1.0", "", MigrateOptions{})
+			assert.NoError(t, err)
+
+			err = session.DB(DbName).C(DbUsersColl).Insert(tc.users...)
+			assert.NoError(t, err)
+
+			_, err = ds.MigrateTenantTo(ctx, "1.2.0", "", MigrateOptions{})
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+
+			// the additional emails are now taken for primary ones
+			err = ds.CreateUser(ctx, &model.User{ID: "3", Email: "foo@baz.com"})
+			assert.Equal(t, store.ErrDuplicateEmail, err)
+		})
+	}
+}
@@ -16,6 +16,8 @@ package mongo
 
 import (
 	"context"
+
+	"github.com/mendersoftware/useradm/model"
 )
 
 type TenantStoreMongo struct {
@@ -31,3 +33,19 @@ func NewTenantStoreMongo(db *DataStoreMongo) *TenantStoreMongo {
 func (ts *TenantStoreMongo) MigrateTenant(ctx context.Context, id string) error {
 	return ts.db.MigrateTenant(ctx, DbVersion, id)
 }
+
+func (ts *TenantStoreMongo) DeleteTenant(ctx context.Context, id string) error {
+	return ts.db.DeleteTenant(ctx, id)
+}
+
+func (ts *TenantStoreMongo) TenantExists(ctx context.Context, id string) (bool, error) {
+	return ts.db.TenantExists(ctx, id)
+}
+
+func (ts *TenantStoreMongo) GetMigrationStatus(ctx context.Context, id string) (*model.MigrationStatus, error) {
+	return ts.db.GetMigrationStatus(ctx, id)
+}
+
+func (ts *TenantStoreMongo) GetMigrationProgress(ctx context.Context) (*model.MigrationProgress, error) {
+	return ts.db.GetMigrationProgress(ctx)
+}
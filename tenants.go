@@ -0,0 +1,97 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/client/tenant"
+)
+
+// Tenant verification modes, see SettingTenantVerification
+const (
+	// the tenants are resolved by tenantadm, at tenantadm_addr
+	TenantVerificationTenantAdm = "tenantadm"
+	// all the users belong to the tenant tenant_static_id
+	TenantVerificationStatic = "static"
+	// the users belong to no tenant, single-tenant installations
+	TenantVerificationNone = "none"
+)
+
+// tenantVerification returns the tenant verification mode, resolving
+// the default one
+func tenantVerification(c config.Reader) string {
+	mode := c.GetString(SettingTenantVerification)
+	if mode != "" {
+		return mode
+	}
+	if c.GetString(SettingTenantAdmAddr) != "" {
+		return TenantVerificationTenantAdm
+	}
+	return TenantVerificationNone
+}
+
+// multitenant tells if the users belong to tenants
+func multitenant(c config.Reader) bool {
+	return tenantVerification(c) != TenantVerificationNone
+}
+
+// Helper for setting up the tenant verification selected in the
+// application configuration
+func tenantVerifierFromAppConfig(c config.Reader) (tenant.TenantVerifier, error) {
+	switch mode := tenantVerification(c); mode {
+	case TenantVerificationTenantAdm:
+		addr := c.GetString(SettingTenantAdmAddr)
+		if addr == "" {
+			return nil, errors.Errorf("%s is required by the %s tenant verification",
+				SettingTenantAdmAddr, mode)
+		}
+		return tenant.NewHTTPVerifier(tenantClientFromAppConfig(c, addr)), nil
+	case TenantVerificationStatic:
+		id := c.GetString(SettingTenantStaticID)
+		if id == "" {
+			return nil, errors.Errorf("%s is required by the %s tenant verification",
+				SettingTenantStaticID, mode)
+		}
+		return tenant.NewStaticVerifier(tenant.Tenant{ID: id}), nil
+	case TenantVerificationNone:
+		return tenant.NoopVerifier{}, nil
+	default:
+		return nil, errors.Errorf("unknown %s: %q, expected %s, %s or %s",
+			SettingTenantVerification, mode, TenantVerificationTenantAdm,
+			TenantVerificationStatic, TenantVerificationNone)
+	}
+}
+
+// tenantClientFromAppConfig sets up the tenantadm client, with the
+// requests retried and suspended during outages
+func tenantClientFromAppConfig(c config.Reader, addr string) tenant.ClientRunner {
+	tc := tenant.NewClient(tenant.Config{
+		TenantAdmAddr: addr,
+		Timeout:       time.Duration(c.GetInt(SettingTenantAdmTimeout)) * time.Second,
+	})
+
+	return tenant.NewResilientClient(tc, tenant.ResilienceConfig{
+		Retries: c.GetInt(SettingTenantAdmRetries),
+		RetryBackoff: time.Duration(c.GetInt(SettingTenantAdmRetryBackoffMs)) *
+			time.Millisecond,
+		BreakerThreshold: c.GetInt(SettingTenantAdmBreakerThreshold),
+		BreakerCooldown: time.Duration(c.GetInt(SettingTenantAdmBreakerCooldown)) *
+			time.Second,
+		FailOpen: c.GetBool(SettingTenantAdmFailOpen),
+	})
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"testing"
+
+	cmocks "github.com/mendersoftware/go-lib-micro/config/mocks"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/client/tenant"
+)
+
+func TestTenantVerifierFromAppConfig(t *testing.T) {
+	testCases := map[string]struct {
+		mode     string
+		addr     string
+		staticID string
+
+		multitenant bool
+		verifier    interface{}
+		err         string
+	}{
+		"default, standalone": {
+			verifier: tenant.NoopVerifier{},
+		},
+		"default, tenantadm": {
+			addr: "http://tenantadm:8080",
+
+			multitenant: true,
+			verifier:    &tenant.HTTPVerifier{},
+		},
+		"tenantadm": {
+			mode: TenantVerificationTenantAdm,
+			addr: "http://tenantadm:8080",
+
+			multitenant: true,
+			verifier:    &tenant.HTTPVerifier{},
+		},
+		"tenantadm, no address": {
+			mode: TenantVerificationTenantAdm,
+
+			multitenant: true,
+			err:         "tenantadm_addr is required by the tenantadm tenant verification",
+		},
+		"static": {
+			mode:     TenantVerificationStatic,
+			staticID: "foo",
+
+			multitenant: true,
+			verifier:    &tenant.StaticVerifier{},
+		},
+		"static, no tenant": {
+			mode: TenantVerificationStatic,
+
+			multitenant: true,
+			err:         "tenant_static_id is required by the static tenant verification",
+		},
+		"none": {
+			mode: TenantVerificationNone,
+			addr: "http://tenantadm:8080",
+
+			verifier: tenant.NoopVerifier{},
+		},
+		"unknown": {
+			mode: "foo",
+
+			multitenant: true,
+			err: `unknown tenant_verification: "foo", ` +
+				`expected tenantadm, static or none`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			conf := &cmocks.Reader{}
+			conf.On("GetString", SettingTenantVerification).Return(tc.mode)
+			conf.On("GetString", SettingTenantAdmAddr).Return(tc.addr)
+			conf.On("GetString", SettingTenantStaticID).Return(tc.staticID)
+			conf.On("GetInt", SettingTenantAdmTimeout).Return(10)
+			conf.On("GetInt", SettingTenantAdmRetries).Return(2)
+			conf.On("GetInt", SettingTenantAdmRetryBackoffMs).Return(100)
+			conf.On("GetInt", SettingTenantAdmBreakerThreshold).Return(5)
+			conf.On("GetInt", SettingTenantAdmBreakerCooldown).Return(30)
+			conf.On("GetBool", SettingTenantAdmFailOpen).Return(false)
+
+			assert.Equal(t, tc.multitenant, multitenant(conf))
+
+			verifier, err := tenantVerifierFromAppConfig(conf)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.IsType(t, tc.verifier, verifier)
+		})
+	}
+}
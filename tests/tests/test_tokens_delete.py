@@ -75,7 +75,7 @@ class TestDeleteTokensMultitenant:
 
         payload = {'user_id': user, 'tenant_id': tenant}
         rsp = requests.delete(api_client_int.make_api_url("/tokens"), params=payload)
-        assert rsp.status_code == 204
+        assert rsp.status_code == 202
 
         verify_tokens(api_client_int, tokens, tenant, user)
 
@@ -89,10 +89,19 @@ class TestDeleteTokensMultitenant:
 
         payload = {'tenant_id': tenant}
         rsp = requests.delete(api_client_int.make_api_url("/tokens"), params=payload)
-        assert rsp.status_code == 204
+        assert rsp.status_code == 202
 
+        # the tokens are rejected before the revocation is done
         verify_tokens(api_client_int, tokens, tenant)
 
+        revocation = rsp.json()
+        assert revocation['tenant_id'] == tenant
+        assert rsp.headers['Location'] == "tokens/revocations/" + revocation['id']
+
+        rsp = requests.get(api_client_int.make_api_url("/tokens/revocations/" + revocation['id']))
+        assert rsp.status_code == 200
+        assert rsp.json()['status'] in ['pending', 'running', 'done']
+
     def test_delete_by_non_existent_user_ok(self, api_client_int, user_tokens_mt_f):
         tokens = user_tokens_mt_f
         for t in tokens:
@@ -103,7 +112,7 @@ class TestDeleteTokensMultitenant:
 
         payload = {'user_id': 'foo', 'tenant_id': tenant}
         rsp = requests.delete(api_client_int.make_api_url("/tokens"), params=payload)
-        assert rsp.status_code == 204
+        assert rsp.status_code == 202
 
         verify_tokens(api_client_int, tokens)
 
@@ -114,7 +123,7 @@ class TestDeleteTokensMultitenant:
 
         payload = {'tenant_id': 'foo'}
         rsp = requests.delete(api_client_int.make_api_url("/tokens"), params=payload)
-        assert rsp.status_code == 204
+        assert rsp.status_code == 202
 
         verify_tokens(api_client_int, tokens)
 
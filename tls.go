@@ -0,0 +1,121 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package main
+
+import (
+	"crypto/tls"
+
+	"github.com/mendersoftware/go-lib-micro/config"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/keys"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Helper for mapping application configuration to the TLS configuration
+// of the listener; returns nil if HTTPS is not enabled
+func tlsConfigFromAppConfig(c config.Reader) (*tls.Config, *keys.CertLoader, error) {
+	certPath := c.GetString(SettingTLSCertPath)
+	keyPath := c.GetString(SettingTLSKeyPath)
+	if certPath == "" && keyPath == "" {
+		return nil, nil, nil
+	}
+	if certPath == "" || keyPath == "" {
+		return nil, nil, errors.Errorf("both %s and %s must be set",
+			SettingTLSCertPath, SettingTLSKeyPath)
+	}
+
+	minVersion, ok := tlsVersions[c.GetString(SettingTLSMinVersion)]
+	if !ok {
+		return nil, nil, errors.Errorf("unsupported TLS version: %s",
+			c.GetString(SettingTLSMinVersion))
+	}
+
+	cipherSuites, err := tlsCipherSuites(c.GetStringSlice(SettingTLSCipherSuites))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loader, err := keys.NewCertLoader(certPath, keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: loader.GetCertificate,
+	}, loader, nil
+}
+
+// tlsCipherSuites maps cipher suite names to their IDs;
+// nil, i.e. the Go defaults, if none are given
+func tlsCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	known := map[string]uint16{}
+	for _, s := range tls.CipherSuites() {
+		known[s.Name] = s.ID
+	}
+
+	ids := []uint16{}
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, errors.Errorf("unsupported cipher suite: %s", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// Helper for mapping application configuration to the TLS configuration
+// of the internal API listener, requiring client certificates if the CA
+// to verify them against is set
+func internalTLSConfigFromAppConfig(c config.Reader, base *tls.Config) (*tls.Config, error) {
+	caPath := c.GetString(SettingInternalTLSClientCAPath)
+	if caPath == "" {
+		return base, nil
+	}
+	if base == nil {
+		return nil, errors.Errorf("%s requires %s and %s to be set",
+			SettingInternalTLSClientCAPath, SettingTLSCertPath, SettingTLSKeyPath)
+	}
+
+	pool, err := keys.LoadCertPool(caPath)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier := &keys.ClientCertVerifier{
+		AllowedSANs:    c.GetStringSlice(SettingInternalTLSClientAllowedSANs),
+		AllowedIssuers: c.GetStringSlice(SettingInternalTLSClientAllowedIssuers),
+	}
+
+	tlsConfig := base.Clone()
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	tlsConfig.ClientCAs = pool
+	tlsConfig.VerifyPeerCertificate = verifier.VerifyPeerCertificate
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/mail"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+)
+
+func (ua *UserAdm) BootstrapAdmin(ctx context.Context, email string) error {
+	l := log.FromContext(ctx)
+
+	n, err := ua.db.CountUsers(ctx, model.UserFilter{})
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to count users")
+	}
+	if n > 0 {
+		return nil
+	}
+
+	// the password is never stored in plain text, it's only
+	// handed over to the administrator once
+	password, err := newVerificationCode()
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to generate password")
+	}
+
+	u := &model.User{
+		Email:    email,
+		Password: password,
+	}
+	if err := u.ValidateNew(); err != nil {
+		return errors.Wrap(err, "useradm: invalid administrator")
+	}
+
+	if err := ua.CreateUser(ctx, u); err != nil {
+		// another instance bootstrapped concurrently
+		if err == store.ErrDuplicateEmail {
+			return nil
+		}
+		return errors.Wrap(err, "useradm: failed to create administrator")
+	}
+
+	if ua.mailer != nil {
+		err := ua.mailer.Send(ctx, mail.Message{
+			To:      u.Email,
+			Subject: subjectBootstrapAdmin,
+			Body:    fmt.Sprintf(bodyBootstrapAdmin, u.Email, password),
+		})
+		if err == nil {
+			l.Infof("created administrator %s, the password was mailed to it",
+				u.Email)
+			return nil
+		}
+		l.Errorf("failed to mail the password of administrator %s: %v", u.Email, err)
+	}
+
+	l.Warnf("created administrator %s with password %s, "+
+		"change it after logging in", u.Email, password)
+
+	return nil
+}
+
+// inviteTenantAdmin creates the first administrator of the new tenant,
+// and mails it the invitation with a random password; on failure the
+// tenant is removed again if this call created it, so the creation can
+// be retried, otherwise only the administrator is
+func (ua *UserAdm) inviteTenantAdmin(ctx context.Context,
+	tenant model.NewTenant, existed bool) error {
+	ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenant.ID})
+
+	// never remove a tenant which is already in use
+	n, err := ua.db.CountUsers(ctx, model.UserFilter{})
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to count users")
+	}
+	if n > 0 {
+		return ErrTenantHasUsers
+	}
+
+	password, err := newVerificationCode()
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to generate password")
+	}
+
+	u := &model.User{
+		Email:    tenant.AdminEmail,
+		Password: password,
+	}
+	err = u.ValidateNew()
+	if err == nil {
+		err = ua.CreateUser(ctx, u)
+	}
+	if err == nil {
+		err = ua.mailer.Send(ctx, mail.Message{
+			To:      u.Email,
+			Subject: subjectTenantInvitation,
+			Body:    fmt.Sprintf(bodyTenantInvitation, u.Email, password),
+		})
+		if err != nil {
+			err = errors.Wrap(err, "useradm: failed to mail the invitation")
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	l := log.FromContext(ctx)
+	if u.ID != "" && ua.verifyTenant {
+		if cerr := ua.compensateTenantUser(ctx, u.ID, tenant.ID); cerr != nil {
+			l.Errorf("failed to remove administrator %s of tenant %s: %v",
+				u.ID, tenant.ID, cerr)
+		}
+	}
+	if !existed {
+		if derr := ua.tenantKeeper.DeleteTenant(ctx, tenant.ID); derr != nil {
+			l.Errorf("failed to remove tenant %s: %v", tenant.ID, derr)
+		}
+	} else if u.ID != "" {
+		// the tenant's other data, e.g. the settings, is kept
+		if derr := ua.db.EraseUser(ctx, u.ID); derr != nil &&
+			derr != store.ErrUserNotFound {
+			l.Errorf("failed to remove administrator %s of tenant %s: %v",
+				u.ID, tenant.ID, derr)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,271 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mendersoftware/useradm/mail"
+	mmail "github.com/mendersoftware/useradm/mail/mocks"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmBootstrapAdmin(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dbCount    int
+		dbCountErr error
+		dbErr      error
+
+		withMailer bool
+		mailErr    error
+
+		created bool
+		err     error
+	}{
+		"ok": {
+			created: true,
+		},
+		"ok, mailed": {
+			withMailer: true,
+			created:    true,
+		},
+		"ok, mail failed": {
+			withMailer: true,
+			mailErr:    errors.New("smtp server down"),
+			created:    true,
+		},
+		"ok, users exist": {
+			dbCount: 1,
+		},
+		"ok, created concurrently": {
+			dbErr:   store.ErrDuplicateEmail,
+			created: true,
+		},
+		"error: count": {
+			dbCountErr: errors.New("db connection failed"),
+			err:        errors.New("useradm: failed to count users: db connection failed"),
+		},
+		"error: create": {
+			dbErr:   errors.New("db connection failed"),
+			created: true,
+			err: errors.New("useradm: failed to create administrator: " +
+				"useradm: failed to create user in the db: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+
+			var stored *model.User
+			db := &mstore.DataStore{}
+			db.On("CountUsers", ContextMatcher(), model.UserFilter{}).
+				Return(tc.dbCount, tc.dbCountErr)
+			db.On("GetSettings", ContextMatcher()).
+				Return(map[string]interface{}{}, nil)
+			db.On("GetPlan", ContextMatcher()).Return(nil, nil)
+			db.On("CreateUser", ContextMatcher(), mock.AnythingOfType("*model.User")).
+				Run(func(args mock.Arguments) {
+					stored = args.Get(1).(*model.User)
+				}).
+				Return(tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			var sent []mail.Message
+			if tc.withMailer {
+				mailer := &mmail.Mailer{}
+				mailer.On("Send", ContextMatcher(), mock.AnythingOfType("mail.Message")).
+					Run(func(args mock.Arguments) {
+						sent = append(sent, args.Get(1).(mail.Message))
+					}).
+					Return(tc.mailErr)
+				useradm = useradm.WithMailer(mailer)
+			}
+
+			err := useradm.BootstrapAdmin(ctx, "Admin@Example.com")
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if !tc.created {
+				assert.Nil(t, stored)
+				return
+			}
+			assert.Equal(t, "admin@example.com", stored.Email)
+
+			if tc.withMailer && assert.Len(t, sent, 1) {
+				assert.Equal(t, "admin@example.com", sent[0].To)
+				assert.Equal(t, subjectBootstrapAdmin, sent[0].Subject)
+
+				// the mailed password is the one stored
+				password := strings.TrimSpace(strings.Split(sent[0].Body, "\n\n")[2])
+				assert.NoError(t, bcrypt.CompareHashAndPassword(
+					[]byte(stored.Password), []byte(password)))
+			}
+		})
+	}
+}
+
+func TestUserAdmCreateTenantWithAdmin(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		noMailer   bool
+		existed    bool
+		dbCount    int
+		dbCountErr error
+		dbErr      error
+		mailErr    error
+
+		created bool
+		deleted bool
+		err     error
+	}{
+		"ok": {
+			created: true,
+		},
+		"error: no mailer": {
+			noMailer: true,
+			err:      ErrMailerNotConfigured,
+		},
+		"error: tenant has users": {
+			dbCount: 1,
+			err:     ErrTenantHasUsers,
+		},
+		"error: count": {
+			dbCountErr: errors.New("db connection failed"),
+			err:        errors.New("useradm: failed to count users: db connection failed"),
+		},
+		"error: create": {
+			dbErr:   store.ErrDuplicateEmail,
+			created: true,
+			deleted: true,
+			err:     store.ErrDuplicateEmail,
+		},
+		"error: mail": {
+			mailErr: errors.New("smtp server down"),
+			created: true,
+			deleted: true,
+			err:     errors.New("useradm: failed to mail the invitation: smtp server down"),
+		},
+		"error: mail, tenant existed": {
+			existed: true,
+			mailErr: errors.New("smtp server down"),
+			created: true,
+			err:     errors.New("useradm: failed to mail the invitation: smtp server down"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+			tenantCtx := mock.MatchedBy(func(c context.Context) bool {
+				id := identity.FromContext(c)
+				return id != nil && id.Tenant == "tenant1"
+			})
+
+			var stored *model.User
+			db := &mstore.DataStore{}
+			db.On("CountUsers", tenantCtx, model.UserFilter{}).
+				Return(tc.dbCount, tc.dbCountErr)
+			db.On("GetSettings", tenantCtx).
+				Return(map[string]interface{}{}, nil)
+			db.On("GetPlan", tenantCtx).Return(nil, nil)
+			db.On("CreateUser", tenantCtx, mock.AnythingOfType("*model.User")).
+				Run(func(args mock.Arguments) {
+					stored = args.Get(1).(*model.User)
+				}).
+				Return(tc.dbErr)
+
+			db.On("EraseUser", tenantCtx, mock.AnythingOfType("string")).Return(nil)
+
+			tenantDb := &mstore.TenantDataKeeper{}
+			tenantDb.On("TenantExists", ContextMatcher(), "tenant1").Return(tc.existed, nil)
+			tenantDb.On("MigrateTenant", ContextMatcher(), "tenant1").Return(nil)
+			tenantDb.On("DeleteTenant", ContextMatcher(), "tenant1").Return(nil)
+
+			useradm := NewUserAdm(nil, db, tenantDb, Config{})
+
+			var sent []mail.Message
+			if !tc.noMailer {
+				mailer := &mmail.Mailer{}
+				mailer.On("Send", tenantCtx, mock.AnythingOfType("mail.Message")).
+					Run(func(args mock.Arguments) {
+						sent = append(sent, args.Get(1).(mail.Message))
+					}).
+					Return(tc.mailErr)
+				useradm = useradm.WithMailer(mailer)
+			}
+
+			err := useradm.CreateTenant(ctx, model.NewTenant{
+				ID:         "tenant1",
+				AdminEmail: "Admin@Example.com",
+			})
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+
+			if tc.noMailer {
+				tenantDb.AssertNotCalled(t, "MigrateTenant", mock.Anything, mock.Anything)
+			}
+			if tc.deleted {
+				tenantDb.AssertCalled(t, "DeleteTenant", ContextMatcher(), "tenant1")
+			} else {
+				tenantDb.AssertNotCalled(t, "DeleteTenant", mock.Anything, mock.Anything)
+			}
+			// only the administrator is removed from a tenant which existed
+			if tc.existed && tc.err != nil {
+				db.AssertCalled(t, "EraseUser", tenantCtx, stored.ID)
+			} else {
+				db.AssertNotCalled(t, "EraseUser", mock.Anything, mock.Anything)
+			}
+
+			if !tc.created {
+				assert.Nil(t, stored)
+				return
+			}
+			assert.Equal(t, "admin@example.com", stored.Email)
+
+			if tc.dbErr == nil && assert.Len(t, sent, 1) {
+				assert.Equal(t, "admin@example.com", sent[0].To)
+				assert.Equal(t, subjectTenantInvitation, sent[0].Subject)
+
+				// the mailed password is the one stored
+				password := strings.TrimSpace(strings.Split(sent[0].Body, "\n\n")[2])
+				assert.NoError(t, bcrypt.CompareHashAndPassword(
+					[]byte(stored.Password), []byte(password)))
+			}
+		})
+	}
+}
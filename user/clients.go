@@ -0,0 +1,198 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/scope"
+	"github.com/mendersoftware/useradm/store"
+)
+
+func (ua *UserAdm) CreateOAuthClient(ctx context.Context,
+	c model.OAuthClientNew) (*model.OAuthClientCredentials, error) {
+	// the clients get at most the tenant admin's scopes, never the
+	// operator's
+	clientScope, err := scope.Narrow(scope.All, c.Scope)
+	if err != nil {
+		return nil, ErrInvalidScope
+	}
+
+	secret, err := newClientSecret()
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to generate client secret")
+	}
+
+	client := model.OAuthClient{
+		ID:           uuid.NewV4().String(),
+		Name:         c.Name,
+		Scope:        clientScope,
+		RedirectURIs: c.RedirectURIs,
+		SecretHash:   hashClientSecret(secret),
+		CreatedTs:    time.Now().UTC(),
+	}
+	if err := ua.db.CreateOAuthClient(ctx, &client); err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to create client")
+	}
+
+	return &model.OAuthClientCredentials{
+		OAuthClient: client,
+		Secret:      secret,
+	}, nil
+}
+
+func (ua *UserAdm) GetOAuthClients(ctx context.Context) ([]model.OAuthClient, error) {
+	clients, err := ua.db.GetOAuthClients(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get clients")
+	}
+	return clients, nil
+}
+
+func (ua *UserAdm) DeleteOAuthClient(ctx context.Context, id string) error {
+	if err := ua.db.DeleteOAuthClient(ctx, id); err != nil {
+		if err == store.ErrOAuthClientNotFound {
+			return err
+		}
+		return errors.Wrap(err, "useradm: failed to delete client")
+	}
+
+	if err := ua.db.DeleteTokensByUserId(ctx, id); err != nil && err != store.ErrTokenNotFound {
+		return errors.Wrap(err, "useradm: failed to delete client tokens")
+	}
+	return nil
+}
+
+func (ua *UserAdm) IssueClientToken(ctx context.Context,
+	id, secret, requested string) (*jwt.Token, error) {
+	client, err := ua.authenticateClient(ctx, id, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenScope, err := scope.Narrow(client.Scope, requested)
+	if err != nil {
+		return nil, ErrInvalidScope
+	}
+
+	if client.TenantID != "" {
+		ctx = identity.WithContext(ctx, &identity.Identity{Tenant: client.TenantID})
+
+		status, err := ua.db.GetTenantStatus(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "useradm: failed to get tenant status")
+		}
+		if err := ua.checkTenantStatus(ctx, status); err != nil {
+			return nil, err
+		}
+	}
+
+	t := ua.generateToken(client.ID, tokenScope, client.TenantID)
+	t.Claims.Client = true
+
+	if err := ua.db.SaveToken(ctx, t); err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to save token")
+	}
+
+	log.FromContext(ctx).F(log.Ctx{
+		"client_id": client.ID,
+		"token_id":  t.Id,
+	}).Infof("token issued to client %s", client.Name)
+
+	return t, nil
+}
+
+// authenticateClient returns the client with the given credentials,
+// ErrInvalidClient if there's none
+func (ua *UserAdm) authenticateClient(ctx context.Context,
+	id, secret string) (*model.OAuthClient, error) {
+	if id == "" {
+		return nil, ErrInvalidClient
+	}
+
+	client, err := ua.db.GetOAuthClientById(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get client")
+	}
+	if client == nil {
+		return nil, ErrInvalidClient
+	}
+	if subtle.ConstantTimeCompare([]byte(hashClientSecret(secret)),
+		[]byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+// verifyClientToken checks the token of an OAuth client, which is valid
+// while the client isn't removed
+func (ua *UserAdm) verifyClientToken(ctx context.Context, token *jwt.Token) error {
+	client, err := ua.db.GetOAuthClientById(ctx, token.Claims.Subject)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get client")
+	}
+	if client == nil || client.TenantID != token.Claims.Tenant {
+		return ErrUnauthorized
+	}
+
+	dbToken, err := ua.db.GetTokenById(ctx, token.Id)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get token")
+	}
+	if dbToken == nil {
+		return ErrUnauthorized
+	}
+
+	if token.Claims.Tenant != "" {
+		status, err := ua.db.GetTenantStatus(ctx)
+		if err != nil {
+			return errors.Wrap(err, "useradm: failed to get tenant status")
+		}
+		return ua.checkTenantStatus(ctx, status)
+	}
+	return nil
+}
+
+func newClientSecret() (string, error) {
+	return randomHex(32)
+}
+
+// randomHex returns n random bytes, hex-encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashClientSecret returns the form the secret is stored in; the secrets
+// are random, unlike passwords, so a plain hash is enough
+func hashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,276 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/scope"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmCreateOAuthClient(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		client model.OAuthClientNew
+
+		dbErr error
+
+		scope string
+		err   error
+	}{
+		"ok, full scope": {
+			client: model.OAuthClientNew{Name: "ci"},
+			scope:  scope.All,
+		},
+		"ok, narrowed": {
+			client: model.OAuthClientNew{Name: "ci", Scope: scope.UsersRead},
+			scope:  scope.UsersRead,
+		},
+		"error: operator scope": {
+			client: model.OAuthClientNew{Name: "ci", Scope: scope.Operator},
+			err:    ErrInvalidScope,
+		},
+		"error: db": {
+			client: model.OAuthClientNew{Name: "ci"},
+			dbErr:  errors.New("db connection failed"),
+			err:    errors.New("useradm: failed to create client: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("CreateOAuthClient", ContextMatcher(),
+				mock.AnythingOfType("*model.OAuthClient")).Return(tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			creds, err := useradm.CreateOAuthClient(context.Background(), tc.client)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, creds)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEmpty(t, creds.ID)
+			assert.Equal(t, tc.client.Name, creds.Name)
+			assert.Equal(t, tc.scope, creds.Scope)
+			assert.NotEmpty(t, creds.Secret)
+			assert.Equal(t, hashClientSecret(creds.Secret), creds.SecretHash)
+		})
+	}
+}
+
+func TestUserAdmIssueClientToken(t *testing.T) {
+	t.Parallel()
+
+	client := &model.OAuthClient{
+		ID:         "client-1",
+		TenantID:   "tenant-1",
+		Name:       "ci",
+		Scope:      scope.UsersWrite,
+		SecretHash: hashClientSecret("secret"),
+	}
+
+	testCases := map[string]struct {
+		id     string
+		secret string
+		scope  string
+
+		dbClient    *model.OAuthClient
+		dbClientErr error
+		dbStatus    *model.TenantStatus
+		dbSaveErr   error
+
+		tokenScope string
+		err        error
+	}{
+		"ok": {
+			id:         "client-1",
+			secret:     "secret",
+			dbClient:   client,
+			tokenScope: scope.UsersWrite,
+		},
+		"ok, narrowed": {
+			id:         "client-1",
+			secret:     "secret",
+			scope:      scope.UsersRead,
+			dbClient:   client,
+			tokenScope: scope.UsersRead,
+		},
+		"error: no client id": {
+			err: ErrInvalidClient,
+		},
+		"error: unknown client": {
+			id:     "client-1",
+			secret: "secret",
+			err:    ErrInvalidClient,
+		},
+		"error: wrong secret": {
+			id:       "client-1",
+			secret:   "wrong",
+			dbClient: client,
+			err:      ErrInvalidClient,
+		},
+		"error: scope not granted": {
+			id:       "client-1",
+			secret:   "secret",
+			scope:    scope.SettingsWrite,
+			dbClient: client,
+			err:      ErrInvalidScope,
+		},
+		"error: tenant suspended": {
+			id:       "client-1",
+			secret:   "secret",
+			dbClient: client,
+			dbStatus: &model.TenantStatus{
+				Status:    model.TenantStatusSuspended,
+				UpdatedTs: time.Now(),
+			},
+			err: ErrTenantAccountSuspended,
+		},
+		"error: db get": {
+			id:          "client-1",
+			secret:      "secret",
+			dbClientErr: errors.New("db connection failed"),
+			err:         errors.New("useradm: failed to get client: db connection failed"),
+		},
+		"error: db save": {
+			id:        "client-1",
+			secret:    "secret",
+			dbClient:  client,
+			dbSaveErr: errors.New("db connection failed"),
+			err:       errors.New("useradm: failed to save token: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("GetOAuthClientById", ContextMatcher(), tc.id).
+				Return(tc.dbClient, tc.dbClientErr)
+			db.On("GetTenantStatus", ContextMatcher()).Return(tc.dbStatus, nil)
+			db.On("SaveToken", ContextMatcher(),
+				mock.AnythingOfType("*jwt.Token")).Return(tc.dbSaveErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{ExpirationTime: 3600})
+
+			token, err := useradm.IssueClientToken(context.Background(),
+				tc.id, tc.secret, tc.scope)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, token)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, client.ID, token.Claims.Subject)
+			assert.Equal(t, client.TenantID, token.Claims.Tenant)
+			assert.Equal(t, tc.tokenScope, token.Claims.Scope)
+			assert.True(t, token.Claims.Client)
+			assert.True(t, token.Claims.User)
+		})
+	}
+}
+
+func TestUserAdmVerifyClientToken(t *testing.T) {
+	t.Parallel()
+
+	client := &model.OAuthClient{
+		ID:       "client-1",
+		TenantID: "tenant-1",
+		Name:     "ci",
+		Scope:    scope.All,
+	}
+	token := &jwt.Token{
+		Id: "token-1",
+		Claims: jwt.Claims{
+			ID:      "token-1",
+			Subject: "client-1",
+			Tenant:  "tenant-1",
+			Scope:   scope.All,
+			User:    true,
+			Client:  true,
+		},
+	}
+
+	testCases := map[string]struct {
+		dbClient *model.OAuthClient
+		dbToken  *jwt.Token
+		dbStatus *model.TenantStatus
+
+		err error
+	}{
+		"ok": {
+			dbClient: client,
+			dbToken:  token,
+		},
+		"error: client removed": {
+			err: ErrUnauthorized,
+		},
+		"error: client of another tenant": {
+			dbClient: &model.OAuthClient{ID: "client-1", TenantID: "tenant-2"},
+			dbToken:  token,
+			err:      ErrUnauthorized,
+		},
+		"error: token removed": {
+			dbClient: client,
+			err:      ErrUnauthorized,
+		},
+		"error: tenant suspended": {
+			dbClient: client,
+			dbToken:  token,
+			dbStatus: &model.TenantStatus{
+				Status:    model.TenantStatusSuspended,
+				UpdatedTs: time.Now(),
+			},
+			err: ErrTenantAccountSuspended,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("GetOAuthClientById", ContextMatcher(), "client-1").
+				Return(tc.dbClient, nil)
+			db.On("GetTokenById", ContextMatcher(), "token-1").
+				Return(tc.dbToken, nil)
+			db.On("GetTenantStatus", ContextMatcher()).Return(tc.dbStatus, nil)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{Tenant: "tenant-1"})
+			err := useradm.verifyClientToken(ctx, token)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"crypto/rand"
+	"net/url"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/scope"
+	"github.com/mendersoftware/useradm/store"
+)
+
+const (
+	// seconds the device's interval grows by when it polls too often,
+	// see RFC 8628 3.5
+	deviceSlowDownInterval = 5
+
+	// attempts at a user code not taken yet
+	userCodeAttempts = 3
+)
+
+func (ua *UserAdm) StartDeviceAuthorization(ctx context.Context,
+	clientID, requestedScope string) (*model.DeviceAuthorizationResponse, error) {
+	if ua.config.DeviceVerificationURL == "" {
+		return nil, ErrDeviceFlowDisabled
+	}
+	if clientID == "" || len(clientID) > model.MaxDeviceClientIDLength {
+		return nil, model.ErrInvalidDeviceClientID
+	}
+	if _, err := scope.Narrow(scope.All+" "+scope.Operator, requestedScope); err != nil {
+		return nil, ErrInvalidScope
+	}
+
+	deviceCode, err := randomHex(32)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to generate device code")
+	}
+
+	a := &model.DeviceAuthorization{
+		ID:       hashClientSecret(deviceCode),
+		ClientID: clientID,
+		Scope:    requestedScope,
+		Status:   model.DeviceAuthorizationPending,
+		Interval: ua.config.DeviceCodeInterval,
+		ExpiresTs: time.Now().UTC().Add(
+			time.Duration(ua.config.DeviceCodeExpirationTime) * time.Second),
+	}
+	for i := 0; ; i++ {
+		a.UserCode, err = randomUserCode()
+		if err != nil {
+			return nil, errors.Wrap(err, "useradm: failed to generate user code")
+		}
+		err = ua.db.CreateDeviceAuthorization(ctx, a)
+		if err != store.ErrDuplicateUserCode || i == userCodeAttempts-1 {
+			break
+		}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to save device authorization")
+	}
+
+	userCode := model.FormatUserCode(a.UserCode)
+	complete, err := url.Parse(ua.config.DeviceVerificationURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: invalid device verification URL")
+	}
+	q := complete.Query()
+	q.Set("user_code", userCode)
+	complete.RawQuery = q.Encode()
+
+	return &model.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         ua.config.DeviceVerificationURL,
+		VerificationURIComplete: complete.String(),
+		ExpiresIn:               ua.config.DeviceCodeExpirationTime,
+		Interval:                a.Interval,
+	}, nil
+}
+
+func (ua *UserAdm) GetDeviceAuthorization(ctx context.Context,
+	userCode string) (*model.DeviceAuthorizationInfo, error) {
+	a, err := ua.pendingDeviceAuthorization(ctx, userCode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.DeviceAuthorizationInfo{
+		UserCode:  model.FormatUserCode(a.UserCode),
+		ClientID:  a.ClientID,
+		Scope:     a.Scope,
+		ExpiresTs: a.ExpiresTs,
+	}, nil
+}
+
+// VerifyDeviceAuthorization approves or denies the device's login as the
+// user in the context; the token gets the requested scopes the user has,
+// all the user's if none
+func (ua *UserAdm) VerifyDeviceAuthorization(ctx context.Context,
+	v model.DeviceVerification) error {
+	a, err := ua.pendingDeviceAuthorization(ctx, v.UserCode)
+	if err != nil {
+		return err
+	}
+	ident := identity.FromContext(ctx)
+
+	l := log.FromContext(ctx).F(log.Ctx{
+		"client_id": a.ClientID,
+		"user_id":   ident.Subject,
+	})
+
+	if !*v.Approve {
+		err := ua.db.ResolveDeviceAuthorization(ctx, a.ID, model.DeviceAuthorizationResolution{
+			Status:   model.DeviceAuthorizationDenied,
+			TenantID: ident.Tenant,
+			UserID:   ident.Subject,
+		})
+		if err != nil {
+			return err
+		}
+		l.Infof("user %s denied the login of %s", ident.Subject, a.ClientID)
+		return nil
+	}
+
+	user, err := ua.db.GetUserById(ctx, ident.Subject)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil {
+		return ErrUnauthorized
+	}
+	if !user.IsActive() {
+		return ErrUserInactive
+	}
+
+	tokenScope, err := scope.Narrow(ua.userScope(ident.Tenant, user), a.Scope)
+	if err != nil {
+		return ErrInvalidScope
+	}
+
+	err = ua.db.ResolveDeviceAuthorization(ctx, a.ID, model.DeviceAuthorizationResolution{
+		Status:   model.DeviceAuthorizationApproved,
+		TenantID: ident.Tenant,
+		UserID:   user.ID,
+		Scope:    tokenScope,
+	})
+	if err != nil {
+		return err
+	}
+	l.Infof("user %s approved the login of %s", user.ID, a.ClientID)
+	return nil
+}
+
+// pendingDeviceAuthorization returns the login the user in the context
+// may approve, store.ErrDeviceAuthorizationNotFound if there's none
+func (ua *UserAdm) pendingDeviceAuthorization(ctx context.Context,
+	userCode string) (*model.DeviceAuthorization, error) {
+	if ua.config.DeviceVerificationURL == "" {
+		return nil, ErrDeviceFlowDisabled
+	}
+	if identity.FromContext(ctx) == nil {
+		return nil, ErrUnauthorized
+	}
+
+	a, err := ua.db.GetDeviceAuthorizationByUserCode(ctx,
+		model.NormalizeUserCode(userCode))
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get device authorization")
+	}
+	if a == nil || a.Status != model.DeviceAuthorizationPending ||
+		time.Now().After(a.ExpiresTs) {
+		return nil, store.ErrDeviceAuthorizationNotFound
+	}
+	return a, nil
+}
+
+// IssueDeviceToken responds to the device's poll, with the token once the
+// user approved the login, see RFC 8628 3.5
+func (ua *UserAdm) IssueDeviceToken(ctx context.Context,
+	clientID, deviceCode string) (*model.AccessToken, error) {
+	if ua.config.DeviceVerificationURL == "" {
+		return nil, ErrDeviceFlowDisabled
+	}
+
+	a, err := ua.db.GetDeviceAuthorization(ctx, hashClientSecret(deviceCode))
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get device authorization")
+	}
+	if a == nil || a.ClientID != clientID {
+		return nil, ErrInvalidDeviceCode
+	}
+
+	now := time.Now().UTC()
+	if now.After(a.ExpiresTs) {
+		return nil, ErrExpiredDeviceCode
+	}
+
+	switch a.Status {
+	case model.DeviceAuthorizationPending:
+		err, next := ErrAuthorizationPending, a.Interval
+		if !a.PolledTs.IsZero() &&
+			now.Before(a.PolledTs.Add(time.Duration(a.Interval)*time.Second)) {
+			next += deviceSlowDownInterval
+			err = ErrSlowDown
+		}
+		if perr := ua.db.SetDeviceAuthorizationPolled(ctx, a.ID, now, next); perr != nil {
+			return nil, errors.Wrap(perr, "useradm: failed to update device authorization")
+		}
+		return nil, err
+	case model.DeviceAuthorizationDenied:
+		if err := ua.db.DeleteDeviceAuthorization(ctx, a.ID); err != nil &&
+			err != store.ErrDeviceAuthorizationNotFound {
+			return nil, errors.Wrap(err, "useradm: failed to remove device authorization")
+		}
+		return nil, ErrAccessDenied
+	}
+
+	// the token is issued once, to whichever poll removes the login first
+	err = ua.db.DeleteDeviceAuthorization(ctx, a.ID)
+	switch err {
+	case nil:
+	case store.ErrDeviceAuthorizationNotFound:
+		return nil, ErrInvalidDeviceCode
+	default:
+		return nil, errors.Wrap(err, "useradm: failed to remove device authorization")
+	}
+
+	ctx = identity.WithContext(ctx, &identity.Identity{
+		Subject: a.UserID,
+		Tenant:  a.TenantID,
+	})
+
+	user, err := ua.db.GetUserById(ctx, a.UserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil || !user.IsActive() {
+		return nil, ErrAccessDenied
+	}
+
+	token, err := ua.issueUserToken(ctx, user, a.TenantID, a.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := ua.encodeToken(ctx, token)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to sign token")
+	}
+
+	log.FromContext(ctx).F(log.Ctx{
+		"client_id": a.ClientID,
+		"user_id":   user.ID,
+		"token_id":  token.Id,
+	}).Infof("user %s logged in on %s", user.ID, a.ClientID)
+
+	return &model.AccessToken{
+		AccessToken: raw,
+		TokenType:   model.TokenTypeBearer,
+		ExpiresIn:   token.Claims.ExpiresAt - token.Claims.IssuedAt,
+		Scope:       token.Claims.Scope,
+	}, nil
+}
+
+// randomUserCode returns a normalized user code; bytes beyond the largest
+// multiple of the charset's size are skipped, so that all the letters are
+// equally likely
+func randomUserCode() (string, error) {
+	n := len(model.UserCodeCharset)
+	limit := 256 - 256%n
+
+	code := make([]byte, 0, model.UserCodeLength)
+	b := make([]byte, 2*model.UserCodeLength)
+	for len(code) < model.UserCodeLength {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		for _, c := range b {
+			if int(c) < limit && len(code) < model.UserCodeLength {
+				code = append(code, model.UserCodeCharset[int(c)%n])
+			}
+		}
+	}
+	return string(code), nil
+}
@@ -0,0 +1,524 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/jwt"
+	mjwt "github.com/mendersoftware/useradm/jwt/mocks"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/scope"
+	"github.com/mendersoftware/useradm/store"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+var deviceConfig = Config{
+	ExpirationTime:           3600,
+	DeviceVerificationURL:    "https://mender.example.com/ui/device",
+	DeviceCodeExpirationTime: 600,
+	DeviceCodeInterval:       5,
+}
+
+func TestUserAdmStartDeviceAuthorization(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		config   Config
+		clientID string
+		scope    string
+
+		dbErrs []error
+
+		err error
+	}{
+		"ok": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			dbErrs:   []error{nil},
+		},
+		"ok, user code taken": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			scope:    scope.UsersRead,
+			dbErrs:   []error{store.ErrDuplicateUserCode, nil},
+		},
+		"error: disabled": {
+			clientID: "mender-cli",
+			err:      ErrDeviceFlowDisabled,
+		},
+		"error: no client id": {
+			config: deviceConfig,
+			err:    model.ErrInvalidDeviceClientID,
+		},
+		"error: invalid scope": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			scope:    "mender.foo",
+			err:      ErrInvalidScope,
+		},
+		"error: db": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			dbErrs:   []error{errors.New("db connection failed")},
+			err: errors.New("useradm: failed to save device authorization: " +
+				"db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			var saved *model.DeviceAuthorization
+			db := &mstore.DataStore{}
+			for _, err := range tc.dbErrs {
+				db.On("CreateDeviceAuthorization", ContextMatcher(),
+					mock.AnythingOfType("*model.DeviceAuthorization")).
+					Run(func(args mock.Arguments) {
+						saved = args.Get(1).(*model.DeviceAuthorization)
+					}).Return(err).Once()
+			}
+
+			useradm := NewUserAdm(nil, db, nil, tc.config)
+
+			rsp, err := useradm.StartDeviceAuthorization(context.Background(),
+				tc.clientID, tc.scope)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, rsp)
+				return
+			}
+			assert.NoError(t, err)
+			db.AssertExpectations(t)
+
+			assert.Equal(t, hashClientSecret(rsp.DeviceCode), saved.ID)
+			assert.Equal(t, model.FormatUserCode(saved.UserCode), rsp.UserCode)
+			assert.True(t, model.IsUserCode(rsp.UserCode))
+			assert.Equal(t, tc.clientID, saved.ClientID)
+			assert.Equal(t, tc.scope, saved.Scope)
+			assert.Equal(t, model.DeviceAuthorizationPending, saved.Status)
+			assert.Equal(t, deviceConfig.DeviceVerificationURL, rsp.VerificationURI)
+			assert.Equal(t,
+				deviceConfig.DeviceVerificationURL+"?user_code="+rsp.UserCode,
+				rsp.VerificationURIComplete)
+			assert.Equal(t, int64(600), rsp.ExpiresIn)
+			assert.Equal(t, 5, rsp.Interval)
+		})
+	}
+}
+
+func TestUserAdmVerifyDeviceAuthorization(t *testing.T) {
+	t.Parallel()
+
+	approve, deny := true, false
+	ident := &identity.Identity{Subject: "user-1", Tenant: "tenant-1"}
+
+	testCases := map[string]struct {
+		ident    *identity.Identity
+		approve  *bool
+		userCode string
+
+		dbAuth *model.DeviceAuthorization
+		dbUser *model.User
+
+		resolution *model.DeviceAuthorizationResolution
+		err        error
+	}{
+		"ok, approved": {
+			ident:    ident,
+			approve:  &approve,
+			userCode: "bcdf-ghjk",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        "device-1",
+				Status:    model.DeviceAuthorizationPending,
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			dbUser: &model.User{ID: "user-1"},
+			resolution: &model.DeviceAuthorizationResolution{
+				Status:   model.DeviceAuthorizationApproved,
+				TenantID: "tenant-1",
+				UserID:   "user-1",
+				Scope:    scope.All,
+			},
+		},
+		"ok, approved with the requested scope": {
+			ident:    ident,
+			approve:  &approve,
+			userCode: "BCDFGHJK",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        "device-1",
+				Scope:     scope.UsersRead,
+				Status:    model.DeviceAuthorizationPending,
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			dbUser: &model.User{ID: "user-1"},
+			resolution: &model.DeviceAuthorizationResolution{
+				Status:   model.DeviceAuthorizationApproved,
+				TenantID: "tenant-1",
+				UserID:   "user-1",
+				Scope:    scope.UsersRead,
+			},
+		},
+		"ok, denied": {
+			ident:    ident,
+			approve:  &deny,
+			userCode: "BCDF-GHJK",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        "device-1",
+				Status:    model.DeviceAuthorizationPending,
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			resolution: &model.DeviceAuthorizationResolution{
+				Status:   model.DeviceAuthorizationDenied,
+				TenantID: "tenant-1",
+				UserID:   "user-1",
+			},
+		},
+		"error: no identity": {
+			approve:  &approve,
+			userCode: "BCDF-GHJK",
+			err:      ErrUnauthorized,
+		},
+		"error: unknown code": {
+			ident:    ident,
+			approve:  &approve,
+			userCode: "BCDF-GHJK",
+			err:      store.ErrDeviceAuthorizationNotFound,
+		},
+		"error: already approved": {
+			ident:    ident,
+			approve:  &approve,
+			userCode: "BCDF-GHJK",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        "device-1",
+				Status:    model.DeviceAuthorizationApproved,
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			err: store.ErrDeviceAuthorizationNotFound,
+		},
+		"error: expired": {
+			ident:    ident,
+			approve:  &approve,
+			userCode: "BCDF-GHJK",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        "device-1",
+				Status:    model.DeviceAuthorizationPending,
+				ExpiresTs: time.Now().Add(-time.Second),
+			},
+			err: store.ErrDeviceAuthorizationNotFound,
+		},
+		"error: scope not granted to the user": {
+			ident:    ident,
+			approve:  &approve,
+			userCode: "BCDF-GHJK",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        "device-1",
+				Scope:     scope.Operator,
+				Status:    model.DeviceAuthorizationPending,
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			dbUser: &model.User{ID: "user-1"},
+			err:    ErrInvalidScope,
+		},
+		"error: user inactive": {
+			ident:    ident,
+			approve:  &approve,
+			userCode: "BCDF-GHJK",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        "device-1",
+				Status:    model.DeviceAuthorizationPending,
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			dbUser: &model.User{ID: "user-1", Status: model.UserStatusInactive},
+			err:    ErrUserInactive,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("GetDeviceAuthorizationByUserCode", ContextMatcher(), "BCDFGHJK").
+				Return(tc.dbAuth, nil)
+			db.On("GetUserById", ContextMatcher(), "user-1").Return(tc.dbUser, nil)
+			if tc.resolution != nil {
+				db.On("ResolveDeviceAuthorization", ContextMatcher(), "device-1",
+					*tc.resolution).Return(nil)
+			}
+
+			useradm := NewUserAdm(nil, db, nil, deviceConfig)
+
+			ctx := context.Background()
+			if tc.ident != nil {
+				ctx = identity.WithContext(ctx, tc.ident)
+			}
+			err := useradm.VerifyDeviceAuthorization(ctx, model.DeviceVerification{
+				UserCode: tc.userCode,
+				Approve:  tc.approve,
+			})
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.resolution != nil {
+				db.AssertCalled(t, "ResolveDeviceAuthorization", ContextMatcher(),
+					"device-1", *tc.resolution)
+			}
+		})
+	}
+}
+
+func TestUserAdmIssueDeviceToken(t *testing.T) {
+	t.Parallel()
+
+	polled := time.Now().Add(-time.Minute)
+	user := &model.User{ID: "user-1"}
+
+	testCases := map[string]struct {
+		config   Config
+		clientID string
+
+		dbAuth      *model.DeviceAuthorization
+		dbDeleteErr error
+		dbUser      *model.User
+		dbStatus    *model.TenantStatus
+
+		polledInterval int
+		deleted        bool
+		err            error
+	}{
+		"ok": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        hashClientSecret("device-code"),
+				ClientID:  "mender-cli",
+				Scope:     scope.UsersRead,
+				Status:    model.DeviceAuthorizationApproved,
+				TenantID:  "tenant-1",
+				UserID:    "user-1",
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			dbUser:  user,
+			deleted: true,
+		},
+		"error: disabled": {
+			clientID: "mender-cli",
+			err:      ErrDeviceFlowDisabled,
+		},
+		"error: unknown device code": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			err:      ErrInvalidDeviceCode,
+		},
+		"error: other client": {
+			config:   deviceConfig,
+			clientID: "other",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        hashClientSecret("device-code"),
+				ClientID:  "mender-cli",
+				Status:    model.DeviceAuthorizationApproved,
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			err: ErrInvalidDeviceCode,
+		},
+		"error: expired": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        hashClientSecret("device-code"),
+				ClientID:  "mender-cli",
+				Status:    model.DeviceAuthorizationPending,
+				ExpiresTs: time.Now().Add(-time.Second),
+			},
+			err: ErrExpiredDeviceCode,
+		},
+		"error: pending, first poll": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        hashClientSecret("device-code"),
+				ClientID:  "mender-cli",
+				Status:    model.DeviceAuthorizationPending,
+				Interval:  5,
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			polledInterval: 5,
+			err:            ErrAuthorizationPending,
+		},
+		"error: pending": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        hashClientSecret("device-code"),
+				ClientID:  "mender-cli",
+				Status:    model.DeviceAuthorizationPending,
+				Interval:  5,
+				PolledTs:  polled,
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			polledInterval: 5,
+			err:            ErrAuthorizationPending,
+		},
+		"error: polling too often": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        hashClientSecret("device-code"),
+				ClientID:  "mender-cli",
+				Status:    model.DeviceAuthorizationPending,
+				Interval:  5,
+				PolledTs:  time.Now().Add(-time.Second),
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			polledInterval: 10,
+			err:            ErrSlowDown,
+		},
+		"error: denied": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        hashClientSecret("device-code"),
+				ClientID:  "mender-cli",
+				Status:    model.DeviceAuthorizationDenied,
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			deleted: true,
+			err:     ErrAccessDenied,
+		},
+		"error: token already issued": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        hashClientSecret("device-code"),
+				ClientID:  "mender-cli",
+				Status:    model.DeviceAuthorizationApproved,
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			dbDeleteErr: store.ErrDeviceAuthorizationNotFound,
+			deleted:     true,
+			err:         ErrInvalidDeviceCode,
+		},
+		"error: user deactivated since": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        hashClientSecret("device-code"),
+				ClientID:  "mender-cli",
+				Status:    model.DeviceAuthorizationApproved,
+				TenantID:  "tenant-1",
+				UserID:    "user-1",
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			dbUser:  &model.User{ID: "user-1", Status: model.UserStatusInactive},
+			deleted: true,
+			err:     ErrAccessDenied,
+		},
+		"error: tenant suspended": {
+			config:   deviceConfig,
+			clientID: "mender-cli",
+			dbAuth: &model.DeviceAuthorization{
+				ID:        hashClientSecret("device-code"),
+				ClientID:  "mender-cli",
+				Status:    model.DeviceAuthorizationApproved,
+				TenantID:  "tenant-1",
+				UserID:    "user-1",
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			dbUser: user,
+			dbStatus: &model.TenantStatus{
+				Status:    model.TenantStatusSuspended,
+				UpdatedTs: time.Now(),
+			},
+			deleted: true,
+			err:     ErrTenantAccountSuspended,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			id := hashClientSecret("device-code")
+
+			db := &mstore.DataStore{}
+			db.On("GetDeviceAuthorization", ContextMatcher(), id).Return(tc.dbAuth, nil)
+			if tc.polledInterval != 0 {
+				db.On("SetDeviceAuthorizationPolled", ContextMatcher(), id,
+					mock.AnythingOfType("time.Time"), tc.polledInterval).Return(nil)
+			}
+			if tc.deleted {
+				db.On("DeleteDeviceAuthorization", ContextMatcher(), id).
+					Return(tc.dbDeleteErr)
+			}
+			db.On("GetUserById", ContextMatcher(), "user-1").Return(tc.dbUser, nil)
+			db.On("GetTenantStatus", ContextMatcher()).Return(tc.dbStatus, nil)
+			db.On("SaveToken", ContextMatcher(),
+				mock.AnythingOfType("*jwt.Token")).Return(nil)
+
+			var issued *jwt.Token
+			jwth := &mjwt.Handler{}
+			jwth.On("ToJWT", mock.AnythingOfType("*jwt.Token")).
+				Run(func(args mock.Arguments) {
+					issued = args.Get(0).(*jwt.Token)
+				}).Return("token", nil)
+
+			useradm := NewUserAdm(jwth, db, nil, tc.config)
+
+			token, err := useradm.IssueDeviceToken(context.Background(),
+				tc.clientID, "device-code")
+			if tc.polledInterval != 0 {
+				db.AssertCalled(t, "SetDeviceAuthorizationPolled", ContextMatcher(), id,
+					mock.AnythingOfType("time.Time"), tc.polledInterval)
+			}
+			if tc.deleted {
+				db.AssertCalled(t, "DeleteDeviceAuthorization", ContextMatcher(), id)
+			}
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, token)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, &model.AccessToken{
+				AccessToken: "token",
+				TokenType:   model.TokenTypeBearer,
+				ExpiresIn:   3600,
+				Scope:       scope.UsersRead,
+			}, token)
+			assert.Equal(t, "user-1", issued.Claims.Subject)
+			assert.Equal(t, "tenant-1", issued.Claims.Tenant)
+		})
+	}
+}
+
+func TestRandomUserCode(t *testing.T) {
+	t.Parallel()
+
+	for i := 0; i < 100; i++ {
+		code, err := randomUserCode()
+		assert.NoError(t, err)
+		assert.Len(t, code, model.UserCodeLength)
+		assert.Equal(t, strings.ToUpper(code), code)
+		assert.True(t, model.IsUserCode(code))
+	}
+}
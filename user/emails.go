@@ -0,0 +1,231 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/client/tenant"
+	"github.com/mendersoftware/useradm/mail"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+)
+
+const (
+	// time for which the code sent to an additional email address
+	// can be used to verify it
+	EmailVerificationTTL = 24 * time.Hour
+)
+
+var (
+	ErrInvalidVerificationCode  = errors.New("invalid or expired verification code")
+	ErrEmailNotVerified         = errors.New("email address is not verified")
+	ErrAdditionalEmailsDisabled = errors.New("additional email addresses are not enabled")
+)
+
+func (ua *UserAdm) AddUserEmail(ctx context.Context, id string,
+	e model.UserEmailNew) (*model.UserEmail, error) {
+	if !ua.config.AdditionalEmails || ua.mailer == nil {
+		return nil, ErrAdditionalEmailsDisabled
+	}
+
+	user, err := ua.db.GetUserById(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil {
+		return nil, store.ErrUserNotFound
+	}
+	if len(user.Emails) >= model.MaxUserEmails {
+		return nil, model.ErrTooManyEmails
+	}
+
+	ts, err := ua.tenantSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ts.CheckEmail(e.Email); err != nil {
+		return nil, err
+	}
+
+	code, err := newVerificationCode()
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to generate verification code")
+	}
+
+	email := &model.UserEmail{
+		Email:    model.NormalizeEmail(e.Email),
+		CodeHash: hashVerificationCode(code),
+	}
+	if err := ua.db.AddUserEmail(ctx, id, email); err != nil {
+		if err == store.ErrUserNotFound || err == store.ErrDuplicateEmail {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "useradm: failed to add email address")
+	}
+
+	ua.sendVerificationCode(ctx, user, email.Email, code)
+
+	added := *email
+	added.CodeHash = ""
+	return &added, nil
+}
+
+func (ua *UserAdm) VerifyUserEmail(ctx context.Context, id, email, code string) error {
+	email = model.NormalizeEmail(email)
+
+	e, err := ua.getUserEmail(ctx, id, email)
+	if err != nil {
+		return err
+	}
+	if e.Verified {
+		return nil
+	}
+
+	if e.CreatedTs == nil || time.Since(*e.CreatedTs) > EmailVerificationTTL ||
+		subtle.ConstantTimeCompare([]byte(e.CodeHash),
+			[]byte(hashVerificationCode(code))) != 1 {
+		return ErrInvalidVerificationCode
+	}
+
+	if err := ua.db.VerifyUserEmail(ctx, id, email); err != nil {
+		if err == store.ErrUserNotFound || err == store.ErrUserEmailNotFound {
+			return err
+		}
+		return errors.Wrap(err, "useradm: failed to verify email address")
+	}
+
+	return nil
+}
+
+func (ua *UserAdm) DeleteUserEmail(ctx context.Context, id, email string) error {
+	err := ua.db.DeleteUserEmail(ctx, id, model.NormalizeEmail(email))
+	if err != nil {
+		if err == store.ErrUserNotFound || err == store.ErrUserEmailNotFound {
+			return err
+		}
+		return errors.Wrap(err, "useradm: failed to remove email address")
+	}
+
+	return nil
+}
+
+func (ua *UserAdm) SetPrimaryEmail(ctx context.Context, id, email string) error {
+	email = model.NormalizeEmail(email)
+
+	user, err := ua.db.GetUserById(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil {
+		return store.ErrUserNotFound
+	}
+	e := user.FindEmail(email)
+	if e == nil {
+		return store.ErrUserEmailNotFound
+	}
+	if !e.Verified {
+		return ErrEmailNotVerified
+	}
+
+	if ua.verifyTenant {
+		ident := identity.FromContext(ctx)
+		err := ua.cTenant.UpdateUser(ctx,
+			ident.Tenant,
+			id,
+			&tenant.UserUpdate{
+				Name: email,
+			})
+
+		if err != nil {
+			switch err {
+			case tenant.ErrDuplicateUser:
+				return store.ErrDuplicateEmail
+			case tenant.ErrUserNotFound:
+				return store.ErrUserNotFound
+			default:
+				return errors.Wrap(err, "useradm: failed to update user in tenantadm")
+			}
+		}
+	}
+
+	if err := ua.db.SetPrimaryEmail(ctx, id, email); err != nil {
+		if err == store.ErrUserNotFound || err == store.ErrUserEmailNotFound ||
+			err == store.ErrDuplicateEmail {
+			return err
+		}
+		return errors.Wrap(err, "useradm: failed to set primary email address")
+	}
+
+	ua.notifyEmailChanged(ctx, id, user.Email, email)
+
+	return nil
+}
+
+// getUserEmail returns the additional email address of the user
+func (ua *UserAdm) getUserEmail(ctx context.Context, id, email string) (*model.UserEmail, error) {
+	user, err := ua.db.GetUserById(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil {
+		return nil, store.ErrUserNotFound
+	}
+
+	e := user.FindEmail(email)
+	if e == nil {
+		return nil, store.ErrUserEmailNotFound
+	}
+
+	return e, nil
+}
+
+// sendVerificationCode mails the code to the new address of the user;
+// it's sent regardless of the user's notification settings
+func (ua *UserAdm) sendVerificationCode(ctx context.Context, user *model.User,
+	email, code string) {
+	err := ua.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: subjectVerifyEmail,
+		Body:    fmt.Sprintf(bodyVerifyEmail, email, user.Email, code),
+	})
+	if err != nil {
+		log.FromContext(ctx).Errorf("failed to send verification code to user %s: %v",
+			user.ID, err)
+	}
+}
+
+func newVerificationCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashVerificationCode returns the form the code is stored in
+func hashVerificationCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,344 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/client/tenant"
+	mct "github.com/mendersoftware/useradm/client/tenant/mocks"
+	"github.com/mendersoftware/useradm/mail"
+	mmail "github.com/mendersoftware/useradm/mail/mocks"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmAddUserEmail(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		disabled bool
+		noMailer bool
+
+		dbUser     *model.User
+		dbErr      error
+		dbSettings map[string]interface{}
+
+		sent bool
+		err  error
+	}{
+		"ok": {
+			dbUser: &model.User{ID: "1", Email: "foo@bar.com"},
+			sent:   true,
+		},
+		"error: disabled": {
+			disabled: true,
+			dbUser:   &model.User{ID: "1", Email: "foo@bar.com"},
+			err:      ErrAdditionalEmailsDisabled,
+		},
+		"error: no mailer": {
+			noMailer: true,
+			dbUser:   &model.User{ID: "1", Email: "foo@bar.com"},
+			err:      ErrAdditionalEmailsDisabled,
+		},
+		"error: no user": {
+			err: store.ErrUserNotFound,
+		},
+		"error: too many emails": {
+			dbUser: &model.User{
+				ID:     "1",
+				Email:  "foo@bar.com",
+				Emails: make([]model.UserEmail, model.MaxUserEmails),
+			},
+			err: model.ErrTooManyEmails,
+		},
+		"error: domain not allowed": {
+			dbUser: &model.User{ID: "1", Email: "foo@bar.com"},
+			dbSettings: map[string]interface{}{
+				model.SettingAllowedEmailDomains: []interface{}{"bar.com"},
+			},
+			err: model.ErrEmailDomainNotAllowed,
+		},
+		"error: duplicate": {
+			dbUser: &model.User{ID: "1", Email: "foo@bar.com"},
+			dbErr:  store.ErrDuplicateEmail,
+			err:    store.ErrDuplicateEmail,
+		},
+		"error: db": {
+			dbUser: &model.User{ID: "1", Email: "foo@bar.com"},
+			dbErr:  errors.New("db connection failed"),
+			err:    errors.New("useradm: failed to add email address: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+
+			var stored *model.UserEmail
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ContextMatcher(), "1").Return(tc.dbUser, nil)
+			db.On("GetSettings", ContextMatcher()).Return(tc.dbSettings, nil)
+			db.On("AddUserEmail", ContextMatcher(), "1",
+				mock.AnythingOfType("*model.UserEmail")).
+				Run(func(args mock.Arguments) {
+					stored = args.Get(2).(*model.UserEmail)
+				}).
+				Return(tc.dbErr)
+
+			var sent []mail.Message
+			mailer := &mmail.Mailer{}
+			mailer.On("Send", ContextMatcher(), mock.AnythingOfType("mail.Message")).
+				Run(func(args mock.Arguments) {
+					sent = append(sent, args.Get(1).(mail.Message))
+				}).
+				Return(nil)
+
+			useradm := NewUserAdm(nil, db, nil, Config{AdditionalEmails: !tc.disabled})
+			if !tc.noMailer {
+				useradm = useradm.WithMailer(mailer)
+			}
+
+			// the email is stored normalized
+			e, err := useradm.AddUserEmail(ctx, "1", model.UserEmailNew{Email: "Foo@Baz.com"})
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "foo@baz.com", e.Email)
+				assert.False(t, e.Verified)
+				assert.Empty(t, e.CodeHash)
+				assert.NotEmpty(t, stored.CodeHash)
+			}
+
+			if tc.sent && assert.Len(t, sent, 1) {
+				assert.Equal(t, "foo@baz.com", sent[0].To)
+				assert.Equal(t, subjectVerifyEmail, sent[0].Subject)
+
+				// the mailed code verifies the address
+				code := strings.Fields(strings.Split(sent[0].Body, "\n\n")[2])
+				assert.Equal(t, stored.CodeHash, hashVerificationCode(code[0]))
+			} else {
+				assert.Empty(t, sent)
+			}
+		})
+	}
+}
+
+func TestUserAdmVerifyUserEmail(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	expired := now.Add(-EmailVerificationTTL - time.Minute)
+
+	testCases := map[string]struct {
+		email model.UserEmail
+		code  string
+
+		dbErr error
+
+		verified bool
+		err      error
+	}{
+		"ok": {
+			email: model.UserEmail{
+				Email:     "foo@baz.com",
+				CreatedTs: &now,
+				CodeHash:  hashVerificationCode("1234"),
+			},
+			code:     "1234",
+			verified: true,
+		},
+		"ok, verified already": {
+			email: model.UserEmail{
+				Email:    "foo@baz.com",
+				Verified: true,
+			},
+			code: "1234",
+		},
+		"error: wrong code": {
+			email: model.UserEmail{
+				Email:     "foo@baz.com",
+				CreatedTs: &now,
+				CodeHash:  hashVerificationCode("1234"),
+			},
+			code: "4321",
+			err:  ErrInvalidVerificationCode,
+		},
+		"error: expired": {
+			email: model.UserEmail{
+				Email:     "foo@baz.com",
+				CreatedTs: &expired,
+				CodeHash:  hashVerificationCode("1234"),
+			},
+			code: "1234",
+			err:  ErrInvalidVerificationCode,
+		},
+		"error: no such email": {
+			email: model.UserEmail{Email: "foo@qux.com"},
+			code:  "1234",
+			err:   store.ErrUserEmailNotFound,
+		},
+		"error: db": {
+			email: model.UserEmail{
+				Email:     "foo@baz.com",
+				CreatedTs: &now,
+				CodeHash:  hashVerificationCode("1234"),
+			},
+			code:     "1234",
+			dbErr:    errors.New("db connection failed"),
+			verified: true,
+			err:      errors.New("useradm: failed to verify email address: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ContextMatcher(), "1").
+				Return(&model.User{
+					ID:     "1",
+					Email:  "foo@bar.com",
+					Emails: []model.UserEmail{tc.email},
+				}, nil)
+			db.On("VerifyUserEmail", ContextMatcher(), "1", "foo@baz.com").
+				Return(tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			err := useradm.VerifyUserEmail(ctx, "1", "Foo@Baz.com", tc.code)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.verified {
+				db.AssertCalled(t, "VerifyUserEmail", ContextMatcher(), "1", "foo@baz.com")
+			} else {
+				db.AssertNotCalled(t, "VerifyUserEmail",
+					ContextMatcher(), mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestUserAdmSetPrimaryEmail(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		email model.UserEmail
+
+		verifyTenant bool
+		tenantErr    error
+
+		dbErr error
+
+		err error
+	}{
+		"ok": {
+			email: model.UserEmail{Email: "foo@baz.com", Verified: true},
+		},
+		"ok, multitenant": {
+			email:        model.UserEmail{Email: "foo@baz.com", Verified: true},
+			verifyTenant: true,
+		},
+		"error: not verified": {
+			email: model.UserEmail{Email: "foo@baz.com"},
+			err:   ErrEmailNotVerified,
+		},
+		"error: no such email": {
+			email: model.UserEmail{Email: "foo@qux.com", Verified: true},
+			err:   store.ErrUserEmailNotFound,
+		},
+		"error: multitenant, duplicate": {
+			email:        model.UserEmail{Email: "foo@baz.com", Verified: true},
+			verifyTenant: true,
+			tenantErr:    tenant.ErrDuplicateUser,
+			err:          store.ErrDuplicateEmail,
+		},
+		"error: db": {
+			email: model.UserEmail{Email: "foo@baz.com", Verified: true},
+			dbErr: errors.New("db connection failed"),
+			err: errors.New("useradm: failed to set primary email address: " +
+				"db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := identity.WithContext(context.Background(), &identity.Identity{
+				Tenant: "tenant-1",
+			})
+
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ContextMatcher(), "1").
+				Return(&model.User{
+					ID:     "1",
+					Email:  "foo@bar.com",
+					Emails: []model.UserEmail{tc.email},
+				}, nil)
+			db.On("SetPrimaryEmail", ContextMatcher(), "1", "foo@baz.com").
+				Return(tc.dbErr)
+			db.On("GetUserSettings", ContextMatcher(), "1").
+				Return(map[string]interface{}{}, nil)
+
+			var sent []mail.Message
+			mailer := &mmail.Mailer{}
+			mailer.On("Send", ContextMatcher(), mock.AnythingOfType("mail.Message")).
+				Run(func(args mock.Arguments) {
+					sent = append(sent, args.Get(1).(mail.Message))
+				}).
+				Return(nil)
+
+			useradm := NewUserAdm(nil, db, nil, Config{}).WithMailer(mailer)
+			if tc.verifyTenant {
+				cTenant := &mct.TenantVerifier{}
+				cTenant.On("UpdateUser", ContextMatcher(), "tenant-1", "1",
+					&tenant.UserUpdate{Name: "foo@baz.com"}).
+					Return(tc.tenantErr)
+				useradm = useradm.WithTenantVerification(cTenant)
+			}
+
+			err := useradm.SetPrimaryEmail(ctx, "1", "foo@baz.com")
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Empty(t, sent)
+			} else {
+				assert.NoError(t, err)
+				if assert.Len(t, sent, 1) {
+					assert.Equal(t, "foo@bar.com", sent[0].To)
+					assert.Equal(t, subjectEmailChanged, sent[0].Subject)
+				}
+			}
+		})
+	}
+}
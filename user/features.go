@@ -0,0 +1,53 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+func (ua *UserAdm) GetFeatures(ctx context.Context) (map[string]bool, error) {
+	overrides, err := ua.db.GetFeatures(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get features")
+	}
+
+	features := map[string]bool{}
+	for _, name := range ua.config.Features {
+		features[name] = true
+	}
+	for _, f := range overrides {
+		features[f.Name] = f.Enabled
+	}
+
+	return features, nil
+}
+
+func (ua *UserAdm) SetFeature(ctx context.Context, f model.Feature) error {
+	if err := ua.db.SetFeature(ctx, &f); err != nil {
+		return errors.Wrap(err, "useradm: failed to set feature")
+	}
+	return nil
+}
+
+func (ua *UserAdm) ResetFeature(ctx context.Context, name string) error {
+	if err := ua.db.DeleteFeature(ctx, name); err != nil {
+		return errors.Wrap(err, "useradm: failed to reset feature")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/model"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmGetFeatures(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		config     []string
+		dbFeatures []model.Feature
+		dbErr      error
+
+		features map[string]bool
+		err      error
+	}{
+		"ok, none": {
+			features: map[string]bool{},
+		},
+		"ok, configured": {
+			config:   []string{"foo", "bar"},
+			features: map[string]bool{"foo": true, "bar": true},
+		},
+		"ok, overrides": {
+			config: []string{"foo", "bar"},
+			dbFeatures: []model.Feature{
+				{Name: "bar", Enabled: false},
+				{Name: "baz", Enabled: true},
+			},
+			features: map[string]bool{"foo": true, "bar": false, "baz": true},
+		},
+		"error: db": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to get features: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetFeatures", ContextMatcher()).Return(tc.dbFeatures, tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{Features: tc.config})
+
+			features, err := useradm.GetFeatures(ctx)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.features, features)
+			}
+		})
+	}
+}
+
+func TestUserAdmSetFeature(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dbErr error
+		err   error
+	}{
+		"ok": {},
+		"error": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to set feature: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+			feature := model.Feature{Name: "foo", Enabled: true}
+
+			db := &mstore.DataStore{}
+			db.On("SetFeature", ContextMatcher(), &feature).Return(tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			err := useradm.SetFeature(ctx, feature)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			db.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+)
+
+func (ua *UserAdm) CreateGroup(ctx context.Context, g *model.Group) error {
+	if err := ua.checkCapability(ctx, model.CapabilityGroups); err != nil {
+		return err
+	}
+
+	g.ID = uuid.NewV4().String()
+
+	if err := ua.db.CreateGroup(ctx, g); err != nil {
+		if err == store.ErrDuplicateGroupName {
+			return err
+		}
+		return errors.Wrap(err, "useradm: failed to create group")
+	}
+
+	return nil
+}
+
+func (ua *UserAdm) GetGroups(ctx context.Context) ([]model.Group, error) {
+	groups, err := ua.db.GetGroups(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get groups")
+	}
+
+	return groups, nil
+}
+
+func (ua *UserAdm) GetGroup(ctx context.Context, id string) (*model.Group, error) {
+	group, err := ua.db.GetGroupById(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get group")
+	}
+
+	return group, nil
+}
+
+func (ua *UserAdm) DeleteGroup(ctx context.Context, id string) error {
+	if err := ua.db.DeleteGroup(ctx, id); err != nil {
+		return errors.Wrap(err, "useradm: failed to delete group")
+	}
+
+	return nil
+}
+
+func (ua *UserAdm) GetGroupMembers(ctx context.Context, id string) ([]model.User, error) {
+	if err := ua.checkGroupExists(ctx, id); err != nil {
+		return nil, err
+	}
+
+	users, err := ua.db.GetUsers(ctx, model.UserFilter{Group: id})
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get group members")
+	}
+
+	return users, nil
+}
+
+func (ua *UserAdm) AddGroupMember(ctx context.Context, groupID, userID string) error {
+	if err := ua.checkGroupExists(ctx, groupID); err != nil {
+		return err
+	}
+
+	if err := ua.db.AddUserToGroup(ctx, userID, groupID); err != nil {
+		if err == store.ErrUserNotFound {
+			return err
+		}
+		return errors.Wrap(err, "useradm: failed to add group member")
+	}
+
+	return nil
+}
+
+func (ua *UserAdm) RemoveGroupMember(ctx context.Context, groupID, userID string) error {
+	if err := ua.db.RemoveUserFromGroup(ctx, userID, groupID); err != nil {
+		if err == store.ErrUserNotFound {
+			return err
+		}
+		return errors.Wrap(err, "useradm: failed to remove group member")
+	}
+
+	return nil
+}
+
+func (ua *UserAdm) checkGroupExists(ctx context.Context, id string) error {
+	group, err := ua.db.GetGroupById(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get group")
+	}
+
+	if group == nil {
+		return store.ErrGroupNotFound
+	}
+
+	return nil
+}
+
+// groupNames returns the names of the user's groups, for use in tokens
+func (ua *UserAdm) groupNames(ctx context.Context, user *model.User) ([]string, error) {
+	if len(user.Groups) == 0 {
+		return nil, nil
+	}
+
+	groups, err := ua.db.GetGroupsByIds(ctx, user.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(groups))
+	for i, g := range groups {
+		names[i] = g.Name
+	}
+
+	return names, nil
+}
@@ -0,0 +1,241 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmCreateGroup(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dbErr error
+
+		err error
+	}{
+		"ok": {},
+		"error: duplicate name": {
+			dbErr: store.ErrDuplicateGroupName,
+			err:   store.ErrDuplicateGroupName,
+		},
+		"error: db": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to create group: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetPlan", ContextMatcher()).Return(nil, nil)
+			db.On("CreateGroup", ContextMatcher(),
+				mock.AnythingOfType("*model.Group")).
+				Return(tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			group := &model.Group{Name: "devops"}
+			err := useradm.CreateGroup(ctx, group)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, group.ID)
+			}
+		})
+	}
+}
+
+func TestUserAdmGetGroupMembers(t *testing.T) {
+	t.Parallel()
+
+	users := []model.User{
+		{
+			ID:     "user-1",
+			Email:  "foo@bar.com",
+			Groups: []string{"group-1"},
+		},
+	}
+
+	testCases := map[string]struct {
+		dbGroup    *model.Group
+		dbGroupErr error
+		dbUsers    []model.User
+		dbUsersErr error
+
+		users []model.User
+		err   error
+	}{
+		"ok": {
+			dbGroup: &model.Group{ID: "group-1", Name: "devops"},
+			dbUsers: users,
+			users:   users,
+		},
+		"error: group not found": {
+			err: store.ErrGroupNotFound,
+		},
+		"error: get group": {
+			dbGroupErr: errors.New("db connection failed"),
+			err:        errors.New("useradm: failed to get group: db connection failed"),
+		},
+		"error: get users": {
+			dbGroup:    &model.Group{ID: "group-1", Name: "devops"},
+			dbUsersErr: errors.New("db connection failed"),
+			err:        errors.New("useradm: failed to get group members: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetGroupById", ContextMatcher(), "group-1").
+				Return(tc.dbGroup, tc.dbGroupErr)
+			db.On("GetUsers", ContextMatcher(),
+				model.UserFilter{Group: "group-1"}).
+				Return(tc.dbUsers, tc.dbUsersErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			users, err := useradm.GetGroupMembers(ctx, "group-1")
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.users, users)
+			}
+		})
+	}
+}
+
+func TestUserAdmAddGroupMember(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dbGroup    *model.Group
+		dbGroupErr error
+		dbAddErr   error
+
+		err error
+	}{
+		"ok": {
+			dbGroup: &model.Group{ID: "group-1", Name: "devops"},
+		},
+		"error: group not found": {
+			err: store.ErrGroupNotFound,
+		},
+		"error: get group": {
+			dbGroupErr: errors.New("db connection failed"),
+			err:        errors.New("useradm: failed to get group: db connection failed"),
+		},
+		"error: user not found": {
+			dbGroup:  &model.Group{ID: "group-1", Name: "devops"},
+			dbAddErr: store.ErrUserNotFound,
+			err:      store.ErrUserNotFound,
+		},
+		"error: db": {
+			dbGroup:  &model.Group{ID: "group-1", Name: "devops"},
+			dbAddErr: errors.New("db connection failed"),
+			err:      errors.New("useradm: failed to add group member: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetGroupById", ContextMatcher(), "group-1").
+				Return(tc.dbGroup, tc.dbGroupErr)
+			db.On("AddUserToGroup", ContextMatcher(), "user-1", "group-1").
+				Return(tc.dbAddErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			err := useradm.AddGroupMember(ctx, "group-1", "user-1")
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				db.AssertCalled(t, "AddUserToGroup", ContextMatcher(),
+					"user-1", "group-1")
+			}
+		})
+	}
+}
+
+func TestUserAdmRemoveGroupMember(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dbErr error
+
+		err error
+	}{
+		"ok": {},
+		"error: user not found": {
+			dbErr: store.ErrUserNotFound,
+			err:   store.ErrUserNotFound,
+		},
+		"error: db": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to remove group member: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("RemoveUserFromGroup", ContextMatcher(), "user-1", "group-1").
+				Return(tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			err := useradm.RemoveGroupMember(ctx, "group-1", "user-1")
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
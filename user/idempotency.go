@@ -0,0 +1,101 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+)
+
+var (
+	ErrIdempotencyKeyInProgress = errors.New("a request with this Idempotency-Key " +
+		"is still in progress")
+	ErrIdempotencyKeyReused = errors.New("Idempotency-Key was already used " +
+		"for a different user")
+)
+
+func (ua *UserAdm) CreateUserOnce(ctx context.Context, key string,
+	u *model.User) (string, error) {
+	return ua.createUserOnce(ctx, key, u.Email, func() (string, error) {
+		err := ua.CreateUser(ctx, u)
+		return u.ID, err
+	})
+}
+
+func (ua *UserAdm) CreateUserInternalOnce(ctx context.Context, key string,
+	u *model.UserInternal) (string, error) {
+	return ua.createUserOnce(ctx, key, u.Email, func() (string, error) {
+		err := ua.CreateUserInternal(ctx, u)
+		return u.ID, err
+	})
+}
+
+// createUserOnce runs create at most once per idempotency key and returns
+// the ID of the created user; retries of a request get the user created
+// by the first one, without running create again
+func (ua *UserAdm) createUserOnce(ctx context.Context, key, email string,
+	create func() (string, error)) (string, error) {
+	if key == "" {
+		return create()
+	}
+
+	err := ua.db.CreateIdempotencyKey(ctx, &model.IdempotencyKey{
+		Key:       key,
+		Email:     email,
+		CreatedTs: time.Now().UTC(),
+	})
+	if err == store.ErrDuplicateIdempotencyKey {
+		k, err := ua.db.GetIdempotencyKey(ctx, key)
+		if err != nil {
+			return "", errors.Wrap(err, "useradm: failed to get idempotency key")
+		}
+
+		switch {
+		case k == nil || k.UserID == "":
+			// being created, or just expired
+			return "", ErrIdempotencyKeyInProgress
+		case k.Email != email:
+			return "", ErrIdempotencyKeyReused
+		default:
+			return k.UserID, nil
+		}
+	} else if err != nil {
+		return "", errors.Wrap(err, "useradm: failed to save idempotency key")
+	}
+
+	l := log.FromContext(ctx)
+
+	id, err := create()
+	if err != nil {
+		// the request failed, let the client retry it
+		if derr := ua.db.DeleteIdempotencyKey(ctx, key); derr != nil {
+			l.Errorf("failed to release idempotency key: %v", derr)
+		}
+		return "", err
+	}
+
+	// the user exists either way; the retries with the key are refused
+	// as in progress until the key expires
+	if err := ua.db.SetIdempotencyKeyUser(ctx, key, id); err != nil {
+		l.Errorf("failed to record user %s of idempotency key: %v", id, err)
+	}
+
+	return id, nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmCreateUserOnce(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		key string
+
+		createKeyErr error
+		existingKey  *model.IdempotencyKey
+		createErr    error
+		setUserErr   error
+
+		created  bool
+		released bool
+		id       string
+		err      error
+	}{
+		"ok": {
+			key:     "key-1",
+			created: true,
+		},
+		"ok, no key": {
+			created: true,
+		},
+		"ok, retried": {
+			key:          "key-1",
+			createKeyErr: store.ErrDuplicateIdempotencyKey,
+			existingKey: &model.IdempotencyKey{
+				Key:    "key-1",
+				Email:  "foo@foo.com",
+				UserID: "1234",
+			},
+			id: "1234",
+		},
+		"ok, the user is recorded for the key in vain": {
+			key:        "key-1",
+			setUserErr: errors.New("db connection failed"),
+			created:    true,
+		},
+		"error: in progress": {
+			key:          "key-1",
+			createKeyErr: store.ErrDuplicateIdempotencyKey,
+			existingKey: &model.IdempotencyKey{
+				Key:   "key-1",
+				Email: "foo@foo.com",
+			},
+			err: ErrIdempotencyKeyInProgress,
+		},
+		"error: used for another user": {
+			key:          "key-1",
+			createKeyErr: store.ErrDuplicateIdempotencyKey,
+			existingKey: &model.IdempotencyKey{
+				Key:    "key-1",
+				Email:  "bar@foo.com",
+				UserID: "1234",
+			},
+			err: ErrIdempotencyKeyReused,
+		},
+		"error: create failed": {
+			key:       "key-1",
+			createErr: store.ErrDuplicateEmail,
+			released:  true,
+			err:       store.ErrDuplicateEmail,
+		},
+		"error: db": {
+			key:          "key-1",
+			createKeyErr: errors.New("db connection failed"),
+			err: errors.New("useradm: failed to save idempotency key: " +
+				"db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("CreateIdempotencyKey", ContextMatcher(),
+				mock.MatchedBy(func(k *model.IdempotencyKey) bool {
+					return k.Key == tc.key && k.Email == "foo@foo.com"
+				})).
+				Return(tc.createKeyErr)
+			db.On("GetIdempotencyKey", ContextMatcher(), tc.key).
+				Return(tc.existingKey, nil)
+			db.On("SetIdempotencyKeyUser", ContextMatcher(), tc.key,
+				mock.AnythingOfType("string")).
+				Return(tc.setUserErr)
+			db.On("DeleteIdempotencyKey", ContextMatcher(), tc.key).Return(nil)
+			db.On("GetSettings", ContextMatcher()).
+				Return(map[string]interface{}{}, nil)
+			db.On("GetPlan", ContextMatcher()).Return(nil, nil)
+			db.On("CreateUser", ContextMatcher(), mock.AnythingOfType("*model.User")).
+				Return(tc.createErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			u := &model.User{Email: "foo@foo.com", Password: "correcthorsebatterystaple"}
+			id, err := useradm.CreateUserOnce(context.Background(), tc.key, u)
+
+			if tc.created {
+				db.AssertCalled(t, "CreateUser", ContextMatcher(), u)
+				tc.id = u.ID
+			} else if tc.createErr == nil {
+				db.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+			}
+			if tc.released {
+				db.AssertCalled(t, "DeleteIdempotencyKey", ContextMatcher(), tc.key)
+			} else {
+				db.AssertNotCalled(t, "DeleteIdempotencyKey", mock.Anything, mock.Anything)
+			}
+			if tc.created && tc.key != "" {
+				db.AssertCalled(t, "SetIdempotencyKeyUser", ContextMatcher(), tc.key, u.ID)
+			}
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Empty(t, id)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEmpty(t, id)
+			assert.Equal(t, tc.id, id)
+		})
+	}
+}
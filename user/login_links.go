@@ -0,0 +1,185 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/mail"
+	"github.com/mendersoftware/useradm/model"
+)
+
+// RequestLoginLink mails a login link to the user with the email, if the
+// user's tenant allows it, and no link was sent to the user in the last
+// model.LoginLinkResendInterval; nothing tells the caller whether the link
+// was sent, so that the users of the service can't be found out this way
+func (ua *UserAdm) RequestLoginLink(ctx context.Context, email string) error {
+	if ua.config.MagicLinkURL == "" || ua.mailer == nil {
+		return ErrMagicLinkDisabled
+	}
+
+	l := log.FromContext(ctx)
+
+	var tenantID string
+	if ua.verifyTenant {
+		tenant, err := ua.getTenant(ctx, email)
+		if err != nil {
+			return errors.Wrap(err, "failed to check user's tenant")
+		}
+		if tenant == nil {
+			return nil
+		}
+
+		tenantID = tenant.ID
+		ctx = identity.WithContext(ctx, &identity.Identity{Tenant: tenantID})
+
+		status := ua.syncTenantStatus(ctx, tenant.Status)
+		if err := ua.checkTenantStatus(ctx, status); err != nil {
+			l.Infof("login link not sent to a user of tenant %s: %v", tenantID, err)
+			return nil
+		}
+	}
+
+	email = model.NormalizeEmail(email)
+
+	ts, err := ua.tenantSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if !ts.MagicLinkLogin {
+		return nil
+	}
+
+	user, err := ua.getUserByLogin(ctx, email)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil || !user.IsActive() {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	latest, err := ua.db.GetLatestLoginLink(ctx, tenantID, user.ID)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get login link")
+	}
+	if latest != nil && now.Before(latest.ExpiresTs) &&
+		now.Before(latest.CreatedTs.Add(model.LoginLinkResendInterval)) {
+		l.F(log.Ctx{"user_id": user.ID}).
+			Infof("login link sent to user %s recently, not resending", user.ID)
+		return nil
+	}
+
+	code, err := randomHex(32)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to generate login link")
+	}
+
+	err = ua.db.SaveLoginLink(ctx, &model.LoginLink{
+		ID:        hashClientSecret(code),
+		TenantID:  tenantID,
+		UserID:    user.ID,
+		Email:     email,
+		CreatedTs: now,
+		ExpiresTs: now.Add(
+			time.Duration(ua.config.MagicLinkExpirationTime) * time.Second),
+	})
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to save login link")
+	}
+
+	link, err := url.Parse(ua.config.MagicLinkURL)
+	if err != nil {
+		return errors.Wrap(err, "useradm: invalid login link URL")
+	}
+	q := link.Query()
+	q.Set("code", code)
+	link.RawQuery = q.Encode()
+
+	err = ua.mailer.Send(ctx, mail.Message{
+		To:      email,
+		Subject: subjectLoginLink,
+		Body: fmt.Sprintf(bodyLoginLink, email, link.String(),
+			ua.config.MagicLinkExpirationTime/60),
+	})
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to send login link")
+	}
+
+	l.F(log.Ctx{"user_id": user.ID}).Infof("login link sent to user %s", user.ID)
+	return nil
+}
+
+// LoginWithLink logs the user in with the code of the login link; the
+// link works once, and only while the tenant allows the login links
+func (ua *UserAdm) LoginWithLink(ctx context.Context, code string,
+	info model.LoginInfo) (*jwt.Token, error) {
+	if ua.config.MagicLinkURL == "" {
+		return nil, ErrMagicLinkDisabled
+	}
+
+	link, err := ua.db.TakeLoginLink(ctx, hashClientSecret(code))
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get login link")
+	}
+	if link == nil || time.Now().After(link.ExpiresTs) {
+		return nil, ErrUnauthorized
+	}
+
+	ctx = identity.WithContext(ctx, &identity.Identity{
+		Subject: link.UserID,
+		Tenant:  link.TenantID,
+	})
+
+	if link.TenantID != "" {
+		status, err := ua.db.GetTenantStatus(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "useradm: failed to get tenant status")
+		}
+		if err := ua.checkTenantStatus(ctx, status); err != nil {
+			return nil, err
+		}
+	}
+
+	ts, err := ua.tenantSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !ts.MagicLinkLogin {
+		return nil, ErrUnauthorized
+	}
+
+	user, err := ua.db.GetUserById(ctx, link.UserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user")
+	}
+	// the address may have been removed since the link was sent
+	if user == nil || !user.CanLoginWith(link.Email) {
+		return nil, ErrUnauthorized
+	}
+	if !user.IsActive() {
+		ua.saveLoginEvent(ctx, user.ID, model.LoginMethodMagicLink, info, false)
+		return nil, ErrUserInactive
+	}
+
+	return ua.loginToken(ctx, user, link.TenantID, model.LoginMethodMagicLink, info)
+}
@@ -0,0 +1,328 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/client/tenant"
+	mct "github.com/mendersoftware/useradm/client/tenant/mocks"
+	"github.com/mendersoftware/useradm/mail"
+	mmail "github.com/mendersoftware/useradm/mail/mocks"
+	"github.com/mendersoftware/useradm/model"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+var magicLinkConfig = Config{
+	ExpirationTime:          3600,
+	MagicLinkURL:            "https://mender.example.com/ui/login",
+	MagicLinkExpirationTime: 900,
+}
+
+func TestUserAdmRequestLoginLink(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		config Config
+		email  string
+
+		tenant   *tenant.Tenant
+		settings map[string]interface{}
+		dbUser   *model.User
+		dbLatest *model.LoginLink
+
+		sent bool
+		err  error
+	}{
+		"ok": {
+			config:   magicLinkConfig,
+			email:    "Foo@Bar.com",
+			settings: map[string]interface{}{model.SettingMagicLinkLogin: true},
+			dbUser:   &model.User{ID: "user-1", Email: "foo@bar.com"},
+			sent:     true,
+		},
+		"ok, multitenant": {
+			config:   magicLinkConfig,
+			email:    "foo@bar.com",
+			tenant:   &tenant.Tenant{ID: "tenant-1", Status: model.TenantStatusActive},
+			settings: map[string]interface{}{model.SettingMagicLinkLogin: true},
+			dbUser:   &model.User{ID: "user-1", Email: "foo@bar.com"},
+			sent:     true,
+		},
+		"ok, resent after a while": {
+			config:   magicLinkConfig,
+			email:    "foo@bar.com",
+			settings: map[string]interface{}{model.SettingMagicLinkLogin: true},
+			dbUser:   &model.User{ID: "user-1", Email: "foo@bar.com"},
+			dbLatest: &model.LoginLink{
+				CreatedTs: time.Now().Add(-2 * model.LoginLinkResendInterval),
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+			sent: true,
+		},
+		"ok, not resent right away": {
+			config:   magicLinkConfig,
+			email:    "foo@bar.com",
+			settings: map[string]interface{}{model.SettingMagicLinkLogin: true},
+			dbUser:   &model.User{ID: "user-1", Email: "foo@bar.com"},
+			dbLatest: &model.LoginLink{
+				CreatedTs: time.Now(),
+				ExpiresTs: time.Now().Add(time.Minute),
+			},
+		},
+		"ok, not sent to an unknown user": {
+			config:   magicLinkConfig,
+			email:    "foo@bar.com",
+			settings: map[string]interface{}{model.SettingMagicLinkLogin: true},
+		},
+		"ok, not sent to an inactive user": {
+			config:   magicLinkConfig,
+			email:    "foo@bar.com",
+			settings: map[string]interface{}{model.SettingMagicLinkLogin: true},
+			dbUser: &model.User{ID: "user-1", Email: "foo@bar.com",
+				Status: model.UserStatusInactive},
+		},
+		"ok, not sent if the tenant doesn't allow it": {
+			config:   magicLinkConfig,
+			email:    "foo@bar.com",
+			settings: map[string]interface{}{},
+			dbUser:   &model.User{ID: "user-1", Email: "foo@bar.com"},
+		},
+		"ok, not sent to a suspended tenant": {
+			config:   magicLinkConfig,
+			email:    "foo@bar.com",
+			tenant:   &tenant.Tenant{ID: "tenant-1", Status: model.TenantStatusSuspended},
+			settings: map[string]interface{}{model.SettingMagicLinkLogin: true},
+			dbUser:   &model.User{ID: "user-1", Email: "foo@bar.com"},
+		},
+		"error: disabled": {
+			email: "foo@bar.com",
+			err:   ErrMagicLinkDisabled,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("GetSettings", ContextMatcher()).Return(tc.settings, nil)
+			db.On("GetUserByEmail", ContextMatcher(), "foo@bar.com").
+				Return(tc.dbUser, nil)
+			db.On("GetTenantStatus", ContextMatcher()).Return(nil, nil)
+			db.On("SetTenantStatus", ContextMatcher(),
+				mock.AnythingOfType("*model.TenantStatus")).Return(nil)
+			db.On("GetLatestLoginLink", ContextMatcher(), mock.AnythingOfType("string"),
+				"user-1").Return(tc.dbLatest, nil)
+			db.On("SaveLoginLink", ContextMatcher(),
+				mock.AnythingOfType("*model.LoginLink")).Return(nil)
+
+			var sent []mail.Message
+			mailer := &mmail.Mailer{}
+			mailer.On("Send", ContextMatcher(), mock.AnythingOfType("mail.Message")).
+				Run(func(args mock.Arguments) {
+					sent = append(sent, args.Get(1).(mail.Message))
+				}).
+				Return(nil)
+
+			useradm := NewUserAdm(nil, db, nil, tc.config).WithMailer(mailer)
+			if tc.tenant != nil {
+				cTenant := &mct.TenantVerifier{}
+				cTenant.On("GetTenant", ContextMatcher(), "foo@bar.com").
+					Return(tc.tenant, nil)
+				useradm = useradm.WithTenantVerification(cTenant)
+			}
+
+			err := useradm.RequestLoginLink(context.Background(), tc.email)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			if !tc.sent {
+				assert.Empty(t, sent)
+				db.AssertNotCalled(t, "SaveLoginLink", ContextMatcher(),
+					mock.AnythingOfType("*model.LoginLink"))
+				return
+			}
+
+			if !assert.Len(t, sent, 1) {
+				return
+			}
+			assert.Equal(t, "foo@bar.com", sent[0].To)
+			assert.Equal(t, subjectLoginLink, sent[0].Subject)
+
+			// the link carries the code, the store only its hash
+			link := db.Calls[len(db.Calls)-1].Arguments.Get(1).(*model.LoginLink)
+			start := strings.Index(sent[0].Body, magicLinkConfig.MagicLinkURL)
+			if !assert.True(t, start >= 0) {
+				return
+			}
+			raw := strings.Fields(sent[0].Body[start:])[0]
+			u, err := url.Parse(raw)
+			assert.NoError(t, err)
+			assert.Equal(t, hashClientSecret(u.Query().Get("code")), link.ID)
+			assert.Equal(t, "user-1", link.UserID)
+			assert.Equal(t, "foo@bar.com", link.Email)
+			if tc.tenant != nil {
+				assert.Equal(t, tc.tenant.ID, link.TenantID)
+			}
+			assert.WithinDuration(t, time.Now(), link.CreatedTs, time.Minute)
+			assert.WithinDuration(t, time.Now().Add(15*time.Minute), link.ExpiresTs,
+				time.Minute)
+		})
+	}
+}
+
+func TestUserAdmLoginWithLink(t *testing.T) {
+	t.Parallel()
+
+	link := &model.LoginLink{
+		ID:        hashClientSecret("code"),
+		TenantID:  "tenant-1",
+		UserID:    "user-1",
+		Email:     "foo@bar.com",
+		ExpiresTs: time.Now().Add(time.Minute),
+	}
+	settings := map[string]interface{}{model.SettingMagicLinkLogin: true}
+	user := &model.User{ID: "user-1", Email: "foo@bar.com"}
+	success, failure := true, false
+
+	testCases := map[string]struct {
+		config Config
+
+		dbLink    *model.LoginLink
+		dbLinkErr error
+		settings  map[string]interface{}
+		dbUser    *model.User
+		dbStatus  *model.TenantStatus
+
+		event *bool
+		err   error
+	}{
+		"ok": {
+			config:   magicLinkConfig,
+			dbLink:   link,
+			settings: settings,
+			dbUser:   user,
+			event:    &success,
+		},
+		"error: disabled": {
+			err: ErrMagicLinkDisabled,
+		},
+		"error: unknown code": {
+			config: magicLinkConfig,
+			err:    ErrUnauthorized,
+		},
+		"error: expired": {
+			config: magicLinkConfig,
+			dbLink: &model.LoginLink{
+				ID:        hashClientSecret("code"),
+				UserID:    "user-1",
+				Email:     "foo@bar.com",
+				ExpiresTs: time.Now().Add(-time.Second),
+			},
+			settings: settings,
+			dbUser:   user,
+			err:      ErrUnauthorized,
+		},
+		"error: no longer allowed by the tenant": {
+			config:   magicLinkConfig,
+			dbLink:   link,
+			settings: map[string]interface{}{},
+			dbUser:   user,
+			err:      ErrUnauthorized,
+		},
+		"error: email removed since": {
+			config:   magicLinkConfig,
+			dbLink:   link,
+			settings: settings,
+			dbUser:   &model.User{ID: "user-1", Email: "foo@baz.com"},
+			err:      ErrUnauthorized,
+		},
+		"error: user inactive": {
+			config:   magicLinkConfig,
+			dbLink:   link,
+			settings: settings,
+			dbUser: &model.User{ID: "user-1", Email: "foo@bar.com",
+				Status: model.UserStatusInactive},
+			event: &failure,
+			err:   ErrUserInactive,
+		},
+		"error: tenant suspended": {
+			config:   magicLinkConfig,
+			dbLink:   link,
+			settings: settings,
+			dbUser:   user,
+			dbStatus: &model.TenantStatus{
+				Status:    model.TenantStatusSuspended,
+				UpdatedTs: time.Now(),
+			},
+			err: ErrTenantAccountSuspended,
+		},
+		"error: db": {
+			config:    magicLinkConfig,
+			dbLinkErr: errors.New("db failed"),
+			err:       errors.New("useradm: failed to get login link: db failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("TakeLoginLink", ContextMatcher(), hashClientSecret("code")).
+				Return(tc.dbLink, tc.dbLinkErr)
+			db.On("GetTenantStatus", ContextMatcher()).Return(tc.dbStatus, nil)
+			db.On("GetSettings", ContextMatcher()).Return(tc.settings, nil)
+			db.On("GetUserById", ContextMatcher(), "user-1").Return(tc.dbUser, nil)
+			db.On("SaveToken", ContextMatcher(),
+				mock.AnythingOfType("*jwt.Token")).Return(nil)
+			db.On("SetLastLogin", ContextMatcher(), "user-1",
+				mock.AnythingOfType("time.Time"), "1.2.3.4").Return(nil)
+			db.On("SaveLoginEvent", ContextMatcher(),
+				mock.AnythingOfType("*model.LoginEvent")).Return(nil)
+
+			useradm := NewUserAdm(nil, db, nil, tc.config)
+
+			token, err := useradm.LoginWithLink(context.Background(), "code",
+				model.LoginInfo{IP: "1.2.3.4"})
+			if tc.event != nil {
+				db.AssertCalled(t, "SaveLoginEvent", ContextMatcher(),
+					mock.MatchedBy(func(e *model.LoginEvent) bool {
+						return e.UserID == "user-1" && e.Success == *tc.event &&
+							e.Method == model.LoginMethodMagicLink
+					}))
+			} else {
+				db.AssertNotCalled(t, "SaveLoginEvent", ContextMatcher(),
+					mock.AnythingOfType("*model.LoginEvent"))
+			}
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, token)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "user-1", token.Claims.Subject)
+			assert.Equal(t, "tenant-1", token.Claims.Tenant)
+		})
+	}
+}
@@ -23,13 +23,1311 @@ type App struct {
 	mock.Mock
 }
 
+// AddGroupMember provides a mock function with given fields: ctx, groupID, userID
+func (_m *App) AddGroupMember(ctx context.Context, groupID string, userID string) error {
+	ret := _m.Called(ctx, groupID, userID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, groupID, userID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// AddUserEmail provides a mock function with given fields: ctx, id, e
+func (_m *App) AddUserEmail(ctx context.Context, id string, e model.UserEmailNew) (*model.UserEmail, error) {
+	ret := _m.Called(ctx, id, e)
+
+	var r0 *model.UserEmail
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.UserEmailNew) *model.UserEmail); ok {
+		r0 = rf(ctx, id, e)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.UserEmail)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, model.UserEmailNew) error); ok {
+		r1 = rf(ctx, id, e)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// AuthorizeOIDC provides a mock function with given fields: ctx, r
+func (_m *App) AuthorizeOIDC(ctx context.Context, r model.AuthorizationRequest) (string, error) {
+	ret := _m.Called(ctx, r)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, model.AuthorizationRequest) string); ok {
+		r0 = rf(ctx, r)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.AuthorizationRequest) error); ok {
+		r1 = rf(ctx, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// BootstrapAdmin provides a mock function with given fields: ctx, email
+func (_m *App) BootstrapAdmin(ctx context.Context, email string) error {
+	ret := _m.Called(ctx, email)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, email)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CountUsers provides a mock function with given fields: ctx, fltr
+func (_m *App) CountUsers(ctx context.Context, fltr model.UserFilter) (int, error) {
+	ret := _m.Called(ctx, fltr)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, model.UserFilter) int); ok {
+		r0 = rf(ctx, fltr)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.UserFilter) error); ok {
+		r1 = rf(ctx, fltr)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateGroup provides a mock function with given fields: ctx, g
+func (_m *App) CreateGroup(ctx context.Context, g *model.Group) error {
+	ret := _m.Called(ctx, g)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.Group) error); ok {
+		r0 = rf(ctx, g)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateOAuthClient provides a mock function with given fields: ctx, c
+func (_m *App) CreateOAuthClient(ctx context.Context, c model.OAuthClientNew) (*model.OAuthClientCredentials, error) {
+	ret := _m.Called(ctx, c)
+
+	var r0 *model.OAuthClientCredentials
+	if rf, ok := ret.Get(0).(func(context.Context, model.OAuthClientNew) *model.OAuthClientCredentials); ok {
+		r0 = rf(ctx, c)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.OAuthClientCredentials)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.OAuthClientNew) error); ok {
+		r1 = rf(ctx, c)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateServiceAccount provides a mock function with given fields: ctx, a
+func (_m *App) CreateServiceAccount(ctx context.Context, a model.ServiceAccountNew) (*model.ServiceAccount, error) {
+	ret := _m.Called(ctx, a)
+
+	var r0 *model.ServiceAccount
+	if rf, ok := ret.Get(0).(func(context.Context, model.ServiceAccountNew) *model.ServiceAccount); ok {
+		r0 = rf(ctx, a)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.ServiceAccount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.ServiceAccountNew) error); ok {
+		r1 = rf(ctx, a)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // CreateTenant provides a mock function with given fields: ctx, tenant
 func (_m *App) CreateTenant(ctx context.Context, tenant model.NewTenant) error {
 	ret := _m.Called(ctx, tenant)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, model.NewTenant) error); ok {
-		r0 = rf(ctx, tenant)
+	if rf, ok := ret.Get(0).(func(context.Context, model.NewTenant) error); ok {
+		r0 = rf(ctx, tenant)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateUser provides a mock function with given fields: ctx, u
+func (_m *App) CreateUser(ctx context.Context, u *model.User) error {
+	ret := _m.Called(ctx, u)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.User) error); ok {
+		r0 = rf(ctx, u)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateUserInternal provides a mock function with given fields: ctx, u
+func (_m *App) CreateUserInternal(ctx context.Context, u *model.UserInternal) error {
+	ret := _m.Called(ctx, u)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *model.UserInternal) error); ok {
+		r0 = rf(ctx, u)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CreateUserInternalOnce provides a mock function with given fields: ctx, key, u
+func (_m *App) CreateUserInternalOnce(ctx context.Context, key string, u *model.UserInternal) (string, error) {
+	ret := _m.Called(ctx, key, u)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, *model.UserInternal) string); ok {
+		r0 = rf(ctx, key, u)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, *model.UserInternal) error); ok {
+		r1 = rf(ctx, key, u)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// CreateUserOnce provides a mock function with given fields: ctx, key, u
+func (_m *App) CreateUserOnce(ctx context.Context, key string, u *model.User) (string, error) {
+	ret := _m.Called(ctx, key, u)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, *model.User) string); ok {
+		r0 = rf(ctx, key, u)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, *model.User) error); ok {
+		r1 = rf(ctx, key, u)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteExpiredTokens provides a mock function with given fields: ctx
+func (_m *App) DeleteExpiredTokens(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteGroup provides a mock function with given fields: ctx, id
+func (_m *App) DeleteGroup(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteOAuthClient provides a mock function with given fields: ctx, id
+func (_m *App) DeleteOAuthClient(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteOwnUser provides a mock function with given fields: ctx, password
+func (_m *App) DeleteOwnUser(ctx context.Context, password string) error {
+	ret := _m.Called(ctx, password)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, password)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteServiceAccount provides a mock function with given fields: ctx, id
+func (_m *App) DeleteServiceAccount(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteSetting provides a mock function with given fields: ctx, key, ifMatch
+func (_m *App) DeleteSetting(ctx context.Context, key string, ifMatch []string) (string, error) {
+	ret := _m.Called(ctx, key, ifMatch)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) string); ok {
+		r0 = rf(ctx, key, ifMatch)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string) error); ok {
+		r1 = rf(ctx, key, ifMatch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteSettingsSchema provides a mock function with given fields: ctx
+func (_m *App) DeleteSettingsSchema(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteTenant provides a mock function with given fields: ctx, id
+func (_m *App) DeleteTenant(ctx context.Context, id string) error {
+	ret := _m.Called(ctx, id)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteTokens provides a mock function with given fields: ctx, tenantId, userId
+func (_m *App) DeleteTokens(ctx context.Context, tenantId string, userId string) error {
+	ret := _m.Called(ctx, tenantId, userId)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, tenantId, userId)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUser provides a mock function with given fields: ctx, id, ifMatch
+func (_m *App) DeleteUser(ctx context.Context, id string, ifMatch []string) error {
+	ret := _m.Called(ctx, id, ifMatch)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) error); ok {
+		r0 = rf(ctx, id, ifMatch)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DeleteUserEmail provides a mock function with given fields: ctx, id, email
+func (_m *App) DeleteUserEmail(ctx context.Context, id string, email string) error {
+	ret := _m.Called(ctx, id, email)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, id, email)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// DisableExpiredUsers provides a mock function with given fields: ctx
+func (_m *App) DisableExpiredUsers(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// EraseUser provides a mock function with given fields: ctx, id
+func (_m *App) EraseUser(ctx context.Context, id string) (*model.ErasureReceipt, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.ErasureReceipt
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.ErasureReceipt); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.ErasureReceipt)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ExchangeAuthCode provides a mock function with given fields: ctx, e
+func (_m *App) ExchangeAuthCode(ctx context.Context, e model.AuthCodeExchange) (*model.AccessToken, error) {
+	ret := _m.Called(ctx, e)
+
+	var r0 *model.AccessToken
+	if rf, ok := ret.Get(0).(func(context.Context, model.AuthCodeExchange) *model.AccessToken); ok {
+		r0 = rf(ctx, e)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.AccessToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.AuthCodeExchange) error); ok {
+		r1 = rf(ctx, e)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ExchangeToken provides a mock function with given fields: ctx, e
+func (_m *App) ExchangeToken(ctx context.Context, e model.TokenExchange) (*model.AccessToken, error) {
+	ret := _m.Called(ctx, e)
+
+	var r0 *model.AccessToken
+	if rf, ok := ret.Get(0).(func(context.Context, model.TokenExchange) *model.AccessToken); ok {
+		r0 = rf(ctx, e)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.AccessToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.TokenExchange) error); ok {
+		r1 = rf(ctx, e)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ForEachUser provides a mock function with given fields: ctx, fltr, fn
+func (_m *App) ForEachUser(ctx context.Context, fltr model.UserFilter, fn func(u *model.User) error) error {
+	ret := _m.Called(ctx, fltr, fn)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.UserFilter, func(u *model.User) error) error); ok {
+		r0 = rf(ctx, fltr, fn)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetDeviceAuthorization provides a mock function with given fields: ctx, userCode
+func (_m *App) GetDeviceAuthorization(ctx context.Context, userCode string) (*model.DeviceAuthorizationInfo, error) {
+	ret := _m.Called(ctx, userCode)
+
+	var r0 *model.DeviceAuthorizationInfo
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.DeviceAuthorizationInfo); ok {
+		r0 = rf(ctx, userCode)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeviceAuthorizationInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, userCode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetFeatures provides a mock function with given fields: ctx
+func (_m *App) GetFeatures(ctx context.Context) (map[string]bool, error) {
+	ret := _m.Called(ctx)
+
+	var r0 map[string]bool
+	if rf, ok := ret.Get(0).(func(context.Context) map[string]bool); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]bool)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroup provides a mock function with given fields: ctx, id
+func (_m *App) GetGroup(ctx context.Context, id string) (*model.Group, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.Group
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.Group); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.Group)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroupMembers provides a mock function with given fields: ctx, id
+func (_m *App) GetGroupMembers(ctx context.Context, id string) ([]model.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 []model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetGroups provides a mock function with given fields: ctx
+func (_m *App) GetGroups(ctx context.Context) ([]model.Group, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.Group
+	if rf, ok := ret.Get(0).(func(context.Context) []model.Group); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.Group)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetJobStatuses provides a mock function with given fields: ctx
+func (_m *App) GetJobStatuses(ctx context.Context) ([]model.JobStatus, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.JobStatus
+	if rf, ok := ret.Get(0).(func(context.Context) []model.JobStatus); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.JobStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLimitUsage provides a mock function with given fields: ctx, name
+func (_m *App) GetLimitUsage(ctx context.Context, name string) (*model.LimitUsage, error) {
+	ret := _m.Called(ctx, name)
+
+	var r0 *model.LimitUsage
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.LimitUsage); ok {
+		r0 = rf(ctx, name)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.LimitUsage)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, name)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetLoginHistory provides a mock function with given fields: ctx, id
+func (_m *App) GetLoginHistory(ctx context.Context, id string) ([]model.LoginEvent, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 []model.LoginEvent
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.LoginEvent); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.LoginEvent)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetMigrationProgress provides a mock function with given fields: ctx
+func (_m *App) GetMigrationProgress(ctx context.Context) (*model.MigrationProgress, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.MigrationProgress
+	if rf, ok := ret.Get(0).(func(context.Context) *model.MigrationProgress); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.MigrationProgress)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOAuthClients provides a mock function with given fields: ctx
+func (_m *App) GetOAuthClients(ctx context.Context) ([]model.OAuthClient, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.OAuthClient
+	if rf, ok := ret.Get(0).(func(context.Context) []model.OAuthClient); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.OAuthClient)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOIDCConfiguration provides a mock function with given fields: ctx
+func (_m *App) GetOIDCConfiguration(ctx context.Context) (*model.OIDCConfiguration, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.OIDCConfiguration
+	if rf, ok := ret.Get(0).(func(context.Context) *model.OIDCConfiguration); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.OIDCConfiguration)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOIDCKeys provides a mock function with given fields: ctx
+func (_m *App) GetOIDCKeys(ctx context.Context) (*jwt.JWKS, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *jwt.JWKS
+	if rf, ok := ret.Get(0).(func(context.Context) *jwt.JWKS); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*jwt.JWKS)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetOwnSettings provides a mock function with given fields: ctx
+func (_m *App) GetOwnSettings(ctx context.Context) (map[string]interface{}, error) {
+	ret := _m.Called(ctx)
+
+	var r0 map[string]interface{}
+	if rf, ok := ret.Get(0).(func(context.Context) map[string]interface{}); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]interface{})
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetPlan provides a mock function with given fields: ctx
+func (_m *App) GetPlan(ctx context.Context) (*model.PlanInfo, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.PlanInfo
+	if rf, ok := ret.Get(0).(func(context.Context) *model.PlanInfo); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.PlanInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetServiceAccount provides a mock function with given fields: ctx, id
+func (_m *App) GetServiceAccount(ctx context.Context, id string) (*model.ServiceAccount, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.ServiceAccount
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.ServiceAccount); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.ServiceAccount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetServiceAccounts provides a mock function with given fields: ctx
+func (_m *App) GetServiceAccounts(ctx context.Context) ([]model.ServiceAccount, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.ServiceAccount
+	if rf, ok := ret.Get(0).(func(context.Context) []model.ServiceAccount); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.ServiceAccount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSettings provides a mock function with given fields: ctx
+func (_m *App) GetSettings(ctx context.Context) (map[string]interface{}, error) {
+	ret := _m.Called(ctx)
+
+	var r0 map[string]interface{}
+	if rf, ok := ret.Get(0).(func(context.Context) map[string]interface{}); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]interface{})
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSettingsHistory provides a mock function with given fields: ctx
+func (_m *App) GetSettingsHistory(ctx context.Context) ([]model.SettingsVersion, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.SettingsVersion
+	if rf, ok := ret.Get(0).(func(context.Context) []model.SettingsVersion); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.SettingsVersion)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetSettingsSchema provides a mock function with given fields: ctx
+func (_m *App) GetSettingsSchema(ctx context.Context) (string, error) {
+	ret := _m.Called(ctx)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context) string); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTenantMigrationStatus provides a mock function with given fields: ctx, id
+func (_m *App) GetTenantMigrationStatus(ctx context.Context, id string) (*model.MigrationStatus, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.MigrationStatus
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.MigrationStatus); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.MigrationStatus)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetTokenRevocation provides a mock function with given fields: ctx, id
+func (_m *App) GetTokenRevocation(ctx context.Context, id string) (*model.TokenRevocation, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.TokenRevocation
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.TokenRevocation); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.TokenRevocation)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUser provides a mock function with given fields: ctx, id
+func (_m *App) GetUser(ctx context.Context, id string) (*model.User, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.User
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserCounts provides a mock function with given fields: ctx
+func (_m *App) GetUserCounts(ctx context.Context) ([]model.UserCount, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []model.UserCount
+	if rf, ok := ret.Get(0).(func(context.Context) []model.UserCount); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.UserCount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserData provides a mock function with given fields: ctx, id
+func (_m *App) GetUserData(ctx context.Context, id string) (*model.UserData, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 *model.UserData
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.UserData); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.UserData)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserInfo provides a mock function with given fields: ctx
+func (_m *App) GetUserInfo(ctx context.Context) (*model.UserInfo, error) {
+	ret := _m.Called(ctx)
+
+	var r0 *model.UserInfo
+	if rf, ok := ret.Get(0).(func(context.Context) *model.UserInfo); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.UserInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUserTokens provides a mock function with given fields: ctx, id
+func (_m *App) GetUserTokens(ctx context.Context, id string) ([]model.TokenInfo, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 []model.TokenInfo
+	if rf, ok := ret.Get(0).(func(context.Context, string) []model.TokenInfo); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.TokenInfo)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUsers provides a mock function with given fields: ctx, fltr
+func (_m *App) GetUsers(ctx context.Context, fltr model.UserFilter) ([]model.User, error) {
+	ret := _m.Called(ctx, fltr)
+
+	var r0 []model.User
+	if rf, ok := ret.Get(0).(func(context.Context, model.UserFilter) []model.User); ok {
+		r0 = rf(ctx, fltr)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]model.User)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.UserFilter) error); ok {
+		r1 = rf(ctx, fltr)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// GetUsersVersion provides a mock function with given fields: ctx, fltr
+func (_m *App) GetUsersVersion(ctx context.Context, fltr model.UserFilter) (*model.UsersVersion, error) {
+	ret := _m.Called(ctx, fltr)
+
+	var r0 *model.UsersVersion
+	if rf, ok := ret.Get(0).(func(context.Context, model.UserFilter) *model.UsersVersion); ok {
+		r0 = rf(ctx, fltr)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.UsersVersion)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, model.UserFilter) error); ok {
+		r1 = rf(ctx, fltr)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Impersonate provides a mock function with given fields: ctx, id, imp
+func (_m *App) Impersonate(ctx context.Context, id string, imp model.Impersonation) (*jwt.Token, error) {
+	ret := _m.Called(ctx, id, imp)
+
+	var r0 *jwt.Token
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.Impersonation) *jwt.Token); ok {
+		r0 = rf(ctx, id, imp)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*jwt.Token)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, model.Impersonation) error); ok {
+		r1 = rf(ctx, id, imp)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IssueClientToken provides a mock function with given fields: ctx, id, secret, scope
+func (_m *App) IssueClientToken(ctx context.Context, id string, secret string, scope string) (*jwt.Token, error) {
+	ret := _m.Called(ctx, id, secret, scope)
+
+	var r0 *jwt.Token
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) *jwt.Token); ok {
+		r0 = rf(ctx, id, secret, scope)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*jwt.Token)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) error); ok {
+		r1 = rf(ctx, id, secret, scope)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IssueDeviceToken provides a mock function with given fields: ctx, clientID, deviceCode
+func (_m *App) IssueDeviceToken(ctx context.Context, clientID string, deviceCode string) (*model.AccessToken, error) {
+	ret := _m.Called(ctx, clientID, deviceCode)
+
+	var r0 *model.AccessToken
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *model.AccessToken); ok {
+		r0 = rf(ctx, clientID, deviceCode)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.AccessToken)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, clientID, deviceCode)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// IssueServiceAccountToken provides a mock function with given fields: ctx, id, r
+func (_m *App) IssueServiceAccountToken(ctx context.Context, id string, r model.ServiceAccountTokenRequest) (*jwt.Token, error) {
+	ret := _m.Called(ctx, id, r)
+
+	var r0 *jwt.Token
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.ServiceAccountTokenRequest) *jwt.Token); ok {
+		r0 = rf(ctx, id, r)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*jwt.Token)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, model.ServiceAccountTokenRequest) error); ok {
+		r1 = rf(ctx, id, r)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Login provides a mock function with given fields: ctx, login, pass, info
+func (_m *App) Login(ctx context.Context, login string, pass string, info model.LoginInfo) (*jwt.Token, error) {
+	ret := _m.Called(ctx, login, pass, info)
+
+	var r0 *jwt.Token
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, model.LoginInfo) *jwt.Token); ok {
+		r0 = rf(ctx, login, pass, info)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*jwt.Token)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, model.LoginInfo) error); ok {
+		r1 = rf(ctx, login, pass, info)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LoginWithLink provides a mock function with given fields: ctx, code, info
+func (_m *App) LoginWithLink(ctx context.Context, code string, info model.LoginInfo) (*jwt.Token, error) {
+	ret := _m.Called(ctx, code, info)
+
+	var r0 *jwt.Token
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.LoginInfo) *jwt.Token); ok {
+		r0 = rf(ctx, code, info)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*jwt.Token)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, model.LoginInfo) error); ok {
+		r1 = rf(ctx, code, info)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// LookupUser provides a mock function with given fields: ctx, login
+func (_m *App) LookupUser(ctx context.Context, login string) (*model.UserLookup, error) {
+	ret := _m.Called(ctx, login)
+
+	var r0 *model.UserLookup
+	if rf, ok := ret.Get(0).(func(context.Context, string) *model.UserLookup); ok {
+		r0 = rf(ctx, login)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.UserLookup)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, login)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ProcessTokenRevocations provides a mock function with given fields: ctx
+func (_m *App) ProcessTokenRevocations(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -37,13 +1335,13 @@ func (_m *App) CreateTenant(ctx context.Context, tenant model.NewTenant) error {
 	return r0
 }
 
-// CreateUser provides a mock function with given fields: ctx, u
-func (_m *App) CreateUser(ctx context.Context, u *model.User) error {
-	ret := _m.Called(ctx, u)
+// PurgeDeletedUsers provides a mock function with given fields: ctx
+func (_m *App) PurgeDeletedUsers(ctx context.Context) error {
+	ret := _m.Called(ctx)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, *model.User) error); ok {
-		r0 = rf(ctx, u)
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -51,13 +1349,13 @@ func (_m *App) CreateUser(ctx context.Context, u *model.User) error {
 	return r0
 }
 
-// CreateUserInternal provides a mock function with given fields: ctx, u
-func (_m *App) CreateUserInternal(ctx context.Context, u *model.UserInternal) error {
-	ret := _m.Called(ctx, u)
+// ReconcilePendingUsers provides a mock function with given fields: ctx
+func (_m *App) ReconcilePendingUsers(ctx context.Context) error {
+	ret := _m.Called(ctx)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, *model.UserInternal) error); ok {
-		r0 = rf(ctx, u)
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -65,13 +1363,27 @@ func (_m *App) CreateUserInternal(ctx context.Context, u *model.UserInternal) er
 	return r0
 }
 
-// DeleteTokens provides a mock function with given fields: ctx, tenantId, userId
-func (_m *App) DeleteTokens(ctx context.Context, tenantId string, userId string) error {
-	ret := _m.Called(ctx, tenantId, userId)
+// RemoveGroupMember provides a mock function with given fields: ctx, groupID, userID
+func (_m *App) RemoveGroupMember(ctx context.Context, groupID string, userID string) error {
+	ret := _m.Called(ctx, groupID, userID)
 
 	var r0 error
 	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
-		r0 = rf(ctx, tenantId, userId)
+		r0 = rf(ctx, groupID, userID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RequestLoginLink provides a mock function with given fields: ctx, email
+func (_m *App) RequestLoginLink(ctx context.Context, email string) error {
+	ret := _m.Called(ctx, email)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, email)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -79,8 +1391,22 @@ func (_m *App) DeleteTokens(ctx context.Context, tenantId string, userId string)
 	return r0
 }
 
-// DeleteUser provides a mock function with given fields: ctx, id
-func (_m *App) DeleteUser(ctx context.Context, id string) error {
+// ResetFeature provides a mock function with given fields: ctx, name
+func (_m *App) ResetFeature(ctx context.Context, name string) error {
+	ret := _m.Called(ctx, name)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, name)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RestoreUser provides a mock function with given fields: ctx, id
+func (_m *App) RestoreUser(ctx context.Context, id string) error {
 	ret := _m.Called(ctx, id)
 
 	var r0 error
@@ -93,22 +1419,36 @@ func (_m *App) DeleteUser(ctx context.Context, id string) error {
 	return r0
 }
 
-// GetUser provides a mock function with given fields: ctx, id
-func (_m *App) GetUser(ctx context.Context, id string) (*model.User, error) {
+// RevokeServiceAccountTokens provides a mock function with given fields: ctx, id
+func (_m *App) RevokeServiceAccountTokens(ctx context.Context, id string) error {
 	ret := _m.Called(ctx, id)
 
-	var r0 *model.User
-	if rf, ok := ret.Get(0).(func(context.Context, string) *model.User); ok {
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
 		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RevokeTokens provides a mock function with given fields: ctx, tenantId, userId
+func (_m *App) RevokeTokens(ctx context.Context, tenantId string, userId string) (*model.TokenRevocation, error) {
+	ret := _m.Called(ctx, tenantId, userId)
+
+	var r0 *model.TokenRevocation
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *model.TokenRevocation); ok {
+		r0 = rf(ctx, tenantId, userId)
 	} else {
 		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*model.User)
+			r0 = ret.Get(0).(*model.TokenRevocation)
 		}
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
-		r1 = rf(ctx, id)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, tenantId, userId)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -116,22 +1456,20 @@ func (_m *App) GetUser(ctx context.Context, id string) (*model.User, error) {
 	return r0, r1
 }
 
-// GetUsers provides a mock function with given fields: ctx
-func (_m *App) GetUsers(ctx context.Context) ([]model.User, error) {
-	ret := _m.Called(ctx)
+// RollbackSettings provides a mock function with given fields: ctx, etag, ifMatch
+func (_m *App) RollbackSettings(ctx context.Context, etag string, ifMatch []string) (string, error) {
+	ret := _m.Called(ctx, etag, ifMatch)
 
-	var r0 []model.User
-	if rf, ok := ret.Get(0).(func(context.Context) []model.User); ok {
-		r0 = rf(ctx)
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, []string) string); ok {
+		r0 = rf(ctx, etag, ifMatch)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).([]model.User)
-		}
+		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
+	if rf, ok := ret.Get(1).(func(context.Context, string, []string) error); ok {
+		r1 = rf(ctx, etag, ifMatch)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -139,22 +1477,55 @@ func (_m *App) GetUsers(ctx context.Context) ([]model.User, error) {
 	return r0, r1
 }
 
-// Login provides a mock function with given fields: ctx, email, pass
-func (_m *App) Login(ctx context.Context, email string, pass string) (*jwt.Token, error) {
-	ret := _m.Called(ctx, email, pass)
+// SaveOwnSettings provides a mock function with given fields: ctx, s
+func (_m *App) SaveOwnSettings(ctx context.Context, s map[string]interface{}) error {
+	ret := _m.Called(ctx, s)
 
-	var r0 *jwt.Token
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) *jwt.Token); ok {
-		r0 = rf(ctx, email, pass)
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]interface{}) error); ok {
+		r0 = rf(ctx, s)
 	} else {
-		if ret.Get(0) != nil {
-			r0 = ret.Get(0).(*jwt.Token)
-		}
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SaveSetting provides a mock function with given fields: ctx, key, value, ifMatch
+func (_m *App) SaveSetting(ctx context.Context, key string, value interface{}, ifMatch []string) (string, error) {
+	ret := _m.Called(ctx, key, value, ifMatch)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, string, interface{}, []string) string); ok {
+		r0 = rf(ctx, key, value, ifMatch)
+	} else {
+		r0 = ret.Get(0).(string)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
-		r1 = rf(ctx, email, pass)
+	if rf, ok := ret.Get(1).(func(context.Context, string, interface{}, []string) error); ok {
+		r1 = rf(ctx, key, value, ifMatch)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// SaveSettings provides a mock function with given fields: ctx, s, ifMatch
+func (_m *App) SaveSettings(ctx context.Context, s map[string]interface{}, ifMatch []string) (string, error) {
+	ret := _m.Called(ctx, s, ifMatch)
+
+	var r0 string
+	if rf, ok := ret.Get(0).(func(context.Context, map[string]interface{}, []string) string); ok {
+		r0 = rf(ctx, s, ifMatch)
+	} else {
+		r0 = ret.Get(0).(string)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, map[string]interface{}, []string) error); ok {
+		r1 = rf(ctx, s, ifMatch)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -162,6 +1533,48 @@ func (_m *App) Login(ctx context.Context, email string, pass string) (*jwt.Token
 	return r0, r1
 }
 
+// SaveSettingsSchema provides a mock function with given fields: ctx, s
+func (_m *App) SaveSettingsSchema(ctx context.Context, s string) error {
+	ret := _m.Called(ctx, s)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, s)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetFeature provides a mock function with given fields: ctx, f
+func (_m *App) SetFeature(ctx context.Context, f model.Feature) error {
+	ret := _m.Called(ctx, f)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.Feature) error); ok {
+		r0 = rf(ctx, f)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetLimit provides a mock function with given fields: ctx, l
+func (_m *App) SetLimit(ctx context.Context, l model.Limit) error {
+	ret := _m.Called(ctx, l)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.Limit) error); ok {
+		r0 = rf(ctx, l)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SetPassword provides a mock function with given fields: ctx, u
 func (_m *App) SetPassword(ctx context.Context, u model.UserUpdate) error {
 	ret := _m.Called(ctx, u)
@@ -176,6 +1589,48 @@ func (_m *App) SetPassword(ctx context.Context, u model.UserUpdate) error {
 	return r0
 }
 
+// SetPlan provides a mock function with given fields: ctx, p
+func (_m *App) SetPlan(ctx context.Context, p model.Plan) error {
+	ret := _m.Called(ctx, p)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.Plan) error); ok {
+		r0 = rf(ctx, p)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetPrimaryEmail provides a mock function with given fields: ctx, id, email
+func (_m *App) SetPrimaryEmail(ctx context.Context, id string, email string) error {
+	ret := _m.Called(ctx, id, email)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, id, email)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// SetTenantStatus provides a mock function with given fields: ctx, status
+func (_m *App) SetTenantStatus(ctx context.Context, status string) error {
+	ret := _m.Called(ctx, status)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) error); ok {
+		r0 = rf(ctx, status)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // SignToken provides a mock function with given fields: ctx, t
 func (_m *App) SignToken(ctx context.Context, t *jwt.Token) (string, error) {
 	ret := _m.Called(ctx, t)
@@ -197,6 +1652,52 @@ func (_m *App) SignToken(ctx context.Context, t *jwt.Token) (string, error) {
 	return r0, r1
 }
 
+// StartDeviceAuthorization provides a mock function with given fields: ctx, clientID, scope
+func (_m *App) StartDeviceAuthorization(ctx context.Context, clientID string, scope string) (*model.DeviceAuthorizationResponse, error) {
+	ret := _m.Called(ctx, clientID, scope)
+
+	var r0 *model.DeviceAuthorizationResponse
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) *model.DeviceAuthorizationResponse); ok {
+		r0 = rf(ctx, clientID, scope)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.DeviceAuthorizationResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, clientID, scope)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateServiceAccount provides a mock function with given fields: ctx, id, u
+func (_m *App) UpdateServiceAccount(ctx context.Context, id string, u model.ServiceAccountUpdate) (*model.ServiceAccount, error) {
+	ret := _m.Called(ctx, id, u)
+
+	var r0 *model.ServiceAccount
+	if rf, ok := ret.Get(0).(func(context.Context, string, model.ServiceAccountUpdate) *model.ServiceAccount); ok {
+		r0 = rf(ctx, id, u)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*model.ServiceAccount)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, model.ServiceAccountUpdate) error); ok {
+		r1 = rf(ctx, id, u)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UpdateUser provides a mock function with given fields: ctx, id, u
 func (_m *App) UpdateUser(ctx context.Context, id string, u *model.UserUpdate) error {
 	ret := _m.Called(ctx, id, u)
@@ -224,3 +1725,31 @@ func (_m *App) Verify(ctx context.Context, token *jwt.Token) error {
 
 	return r0
 }
+
+// VerifyDeviceAuthorization provides a mock function with given fields: ctx, v
+func (_m *App) VerifyDeviceAuthorization(ctx context.Context, v model.DeviceVerification) error {
+	ret := _m.Called(ctx, v)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, model.DeviceVerification) error); ok {
+		r0 = rf(ctx, v)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// VerifyUserEmail provides a mock function with given fields: ctx, id, email, code
+func (_m *App) VerifyUserEmail(ctx context.Context, id string, email string, code string) error {
+	ret := _m.Called(ctx, id, email, code)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) error); ok {
+		r0 = rf(ctx, id, email, code)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
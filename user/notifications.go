@@ -0,0 +1,151 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+
+	"github.com/mendersoftware/useradm/mail"
+	"github.com/mendersoftware/useradm/model"
+)
+
+const (
+	// user settings key opting the user out of email notifications
+	SettingNotificationsOptOut = "email_notifications_opt_out"
+
+	subjectPasswordChanged = "Your password was changed"
+	bodyPasswordChanged    = "The password of your account %s was changed.\n\n" +
+		"If you did not make this change, contact your administrator immediately.\n"
+
+	subjectEmailChanged = "Your email address was changed"
+	bodyEmailChanged    = "The email address of your account was changed from %s to %s.\n\n" +
+		"If you did not make this change, contact your administrator immediately.\n"
+
+	subjectVerifyEmail = "Verify your email address"
+	bodyVerifyEmail    = "The email address %s was added to your account %s.\n\n" +
+		"Use the following code to verify it:\n\n%s\n\n" +
+		"The code is valid for 24 hours. If you did not make this change, " +
+		"ignore this message.\n"
+
+	subjectNewDeviceLogin = "New sign-in to your account"
+	bodyNewDeviceLogin    = "Your account %s was used to sign in from a new device.\n\n" +
+		"Time: %s\nIP address: %s\nUser agent: %s\n\n" +
+		"If this wasn't you, change your password immediately.\n"
+
+	subjectLoginLink = "Your login link"
+	bodyLoginLink    = "Use the following link to log in to your account %s:\n\n%s\n\n" +
+		"The link is valid for %d minutes and works once. If you did not " +
+		"ask for it, ignore this message.\n"
+
+	subjectLoginOTP = "Your login code"
+	bodyLoginOTP    = "Use the following code to complete the login to your account %s:\n\n%s\n\n" +
+		"The code is valid for %d minutes. If you did not try to log in, " +
+		"change your password immediately.\n"
+	smsLoginOTP = "Your Mender login code is %s, valid for %d minutes."
+
+	subjectBootstrapAdmin = "Your administrator account was created"
+	bodyBootstrapAdmin    = "The administrator account %s was created.\n\n" +
+		"Log in with the following password and change it right away:\n\n%s\n"
+
+	subjectTenantInvitation = "Your organization was created"
+	bodyTenantInvitation    = "Your organization was created, with the " +
+		"administrator account %s.\n\n" +
+		"Log in with the following password and change it right away:\n\n%s\n"
+)
+
+func (ua *UserAdm) WithMailer(m mail.Mailer) *UserAdm {
+	ua.mailer = m
+	return ua
+}
+
+// notify sends a notification email about a change to the user's account,
+// unless the user opted out; failures are only logged
+func (ua *UserAdm) notify(ctx context.Context, userID, to, subject, body string) {
+	if ua.mailer == nil {
+		return
+	}
+
+	l := log.FromContext(ctx)
+
+	settings, err := ua.db.GetUserSettings(ctx, userID)
+	if err != nil {
+		l.Errorf("failed to check notification settings of user %s: %v", userID, err)
+		return
+	}
+
+	if optOut, _ := settings[SettingNotificationsOptOut].(bool); optOut {
+		return
+	}
+
+	err = ua.mailer.Send(ctx, mail.Message{
+		To:      to,
+		Subject: subject,
+		Body:    body,
+	})
+	if err != nil {
+		l.Errorf("failed to send notification to user %s: %v", userID, err)
+	}
+}
+
+func (ua *UserAdm) notifyPasswordChanged(ctx context.Context, userID, email string) {
+	ua.notify(ctx, userID, email, subjectPasswordChanged,
+		fmt.Sprintf(bodyPasswordChanged, email))
+}
+
+func (ua *UserAdm) notifyEmailChanged(ctx context.Context, userID, oldEmail, newEmail string) {
+	ua.notify(ctx, userID, oldEmail, subjectEmailChanged,
+		fmt.Sprintf(bodyEmailChanged, oldEmail, newEmail))
+}
+
+// notifyNewDeviceLogin notifies the user about a successful login, already
+// saved in the login history, if none of the other successful logins came
+// from the same IP and user agent
+func (ua *UserAdm) notifyNewDeviceLogin(ctx context.Context, user *model.User,
+	info model.LoginInfo) {
+	if ua.mailer == nil {
+		return
+	}
+
+	events, err := ua.db.GetLoginEvents(ctx, user.ID)
+	if err != nil {
+		log.FromContext(ctx).Errorf("failed to get login history of user %s: %v",
+			user.ID, err)
+		return
+	}
+
+	same, other := 0, 0
+	for _, e := range events {
+		if !e.Success {
+			continue
+		}
+		if e.IP == info.IP && e.UserAgent == info.UserAgent {
+			same++
+		} else {
+			other++
+		}
+	}
+	// the very first login is not reported, nor the ones from a device
+	// which logged in before this login
+	if other == 0 || same > 1 {
+		return
+	}
+
+	ua.notify(ctx, user.ID, user.Email, subjectNewDeviceLogin,
+		fmt.Sprintf(bodyNewDeviceLogin, user.Email,
+			time.Now().UTC().Format(time.RFC1123), info.IP, info.UserAgent))
+}
@@ -0,0 +1,231 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/mail"
+	mmail "github.com/mendersoftware/useradm/mail/mocks"
+	"github.com/mendersoftware/useradm/model"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmUpdateUserNotifications(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		update   model.UserUpdate
+		settings map[string]interface{}
+
+		messages []mail.Message
+	}{
+		"password change": {
+			update: model.UserUpdate{Password: "correcthorsebatterystaple"},
+			messages: []mail.Message{
+				{To: "foo@bar.com", Subject: subjectPasswordChanged},
+			},
+		},
+		"email change": {
+			update: model.UserUpdate{Email: "baz@bar.com"},
+			messages: []mail.Message{
+				{To: "foo@bar.com", Subject: subjectEmailChanged},
+			},
+		},
+		"email and password change": {
+			update: model.UserUpdate{
+				Email:    "baz@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+			messages: []mail.Message{
+				{To: "foo@bar.com", Subject: subjectEmailChanged},
+				{To: "baz@bar.com", Subject: subjectPasswordChanged},
+			},
+		},
+		"status change": {
+			update: model.UserUpdate{Status: model.UserStatusActive},
+		},
+		"password change, opted out": {
+			update: model.UserUpdate{Password: "correcthorsebatterystaple"},
+			settings: map[string]interface{}{
+				SettingNotificationsOptOut: true,
+			},
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ContextMatcher(), "1234").
+				Return(&model.User{ID: "1234", Email: "foo@bar.com"}, nil)
+			db.On("UpdateUser", ContextMatcher(), "1234",
+				mock.AnythingOfType("*model.UserUpdate")).
+				Return(nil)
+			settings := tc.settings
+			if settings == nil {
+				settings = map[string]interface{}{}
+			}
+			db.On("GetSettings", ContextMatcher()).
+				Return(map[string]interface{}{}, nil)
+			db.On("GetUserSettings", ContextMatcher(), "1234").Return(settings, nil)
+
+			var sent []mail.Message
+			mailer := &mmail.Mailer{}
+			mailer.On("Send", ContextMatcher(), mock.AnythingOfType("mail.Message")).
+				Run(func(args mock.Arguments) {
+					sent = append(sent, args.Get(1).(mail.Message))
+				}).
+				Return(nil)
+
+			useradm := NewUserAdm(nil, db, nil, Config{}).WithMailer(mailer)
+
+			err := useradm.UpdateUser(ctx, "1234", &tc.update)
+			assert.NoError(t, err)
+
+			if assert.Len(t, sent, len(tc.messages)) {
+				for i, m := range tc.messages {
+					assert.Equal(t, m.To, sent[i].To)
+					assert.Equal(t, m.Subject, sent[i].Subject)
+				}
+			}
+		})
+	}
+}
+
+func TestUserAdmSetPasswordNotification(t *testing.T) {
+	ctx := context.Background()
+
+	db := &mstore.DataStore{}
+	db.On("GetUserByEmail", ContextMatcher(), "foo@bar.com").
+		Return(&model.User{ID: "1234", Email: "foo@bar.com"}, nil)
+	db.On("UpdateUser", ContextMatcher(), "1234",
+		mock.AnythingOfType("*model.UserUpdate")).
+		Return(nil)
+	db.On("GetUserSettings", ContextMatcher(), "1234").
+		Return(map[string]interface{}{}, nil)
+
+	mailer := &mmail.Mailer{}
+	mailer.On("Send", ContextMatcher(),
+		mock.MatchedBy(func(m mail.Message) bool {
+			return m.To == "foo@bar.com" &&
+				m.Subject == subjectPasswordChanged
+		})).
+		Return(errors.New("mail queue is full"))
+
+	useradm := NewUserAdm(nil, db, nil, Config{}).WithMailer(mailer)
+
+	// notification failures don't fail the operation
+	err := useradm.SetPassword(ctx, model.UserUpdate{
+		Email:    "foo@bar.com",
+		Password: "correcthorsebatterystaple",
+	})
+	assert.NoError(t, err)
+
+	mailer.AssertExpectations(t)
+}
+
+func TestUserAdmNotifyNewDeviceLogin(t *testing.T) {
+	t.Parallel()
+
+	info := model.LoginInfo{IP: "1.2.3.4", UserAgent: "curl/7.58.0"}
+	// the login being reported, already in the history
+	current := model.LoginEvent{IP: "1.2.3.4", UserAgent: "curl/7.58.0", Success: true}
+
+	testCases := map[string]struct {
+		events    []model.LoginEvent
+		eventsErr error
+
+		notify bool
+	}{
+		"first login": {
+			events: []model.LoginEvent{current},
+		},
+		"known device": {
+			events: []model.LoginEvent{
+				current,
+				{IP: "5.6.7.8", UserAgent: "curl/7.58.0", Success: true},
+				{IP: "1.2.3.4", UserAgent: "curl/7.58.0", Success: true},
+			},
+		},
+		"new device": {
+			events: []model.LoginEvent{
+				current,
+				{IP: "5.6.7.8", UserAgent: "curl/7.58.0", Success: true},
+			},
+			notify: true,
+		},
+		"new device, only failed attempts from it": {
+			events: []model.LoginEvent{
+				current,
+				{IP: "1.2.3.4", UserAgent: "curl/7.58.0", Success: false},
+				{IP: "5.6.7.8", UserAgent: "curl/7.58.0", Success: true},
+			},
+			notify: true,
+		},
+		"new device, login not saved": {
+			events: []model.LoginEvent{
+				{IP: "5.6.7.8", UserAgent: "curl/7.58.0", Success: true},
+			},
+			notify: true,
+		},
+		"error getting history": {
+			eventsErr: errors.New("db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetLoginEvents", ContextMatcher(), "1234").
+				Return(tc.events, tc.eventsErr)
+			db.On("GetUserSettings", ContextMatcher(), "1234").
+				Return(map[string]interface{}{}, nil)
+
+			mailer := &mmail.Mailer{}
+			mailer.On("Send", ContextMatcher(),
+				mock.MatchedBy(func(m mail.Message) bool {
+					return m.To == "foo@bar.com" &&
+						m.Subject == subjectNewDeviceLogin &&
+						strings.Contains(m.Body, "IP address: 1.2.3.4")
+				})).
+				Return(nil)
+
+			useradm := NewUserAdm(nil, db, nil, Config{}).WithMailer(mailer)
+
+			useradm.notifyNewDeviceLogin(ctx,
+				&model.User{ID: "1234", Email: "foo@bar.com"}, info)
+
+			if tc.notify {
+				mailer.AssertExpectations(t)
+			} else {
+				mailer.AssertNotCalled(t, "Send", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/scope"
+	"github.com/mendersoftware/useradm/store"
+)
+
+// paths of the OpenID Connect endpoints, relative to the configured URL
+const (
+	oidcPathIssuer    = "/oidc"
+	oidcPathAuthorize = "/oidc/authorize"
+	oidcPathToken     = "/auth/token"
+	oidcPathUserinfo  = "/oidc/userinfo"
+	oidcPathJWKS      = "/oidc/jwks"
+)
+
+func (ua *UserAdm) oidcURL(path string) string {
+	return strings.TrimSuffix(ua.config.OIDCURL, "/") + path
+}
+
+func (ua *UserAdm) GetOIDCConfiguration(ctx context.Context) (*model.OIDCConfiguration, error) {
+	if ua.config.OIDCURL == "" {
+		return nil, ErrOIDCDisabled
+	}
+
+	return &model.OIDCConfiguration{
+		Issuer:                ua.oidcURL(oidcPathIssuer),
+		AuthorizationEndpoint: ua.oidcURL(oidcPathAuthorize),
+		TokenEndpoint:         ua.oidcURL(oidcPathToken),
+		UserinfoEndpoint:      ua.oidcURL(oidcPathUserinfo),
+		JWKSURI:               ua.oidcURL(oidcPathJWKS),
+		ScopesSupported: []string{
+			model.ScopeOpenID, model.ScopeProfile, model.ScopeEmail,
+		},
+		ResponseTypesSupported: []string{model.ResponseTypeCode},
+		GrantTypesSupported: []string{
+			model.GrantTypeAuthorizationCode, model.GrantTypeClientCredentials,
+			model.GrantTypeTokenExchange,
+		},
+		SubjectTypesSupported:            []string{"public"},
+		IDTokenSigningAlgValuesSupported: []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: []string{
+			"client_secret_basic", "client_secret_post",
+		},
+		CodeChallengeMethodsSupported: []string{model.CodeChallengeMethodS256},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "email", "name",
+		},
+	}, nil
+}
+
+func (ua *UserAdm) GetOIDCKeys(ctx context.Context) (*jwt.JWKS, error) {
+	if ua.config.OIDCURL == "" {
+		return nil, ErrOIDCDisabled
+	}
+
+	keys := &jwt.JWKS{Keys: []jwt.JWK{}}
+	for _, key := range ua.jwtHandler.PublicKeys() {
+		keys.Keys = append(keys.Keys, jwt.NewJWK(key))
+	}
+	return keys, nil
+}
+
+// AuthorizeOIDC returns ErrInvalidClient or ErrInvalidRedirectURI if the
+// user can't be sent back to the client, the errors of the request
+// otherwise
+func (ua *UserAdm) AuthorizeOIDC(ctx context.Context,
+	r model.AuthorizationRequest) (string, error) {
+	if ua.config.OIDCURL == "" {
+		return "", ErrOIDCDisabled
+	}
+
+	ident := identity.FromContext(ctx)
+	if ident == nil {
+		return "", ErrUnauthorized
+	}
+
+	// only the tenant's own clients may authenticate its users
+	client, err := ua.db.GetOAuthClientById(ctx, r.ClientID)
+	if err != nil {
+		return "", errors.Wrap(err, "useradm: failed to get client")
+	}
+	if client == nil || client.TenantID != ident.Tenant {
+		return "", ErrInvalidClient
+	}
+	if !hasRedirectURI(client, r.RedirectURI) {
+		return "", ErrInvalidRedirectURI
+	}
+
+	if err := r.Validate(); err != nil {
+		return "", err
+	}
+
+	user, err := ua.db.GetUserById(ctx, ident.Subject)
+	if err != nil {
+		return "", errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil {
+		return "", ErrUnauthorized
+	}
+	if !user.IsActive() {
+		return "", ErrUserInactive
+	}
+
+	// the access token gets the mender scopes requested, all the client's
+	// if none, as long as the user has them too
+	accessScope, err := scope.Narrow(client.Scope, r.MenderScope())
+	if err != nil {
+		return "", ErrInvalidScope
+	}
+	if _, err := scope.Narrow(ua.userScope(ident.Tenant, user), accessScope); err != nil {
+		return "", ErrInvalidScope
+	}
+
+	code, err := randomHex(32)
+	if err != nil {
+		return "", errors.Wrap(err, "useradm: failed to generate authorization code")
+	}
+
+	now := time.Now().UTC()
+	err = ua.db.SaveOAuthCode(ctx, &model.OAuthCode{
+		ID:            hashClientSecret(code),
+		ClientID:      client.ID,
+		TenantID:      ident.Tenant,
+		UserID:        user.ID,
+		RedirectURI:   r.RedirectURI,
+		Scope:         r.Scope,
+		Nonce:         r.Nonce,
+		CodeChallenge: r.CodeChallenge,
+		AccessScope:   accessScope,
+		AuthTime:      now,
+		ExpiresTs:     now.Add(time.Duration(ua.config.AuthCodeExpirationTime) * time.Second),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "useradm: failed to save authorization code")
+	}
+
+	return code, nil
+}
+
+func (ua *UserAdm) ExchangeAuthCode(ctx context.Context,
+	e model.AuthCodeExchange) (*model.AccessToken, error) {
+	if ua.config.OIDCURL == "" {
+		return nil, ErrOIDCDisabled
+	}
+
+	client, err := ua.authenticateClient(ctx, e.ClientID, e.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := ua.db.TakeOAuthCode(ctx, hashClientSecret(e.Code))
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get authorization code")
+	}
+	if code == nil || code.ClientID != client.ID ||
+		code.RedirectURI != e.RedirectURI ||
+		time.Now().After(code.ExpiresTs) ||
+		!verifyCodeChallenge(code.CodeChallenge, e.CodeVerifier) {
+		return nil, ErrInvalidGrant
+	}
+
+	ctx = identity.WithContext(ctx, &identity.Identity{
+		Subject: code.UserID,
+		Tenant:  code.TenantID,
+	})
+
+	user, err := ua.db.GetUserById(ctx, code.UserID)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil || !user.IsActive() {
+		return nil, ErrInvalidGrant
+	}
+
+	access, err := ua.issueUserToken(ctx, user, code.TenantID, code.AccessScope)
+	if err != nil {
+		return nil, err
+	}
+
+	request := model.AuthorizationRequest{Scope: code.Scope}
+	id := &jwt.Token{
+		Claims: jwt.Claims{
+			Issuer:    ua.oidcURL(oidcPathIssuer),
+			Subject:   user.ID,
+			Audience:  client.ID,
+			IssuedAt:  access.Claims.IssuedAt,
+			ExpiresAt: access.Claims.ExpiresAt,
+			AuthTime:  code.AuthTime.Unix(),
+			Nonce:     code.Nonce,
+		},
+	}
+	if request.HasScope(model.ScopeEmail) {
+		id.Claims.Email = user.Email
+	}
+	if request.HasScope(model.ScopeProfile) {
+		id.Claims.Name = user.Name
+	}
+
+	rawAccess, err := ua.encodeToken(ctx, access)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to sign access token")
+	}
+	rawID, err := ua.jwtHandler.ToJWT(id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to sign ID token")
+	}
+
+	log.FromContext(ctx).F(log.Ctx{
+		"client_id": client.ID,
+		"user_id":   user.ID,
+		"token_id":  access.Id,
+	}).Infof("user %s authenticated to client %s", user.ID, client.Name)
+
+	return &model.AccessToken{
+		AccessToken: rawAccess,
+		TokenType:   model.TokenTypeBearer,
+		ExpiresIn:   access.Claims.ExpiresAt - access.Claims.IssuedAt,
+		Scope:       code.Scope,
+		IDToken:     rawID,
+	}, nil
+}
+
+func (ua *UserAdm) GetUserInfo(ctx context.Context) (*model.UserInfo, error) {
+	if ua.config.OIDCURL == "" {
+		return nil, ErrOIDCDisabled
+	}
+
+	ident := identity.FromContext(ctx)
+	if ident == nil {
+		return nil, ErrUnauthorized
+	}
+
+	user, err := ua.db.GetUserById(ctx, ident.Subject)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil {
+		return nil, store.ErrUserNotFound
+	}
+
+	return &model.UserInfo{
+		Subject: user.ID,
+		Email:   user.Email,
+		Name:    user.Name,
+	}, nil
+}
+
+// hasRedirectURI checks the URI is one of the client's; the URIs must
+// match exactly, see RFC 6749 3.1.2.3
+func hasRedirectURI(client *model.OAuthClient, uri string) bool {
+	for _, u := range client.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyCodeChallenge checks the PKCE code verifier against the S256
+// challenge, see RFC 7636 4.6
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
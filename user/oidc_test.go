@@ -0,0 +1,402 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/jwt"
+	mjwt "github.com/mendersoftware/useradm/jwt/mocks"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/scope"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmGetOIDCConfiguration(t *testing.T) {
+	t.Parallel()
+
+	useradm := NewUserAdm(nil, nil, nil, Config{})
+	config, err := useradm.GetOIDCConfiguration(context.Background())
+	assert.EqualError(t, err, ErrOIDCDisabled.Error())
+	assert.Nil(t, config)
+
+	useradm = NewUserAdm(nil, nil, nil, Config{
+		OIDCURL: "https://mender.example.com/api/management/v1/useradm/",
+	})
+	config, err = useradm.GetOIDCConfiguration(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "https://mender.example.com/api/management/v1/useradm/oidc",
+		config.Issuer)
+	assert.Equal(t, "https://mender.example.com/api/management/v1/useradm/oidc/authorize",
+		config.AuthorizationEndpoint)
+	assert.Equal(t, "https://mender.example.com/api/management/v1/useradm/auth/token",
+		config.TokenEndpoint)
+	assert.Equal(t, "https://mender.example.com/api/management/v1/useradm/oidc/jwks",
+		config.JWKSURI)
+	assert.Equal(t, []string{model.CodeChallengeMethodS256},
+		config.CodeChallengeMethodsSupported)
+}
+
+func TestUserAdmAuthorizeOIDC(t *testing.T) {
+	t.Parallel()
+
+	client := &model.OAuthClient{
+		ID:           "client-1",
+		TenantID:     "tenant-1",
+		Name:         "tool",
+		Scope:        scope.UsersRead + " " + scope.SettingsRead,
+		RedirectURIs: []string{"https://tool.example.com/callback"},
+	}
+	request := model.AuthorizationRequest{
+		ResponseType:        model.ResponseTypeCode,
+		ClientID:            "client-1",
+		RedirectURI:         "https://tool.example.com/callback",
+		Scope:               "openid email",
+		Nonce:               "n-1",
+		CodeChallenge:       "challenge",
+		CodeChallengeMethod: model.CodeChallengeMethodS256,
+	}
+	ident := &identity.Identity{Subject: "user-1", Tenant: "tenant-1"}
+
+	testCases := map[string]struct {
+		ident   *identity.Identity
+		request func(r *model.AuthorizationRequest)
+
+		dbClient *model.OAuthClient
+		dbUser   *model.User
+		dbErr    error
+
+		accessScope string
+		err         error
+	}{
+		"ok, all the client's scopes": {
+			ident:       ident,
+			dbClient:    client,
+			dbUser:      &model.User{ID: "user-1"},
+			accessScope: client.Scope,
+		},
+		"ok, narrowed": {
+			ident: ident,
+			request: func(r *model.AuthorizationRequest) {
+				r.Scope = "openid " + scope.UsersRead
+			},
+			dbClient:    client,
+			dbUser:      &model.User{ID: "user-1"},
+			accessScope: scope.UsersRead,
+		},
+		"error: no identity": {
+			err: ErrUnauthorized,
+		},
+		"error: unknown client": {
+			ident: ident,
+			err:   ErrInvalidClient,
+		},
+		"error: client of another tenant": {
+			ident:    &identity.Identity{Subject: "user-1", Tenant: "tenant-2"},
+			dbClient: client,
+			err:      ErrInvalidClient,
+		},
+		"error: redirect URI not registered": {
+			ident: ident,
+			request: func(r *model.AuthorizationRequest) {
+				r.RedirectURI = "https://evil.example.com/callback"
+			},
+			dbClient: client,
+			err:      ErrInvalidRedirectURI,
+		},
+		"error: no PKCE": {
+			ident: ident,
+			request: func(r *model.AuthorizationRequest) {
+				r.CodeChallenge = ""
+			},
+			dbClient: client,
+			err:      model.ErrInvalidCodeChallenge,
+		},
+		"error: scope not granted to the client": {
+			ident: ident,
+			request: func(r *model.AuthorizationRequest) {
+				r.Scope = "openid " + scope.UsersWrite
+			},
+			dbClient: client,
+			dbUser:   &model.User{ID: "user-1"},
+			err:      ErrInvalidScope,
+		},
+		"error: user inactive": {
+			ident:    ident,
+			dbClient: client,
+			dbUser:   &model.User{ID: "user-1", Status: model.UserStatusInactive},
+			err:      ErrUserInactive,
+		},
+		"error: db": {
+			ident: ident,
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to get client: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			r := request
+			if tc.request != nil {
+				tc.request(&r)
+			}
+
+			var saved *model.OAuthCode
+			db := &mstore.DataStore{}
+			db.On("GetOAuthClientById", ContextMatcher(), "client-1").
+				Return(tc.dbClient, tc.dbErr)
+			db.On("GetUserById", ContextMatcher(), "user-1").
+				Return(tc.dbUser, nil)
+			db.On("SaveOAuthCode", ContextMatcher(),
+				mock.AnythingOfType("*model.OAuthCode")).
+				Run(func(args mock.Arguments) {
+					saved = args.Get(1).(*model.OAuthCode)
+				}).Return(nil)
+
+			useradm := NewUserAdm(nil, db, nil, Config{
+				OIDCURL:                "https://mender.example.com",
+				AuthCodeExpirationTime: 60,
+			})
+
+			ctx := context.Background()
+			if tc.ident != nil {
+				ctx = identity.WithContext(ctx, tc.ident)
+			}
+			code, err := useradm.AuthorizeOIDC(ctx, r)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Empty(t, code)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEmpty(t, code)
+			assert.Equal(t, hashClientSecret(code), saved.ID)
+			assert.Equal(t, "tenant-1", saved.TenantID)
+			assert.Equal(t, "user-1", saved.UserID)
+			assert.Equal(t, r.Nonce, saved.Nonce)
+			assert.Equal(t, tc.accessScope, saved.AccessScope)
+			assert.WithinDuration(t, time.Now().Add(time.Minute), saved.ExpiresTs,
+				5*time.Second)
+		})
+	}
+}
+
+func TestUserAdmExchangeAuthCode(t *testing.T) {
+	t.Parallel()
+
+	client := &model.OAuthClient{
+		ID:         "client-1",
+		TenantID:   "tenant-1",
+		Name:       "tool",
+		Scope:      scope.UsersRead,
+		SecretHash: hashClientSecret("secret"),
+	}
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	authTime := time.Now().Add(-10 * time.Second).UTC()
+	code := model.OAuthCode{
+		ID:            hashClientSecret("code-1"),
+		ClientID:      "client-1",
+		TenantID:      "tenant-1",
+		UserID:        "user-1",
+		RedirectURI:   "https://tool.example.com/callback",
+		Scope:         "openid email",
+		Nonce:         "n-1",
+		CodeChallenge: base64.RawURLEncoding.EncodeToString(sum[:]),
+		AccessScope:   scope.UsersRead,
+		AuthTime:      authTime,
+		ExpiresTs:     time.Now().Add(time.Minute),
+	}
+	exchange := model.AuthCodeExchange{
+		ClientID:     "client-1",
+		ClientSecret: "secret",
+		Code:         "code-1",
+		RedirectURI:  "https://tool.example.com/callback",
+		CodeVerifier: verifier,
+	}
+	user := &model.User{ID: "user-1", Email: "foo@bar.com", Name: "Foo"}
+
+	testCases := map[string]struct {
+		exchange func(e *model.AuthCodeExchange)
+		code     func(c *model.OAuthCode)
+
+		dbNoCode bool
+		dbUser   *model.User
+		dbStatus *model.TenantStatus
+
+		err error
+	}{
+		"ok": {
+			dbUser: user,
+		},
+		"error: wrong secret": {
+			exchange: func(e *model.AuthCodeExchange) {
+				e.ClientSecret = "wrong"
+			},
+			err: ErrInvalidClient,
+		},
+		"error: code used or unknown": {
+			dbNoCode: true,
+			err:      ErrInvalidGrant,
+		},
+		"error: code of another client": {
+			code: func(c *model.OAuthCode) {
+				c.ClientID = "client-2"
+			},
+			err: ErrInvalidGrant,
+		},
+		"error: other redirect URI": {
+			exchange: func(e *model.AuthCodeExchange) {
+				e.RedirectURI = "https://tool.example.com/other"
+			},
+			err: ErrInvalidGrant,
+		},
+		"error: code expired": {
+			code: func(c *model.OAuthCode) {
+				c.ExpiresTs = time.Now().Add(-time.Second)
+			},
+			err: ErrInvalidGrant,
+		},
+		"error: wrong code verifier": {
+			exchange: func(e *model.AuthCodeExchange) {
+				e.CodeVerifier = "wrong"
+			},
+			err: ErrInvalidGrant,
+		},
+		"error: no code verifier": {
+			exchange: func(e *model.AuthCodeExchange) {
+				e.CodeVerifier = ""
+			},
+			err: ErrInvalidGrant,
+		},
+		"error: user removed": {
+			err: ErrInvalidGrant,
+		},
+		"error: tenant suspended": {
+			dbUser: user,
+			dbStatus: &model.TenantStatus{
+				Status:    model.TenantStatusSuspended,
+				UpdatedTs: time.Now(),
+			},
+			err: ErrTenantAccountSuspended,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			e := exchange
+			if tc.exchange != nil {
+				tc.exchange(&e)
+			}
+			c := code
+			if tc.code != nil {
+				tc.code(&c)
+			}
+			dbCode := &c
+			if tc.dbNoCode {
+				dbCode = nil
+			}
+
+			db := &mstore.DataStore{}
+			db.On("GetOAuthClientById", ContextMatcher(), "client-1").
+				Return(client, nil)
+			db.On("TakeOAuthCode", ContextMatcher(), hashClientSecret("code-1")).
+				Return(dbCode, nil)
+			db.On("GetUserById", ContextMatcher(), "user-1").
+				Return(tc.dbUser, nil)
+			db.On("GetTenantStatus", ContextMatcher()).Return(tc.dbStatus, nil)
+			db.On("SaveToken", ContextMatcher(),
+				mock.AnythingOfType("*jwt.Token")).Return(nil)
+
+			var access, id *jwt.Token
+			jwth := &mjwt.Handler{}
+			jwth.On("ToJWT", mock.MatchedBy(func(t *jwt.Token) bool {
+				return t.Claims.User
+			})).Run(func(args mock.Arguments) {
+				access = args.Get(0).(*jwt.Token)
+			}).Return("access", nil)
+			jwth.On("ToJWT", mock.MatchedBy(func(t *jwt.Token) bool {
+				return !t.Claims.User
+			})).Run(func(args mock.Arguments) {
+				id = args.Get(0).(*jwt.Token)
+			}).Return("id", nil)
+
+			useradm := NewUserAdm(jwth, db, nil, Config{
+				OIDCURL:        "https://mender.example.com",
+				ExpirationTime: 3600,
+			})
+
+			token, err := useradm.ExchangeAuthCode(context.Background(), e)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, token)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, &model.AccessToken{
+				AccessToken: "access",
+				TokenType:   model.TokenTypeBearer,
+				ExpiresIn:   3600,
+				Scope:       "openid email",
+				IDToken:     "id",
+			}, token)
+
+			assert.Equal(t, "user-1", access.Claims.Subject)
+			assert.Equal(t, "tenant-1", access.Claims.Tenant)
+			assert.Equal(t, scope.UsersRead, access.Claims.Scope)
+
+			assert.Equal(t, "https://mender.example.com/oidc", id.Claims.Issuer)
+			assert.Equal(t, "user-1", id.Claims.Subject)
+			assert.Equal(t, "client-1", id.Claims.Audience)
+			assert.Equal(t, "n-1", id.Claims.Nonce)
+			assert.Equal(t, authTime.Unix(), id.Claims.AuthTime)
+			assert.Equal(t, "foo@bar.com", id.Claims.Email)
+			assert.Empty(t, id.Claims.Name)
+		})
+	}
+}
+
+func TestUserAdmGetUserInfo(t *testing.T) {
+	t.Parallel()
+
+	db := &mstore.DataStore{}
+	db.On("GetUserById", ContextMatcher(), "user-1").
+		Return(&model.User{ID: "user-1", Email: "foo@bar.com", Name: "Foo"}, nil)
+
+	useradm := NewUserAdm(nil, db, nil, Config{OIDCURL: "https://mender.example.com"})
+
+	ctx := identity.WithContext(context.Background(),
+		&identity.Identity{Subject: "user-1", Tenant: "tenant-1"})
+	info, err := useradm.GetUserInfo(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.UserInfo{
+		Subject: "user-1",
+		Email:   "foo@bar.com",
+		Name:    "Foo",
+	}, info)
+
+	_, err = useradm.GetUserInfo(context.Background())
+	assert.EqualError(t, err, ErrUnauthorized.Error())
+}
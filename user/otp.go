@@ -0,0 +1,171 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/mail"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/sms"
+	"github.com/mendersoftware/useradm/store"
+)
+
+func (ua *UserAdm) WithSMSSender(s sms.Sender) *UserAdm {
+	ua.sms = s
+	return ua
+}
+
+// checkSecondFactor makes the user, who got the password right, prove the
+// second factor if the tenant requires one: without a code, a new one is
+// sent to the user, unless one was sent recently, and ErrOTPRequired
+// returned
+func (ua *UserAdm) checkSecondFactor(ctx context.Context, user *model.User,
+	info model.LoginInfo) error {
+	ts, err := ua.tenantSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if ts.SecondFactor == "" {
+		return nil
+	}
+
+	if info.OTP == "" {
+		if err := ua.sendLoginOTP(ctx, user, ts.SecondFactor); err != nil {
+			return err
+		}
+		return ErrOTPRequired
+	}
+	return ua.verifyLoginOTP(ctx, user.ID, info.OTP)
+}
+
+// sendLoginOTP sends a new one-time code to the user, replacing the
+// previous one; users without a phone number get it by email. A code
+// still valid is replaced at most every model.LoginOTPResendInterval,
+// and not at all once its attempts are used up, which the new code
+// inherits
+func (ua *UserAdm) sendLoginOTP(ctx context.Context, user *model.User, channel string) error {
+	l := log.FromContext(ctx)
+
+	if channel == model.SecondFactorSMS && (ua.sms == nil || user.Phone == "") {
+		channel = model.SecondFactorEmail
+	}
+	if channel == model.SecondFactorEmail && ua.mailer == nil {
+		l.Errorf("the tenant requires a second factor, but no mailer is configured")
+		return ErrOTPUndeliverable
+	}
+
+	now := time.Now().UTC()
+	prev, err := ua.db.GetLoginOTP(ctx, user.ID)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get login code")
+	}
+	attempts := 0
+	if prev != nil && now.Before(prev.ExpiresTs) {
+		if prev.Attempts >= model.MaxLoginOTPAttempts {
+			return ErrInvalidOTP
+		}
+		if now.Before(prev.SentTs.Add(model.LoginOTPResendInterval)) {
+			l.F(log.Ctx{"user_id": user.ID}).
+				Infof("login code sent to user %s recently, not resending", user.ID)
+			return nil
+		}
+		attempts = prev.Attempts
+	}
+
+	code, err := randomDigits(model.LoginOTPLength)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to generate login code")
+	}
+
+	err = ua.db.SaveLoginOTP(ctx, &model.LoginOTP{
+		UserID:   user.ID,
+		Code:     hashVerificationCode(code),
+		Channel:  channel,
+		Attempts: attempts,
+		SentTs:   now,
+		ExpiresTs: now.Add(
+			time.Duration(ua.config.OTPExpirationTime) * time.Second),
+	})
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to save login code")
+	}
+
+	minutes := ua.config.OTPExpirationTime / 60
+	if channel == model.SecondFactorSMS {
+		err = ua.sms.Send(ctx, sms.Message{
+			To:   user.Phone,
+			Body: fmt.Sprintf(smsLoginOTP, code, minutes),
+		})
+	} else {
+		err = ua.mailer.Send(ctx, mail.Message{
+			To:      user.Email,
+			Subject: subjectLoginOTP,
+			Body:    fmt.Sprintf(bodyLoginOTP, user.Email, code, minutes),
+		})
+	}
+	if err != nil {
+		return errors.Wrapf(err, "useradm: failed to send login code by %s", channel)
+	}
+
+	l.F(log.Ctx{"user_id": user.ID}).
+		Infof("login code sent to user %s by %s", user.ID, channel)
+	return nil
+}
+
+// verifyLoginOTP accepts the user's code once; the code stops working
+// after MaxLoginOTPAttempts wrong ones. Each attempt is counted before
+// the code is compared, so that concurrent guesses can't exceed them
+func (ua *UserAdm) verifyLoginOTP(ctx context.Context, userID, code string) error {
+	otp, err := ua.db.TakeLoginOTPAttempt(ctx, userID, time.Now().UTC())
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to check login code")
+	}
+	if otp == nil {
+		return ErrInvalidOTP
+	}
+
+	if subtle.ConstantTimeCompare([]byte(otp.Code),
+		[]byte(hashVerificationCode(code))) != 1 {
+		return ErrInvalidOTP
+	}
+
+	// the code is accepted once, by whichever login removes it first
+	switch err := ua.db.DeleteLoginOTP(ctx, userID); err {
+	case nil:
+		return nil
+	case store.ErrLoginOTPNotFound:
+		return ErrInvalidOTP
+	default:
+		return errors.Wrap(err, "useradm: failed to remove login code")
+	}
+}
+
+// randomDigits returns a random number of n digits, zero padded
+func randomDigits(n int) (string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+	v, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", n, v), nil
+}
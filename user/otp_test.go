@@ -0,0 +1,308 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/mail"
+	mmail "github.com/mendersoftware/useradm/mail/mocks"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/sms"
+	msms "github.com/mendersoftware/useradm/sms/mocks"
+	"github.com/mendersoftware/useradm/store"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmLoginSecondFactor(t *testing.T) {
+	t.Parallel()
+
+	user := &model.User{
+		ID:       "user-1",
+		Email:    "foo@bar.com",
+		Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+	}
+	withPhone := *user
+	withPhone.Phone = "+4712345678"
+
+	code := func(attempts int, expires time.Time) *model.LoginOTP {
+		return &model.LoginOTP{
+			UserID:    "user-1",
+			Code:      hashVerificationCode("123456"),
+			Channel:   model.SecondFactorEmail,
+			Attempts:  attempts,
+			ExpiresTs: expires,
+		}
+	}
+	valid := time.Now().Add(time.Minute)
+	sent := func(attempts int, sentTs time.Time) *model.LoginOTP {
+		otp := code(attempts, valid)
+		otp.SentTs = sentTs
+		return otp
+	}
+
+	testCases := map[string]struct {
+		secondFactor string
+		otp          string
+		noMailer     bool
+
+		dbUser      *model.User
+		dbOTP       *model.LoginOTP
+		dbDeleteErr error
+
+		sentBy   string
+		attempts int
+		deleted  bool
+		err      error
+	}{
+		"ok, not required": {
+			dbUser: user,
+		},
+		"ok, code accepted": {
+			secondFactor: model.SecondFactorEmail,
+			otp:          "123456",
+			dbUser:       user,
+			dbOTP:        code(0, valid),
+			deleted:      true,
+		},
+		"error: code sent by email": {
+			secondFactor: model.SecondFactorEmail,
+			dbUser:       user,
+			sentBy:       model.SecondFactorEmail,
+			err:          ErrOTPRequired,
+		},
+		"error: code sent by SMS": {
+			secondFactor: model.SecondFactorSMS,
+			dbUser:       &withPhone,
+			sentBy:       model.SecondFactorSMS,
+			err:          ErrOTPRequired,
+		},
+		"error: code sent by email to a user without phone": {
+			secondFactor: model.SecondFactorSMS,
+			dbUser:       user,
+			sentBy:       model.SecondFactorEmail,
+			err:          ErrOTPRequired,
+		},
+		"error: code resent, keeping the attempts": {
+			secondFactor: model.SecondFactorEmail,
+			dbUser:       user,
+			dbOTP:        sent(2, time.Now().Add(-2*model.LoginOTPResendInterval)),
+			sentBy:       model.SecondFactorEmail,
+			attempts:     2,
+			err:          ErrOTPRequired,
+		},
+		"error: code sent recently, not resent": {
+			secondFactor: model.SecondFactorEmail,
+			dbUser:       user,
+			dbOTP:        sent(2, time.Now()),
+			err:          ErrOTPRequired,
+		},
+		"error: attempts used up, not resent": {
+			secondFactor: model.SecondFactorEmail,
+			dbUser:       user,
+			dbOTP: sent(model.MaxLoginOTPAttempts,
+				time.Now().Add(-2*model.LoginOTPResendInterval)),
+			err: ErrInvalidOTP,
+		},
+		"error: code expired, new one sent": {
+			secondFactor: model.SecondFactorEmail,
+			dbUser:       user,
+			dbOTP:        code(model.MaxLoginOTPAttempts, time.Now().Add(-time.Second)),
+			sentBy:       model.SecondFactorEmail,
+			err:          ErrOTPRequired,
+		},
+		"error: no way to send the code": {
+			secondFactor: model.SecondFactorEmail,
+			noMailer:     true,
+			dbUser:       user,
+			err:          ErrOTPUndeliverable,
+		},
+		"error: wrong code": {
+			secondFactor: model.SecondFactorEmail,
+			otp:          "654321",
+			dbUser:       user,
+			dbOTP:        code(0, valid),
+			err:          ErrInvalidOTP,
+		},
+		"error: no code sent": {
+			secondFactor: model.SecondFactorEmail,
+			otp:          "123456",
+			dbUser:       user,
+			err:          ErrInvalidOTP,
+		},
+		"error: code expired": {
+			secondFactor: model.SecondFactorEmail,
+			otp:          "123456",
+			dbUser:       user,
+			dbOTP:        code(0, time.Now().Add(-time.Second)),
+			err:          ErrInvalidOTP,
+		},
+		"error: too many wrong codes": {
+			secondFactor: model.SecondFactorEmail,
+			otp:          "123456",
+			dbUser:       user,
+			dbOTP:        code(model.MaxLoginOTPAttempts, valid),
+			err:          ErrInvalidOTP,
+		},
+		"error: code used concurrently": {
+			secondFactor: model.SecondFactorEmail,
+			otp:          "123456",
+			dbUser:       user,
+			dbOTP:        code(0, valid),
+			dbDeleteErr:  store.ErrLoginOTPNotFound,
+			deleted:      true,
+			err:          ErrInvalidOTP,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			settings := map[string]interface{}{}
+			if tc.secondFactor != "" {
+				settings[model.SettingSecondFactor] = tc.secondFactor
+			}
+
+			db := &mstore.DataStore{}
+			db.On("GetUserByEmail", ContextMatcher(), "foo@bar.com").
+				Return(tc.dbUser, nil)
+			db.On("GetSettings", ContextMatcher()).Return(settings, nil)
+			db.On("SaveLoginOTP", ContextMatcher(),
+				mock.AnythingOfType("*model.LoginOTP")).Return(nil)
+			db.On("GetLoginOTP", ContextMatcher(), "user-1").Return(tc.dbOTP, nil)
+			// the code as the store finds it, if it's still valid
+			taken := tc.dbOTP
+			if taken != nil && (taken.Attempts >= model.MaxLoginOTPAttempts ||
+				time.Now().After(taken.ExpiresTs)) {
+				taken = nil
+			}
+			db.On("TakeLoginOTPAttempt", ContextMatcher(), "user-1",
+				mock.AnythingOfType("time.Time")).Return(taken, nil)
+			db.On("DeleteLoginOTP", ContextMatcher(), "user-1").Return(tc.dbDeleteErr)
+			db.On("SaveToken", ContextMatcher(),
+				mock.AnythingOfType("*jwt.Token")).Return(nil)
+			db.On("SetLastLogin", ContextMatcher(), "user-1",
+				mock.AnythingOfType("time.Time"), "").Return(nil)
+			db.On("GetLoginEvents", ContextMatcher(), "user-1").
+				Return([]model.LoginEvent{}, nil)
+			db.On("SaveLoginEvent", ContextMatcher(),
+				mock.AnythingOfType("*model.LoginEvent")).Return(nil)
+
+			var mailed []mail.Message
+			mailer := &mmail.Mailer{}
+			mailer.On("Send", ContextMatcher(), mock.AnythingOfType("mail.Message")).
+				Run(func(args mock.Arguments) {
+					mailed = append(mailed, args.Get(1).(mail.Message))
+				}).
+				Return(nil)
+
+			var texted []sms.Message
+			sender := &msms.Sender{}
+			sender.On("Send", ContextMatcher(), mock.AnythingOfType("sms.Message")).
+				Run(func(args mock.Arguments) {
+					texted = append(texted, args.Get(1).(sms.Message))
+				}).
+				Return(nil)
+
+			useradm := NewUserAdm(nil, db, nil, Config{
+				ExpirationTime:    3600,
+				OTPExpirationTime: 300,
+			}).WithSMSSender(sender)
+			if !tc.noMailer {
+				useradm = useradm.WithMailer(mailer)
+			}
+
+			token, err := useradm.Login(context.Background(), "foo@bar.com",
+				"correcthorsebatterystaple", model.LoginInfo{OTP: tc.otp})
+
+			if tc.deleted {
+				db.AssertCalled(t, "DeleteLoginOTP", ContextMatcher(), "user-1")
+			} else {
+				db.AssertNotCalled(t, "DeleteLoginOTP", ContextMatcher(), "user-1")
+			}
+			// every code entered counts as an attempt
+			if tc.otp != "" && tc.secondFactor != "" {
+				db.AssertCalled(t, "TakeLoginOTPAttempt", ContextMatcher(), "user-1",
+					mock.AnythingOfType("time.Time"))
+			} else {
+				db.AssertNotCalled(t, "TakeLoginOTPAttempt", ContextMatcher(), "user-1",
+					mock.AnythingOfType("time.Time"))
+			}
+
+			var sent string
+			switch tc.sentBy {
+			case model.SecondFactorEmail:
+				assert.Empty(t, texted)
+				if assert.Len(t, mailed, 1) {
+					assert.Equal(t, "foo@bar.com", mailed[0].To)
+					assert.Equal(t, subjectLoginOTP, mailed[0].Subject)
+					sent = mailed[0].Body
+				}
+			case model.SecondFactorSMS:
+				assert.Empty(t, mailed)
+				if assert.Len(t, texted, 1) {
+					assert.Equal(t, "+4712345678", texted[0].To)
+					sent = texted[0].Body
+				}
+			default:
+				assert.Empty(t, mailed)
+				assert.Empty(t, texted)
+				db.AssertNotCalled(t, "SaveLoginOTP", ContextMatcher(),
+					mock.AnythingOfType("*model.LoginOTP"))
+			}
+			if sent != "" {
+				// the message carries the code, the store only its hash
+				var saved *model.LoginOTP
+				for _, c := range db.Calls {
+					if c.Method == "SaveLoginOTP" {
+						saved = c.Arguments.Get(1).(*model.LoginOTP)
+					}
+				}
+				if assert.NotNil(t, saved) {
+					found := regexp.MustCompile(`\b[0-9]{6}\b`).FindString(sent)
+					assert.Equal(t, hashVerificationCode(found), saved.Code)
+					assert.Equal(t, tc.sentBy, saved.Channel)
+					assert.Equal(t, tc.attempts, saved.Attempts)
+					assert.WithinDuration(t, time.Now(), saved.SentTs, time.Minute)
+					assert.WithinDuration(t, time.Now().Add(5*time.Minute),
+						saved.ExpiresTs, time.Minute)
+				}
+			}
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, token)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "user-1", token.Claims.Subject)
+		})
+	}
+}
+
+func TestRandomDigits(t *testing.T) {
+	t.Parallel()
+
+	for i := 0; i < 100; i++ {
+		code, err := randomDigits(model.LoginOTPLength)
+		assert.NoError(t, err)
+		assert.Regexp(t, `^[0-9]{6}$`, code)
+	}
+}
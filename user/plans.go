@@ -0,0 +1,124 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+var (
+	ErrPlanLimit = errors.New("not available in the tenant's plan")
+)
+
+func (ua *UserAdm) SetPlan(ctx context.Context, p model.Plan) error {
+	if err := ua.db.SetPlan(ctx, &p); err != nil {
+		return errors.Wrap(err, "useradm: failed to set plan")
+	}
+	return nil
+}
+
+func (ua *UserAdm) GetPlan(ctx context.Context) (*model.PlanInfo, error) {
+	plan, err := ua.db.GetPlan(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get plan")
+	}
+
+	info := &model.PlanInfo{PlanCapabilities: plan.Capabilities()}
+	if plan != nil {
+		info.Name = plan.Name
+	}
+	return info, nil
+}
+
+// syncPlan records the tenant's plan reported by tenantadm, if changed
+func (ua *UserAdm) syncPlan(ctx context.Context, name string) error {
+	plan, err := ua.db.GetPlan(ctx)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get plan")
+	}
+	if plan != nil && plan.Name == name {
+		return nil
+	}
+	return ua.SetPlan(ctx, model.Plan{Name: name})
+}
+
+func (ua *UserAdm) planCapabilities(ctx context.Context) (model.PlanCapabilities, error) {
+	plan, err := ua.db.GetPlan(ctx)
+	if err != nil {
+		return model.PlanCapabilities{}, errors.Wrap(err, "useradm: failed to get plan")
+	}
+	return plan.Capabilities(), nil
+}
+
+// checkCapability returns ErrPlanLimit unless the tenant's plan
+// includes the capability
+func (ua *UserAdm) checkCapability(ctx context.Context, capability string) error {
+	caps, err := ua.planCapabilities(ctx)
+	if err != nil {
+		return err
+	}
+	if !caps.Has(capability) {
+		return ErrPlanLimit
+	}
+	return nil
+}
+
+// checkPlanUsers returns ErrPlanLimit if the tenant's plan doesn't allow
+// another user; unlike model.LimitMaxUsers, enforced by the datastore, the
+// check may be raced by concurrent creations, which is fine for upselling
+func (ua *UserAdm) checkPlanUsers(ctx context.Context) error {
+	caps, err := ua.planCapabilities(ctx)
+	if err != nil {
+		return err
+	}
+	if caps.MaxUsers == 0 {
+		return nil
+	}
+
+	n, err := ua.db.CountUsers(ctx, model.UserFilter{})
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to count users")
+	}
+	if n >= caps.MaxUsers {
+		return ErrPlanLimit
+	}
+	return nil
+}
+
+// planLoginHistory drops the login events older than the tenant's plan
+// keeps visible
+func (ua *UserAdm) planLoginHistory(ctx context.Context,
+	events []model.LoginEvent) ([]model.LoginEvent, error) {
+	caps, err := ua.planCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if caps.LoginHistoryDays == 0 {
+		return events, nil
+	}
+
+	since := time.Now().AddDate(0, 0, -caps.LoginHistoryDays)
+	visible := []model.LoginEvent{}
+	for _, e := range events {
+		if e.Timestamp.After(since) {
+			visible = append(visible, e)
+		}
+	}
+	return visible, nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmGetPlan(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dbPlan *model.Plan
+		dbErr  error
+
+		info *model.PlanInfo
+		err  error
+	}{
+		"ok, no plan": {
+			info: &model.PlanInfo{
+				PlanCapabilities: (*model.Plan)(nil).Capabilities(),
+			},
+		},
+		"ok": {
+			dbPlan: &model.Plan{Name: model.PlanOpenSource},
+			info: &model.PlanInfo{
+				Name:             model.PlanOpenSource,
+				PlanCapabilities: (&model.Plan{Name: model.PlanOpenSource}).Capabilities(),
+			},
+		},
+		"error: db": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to get plan: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("GetPlan", ContextMatcher()).Return(tc.dbPlan, tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			info, err := useradm.GetPlan(context.Background())
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.info, info)
+			}
+		})
+	}
+}
+
+func TestUserAdmPlanGating(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	os := &model.Plan{Name: model.PlanOpenSource}
+
+	t.Run("groups not in plan", func(t *testing.T) {
+		db := &mstore.DataStore{}
+		db.On("GetPlan", ContextMatcher()).Return(os, nil)
+		useradm := NewUserAdm(nil, db, nil, Config{})
+
+		err := useradm.CreateGroup(ctx, &model.Group{Name: "ops"})
+		assert.Equal(t, ErrPlanLimit, err)
+		db.AssertNotCalled(t, "CreateGroup", mock.Anything, mock.Anything)
+	})
+
+	t.Run("user count at plan limit", func(t *testing.T) {
+		db := &mstore.DataStore{}
+		db.On("GetPlan", ContextMatcher()).Return(os, nil)
+		db.On("CountUsers", ContextMatcher(), model.UserFilter{}).Return(5, nil)
+		useradm := NewUserAdm(nil, db, nil, Config{})
+
+		assert.Equal(t, ErrPlanLimit, useradm.checkPlanUsers(ctx))
+	})
+
+	t.Run("user count under plan limit", func(t *testing.T) {
+		db := &mstore.DataStore{}
+		db.On("GetPlan", ContextMatcher()).Return(os, nil)
+		db.On("CountUsers", ContextMatcher(), model.UserFilter{}).Return(4, nil)
+		useradm := NewUserAdm(nil, db, nil, Config{})
+
+		assert.NoError(t, useradm.checkPlanUsers(ctx))
+	})
+
+	t.Run("login history retention", func(t *testing.T) {
+		db := &mstore.DataStore{}
+		db.On("GetPlan", ContextMatcher()).Return(os, nil)
+		useradm := NewUserAdm(nil, db, nil, Config{})
+
+		recent := model.LoginEvent{Timestamp: time.Now().Add(-time.Hour)}
+		old := model.LoginEvent{Timestamp: time.Now().AddDate(0, 0, -8)}
+
+		events, err := useradm.planLoginHistory(ctx, []model.LoginEvent{recent, old})
+		assert.NoError(t, err)
+		assert.Equal(t, []model.LoginEvent{recent}, events)
+	})
+
+	t.Run("sync plan, unchanged", func(t *testing.T) {
+		db := &mstore.DataStore{}
+		db.On("GetPlan", ContextMatcher()).Return(os, nil)
+		useradm := NewUserAdm(nil, db, nil, Config{})
+
+		assert.NoError(t, useradm.syncPlan(ctx, model.PlanOpenSource))
+		db.AssertNotCalled(t, "SetPlan", mock.Anything, mock.Anything)
+	})
+
+	t.Run("sync plan, changed", func(t *testing.T) {
+		db := &mstore.DataStore{}
+		db.On("GetPlan", ContextMatcher()).Return(os, nil)
+		db.On("SetPlan", ContextMatcher(),
+			&model.Plan{Name: model.PlanEnterprise}).Return(nil)
+		useradm := NewUserAdm(nil, db, nil, Config{})
+
+		assert.NoError(t, useradm.syncPlan(ctx, model.PlanEnterprise))
+		db.AssertExpectations(t)
+	})
+}
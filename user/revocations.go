@@ -0,0 +1,104 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+// a revocation running for longer was most likely abandoned by a stopped
+// instance of the service, and is taken over by another
+const tokenRevocationTimeout = 10 * time.Minute
+
+// RevokeTokens rejects the tokens of the tenant's users, or of the given
+// user, from now on, and schedules their removal by
+// ProcessTokenRevocations.
+// The revocation has the precision of a second: tokens issued in the
+// same second as it are rejected too.
+func (ua *UserAdm) RevokeTokens(ctx context.Context, tenantId, userId string) (*model.TokenRevocation, error) {
+	tenantCtx := identity.WithContext(ctx, &identity.Identity{
+		Tenant: tenantId,
+	})
+
+	now := time.Now().UTC()
+	if err := ua.db.RevokeTokens(tenantCtx, userId, now); err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to revoke tokens")
+	}
+
+	r := &model.TokenRevocation{
+		ID:        uuid.NewV4().String(),
+		TenantID:  tenantId,
+		UserID:    userId,
+		Status:    model.RevocationStatusPending,
+		CreatedTs: now,
+	}
+	if err := ua.db.SaveTokenRevocation(ctx, r); err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to schedule token removal")
+	}
+	return r, nil
+}
+
+func (ua *UserAdm) GetTokenRevocation(ctx context.Context, id string) (*model.TokenRevocation, error) {
+	r, err := ua.db.GetTokenRevocation(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get token revocation")
+	}
+	return r, nil
+}
+
+// ProcessTokenRevocations removes the tokens of the pending revocations,
+// one at a time until there are none left
+func (ua *UserAdm) ProcessTokenRevocations(ctx context.Context) error {
+	l := log.FromContext(ctx)
+
+	var failed error
+	for {
+		now := time.Now().UTC()
+		r, err := ua.db.ClaimTokenRevocation(ctx, now, now.Add(-tokenRevocationTimeout))
+		if err != nil {
+			return errors.Wrap(err, "useradm: failed to get token revocation")
+		}
+		if r == nil {
+			return failed
+		}
+
+		err = ua.DeleteTokens(ctx, r.TenantID, r.UserID)
+
+		finished := time.Now().UTC()
+		r.FinishedTs = &finished
+		if err != nil {
+			r.Status = model.RevocationStatusFailed
+			r.Error = err.Error()
+			if failed == nil {
+				failed = errors.Wrapf(err, "useradm: token revocation %s failed", r.ID)
+			}
+		} else {
+			r.Status = model.RevocationStatusDone
+		}
+
+		if err := ua.db.SaveTokenRevocation(ctx, r); err != nil {
+			return errors.Wrapf(err, "useradm: failed to save token revocation %s", r.ID)
+		}
+		l.Infof("token revocation %s for tenant %q, user %q: %s",
+			r.ID, r.TenantID, r.UserID, r.Status)
+	}
+}
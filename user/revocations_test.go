@@ -0,0 +1,183 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/store"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmRevokeTokens(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		tenant string
+		user   string
+
+		dbRevokeErr error
+		dbSaveErr   error
+
+		err error
+	}{
+		"ok, tenant": {
+			tenant: "foo",
+		},
+		"ok, tenant and user": {
+			tenant: "foo",
+			user:   "bar",
+		},
+		"error: revoke": {
+			tenant:      "foo",
+			dbRevokeErr: errors.New("db failed"),
+			err:         errors.New("useradm: failed to revoke tokens: db failed"),
+		},
+		"error: save": {
+			tenant:    "foo",
+			dbSaveErr: errors.New("db failed"),
+			err:       errors.New("useradm: failed to schedule token removal: db failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("RevokeTokens",
+				mock.MatchedBy(func(c context.Context) bool {
+					id := identity.FromContext(c)
+					return id != nil && id.Tenant == tc.tenant
+				}),
+				tc.user,
+				mock.AnythingOfType("time.Time")).
+				Return(tc.dbRevokeErr)
+			db.On("SaveTokenRevocation", ctx,
+				mock.MatchedBy(func(r *model.TokenRevocation) bool {
+					return r.TenantID == tc.tenant && r.UserID == tc.user &&
+						r.Status == model.RevocationStatusPending &&
+						r.ID != ""
+				})).
+				Return(tc.dbSaveErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			r, err := useradm.RevokeTokens(ctx, tc.tenant, tc.user)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, r)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.tenant, r.TenantID)
+				assert.Equal(t, tc.user, r.UserID)
+				assert.Equal(t, model.RevocationStatusPending, r.Status)
+			}
+		})
+	}
+}
+
+func TestUserAdmProcessTokenRevocations(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		revocations []*model.TokenRevocation
+		dbClaimErr  error
+		dbDeleteErr error
+
+		status string
+		err    error
+	}{
+		"ok, none": {},
+		"ok": {
+			revocations: []*model.TokenRevocation{
+				{ID: "1", TenantID: "foo"},
+				{ID: "2", TenantID: "foo", UserID: "bar"},
+			},
+			status: model.RevocationStatusDone,
+		},
+		"ok, no tokens": {
+			revocations: []*model.TokenRevocation{
+				{ID: "1", TenantID: "foo"},
+			},
+			dbDeleteErr: store.ErrTokenNotFound,
+			status:      model.RevocationStatusDone,
+		},
+		"error: delete": {
+			revocations: []*model.TokenRevocation{
+				{ID: "1", TenantID: "foo"},
+				{ID: "2", TenantID: "foo", UserID: "bar"},
+			},
+			dbDeleteErr: errors.New("db failed"),
+			status:      model.RevocationStatusFailed,
+			err: errors.New("useradm: token revocation 1 failed: " +
+				"failed to delete tokens for tenant: foo, user id: : db failed"),
+		},
+		"error: claim": {
+			dbClaimErr: errors.New("db failed"),
+			err:        errors.New("useradm: failed to get token revocation: db failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			for _, r := range tc.revocations {
+				db.On("ClaimTokenRevocation", ctx,
+					mock.AnythingOfType("time.Time"),
+					mock.AnythingOfType("time.Time")).
+					Return(r, nil).Once()
+			}
+			db.On("ClaimTokenRevocation", ctx,
+				mock.AnythingOfType("time.Time"),
+				mock.AnythingOfType("time.Time")).
+				Return(nil, tc.dbClaimErr).Once()
+			db.On("DeleteTokens", ContextMatcher()).Return(tc.dbDeleteErr)
+			db.On("DeleteTokensByUserId", ContextMatcher(), "bar").Return(tc.dbDeleteErr)
+			db.On("SaveTokenRevocation", ctx,
+				mock.AnythingOfType("*model.TokenRevocation")).
+				Return(nil)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			err := useradm.ProcessTokenRevocations(ctx)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+
+			for _, r := range tc.revocations {
+				assert.Equal(t, tc.status, r.Status)
+				assert.NotNil(t, r.FinishedTs)
+				assert.False(t, r.FinishedTs.After(time.Now()))
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/scope"
+	"github.com/mendersoftware/useradm/store"
+)
+
+func (ua *UserAdm) CreateServiceAccount(ctx context.Context,
+	a model.ServiceAccountNew) (*model.ServiceAccount, error) {
+	accountScope, err := scope.Narrow(scope.All, a.Scope)
+	if err != nil {
+		return nil, ErrInvalidScope
+	}
+
+	owner := a.Owner
+	if owner == "" {
+		if id := identity.FromContext(ctx); id != nil {
+			owner = id.Subject
+		}
+	}
+	if err := ua.checkServiceAccountOwner(ctx, owner); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	account := &model.ServiceAccount{
+		ID:          uuid.NewV4().String(),
+		Name:        a.Name,
+		Description: a.Description,
+		Scope:       accountScope,
+		Owner:       owner,
+		CreatedTs:   now,
+		UpdatedTs:   now,
+	}
+	if err := ua.db.CreateServiceAccount(ctx, account); err != nil {
+		if err == store.ErrDuplicateServiceAccountName {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "useradm: failed to create service account")
+	}
+
+	log.FromContext(ctx).F(log.Ctx{
+		"service_account_id": account.ID,
+		"owner":              owner,
+	}).Infof("service account %s created", account.Name)
+
+	return account, nil
+}
+
+func (ua *UserAdm) GetServiceAccounts(ctx context.Context) ([]model.ServiceAccount, error) {
+	accounts, err := ua.db.GetServiceAccounts(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get service accounts")
+	}
+
+	return accounts, nil
+}
+
+func (ua *UserAdm) GetServiceAccount(ctx context.Context,
+	id string) (*model.ServiceAccount, error) {
+	account, err := ua.db.GetServiceAccountById(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get service account")
+	}
+
+	return account, nil
+}
+
+func (ua *UserAdm) UpdateServiceAccount(ctx context.Context, id string,
+	u model.ServiceAccountUpdate) (*model.ServiceAccount, error) {
+	if u.Scope != nil {
+		accountScope, err := scope.Narrow(scope.All, *u.Scope)
+		if err != nil {
+			return nil, ErrInvalidScope
+		}
+		u.Scope = &accountScope
+	}
+
+	if u.Owner != nil {
+		if err := ua.checkServiceAccountOwner(ctx, *u.Owner); err != nil {
+			return nil, err
+		}
+	}
+
+	account, err := ua.db.UpdateServiceAccount(ctx, id, &u)
+	if err != nil {
+		if err == store.ErrServiceAccountNotFound {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "useradm: failed to update service account")
+	}
+
+	return account, nil
+}
+
+func (ua *UserAdm) DeleteServiceAccount(ctx context.Context, id string) error {
+	if err := ua.db.DeleteServiceAccount(ctx, id); err != nil {
+		if err == store.ErrServiceAccountNotFound {
+			return err
+		}
+		return errors.Wrap(err, "useradm: failed to delete service account")
+	}
+
+	if err := ua.db.DeleteTokensByUserId(ctx, id); err != nil && err != store.ErrTokenNotFound {
+		return errors.Wrap(err, "useradm: failed to delete service account tokens")
+	}
+
+	log.FromContext(ctx).F(log.Ctx{
+		"service_account_id": id,
+	}).Infof("service account %s deleted", id)
+
+	return nil
+}
+
+func (ua *UserAdm) IssueServiceAccountToken(ctx context.Context, id string,
+	r model.ServiceAccountTokenRequest) (*jwt.Token, error) {
+	account, err := ua.db.GetServiceAccountById(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get service account")
+	}
+	if account == nil {
+		return nil, store.ErrServiceAccountNotFound
+	}
+
+	expiresIn := ua.config.ServiceAccountExpirationTime
+	if r.ExpiresIn > 0 && r.ExpiresIn < expiresIn {
+		expiresIn = r.ExpiresIn
+	}
+
+	var tenant string
+	if ident := identity.FromContext(ctx); ident != nil {
+		tenant = ident.Tenant
+	}
+
+	t := ua.generateToken(account.ID, account.Scope, tenant)
+	t.Claims.ExpiresAt = t.Claims.IssuedAt + expiresIn
+	t.Claims.ServiceAccount = true
+
+	if err := ua.db.SaveToken(ctx, t); err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to save token")
+	}
+
+	log.FromContext(ctx).F(log.Ctx{
+		"service_account_id": account.ID,
+		"token_id":           t.Id,
+	}).Infof("token issued to service account %s", account.Name)
+
+	return t, nil
+}
+
+func (ua *UserAdm) RevokeServiceAccountTokens(ctx context.Context, id string) error {
+	account, err := ua.db.GetServiceAccountById(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get service account")
+	}
+	if account == nil {
+		return store.ErrServiceAccountNotFound
+	}
+
+	if err := ua.db.DeleteTokensByUserId(ctx, id); err != nil && err != store.ErrTokenNotFound {
+		return errors.Wrap(err, "useradm: failed to delete service account tokens")
+	}
+
+	return nil
+}
+
+// checkServiceAccountOwner makes sure the owner is one of the tenant's users
+func (ua *UserAdm) checkServiceAccountOwner(ctx context.Context, owner string) error {
+	if owner == "" {
+		return model.ErrInvalidServiceAccountOwner
+	}
+
+	user, err := ua.db.GetUserById(ctx, owner)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil {
+		return model.ErrInvalidServiceAccountOwner
+	}
+
+	return nil
+}
+
+// verifyServiceAccountToken checks the token of a service account, which
+// is valid while the account exists and still has the token's scopes
+func (ua *UserAdm) verifyServiceAccountToken(ctx context.Context, token *jwt.Token) error {
+	account, err := ua.db.GetServiceAccountById(ctx, token.Claims.Subject)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get service account")
+	}
+	if account == nil {
+		return ErrUnauthorized
+	}
+	if _, err := scope.Narrow(account.Scope, token.Claims.Scope); err != nil {
+		log.FromContext(ctx).Errorf("service account %s no longer has the scope %q",
+			account.ID, token.Claims.Scope)
+		return ErrUnauthorized
+	}
+
+	dbToken, err := ua.db.GetTokenById(ctx, token.Id)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get token")
+	}
+	if dbToken == nil {
+		return ErrUnauthorized
+	}
+
+	if token.Claims.Tenant != "" {
+		status, err := ua.db.GetTenantStatus(ctx)
+		if err != nil {
+			return errors.Wrap(err, "useradm: failed to get tenant status")
+		}
+		return ua.checkTenantStatus(ctx, status)
+	}
+	return nil
+}
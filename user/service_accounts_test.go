@@ -0,0 +1,303 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/scope"
+	"github.com/mendersoftware/useradm/store"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmCreateServiceAccount(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		account model.ServiceAccountNew
+
+		dbUser *model.User
+		dbErr  error
+
+		owner string
+		scope string
+		err   error
+	}{
+		"ok, owned by the caller": {
+			account: model.ServiceAccountNew{Name: "ci"},
+			dbUser:  &model.User{ID: "caller"},
+			owner:   "caller",
+			scope:   scope.All,
+		},
+		"ok, other owner": {
+			account: model.ServiceAccountNew{
+				Name:  "ci",
+				Scope: scope.UsersRead,
+				Owner: "user-1",
+			},
+			dbUser: &model.User{ID: "user-1"},
+			owner:  "user-1",
+			scope:  scope.UsersRead,
+		},
+		"error: operator scope": {
+			account: model.ServiceAccountNew{Name: "ci", Scope: scope.Operator},
+			err:     ErrInvalidScope,
+		},
+		"error: unknown owner": {
+			account: model.ServiceAccountNew{Name: "ci", Owner: "user-2"},
+			err:     model.ErrInvalidServiceAccountOwner,
+		},
+		"error: duplicate name": {
+			account: model.ServiceAccountNew{Name: "ci"},
+			dbUser:  &model.User{ID: "caller"},
+			dbErr:   store.ErrDuplicateServiceAccountName,
+			err:     store.ErrDuplicateServiceAccountName,
+		},
+		"error: db": {
+			account: model.ServiceAccountNew{Name: "ci"},
+			dbUser:  &model.User{ID: "caller"},
+			dbErr:   errors.New("db connection failed"),
+			err:     errors.New("useradm: failed to create service account: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ContextMatcher(), mock.AnythingOfType("string")).
+				Return(tc.dbUser, nil)
+			db.On("CreateServiceAccount", ContextMatcher(),
+				mock.AnythingOfType("*model.ServiceAccount")).Return(tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{Subject: "caller", IsUser: true})
+			account, err := useradm.CreateServiceAccount(ctx, tc.account)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, account)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEmpty(t, account.ID)
+			assert.Equal(t, tc.account.Name, account.Name)
+			assert.Equal(t, tc.owner, account.Owner)
+			assert.Equal(t, tc.scope, account.Scope)
+		})
+	}
+}
+
+func TestUserAdmUpdateServiceAccount(t *testing.T) {
+	t.Parallel()
+
+	badScope := scope.Operator
+	owner := "user-2"
+
+	testCases := map[string]struct {
+		update model.ServiceAccountUpdate
+
+		dbUser *model.User
+		dbErr  error
+
+		err error
+	}{
+		"ok": {
+			update: model.ServiceAccountUpdate{Owner: &owner},
+			dbUser: &model.User{ID: owner},
+		},
+		"error: operator scope": {
+			update: model.ServiceAccountUpdate{Scope: &badScope},
+			err:    ErrInvalidScope,
+		},
+		"error: unknown owner": {
+			update: model.ServiceAccountUpdate{Owner: &owner},
+			err:    model.ErrInvalidServiceAccountOwner,
+		},
+		"error: not found": {
+			update: model.ServiceAccountUpdate{Owner: &owner},
+			dbUser: &model.User{ID: owner},
+			dbErr:  store.ErrServiceAccountNotFound,
+			err:    store.ErrServiceAccountNotFound,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ContextMatcher(), owner).Return(tc.dbUser, nil)
+			db.On("UpdateServiceAccount", ContextMatcher(), "sa-1", &tc.update).
+				Return(&model.ServiceAccount{ID: "sa-1"}, tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			account, err := useradm.UpdateServiceAccount(context.Background(),
+				"sa-1", tc.update)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, account)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "sa-1", account.ID)
+			}
+		})
+	}
+}
+
+func TestUserAdmIssueServiceAccountToken(t *testing.T) {
+	t.Parallel()
+
+	account := &model.ServiceAccount{
+		ID:    "sa-1",
+		Name:  "ci",
+		Scope: scope.UsersRead,
+	}
+
+	testCases := map[string]struct {
+		expiresIn int64
+
+		dbAccount *model.ServiceAccount
+		dbSaveErr error
+
+		lifetime int64
+		err      error
+	}{
+		"ok, maximum": {
+			dbAccount: account,
+			lifetime:  7200,
+		},
+		"ok, shorter": {
+			expiresIn: 600,
+			dbAccount: account,
+			lifetime:  600,
+		},
+		"ok, longer than allowed": {
+			expiresIn: 86400,
+			dbAccount: account,
+			lifetime:  7200,
+		},
+		"error: not found": {
+			err: store.ErrServiceAccountNotFound,
+		},
+		"error: db save": {
+			dbAccount: account,
+			dbSaveErr: errors.New("db connection failed"),
+			err:       errors.New("useradm: failed to save token: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("GetServiceAccountById", ContextMatcher(), "sa-1").
+				Return(tc.dbAccount, nil)
+			db.On("SaveToken", ContextMatcher(),
+				mock.AnythingOfType("*jwt.Token")).Return(tc.dbSaveErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{
+				ExpirationTime:               3600,
+				ServiceAccountExpirationTime: 7200,
+			})
+
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{Subject: "caller", Tenant: "tenant-1"})
+			token, err := useradm.IssueServiceAccountToken(ctx, "sa-1",
+				model.ServiceAccountTokenRequest{ExpiresIn: tc.expiresIn})
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, token)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "sa-1", token.Claims.Subject)
+			assert.Equal(t, "tenant-1", token.Claims.Tenant)
+			assert.Equal(t, scope.UsersRead, token.Claims.Scope)
+			assert.Equal(t, tc.lifetime, token.Claims.ExpiresAt-token.Claims.IssuedAt)
+			assert.True(t, token.Claims.ServiceAccount)
+			assert.True(t, token.Claims.User)
+		})
+	}
+}
+
+func TestUserAdmVerifyServiceAccountToken(t *testing.T) {
+	t.Parallel()
+
+	token := &jwt.Token{
+		Id: "token-1",
+		Claims: jwt.Claims{
+			ID:             "token-1",
+			Subject:        "sa-1",
+			Issuer:         "mender",
+			Scope:          scope.UsersWrite,
+			User:           true,
+			ServiceAccount: true,
+		},
+	}
+
+	testCases := map[string]struct {
+		dbAccount *model.ServiceAccount
+		dbToken   *jwt.Token
+
+		err error
+	}{
+		"ok": {
+			dbAccount: &model.ServiceAccount{ID: "sa-1", Scope: scope.UsersWrite},
+			dbToken:   token,
+		},
+		"error: account removed": {
+			err: ErrUnauthorized,
+		},
+		"error: scope taken away": {
+			dbAccount: &model.ServiceAccount{ID: "sa-1", Scope: scope.UsersRead},
+			dbToken:   token,
+			err:       ErrUnauthorized,
+		},
+		"error: token revoked": {
+			dbAccount: &model.ServiceAccount{ID: "sa-1", Scope: scope.All},
+			err:       ErrUnauthorized,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("GetServiceAccountById", ContextMatcher(), "sa-1").
+				Return(tc.dbAccount, nil)
+			db.On("GetTokenById", ContextMatcher(), "token-1").
+				Return(tc.dbToken, nil)
+
+			useradm := NewUserAdm(nil, db, nil, Config{Issuer: "mender"})
+
+			err := useradm.Verify(context.Background(), token)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			db.AssertNotCalled(t, "GetUserById", mock.Anything, mock.Anything)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+)
+
+const (
+	// the access tokens are self-contained JWTs
+	TokenFormatJWT = "jwt"
+	// the access tokens are references to the sessions kept server-side,
+	// which are gone with their tokens
+	TokenFormatOpaque = "opaque"
+)
+
+// encodeToken returns what the client gets for the access token: the JWT,
+// or with opaque tokens the reference to the token's session
+func (ua *UserAdm) encodeToken(ctx context.Context, t *jwt.Token) (string, error) {
+	if ua.config.TokenFormat != TokenFormatOpaque {
+		return ua.jwtHandler.ToJWT(t)
+	}
+
+	ref, err := randomHex(32)
+	if err != nil {
+		return "", errors.Wrap(err, "useradm: failed to generate token reference")
+	}
+	err = ua.db.SaveSession(ctx, &model.Session{
+		ID:        hashClientSecret(ref),
+		TenantID:  t.Claims.Tenant,
+		TokenID:   t.Id,
+		ExpiresTs: time.Unix(t.Claims.ExpiresAt, 0).UTC(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "useradm: failed to save session")
+	}
+	return ref, nil
+}
+
+// parseToken returns the token the client presented, either a JWT or the
+// reference to a session; the JWTs are accepted with opaque tokens too, so
+// that the tokens issued before switching the format stay valid, unless
+// Config.RejectJWT is set once they expired
+func (ua *UserAdm) parseToken(ctx context.Context, raw string) (*jwt.Token, error) {
+	if !isOpaqueToken(raw) {
+		if ua.config.TokenFormat == TokenFormatOpaque && ua.config.RejectJWT {
+			return nil, jwt.ErrTokenInvalid
+		}
+		return ua.jwtHandler.FromJWT(raw)
+	}
+
+	s, err := ua.db.GetSession(ctx, hashClientSecret(raw))
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get session")
+	}
+	if s == nil {
+		return nil, jwt.ErrTokenInvalid
+	}
+	leeway := time.Duration(ua.config.Leeway) * time.Second
+	if time.Now().After(s.ExpiresTs.Add(leeway)) {
+		return nil, jwt.ErrTokenExpired
+	}
+
+	ctx = identity.WithContext(ctx, &identity.Identity{Tenant: s.TenantID})
+	t, err := ua.db.GetTokenById(ctx, s.TokenID)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get token")
+	}
+	// the token was revoked or its user removed
+	if t == nil {
+		return nil, jwt.ErrTokenInvalid
+	}
+	if err := t.Claims.ValidAt(time.Now(), leeway); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// isOpaqueToken tells the references apart from the JWTs, which have
+// three dot-separated parts
+func isOpaqueToken(raw string) bool {
+	return raw != "" && !strings.Contains(raw, ".")
+}
+
+// TokenHandler returns the handler the middlewares parse the tokens of the
+// requests with, which resolves the opaque tokens along with the JWTs
+func (ua *UserAdm) TokenHandler() jwt.Handler {
+	return &tokenHandler{Handler: ua.jwtHandler, ua: ua}
+}
+
+type tokenHandler struct {
+	jwt.Handler
+	ua *UserAdm
+}
+
+// FromJWT resolves the opaque tokens too, outside of any request
+func (h *tokenHandler) FromJWT(raw string) (*jwt.Token, error) {
+	return h.ua.parseToken(context.Background(), raw)
+}
+
+// FromJWTWithContext resolves the opaque tokens in the context of the
+// request, keeping its logger and ID
+func (h *tokenHandler) FromJWTWithContext(ctx context.Context, raw string) (*jwt.Token, error) {
+	return h.ua.parseToken(ctx, raw)
+}
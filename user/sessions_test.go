@@ -0,0 +1,183 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/jwt"
+	mjwt "github.com/mendersoftware/useradm/jwt/mocks"
+	"github.com/mendersoftware/useradm/model"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmEncodeToken(t *testing.T) {
+	t.Parallel()
+
+	token := &jwt.Token{
+		Id: "token-1",
+		Claims: jwt.Claims{
+			ID:        "token-1",
+			Subject:   "user-1",
+			Tenant:    "tenant-1",
+			ExpiresAt: 1500003600,
+		},
+	}
+
+	// self-contained tokens by default
+	jwth := &mjwt.Handler{}
+	jwth.On("ToJWT", token).Return("header.claims.signature", nil)
+	db := &mstore.DataStore{}
+
+	useradm := NewUserAdm(jwth, db, nil, Config{})
+	raw, err := useradm.SignToken(context.Background(), token)
+	assert.NoError(t, err)
+	assert.Equal(t, "header.claims.signature", raw)
+	db.AssertNotCalled(t, "SaveSession", mock.Anything, mock.Anything)
+
+	// the opaque tokens are references to the saved sessions
+	var saved *model.Session
+	db.On("SaveSession", ContextMatcher(), mock.AnythingOfType("*model.Session")).
+		Run(func(args mock.Arguments) {
+			saved = args.Get(1).(*model.Session)
+		}).Return(nil)
+
+	useradm = NewUserAdm(jwth, db, nil, Config{TokenFormat: TokenFormatOpaque})
+	raw, err = useradm.SignToken(context.Background(), token)
+	assert.NoError(t, err)
+	assert.Len(t, raw, 64)
+	assert.True(t, isOpaqueToken(raw))
+	assert.Equal(t, &model.Session{
+		ID:        hashClientSecret(raw),
+		TenantID:  "tenant-1",
+		TokenID:   "token-1",
+		ExpiresTs: time.Unix(1500003600, 0).UTC(),
+	}, saved)
+	jwth.AssertNumberOfCalls(t, "ToJWT", 1)
+}
+
+func TestUserAdmParseToken(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	token := &jwt.Token{
+		Id: "token-1",
+		Claims: jwt.Claims{
+			ID:        "token-1",
+			Issuer:    "mender",
+			Subject:   "user-1",
+			Tenant:    "tenant-1",
+			Scope:     "mender.*",
+			User:      true,
+			ExpiresAt: now.Add(time.Hour).Unix(),
+		},
+	}
+	session := &model.Session{
+		ID:        hashClientSecret("ref"),
+		TenantID:  "tenant-1",
+		TokenID:   "token-1",
+		ExpiresTs: now.Add(time.Hour),
+	}
+
+	testCases := map[string]struct {
+		raw       string
+		rejectJWT bool
+
+		dbSession *model.Session
+		dbToken   *jwt.Token
+
+		token *jwt.Token
+		err   error
+	}{
+		"ok: jwt": {
+			raw:   "header.claims.signature",
+			token: token,
+		},
+		"error: jwt rejected": {
+			raw:       "header.claims.signature",
+			rejectJWT: true,
+			err:       jwt.ErrTokenInvalid,
+		},
+		"ok: opaque": {
+			raw:       "ref",
+			dbSession: session,
+			dbToken:   token,
+			token:     token,
+		},
+		"error: unknown reference": {
+			raw: "ref",
+			err: jwt.ErrTokenInvalid,
+		},
+		"error: session expired": {
+			raw: "ref",
+			dbSession: &model.Session{
+				ID:        hashClientSecret("ref"),
+				TenantID:  "tenant-1",
+				TokenID:   "token-1",
+				ExpiresTs: now.Add(-time.Second),
+			},
+			err: jwt.ErrTokenExpired,
+		},
+		"error: token revoked": {
+			raw:       "ref",
+			dbSession: session,
+			err:       jwt.ErrTokenInvalid,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			jwth := &mjwt.Handler{}
+			jwth.On("FromJWT", "header.claims.signature").Return(token, nil)
+
+			// the sessions are read in the context of the request
+			ctx := requestid.WithContext(context.Background(), "test")
+			inRequest := mock.MatchedBy(func(ctx context.Context) bool {
+				return requestid.FromContext(ctx) == "test"
+			})
+
+			db := &mstore.DataStore{}
+			db.On("GetSession", inRequest, hashClientSecret("ref")).
+				Return(tc.dbSession, nil)
+			db.On("GetTokenById", mock.MatchedBy(func(ctx context.Context) bool {
+				id := identity.FromContext(ctx)
+				return id != nil && id.Tenant == "tenant-1" &&
+					requestid.FromContext(ctx) == "test"
+			}), "token-1").Return(tc.dbToken, nil)
+
+			useradm := NewUserAdm(jwth, db, nil, Config{
+				TokenFormat: TokenFormatOpaque,
+				RejectJWT:   tc.rejectJWT,
+			})
+
+			// the middlewares' handler resolves the references the same way
+			parsed, err := jwt.FromJWT(ctx, useradm.TokenHandler(), tc.raw)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, parsed)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.token, parsed)
+		})
+	}
+}
@@ -0,0 +1,454 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/schema"
+	"github.com/mendersoftware/useradm/store"
+)
+
+// maximum size of a single setting's value, JSON encoded
+const MaxSettingSize = 16 * 1024
+
+// settingValidator checks the value of a setting,
+// returns nil if the value is valid
+type settingValidator func(key string, value interface{}) *model.FieldError
+
+// settingValidators hook the validation of the settings known to useradm,
+// other keys are stored as given
+var settingValidators = map[string]settingValidator{
+	model.SettingPasswordMinLength: validateTenantSetting,
+	model.SettingSessionLength:     validateTenantSetting,
+}
+
+// userSettingValidators are the settingValidators of the user settings
+var userSettingValidators = map[string]settingValidator{
+	SettingNotificationsOptOut: validateBool,
+}
+
+// ReadOnlySettings are the settings maintained by the store
+var ReadOnlySettings = []string{"created_ts", "updated_ts", "etag"}
+
+// ReservedSettings are the keys taken by the settings API, e.g.
+// /settings/history, which would hide the settings of that name
+var ReservedSettings = []string{"history"}
+
+// WithSettingsSchema makes useradm validate the settings of tenants
+// without own schema against the given one
+func (ua *UserAdm) WithSettingsSchema(s *schema.Schema) *UserAdm {
+	ua.settingsSchema = s
+	return ua
+}
+
+func (ua *UserAdm) GetSettings(ctx context.Context) (map[string]interface{}, error) {
+	settings, err := ua.db.GetSettings(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get settings")
+	}
+
+	return settings, nil
+}
+
+func (ua *UserAdm) SaveSettings(ctx context.Context, s map[string]interface{},
+	ifMatch []string) (string, error) {
+	editor, err := ua.settingsEditor(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := validateSettings(s); err != nil {
+		return "", err
+	}
+	if err := model.TenantSettingsConflict(s); err != nil {
+		return "", model.FieldErrors{err}
+	}
+
+	sch, err := ua.settingsSchemaFor(ctx)
+	if err != nil {
+		return "", err
+	}
+	if sch != nil {
+		if err := sch.Validate("", s); err != nil {
+			return "", err
+		}
+	}
+
+	etag, err := ua.db.SaveSettings(ctx, s, ifMatch)
+	if err != nil {
+		return "", settingsStoreError(err, "useradm: failed to save settings")
+	}
+
+	log.FromContext(ctx).Infof("settings replaced by user %s, version %s",
+		editor, etag)
+
+	return etag, nil
+}
+
+func (ua *UserAdm) SaveSetting(ctx context.Context, key string, value interface{},
+	ifMatch []string) (string, error) {
+	editor, err := ua.settingsEditor(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if err := validateSettings(map[string]interface{}{key: value}); err != nil {
+		return "", err
+	}
+	if key == model.SettingMagicLinkLogin || key == model.SettingSecondFactor {
+		if err := ua.checkSettingConflict(ctx, key, value); err != nil {
+			return "", err
+		}
+	}
+
+	sch, err := ua.settingsSchemaFor(ctx)
+	if err != nil {
+		return "", err
+	}
+	if sch != nil {
+		if p, allowed := sch.Property(key); !allowed {
+			return "", model.NewFieldError(key, "is not allowed")
+		} else if p != nil {
+			if err := p.Validate(key, value); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	etag, err := ua.db.SaveSetting(ctx, key, value, ifMatch)
+	if err != nil {
+		return "", settingsStoreError(err, "useradm: failed to save setting")
+	}
+
+	log.FromContext(ctx).Infof("setting %s changed by user %s, version %s",
+		key, editor, etag)
+
+	return etag, nil
+}
+
+func (ua *UserAdm) DeleteSetting(ctx context.Context, key string,
+	ifMatch []string) (string, error) {
+	editor, err := ua.settingsEditor(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	if errs := readOnlySettingsErrors(map[string]interface{}{key: nil}); len(errs) > 0 {
+		return "", errs
+	}
+
+	sch, err := ua.settingsSchemaFor(ctx)
+	if err != nil {
+		return "", err
+	}
+	if sch != nil && sch.Requires(key) {
+		return "", model.NewFieldError(key, "is required")
+	}
+
+	etag, err := ua.db.DeleteSetting(ctx, key, ifMatch)
+	if err != nil {
+		return "", settingsStoreError(err, "useradm: failed to delete setting")
+	}
+
+	log.FromContext(ctx).Infof("setting %s removed by user %s, version %s",
+		key, editor, etag)
+
+	return etag, nil
+}
+
+func (ua *UserAdm) GetSettingsHistory(ctx context.Context) ([]model.SettingsVersion, error) {
+	versions, err := ua.db.GetSettingsHistory(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get settings history")
+	}
+
+	return versions, nil
+}
+
+func (ua *UserAdm) RollbackSettings(ctx context.Context, etag string,
+	ifMatch []string) (string, error) {
+	editor, err := ua.settingsEditor(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	newETag, err := ua.db.RollbackSettings(ctx, etag, ifMatch)
+	if err != nil {
+		return "", settingsStoreError(err, "useradm: failed to roll back settings")
+	}
+
+	log.FromContext(ctx).Infof("settings rolled back to version %s by user %s, version %s",
+		etag, editor, newETag)
+
+	return newETag, nil
+}
+
+func (ua *UserAdm) SaveSettingsSchema(ctx context.Context, s string) error {
+	if _, err := schema.Parse([]byte(s)); err != nil {
+		return errors.Wrap(err, "useradm: invalid settings schema")
+	}
+
+	if err := ua.db.SaveSettingsSchema(ctx, s); err != nil {
+		return errors.Wrap(err, "useradm: failed to save settings schema")
+	}
+
+	log.FromContext(ctx).Infof("settings schema replaced")
+
+	return nil
+}
+
+func (ua *UserAdm) GetSettingsSchema(ctx context.Context) (string, error) {
+	s, err := ua.db.GetSettingsSchema(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "useradm: failed to get settings schema")
+	}
+
+	return s, nil
+}
+
+func (ua *UserAdm) DeleteSettingsSchema(ctx context.Context) error {
+	if err := ua.db.DeleteSettingsSchema(ctx); err != nil {
+		return errors.Wrap(err, "useradm: failed to delete settings schema")
+	}
+
+	log.FromContext(ctx).Infof("settings schema removed")
+
+	return nil
+}
+
+// checkSettingConflict checks the setting against the other settings
+// of the tenant it can't be combined with
+func (ua *UserAdm) checkSettingConflict(ctx context.Context, key string,
+	value interface{}) error {
+	current, err := ua.db.GetSettings(ctx)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get settings")
+	}
+
+	settings := map[string]interface{}{key: value}
+	for _, k := range []string{model.SettingMagicLinkLogin, model.SettingSecondFactor} {
+		if _, ok := settings[k]; !ok {
+			settings[k] = current[k]
+		}
+	}
+	if err := model.TenantSettingsConflict(settings); err != nil {
+		return model.FieldErrors{err}
+	}
+	return nil
+}
+
+// settingsSchemaFor returns the schema of the tenant's settings,
+// nil if the settings aren't validated against any
+func (ua *UserAdm) settingsSchemaFor(ctx context.Context) (*schema.Schema, error) {
+	data, err := ua.db.GetSettingsSchema(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get settings schema")
+	}
+
+	if data == "" {
+		return ua.settingsSchema, nil
+	}
+
+	s, err := schema.Parse([]byte(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to parse the tenant's settings schema")
+	}
+
+	return s, nil
+}
+
+// settingsEditor returns the ID of the user changing the settings,
+// changes are only accepted from the administrators of the tenant; all
+// users are granted full permissions, so every active user is one
+func (ua *UserAdm) settingsEditor(ctx context.Context) (string, error) {
+	ident := identity.FromContext(ctx)
+	if ident == nil || ident.Subject == "" {
+		return "", ErrUnauthorized
+	}
+	if !ident.IsUser {
+		return "", ErrNotAdmin
+	}
+
+	user, err := ua.db.GetUserById(ctx, ident.Subject)
+	if err != nil {
+		return "", errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil || !user.IsActive() {
+		return "", ErrNotAdmin
+	}
+
+	return ident.Subject, nil
+}
+
+// settingsStoreError passes the errors the caller is expected to handle
+// through as is, wraps the others
+func settingsStoreError(err error, msg string) error {
+	switch err {
+	case store.ErrSettingsETagMismatch,
+		store.ErrSettingNotFound,
+		store.ErrSettingsVersionNotFound:
+		return err
+	default:
+		return errors.Wrap(err, msg)
+	}
+}
+
+// validateSettings checks the sizes of the settings and runs their
+// validators, see settingValidators
+func validateSettings(settings map[string]interface{}) error {
+	errs := readOnlySettingsErrors(settings)
+	for _, k := range ReservedSettings {
+		if _, ok := settings[k]; ok {
+			errs = append(errs, model.NewFieldError(k, "is reserved"))
+		}
+	}
+
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := validateSetting(k, settings[k]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateSetting(key string, value interface{}) *model.FieldError {
+	if err := validateSettingKeys(key, value); err != nil {
+		return err
+	}
+	if err := validateSettingSize(key, value); err != nil {
+		return err
+	}
+
+	if validate, ok := settingValidators[key]; ok {
+		return validate(key, value)
+	}
+
+	return nil
+}
+
+// validateSettingKeys rejects the keys the store can't keep, of the setting
+// and of the objects in its value
+func validateSettingKeys(key string, value interface{}) *model.FieldError {
+	if !validSettingKey(key) || !validSettingKeysIn(value) {
+		return model.NewFieldError(key, "keys must not be empty or contain '.' or '$'")
+	}
+	return nil
+}
+
+func validSettingKey(key string) bool {
+	return key != "" && !strings.ContainsAny(key, ".$")
+}
+
+func validSettingKeysIn(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			if !validSettingKey(k) || !validSettingKeysIn(e) {
+				return false
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			if !validSettingKeysIn(e) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func validateSettingSize(key string, value interface{}) *model.FieldError {
+	data, err := json.Marshal(value)
+	if err != nil || len(data) > MaxSettingSize {
+		return model.NewFieldError(key,
+			fmt.Sprintf("must not be larger than %d bytes", MaxSettingSize))
+	}
+	return nil
+}
+
+func readOnlySettingsErrors(settings map[string]interface{}) model.FieldErrors {
+	errs := model.FieldErrors{}
+
+	for _, k := range ReadOnlySettings {
+		if _, ok := settings[k]; ok {
+			errs = append(errs, model.NewFieldError(k, "field can't be modified"))
+		}
+	}
+
+	return errs
+}
+
+// validateUserSettings checks the sizes of the settings of a single user
+// and runs their validators, see userSettingValidators
+func validateUserSettings(settings map[string]interface{}) error {
+	errs := readOnlySettingsErrors(settings)
+
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if err := validateSettingKeys(k, settings[k]); err != nil {
+			errs = append(errs, err)
+		} else if err := validateSettingSize(k, settings[k]); err != nil {
+			errs = append(errs, err)
+		} else if validate, ok := userSettingValidators[k]; ok {
+			if err := validate(k, settings[k]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func validateTenantSetting(key string, value interface{}) *model.FieldError {
+	err := model.ValidateTenantSettings(map[string]interface{}{key: value})
+	if errs, ok := err.(model.FieldErrors); ok && len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func validateBool(key string, value interface{}) *model.FieldError {
+	if _, ok := value.(bool); !ok {
+		return model.NewFieldError(key, "must be a boolean")
+	}
+	return nil
+}
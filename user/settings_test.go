@@ -0,0 +1,550 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/schema"
+	"github.com/mendersoftware/useradm/store"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmSaveSettings(t *testing.T) {
+	t.Parallel()
+
+	deploymentSchema, err := schema.Parse([]byte(
+		`{"properties": {"theme": {"enum": ["light", "dark"]}}}`))
+	assert.NoError(t, err)
+
+	testCases := map[string]struct {
+		subject  string
+		settings map[string]interface{}
+		ifMatch  []string
+
+		schema   *schema.Schema
+		dbSchema string
+		dbErr    error
+
+		err error
+	}{
+		"ok": {
+			subject:  "foo",
+			settings: map[string]interface{}{"theme": "dark"},
+		},
+		"ok, if-match": {
+			subject:  "foo",
+			settings: map[string]interface{}{"theme": "dark"},
+			ifMatch:  []string{"v1"},
+		},
+		"ok, tenant settings": {
+			subject: "foo",
+			settings: map[string]interface{}{
+				"password_min_length": float64(12),
+				"session_length":      float64(3600),
+			},
+		},
+		"ok, deployment schema": {
+			subject:  "foo",
+			settings: map[string]interface{}{"theme": "dark"},
+			schema:   deploymentSchema,
+		},
+		"ok, deployment schema overridden by tenant schema": {
+			subject:  "foo",
+			settings: map[string]interface{}{"theme": "blue"},
+			schema:   deploymentSchema,
+			dbSchema: `{"properties": {"theme": {"type": "string"}}}`,
+		},
+		"error: no identity": {
+			settings: map[string]interface{}{"theme": "dark"},
+			err:      ErrUnauthorized,
+		},
+		"error: read-only": {
+			subject: "foo",
+			settings: map[string]interface{}{
+				"theme": "dark",
+				"etag":  "v1",
+			},
+			err: errors.New("etag: field can't be modified"),
+		},
+		"error: invalid tenant settings": {
+			subject: "foo",
+			settings: map[string]interface{}{
+				"password_min_length": float64(4),
+				"session_length":      "1h",
+			},
+			err: errors.New("password_min_length: must be an integer between 8 and 128; " +
+				"session_length: must be an integer between 60 and 2592000"),
+		},
+		"error: too large": {
+			subject:  "foo",
+			settings: map[string]interface{}{"theme": strings.Repeat("a", MaxSettingSize)},
+			err:      errors.New("theme: must not be larger than 16384 bytes"),
+		},
+		"error: deployment schema": {
+			subject:  "foo",
+			settings: map[string]interface{}{"theme": "blue"},
+			schema:   deploymentSchema,
+			err:      errors.New("theme: must be one of the allowed values"),
+		},
+		"error: tenant schema": {
+			subject:  "foo",
+			settings: map[string]interface{}{"theme": "blue"},
+			dbSchema: `{"properties": {"theme": {"enum": ["light", "dark"]}}}`,
+			err:      errors.New("theme: must be one of the allowed values"),
+		},
+		"error: invalid tenant schema": {
+			subject:  "foo",
+			settings: map[string]interface{}{"theme": "blue"},
+			dbSchema: `{"oneOf": []}`,
+			err: errors.New("useradm: failed to parse the tenant's settings schema: " +
+				`unsupported keyword "oneOf"`),
+		},
+		"error: magic link login with the second factor": {
+			subject: "foo",
+			settings: map[string]interface{}{
+				model.SettingMagicLinkLogin: true,
+				model.SettingSecondFactor:   model.SecondFactorEmail,
+			},
+			err: errors.New("magic_link_login: can't be enabled together with second_factor"),
+		},
+		"error: etag mismatch": {
+			subject:  "foo",
+			settings: map[string]interface{}{"theme": "dark"},
+			ifMatch:  []string{"v0"},
+			dbErr:    store.ErrSettingsETagMismatch,
+			err:      store.ErrSettingsETagMismatch,
+		},
+		"error: db": {
+			subject:  "foo",
+			settings: map[string]interface{}{"theme": "dark"},
+			dbErr:    errors.New("db connection failed"),
+			err:      errors.New("useradm: failed to save settings: db connection failed"),
+		},
+		"error: not a user": {
+			subject:  "device",
+			settings: map[string]interface{}{"theme": "dark"},
+			err:      ErrNotAdmin,
+		},
+		"error: inactive user": {
+			subject:  "inactive",
+			settings: map[string]interface{}{"theme": "dark"},
+			err:      ErrNotAdmin,
+		},
+		"error: unknown user": {
+			subject:  "unknown",
+			settings: map[string]interface{}{"theme": "dark"},
+			err:      ErrNotAdmin,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+			if tc.subject != "" {
+				ctx = identity.WithContext(ctx, &identity.Identity{
+					Subject: tc.subject,
+					IsUser:  tc.subject != "device",
+				})
+			}
+
+			db := &mstore.DataStore{}
+			mockSettingsEditor(db, tc.subject)
+			db.On("GetSettingsSchema", ContextMatcher()).Return(tc.dbSchema, nil)
+			db.On("SaveSettings", ContextMatcher(), tc.settings, tc.ifMatch).
+				Return("v2", tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{}).WithSettingsSchema(tc.schema)
+
+			etag, err := useradm.SaveSettings(ctx, tc.settings, tc.ifMatch)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				if tc.dbErr == store.ErrSettingsETagMismatch {
+					assert.Equal(t, store.ErrSettingsETagMismatch, err)
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "v2", etag)
+			}
+		})
+	}
+}
+
+func TestUserAdmSaveSetting(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		subject string
+		key     string
+		value   interface{}
+
+		dbSettings map[string]interface{}
+		dbSchema   string
+		dbErr      error
+
+		err error
+	}{
+		"ok": {
+			subject: "foo",
+			key:     "theme",
+			value:   "dark",
+		},
+		"ok, magic link login": {
+			subject:    "foo",
+			key:        model.SettingMagicLinkLogin,
+			value:      true,
+			dbSettings: map[string]interface{}{"theme": "dark"},
+		},
+		"error: magic link login with the second factor": {
+			subject: "foo",
+			key:     model.SettingMagicLinkLogin,
+			value:   true,
+			dbSettings: map[string]interface{}{
+				model.SettingSecondFactor: model.SecondFactorEmail,
+			},
+			err: errors.New("magic_link_login: can't be enabled together with second_factor"),
+		},
+		"error: second factor with magic link login": {
+			subject: "foo",
+			key:     model.SettingSecondFactor,
+			value:   model.SecondFactorSMS,
+			dbSettings: map[string]interface{}{
+				model.SettingMagicLinkLogin: true,
+			},
+			err: errors.New("magic_link_login: can't be enabled together with second_factor"),
+		},
+		"ok, tenant schema": {
+			subject:  "foo",
+			key:      "page_size",
+			value:    float64(20),
+			dbSchema: `{"properties": {"page_size": {"type": "integer"}}}`,
+		},
+		"error: no identity": {
+			key:   "theme",
+			value: "dark",
+			err:   ErrUnauthorized,
+		},
+		"error: read-only": {
+			subject: "foo",
+			key:     "updated_ts",
+			value:   "2018-01-01T00:00:00Z",
+			err:     errors.New("updated_ts: field can't be modified"),
+		},
+		"error: reserved": {
+			subject: "foo",
+			key:     "history",
+			value:   "dark",
+			err:     errors.New("history: is reserved"),
+		},
+		"error: invalid key": {
+			subject: "foo",
+			key:     "ui.theme",
+			value:   "dark",
+			err:     errors.New("ui.theme: keys must not be empty or contain '.' or '$'"),
+		},
+		"error: invalid known setting": {
+			subject: "foo",
+			key:     model.SettingSessionLength,
+			value:   "foo",
+			err:     errors.New("session_length: must be an integer between 60 and 2592000"),
+		},
+		"error: tenant schema": {
+			subject:  "foo",
+			key:      "page_size",
+			value:    "twenty",
+			dbSchema: `{"properties": {"page_size": {"type": "integer"}}}`,
+			err:      errors.New("page_size: must be of type integer"),
+		},
+		"error: not allowed by tenant schema": {
+			subject:  "foo",
+			key:      "theme",
+			value:    "dark",
+			dbSchema: `{"properties": {}, "additionalProperties": false}`,
+			err:      errors.New("theme: is not allowed"),
+		},
+		"error: db": {
+			subject: "foo",
+			key:     "theme",
+			value:   "dark",
+			dbErr:   errors.New("db connection failed"),
+			err:     errors.New("useradm: failed to save setting: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+			if tc.subject != "" {
+				ctx = identity.WithContext(ctx, &identity.Identity{
+					Subject: tc.subject,
+					IsUser:  tc.subject != "device",
+				})
+			}
+
+			db := &mstore.DataStore{}
+			mockSettingsEditor(db, tc.subject)
+			db.On("GetSettings", ContextMatcher()).Return(tc.dbSettings, nil)
+			db.On("GetSettingsSchema", ContextMatcher()).Return(tc.dbSchema, nil)
+			db.On("SaveSetting", ContextMatcher(), tc.key, tc.value, []string(nil)).
+				Return("v2", tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			etag, err := useradm.SaveSetting(ctx, tc.key, tc.value, nil)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				if tc.dbErr == nil {
+					db.AssertNotCalled(t, "SaveSetting", ContextMatcher(), tc.key,
+						tc.value, []string(nil))
+				}
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "v2", etag)
+			}
+		})
+	}
+}
+
+func TestUserAdmDeleteSetting(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		subject string
+		key     string
+
+		dbSchema string
+		dbErr    error
+
+		err error
+	}{
+		"ok": {
+			subject: "foo",
+			key:     "theme",
+		},
+		"error: no identity": {
+			key: "theme",
+			err: ErrUnauthorized,
+		},
+		"error: read-only": {
+			subject: "foo",
+			key:     "created_ts",
+			err:     errors.New("created_ts: field can't be modified"),
+		},
+		"error: required by tenant schema": {
+			subject:  "foo",
+			key:      "theme",
+			dbSchema: `{"required": ["theme"]}`,
+			err:      errors.New("theme: is required"),
+		},
+		"error: not found": {
+			subject: "foo",
+			key:     "theme",
+			dbErr:   store.ErrSettingNotFound,
+			err:     store.ErrSettingNotFound,
+		},
+		"error: db": {
+			subject: "foo",
+			key:     "theme",
+			dbErr:   errors.New("db connection failed"),
+			err:     errors.New("useradm: failed to delete setting: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+			if tc.subject != "" {
+				ctx = identity.WithContext(ctx, &identity.Identity{
+					Subject: tc.subject,
+					IsUser:  tc.subject != "device",
+				})
+			}
+
+			db := &mstore.DataStore{}
+			mockSettingsEditor(db, tc.subject)
+			db.On("GetSettingsSchema", ContextMatcher()).Return(tc.dbSchema, nil)
+			db.On("DeleteSetting", ContextMatcher(), tc.key, []string(nil)).
+				Return("v2", tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			etag, err := useradm.DeleteSetting(ctx, tc.key, nil)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "v2", etag)
+			}
+		})
+	}
+}
+
+func TestUserAdmRollbackSettings(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		subject string
+
+		dbErr error
+
+		err error
+	}{
+		"ok": {
+			subject: "foo",
+		},
+		"error: no identity": {
+			err: ErrUnauthorized,
+		},
+		"error: version not found": {
+			subject: "foo",
+			dbErr:   store.ErrSettingsVersionNotFound,
+			err:     store.ErrSettingsVersionNotFound,
+		},
+		"error: db": {
+			subject: "foo",
+			dbErr:   errors.New("db connection failed"),
+			err:     errors.New("useradm: failed to roll back settings: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+			if tc.subject != "" {
+				ctx = identity.WithContext(ctx, &identity.Identity{
+					Subject: tc.subject,
+					IsUser:  tc.subject != "device",
+				})
+			}
+
+			db := &mstore.DataStore{}
+			mockSettingsEditor(db, tc.subject)
+			db.On("RollbackSettings", ContextMatcher(), "v1", []string{"v2"}).
+				Return("v3", tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			etag, err := useradm.RollbackSettings(ctx, "v1", []string{"v2"})
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "v3", etag)
+			}
+		})
+	}
+}
+
+func TestUserAdmSaveSettingsSchema(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		schema string
+
+		dbErr error
+
+		err error
+	}{
+		"ok": {
+			schema: `{"type": "object", "required": ["theme"]}`,
+		},
+		"error: invalid schema": {
+			schema: `{"allOf": []}`,
+			err:    errors.New(`useradm: invalid settings schema: unsupported keyword "allOf"`),
+		},
+		"error: db": {
+			schema: `{"type": "object"}`,
+			dbErr:  errors.New("db connection failed"),
+			err:    errors.New("useradm: failed to save settings schema: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("SaveSettingsSchema", ContextMatcher(), tc.schema).Return(tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			err := useradm.SaveSettingsSchema(context.Background(), tc.schema)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateSettings(t *testing.T) {
+	t.Parallel()
+
+	err := validateSettings(map[string]interface{}{
+		"session_length": 10,
+		"created_ts":     "now",
+		"foo":            "bar",
+	})
+
+	assert.EqualError(t, err, "created_ts: field can't be modified; "+
+		"session_length: must be an integer between 60 and 2592000")
+
+	assert.NoError(t, validateSettings(map[string]interface{}{
+		"password_min_length": 10,
+		"foo":                 "bar",
+	}))
+
+	err = validateSettings(map[string]interface{}{
+		"history": "foo",
+		"a.b":     1,
+		"$where":  1,
+		"nested":  map[string]interface{}{"ok": []interface{}{map[string]interface{}{"x.y": 1}}},
+		"fine":    map[string]interface{}{"ok": []interface{}{"a.b"}},
+	})
+	assert.EqualError(t, err, "history: is reserved; "+
+		"$where: keys must not be empty or contain '.' or '$'; "+
+		"a.b: keys must not be empty or contain '.' or '$'; "+
+		"nested: keys must not be empty or contain '.' or '$'")
+}
+
+// mockSettingsEditor sets the user editing the settings up in the db;
+// the "inactive" and "unknown" users aren't administrators
+func mockSettingsEditor(db *mstore.DataStore, subject string) {
+	var user *model.User
+	switch subject {
+	case "unknown":
+	case "inactive":
+		user = &model.User{ID: subject, Status: model.UserStatusInactive}
+	default:
+		user = &model.User{ID: subject}
+	}
+	db.On("GetUserById", ContextMatcher(), subject).Return(user, nil)
+}
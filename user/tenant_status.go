@@ -0,0 +1,103 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"time"
+
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+func (ua *UserAdm) SetTenantStatus(ctx context.Context, status string) error {
+	current, err := ua.db.GetTenantStatus(ctx)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get tenant status")
+	}
+	// the grace period runs from the first time the status was seen
+	if current != nil && current.Status == status {
+		return nil
+	}
+
+	err = ua.db.SetTenantStatus(ctx, &model.TenantStatus{
+		Status:    status,
+		UpdatedTs: time.Now().UTC(),
+	})
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to set tenant status")
+	}
+	return nil
+}
+
+// syncTenantStatus records the tenant's status reported by tenantadm, if
+// changed, and returns the recorded one; if it can't be recorded the
+// grace period, if any, starts now
+func (ua *UserAdm) syncTenantStatus(ctx context.Context, status string) *model.TenantStatus {
+	if status == "" {
+		status = model.TenantStatusActive
+	}
+
+	l := log.FromContext(ctx)
+
+	current, err := ua.db.GetTenantStatus(ctx)
+	if err != nil {
+		l.Errorf("failed to get tenant status: %v", err)
+		return &model.TenantStatus{Status: status, UpdatedTs: time.Now()}
+	}
+	if current != nil && current.Status == status {
+		return current
+	}
+	if current == nil && status == model.TenantStatusActive {
+		return nil
+	}
+
+	if err := ua.SetTenantStatus(ctx, status); err != nil {
+		l.Errorf("failed to record tenant status: %v", err)
+	}
+	return &model.TenantStatus{Status: status, UpdatedTs: time.Now()}
+}
+
+// checkTenantStatus rejects the users of suspended tenants, and of the
+// tenants whose trial expired or whose payment is overdue once the grace
+// period is over
+func (ua *UserAdm) checkTenantStatus(ctx context.Context, status *model.TenantStatus) error {
+	if status == nil {
+		return nil
+	}
+
+	var err error
+	switch status.Status {
+	case model.TenantStatusSuspended:
+		return ErrTenantAccountSuspended
+	case model.TenantStatusTrialExpired:
+		err = ErrTenantTrialExpired
+	case model.TenantStatusPaymentOverdue:
+		err = ErrTenantPaymentOverdue
+	default:
+		return nil
+	}
+
+	graceEnd := status.UpdatedTs.Add(
+		time.Duration(ua.config.TenantGracePeriod) * time.Second)
+	if time.Now().After(graceEnd) {
+		return err
+	}
+
+	log.FromContext(ctx).Warnf("%v, access allowed until the end of "+
+		"the grace period at %s", err, graceEnd.UTC().Format(time.RFC3339))
+	return nil
+}
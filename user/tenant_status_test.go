@@ -0,0 +1,105 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmSetTenantStatus(t *testing.T) {
+	t.Parallel()
+
+	since := time.Now().Add(-24 * time.Hour)
+
+	testCases := map[string]struct {
+		status string
+
+		dbStatus    *model.TenantStatus
+		dbStatusErr error
+		dbSetErr    error
+
+		set bool
+		err error
+	}{
+		"ok, new status": {
+			status: model.TenantStatusPaymentOverdue,
+			set:    true,
+		},
+		"ok, changed": {
+			status: model.TenantStatusActive,
+			dbStatus: &model.TenantStatus{
+				Status:    model.TenantStatusPaymentOverdue,
+				UpdatedTs: since,
+			},
+			set: true,
+		},
+		"ok, unchanged": {
+			status: model.TenantStatusPaymentOverdue,
+			dbStatus: &model.TenantStatus{
+				Status:    model.TenantStatusPaymentOverdue,
+				UpdatedTs: since,
+			},
+		},
+		"error: db get": {
+			status:      model.TenantStatusPaymentOverdue,
+			dbStatusErr: errors.New("db connection failed"),
+			err:         errors.New("useradm: failed to get tenant status: db connection failed"),
+		},
+		"error: db set": {
+			status:   model.TenantStatusPaymentOverdue,
+			dbSetErr: errors.New("db connection failed"),
+			set:      true,
+			err:      errors.New("useradm: failed to set tenant status: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("GetTenantStatus", ContextMatcher()).
+				Return(tc.dbStatus, tc.dbStatusErr)
+			db.On("SetTenantStatus", ContextMatcher(),
+				mock.MatchedBy(func(s *model.TenantStatus) bool {
+					return s.Status == tc.status &&
+						time.Since(s.UpdatedTs) < time.Minute
+				})).Return(tc.dbSetErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			err := useradm.SetTenantStatus(context.Background(), tc.status)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.set {
+				db.AssertCalled(t, "SetTenantStatus", ContextMatcher(),
+					mock.Anything)
+			} else {
+				db.AssertNotCalled(t, "SetTenantStatus", mock.Anything,
+					mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+
+	"github.com/mendersoftware/go-lib-micro/identity"
+	"github.com/mendersoftware/go-lib-micro/log"
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/scope"
+)
+
+// ExchangeToken exchanges the user's token for one the client acts with on
+// the user's behalf, see RFC 8693; the token gets the requested scopes both
+// the user's token and the client have, and expires no later than the
+// user's token
+func (ua *UserAdm) ExchangeToken(ctx context.Context,
+	e model.TokenExchange) (*model.AccessToken, error) {
+	client, err := ua.authenticateClient(ctx, e.ClientID, e.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if !model.IsExchangeTokenType(e.SubjectTokenType) ||
+		(e.RequestedTokenType != "" && !model.IsExchangeTokenType(e.RequestedTokenType)) {
+		return nil, ErrUnsupportedTokenType
+	}
+
+	subject, err := ua.parseToken(ctx, e.SubjectToken)
+	if err != nil {
+		return nil, ErrInvalidSubjectToken
+	}
+	// only the users' own tokens are exchanged, and only by the clients
+	// of the users' tenant
+	if subject.Claims.Client || subject.Claims.ServiceAccount ||
+		subject.Claims.Tenant != client.TenantID {
+		return nil, ErrInvalidSubjectToken
+	}
+
+	ctx = identity.WithContext(ctx, &identity.Identity{
+		Subject: subject.Claims.Subject,
+		Tenant:  subject.Claims.Tenant,
+		IsUser:  true,
+	})
+
+	switch err := ua.Verify(ctx, subject); err {
+	case nil:
+	case ErrUnauthorized, jwt.ErrTokenInvalid:
+		return nil, ErrInvalidSubjectToken
+	default:
+		return nil, err
+	}
+
+	tokenScope, err := scope.Narrow(subject.Claims.Scope, e.Scope)
+	if err != nil {
+		return nil, ErrInvalidScope
+	}
+	if _, err := scope.Narrow(client.Scope, tokenScope); err != nil {
+		return nil, ErrInvalidScope
+	}
+
+	t := ua.generateToken(subject.Claims.Subject, tokenScope, subject.Claims.Tenant)
+	t.Claims.Groups = subject.Claims.Groups
+	t.Claims.Impersonator = subject.Claims.Impersonator
+	t.Claims.Actor = &jwt.Actor{
+		Subject: client.ID,
+		Actor:   subject.Claims.Actor,
+	}
+	t.Claims.ExpiresAt = t.Claims.IssuedAt + ua.config.TokenExchangeExpirationTime
+	if subject.Claims.ExpiresAt < t.Claims.ExpiresAt {
+		t.Claims.ExpiresAt = subject.Claims.ExpiresAt
+	}
+
+	if err := ua.db.SaveToken(ctx, t); err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to save token")
+	}
+
+	raw, err := ua.encodeToken(ctx, t)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to sign token")
+	}
+
+	issuedType := e.RequestedTokenType
+	if issuedType == "" {
+		issuedType = model.TokenTypeAccessToken
+	}
+
+	log.FromContext(ctx).F(log.Ctx{
+		"client_id":        client.ID,
+		"user_id":          subject.Claims.Subject,
+		"token_id":         t.Id,
+		"subject_token_id": subject.Id,
+	}).Infof("token of user %s exchanged by client %s", subject.Claims.Subject, client.Name)
+
+	return &model.AccessToken{
+		AccessToken:     raw,
+		TokenType:       model.TokenTypeBearer,
+		ExpiresIn:       t.Claims.ExpiresAt - t.Claims.IssuedAt,
+		Scope:           tokenScope,
+		IssuedTokenType: issuedType,
+	}, nil
+}
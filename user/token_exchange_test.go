@@ -0,0 +1,250 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	mct "github.com/mendersoftware/useradm/client/tenant/mocks"
+	"github.com/mendersoftware/useradm/jwt"
+	mjwt "github.com/mendersoftware/useradm/jwt/mocks"
+	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/scope"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+func TestUserAdmExchangeToken(t *testing.T) {
+	t.Parallel()
+
+	client := &model.OAuthClient{
+		ID:         "client-1",
+		TenantID:   "tenant-1",
+		Name:       "reports",
+		Scope:      scope.UsersRead + " " + scope.SettingsRead,
+		SecretHash: hashClientSecret("secret"),
+	}
+	exchange := model.TokenExchange{
+		ClientID:         "client-1",
+		ClientSecret:     "secret",
+		SubjectToken:     "header.claims.signature",
+		SubjectTokenType: model.TokenTypeAccessToken,
+		Scope:            scope.UsersRead,
+	}
+	now := time.Now().Unix()
+
+	testCases := map[string]struct {
+		exchange func(e *model.TokenExchange)
+		subject  func(c *jwt.Claims)
+
+		subjectErr error
+		dbUser     *model.User
+		dbToken    *jwt.Token
+		dbStatus   *model.TenantStatus
+
+		err       error
+		expiresIn int64
+		actor     *jwt.Actor
+		issued    string
+	}{
+		"ok": {
+			dbUser:    &model.User{ID: "user-1"},
+			dbToken:   &jwt.Token{Id: "token-1"},
+			expiresIn: 300,
+			actor:     &jwt.Actor{Subject: "client-1"},
+			issued:    model.TokenTypeAccessToken,
+		},
+		"ok: jwt requested, token expiring sooner": {
+			exchange: func(e *model.TokenExchange) {
+				e.SubjectTokenType = model.TokenTypeJWT
+				e.RequestedTokenType = model.TokenTypeJWT
+			},
+			subject: func(c *jwt.Claims) {
+				c.ExpiresAt = now + 60
+			},
+			dbUser:    &model.User{ID: "user-1"},
+			dbToken:   &jwt.Token{Id: "token-1"},
+			expiresIn: 60,
+			actor:     &jwt.Actor{Subject: "client-1"},
+			issued:    model.TokenTypeJWT,
+		},
+		"ok: exchanged before": {
+			subject: func(c *jwt.Claims) {
+				c.Actor = &jwt.Actor{Subject: "client-0"}
+			},
+			dbUser:    &model.User{ID: "user-1"},
+			dbToken:   &jwt.Token{Id: "token-1"},
+			expiresIn: 300,
+			actor: &jwt.Actor{
+				Subject: "client-1",
+				Actor:   &jwt.Actor{Subject: "client-0"},
+			},
+			issued: model.TokenTypeAccessToken,
+		},
+		"error: wrong secret": {
+			exchange: func(e *model.TokenExchange) {
+				e.ClientSecret = "wrong"
+			},
+			err: ErrInvalidClient,
+		},
+		"error: unsupported subject token type": {
+			exchange: func(e *model.TokenExchange) {
+				e.SubjectTokenType = "urn:ietf:params:oauth:token-type:id_token"
+			},
+			err: ErrUnsupportedTokenType,
+		},
+		"error: unsupported requested token type": {
+			exchange: func(e *model.TokenExchange) {
+				e.RequestedTokenType = "urn:ietf:params:oauth:token-type:refresh_token"
+			},
+			err: ErrUnsupportedTokenType,
+		},
+		"error: subject token expired": {
+			subjectErr: jwt.ErrTokenExpired,
+			err:        ErrInvalidSubjectToken,
+		},
+		"error: token of another tenant": {
+			subject: func(c *jwt.Claims) {
+				c.Tenant = "tenant-2"
+			},
+			err: ErrInvalidSubjectToken,
+		},
+		"error: token of a client": {
+			subject: func(c *jwt.Claims) {
+				c.Subject = "client-2"
+				c.Client = true
+			},
+			err: ErrInvalidSubjectToken,
+		},
+		"error: subject token removed": {
+			dbUser: &model.User{ID: "user-1"},
+			err:    ErrInvalidSubjectToken,
+		},
+		"error: user removed": {
+			err: ErrInvalidSubjectToken,
+		},
+		"error: tenant suspended": {
+			dbUser:  &model.User{ID: "user-1"},
+			dbToken: &jwt.Token{Id: "token-1"},
+			dbStatus: &model.TenantStatus{
+				Status:    model.TenantStatusSuspended,
+				UpdatedTs: time.Now(),
+			},
+			err: ErrTenantAccountSuspended,
+		},
+		"error: scope not granted to the user": {
+			exchange: func(e *model.TokenExchange) {
+				e.Scope = scope.UsersWrite
+			},
+			dbUser:  &model.User{ID: "user-1"},
+			dbToken: &jwt.Token{Id: "token-1"},
+			err:     ErrInvalidScope,
+		},
+		"error: scope not granted to the client": {
+			exchange: func(e *model.TokenExchange) {
+				e.Scope = ""
+			},
+			dbUser:  &model.User{ID: "user-1"},
+			dbToken: &jwt.Token{Id: "token-1"},
+			err:     ErrInvalidScope,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			e := exchange
+			if tc.exchange != nil {
+				tc.exchange(&e)
+			}
+			subject := &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					ID:        "token-1",
+					Issuer:    "mender",
+					Subject:   "user-1",
+					Tenant:    "tenant-1",
+					Scope:     scope.UsersRead + " " + scope.SettingsWrite,
+					User:      true,
+					Groups:    []string{"ops"},
+					IssuedAt:  now - 60,
+					ExpiresAt: now + 3600,
+				},
+			}
+			if tc.subject != nil {
+				tc.subject(&subject.Claims)
+			}
+
+			db := &mstore.DataStore{}
+			db.On("GetOAuthClientById", ContextMatcher(), "client-1").
+				Return(client, nil)
+			db.On("GetUserById", ContextMatcher(), "user-1").
+				Return(tc.dbUser, nil)
+			db.On("GetTenantStatus", ContextMatcher()).Return(tc.dbStatus, nil)
+			db.On("GetTokenById", ContextMatcher(), "token-1").
+				Return(tc.dbToken, nil)
+			db.On("GetTokensRevokedTs", ContextMatcher(), "user-1").
+				Return(time.Time{}, nil)
+			db.On("SaveToken", ContextMatcher(),
+				mock.AnythingOfType("*jwt.Token")).Return(nil)
+
+			var issued *jwt.Token
+			jwth := &mjwt.Handler{}
+			if tc.subjectErr != nil {
+				jwth.On("FromJWT", "header.claims.signature").Return(nil, tc.subjectErr)
+			} else {
+				jwth.On("FromJWT", "header.claims.signature").Return(subject, nil)
+			}
+			jwth.On("ToJWT", mock.AnythingOfType("*jwt.Token")).
+				Run(func(args mock.Arguments) {
+					issued = args.Get(0).(*jwt.Token)
+				}).Return("exchanged", nil)
+
+			useradm := NewUserAdm(jwth, db, nil, Config{
+				Issuer:                      "mender",
+				ExpirationTime:              3600,
+				TokenExchangeExpirationTime: 300,
+			}).WithTenantVerification(&mct.TenantVerifier{})
+
+			token, err := useradm.ExchangeToken(context.Background(), e)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, token)
+				db.AssertNotCalled(t, "SaveToken", ContextMatcher(),
+					mock.AnythingOfType("*jwt.Token"))
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "exchanged", token.AccessToken)
+			assert.Equal(t, model.TokenTypeBearer, token.TokenType)
+			assert.Equal(t, scope.UsersRead, token.Scope)
+			assert.Equal(t, tc.issued, token.IssuedTokenType)
+			assert.InDelta(t, tc.expiresIn, token.ExpiresIn, 1)
+
+			assert.NotEqual(t, subject.Id, issued.Id)
+			assert.Equal(t, "user-1", issued.Claims.Subject)
+			assert.Equal(t, "tenant-1", issued.Claims.Tenant)
+			assert.Equal(t, scope.UsersRead, issued.Claims.Scope)
+			assert.True(t, issued.Claims.User)
+			assert.Equal(t, []string{"ops"}, issued.Claims.Groups)
+			assert.Equal(t, tc.actor, issued.Claims.Actor)
+			assert.True(t, issued.Claims.ExpiresAt <= subject.Claims.ExpiresAt)
+			db.AssertCalled(t, "SaveToken", ContextMatcher(), issued)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/mendersoftware/useradm/model"
+)
+
+// UsageReporter emits the usage of the tenants, e.g. to the billing service
+type UsageReporter interface {
+	ReportUserCounts(ctx context.Context, counts []model.UserCount) error
+}
+
+func (ua *UserAdm) WithUsageReporter(r UsageReporter) *UserAdm {
+	ua.usage = r
+	return ua
+}
+
+func (ua *UserAdm) GetUserCounts(ctx context.Context) ([]model.UserCount, error) {
+	counts, err := ua.db.CountUsersByTenant(ctx,
+		time.Now().Add(-model.ActiveUsersPeriod))
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to count users")
+	}
+	return counts, nil
+}
+
+// ReportUserCounts emits the user counts of all the tenants, if there's
+// a reporter set up
+func (ua *UserAdm) ReportUserCounts(ctx context.Context) error {
+	if ua.usage == nil {
+		return nil
+	}
+
+	counts, err := ua.GetUserCounts(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := ua.usage.ReportUserCounts(ctx, counts); err != nil {
+		return errors.Wrap(err, "useradm: failed to report user counts")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2018 Northern.tech AS
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+package useradm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/mendersoftware/useradm/model"
+	mstore "github.com/mendersoftware/useradm/store/mocks"
+)
+
+type reporterFunc func(ctx context.Context, counts []model.UserCount) error
+
+func (f reporterFunc) ReportUserCounts(ctx context.Context, counts []model.UserCount) error {
+	return f(ctx, counts)
+}
+
+func TestUserAdmReportUserCounts(t *testing.T) {
+	t.Parallel()
+
+	counts := []model.UserCount{
+		{TenantID: "foo", Total: 3, Active: 2},
+	}
+
+	testCases := map[string]struct {
+		noReporter  bool
+		dbErr       error
+		reporterErr error
+
+		err error
+	}{
+		"ok": {},
+		"ok, no reporter": {
+			noReporter: true,
+		},
+		"error: db": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to count users: db connection failed"),
+		},
+		"error: reporter": {
+			reporterErr: errors.New("connection refused"),
+			err:         errors.New("useradm: failed to report user counts: connection refused"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(name, func(t *testing.T) {
+			db := &mstore.DataStore{}
+			db.On("CountUsersByTenant", ContextMatcher(),
+				mock.MatchedBy(func(since time.Time) bool {
+					return time.Since(since) >= model.ActiveUsersPeriod
+				})).Return(counts, tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			var reported []model.UserCount
+			if !tc.noReporter {
+				useradm = useradm.WithUsageReporter(reporterFunc(
+					func(ctx context.Context, c []model.UserCount) error {
+						reported = c
+						return tc.reporterErr
+					}))
+			}
+
+			err := useradm.ReportUserCounts(context.Background())
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				return
+			}
+			assert.NoError(t, err)
+			if tc.noReporter {
+				db.AssertNotCalled(t, "CountUsersByTenant", mock.Anything, mock.Anything)
+			} else {
+				assert.Equal(t, counts, reported)
+			}
+		})
+	}
+}
@@ -17,7 +17,6 @@ import (
 	"context"
 	"time"
 
-	"github.com/mendersoftware/go-lib-micro/apiclient"
 	"github.com/mendersoftware/go-lib-micro/identity"
 	"github.com/mendersoftware/go-lib-micro/log"
 	"github.com/pkg/errors"
@@ -26,8 +25,12 @@ import (
 
 	"github.com/mendersoftware/useradm/client/tenant"
 	"github.com/mendersoftware/useradm/jwt"
+	"github.com/mendersoftware/useradm/mail"
+	"github.com/mendersoftware/useradm/metrics"
 	"github.com/mendersoftware/useradm/model"
+	"github.com/mendersoftware/useradm/schema"
 	"github.com/mendersoftware/useradm/scope"
+	"github.com/mendersoftware/useradm/sms"
 	"github.com/mendersoftware/useradm/store"
 )
 
@@ -37,31 +40,261 @@ var (
 	ErrAuthInvalid            = errors.New("token is invalid")
 	ErrUserNotFound           = errors.New("user not found")
 	ErrTenantAccountSuspended = errors.New("tenant account suspended")
+	ErrTenantTrialExpired     = errors.New("tenant trial expired")
+	ErrTenantPaymentOverdue   = errors.New("tenant payment overdue")
+	ErrLastAdmin              = errors.New("cannot remove the last administrator of the tenant")
+	ErrSelfDelete             = errors.New("cannot delete own user account")
+	ErrNotAdmin               = errors.New("administrator permissions required")
+	ErrUserInactive           = errors.New("user account is inactive")
+	ErrInvalidScope           = errors.New("invalid or not granted scope requested")
+	ErrTenantHasUsers         = errors.New("tenant already has users")
+	ErrMailerNotConfigured    = errors.New("no mailer configured to send the invitation")
+	ErrInvalidClient          = errors.New("client authentication failed")
+	ErrOIDCDisabled           = errors.New("OpenID Connect is not enabled")
+	ErrInvalidRedirectURI     = errors.New("redirect URI not registered for the client")
+	ErrInvalidGrant           = errors.New("invalid or expired authorization code")
+	ErrDeviceFlowDisabled     = errors.New("device authorization grant is not enabled")
+	ErrInvalidDeviceCode      = errors.New("invalid device code")
+	ErrExpiredDeviceCode      = errors.New("device code expired")
+	ErrAuthorizationPending   = errors.New("authorization pending")
+	ErrSlowDown               = errors.New("polling too often, slow down")
+	ErrAccessDenied           = errors.New("the user denied the authorization")
+	ErrMagicLinkDisabled      = errors.New("login links are not enabled")
+	ErrOTPRequired            = errors.New("one-time login code required")
+	ErrInvalidOTP             = errors.New("invalid or expired one-time login code")
+	ErrOTPUndeliverable       = errors.New("no way to send the one-time login code")
+	ErrInvalidSubjectToken    = errors.New("invalid or expired subject token")
+	ErrUnsupportedTokenType   = errors.New("unsupported token type")
 )
 
 const (
-	TenantStatusSuspended = "suspended"
+	TenantStatusSuspended = model.TenantStatusSuspended
 )
 
 type App interface {
-	// Login accepts email/password, returns JWT
-	Login(ctx context.Context, email, pass string) (*jwt.Token, error)
+	// Login authenticates the user with either the email or the username
+	// and the password, returns JWT
+	Login(ctx context.Context, login, pass string, info model.LoginInfo) (*jwt.Token, error)
+	// Impersonate issues a token of the user to the super-admin acting
+	// as the user, recorded in the user's login history
+	Impersonate(ctx context.Context, id string, imp model.Impersonation) (*jwt.Token, error)
 	CreateUser(ctx context.Context, u *model.User) error
 	CreateUserInternal(ctx context.Context, u *model.UserInternal) error
+	// CreateUserOnce runs CreateUser at most once per idempotency key,
+	// returning the ID of the user; the retries with the key get the user
+	// created by the first request. The user is always created if the
+	// key is empty
+	CreateUserOnce(ctx context.Context, key string, u *model.User) (string, error)
+	// CreateUserInternalOnce is CreateUserOnce for CreateUserInternal
+	CreateUserInternalOnce(ctx context.Context, key string,
+		u *model.UserInternal) (string, error)
+	// BootstrapAdmin creates the user with the given email and a random
+	// password if there are no users yet
+	BootstrapAdmin(ctx context.Context, email string) error
 	UpdateUser(ctx context.Context, id string, u *model.UserUpdate) error
 	Verify(ctx context.Context, token *jwt.Token) error
-	GetUsers(ctx context.Context) ([]model.User, error)
+	GetUsers(ctx context.Context, fltr model.UserFilter) ([]model.User, error)
+	CountUsers(ctx context.Context, fltr model.UserFilter) (int, error)
+	// GetUsersVersion returns the version of the users matching the
+	// filter, see model.UsersVersion
+	GetUsersVersion(ctx context.Context, fltr model.UserFilter) (*model.UsersVersion, error)
+	// ForEachUser calls fn for every user matching the filter, see
+	// store.DataStore.ForEachUser
+	ForEachUser(ctx context.Context, fltr model.UserFilter, fn func(u *model.User) error) error
+	// GetUserData gathers everything stored about the user
+	GetUserData(ctx context.Context, id string) (*model.UserData, error)
 	GetUser(ctx context.Context, id string) (*model.User, error)
-	DeleteUser(ctx context.Context, id string) error
+	// LookupUser finds the user with given email among all tenants,
+	// or with given username in a single tenant setup; returns
+	// store.ErrUserNotFound if there's none
+	LookupUser(ctx context.Context, login string) (*model.UserLookup, error)
+	// GetLoginHistory returns the recent login attempts of the user
+	GetLoginHistory(ctx context.Context, id string) ([]model.LoginEvent, error)
+	// GetUserTokens describes the tokens issued to the user,
+	// returns store.ErrUserNotFound if there's no such user
+	GetUserTokens(ctx context.Context, id string) ([]model.TokenInfo, error)
+	// DeleteUser deletes the user; if ifMatch is not empty, only the
+	// versions of the user it lists
+	DeleteUser(ctx context.Context, id string, ifMatch []string) error
+	// DeleteOwnUser removes the user identified in the context,
+	// the password must be provided as a confirmation
+	DeleteOwnUser(ctx context.Context, password string) error
+	// GetOwnSettings returns the settings of the user identified in the context
+	GetOwnSettings(ctx context.Context) (map[string]interface{}, error)
+	// SaveOwnSettings replaces the settings of the user identified in the context,
+	// invalid settings are reported as model.FieldErrors
+	SaveOwnSettings(ctx context.Context, s map[string]interface{}) error
 	SetPassword(ctx context.Context, u model.UserUpdate) error
-
-	// SignToken generates a signed
-	// token using configuration & method set up in UserAdmApp
+	// EraseUser permanently removes all personal data of the user,
+	// the returned receipt is signed with the service's key
+	EraseUser(ctx context.Context, id string) (*model.ErasureReceipt, error)
+	// RestoreUser brings back a deleted user which wasn't purged yet
+	RestoreUser(ctx context.Context, id string) error
+	// PurgeDeletedUsers permanently removes users deleted
+	// longer than the configured retention period ago
+	PurgeDeletedUsers(ctx context.Context) error
+	// DisableExpiredUsers suspends the accounts whose expiry time has passed
+	DisableExpiredUsers(ctx context.Context) error
+	// DeleteExpiredTokens removes the tokens that can no longer be used
+	DeleteExpiredTokens(ctx context.Context) error
+	// ReconcilePendingUsers rolls back the user creations that didn't
+	// complete within the configured timeout
+	ReconcilePendingUsers(ctx context.Context) error
+
+	// AddUserEmail adds an additional email address to the user, the code
+	// to verify it is mailed to the address
+	AddUserEmail(ctx context.Context, id string, e model.UserEmailNew) (*model.UserEmail, error)
+	// VerifyUserEmail verifies the additional email address of the user
+	// with the mailed code, returns ErrInvalidVerificationCode if the code
+	// doesn't match or has expired
+	VerifyUserEmail(ctx context.Context, id, email, code string) error
+	DeleteUserEmail(ctx context.Context, id, email string) error
+	// SetPrimaryEmail makes the verified additional email address the
+	// primary one, returns ErrEmailNotVerified if it's not verified
+	SetPrimaryEmail(ctx context.Context, id, email string) error
+
+	CreateGroup(ctx context.Context, g *model.Group) error
+	GetGroups(ctx context.Context) ([]model.Group, error)
+	// GetGroup returns nil,nil if the group doesn't exist
+	GetGroup(ctx context.Context, id string) (*model.Group, error)
+	DeleteGroup(ctx context.Context, id string) error
+	GetGroupMembers(ctx context.Context, id string) ([]model.User, error)
+	AddGroupMember(ctx context.Context, groupID, userID string) error
+	RemoveGroupMember(ctx context.Context, groupID, userID string) error
+
+	// SignToken returns what the client gets for the token: the signed
+	// JWT, or the reference to its session with opaque tokens
 	SignToken(ctx context.Context, t *jwt.Token) (string, error)
 
 	DeleteTokens(ctx context.Context, tenantId, userId string) error
+	// RevokeTokens rejects the tokens of the tenant's users, or of the
+	// given user, right away and schedules their removal
+	RevokeTokens(ctx context.Context, tenantId, userId string) (*model.TokenRevocation, error)
+	// GetTokenRevocation returns nil,nil if not found
+	GetTokenRevocation(ctx context.Context, id string) (*model.TokenRevocation, error)
+	// ProcessTokenRevocations removes the tokens of the pending revocations
+	ProcessTokenRevocations(ctx context.Context) error
 
 	CreateTenant(ctx context.Context, tenant model.NewTenant) error
+	// DeleteTenant removes all data of the tenant
+	DeleteTenant(ctx context.Context, id string) error
+	// GetTenantMigrationStatus returns the DB version of the tenant
+	// and the migrations applied and pending
+	GetTenantMigrationStatus(ctx context.Context, id string) (*model.MigrationStatus, error)
+	// GetMigrationProgress returns the progress of the latest migration
+	// of all the tenants, nil if there was none
+	GetMigrationProgress(ctx context.Context) (*model.MigrationProgress, error)
+	// GetJobStatuses returns the status of the background jobs
+	// which have run
+	GetJobStatuses(ctx context.Context) ([]model.JobStatus, error)
+
+	// SetLimit sets the tenant's limit, see model.Limit
+	SetLimit(ctx context.Context, l model.Limit) error
+	// GetLimitUsage returns the tenant's limit with the current usage
+	GetLimitUsage(ctx context.Context, name string) (*model.LimitUsage, error)
+
+	// SetPlan sets the tenant's subscription plan
+	SetPlan(ctx context.Context, p model.Plan) error
+	// GetPlan returns the tenant's plan and the capabilities it gates
+	GetPlan(ctx context.Context) (*model.PlanInfo, error)
+	// SetTenantStatus records the status of the tenant's account,
+	// enforced on login and on verification
+	SetTenantStatus(ctx context.Context, status string) error
+
+	// CreateOAuthClient registers a client of the tenant, returning it
+	// with its secret, which isn't stored
+	CreateOAuthClient(ctx context.Context,
+		c model.OAuthClientNew) (*model.OAuthClientCredentials, error)
+	GetOAuthClients(ctx context.Context) ([]model.OAuthClient, error)
+	// DeleteOAuthClient removes the client along with its tokens
+	DeleteOAuthClient(ctx context.Context, id string) error
+	// IssueClientToken authenticates the client and issues it a token
+	// with the requested scopes, all the client's if empty
+	IssueClientToken(ctx context.Context, id, secret, scope string) (*jwt.Token, error)
+	// ExchangeToken authenticates the client and exchanges the user's
+	// token for a narrower one the client acts with on the user's behalf
+	ExchangeToken(ctx context.Context, e model.TokenExchange) (*model.AccessToken, error)
+
+	// GetOIDCConfiguration returns the OpenID Provider metadata,
+	// ErrOIDCDisabled if OpenID Connect isn't configured
+	GetOIDCConfiguration(ctx context.Context) (*model.OIDCConfiguration, error)
+	// GetOIDCKeys returns the keys the ID tokens are signed with
+	GetOIDCKeys(ctx context.Context) (*jwt.JWKS, error)
+	// AuthorizeOIDC issues an authorization code for the client to the
+	// user in the context
+	AuthorizeOIDC(ctx context.Context, r model.AuthorizationRequest) (string, error)
+	// ExchangeAuthCode authenticates the client and exchanges the code
+	// for the user's access and ID tokens
+	ExchangeAuthCode(ctx context.Context, e model.AuthCodeExchange) (*model.AccessToken, error)
+	// GetUserInfo returns the claims about the user in the context
+	GetUserInfo(ctx context.Context) (*model.UserInfo, error)
+
+	// StartDeviceAuthorization starts the login of a device, which the
+	// user approves with the user code, see RFC 8628
+	StartDeviceAuthorization(ctx context.Context,
+		clientID, scope string) (*model.DeviceAuthorizationResponse, error)
+	// GetDeviceAuthorization returns the pending login with the user code
+	GetDeviceAuthorization(ctx context.Context,
+		userCode string) (*model.DeviceAuthorizationInfo, error)
+	// VerifyDeviceAuthorization approves or denies the pending login
+	// as the user in the context
+	VerifyDeviceAuthorization(ctx context.Context, v model.DeviceVerification) error
+	// RequestLoginLink mails a one-time login link to the user
+	RequestLoginLink(ctx context.Context, email string) error
+	// LoginWithLink exchanges the code of the login link for a token
+	LoginWithLink(ctx context.Context, code string, info model.LoginInfo) (*jwt.Token, error)
+	// IssueDeviceToken returns the user's token once the login is
+	// approved, ErrAuthorizationPending or ErrSlowDown until then
+	IssueDeviceToken(ctx context.Context, clientID, deviceCode string) (*model.AccessToken, error)
+
+	// CreateServiceAccount creates the account, owned by the user in the
+	// context unless another owner is given
+	CreateServiceAccount(ctx context.Context, a model.ServiceAccountNew) (*model.ServiceAccount, error)
+	GetServiceAccounts(ctx context.Context) ([]model.ServiceAccount, error)
+	// GetServiceAccount returns nil,nil if there's no such account
+	GetServiceAccount(ctx context.Context, id string) (*model.ServiceAccount, error)
+	// UpdateServiceAccount changes the account's description,
+	// scope or owner
+	UpdateServiceAccount(ctx context.Context, id string,
+		u model.ServiceAccountUpdate) (*model.ServiceAccount, error)
+	// DeleteServiceAccount removes the account along with its tokens
+	DeleteServiceAccount(ctx context.Context, id string) error
+	// IssueServiceAccountToken issues a token to the service account
+	IssueServiceAccountToken(ctx context.Context, id string,
+		r model.ServiceAccountTokenRequest) (*jwt.Token, error)
+	// RevokeServiceAccountTokens removes all the tokens of the account
+	RevokeServiceAccountTokens(ctx context.Context, id string) error
+	// GetUserCounts returns the number of users, total and active,
+	// of every tenant
+	GetUserCounts(ctx context.Context) ([]model.UserCount, error)
+	// GetFeatures returns the feature flags of the tenant, the configured
+	// ones and the tenant's overrides
+	GetFeatures(ctx context.Context) (map[string]bool, error)
+	// SetFeature overrides the feature flag for the tenant
+	SetFeature(ctx context.Context, f model.Feature) error
+	// ResetFeature removes the tenant's override of the feature flag
+	ResetFeature(ctx context.Context, name string) error
+	// GetSettings returns the settings of the tenant
+	GetSettings(ctx context.Context) (map[string]interface{}, error)
+	// SaveSettings validates and replaces the settings of the tenant,
+	// returns the new version's ETag; invalid settings are reported as
+	// model.FieldErrors, see store.DataStore.SaveSettings for ifMatch
+	SaveSettings(ctx context.Context, s map[string]interface{}, ifMatch []string) (string, error)
+	// SaveSetting validates and sets a single setting, see SaveSettings
+	SaveSetting(ctx context.Context, key string, value interface{}, ifMatch []string) (string, error)
+	// DeleteSetting removes a single setting, see SaveSettings
+	DeleteSetting(ctx context.Context, key string, ifMatch []string) (string, error)
+	// GetSettingsHistory returns the replaced versions of the settings
+	GetSettingsHistory(ctx context.Context) ([]model.SettingsVersion, error)
+	// RollbackSettings restores the version of the settings with given ETag
+	RollbackSettings(ctx context.Context, etag string, ifMatch []string) (string, error)
+	// SaveSettingsSchema sets the JSON Schema the tenant's settings are
+	// validated against
+	SaveSettingsSchema(ctx context.Context, s string) error
+	// GetSettingsSchema returns the tenant's settings schema,
+	// empty if there's none
+	GetSettingsSchema(ctx context.Context) (string, error)
+	DeleteSettingsSchema(ctx context.Context) error
 }
 
 type Config struct {
@@ -69,12 +302,54 @@ type Config struct {
 	Issuer string
 	// token expiration time
 	ExpirationTime int64
-}
-
-type ApiClientGetter func() apiclient.HttpRunner
-
-func simpleApiClientGetter() apiclient.HttpRunner {
-	return &apiclient.HttpApi{}
+	// time (in seconds) the clocks of the hosts issuing and verifying the
+	// tokens may drift apart
+	Leeway int64
+	// time (in seconds) for which deleted users can be restored
+	DeletedUsersRetention int64
+	// time (in seconds) after which a user creation that didn't
+	// complete is rolled back
+	PendingUsersTimeout int64
+	// feature flags on for all tenants without an override
+	Features []string
+	// maximum expiration time of the impersonation tokens
+	ImpersonationExpirationTime int64
+	// maximum expiration time of the service accounts' tokens
+	ServiceAccountExpirationTime int64
+	// TokenFormatJWT or TokenFormatOpaque, the format of the access
+	// tokens given to the clients
+	TokenFormat string
+	// with TokenFormatOpaque, reject the JWTs issued before switching
+	// the format instead of accepting them until they expire
+	RejectJWT bool
+	// maximum expiration time of the tokens exchanged for the users'
+	TokenExchangeExpirationTime int64
+	// URL of the management API as seen by the OpenID Connect clients,
+	// which is disabled if empty
+	OIDCURL string
+	// expiration time of the OpenID Connect authorization codes
+	AuthCodeExpirationTime int64
+	// URL of the page the users approve the device logins on, the
+	// device authorization grant is disabled if empty
+	DeviceVerificationURL string
+	// expiration time of the device logins
+	DeviceCodeExpirationTime int64
+	// time (in seconds) the devices must wait between the polls
+	DeviceCodeInterval int
+	// URL of the page logging the users in with the codes of the login
+	// links, which are disabled if empty
+	MagicLinkURL string
+	// expiration time of the login links
+	MagicLinkExpirationTime int64
+	// expiration time of the one-time codes of the second factor
+	OTPExpirationTime int64
+	// tenant of the hosted operators, which may address any tenant
+	OperatorTenant string
+	// time (in seconds) the users of a tenant whose trial expired or
+	// whose payment is overdue may still log in
+	TenantGracePeriod int64
+	// allow the users additional email addresses, verified by mail
+	AdditionalEmails bool
 }
 
 type UserAdm struct {
@@ -83,9 +358,15 @@ type UserAdm struct {
 	db           store.DataStore
 	config       Config
 	verifyTenant bool
-	cTenant      tenant.ClientRunner
-	clientGetter ApiClientGetter
+	cTenant      tenant.TenantVerifier
 	tenantKeeper store.TenantDataKeeper
+	mailer       mail.Mailer
+	sms          sms.Sender
+	usage        UsageReporter
+	// settings of tenants without own schema are validated against it
+	settingsSchema *schema.Schema
+	// number of expired tokens removed, if the metrics are on
+	expiredTokens *metrics.CounterVec
 }
 
 func NewUserAdm(jwtHandler jwt.Handler, db store.DataStore,
@@ -95,42 +376,61 @@ func NewUserAdm(jwtHandler jwt.Handler, db store.DataStore,
 		jwtHandler:   jwtHandler,
 		db:           db,
 		config:       config,
-		clientGetter: simpleApiClientGetter,
+		cTenant:      tenant.NoopVerifier{},
 		tenantKeeper: tenantKeeper,
 	}
 }
 
-func (u *UserAdm) Login(ctx context.Context, email, pass string) (*jwt.Token, error) {
+func (u *UserAdm) Login(ctx context.Context, login, pass string,
+	info model.LoginInfo) (*jwt.Token, error) {
 	var ident identity.Identity
 
-	if email == "" {
+	l := log.FromContext(ctx)
+
+	if login == "" {
 		return nil, ErrUnauthorized
 	}
 
 	if u.verifyTenant {
+		// tenantadm knows the users by email only, the tenant of
+		// a username can't be found
+		if model.IsUsername(login) {
+			u.failUnknownLogin(ctx, pass, info)
+			return nil, ErrUnauthorized
+		}
+
 		// check the user's tenant
-		tenant, err := u.cTenant.GetTenant(ctx, email, u.clientGetter())
+		tenant, err := u.getTenant(ctx, login)
 
 		if err != nil {
 			return nil, errors.Wrap(err, "failed to check user's tenant")
 		}
 
 		if tenant == nil {
+			u.failUnknownLogin(ctx, pass, info)
 			return nil, ErrUnauthorized
 		}
 
-		if tenant.Status == TenantStatusSuspended {
-			return nil, ErrTenantAccountSuspended
-		}
-
 		ident.Tenant = tenant.ID
 		ctx = identity.WithContext(ctx, &ident)
+
+		status := u.syncTenantStatus(ctx, tenant.Status)
+		if err := u.checkTenantStatus(ctx, status); err != nil {
+			return nil, err
+		}
+
+		if tenant.Plan != "" {
+			if err := u.syncPlan(ctx, tenant.Plan); err != nil {
+				l.Errorf("failed to record plan of tenant %s: %v", tenant.ID, err)
+			}
+		}
 	}
 
 	//get user
-	user, err := u.db.GetUserByEmail(ctx, email)
+	user, err := u.getUserByLogin(ctx, login)
 
 	if user == nil && err == nil {
+		u.failUnknownLogin(ctx, pass, info)
 		return nil, ErrUnauthorized
 	}
 
@@ -141,20 +441,245 @@ func (u *UserAdm) Login(ctx context.Context, email, pass string) (*jwt.Token, er
 	//verify password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(pass))
 	if err != nil {
+		if err := u.db.IncFailedLogins(ctx, user.ID); err != nil {
+			l.Errorf("failed to record failed login of user %s: %v", user.ID, err)
+		}
+		u.saveLoginEvent(ctx, user.ID, model.LoginMethodPassword, info, false)
 		return nil, ErrUnauthorized
 	}
 
+	if !user.IsActive() {
+		u.saveLoginEvent(ctx, user.ID, model.LoginMethodPassword, info, false)
+		return nil, ErrUserInactive
+	}
+
+	if err := u.checkSecondFactor(ctx, user, info); err != nil {
+		if err == ErrInvalidOTP {
+			u.saveLoginEvent(ctx, user.ID, model.LoginMethodPassword, info, false)
+		}
+		return nil, err
+	}
+
+	return u.loginToken(ctx, user, ident.Tenant, model.LoginMethodPassword, info)
+}
+
+// loginToken issues the token of the authenticated user, recording the
+// login in the user's history
+func (u *UserAdm) loginToken(ctx context.Context, user *model.User, tenant, method string,
+	info model.LoginInfo) (*jwt.Token, error) {
+	l := log.FromContext(ctx)
+
+	tokenScope, err := scope.Narrow(u.userScope(tenant, user), info.Scope)
+	if err != nil {
+		return nil, ErrInvalidScope
+	}
+
+	groups, err := u.groupNames(ctx, user)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user groups")
+	}
+
+	ts, err := u.tenantSettings(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	//generate and save token
-	t := u.generateToken(user.ID, scope.All, ident.Tenant)
+	t := u.generateToken(user.ID, tokenScope, tenant)
+	t.Claims.Groups = groups
+	if ts.SessionLength > 0 {
+		t.Claims.ExpiresAt = time.Now().Unix() + ts.SessionLength
+	}
 
 	err = u.db.SaveToken(ctx, t)
 	if err != nil {
 		return nil, errors.Wrap(err, "useradm: failed to save token")
 	}
 
+	if err := u.db.SetLastLogin(ctx, user.ID, time.Now(), info.IP); err != nil {
+		l.Errorf("failed to record login of user %s: %v", user.ID, err)
+	}
+	u.saveLoginEvent(ctx, user.ID, method, info, true)
+	u.notifyNewDeviceLogin(ctx, user, info)
+
 	return t, nil
 }
 
+func (u *UserAdm) Impersonate(ctx context.Context, id string,
+	imp model.Impersonation) (*jwt.Token, error) {
+	user, err := u.db.GetUserById(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil {
+		return nil, store.ErrUserNotFound
+	}
+	if !user.IsActive() {
+		return nil, ErrUserInactive
+	}
+
+	groups, err := u.groupNames(ctx, user)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user groups")
+	}
+
+	expiresIn := u.config.ImpersonationExpirationTime
+	if imp.ExpiresIn > 0 && imp.ExpiresIn < expiresIn {
+		expiresIn = imp.ExpiresIn
+	}
+
+	var tenant string
+	if ident := identity.FromContext(ctx); ident != nil {
+		tenant = ident.Tenant
+	}
+
+	t := u.generateToken(user.ID, u.userScope(tenant, user), tenant)
+	t.Claims.Groups = groups
+	t.Claims.ExpiresAt = t.Claims.IssuedAt + expiresIn
+	t.Claims.Impersonator = imp.Actor
+
+	if err := u.db.SaveToken(ctx, t); err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to save token")
+	}
+
+	log.FromContext(ctx).F(log.Ctx{
+		"user_id":      user.ID,
+		"token_id":     t.Id,
+		"impersonator": imp.Actor,
+		"reason":       imp.Reason,
+	}).Warnf("impersonation token issued for user %s", user.ID)
+
+	event := &model.LoginEvent{
+		ID:            uuid.NewV4().String(),
+		UserID:        user.ID,
+		Timestamp:     time.Now().UTC(),
+		Success:       true,
+		Method:        model.LoginMethodImpersonation,
+		Impersonation: &model.Impersonation{Actor: imp.Actor, Reason: imp.Reason},
+	}
+	if err := u.db.SaveLoginEvent(ctx, event); err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to save login event")
+	}
+
+	return t, nil
+}
+
+// userScope returns the scopes granted to the user's tokens; all the users
+// are administrators, see checkNotLastAdmin, and the users of the operator
+// tenant are the hosted operators as well
+func (u *UserAdm) userScope(tenant string, user *model.User) string {
+	if tenant != "" && tenant == u.config.OperatorTenant {
+		return scope.All + " " + scope.Operator
+	}
+	return scope.All
+}
+
+// issueUserToken issues and saves the token of the user in the context's
+// identity to a client acting on the user's behalf, unless the tenant's
+// account isn't in good standing
+func (u *UserAdm) issueUserToken(ctx context.Context, user *model.User,
+	tenant, tokenScope string) (*jwt.Token, error) {
+	if tenant != "" {
+		status, err := u.db.GetTenantStatus(ctx)
+		if err != nil {
+			return nil, errors.Wrap(err, "useradm: failed to get tenant status")
+		}
+		if err := u.checkTenantStatus(ctx, status); err != nil {
+			return nil, err
+		}
+	}
+
+	groups, err := u.groupNames(ctx, user)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user groups")
+	}
+
+	t := u.generateToken(user.ID, tokenScope, tenant)
+	t.Claims.Groups = groups
+	if err := u.db.SaveToken(ctx, t); err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to save token")
+	}
+	return t, nil
+}
+
+// dummyPasswordHash is checked against the passwords of the logins of
+// unknown users, at the cost of the hashes of the actual passwords
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword(
+	[]byte("useradm dummy password"), bcrypt.DefaultCost)
+
+// failUnknownLogin does what a wrong password does, checking the password
+// against a dummy hash and recording the failed attempt, so the logins of
+// unknown users can't be told apart by their latency; the attempt is
+// recorded without a user, and expires with the rest of the login history
+func (u *UserAdm) failUnknownLogin(ctx context.Context, pass string, info model.LoginInfo) {
+	_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(pass))
+
+	err := u.db.IncFailedLogins(ctx, "")
+	if err != nil && err != store.ErrUserNotFound {
+		log.FromContext(ctx).Errorf("failed to record failed login: %v", err)
+	}
+	u.saveLoginEvent(ctx, "", model.LoginMethodPassword, info, false)
+}
+
+// getUserByLogin finds the user by the username or the email, whichever
+// the login is; additional emails are accepted only once verified
+func (u *UserAdm) getUserByLogin(ctx context.Context, login string) (*model.User, error) {
+	if model.IsUsername(login) {
+		return u.db.GetUserByUsername(ctx, model.NormalizeUsername(login))
+	}
+
+	email := model.NormalizeEmail(login)
+	user, err := u.db.GetUserByEmail(ctx, email)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	if !user.CanLoginWith(email) {
+		return nil, nil
+	}
+	return user, nil
+}
+
+// getTenant returns the tenant of the user with the given email, nil if
+// there's none; tenantadm knows the users created before the emails were
+// normalized by the email as it was given, so that's tried too
+func (u *UserAdm) getTenant(ctx context.Context, email string) (*tenant.Tenant, error) {
+	normalized := model.NormalizeEmail(email)
+	t, err := u.cTenant.GetTenant(ctx, normalized)
+	if err != nil || t != nil || normalized == email {
+		return t, err
+	}
+	return u.cTenant.GetTenant(ctx, email)
+}
+
+// saveLoginEvent adds a login attempt to the user's login history; failures
+// are only logged, as they must not prevent the user from logging in
+func (u *UserAdm) saveLoginEvent(ctx context.Context, userID, method string,
+	info model.LoginInfo, success bool) {
+	event := &model.LoginEvent{
+		ID:        uuid.NewV4().String(),
+		UserID:    userID,
+		Timestamp: time.Now().UTC(),
+		IP:        info.IP,
+		UserAgent: info.UserAgent,
+		Success:   success,
+		Method:    method,
+	}
+
+	if err := u.db.SaveLoginEvent(ctx, event); err != nil {
+		log.FromContext(ctx).Errorf("failed to save login event of user %s: %v",
+			userID, err)
+	}
+}
+
+// tenantSettings returns the tenant-wide settings of the tenant in context
+func (u *UserAdm) tenantSettings(ctx context.Context) (model.TenantSettings, error) {
+	settings, err := u.db.GetSettings(ctx)
+	if err != nil {
+		return model.TenantSettings{}, errors.Wrap(err, "useradm: failed to get settings")
+	}
+	return model.NewTenantSettings(settings), nil
+}
+
 func (u *UserAdm) generateToken(subject, scope, tenant string) *jwt.Token {
 	id := uuid.NewV4().String()
 
@@ -163,6 +688,7 @@ func (u *UserAdm) generateToken(subject, scope, tenant string) *jwt.Token {
 		Claims: jwt.Claims{
 			ID:        id,
 			Issuer:    u.config.Issuer,
+			IssuedAt:  time.Now().Unix(),
 			ExpiresAt: time.Now().Unix() + u.config.ExpirationTime,
 			Subject:   subject,
 			Scope:     scope,
@@ -173,10 +699,21 @@ func (u *UserAdm) generateToken(subject, scope, tenant string) *jwt.Token {
 }
 
 func (u *UserAdm) SignToken(ctx context.Context, t *jwt.Token) (string, error) {
-	return u.jwtHandler.ToJWT(t)
+	return u.encodeToken(ctx, t)
 }
 
 func (ua *UserAdm) CreateUser(ctx context.Context, u *model.User) error {
+	ts, err := ua.tenantSettings(ctx)
+	if err != nil {
+		return err
+	}
+	if err := ts.CheckPassword(u.Password); err != nil {
+		return err
+	}
+	if err := ts.CheckEmail(u.Email); err != nil {
+		return err
+	}
+
 	hash, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return errors.Wrap(err, "failed to generate password hash")
@@ -207,15 +744,36 @@ func (ua *UserAdm) doCreateUser(ctx context.Context, u *model.User, propagate bo
 		u.ID = uuid.NewV4().String()
 	}
 
+	u.Email = model.NormalizeEmail(u.Email)
+	u.Username = model.NormalizeUsername(u.Username)
+
+	if u.Status == "" {
+		u.Status = model.UserStatusActive
+	}
+
+	if err := ua.checkPlanUsers(ctx); err != nil {
+		return err
+	}
+
 	id := identity.FromContext(ctx)
 	if ua.verifyTenant && propagate {
+		// the creation is recorded until it's complete, so that
+		// a user left behind in tenantadm gets removed eventually
+		err := ua.db.CreatePendingUser(ctx, &model.PendingUser{
+			UserID:    u.ID,
+			TenantID:  id.Tenant,
+			CreatedTs: time.Now().UTC(),
+		})
+		if err != nil {
+			return errors.Wrap(err, "useradm: failed to record user creation")
+		}
+
 		tenantErr = ua.cTenant.CreateUser(ctx,
 			&tenant.User{
 				ID:       u.ID,
 				Name:     u.Email,
 				TenantID: id.Tenant,
-			},
-			ua.clientGetter())
+			})
 
 		if tenantErr != nil && tenantErr != tenant.ErrDuplicateUser {
 			return errors.Wrap(tenantErr, "useradm: failed to create user in tenantadm")
@@ -235,6 +793,7 @@ func (ua *UserAdm) doCreateUser(ctx context.Context, u *model.User, propagate bo
 			}
 			return errors.Wrap(tenantErr, "tenant data out of sync")
 		}
+		ua.completePendingUser(ctx, u.ID)
 		return store.ErrDuplicateEmail
 	}
 
@@ -249,35 +808,109 @@ func (ua *UserAdm) doCreateUser(ctx context.Context, u *model.User, propagate bo
 				err = errors.Wrap(err, compensateErr.Error())
 			}
 		}
+		if err == store.ErrUserLimitReached || err == store.ErrDuplicateUsername {
+			return err
+		}
 
 		return errors.Wrap(err, "useradm: failed to create user in the db")
 	}
 
+	if ua.verifyTenant && propagate {
+		ua.completePendingUser(ctx, u.ID)
+	}
+
 	return nil
 }
 
+// compensateTenantUser removes the user from tenantadm, completing
+// the rollback of its creation
 func (ua *UserAdm) compensateTenantUser(ctx context.Context, userId, tenantId string) error {
-	err := ua.cTenant.DeleteUser(ctx, tenantId, userId, ua.clientGetter())
+	err := ua.cTenant.DeleteUser(ctx, tenantId, userId)
 
-	if err != nil {
+	if err != nil && err != tenant.ErrUserNotFound {
 		return errors.Wrap(err, "faield to delete tenant user")
 	}
 
+	ua.completePendingUser(ctx, userId)
+
 	return nil
 }
 
+// completePendingUser drops the record of a user creation; on failure
+// the record is left to ReconcilePendingUsers, which finds the user
+// in the db and drops it again
+func (ua *UserAdm) completePendingUser(ctx context.Context, userId string) {
+	if err := ua.db.DeletePendingUser(ctx, userId); err != nil {
+		log.FromContext(ctx).Warnf("failed to remove pending user %s: %v", userId, err)
+	}
+}
+
 func (ua *UserAdm) UpdateUser(ctx context.Context, id string, u *model.UserUpdate) error {
-	if ua.verifyTenant && u.Email != "" {
+	u.Email = model.NormalizeEmail(u.Email)
+	u.Username = model.NormalizeUsername(u.Username)
+
+	deactivatedAdmin := false
+	if u.Status == model.UserStatusInactive {
+		var err error
+		deactivatedAdmin, err = ua.checkNotLastAdmin(ctx, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the current email is needed to notify the user about the change,
+	// and to revert it if tenantadm refuses it
+	var user *model.User
+	if (ua.mailer != nil && (u.Email != "" || u.Password != "")) ||
+		(ua.verifyTenant && u.Email != "") {
+		var err error
+		user, err = ua.db.GetUserById(ctx, id)
+		if err != nil {
+			return errors.Wrap(err, "useradm: failed to get user")
+		}
+		if user == nil {
+			return store.ErrUserNotFound
+		}
+	}
+	passwordChanged := u.Password != ""
+
+	if passwordChanged || u.Email != "" {
+		ts, err := ua.tenantSettings(ctx)
+		if err != nil {
+			return err
+		}
+		if passwordChanged {
+			if err := ts.CheckPassword(u.Password); err != nil {
+				return err
+			}
+		}
+		if u.Email != "" {
+			if err := ts.CheckEmail(u.Email); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := ua.db.UpdateUser(ctx, id, u); err != nil {
+		if err == store.ErrDuplicateEmail || err == store.ErrDuplicateUsername ||
+			err == store.ErrUserNotFound || err == store.ErrETagMismatch {
+			return err
+		}
+		return errors.Wrap(err, "useradm: failed to update user information")
+	}
+
+	// tenantadm is told only about changes that made it to the db
+	if ua.verifyTenant && u.Email != "" && u.Email != user.Email {
 		ident := identity.FromContext(ctx)
 		err := ua.cTenant.UpdateUser(ctx,
 			ident.Tenant,
 			id,
 			&tenant.UserUpdate{
 				Name: u.Email,
-			},
-			ua.clientGetter())
+			})
 
 		if err != nil {
+			ua.revertEmail(ctx, id, user.Email, u.ETag)
 			switch err {
 			case tenant.ErrDuplicateUser:
 				return store.ErrDuplicateEmail
@@ -288,11 +921,25 @@ func (ua *UserAdm) UpdateUser(ctx context.Context, id string, u *model.UserUpdat
 			}
 		}
 	}
-	if err := ua.db.UpdateUser(ctx, id, u); err != nil {
-		if err == store.ErrDuplicateEmail || err == store.ErrUserNotFound {
-			return err
+
+	if user != nil && ua.mailer != nil {
+		email := user.Email
+		if u.Email != "" && u.Email != user.Email {
+			ua.notifyEmailChanged(ctx, id, user.Email, u.Email)
+			email = u.Email
+		}
+		if passwordChanged {
+			ua.notifyPasswordChanged(ctx, id, email)
 		}
-		return errors.Wrap(err, "useradm: failed to update user information")
+	}
+
+	// the other changes stay, only the status is reverted
+	if deactivatedAdmin {
+		return ua.keepLastAdmin(ctx, func() error {
+			return ua.db.UpdateUser(ctx, id, &model.UserUpdate{
+				Status: model.UserStatusActive,
+			})
+		})
 	}
 
 	return nil
@@ -326,6 +973,13 @@ func (ua *UserAdm) Verify(ctx context.Context, token *jwt.Token) error {
 		return ErrUnauthorized
 	}
 
+	if token.Claims.Client {
+		return ua.verifyClientToken(ctx, token)
+	}
+	if token.Claims.ServiceAccount {
+		return ua.verifyServiceAccountToken(ctx, token)
+	}
+
 	user, err := ua.db.GetUserById(ctx, token.Claims.Subject)
 	if user == nil && err == nil {
 		return ErrUnauthorized
@@ -334,6 +988,21 @@ func (ua *UserAdm) Verify(ctx context.Context, token *jwt.Token) error {
 		return errors.Wrap(err, "useradm: failed to get user")
 	}
 
+	if !user.IsActive() {
+		l.Errorf("user %s is inactive", user.ID)
+		return ErrUnauthorized
+	}
+
+	if token.Claims.Tenant != "" {
+		status, err := ua.db.GetTenantStatus(ctx)
+		if err != nil {
+			return errors.Wrap(err, "useradm: failed to get tenant status")
+		}
+		if err := ua.checkTenantStatus(ctx, status); err != nil {
+			return err
+		}
+	}
+
 	dbToken, err := ua.db.GetTokenById(ctx, token.Id)
 	if dbToken == nil && err == nil {
 		return ErrUnauthorized
@@ -342,11 +1011,21 @@ func (ua *UserAdm) Verify(ctx context.Context, token *jwt.Token) error {
 		return errors.Wrap(err, "useradm: failed to get token")
 	}
 
+	// the tokens revoked are rejected before they're removed
+	revokedTs, err := ua.db.GetTokensRevokedTs(ctx, user.ID)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get token revocation")
+	}
+	if !revokedTs.IsZero() && token.Claims.IssuedAt <= revokedTs.Unix() {
+		l.Errorf("token %s was revoked", token.Id)
+		return ErrUnauthorized
+	}
+
 	return nil
 }
 
-func (ua *UserAdm) GetUsers(ctx context.Context) ([]model.User, error) {
-	users, err := ua.db.GetUsers(ctx)
+func (ua *UserAdm) GetUsers(ctx context.Context, fltr model.UserFilter) ([]model.User, error) {
+	users, err := ua.db.GetUsers(ctx, fltr)
 	if err != nil {
 		return nil, errors.Wrap(err, "useradm: failed to get users")
 	}
@@ -354,6 +1033,34 @@ func (ua *UserAdm) GetUsers(ctx context.Context) ([]model.User, error) {
 	return users, nil
 }
 
+func (ua *UserAdm) CountUsers(ctx context.Context, fltr model.UserFilter) (int, error) {
+	n, err := ua.db.CountUsers(ctx, fltr)
+	if err != nil {
+		return 0, errors.Wrap(err, "useradm: failed to count users")
+	}
+
+	return n, nil
+}
+
+func (ua *UserAdm) GetUsersVersion(ctx context.Context,
+	fltr model.UserFilter) (*model.UsersVersion, error) {
+	v, err := ua.db.GetUsersVersion(ctx, fltr)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get users version")
+	}
+
+	return v, nil
+}
+
+func (ua *UserAdm) ForEachUser(ctx context.Context, fltr model.UserFilter,
+	fn func(u *model.User) error) error {
+	if err := ua.db.ForEachUser(ctx, fltr, fn); err != nil {
+		return errors.Wrap(err, "useradm: failed to iterate users")
+	}
+
+	return nil
+}
+
 func (ua *UserAdm) GetUser(ctx context.Context, id string) (*model.User, error) {
 	user, err := ua.db.GetUserById(ctx, id)
 	if err != nil {
@@ -363,41 +1070,578 @@ func (ua *UserAdm) GetUser(ctx context.Context, id string) (*model.User, error)
 	return user, nil
 }
 
-func (ua *UserAdm) DeleteUser(ctx context.Context, id string) error {
+func (ua *UserAdm) GetLoginHistory(ctx context.Context, id string) ([]model.LoginEvent, error) {
+	user, err := ua.db.GetUserById(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user")
+	}
+
+	if user == nil {
+		return nil, store.ErrUserNotFound
+	}
+
+	events, err := ua.db.GetLoginEvents(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get login history")
+	}
+
+	return ua.planLoginHistory(ctx, events)
+}
+
+func (ua *UserAdm) GetUserTokens(ctx context.Context, id string) ([]model.TokenInfo, error) {
+	user, err := ua.db.GetUserById(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user")
+	}
+
+	if user == nil {
+		return nil, store.ErrUserNotFound
+	}
+
+	return ua.tokenInfos(ctx, id)
+}
+
+// tokenInfos describes the tokens issued to the user with the given id
+func (ua *UserAdm) tokenInfos(ctx context.Context, id string) ([]model.TokenInfo, error) {
+	tokens, err := ua.db.GetTokensByUserId(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get tokens")
+	}
+
+	infos := []model.TokenInfo{}
+	for _, t := range tokens {
+		infos = append(infos, model.TokenInfo{
+			ID:           t.Id,
+			IssuedAt:     time.Unix(t.Claims.IssuedAt, 0).UTC(),
+			ExpiresAt:    time.Unix(t.Claims.ExpiresAt, 0).UTC(),
+			Impersonator: t.Claims.Impersonator,
+		})
+	}
+
+	return infos, nil
+}
+
+func (ua *UserAdm) LookupUser(ctx context.Context, login string) (*model.UserLookup, error) {
+	lookup := &model.UserLookup{}
+
+	if ua.verifyTenant {
+		if model.IsUsername(login) {
+			return nil, store.ErrUserNotFound
+		}
+		tenant, err := ua.getTenant(ctx, login)
+		if err != nil {
+			return nil, errors.Wrap(err, "useradm: failed to check user's tenant")
+		}
+		if tenant == nil {
+			return nil, store.ErrUserNotFound
+		}
+
+		lookup.TenantID = tenant.ID
+		ctx = identity.WithContext(ctx, &identity.Identity{
+			Tenant: tenant.ID,
+		})
+	}
+
+	user, err := ua.getUserByLogin(ctx, login)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil {
+		return nil, store.ErrUserNotFound
+	}
+
+	lookup.ID = user.ID
+	lookup.Email = user.Email
+	lookup.Username = user.Username
+
+	return lookup, nil
+}
+
+func (ua *UserAdm) GetUserData(ctx context.Context, id string) (*model.UserData, error) {
+	user, err := ua.db.GetUserById(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user")
+	}
+
+	if user == nil {
+		return nil, store.ErrUserNotFound
+	}
+
+	data := &model.UserData{
+		User:       *user,
+		Groups:     []model.Group{},
+		ExportedTs: time.Now().UTC(),
+	}
+
+	if len(user.Groups) > 0 {
+		data.Groups, err = ua.db.GetGroupsByIds(ctx, user.Groups)
+		if err != nil {
+			return nil, errors.Wrap(err, "useradm: failed to get groups")
+		}
+	}
+
+	data.Tokens, err = ua.tokenInfos(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	data.LoginHistory, err = ua.db.GetLoginEvents(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get login history")
+	}
+
+	data.Settings.Preferences, err = ua.db.GetUserSettings(ctx, id)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user settings")
+	}
+	data.Settings.NotificationsOptOut, _ =
+		data.Settings.Preferences[SettingNotificationsOptOut].(bool)
+
+	return data, nil
+}
+
+// revertEmail restores the email of the user changed in the db only,
+// unless the user was modified again in the meantime
+func (ua *UserAdm) revertEmail(ctx context.Context, id, email, etag string) {
+	err := ua.db.UpdateUser(ctx, id, &model.UserUpdate{
+		Email:   email,
+		IfMatch: []string{etag},
+	})
+	if err != nil {
+		log.FromContext(ctx).Errorf("failed to revert the email of user %s: %v", id, err)
+	}
+}
+
+func (ua *UserAdm) DeleteUser(ctx context.Context, id string, ifMatch []string) error {
+	if ident := identity.FromContext(ctx); ident != nil && ident.Subject == id {
+		return ErrSelfDelete
+	}
+
+	return ua.deleteUser(ctx, id, ifMatch)
+}
+
+func (ua *UserAdm) DeleteOwnUser(ctx context.Context, password string) error {
+	ident := identity.FromContext(ctx)
+	if ident == nil || ident.Subject == "" {
+		return ErrUnauthorized
+	}
+
+	if err := ua.checkPassword(ctx, ident.Subject, password); err != nil {
+		return err
+	}
+
+	return ua.deleteUser(ctx, ident.Subject, nil)
+}
+
+// GetOwnSettings returns the settings of the user making the request
+func (ua *UserAdm) GetOwnSettings(ctx context.Context) (map[string]interface{}, error) {
+	ident := identity.FromContext(ctx)
+	if ident == nil || ident.Subject == "" {
+		return nil, ErrUnauthorized
+	}
+
+	settings, err := ua.db.GetUserSettings(ctx, ident.Subject)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get user settings")
+	}
+
+	return settings, nil
+}
+
+// SaveOwnSettings replaces the settings of the user making the request
+func (ua *UserAdm) SaveOwnSettings(ctx context.Context, s map[string]interface{}) error {
+	ident := identity.FromContext(ctx)
+	if ident == nil || ident.Subject == "" {
+		return ErrUnauthorized
+	}
+
+	if err := validateUserSettings(s); err != nil {
+		return err
+	}
+
+	if err := ua.db.SaveUserSettings(ctx, ident.Subject, s); err != nil {
+		return errors.Wrap(err, "useradm: failed to save user settings")
+	}
+
+	return nil
+}
+
+// checkPassword verifies the password of the user with the given id,
+// returns ErrUnauthorized if the user does not exist or the password is wrong
+func (ua *UserAdm) checkPassword(ctx context.Context, id, password string) error {
+	user, err := ua.db.GetUserById(ctx, id)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil {
+		return ErrUnauthorized
+	}
+
+	// password hash is not returned when fetching by id
+	user, err = ua.db.GetUserByEmail(ctx, user.Email)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil {
+		return ErrUnauthorized
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	if err != nil {
+		return ErrUnauthorized
+	}
+
+	return nil
+}
+
+func (ua *UserAdm) deleteUser(ctx context.Context, id string, ifMatch []string) error {
+	isAdmin, err := ua.checkNotLastAdmin(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	err = ua.db.DeleteUser(ctx, id, ifMatch)
+	if err != nil {
+		if err == store.ErrUserNotFound || err == store.ErrETagMismatch {
+			return err
+		}
+		return errors.Wrap(err, "useradm: failed to delete user")
+	}
+
+	if isAdmin {
+		err := ua.keepLastAdmin(ctx, func() error {
+			return ua.db.RestoreUser(ctx, id)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// tenantadm is told only about users deleted from the db
 	if ua.verifyTenant {
 		identity := identity.FromContext(ctx)
-		err := ua.cTenant.DeleteUser(ctx, identity.Tenant, id, ua.clientGetter())
+		err := ua.cTenant.DeleteUser(ctx, identity.Tenant, id)
 
 		if err != nil {
+			// the user is still known to tenantadm, bring it back
+			if compensateErr := ua.db.RestoreUser(ctx, id); compensateErr != nil {
+				err = errors.Wrap(err, compensateErr.Error())
+			}
 			return errors.Wrap(err, "useradm: failed to delete user in tenantadm")
 		}
 	}
 
-	err := ua.db.DeleteUser(ctx, id)
+	return nil
+}
+
+func (ua *UserAdm) EraseUser(ctx context.Context, id string) (*model.ErasureReceipt, error) {
+	ident := identity.FromContext(ctx)
+	receipt := &model.ErasureReceipt{UserID: id}
+	if ident != nil {
+		receipt.TenantID = ident.Tenant
+	}
+
+	// deleted users are already gone from tenantadm
+	if ua.verifyTenant {
+		user, err := ua.db.GetUserById(ctx, id)
+		if err != nil {
+			return nil, errors.Wrap(err, "useradm: failed to get user")
+		}
+		if user != nil {
+			err := ua.cTenant.DeleteUser(ctx, receipt.TenantID, id)
+			if err != nil {
+				return nil, errors.Wrap(err, "useradm: failed to delete user in tenantadm")
+			}
+		}
+	}
+
+	err := ua.db.EraseUser(ctx, id)
 	if err != nil {
-		return errors.Wrap(err, "useradm: failed to delete user")
+		if err == store.ErrUserNotFound {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, "useradm: failed to erase user")
+	}
+
+	receipt.ErasedTs = time.Now().UTC()
+
+	// no expiration time, so that the receipt can't pass as an access token
+	receiptId := uuid.NewV4().String()
+	receipt.Signature, err = ua.jwtHandler.ToJWT(&jwt.Token{
+		Id: receiptId,
+		Claims: jwt.Claims{
+			ID:       receiptId,
+			Issuer:   ua.config.Issuer,
+			IssuedAt: receipt.ErasedTs.Unix(),
+			Subject:  id,
+			Scope:    scope.UserErasure,
+			Tenant:   receipt.TenantID,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to sign erasure receipt")
+	}
+
+	return receipt, nil
+}
+
+// checkNotLastAdmin returns ErrLastAdmin if the user with the given id is the
+// only remaining active administrator of the tenant (identity in context),
+// and whether the user is an administrator at all.
+// All users are granted full permissions, so every active user is an
+// administrator.
+func (ua *UserAdm) checkNotLastAdmin(ctx context.Context, id string) (bool, error) {
+	user, err := ua.db.GetUserById(ctx, id)
+	if err != nil {
+		return false, errors.Wrap(err, "useradm: failed to get user")
+	}
+	if user == nil || !user.IsActive() {
+		return false, nil
+	}
+
+	n, err := ua.db.CountUsers(ctx, model.UserFilter{Active: true})
+	if err != nil {
+		return false, errors.Wrap(err, "useradm: failed to count users")
+	}
+	if n <= 1 {
+		return true, ErrLastAdmin
+	}
+
+	return true, nil
+}
+
+// keepLastAdmin undoes the removal of an administrator if no active user is
+// left; concurrent removals can all pass checkNotLastAdmin, counting again
+// once the user is removed makes each of them see the others
+func (ua *UserAdm) keepLastAdmin(ctx context.Context, undo func() error) error {
+	n, err := ua.db.CountUsers(ctx, model.UserFilter{Active: true})
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to count users")
+	}
+	if n > 0 {
+		return nil
+	}
+
+	if err := undo(); err != nil {
+		return errors.Wrap(err, "useradm: failed to keep the last administrator")
+	}
+	return ErrLastAdmin
+}
+
+func (ua *UserAdm) RestoreUser(ctx context.Context, id string) error {
+	if err := ua.checkPlanUsers(ctx); err != nil {
+		return err
+	}
+
+	err := ua.db.RestoreUser(ctx, id)
+	if err != nil {
+		if err == store.ErrUserNotFound || err == store.ErrDuplicateEmail ||
+			err == store.ErrDuplicateUsername || err == store.ErrUserLimitReached {
+			return err
+		}
+		return errors.Wrap(err, "useradm: failed to restore user")
+	}
+
+	if ua.verifyTenant {
+		user, err := ua.db.GetUserById(ctx, id)
+		if err != nil {
+			return errors.Wrap(err, "useradm: failed to get user")
+		}
+		if user == nil {
+			return store.ErrUserNotFound
+		}
+
+		ident := identity.FromContext(ctx)
+		err = ua.cTenant.CreateUser(ctx,
+			&tenant.User{
+				ID:       user.ID,
+				Name:     user.Email,
+				TenantID: ident.Tenant,
+			})
+
+		if err != nil && err != tenant.ErrDuplicateUser {
+			// the user is unknown to tenantadm, delete it again
+			if compensateErr := ua.db.DeleteUser(ctx, id, nil); compensateErr != nil {
+				err = errors.Wrap(err, compensateErr.Error())
+			}
+			return errors.Wrap(err, "useradm: failed to restore user in tenantadm")
+		}
+	}
+
+	return nil
+}
+
+func (ua *UserAdm) PurgeDeletedUsers(ctx context.Context) error {
+	before := time.Now().Add(-time.Duration(ua.config.DeletedUsersRetention) * time.Second)
+
+	if err := ua.db.PurgeDeletedUsers(ctx, before); err != nil {
+		return errors.Wrap(err, "useradm: failed to purge deleted users")
+	}
+
+	return nil
+}
+
+func (ua *UserAdm) DisableExpiredUsers(ctx context.Context) error {
+	if err := ua.db.DisableExpiredUsers(ctx, time.Now()); err != nil {
+		return errors.Wrap(err, "useradm: failed to disable expired users")
 	}
 
 	return nil
 }
 
-// WithTenantVerification produces a UserAdm instance which enforces
-// tenant verification vs the tenantadm service upon /login.
-func (u *UserAdm) WithTenantVerification(c tenant.ClientRunner) *UserAdm {
-	u.verifyTenant = true
-	u.cTenant = c
+func (ua *UserAdm) ReconcilePendingUsers(ctx context.Context) error {
+	before := time.Now().Add(-time.Duration(ua.config.PendingUsersTimeout) * time.Second)
+
+	pending, err := ua.db.GetPendingUsers(ctx, before)
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to get pending users")
+	}
+
+	l := log.FromContext(ctx)
+	for _, p := range pending {
+		ctx := identity.WithContext(ctx, &identity.Identity{
+			Tenant: p.TenantID,
+		})
+
+		// the creation completed if the user made it to the db
+		user, err := ua.db.GetUserById(ctx, p.UserID)
+		if err != nil {
+			l.Errorf("failed to get pending user %s: %v", p.UserID, err)
+			continue
+		}
+		if user != nil {
+			ua.completePendingUser(ctx, p.UserID)
+			continue
+		}
+
+		if err := ua.compensateTenantUser(ctx, p.UserID, p.TenantID); err != nil {
+			l.Errorf("failed to roll back creation of user %s: %v", p.UserID, err)
+			continue
+		}
+		l.Infof("rolled back creation of user %s in tenant %s", p.UserID, p.TenantID)
+	}
+
+	return nil
+}
+
+func (ua *UserAdm) DeleteExpiredTokens(ctx context.Context) error {
+	n, err := ua.db.DeleteExpiredTokens(ctx, time.Now())
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to delete expired tokens")
+	}
+
+	if n > 0 {
+		log.FromContext(ctx).Infof("removed %d expired tokens", n)
+	}
+	if ua.expiredTokens != nil {
+		ua.expiredTokens.Add(float64(n))
+	}
+
+	return nil
+}
+
+// WithMetrics registers the metrics of the background jobs in r
+func (ua *UserAdm) WithMetrics(r *metrics.Registry) *UserAdm {
+	ua.expiredTokens = metrics.NewCounterVec("useradm_expired_tokens_removed_total",
+		"Number of expired tokens removed by the cleanup job.")
+	r.Register(ua.expiredTokens)
+	return ua
+}
+
+// WithTenantVerification puts the users in the tenants the verifier
+// resolves them to; with tenant.NoopVerifier they belong to none
+func (u *UserAdm) WithTenantVerification(v tenant.TenantVerifier) *UserAdm {
+	_, noop := v.(tenant.NoopVerifier)
+	u.verifyTenant = !noop
+	u.cTenant = v
 	return u
 }
 
 func (u *UserAdm) CreateTenant(ctx context.Context, tenant model.NewTenant) error {
+	if tenant.AdminEmail != "" && u.mailer == nil {
+		return ErrMailerNotConfigured
+	}
+
+	existed, err := u.tenantKeeper.TenantExists(ctx, tenant.ID)
+	if err != nil {
+		return errors.Wrapf(err, "failed to check tenant %v", tenant.ID)
+	}
+
 	if err := u.tenantKeeper.MigrateTenant(ctx, tenant.ID); err != nil {
 		return errors.Wrapf(err, "failed to apply migrations for tenant %v", tenant.ID)
 	}
+
+	if tenant.AdminEmail != "" {
+		return u.inviteTenantAdmin(ctx, tenant, existed)
+	}
+	return nil
+}
+
+func (u *UserAdm) DeleteTenant(ctx context.Context, id string) error {
+	if err := u.tenantKeeper.DeleteTenant(ctx, id); err != nil {
+		return errors.Wrapf(err, "failed to delete data of tenant %v", id)
+	}
 	return nil
 }
 
+func (u *UserAdm) GetTenantMigrationStatus(ctx context.Context, id string) (*model.MigrationStatus, error) {
+	status, err := u.tenantKeeper.GetMigrationStatus(ctx, id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get migration status of tenant %v", id)
+	}
+	return status, nil
+}
+
+func (u *UserAdm) GetMigrationProgress(ctx context.Context) (*model.MigrationProgress, error) {
+	progress, err := u.tenantKeeper.GetMigrationProgress(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get migration progress")
+	}
+	return progress, nil
+}
+
+func (ua *UserAdm) GetJobStatuses(ctx context.Context) ([]model.JobStatus, error) {
+	statuses, err := ua.db.GetJobStatuses(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get job statuses")
+	}
+	return statuses, nil
+}
+
+func (ua *UserAdm) SetLimit(ctx context.Context, l model.Limit) error {
+	if err := ua.db.SetLimit(ctx, &l); err != nil {
+		return errors.Wrap(err, "useradm: failed to set limit")
+	}
+	return nil
+}
+
+func (ua *UserAdm) GetLimitUsage(ctx context.Context, name string) (*model.LimitUsage, error) {
+	if name != model.LimitMaxUsers {
+		return nil, model.ErrUnknownLimit
+	}
+
+	limit, err := ua.db.GetLimit(ctx, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to get limit")
+	}
+
+	usage := &model.LimitUsage{
+		Limit: model.Limit{Name: name},
+	}
+	if limit != nil {
+		usage.Value = limit.Value
+	}
+
+	usage.Usage, err = ua.db.CountUsers(ctx, model.UserFilter{})
+	if err != nil {
+		return nil, errors.Wrap(err, "useradm: failed to count users")
+	}
+
+	return usage, nil
+}
+
 func (ua *UserAdm) SetPassword(ctx context.Context, uu model.UserUpdate) error {
-	u, err := ua.db.GetUserByEmail(ctx, uu.Email)
+	u, err := ua.db.GetUserByEmail(ctx, model.NormalizeEmail(uu.Email))
 	if err != nil {
 		return errors.Wrap(err, "useradm: failed to get user by email")
 
@@ -406,8 +1650,17 @@ func (ua *UserAdm) SetPassword(ctx context.Context, uu model.UserUpdate) error {
 		return ErrUserNotFound
 	}
 
+	// the email only identifies the user, it may be an additional one
+	uu.Email = ""
+
 	err = ua.db.UpdateUser(ctx, u.ID, &uu)
-	return errors.Wrap(err, "useradm: failed to update user information")
+	if err != nil {
+		return errors.Wrap(err, "useradm: failed to update user information")
+	}
+
+	ua.notifyPasswordChanged(ctx, u.ID, u.Email)
+
+	return nil
 }
 
 func (ua *UserAdm) DeleteTokens(ctx context.Context, tenantId, userId string) error {
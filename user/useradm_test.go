@@ -14,21 +14,23 @@
 package useradm
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"testing"
 	"time"
 
-	"github.com/mendersoftware/go-lib-micro/apiclient"
 	"github.com/mendersoftware/go-lib-micro/identity"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
 
 	ct "github.com/mendersoftware/useradm/client/tenant"
 	mct "github.com/mendersoftware/useradm/client/tenant/mocks"
 	"github.com/mendersoftware/useradm/jwt"
 	mjwt "github.com/mendersoftware/useradm/jwt/mocks"
+	"github.com/mendersoftware/useradm/metrics"
 	"github.com/mendersoftware/useradm/model"
 	"github.com/mendersoftware/useradm/scope"
 	"github.com/mendersoftware/useradm/store"
@@ -77,21 +79,34 @@ func TestUserAdmSignToken(t *testing.T) {
 }
 
 func TestUserAdmLogin(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+
 	testCases := map[string]struct {
 		inEmail    string
 		inPassword string
+		inScope    string
 
 		verifyTenant bool
 		tenant       *ct.Tenant
 		tenantErr    error
 
+		dbTenantStatus *model.TenantStatus
+
 		dbUser    *model.User
 		dbUserErr error
 
 		dbTokenErr error
 
+		dbGroups    []model.Group
+		dbGroupsErr error
+
+		dbSettings    map[string]interface{}
+		dbSettingsErr error
+
 		outErr   error
 		outToken *jwt.Token
+		// token lifetime, if other than configured
+		outExpiration int64
 
 		config Config
 	}{
@@ -119,30 +134,21 @@ func TestUserAdmLogin(t *testing.T) {
 				ExpirationTime: 10,
 			},
 		},
-		"ok, multitenant": {
+		"ok, scope requested": {
 			inEmail:    "foo@bar.com",
 			inPassword: "correcthorsebatterystaple",
-
-			verifyTenant: true,
-			tenant: &ct.Tenant{
-				ID:   "tenant1id",
-				Name: "tenant1",
-			},
-			tenantErr: nil,
+			inScope:    scope.UsersRead + " " + scope.SettingsWrite,
 
 			dbUser: &model.User{
 				ID:       "1234",
 				Email:    "foo@bar.com",
 				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
 			},
-			dbUserErr: nil,
 
-			outErr: nil,
 			outToken: &jwt.Token{
 				Claims: jwt.Claims{
 					Subject: "1234",
-					Scope:   scope.All,
-					Tenant:  "tenant1id",
+					Scope:   scope.UsersRead + " " + scope.SettingsWrite,
 				},
 			},
 
@@ -151,60 +157,54 @@ func TestUserAdmLogin(t *testing.T) {
 				ExpirationTime: 10,
 			},
 		},
-		"error, multitenant: tenant not found": {
+		"error, invalid scope requested": {
 			inEmail:    "foo@bar.com",
 			inPassword: "correcthorsebatterystaple",
+			inScope:    scope.UserErasure,
 
-			verifyTenant: true,
-			tenant:       nil,
-			tenantErr:    nil,
-
-			outErr:   ErrUnauthorized,
-			outToken: nil,
-		},
-		"error, multitenant: tenant verification error": {
-			inEmail:    "foo@bar.com",
-			inPassword: "correcthorsebatterystaple",
+			dbUser: &model.User{
+				ID:       "1234",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+			},
 
-			verifyTenant: true,
-			tenant:       nil,
-			tenantErr:    errors.New("some error"),
+			outErr: ErrInvalidScope,
 
-			outErr:   errors.New("failed to check user's tenant: some error"),
-			outToken: nil,
+			config: Config{
+				Issuer:         "foobar",
+				ExpirationTime: 10,
+			},
 		},
-		"error, multitenant: tenant account suspended": {
-			inEmail:    "foo@bar.com",
+		"ok, username": {
+			inEmail:    "Foo.Bar",
 			inPassword: "correcthorsebatterystaple",
 
-			verifyTenant: true,
-			tenant: &ct.Tenant{
-				ID:     "tenant1id",
-				Name:   "tenant1",
-				Status: "suspended",
-			},
-			tenantErr: nil,
-
 			dbUser: &model.User{
 				ID:       "1234",
 				Email:    "foo@bar.com",
+				Username: "foo.bar",
 				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
 			},
 			dbUserErr: nil,
 
-			outErr: ErrTenantAccountSuspended,
+			outErr: nil,
+			outToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Scope:   scope.All,
+				},
+			},
 
 			config: Config{
 				Issuer:         "foobar",
 				ExpirationTime: 10,
 			},
 		},
-		"error: no user": {
-			inEmail:    "foo@bar.com",
+		"error: username, multitenant": {
+			inEmail:    "foo.bar",
 			inPassword: "correcthorsebatterystaple",
 
-			dbUser:    nil,
-			dbUserErr: nil,
+			verifyTenant: true,
 
 			outErr:   ErrUnauthorized,
 			outToken: nil,
@@ -214,41 +214,61 @@ func TestUserAdmLogin(t *testing.T) {
 				ExpirationTime: 10,
 			},
 		},
-		"error: wrong password": {
-			inEmail:    "foo@bar.com",
-			inPassword: "notcorrecthorsebatterystaple",
+		"ok, additional email": {
+			inEmail:    "foo@baz.com",
+			inPassword: "correcthorsebatterystaple",
 
 			dbUser: &model.User{
 				ID:       "1234",
 				Email:    "foo@bar.com",
+				Emails:   []model.UserEmail{{Email: "foo@baz.com", Verified: true}},
 				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
 			},
-			dbUserErr: nil,
 
-			outErr:   ErrUnauthorized,
-			outToken: nil,
+			outToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Scope:   scope.All,
+				},
+			},
 
 			config: Config{
 				Issuer:         "foobar",
 				ExpirationTime: 10,
 			},
 		},
-		"error: regular login, db.GetUserByEmail() error": {
+		"ok, with groups": {
 			inEmail:    "foo@bar.com",
 			inPassword: "correcthorsebatterystaple",
 
-			dbUser:    nil,
-			dbUserErr: errors.New("db: internal error"),
+			dbUser: &model.User{
+				ID:       "1234",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+				Groups:   []string{"group-1", "group-2"},
+			},
+			dbUserErr: nil,
 
-			outErr:   errors.New("useradm: failed to get user: db: internal error"),
-			outToken: nil,
+			dbGroups: []model.Group{
+				{ID: "group-1", Name: "devops"},
+				{ID: "group-2", Name: "qa"},
+			},
+
+			outErr: nil,
+			outToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Scope:   scope.All,
+					Groups:  []string{"devops", "qa"},
+				},
+			},
 
 			config: Config{
 				Issuer:         "foobar",
 				ExpirationTime: 10,
 			},
 		},
-		"error: db.SaveToken() error": {
+		"ok, tenant's session length": {
 			inEmail:    "foo@bar.com",
 			inPassword: "correcthorsebatterystaple",
 
@@ -257,721 +277,3212 @@ func TestUserAdmLogin(t *testing.T) {
 				Email:    "foo@bar.com",
 				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
 			},
-			dbUserErr: nil,
 
-			dbTokenErr: errors.New("db failed"),
+			dbSettings: map[string]interface{}{
+				model.SettingSessionLength: float64(3600),
+			},
 
-			outErr:   errors.New("useradm: failed to save token: db failed"),
-			outToken: nil,
+			outToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Scope:   scope.All,
+				},
+			},
+			outExpiration: 3600,
 
 			config: Config{
 				Issuer:         "foobar",
 				ExpirationTime: 10,
 			},
 		},
-	}
-
-	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
-
-		ctx := context.Background()
-
-		db := &mstore.DataStore{}
-		db.On("GetUserByEmail", ContextMatcher(), tc.inEmail).Return(tc.dbUser, tc.dbUserErr)
-
-		db.On("SaveToken", ContextMatcher(), mock.AnythingOfType("*jwt.Token")).Return(tc.dbTokenErr)
-
-		useradm := NewUserAdm(nil, db, nil, tc.config)
-		if tc.verifyTenant {
-			cTenant := &mct.ClientRunner{}
-			cTenant.On("GetTenant", ContextMatcher(), tc.inEmail, &apiclient.HttpApi{}).
-				Return(tc.tenant, tc.tenantErr)
-			useradm = useradm.WithTenantVerification(cTenant)
-		}
-
-		token, err := useradm.Login(ctx, tc.inEmail, tc.inPassword)
+		"error: get settings": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
 
-		if tc.outErr != nil {
-			assert.EqualError(t, err, tc.outErr.Error())
-			assert.Nil(t, token)
-		} else {
-			if tc.outToken != nil && assert.NotNil(t, token) {
-				assert.NoError(t, err)
-				assert.NotEmpty(t, token.Id)
-				assert.NotEmpty(t, token.Claims.ID)
-				assert.Equal(t, tc.config.Issuer, token.Claims.Issuer)
-				assert.Equal(t, tc.outToken.Claims.Scope, token.Claims.Scope)
-				assert.WithinDuration(t,
-					time.Now().Add(time.Duration(tc.config.ExpirationTime)*time.Second),
-					time.Unix(token.Claims.ExpiresAt, 0),
-					time.Second)
+			dbUser: &model.User{
+				ID:       "1234",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+			},
 
-			}
-		}
-	}
+			dbSettingsErr: errors.New("db failed"),
 
-}
+			outErr: errors.New("useradm: failed to get settings: db failed"),
 
-func TestUserAdmDoCreateUser(t *testing.T) {
-	testCases := map[string]struct {
-		inUser model.User
+			config: Config{
+				Issuer:         "foobar",
+				ExpirationTime: 10,
+			},
+		},
+		"error: get groups": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
 
-		withTenantVerification     bool
-		propagate                  bool
-		tenantCreateUserErr        error
-		tenantDeleteUserErr        error
-		shouldVerifyTenant         bool
-		shouldCompensateTenantUser bool
+			dbUser: &model.User{
+				ID:       "1234",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+				Groups:   []string{"group-1"},
+			},
+			dbUserErr: nil,
 
-		dbUser       *model.User
-		dbGetUserErr error
+			dbGroupsErr: errors.New("db failed"),
 
-		dbErr error
+			outErr:   errors.New("useradm: failed to get user groups: db failed"),
+			outToken: nil,
 
-		outErr error
-	}{
-		"ok": {
-			inUser: model.User{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
+			config: Config{
+				Issuer:         "foobar",
+				ExpirationTime: 10,
 			},
-			dbErr:              nil,
-			outErr:             nil,
-			propagate:          true,
-			shouldVerifyTenant: false,
 		},
 		"ok, multitenant": {
-			inUser: model.User{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
-			},
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
 
-			withTenantVerification: true,
-			propagate:              true,
-			tenantCreateUserErr:    nil,
-			shouldVerifyTenant:     true,
+			verifyTenant: true,
+			tenant: &ct.Tenant{
+				ID:   "tenant1id",
+				Name: "tenant1",
+			},
+			tenantErr: nil,
 
-			dbErr:  nil,
-			outErr: nil,
-		},
-		"ok, multitenant, progate: false": {
-			inUser: model.User{
+			dbUser: &model.User{
+				ID:       "1234",
 				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
 			},
+			dbUserErr: nil,
 
-			withTenantVerification: true,
-			propagate:              false,
-			tenantCreateUserErr:    nil,
-			shouldVerifyTenant:     false,
-
-			dbErr:  nil,
 			outErr: nil,
+			outToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Scope:   scope.All,
+					Tenant:  "tenant1id",
+				},
+			},
+
+			config: Config{
+				Issuer:         "foobar",
+				ExpirationTime: 10,
+			},
 		},
-		"error, multitenant: duplicate user": {
-			inUser: model.User{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
+		"ok, multitenant: operator": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
+
+			verifyTenant: true,
+			tenant: &ct.Tenant{
+				ID:   "operators",
+				Name: "operators",
 			},
 
-			withTenantVerification: true,
-			propagate:              true,
-			tenantCreateUserErr:    ct.ErrDuplicateUser,
-			shouldVerifyTenant:     true,
 			dbUser: &model.User{
 				ID:       "1234",
 				Email:    "foo@bar.com",
 				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
 			},
 
-			dbErr:  nil,
-			outErr: errors.New("user with a given email already exists"),
-		},
-		"error, multitenant: duplicate user, no user in useradm": {
-			inUser: model.User{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
-			},
-
-			withTenantVerification:     true,
-			propagate:                  true,
-			tenantCreateUserErr:        ct.ErrDuplicateUser,
-			shouldVerifyTenant:         true,
-			shouldCompensateTenantUser: true,
+			outToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Scope:   scope.All + " " + scope.Operator,
+					Tenant:  "operators",
+				},
+			},
 
-			dbErr:  nil,
-			outErr: errors.New("tenant data out of sync: user with the same name already exists"),
-		},
-		"error, multitenant: duplicate user, no user in useradm, compensate error": {
-			inUser: model.User{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
+			config: Config{
+				Issuer:         "foobar",
+				ExpirationTime: 10,
+				OperatorTenant: "operators",
 			},
+		},
+		"error, multitenant: tenant not found": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
 
-			withTenantVerification:     true,
-			propagate:                  true,
-			tenantCreateUserErr:        ct.ErrDuplicateUser,
-			tenantDeleteUserErr:        errors.New("delate user error"),
-			shouldVerifyTenant:         true,
-			shouldCompensateTenantUser: true,
+			verifyTenant: true,
+			tenant:       nil,
+			tenantErr:    nil,
 
-			dbErr:  nil,
-			outErr: errors.New("tenant data out of sync: faield to delete tenant user: delate user error"),
+			outErr:   ErrUnauthorized,
+			outToken: nil,
 		},
-		"error, multitenant: duplicate user, get user error": {
-			inUser: model.User{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
-			},
+		"error, multitenant: tenant verification error": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
 
-			withTenantVerification: true,
-			propagate:              true,
-			shouldVerifyTenant:     true,
-			tenantCreateUserErr:    ct.ErrDuplicateUser,
+			verifyTenant: true,
+			tenant:       nil,
+			tenantErr:    errors.New("some error"),
 
-			dbGetUserErr: errors.New("db error"),
-			dbErr:        nil,
-			outErr:       errors.New("tenant data out of sync: failed to get user from db: db error"),
+			outErr:   errors.New("failed to check user's tenant: some error"),
+			outToken: nil,
 		},
-		"error, multitenant: generic": {
-			inUser: model.User{
+		"error, multitenant: tenant account suspended": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
+
+			verifyTenant: true,
+			tenant: &ct.Tenant{
+				ID:     "tenant1id",
+				Name:   "tenant1",
+				Status: "suspended",
+			},
+			tenantErr: nil,
+
+			dbUser: &model.User{
+				ID:       "1234",
 				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
 			},
+			dbUserErr: nil,
 
-			withTenantVerification: true,
-			propagate:              true,
-			tenantCreateUserErr:    errors.New("http 500"),
-			shouldVerifyTenant:     true,
+			outErr: ErrTenantAccountSuspended,
 
-			dbErr:  nil,
-			outErr: errors.New("useradm: failed to create user in tenantadm: http 500"),
-		},
-		"db error: duplicate email": {
-			inUser: model.User{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
+			config: Config{
+				Issuer:         "foobar",
+				ExpirationTime: 10,
 			},
-			dbErr:  store.ErrDuplicateEmail,
-			outErr: store.ErrDuplicateEmail,
 		},
-		"db error, multitenant: duplicate email": {
-			inUser: model.User{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
+		"error, multitenant: trial expired": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
+
+			verifyTenant: true,
+			tenant: &ct.Tenant{
+				ID:     "tenant1id",
+				Name:   "tenant1",
+				Status: model.TenantStatusTrialExpired,
 			},
-			withTenantVerification: true,
-			propagate:              true,
-			shouldVerifyTenant:     true,
-			dbErr:                  store.ErrDuplicateEmail,
-			outErr:                 store.ErrDuplicateEmail,
-		},
-		"db error: general": {
-			inUser: model.User{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
+			dbTenantStatus: &model.TenantStatus{
+				Status:    model.TenantStatusTrialExpired,
+				UpdatedTs: expired.Add(-time.Hour),
 			},
-			dbErr: errors.New("no reachable servers"),
 
-			outErr: errors.New("useradm: failed to create user in the db: no reachable servers"),
-		},
-		"db error, multitenant: general": {
-			inUser: model.User{
+			dbUser: &model.User{
+				ID:       "1234",
 				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
 			},
-			withTenantVerification:     true,
-			propagate:                  true,
-			shouldVerifyTenant:         true,
-			shouldCompensateTenantUser: true,
 
-			dbErr:  errors.New("no reachable servers"),
-			outErr: errors.New("useradm: failed to create user in the db: no reachable servers"),
+			outErr: ErrTenantTrialExpired,
+
+			config: Config{
+				Issuer:            "foobar",
+				ExpirationTime:    10,
+				TenantGracePeriod: 3600,
+			},
 		},
-		"db error, multitenant: general, compensate error": {
-			inUser: model.User{
+		"ok, multitenant: payment overdue, in grace period": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
+
+			verifyTenant: true,
+			tenant: &ct.Tenant{
+				ID:     "tenant1id",
+				Name:   "tenant1",
+				Status: model.TenantStatusPaymentOverdue,
+			},
+			dbTenantStatus: &model.TenantStatus{
+				Status:    model.TenantStatusPaymentOverdue,
+				UpdatedTs: time.Now().Add(-time.Minute),
+			},
+
+			dbUser: &model.User{
+				ID:       "1234",
 				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
 			},
-			withTenantVerification:     true,
-			propagate:                  true,
-			shouldVerifyTenant:         true,
-			shouldCompensateTenantUser: true,
-			tenantDeleteUserErr:        errors.New("delate user error"),
 
-			dbErr:  errors.New("no reachable servers"),
-			outErr: errors.New("useradm: failed to create user in the db: faield to delete tenant user: delate user error: no reachable servers"),
-		},
-	}
+			outToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Scope:   scope.All,
+					Tenant:  "tenant1id",
+				},
+			},
 
-	for name, tc := range testCases {
-		t.Logf("test case: %s", name)
+			config: Config{
+				Issuer:            "foobar",
+				ExpirationTime:    10,
+				TenantGracePeriod: 3600,
+			},
+		},
+		"ok, multitenant: payment overdue, newly reported": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
 
-		ctx := context.Background()
+			verifyTenant: true,
+			tenant: &ct.Tenant{
+				ID:     "tenant1id",
+				Name:   "tenant1",
+				Status: model.TenantStatusPaymentOverdue,
+			},
 
-		db := &mstore.DataStore{}
-		db.On("CreateUser",
-			ContextMatcher(),
-			mock.AnythingOfType("*model.User")).
-			Return(tc.dbErr)
+			dbUser: &model.User{
+				ID:       "1234",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+			},
 
-		db.On("GetUserByEmail", ContextMatcher(), mock.AnythingOfType("string")).
-			Return(tc.dbUser, tc.dbGetUserErr)
+			outToken: &jwt.Token{
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Scope:   scope.All,
+					Tenant:  "tenant1id",
+				},
+			},
 
-		useradm := NewUserAdm(nil, db, nil, Config{})
-		cTenant := &mct.ClientRunner{}
+			config: Config{
+				Issuer:            "foobar",
+				ExpirationTime:    10,
+				TenantGracePeriod: 3600,
+			},
+		},
+		"error, multitenant: payment overdue, grace period over": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
 
-		id := &identity.Identity{
-			Tenant: "foo",
-		}
-		ctx = identity.WithContext(ctx, id)
+			verifyTenant: true,
+			tenant: &ct.Tenant{
+				ID:     "tenant1id",
+				Name:   "tenant1",
+				Status: model.TenantStatusPaymentOverdue,
+			},
+			dbTenantStatus: &model.TenantStatus{
+				Status:    model.TenantStatusPaymentOverdue,
+				UpdatedTs: expired.Add(-time.Hour),
+			},
 
-		if tc.shouldVerifyTenant {
-			cTenant.On("CreateUser",
-				ContextMatcher(),
-				mock.AnythingOfType("*tenant.User"),
-				&apiclient.HttpApi{}).
-				Return(tc.tenantCreateUserErr)
+			dbUser: &model.User{
+				ID:       "1234",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+			},
 
-			if tc.shouldCompensateTenantUser {
-				cTenant.On("DeleteUser",
-					ContextMatcher(),
-					mock.AnythingOfType("string"), mock.AnythingOfType("string"),
-					&apiclient.HttpApi{}).
-					Return(tc.tenantDeleteUserErr)
-			}
-		}
-		if tc.withTenantVerification {
-			useradm = useradm.WithTenantVerification(cTenant)
-		}
+			outErr: ErrTenantPaymentOverdue,
 
-		err := useradm.doCreateUser(ctx, &tc.inUser, tc.propagate)
+			config: Config{
+				Issuer:            "foobar",
+				ExpirationTime:    10,
+				TenantGracePeriod: 3600,
+			},
+		},
+		"error: no user": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
 
-		if tc.outErr != nil {
-			assert.EqualError(t, err, tc.outErr.Error())
-		} else {
-			assert.NoError(t, err)
-		}
+			dbUser:    nil,
+			dbUserErr: nil,
 
-		cTenant.AssertExpectations(t)
-	}
+			outErr:   ErrUnauthorized,
+			outToken: nil,
 
-}
+			config: Config{
+				Issuer:         "foobar",
+				ExpirationTime: 10,
+			},
+		},
+		"error: wrong password": {
+			inEmail:    "foo@bar.com",
+			inPassword: "notcorrecthorsebatterystaple",
+
+			dbUser: &model.User{
+				ID:       "1234",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+			},
+			dbUserErr: nil,
+
+			outErr:   ErrUnauthorized,
+			outToken: nil,
+
+			config: Config{
+				Issuer:         "foobar",
+				ExpirationTime: 10,
+			},
+		},
+		"error: regular login, db.GetUserByEmail() error": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
+
+			dbUser:    nil,
+			dbUserErr: errors.New("db: internal error"),
+
+			outErr:   errors.New("useradm: failed to get user: db: internal error"),
+			outToken: nil,
+
+			config: Config{
+				Issuer:         "foobar",
+				ExpirationTime: 10,
+			},
+		},
+		"error: user inactive": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
+
+			dbUser: &model.User{
+				ID:       "1234",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+				Status:   model.UserStatusInactive,
+			},
+			dbUserErr: nil,
+
+			outErr:   ErrUserInactive,
+			outToken: nil,
+
+			config: Config{
+				Issuer:         "foobar",
+				ExpirationTime: 10,
+			},
+		},
+		"error: user expired": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
+
+			dbUser: &model.User{
+				ID:        "1234",
+				Email:     "foo@bar.com",
+				Password:  `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+				Status:    model.UserStatusActive,
+				ExpiresAt: &expired,
+			},
+			dbUserErr: nil,
+
+			outErr:   ErrUserInactive,
+			outToken: nil,
+
+			config: Config{
+				Issuer:         "foobar",
+				ExpirationTime: 10,
+			},
+		},
+		"error: db.SaveToken() error": {
+			inEmail:    "foo@bar.com",
+			inPassword: "correcthorsebatterystaple",
+
+			dbUser: &model.User{
+				ID:       "1234",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+			},
+			dbUserErr: nil,
+
+			dbTokenErr: errors.New("db failed"),
+
+			outErr:   errors.New("useradm: failed to save token: db failed"),
+			outToken: nil,
+
+			config: Config{
+				Issuer:         "foobar",
+				ExpirationTime: 10,
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		ctx := context.Background()
+
+		db := &mstore.DataStore{}
+		db.On("GetUserByEmail", ContextMatcher(), tc.inEmail).Return(tc.dbUser, tc.dbUserErr)
+		db.On("GetUserByUsername", ContextMatcher(), model.NormalizeUsername(tc.inEmail)).
+			Return(tc.dbUser, tc.dbUserErr)
+
+		db.On("SaveToken", ContextMatcher(), mock.AnythingOfType("*jwt.Token")).Return(tc.dbTokenErr)
+		// the failed logins of unknown users are recorded without a user
+		db.On("IncFailedLogins", ContextMatcher(), "").Return(store.ErrUserNotFound)
+		db.On("SaveLoginEvent", ContextMatcher(),
+			mock.MatchedBy(func(e *model.LoginEvent) bool {
+				return e.UserID == "" && !e.Success
+			})).
+			Return(nil)
+		if tc.dbUser != nil {
+			db.On("SetLastLogin", ContextMatcher(), tc.dbUser.ID,
+				mock.AnythingOfType("time.Time"), "1.2.3.4").
+				Return(nil)
+			db.On("IncFailedLogins", ContextMatcher(), tc.dbUser.ID).
+				Return(nil)
+			db.On("SaveLoginEvent", ContextMatcher(),
+				mock.MatchedBy(func(e *model.LoginEvent) bool {
+					return e.UserID == tc.dbUser.ID &&
+						e.IP == "1.2.3.4" &&
+						e.UserAgent == "test-agent" &&
+						e.Method == model.LoginMethodPassword &&
+						e.Success == (tc.outErr == nil)
+				})).
+				Return(nil)
+			db.On("GetGroupsByIds", ContextMatcher(), tc.dbUser.Groups).
+				Return(tc.dbGroups, tc.dbGroupsErr)
+		}
+		db.On("GetSettings", ContextMatcher()).
+			Return(tc.dbSettings, tc.dbSettingsErr)
+		db.On("GetTenantStatus", ContextMatcher()).
+			Return(tc.dbTenantStatus, nil)
+		db.On("SetTenantStatus", ContextMatcher(),
+			mock.AnythingOfType("*model.TenantStatus")).
+			Return(nil)
+
+		useradm := NewUserAdm(nil, db, nil, tc.config)
+		if tc.verifyTenant {
+			cTenant := &mct.TenantVerifier{}
+			cTenant.On("GetTenant", ContextMatcher(), tc.inEmail).
+				Return(tc.tenant, tc.tenantErr)
+			useradm = useradm.WithTenantVerification(cTenant)
+		}
+
+		token, err := useradm.Login(ctx, tc.inEmail, tc.inPassword,
+			model.LoginInfo{IP: "1.2.3.4", UserAgent: "test-agent",
+				Scope: tc.inScope})
+
+		if tc.dbUser != nil && (tc.outErr == nil ||
+			tc.outErr == ErrUnauthorized || tc.outErr == ErrUserInactive) {
+			db.AssertCalled(t, "SaveLoginEvent", ContextMatcher(),
+				mock.AnythingOfType("*model.LoginEvent"))
+		}
+
+		switch {
+		case tc.outErr == ErrUnauthorized && tc.dbUser != nil:
+			db.AssertCalled(t, "IncFailedLogins", ContextMatcher(), tc.dbUser.ID)
+		case tc.outErr == ErrUnauthorized:
+			// unknown users fail the same way
+			db.AssertCalled(t, "IncFailedLogins", ContextMatcher(), "")
+		default:
+			db.AssertNotCalled(t, "IncFailedLogins", ContextMatcher(), mock.Anything)
+		}
+
+		if tc.outErr != nil {
+			assert.EqualError(t, err, tc.outErr.Error())
+			assert.Nil(t, token)
+			db.AssertNotCalled(t, "SetLastLogin", ContextMatcher(),
+				mock.Anything, mock.Anything, mock.Anything)
+		} else {
+			db.AssertCalled(t, "SetLastLogin", ContextMatcher(), tc.dbUser.ID,
+				mock.AnythingOfType("time.Time"), "1.2.3.4")
+			if tc.outToken != nil && assert.NotNil(t, token) {
+				assert.NoError(t, err)
+				assert.NotEmpty(t, token.Id)
+				assert.NotEmpty(t, token.Claims.ID)
+				assert.Equal(t, tc.config.Issuer, token.Claims.Issuer)
+				assert.Equal(t, tc.outToken.Claims.Scope, token.Claims.Scope)
+				assert.Equal(t, tc.outToken.Claims.Groups, token.Claims.Groups)
+				expiration := tc.config.ExpirationTime
+				if tc.outExpiration != 0 {
+					expiration = tc.outExpiration
+				}
+				assert.WithinDuration(t,
+					time.Now().Add(time.Duration(expiration)*time.Second),
+					time.Unix(token.Claims.ExpiresAt, 0),
+					time.Second)
+
+			}
+		}
+	}
+
+}
+
+func TestUserAdmLoginUnknownUserLatency(t *testing.T) {
+	const pass = "correcthorsebatterystaple"
+
+	db := &mstore.DataStore{}
+	db.On("GetUserByEmail", ContextMatcher(), "foo@bar.com").
+		Return(&model.User{
+			ID:       "1234",
+			Email:    "foo@bar.com",
+			Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+		}, nil)
+	db.On("GetUserByEmail", ContextMatcher(), "unknown@bar.com").
+		Return(nil, nil)
+	db.On("IncFailedLogins", ContextMatcher(), "1234").Return(nil)
+	db.On("IncFailedLogins", ContextMatcher(), "").Return(store.ErrUserNotFound)
+	db.On("SaveLoginEvent", ContextMatcher(), mock.AnythingOfType("*model.LoginEvent")).
+		Return(nil)
+
+	useradm := NewUserAdm(nil, db, nil, Config{})
+
+	login := func(email string) time.Duration {
+		start := time.Now()
+		_, err := useradm.Login(context.Background(), email, pass+"x",
+			model.LoginInfo{})
+		assert.Equal(t, ErrUnauthorized, err)
+		return time.Since(start)
+	}
+
+	// both check a password, the unknown user's is compared with a dummy
+	// hash; it's way longer than the rest of the login
+	wrongPassword := login("foo@bar.com")
+	unknownUser := login("unknown@bar.com")
+	assert.True(t, unknownUser > wrongPassword/2,
+		"unknown user: %s, wrong password: %s", unknownUser, wrongPassword)
+
+	// and both record the failed attempt
+	db.AssertCalled(t, "IncFailedLogins", ContextMatcher(), "1234")
+	db.AssertCalled(t, "IncFailedLogins", ContextMatcher(), "")
+	db.AssertNumberOfCalls(t, "SaveLoginEvent", 2)
+}
+
+func TestUserAdmImpersonate(t *testing.T) {
+	t.Parallel()
+
+	imp := model.Impersonation{
+		Actor:  "support@mender.io",
+		Reason: "ticket 1234",
+	}
+
+	testCases := map[string]struct {
+		expiresIn int64
+
+		dbUser     *model.User
+		dbUserErr  error
+		dbTokenErr error
+		dbEventErr error
+
+		expiration int64
+		err        error
+	}{
+		"ok": {
+			dbUser:     &model.User{ID: "1234", Email: "foo@bar.com"},
+			expiration: 3600,
+		},
+		"ok, shorter expiration": {
+			expiresIn:  600,
+			dbUser:     &model.User{ID: "1234", Email: "foo@bar.com"},
+			expiration: 600,
+		},
+		"ok, expiration limited": {
+			expiresIn:  7200,
+			dbUser:     &model.User{ID: "1234", Email: "foo@bar.com"},
+			expiration: 3600,
+		},
+		"error, not found": {
+			err: store.ErrUserNotFound,
+		},
+		"error, inactive": {
+			dbUser: &model.User{ID: "1234", Email: "foo@bar.com",
+				Status: model.UserStatusInactive},
+			err: ErrUserInactive,
+		},
+		"error, db": {
+			dbUserErr: errors.New("db failed"),
+			err:       errors.New("useradm: failed to get user: db failed"),
+		},
+		"error, token": {
+			dbUser:     &model.User{ID: "1234", Email: "foo@bar.com"},
+			dbTokenErr: errors.New("db failed"),
+			err:        errors.New("useradm: failed to save token: db failed"),
+		},
+		"error, login event": {
+			dbUser:     &model.User{ID: "1234", Email: "foo@bar.com"},
+			dbEventErr: errors.New("db failed"),
+			err:        errors.New("useradm: failed to save login event: db failed"),
+		},
+	}
+
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{Tenant: "tenant1"})
+
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ContextMatcher(), "1234").
+				Return(tc.dbUser, tc.dbUserErr)
+			db.On("GetGroupsByIds", ContextMatcher(), mock.Anything).
+				Return(nil, nil)
+			db.On("SaveToken", ContextMatcher(), mock.AnythingOfType("*jwt.Token")).
+				Return(tc.dbTokenErr)
+			db.On("SaveLoginEvent", ContextMatcher(),
+				mock.MatchedBy(func(e *model.LoginEvent) bool {
+					return e.UserID == "1234" && e.Success &&
+						e.Method == model.LoginMethodImpersonation &&
+						*e.Impersonation == imp
+				})).
+				Return(tc.dbEventErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{
+				Issuer:                      "mender",
+				ExpirationTime:              604800,
+				ImpersonationExpirationTime: 3600,
+			})
+
+			req := imp
+			req.ExpiresIn = tc.expiresIn
+			token, err := useradm.Impersonate(ctx, "1234", req)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, token)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, "1234", token.Claims.Subject)
+			assert.Equal(t, "tenant1", token.Claims.Tenant)
+			assert.Equal(t, imp.Actor, token.Claims.Impersonator)
+			assert.Equal(t, scope.All, token.Claims.Scope)
+			assert.Equal(t, tc.expiration,
+				token.Claims.ExpiresAt-token.Claims.IssuedAt)
+			db.AssertCalled(t, "SaveLoginEvent", ContextMatcher(),
+				mock.AnythingOfType("*model.LoginEvent"))
+		})
+	}
+}
+
+func TestUserAdmCreateUser(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		password      string
+		dbSettings    map[string]interface{}
+		dbSettingsErr error
+
+		err error
+	}{
+		"ok": {
+			password: "correcthorse",
+		},
+		"ok, tenant's password policy": {
+			password: "correcthorsebatterystaple",
+			dbSettings: map[string]interface{}{
+				model.SettingPasswordMinLength: 16,
+			},
+		},
+		"error: password shorter than tenant's policy": {
+			password: "correcthorse",
+			dbSettings: map[string]interface{}{
+				model.SettingPasswordMinLength: 16,
+			},
+			err: model.ErrPasswordTooShort,
+		},
+		"ok, tenant's allowed email domains": {
+			password: "correcthorse",
+			dbSettings: map[string]interface{}{
+				model.SettingAllowedEmailDomains: []interface{}{"acme.com", "bar.com"},
+			},
+		},
+		"error: email domain not allowed": {
+			password: "correcthorse",
+			dbSettings: map[string]interface{}{
+				model.SettingAllowedEmailDomains: []interface{}{"acme.com"},
+			},
+			err: model.ErrEmailDomainNotAllowed,
+		},
+		"error: get settings": {
+			password:      "correcthorse",
+			dbSettingsErr: errors.New("db connection failed"),
+			err:           errors.New("useradm: failed to get settings: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetSettings", ContextMatcher()).
+				Return(tc.dbSettings, tc.dbSettingsErr)
+			db.On("GetPlan", ContextMatcher()).Return(nil, nil)
+			db.On("CreateUser", ContextMatcher(), mock.AnythingOfType("*model.User")).
+				Return(nil)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			user := &model.User{Email: "foo@bar.com", Password: tc.password}
+			err := useradm.CreateUser(ctx, user)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				db.AssertNotCalled(t, "CreateUser", ContextMatcher(), mock.Anything)
+			} else {
+				assert.NoError(t, err)
+				assert.NoError(t, bcrypt.CompareHashAndPassword(
+					[]byte(user.Password), []byte(tc.password)))
+			}
+		})
+	}
+}
+
+func TestUserAdmDoCreateUser(t *testing.T) {
+	testCases := map[string]struct {
+		inUser model.User
+
+		withTenantVerification     bool
+		propagate                  bool
+		tenantCreateUserErr        error
+		tenantDeleteUserErr        error
+		shouldVerifyTenant         bool
+		shouldCompensateTenantUser bool
+
+		dbCreatePendingUserErr    error
+		shouldCompletePendingUser bool
+
+		dbUser       *model.User
+		dbGetUserErr error
+
+		dbErr error
+
+		outErr error
+	}{
+		"ok": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+			dbErr:              nil,
+			outErr:             nil,
+			propagate:          true,
+			shouldVerifyTenant: false,
+		},
+		"ok, multitenant": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+
+			withTenantVerification: true,
+			propagate:              true,
+			tenantCreateUserErr:    nil,
+			shouldVerifyTenant:     true,
+
+			dbErr:                     nil,
+			outErr:                    nil,
+			shouldCompletePendingUser: true,
+		},
+		"ok, multitenant, progate: false": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+
+			withTenantVerification: true,
+			propagate:              false,
+			tenantCreateUserErr:    nil,
+			shouldVerifyTenant:     false,
+
+			dbErr:  nil,
+			outErr: nil,
+		},
+		"error, multitenant: duplicate user": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+
+			withTenantVerification: true,
+			propagate:              true,
+			tenantCreateUserErr:    ct.ErrDuplicateUser,
+			shouldVerifyTenant:     true,
+			dbUser: &model.User{
+				ID:       "1234",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+			},
+
+			dbErr:                     nil,
+			outErr:                    errors.New("user with a given email already exists"),
+			shouldCompletePendingUser: true,
+		},
+		"error, multitenant: duplicate user, no user in useradm": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+
+			withTenantVerification:     true,
+			propagate:                  true,
+			tenantCreateUserErr:        ct.ErrDuplicateUser,
+			shouldVerifyTenant:         true,
+			shouldCompensateTenantUser: true,
+
+			dbErr:                     nil,
+			outErr:                    errors.New("tenant data out of sync: user with the same name already exists"),
+			shouldCompletePendingUser: true,
+		},
+		"error, multitenant: duplicate user, no user in useradm, compensate error": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+
+			withTenantVerification:     true,
+			propagate:                  true,
+			tenantCreateUserErr:        ct.ErrDuplicateUser,
+			tenantDeleteUserErr:        errors.New("delate user error"),
+			shouldVerifyTenant:         true,
+			shouldCompensateTenantUser: true,
+
+			dbErr:  nil,
+			outErr: errors.New("tenant data out of sync: faield to delete tenant user: delate user error"),
+		},
+		"error, multitenant: duplicate user, get user error": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+
+			withTenantVerification: true,
+			propagate:              true,
+			shouldVerifyTenant:     true,
+			tenantCreateUserErr:    ct.ErrDuplicateUser,
+
+			dbGetUserErr: errors.New("db error"),
+			dbErr:        nil,
+			outErr:       errors.New("tenant data out of sync: failed to get user from db: db error"),
+		},
+		"error, multitenant: pending user": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+
+			withTenantVerification: true,
+			propagate:              true,
+			dbCreatePendingUserErr: errors.New("db error"),
+
+			outErr: errors.New("useradm: failed to record user creation: db error"),
+		},
+		"error, multitenant: generic": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+
+			withTenantVerification: true,
+			propagate:              true,
+			tenantCreateUserErr:    errors.New("http 500"),
+			shouldVerifyTenant:     true,
+
+			dbErr:  nil,
+			outErr: errors.New("useradm: failed to create user in tenantadm: http 500"),
+		},
+		"db error: duplicate email": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+			dbErr:  store.ErrDuplicateEmail,
+			outErr: store.ErrDuplicateEmail,
+		},
+		"db error, multitenant: duplicate email": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+			withTenantVerification: true,
+			propagate:              true,
+			shouldVerifyTenant:     true,
+			dbErr:                  store.ErrDuplicateEmail,
+			outErr:                 store.ErrDuplicateEmail,
+		},
+		"db error: user limit reached": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+			dbErr:  store.ErrUserLimitReached,
+			outErr: store.ErrUserLimitReached,
+		},
+		"db error, multitenant: user limit reached": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+			withTenantVerification:     true,
+			propagate:                  true,
+			shouldVerifyTenant:         true,
+			shouldCompensateTenantUser: true,
+			dbErr:                      store.ErrUserLimitReached,
+			outErr:                     store.ErrUserLimitReached,
+			shouldCompletePendingUser:  true,
+		},
+		"db error: general": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+			dbErr: errors.New("no reachable servers"),
+
+			outErr: errors.New("useradm: failed to create user in the db: no reachable servers"),
+		},
+		"db error, multitenant: general": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+			withTenantVerification:     true,
+			propagate:                  true,
+			shouldVerifyTenant:         true,
+			shouldCompensateTenantUser: true,
+
+			dbErr:                     errors.New("no reachable servers"),
+			outErr:                    errors.New("useradm: failed to create user in the db: no reachable servers"),
+			shouldCompletePendingUser: true,
+		},
+		"db error, multitenant: general, compensate error": {
+			inUser: model.User{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+			withTenantVerification:     true,
+			propagate:                  true,
+			shouldVerifyTenant:         true,
+			shouldCompensateTenantUser: true,
+			tenantDeleteUserErr:        errors.New("delate user error"),
+
+			dbErr:  errors.New("no reachable servers"),
+			outErr: errors.New("useradm: failed to create user in the db: faield to delete tenant user: delate user error: no reachable servers"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Logf("test case: %s", name)
+
+		ctx := context.Background()
+
+		db := &mstore.DataStore{}
+		db.On("GetPlan", ContextMatcher()).Return(nil, nil)
+		db.On("CreateUser",
+			ContextMatcher(),
+			mock.AnythingOfType("*model.User")).
+			Return(tc.dbErr)
+
+		db.On("GetUserByEmail", ContextMatcher(), mock.AnythingOfType("string")).
+			Return(tc.dbUser, tc.dbGetUserErr)
+
+		db.On("CreatePendingUser", ContextMatcher(),
+			mock.MatchedBy(func(p *model.PendingUser) bool {
+				return p.UserID != "" && p.TenantID == "foo"
+			})).
+			Return(tc.dbCreatePendingUserErr)
+		db.On("DeletePendingUser", ContextMatcher(), mock.AnythingOfType("string")).
+			Return(nil)
+
+		useradm := NewUserAdm(nil, db, nil, Config{})
+		cTenant := &mct.TenantVerifier{}
+
+		id := &identity.Identity{
+			Tenant: "foo",
+		}
+		ctx = identity.WithContext(ctx, id)
+
+		if tc.shouldVerifyTenant {
+			cTenant.On("CreateUser",
+				ContextMatcher(),
+				mock.AnythingOfType("*tenant.User")).
+				Return(tc.tenantCreateUserErr)
+
+			if tc.shouldCompensateTenantUser {
+				cTenant.On("DeleteUser",
+					ContextMatcher(),
+					mock.AnythingOfType("string"), mock.AnythingOfType("string")).
+					Return(tc.tenantDeleteUserErr)
+			}
+		}
+		if tc.withTenantVerification {
+			useradm = useradm.WithTenantVerification(cTenant)
+		}
+
+		err := useradm.doCreateUser(ctx, &tc.inUser, tc.propagate)
+
+		if tc.outErr != nil {
+			assert.EqualError(t, err, tc.outErr.Error())
+		} else {
+			assert.NoError(t, err)
+		}
+
+		cTenant.AssertExpectations(t)
+		if tc.shouldCompletePendingUser {
+			db.AssertCalled(t, "DeletePendingUser", ContextMatcher(), tc.inUser.ID)
+		} else {
+			db.AssertNotCalled(t, "DeletePendingUser", ContextMatcher(), mock.Anything)
+		}
+	}
+
+}
 
 func TestUserAdmUpdateUser(t *testing.T) {
 	testCases := map[string]struct {
-		inUserUpdate model.UserUpdate
+		inUserUpdate model.UserUpdate
+
+		verifyTenant bool
+		tenantErr    error
+
+		// active users counted before and after the update
+		dbActive   []int
+		dbErr      error
+		dbSettings map[string]interface{}
+
+		outErr error
+	}{
+		"ok": {
+			inUserUpdate: model.UserUpdate{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+			dbErr:  nil,
+			outErr: nil,
+		},
+		"error: password shorter than tenant's policy": {
+			inUserUpdate: model.UserUpdate{
+				Password: "correcthorse",
+			},
+			dbSettings: map[string]interface{}{
+				model.SettingPasswordMinLength: float64(16),
+			},
+			outErr: model.ErrPasswordTooShort,
+		},
+		"ok, multitenant": {
+			inUserUpdate: model.UserUpdate{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+
+			verifyTenant: true,
+			tenantErr:    nil,
+
+			dbErr:  nil,
+			outErr: nil,
+		},
+		"error, multitenant: duplicate user": {
+			inUserUpdate: model.UserUpdate{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+
+			verifyTenant: true,
+			tenantErr:    ct.ErrDuplicateUser,
+
+			dbErr:  nil,
+			outErr: errors.New("user with a given email already exists"),
+		},
+		"error, multitenant: not found": {
+			inUserUpdate: model.UserUpdate{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+
+			verifyTenant: true,
+			tenantErr:    ct.ErrUserNotFound,
+
+			dbErr:  nil,
+			outErr: errors.New("user not found"),
+		},
+		"error, multitenant: generic": {
+			inUserUpdate: model.UserUpdate{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+
+			verifyTenant: true,
+			tenantErr:    errors.New("http 500"),
+
+			dbErr:  nil,
+			outErr: errors.New("useradm: failed to update user in tenantadm: http 500"),
+		},
+		"ok, deactivate": {
+			inUserUpdate: model.UserUpdate{
+				Status: model.UserStatusInactive,
+			},
+			dbActive: []int{2, 1},
+		},
+		"error: deactivate last admin": {
+			inUserUpdate: model.UserUpdate{
+				Status: model.UserStatusInactive,
+			},
+			dbActive: []int{1},
+			outErr:   ErrLastAdmin,
+		},
+		"error: deactivate last admin concurrently": {
+			inUserUpdate: model.UserUpdate{
+				Status: model.UserStatusInactive,
+			},
+			dbActive: []int{2, 0},
+			outErr:   ErrLastAdmin,
+		},
+		"db error: duplicate email": {
+			inUserUpdate: model.UserUpdate{
+				Email: "foo@bar.com",
+			},
+			dbErr:  store.ErrDuplicateEmail,
+			outErr: store.ErrDuplicateEmail,
+		},
+		"db error: etag mismatch": {
+			inUserUpdate: model.UserUpdate{
+				Email:   "foo@bar.com",
+				IfMatch: []string{"v1"},
+			},
+			dbErr:  store.ErrETagMismatch,
+			outErr: store.ErrETagMismatch,
+		},
+		"db error: general": {
+			inUserUpdate: model.UserUpdate{
+				Email:    "foo@bar.com",
+				Password: "correcthorsebatterystaple",
+			},
+			dbErr: errors.New("no reachable servers"),
+
+			outErr: errors.New("useradm: failed to update user information: no reachable servers"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc: %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			for _, n := range tc.dbActive {
+				db.On("CountUsers", ContextMatcher(), model.UserFilter{Active: true}).
+					Return(n, nil).Once()
+			}
+			db.On("UpdateUser",
+				ContextMatcher(),
+				mock.AnythingOfType("string"),
+				mock.AnythingOfType("*model.UserUpdate")).
+				Return(tc.dbErr)
+			db.On("GetSettings", ContextMatcher()).Return(tc.dbSettings, nil)
+			db.On("GetUserById", ContextMatcher(), "123").
+				Return(&model.User{ID: "123", Email: "old@bar.com"}, nil)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			cTenant := &mct.TenantVerifier{}
+			if tc.verifyTenant {
+				id := &identity.Identity{
+					Tenant: "foo",
+				}
+				ctx = identity.WithContext(ctx, id)
+
+				cTenant.On("UpdateUser",
+					ContextMatcher(),
+					mock.AnythingOfType("string"),
+					mock.AnythingOfType("string"),
+					mock.AnythingOfType("*tenant.UserUpdate")).
+					Return(tc.tenantErr)
+				useradm = useradm.WithTenantVerification(cTenant)
+			}
+
+			err := useradm.UpdateUser(ctx, "123", &tc.inUserUpdate)
+
+			if tc.outErr != nil {
+				assert.EqualError(t, err, tc.outErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.dbErr != nil {
+				cTenant.AssertNotCalled(t, "UpdateUser",
+					mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+			if tc.tenantErr != nil {
+				// the email changed in the db is reverted
+				db.AssertNumberOfCalls(t, "UpdateUser", 2)
+				db.AssertCalled(t, "UpdateUser", ContextMatcher(), "123",
+					&model.UserUpdate{Email: "old@bar.com", IfMatch: []string{""}})
+			}
+			if len(tc.dbActive) == 2 && tc.outErr != nil {
+				// the deactivation is reverted
+				db.AssertCalled(t, "UpdateUser", ContextMatcher(), "123",
+					&model.UserUpdate{Status: model.UserStatusActive})
+			}
+			db.AssertNumberOfCalls(t, "CountUsers", len(tc.dbActive))
+		})
+	}
+}
+
+func TestUserAdmVerify(t *testing.T) {
+	testCases := map[string]struct {
+		token *jwt.Token
+
+		dbUser    *model.User
+		dbUserErr error
+
+		dbToken    *jwt.Token
+		dbTokenErr error
+
+		dbRevokedTs    time.Time
+		dbRevokedTsErr error
+
+		verifyTenant   bool
+		dbTenantStatus *model.TenantStatus
+
+		err error
+	}{
+		"ok": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "mender",
+					User:    true,
+				},
+			},
+			dbUser: &model.User{
+				ID: "1234",
+			},
+			dbToken: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "mender",
+					User:    true,
+				},
+			},
+		},
+		"ok, issued after revocation": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject:  "1234",
+					Issuer:   "mender",
+					IssuedAt: 1500000001,
+					User:     true,
+				},
+			},
+			dbUser: &model.User{
+				ID: "1234",
+			},
+			dbToken: &jwt.Token{
+				Id: "token-1",
+			},
+			dbRevokedTs: time.Unix(1500000000, 0),
+		},
+		"error: token revoked": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject:  "1234",
+					Issuer:   "mender",
+					IssuedAt: 1500000000,
+					User:     true,
+				},
+			},
+			dbUser: &model.User{
+				ID: "1234",
+			},
+			dbToken: &jwt.Token{
+				Id: "token-1",
+			},
+			dbRevokedTs: time.Unix(1500000000, 500),
+
+			err: ErrUnauthorized,
+		},
+		"error: db revocation": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "mender",
+					User:    true,
+				},
+			},
+			dbUser: &model.User{
+				ID: "1234",
+			},
+			dbToken: &jwt.Token{
+				Id: "token-1",
+			},
+			dbRevokedTsErr: errors.New("db failed"),
+
+			err: errors.New("useradm: failed to get token revocation: db failed"),
+		},
+		"error: invalid token issuer": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "foo",
+					User:    true,
+				},
+			},
+			err: ErrUnauthorized,
+		},
+		"error: not a user token": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "mender",
+				},
+			},
+			err: ErrUnauthorized,
+		},
+		"error: user not found": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "mender",
+					User:    true,
+				},
+			},
+			err: ErrUnauthorized,
+		},
+		"error: token not found": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "mender",
+					User:    true,
+				},
+			},
+			dbUser: &model.User{
+				ID: "1234",
+			},
+
+			dbToken:    nil,
+			dbTokenErr: nil,
+
+			err: ErrUnauthorized,
+		},
+		"error: user inactive": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "mender",
+					User:    true,
+				},
+			},
+			dbUser: &model.User{
+				ID:     "1234",
+				Status: model.UserStatusInactive,
+			},
+
+			err: ErrUnauthorized,
+		},
+		"ok, tenant in grace period": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "mender",
+					Tenant:  "tenant1id",
+					User:    true,
+				},
+			},
+			dbUser: &model.User{
+				ID: "1234",
+			},
+			dbToken: &jwt.Token{
+				Id: "token-1",
+			},
+			verifyTenant: true,
+			dbTenantStatus: &model.TenantStatus{
+				Status:    model.TenantStatusTrialExpired,
+				UpdatedTs: time.Now().Add(-time.Minute),
+			},
+		},
+		"error: tenant trial expired": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "mender",
+					Tenant:  "tenant1id",
+					User:    true,
+				},
+			},
+			dbUser: &model.User{
+				ID: "1234",
+			},
+			dbToken: &jwt.Token{
+				Id: "token-1",
+			},
+			verifyTenant: true,
+			dbTenantStatus: &model.TenantStatus{
+				Status:    model.TenantStatusTrialExpired,
+				UpdatedTs: time.Now().Add(-2 * time.Hour),
+			},
+
+			err: ErrTenantTrialExpired,
+		},
+		"error: tenant suspended": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "mender",
+					Tenant:  "tenant1id",
+					User:    true,
+				},
+			},
+			dbUser: &model.User{
+				ID: "1234",
+			},
+			dbToken: &jwt.Token{
+				Id: "token-1",
+			},
+			verifyTenant: true,
+			dbTenantStatus: &model.TenantStatus{
+				Status:    model.TenantStatusSuspended,
+				UpdatedTs: time.Now(),
+			},
+
+			err: ErrTenantAccountSuspended,
+		},
+		"error: db user": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "mender",
+					User:    true,
+				},
+			},
+			dbUserErr: errors.New("db internal error"),
+
+			err: errors.New("useradm: failed to get user: db internal error"),
+		},
+		"error: db token": {
+			token: &jwt.Token{
+				Id: "token-1",
+				Claims: jwt.Claims{
+					Subject: "1234",
+					Issuer:  "mender",
+					User:    true,
+				},
+			},
+			dbUser: &model.User{
+				ID: "1234",
+			},
+
+			dbToken:    nil,
+			dbTokenErr: errors.New("db failed"),
+
+			err: errors.New("useradm: failed to get token: db failed"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("test case: %s", name), func(t *testing.T) {
+
+			config := Config{Issuer: "mender", TenantGracePeriod: 3600}
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ctx,
+				tc.token.Claims.Subject).Return(tc.dbUser, tc.dbUserErr)
+			db.On("GetTokenById", ctx,
+				tc.token.Id).Return(tc.dbToken, tc.dbTokenErr)
+			db.On("GetTokensRevokedTs", ctx,
+				tc.token.Claims.Subject).Return(tc.dbRevokedTs, tc.dbRevokedTsErr)
+
+			db.On("GetTenantStatus", ctx).Return(tc.dbTenantStatus, nil)
+
+			useradm := NewUserAdm(nil, db, nil, config)
+			if tc.verifyTenant {
+				useradm = useradm.WithTenantVerification(&mct.TenantVerifier{})
+			}
+
+			err := useradm.Verify(ctx, tc.token)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestUserAdmGetUsers(t *testing.T) {
+	t.Parallel()
+	ts := time.Now()
+	testCases := map[string]struct {
+		dbUsers []model.User
+		dbErr   error
+
+		err error
+	}{
+		"ok: some users": {
+			dbUsers: []model.User{
+				{
+					ID:        "1",
+					Email:     "foo",
+					CreatedTs: &ts,
+				},
+				{
+					ID:        "2",
+					Email:     "bar",
+					UpdatedTs: &ts,
+				},
+			},
+			dbErr: nil,
+			err:   nil,
+		},
+		"ok: no users": {
+			dbUsers: []model.User{},
+			dbErr:   nil,
+			err:     nil,
+		},
+		"error: db": {
+			dbUsers: nil,
+			dbErr:   errors.New("db connection failed"),
+			err:     errors.New("useradm: failed to get users: db connection failed"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			t.Logf("test case: %s", name)
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetUsers", ctx, model.UserFilter{}).Return(tc.dbUsers, tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			users, err := useradm.GetUsers(ctx, model.UserFilter{})
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.dbUsers, users)
+			}
+		})
+	}
+}
+
+func TestUserAdmCountUsers(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dbCount int
+		dbErr   error
+
+		err error
+	}{
+		"ok": {
+			dbCount: 2,
+		},
+		"error: db": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to count users: db connection failed"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+			fltr := model.UserFilter{Group: "group-1"}
+
+			db := &mstore.DataStore{}
+			db.On("CountUsers", ctx, fltr).Return(tc.dbCount, tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			n, err := useradm.CountUsers(ctx, fltr)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.dbCount, n)
+			}
+		})
+	}
+}
+
+func TestUserAdmGetUsersVersion(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dbVersion *model.UsersVersion
+		dbErr     error
+
+		err error
+	}{
+		"ok": {
+			dbVersion: &model.UsersVersion{Count: 2, UpdatedTs: time.Now()},
+		},
+		"error: db": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to get users version: db connection failed"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+			fltr := model.UserFilter{Group: "group-1"}
+
+			db := &mstore.DataStore{}
+			db.On("GetUsersVersion", ctx, fltr).Return(tc.dbVersion, tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			v, err := useradm.GetUsersVersion(ctx, fltr)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.dbVersion, v)
+			}
+		})
+	}
+}
+
+func TestUserAdmForEachUser(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dbErr error
+
+		err error
+	}{
+		"ok": {},
+		"error: db": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to iterate users: db connection failed"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+			fltr := model.UserFilter{Group: "group-1"}
+
+			db := &mstore.DataStore{}
+			db.On("ForEachUser", ctx, fltr,
+				mock.AnythingOfType("func(*model.User) error")).
+				Return(tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			err := useradm.ForEachUser(ctx, fltr, func(*model.User) error { return nil })
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestUserAdmGetUser(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Now()
+
+	testCases := map[string]struct {
+		dbUser *model.User
+		dbErr  error
+
+		err error
+	}{
+		"ok 1": {
+			dbUser: &model.User{
+				ID:        "1",
+				Email:     "foo",
+				UpdatedTs: &ts,
+				CreatedTs: &ts,
+			},
+			dbErr: nil,
+			err:   nil,
+		},
+		"ok: no user": {
+			dbUser: nil,
+			dbErr:  nil,
+			err:    nil,
+		},
+		"error: generic db error": {
+			dbUser: nil,
+			dbErr:  errors.New("db connection failed"),
+			err:    errors.New("useradm: failed to get user: db connection failed"),
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			t.Logf("test case: %s", name)
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ctx, "foo").Return(tc.dbUser, tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			user, err := useradm.GetUser(ctx, "foo")
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.dbUser, user)
+			}
+		})
+	}
+}
+
+func TestUserAdmGetLoginHistory(t *testing.T) {
+	t.Parallel()
+
+	events := []model.LoginEvent{
+		{
+			ID:        "event-2",
+			UserID:    "foo",
+			Timestamp: time.Now(),
+			Success:   true,
+			Method:    model.LoginMethodPassword,
+		},
+		{
+			ID:        "event-1",
+			UserID:    "foo",
+			Timestamp: time.Now().Add(-time.Hour),
+			Success:   false,
+			Method:    model.LoginMethodPassword,
+		},
+	}
+
+	testCases := map[string]struct {
+		dbUser     *model.User
+		dbUserErr  error
+		dbEvents   []model.LoginEvent
+		dbEventErr error
+
+		events []model.LoginEvent
+		err    error
+	}{
+		"ok": {
+			dbUser:   &model.User{ID: "foo"},
+			dbEvents: events,
+			events:   events,
+		},
+		"ok, no history": {
+			dbUser:   &model.User{ID: "foo"},
+			dbEvents: []model.LoginEvent{},
+			events:   []model.LoginEvent{},
+		},
+		"error: user not found": {
+			err: store.ErrUserNotFound,
+		},
+		"error: get user": {
+			dbUserErr: errors.New("db connection failed"),
+			err:       errors.New("useradm: failed to get user: db connection failed"),
+		},
+		"error: get events": {
+			dbUser:     &model.User{ID: "foo"},
+			dbEventErr: errors.New("db connection failed"),
+			err:        errors.New("useradm: failed to get login history: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ContextMatcher(), "foo").
+				Return(tc.dbUser, tc.dbUserErr)
+			db.On("GetPlan", ContextMatcher()).Return(nil, nil)
+			db.On("GetLoginEvents", ContextMatcher(), "foo").
+				Return(tc.dbEvents, tc.dbEventErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			events, err := useradm.GetLoginHistory(ctx, "foo")
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.events, events)
+			}
+		})
+	}
+}
+
+func TestUserAdmGetUserTokens(t *testing.T) {
+	t.Parallel()
+
+	issued := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := map[string]struct {
+		dbUser     *model.User
+		dbUserErr  error
+		dbTokens   []jwt.Token
+		dbTokenErr error
+
+		tokens []model.TokenInfo
+		err    error
+	}{
+		"ok": {
+			dbUser: &model.User{ID: "foo"},
+			dbTokens: []jwt.Token{
+				{
+					Id: "token-1",
+					Claims: jwt.Claims{
+						IssuedAt:  issued.Unix(),
+						ExpiresAt: issued.Add(time.Hour).Unix(),
+					},
+				},
+			},
+			tokens: []model.TokenInfo{
+				{
+					ID:        "token-1",
+					IssuedAt:  issued,
+					ExpiresAt: issued.Add(time.Hour),
+				},
+			},
+		},
+		"ok, no tokens": {
+			dbUser:   &model.User{ID: "foo"},
+			dbTokens: []jwt.Token{},
+			tokens:   []model.TokenInfo{},
+		},
+		"error: user not found": {
+			err: store.ErrUserNotFound,
+		},
+		"error: get user": {
+			dbUserErr: errors.New("db connection failed"),
+			err:       errors.New("useradm: failed to get user: db connection failed"),
+		},
+		"error: get tokens": {
+			dbUser:     &model.User{ID: "foo"},
+			dbTokenErr: errors.New("db connection failed"),
+			err:        errors.New("useradm: failed to get tokens: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ContextMatcher(), "foo").
+				Return(tc.dbUser, tc.dbUserErr)
+			db.On("GetTokensByUserId", ContextMatcher(), "foo").
+				Return(tc.dbTokens, tc.dbTokenErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			tokens, err := useradm.GetUserTokens(ctx, "foo")
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.tokens, tokens)
+			}
+		})
+	}
+}
+
+func TestUserAdmLookupUser(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		verifyTenant bool
+		tenant       *ct.Tenant
+		tenantErr    error
+		// the tenant of the email as given, not normalized
+		givenTenant *ct.Tenant
+
+		login string
+
+		dbUser *model.User
+		dbErr  error
+
+		lookup *model.UserLookup
+		err    error
+	}{
+		"ok": {
+			dbUser: &model.User{ID: "1", Email: "foo@bar.com"},
+			lookup: &model.UserLookup{ID: "1", Email: "foo@bar.com"},
+		},
+		"ok, multitenant": {
+			verifyTenant: true,
+			tenant:       &ct.Tenant{ID: "tenant-1"},
+			dbUser:       &model.User{ID: "1", Email: "foo@bar.com"},
+			lookup: &model.UserLookup{
+				ID:       "1",
+				Email:    "foo@bar.com",
+				TenantID: "tenant-1",
+			},
+		},
+		"ok, multitenant, user known to tenantadm by the email as given": {
+			verifyTenant: true,
+			givenTenant:  &ct.Tenant{ID: "tenant-1"},
+			dbUser:       &model.User{ID: "1", Email: "foo@bar.com"},
+			lookup: &model.UserLookup{
+				ID:       "1",
+				Email:    "foo@bar.com",
+				TenantID: "tenant-1",
+			},
+		},
+		"ok, username": {
+			login:  "Foo.Bar",
+			dbUser: &model.User{ID: "1", Email: "foo@bar.com", Username: "foo.bar"},
+			lookup: &model.UserLookup{ID: "1", Email: "foo@bar.com", Username: "foo.bar"},
+		},
+		"error: not found": {
+			err: store.ErrUserNotFound,
+		},
+		"error: username, multitenant": {
+			login:        "foo.bar",
+			verifyTenant: true,
+			err:          store.ErrUserNotFound,
+		},
+		"error: multitenant, no tenant": {
+			verifyTenant: true,
+			err:          store.ErrUserNotFound,
+		},
+		"error: multitenant, tenantadm error": {
+			verifyTenant: true,
+			tenantErr:    errors.New("http 500"),
+			err:          errors.New("useradm: failed to check user's tenant: http 500"),
+		},
+		"error: db": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to get user: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetUserByEmail",
+				mock.MatchedBy(func(c context.Context) bool {
+					ident := identity.FromContext(c)
+					if tc.tenant == nil && tc.givenTenant == nil {
+						return ident == nil
+					}
+					return ident != nil && ident.Tenant == "tenant-1"
+				}),
+				"foo@bar.com").
+				Return(tc.dbUser, tc.dbErr)
+			db.On("GetUserByUsername", ContextMatcher(), "foo.bar").
+				Return(tc.dbUser, tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+			if tc.verifyTenant {
+				cTenant := &mct.TenantVerifier{}
+				cTenant.On("GetTenant", ContextMatcher(), "foo@bar.com").
+					Return(tc.tenant, tc.tenantErr)
+				cTenant.On("GetTenant", ContextMatcher(), "Foo@Bar.com").
+					Return(tc.givenTenant, nil)
+				useradm = useradm.WithTenantVerification(cTenant)
+			}
+
+			// the email is looked up normalized
+			login := "Foo@Bar.com"
+			if tc.login != "" {
+				login = tc.login
+			}
+			lookup, err := useradm.LookupUser(ctx, login)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.lookup, lookup)
+			}
+		})
+	}
+}
+
+func TestUserAdmGetUserData(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	events := []model.LoginEvent{
+		{
+			ID:        "event-1",
+			UserID:    "foo",
+			Timestamp: ts,
+			Success:   true,
+			Method:    model.LoginMethodPassword,
+		},
+	}
+
+	testCases := map[string]struct {
+		dbUser      *model.User
+		dbUserErr   error
+		dbGroups    []model.Group
+		dbGroupsErr error
+		dbTokens    []jwt.Token
+		dbTokensErr error
+		dbEvents    []model.LoginEvent
+
+		dbUserSettings    map[string]interface{}
+		dbUserSettingsErr error
+
+		data *model.UserData
+		err  error
+	}{
+		"ok": {
+			dbUser: &model.User{
+				ID:     "foo",
+				Email:  "foo@acme.com",
+				Groups: []string{"group-1"},
+			},
+			dbGroups: []model.Group{{ID: "group-1", Name: "qa"}},
+			dbTokens: []jwt.Token{
+				{
+					Id: "token-1",
+					Claims: jwt.Claims{
+						Subject:   "foo",
+						IssuedAt:  ts.Unix(),
+						ExpiresAt: ts.Add(time.Hour).Unix(),
+					},
+				},
+			},
+			dbEvents: events,
+			dbUserSettings: map[string]interface{}{
+				"theme":                    "dark",
+				SettingNotificationsOptOut: true,
+			},
+
+			data: &model.UserData{
+				User: model.User{
+					ID:     "foo",
+					Email:  "foo@acme.com",
+					Groups: []string{"group-1"},
+				},
+				Groups: []model.Group{{ID: "group-1", Name: "qa"}},
+				Tokens: []model.TokenInfo{
+					{ID: "token-1", IssuedAt: ts, ExpiresAt: ts.Add(time.Hour)},
+				},
+				LoginHistory: events,
+				Settings: model.UserDataSettings{
+					NotificationsOptOut: true,
+					Preferences: map[string]interface{}{
+						"theme":                    "dark",
+						SettingNotificationsOptOut: true,
+					},
+				},
+			},
+		},
+		"ok, nothing but the user": {
+			dbUser:   &model.User{ID: "foo", Email: "foo@acme.com"},
+			dbTokens: []jwt.Token{},
+			dbEvents: []model.LoginEvent{},
+
+			dbUserSettings: map[string]interface{}{},
+
+			data: &model.UserData{
+				User:         model.User{ID: "foo", Email: "foo@acme.com"},
+				Groups:       []model.Group{},
+				Tokens:       []model.TokenInfo{},
+				LoginHistory: []model.LoginEvent{},
+				Settings: model.UserDataSettings{
+					Preferences: map[string]interface{}{},
+				},
+			},
+		},
+		"error: user not found": {
+			err: store.ErrUserNotFound,
+		},
+		"error: get user": {
+			dbUserErr: errors.New("db connection failed"),
+			err:       errors.New("useradm: failed to get user: db connection failed"),
+		},
+		"error: get groups": {
+			dbUser: &model.User{
+				ID:     "foo",
+				Groups: []string{"group-1"},
+			},
+			dbGroupsErr: errors.New("db connection failed"),
+			err:         errors.New("useradm: failed to get groups: db connection failed"),
+		},
+		"error: get tokens": {
+			dbUser:      &model.User{ID: "foo"},
+			dbTokensErr: errors.New("db connection failed"),
+			err:         errors.New("useradm: failed to get tokens: db connection failed"),
+		},
+		"error: get user settings": {
+			dbUser:            &model.User{ID: "foo"},
+			dbUserSettingsErr: errors.New("db connection failed"),
+			err:               errors.New("useradm: failed to get user settings: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ContextMatcher(), "foo").
+				Return(tc.dbUser, tc.dbUserErr)
+			db.On("GetGroupsByIds", ContextMatcher(), []string{"group-1"}).
+				Return(tc.dbGroups, tc.dbGroupsErr)
+			db.On("GetTokensByUserId", ContextMatcher(), "foo").
+				Return(tc.dbTokens, tc.dbTokensErr)
+			db.On("GetLoginEvents", ContextMatcher(), "foo").
+				Return(tc.dbEvents, nil)
+			db.On("GetUserSettings", ContextMatcher(), "foo").
+				Return(tc.dbUserSettings, tc.dbUserSettingsErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			data, err := useradm.GetUserData(ctx, "foo")
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.WithinDuration(t, time.Now(), data.ExportedTs, time.Minute)
+				data.ExportedTs = time.Time{}
+				assert.Equal(t, tc.data, data)
+			}
+		})
+	}
+}
+
+func TestUserAdmDeleteUser(t *testing.T) {
+	t.Parallel()
+
+	user := &model.User{ID: "foo", Email: "foo@bar.com"}
+
+	testCases := map[string]struct {
+		subject      string
+		verifyTenant bool
+		tenantErr    error
+		dbUser       *model.User
+		dbUserErr    error
+		// active users counted before and after the removal
+		dbActive   []int
+		dbErr      error
+		restored   bool
+		restoreErr error
+		err        error
+	}{
+		"ok": {
+			dbUser:   user,
+			dbActive: []int{2, 1},
+			dbErr:    nil,
+			err:      nil,
+		},
+		"ok, multitenant": {
+			verifyTenant: true,
+			dbUser:       user,
+			dbActive:     []int{2, 1},
+			dbErr:        nil,
+			err:          nil,
+		},
+		"ok, user does not exist": {
+			dbErr: nil,
+			err:   nil,
+		},
+		"multitenant, tenantadm error": {
+			verifyTenant: true,
+			dbUser:       user,
+			dbActive:     []int{2, 1},
+			tenantErr:    errors.New("http 500"),
+			dbErr:        nil,
+			restored:     true,
+			err:          errors.New("useradm: failed to delete user in tenantadm: http 500"),
+		},
+		"multitenant, tenantadm error, restore failed": {
+			verifyTenant: true,
+			dbUser:       user,
+			dbActive:     []int{2, 1},
+			tenantErr:    errors.New("http 500"),
+			restored:     true,
+			restoreErr:   errors.New("db connection failed"),
+			err: errors.New("useradm: failed to delete user in tenantadm: " +
+				"db connection failed: http 500"),
+		},
+		"multitenant, etag mismatch": {
+			verifyTenant: true,
+			dbUser:       user,
+			dbActive:     []int{2},
+			dbErr:        store.ErrETagMismatch,
+			err:          store.ErrETagMismatch,
+		},
+		"error: last admin": {
+			dbUser:   user,
+			dbActive: []int{1},
+			err:      ErrLastAdmin,
+		},
+		"error: last admin deleted concurrently": {
+			dbUser:   user,
+			dbActive: []int{2, 0},
+			restored: true,
+			err:      ErrLastAdmin,
+		},
+		"error: last admin deleted concurrently, restore failed": {
+			dbUser:     user,
+			dbActive:   []int{2, 0},
+			restored:   true,
+			restoreErr: errors.New("db connection failed"),
+			err: errors.New("useradm: failed to keep the last administrator: " +
+				"db connection failed"),
+		},
+		"ok, inactive user": {
+			dbUser: &model.User{
+				ID:     "foo",
+				Email:  "foo@bar.com",
+				Status: model.UserStatusInactive,
+			},
+		},
+		"error: get user": {
+			dbUserErr: errors.New("db connection failed"),
+			err:       errors.New("useradm: failed to get user: db connection failed"),
+		},
+		"error: self delete": {
+			subject: "foo",
+			dbUser:  user,
+			err:     ErrSelfDelete,
+		},
+		"error": {
+			dbUser:   user,
+			dbActive: []int{2},
+			dbErr:    errors.New("db connection failed"),
+			err:      errors.New("useradm: failed to delete user: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			t.Logf("test case: %s", name)
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ContextMatcher(), "foo").Return(tc.dbUser, tc.dbUserErr)
+			for _, n := range tc.dbActive {
+				db.On("CountUsers", ContextMatcher(), model.UserFilter{Active: true}).
+					Return(n, nil).Once()
+			}
+			db.On("DeleteUser", ContextMatcher(), "foo", []string{"v1"}).Return(tc.dbErr)
+			db.On("RestoreUser", ContextMatcher(), "foo").Return(tc.restoreErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+			if tc.subject != "" {
+				ctx = identity.WithContext(ctx, &identity.Identity{
+					Subject: tc.subject,
+				})
+			}
+			if tc.verifyTenant {
+				id := &identity.Identity{
+					Tenant: "bar",
+				}
+				ctx = identity.WithContext(ctx, id)
+
+				cTenant := &mct.TenantVerifier{}
+				cTenant.On("DeleteUser",
+					ContextMatcher(),
+					"bar", "foo").
+					Return(tc.tenantErr)
+				useradm = useradm.WithTenantVerification(cTenant)
+			}
+
+			err := useradm.DeleteUser(ctx, "foo", []string{"v1"})
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.restored {
+				db.AssertCalled(t, "RestoreUser", ContextMatcher(), "foo")
+			} else {
+				db.AssertNotCalled(t, "RestoreUser", mock.Anything, mock.Anything)
+			}
+			db.AssertNumberOfCalls(t, "CountUsers", len(tc.dbActive))
+		})
+	}
+}
+
+func TestUserAdmDeleteOwnUser(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		subject  string
+		password string
+
+		dbUser      *model.User
+		dbUserErr   error
+		dbActive    []int
+		dbDeleteErr error
+
+		err error
+	}{
+		"ok": {
+			subject:  "foo",
+			password: "correcthorsebatterystaple",
+			dbUser: &model.User{
+				ID:       "foo",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+			},
+			dbActive: []int{2, 1},
+		},
+		"error: no identity": {
+			password: "correcthorsebatterystaple",
+			err:      ErrUnauthorized,
+		},
+		"error: wrong password": {
+			subject:  "foo",
+			password: "notmypassword",
+			dbUser: &model.User{
+				ID:       "foo",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+			},
+			err: ErrUnauthorized,
+		},
+		"error: user not found": {
+			subject:  "foo",
+			password: "correcthorsebatterystaple",
+			err:      ErrUnauthorized,
+		},
+		"error: db": {
+			subject:   "foo",
+			password:  "correcthorsebatterystaple",
+			dbUserErr: errors.New("db connection failed"),
+			err:       errors.New("useradm: failed to get user: db connection failed"),
+		},
+		"error: last admin": {
+			subject:  "foo",
+			password: "correcthorsebatterystaple",
+			dbUser: &model.User{
+				ID:       "foo",
+				Email:    "foo@bar.com",
+				Password: `$2a$10$wMW4kC6o1fY87DokgO.lDektJO7hBXydf4B.yIWmE8hR9jOiO8way`,
+			},
+			dbActive: []int{1},
+			err:      ErrLastAdmin,
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+			if tc.subject != "" {
+				ctx = identity.WithContext(ctx, &identity.Identity{
+					Subject: tc.subject,
+				})
+			}
+
+			db := &mstore.DataStore{}
+			db.On("GetUserById", ContextMatcher(), tc.subject).
+				Return(tc.dbUser, tc.dbUserErr)
+			if tc.dbUser != nil {
+				db.On("GetUserByEmail", ContextMatcher(), tc.dbUser.Email).
+					Return(tc.dbUser, nil)
+			}
+			for _, n := range tc.dbActive {
+				db.On("CountUsers", ContextMatcher(), model.UserFilter{Active: true}).
+					Return(n, nil).Once()
+			}
+			db.On("DeleteUser", ContextMatcher(), tc.subject, []string(nil)).Return(tc.dbDeleteErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			err := useradm.DeleteOwnUser(ctx, tc.password)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				db.AssertCalled(t, "DeleteUser", ContextMatcher(), tc.subject, []string(nil))
+			}
+		})
+	}
+}
+
+func TestUserAdmGetOwnSettings(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		subject string
+
+		dbSettings map[string]interface{}
+		dbErr      error
+
+		settings map[string]interface{}
+		err      error
+	}{
+		"ok": {
+			subject:    "foo",
+			dbSettings: map[string]interface{}{"theme": "dark"},
+			settings:   map[string]interface{}{"theme": "dark"},
+		},
+		"error: no identity": {
+			err: ErrUnauthorized,
+		},
+		"error: db": {
+			subject: "foo",
+			dbErr:   errors.New("db connection failed"),
+			err:     errors.New("useradm: failed to get user settings: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+			if tc.subject != "" {
+				ctx = identity.WithContext(ctx, &identity.Identity{
+					Subject: tc.subject,
+				})
+			}
+
+			db := &mstore.DataStore{}
+			db.On("GetUserSettings", ContextMatcher(), tc.subject).
+				Return(tc.dbSettings, tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			settings, err := useradm.GetOwnSettings(ctx)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.settings, settings)
+			}
+		})
+	}
+}
+
+func TestUserAdmSaveOwnSettings(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		subject  string
+		settings map[string]interface{}
+
+		dbErr error
+
+		err error
+	}{
+		"ok": {
+			subject:  "foo",
+			settings: map[string]interface{}{"theme": "dark"},
+		},
+		"error: no identity": {
+			settings: map[string]interface{}{"theme": "dark"},
+			err:      ErrUnauthorized,
+		},
+		"error: read-only": {
+			subject: "foo",
+			settings: map[string]interface{}{
+				"theme":      "dark",
+				"created_ts": "2018-01-01T00:00:00Z",
+			},
+			err: errors.New("created_ts: field can't be modified"),
+		},
+		"ok, notifications opt-out": {
+			subject: "foo",
+			settings: map[string]interface{}{
+				SettingNotificationsOptOut: true,
+			},
+		},
+		"error: invalid notifications opt-out": {
+			subject: "foo",
+			settings: map[string]interface{}{
+				SettingNotificationsOptOut: []interface{}{"foo"},
+			},
+			err: errors.New("email_notifications_opt_out: must be a boolean"),
+		},
+		"error: db": {
+			subject:  "foo",
+			settings: map[string]interface{}{"theme": "dark"},
+			dbErr:    errors.New("db connection failed"),
+			err:      errors.New("useradm: failed to save user settings: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+			ctx := context.Background()
+			if tc.subject != "" {
+				ctx = identity.WithContext(ctx, &identity.Identity{
+					Subject: tc.subject,
+				})
+			}
+
+			db := &mstore.DataStore{}
+			db.On("SaveUserSettings", ContextMatcher(), tc.subject, tc.settings).
+				Return(tc.dbErr)
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+
+			err := useradm.SaveOwnSettings(ctx, tc.settings)
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				db.AssertCalled(t, "SaveUserSettings", ContextMatcher(), "foo", tc.settings)
+			}
+		})
+	}
+}
+
+func TestUserAdmRestoreUser(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		verifyTenant bool
+		dbPlan       *model.Plan
+		dbCount      int
+		dbErr        error
+		dbUser       *model.User
+		tenantErr    error
+		compensate   bool
+		err          error
+	}{
+		"ok": {},
+		"ok, within plan": {
+			dbPlan:  &model.Plan{Name: model.PlanOpenSource},
+			dbCount: 4,
+		},
+		"error: plan limit": {
+			dbPlan:  &model.Plan{Name: model.PlanOpenSource},
+			dbCount: 5,
+			err:     ErrPlanLimit,
+		},
+		"error: user limit": {
+			dbErr: store.ErrUserLimitReached,
+			err:   store.ErrUserLimitReached,
+		},
+		"ok, multitenant": {
+			verifyTenant: true,
+			dbUser:       &model.User{ID: "foo", Email: "foo@bar.com"},
+		},
+		"ok, multitenant, user known to tenantadm": {
+			verifyTenant: true,
+			dbUser:       &model.User{ID: "foo", Email: "foo@bar.com"},
+			tenantErr:    ct.ErrDuplicateUser,
+		},
+		"multitenant, tenantadm error": {
+			verifyTenant: true,
+			dbUser:       &model.User{ID: "foo", Email: "foo@bar.com"},
+			tenantErr:    errors.New("http 500"),
+			compensate:   true,
+			err:          errors.New("useradm: failed to restore user in tenantadm: http 500"),
+		},
+		"error: not found": {
+			dbErr: store.ErrUserNotFound,
+			err:   store.ErrUserNotFound,
+		},
+		"error: duplicate email": {
+			dbErr: store.ErrDuplicateEmail,
+			err:   store.ErrDuplicateEmail,
+		},
+		"error": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to restore user: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("GetPlan", ContextMatcher()).Return(tc.dbPlan, nil)
+			if tc.dbPlan != nil {
+				db.On("CountUsers", ContextMatcher(), model.UserFilter{}).
+					Return(tc.dbCount, nil)
+			}
+			if tc.err != ErrPlanLimit {
+				db.On("RestoreUser", ContextMatcher(), "foo").Return(tc.dbErr)
+			}
+			if tc.compensate {
+				db.On("DeleteUser", ContextMatcher(), "foo", []string(nil)).Return(nil)
+			}
+
+			useradm := NewUserAdm(nil, db, nil, Config{})
+			if tc.verifyTenant {
+				ctx = identity.WithContext(ctx, &identity.Identity{
+					Tenant: "bar",
+				})
+
+				db.On("GetUserById", ContextMatcher(), "foo").Return(tc.dbUser, nil)
+
+				cTenant := &mct.TenantVerifier{}
+				cTenant.On("CreateUser",
+					ContextMatcher(),
+					&ct.User{
+						ID:       "foo",
+						Name:     "foo@bar.com",
+						TenantID: "bar",
+					}).
+					Return(tc.tenantErr)
+				useradm = useradm.WithTenantVerification(cTenant)
+			}
+
+			err := useradm.RestoreUser(ctx, "foo")
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			db.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserAdmEraseUser(t *testing.T) {
+	t.Parallel()
 
+	testCases := map[string]struct {
 		verifyTenant bool
+		dbUser       *model.User
 		tenantErr    error
+		dbEraseErr   error
+		signErr      error
+
+		err error
+	}{
+		"ok": {},
+		"ok, multitenant": {
+			verifyTenant: true,
+			dbUser:       &model.User{ID: "foo", Email: "foo@bar.com"},
+		},
+		"ok, multitenant, deleted user": {
+			verifyTenant: true,
+		},
+		"error: multitenant, tenantadm error": {
+			verifyTenant: true,
+			dbUser:       &model.User{ID: "foo", Email: "foo@bar.com"},
+			tenantErr:    errors.New("http 500"),
+			err:          errors.New("useradm: failed to delete user in tenantadm: http 500"),
+		},
+		"error: not found": {
+			dbEraseErr: store.ErrUserNotFound,
+			err:        store.ErrUserNotFound,
+		},
+		"error: db": {
+			dbEraseErr: errors.New("db connection failed"),
+			err:        errors.New("useradm: failed to erase user: db connection failed"),
+		},
+		"error: sign": {
+			signErr: errors.New("bad key"),
+			err:     errors.New("useradm: failed to sign erasure receipt: bad key"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := identity.WithContext(context.Background(),
+				&identity.Identity{
+					Tenant: "bar",
+				})
+
+			db := &mstore.DataStore{}
+			db.On("EraseUser", ContextMatcher(), "foo").Return(tc.dbEraseErr)
+
+			jwth := &mjwt.Handler{}
+			jwth.On("ToJWT",
+				mock.MatchedBy(func(t *jwt.Token) bool {
+					return t.Claims.Subject == "foo" &&
+						t.Claims.Tenant == "bar" &&
+						t.Claims.Scope == scope.UserErasure &&
+						t.Claims.ExpiresAt == 0
+				})).
+				Return("signed", tc.signErr)
+
+			useradm := NewUserAdm(jwth, db, nil, Config{})
+			if tc.verifyTenant {
+				db.On("GetUserById", ContextMatcher(), "foo").Return(tc.dbUser, nil)
+
+				cTenant := &mct.TenantVerifier{}
+				cTenant.On("DeleteUser",
+					ContextMatcher(), "bar", "foo").
+					Return(tc.tenantErr)
+				useradm = useradm.WithTenantVerification(cTenant)
+				defer func() {
+					if tc.dbUser != nil {
+						cTenant.AssertExpectations(t)
+					} else {
+						cTenant.AssertNotCalled(t, "DeleteUser",
+							ContextMatcher(), "bar", "foo")
+					}
+				}()
+			}
+
+			receipt, err := useradm.EraseUser(ctx, "foo")
+
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, "foo", receipt.UserID)
+				assert.Equal(t, "bar", receipt.TenantID)
+				assert.Equal(t, "signed", receipt.Signature)
+				assert.WithinDuration(t, time.Now(), receipt.ErasedTs, time.Minute)
+				db.AssertExpectations(t)
+			}
+		})
+	}
+}
+
+func TestUserAdmPurgeDeletedUsers(t *testing.T) {
+	t.Parallel()
 
+	testCases := map[string]struct {
 		dbErr error
-
-		outErr error
+		err   error
 	}{
-		"ok": {
-			inUserUpdate: model.UserUpdate{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
-			},
-			dbErr:  nil,
-			outErr: nil,
+		"ok": {},
+		"error": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to purge deleted users: db connection failed"),
 		},
-		"ok, multitenant": {
-			inUserUpdate: model.UserUpdate{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
-			},
+	}
 
-			verifyTenant: true,
-			tenantErr:    nil,
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
 
-			dbErr:  nil,
-			outErr: nil,
-		},
-		"error, multitenant: duplicate user": {
-			inUserUpdate: model.UserUpdate{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
-			},
+			ctx := context.Background()
 
-			verifyTenant: true,
-			tenantErr:    ct.ErrDuplicateUser,
+			retention := int64(3600)
+			now := time.Now()
 
-			dbErr:  nil,
-			outErr: errors.New("user with a given email already exists"),
-		},
-		"error, multitenant: not found": {
-			inUserUpdate: model.UserUpdate{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
-			},
+			db := &mstore.DataStore{}
+			db.On("PurgeDeletedUsers", ContextMatcher(),
+				mock.MatchedBy(func(before time.Time) bool {
+					cutoff := now.Add(-time.Duration(retention) * time.Second)
+					return !before.Before(cutoff) &&
+						before.Before(cutoff.Add(time.Minute))
+				})).
+				Return(tc.dbErr)
 
-			verifyTenant: true,
-			tenantErr:    ct.ErrUserNotFound,
+			useradm := NewUserAdm(nil, db, nil, Config{
+				DeletedUsersRetention: retention,
+			})
 
-			dbErr:  nil,
-			outErr: errors.New("user not found"),
-		},
-		"error, multitenant: generic": {
-			inUserUpdate: model.UserUpdate{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
-			},
+			err := useradm.PurgeDeletedUsers(ctx)
 
-			verifyTenant: true,
-			tenantErr:    errors.New("http 500"),
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			db.AssertExpectations(t)
+		})
+	}
+}
 
-			dbErr:  nil,
-			outErr: errors.New("useradm: failed to update user in tenantadm: http 500"),
-		},
-		"db error: duplicate email": {
-			inUserUpdate: model.UserUpdate{
-				Email: "foo@bar.com",
-			},
-			dbErr:  store.ErrDuplicateEmail,
-			outErr: store.ErrDuplicateEmail,
-		},
-		"db error: general": {
-			inUserUpdate: model.UserUpdate{
-				Email:    "foo@bar.com",
-				Password: "correcthorsebatterystaple",
-			},
-			dbErr: errors.New("no reachable servers"),
+func TestUserAdmDisableExpiredUsers(t *testing.T) {
+	t.Parallel()
 
-			outErr: errors.New("useradm: failed to update user information: no reachable servers"),
+	testCases := map[string]struct {
+		dbErr error
+		err   error
+	}{
+		"ok": {},
+		"error": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to disable expired users: db connection failed"),
 		},
 	}
 
-	for name, tc := range testCases {
-		t.Run(fmt.Sprintf("tc: %s", name), func(t *testing.T) {
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
 
 			ctx := context.Background()
 
 			db := &mstore.DataStore{}
-			db.On("UpdateUser",
-				ContextMatcher(),
-				mock.AnythingOfType("string"),
-				mock.AnythingOfType("*model.UserUpdate")).
+			db.On("DisableExpiredUsers", ContextMatcher(),
+				mock.AnythingOfType("time.Time")).
 				Return(tc.dbErr)
 
 			useradm := NewUserAdm(nil, db, nil, Config{})
 
-			if tc.verifyTenant {
-				id := &identity.Identity{
-					Tenant: "foo",
-				}
-				ctx = identity.WithContext(ctx, id)
+			err := useradm.DisableExpiredUsers(ctx)
 
-				cTenant := &mct.ClientRunner{}
-				cTenant.On("UpdateUser",
-					ContextMatcher(),
-					mock.AnythingOfType("string"),
-					mock.AnythingOfType("string"),
-					mock.AnythingOfType("*tenant.UserUpdate"),
-					&apiclient.HttpApi{}).
-					Return(tc.tenantErr)
-				useradm = useradm.WithTenantVerification(cTenant)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
 			}
+			db.AssertExpectations(t)
+		})
+	}
+}
 
-			err := useradm.UpdateUser(ctx, "123", &tc.inUserUpdate)
+func TestUserAdmDeleteExpiredTokens(t *testing.T) {
+	t.Parallel()
 
-			if tc.outErr != nil {
-				assert.EqualError(t, err, tc.outErr.Error())
+	testCases := map[string]struct {
+		dbErr error
+		err   error
+	}{
+		"ok": {},
+		"error": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to delete expired tokens: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			db := &mstore.DataStore{}
+			db.On("DeleteExpiredTokens", ContextMatcher(),
+				mock.AnythingOfType("time.Time")).
+				Return(3, tc.dbErr)
+
+			registry := metrics.NewRegistry()
+			useradm := NewUserAdm(nil, db, nil, Config{}).WithMetrics(registry)
+
+			err := useradm.DeleteExpiredTokens(ctx)
+
+			var buf bytes.Buffer
+			assert.NoError(t, registry.WriteText(&buf))
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+				assert.NotContains(t, buf.String(), "useradm_expired_tokens_removed_total 3")
 			} else {
 				assert.NoError(t, err)
+				assert.Contains(t, buf.String(), "useradm_expired_tokens_removed_total 3")
 			}
+			db.AssertExpectations(t)
 		})
 	}
 }
 
-func TestUserAdmVerify(t *testing.T) {
+func TestUserAdmReconcilePendingUsers(t *testing.T) {
+	t.Parallel()
+
+	pending := model.PendingUser{
+		UserID:    "1234",
+		TenantID:  "foo",
+		CreatedTs: time.Now().Add(-time.Hour),
+	}
+
 	testCases := map[string]struct {
-		token *jwt.Token
+		dbPending    []model.PendingUser
+		dbPendingErr error
 
-		dbUser    *model.User
-		dbUserErr error
+		dbUser       *model.User
+		dbGetUserErr error
 
-		dbToken    *jwt.Token
-		dbTokenErr error
+		shouldCompensateTenantUser bool
+		tenantDeleteUserErr        error
+
+		shouldCompletePendingUser bool
 
 		err error
 	}{
-		"ok": {
-			token: &jwt.Token{
-				Id: "token-1",
-				Claims: jwt.Claims{
-					Subject: "1234",
-					Issuer:  "mender",
-					User:    true,
-				},
-			},
-			dbUser: &model.User{
-				ID: "1234",
-			},
-			dbToken: &jwt.Token{
-				Id: "token-1",
-				Claims: jwt.Claims{
-					Subject: "1234",
-					Issuer:  "mender",
-					User:    true,
-				},
-			},
-		},
-		"error: invalid token issuer": {
-			token: &jwt.Token{
-				Id: "token-1",
-				Claims: jwt.Claims{
-					Subject: "1234",
-					Issuer:  "foo",
-					User:    true,
-				},
-			},
-			err: ErrUnauthorized,
+		"ok, none": {
+			dbPending: []model.PendingUser{},
 		},
-		"error: not a user token": {
-			token: &jwt.Token{
-				Id: "token-1",
-				Claims: jwt.Claims{
-					Subject: "1234",
-					Issuer:  "mender",
-				},
-			},
-			err: ErrUnauthorized,
+		"ok, user created": {
+			dbPending:                 []model.PendingUser{pending},
+			dbUser:                    &model.User{ID: "1234"},
+			shouldCompletePendingUser: true,
 		},
-		"error: user not found": {
-			token: &jwt.Token{
-				Id: "token-1",
-				Claims: jwt.Claims{
-					Subject: "1234",
-					Issuer:  "mender",
-					User:    true,
-				},
-			},
-			err: ErrUnauthorized,
+		"ok, user rolled back": {
+			dbPending:                  []model.PendingUser{pending},
+			shouldCompensateTenantUser: true,
+			shouldCompletePendingUser:  true,
 		},
-		"error: token not found": {
-			token: &jwt.Token{
-				Id: "token-1",
-				Claims: jwt.Claims{
-					Subject: "1234",
-					Issuer:  "mender",
-					User:    true,
-				},
-			},
-			dbUser: &model.User{
-				ID: "1234",
-			},
-
-			dbToken:    nil,
-			dbTokenErr: nil,
-
-			err: ErrUnauthorized,
+		"ok, user not in tenantadm": {
+			dbPending:                  []model.PendingUser{pending},
+			shouldCompensateTenantUser: true,
+			tenantDeleteUserErr:        ct.ErrUserNotFound,
+			shouldCompletePendingUser:  true,
 		},
-		"error: db user": {
-			token: &jwt.Token{
-				Id: "token-1",
-				Claims: jwt.Claims{
-					Subject: "1234",
-					Issuer:  "mender",
-					User:    true,
-				},
-			},
-			dbUserErr: errors.New("db internal error"),
-
-			err: errors.New("useradm: failed to get user: db internal error"),
+		"error, tenantadm, left for the next run": {
+			dbPending:                  []model.PendingUser{pending},
+			shouldCompensateTenantUser: true,
+			tenantDeleteUserErr:        errors.New("http 500"),
 		},
-		"error: db token": {
-			token: &jwt.Token{
-				Id: "token-1",
-				Claims: jwt.Claims{
-					Subject: "1234",
-					Issuer:  "mender",
-					User:    true,
-				},
-			},
-			dbUser: &model.User{
-				ID: "1234",
-			},
-
-			dbToken:    nil,
-			dbTokenErr: errors.New("db failed"),
-
-			err: errors.New("useradm: failed to get token: db failed"),
+		"error, get user, left for the next run": {
+			dbPending:    []model.PendingUser{pending},
+			dbGetUserErr: errors.New("db connection failed"),
+		},
+		"error, get pending users": {
+			dbPendingErr: errors.New("db connection failed"),
+			err:          errors.New("useradm: failed to get pending users: db connection failed"),
 		},
 	}
 
-	for name, tc := range testCases {
-		t.Run(fmt.Sprintf("test case: %s", name), func(t *testing.T) {
-
-			config := Config{Issuer: "mender"}
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
 
 			ctx := context.Background()
 
 			db := &mstore.DataStore{}
-			db.On("GetUserById", ctx,
-				tc.token.Claims.Subject).Return(tc.dbUser, tc.dbUserErr)
-			db.On("GetTokenById", ctx,
-				tc.token.Id).Return(tc.dbToken, tc.dbTokenErr)
+			db.On("GetPendingUsers", ContextMatcher(),
+				mock.MatchedBy(func(before time.Time) bool {
+					return before.Before(time.Now().Add(-299 * time.Second))
+				})).
+				Return(tc.dbPending, tc.dbPendingErr)
+			db.On("GetUserById",
+				mock.MatchedBy(func(ctx context.Context) bool {
+					id := identity.FromContext(ctx)
+					return id != nil && id.Tenant == "foo"
+				}),
+				"1234").
+				Return(tc.dbUser, tc.dbGetUserErr)
+			db.On("DeletePendingUser", ContextMatcher(), "1234").
+				Return(nil)
+
+			cTenant := &mct.TenantVerifier{}
+			if tc.shouldCompensateTenantUser {
+				cTenant.On("DeleteUser", ContextMatcher(), "foo", "1234").
+					Return(tc.tenantDeleteUserErr)
+			}
 
-			useradm := NewUserAdm(nil, db, nil, config)
+			useradm := NewUserAdm(nil, db, nil, Config{PendingUsersTimeout: 300}).
+				WithTenantVerification(cTenant)
 
-			err := useradm.Verify(ctx, tc.token)
+			err := useradm.ReconcilePendingUsers(ctx)
 
 			if tc.err != nil {
 				assert.EqualError(t, err, tc.err.Error())
 			} else {
 				assert.NoError(t, err)
 			}
+			cTenant.AssertExpectations(t)
+			if tc.shouldCompletePendingUser {
+				db.AssertCalled(t, "DeletePendingUser", ContextMatcher(), "1234")
+			} else {
+				db.AssertNotCalled(t, "DeletePendingUser", ContextMatcher(), "1234")
+			}
 		})
 	}
 }
 
-func TestUserAdmGetUsers(t *testing.T) {
+func TestUserAdmCreateTenant(t *testing.T) {
 	t.Parallel()
-	ts := time.Now()
-	testCases := map[string]struct {
-		dbUsers []model.User
-		dbErr   error
 
-		err error
+	testCases := map[string]struct {
+		tenant    string
+		tenantErr error
+		err       error
 	}{
-		"ok: some users": {
-			dbUsers: []model.User{
-				{
-					ID:        "1",
-					Email:     "foo",
-					CreatedTs: &ts,
-				},
-				{
-					ID:        "2",
-					Email:     "bar",
-					UpdatedTs: &ts,
-				},
-			},
-			dbErr: nil,
-			err:   nil,
-		},
-		"ok: no users": {
-			dbUsers: []model.User{},
-			dbErr:   nil,
-			err:     nil,
+		"ok": {
+			tenant: "foobar",
 		},
-		"error: db": {
-			dbUsers: nil,
-			dbErr:   errors.New("db connection failed"),
-			err:     errors.New("useradm: failed to get users: db connection failed"),
+		"error": {
+			tenant:    "1234",
+			tenantErr: errors.New("migration failed"),
+			err:       errors.New("failed to apply migrations for tenant 1234: migration failed"),
 		},
 	}
 
-	for name, tc := range testCases {
+	for name := range testCases {
+		tc := testCases[name]
 		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
 
 			t.Logf("test case: %s", name)
 
 			ctx := context.Background()
 
-			db := &mstore.DataStore{}
-			db.On("GetUsers", ctx).Return(tc.dbUsers, tc.dbErr)
-
-			useradm := NewUserAdm(nil, db, nil, Config{})
+			tenantDb := &mstore.TenantDataKeeper{}
+			tenantDb.On("TenantExists", ContextMatcher(), tc.tenant).Return(false, nil)
+			tenantDb.On("MigrateTenant", ContextMatcher(), tc.tenant).Return(tc.tenantErr)
 
-			users, err := useradm.GetUsers(ctx)
+			useradm := NewUserAdm(nil, nil, tenantDb, Config{})
 
+			err := useradm.CreateTenant(ctx, model.NewTenant{ID: tc.tenant})
 			if tc.err != nil {
 				assert.EqualError(t, err, tc.err.Error())
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tc.dbUsers, users)
 			}
 		})
 	}
 }
 
-func TestUserAdmGetUser(t *testing.T) {
+func TestUserAdmDeleteTenant(t *testing.T) {
 	t.Parallel()
 
-	ts := time.Now()
-
 	testCases := map[string]struct {
-		dbUser *model.User
-		dbErr  error
+		tenant    string
+		tenantErr error
+		err       error
+	}{
+		"ok": {
+			tenant: "foobar",
+		},
+		"error": {
+			tenant:    "1234",
+			tenantErr: errors.New("db connection failed"),
+			err:       errors.New("failed to delete data of tenant 1234: db connection failed"),
+		},
+	}
 
-		err error
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			tenantDb := &mstore.TenantDataKeeper{}
+			tenantDb.On("DeleteTenant", ContextMatcher(), tc.tenant).Return(tc.tenantErr)
+
+			useradm := NewUserAdm(nil, nil, tenantDb, Config{})
+
+			err := useradm.DeleteTenant(ctx, tc.tenant)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			tenantDb.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserAdmGetTenantMigrationStatus(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		tenant    string
+		status    *model.MigrationStatus
+		tenantErr error
+		err       error
 	}{
-		"ok 1": {
-			dbUser: &model.User{
-				ID:        "1",
-				Email:     "foo",
-				UpdatedTs: &ts,
-				CreatedTs: &ts,
+		"ok": {
+			tenant: "foobar",
+			status: &model.MigrationStatus{
+				TenantID: "foobar",
+				Version:  "0.1.0",
+				Target:   "1.0.0",
+				Steps: []model.MigrationStep{
+					{Version: "0.1.0", Description: "initial schema"},
+				},
 			},
-			dbErr: nil,
-			err:   nil,
-		},
-		"ok: no user": {
-			dbUser: nil,
-			dbErr:  nil,
-			err:    nil,
 		},
-		"error: generic db error": {
-			dbUser: nil,
-			dbErr:  errors.New("db connection failed"),
-			err:    errors.New("useradm: failed to get user: db connection failed"),
+		"error": {
+			tenant:    "1234",
+			tenantErr: errors.New("db connection failed"),
+			err:       errors.New("failed to get migration status of tenant 1234: db connection failed"),
 		},
 	}
 
-	for name, tc := range testCases {
+	for name := range testCases {
+		tc := testCases[name]
 		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
 
-			t.Logf("test case: %s", name)
-
 			ctx := context.Background()
 
-			db := &mstore.DataStore{}
-			db.On("GetUserById", ctx, "foo").Return(tc.dbUser, tc.dbErr)
-
-			useradm := NewUserAdm(nil, db, nil, Config{})
+			tenantDb := &mstore.TenantDataKeeper{}
+			tenantDb.On("GetMigrationStatus", ContextMatcher(), tc.tenant).
+				Return(tc.status, tc.tenantErr)
 
-			user, err := useradm.GetUser(ctx, "foo")
+			useradm := NewUserAdm(nil, nil, tenantDb, Config{})
 
+			status, err := useradm.GetTenantMigrationStatus(ctx, tc.tenant)
 			if tc.err != nil {
 				assert.EqualError(t, err, tc.err.Error())
+				assert.Nil(t, status)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tc.dbUser, user)
+				assert.Equal(t, tc.status, status)
 			}
+			tenantDb.AssertExpectations(t)
 		})
 	}
 }
 
-func TestUserAdmDeleteUser(t *testing.T) {
+func TestUserAdmGetMigrationProgress(t *testing.T) {
 	t.Parallel()
 
 	testCases := map[string]struct {
-		verifyTenant bool
-		tenantErr    error
-		dbErr        error
-		err          error
+		progress  *model.MigrationProgress
+		tenantErr error
+		err       error
 	}{
 		"ok": {
-			dbErr: nil,
-			err:   nil,
+			progress: &model.MigrationProgress{
+				Version:  "1.0.0",
+				Total:    10,
+				Migrated: 3,
+			},
 		},
-		"ok, multitenant": {
-			verifyTenant: true,
-			dbErr:        nil,
-			err:          nil,
+		"ok, no migration": {},
+		"error": {
+			tenantErr: errors.New("db connection failed"),
+			err:       errors.New("failed to get migration progress: db connection failed"),
 		},
-		"multitenant, tenantadm error": {
-			verifyTenant: true,
-			tenantErr:    errors.New("http 500"),
-			dbErr:        nil,
-			err:          errors.New("useradm: failed to delete user in tenantadm: http 500"),
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+
+			tenantDb := &mstore.TenantDataKeeper{}
+			tenantDb.On("GetMigrationProgress", ContextMatcher()).
+				Return(tc.progress, tc.tenantErr)
+
+			useradm := NewUserAdm(nil, nil, tenantDb, Config{})
+
+			progress, err := useradm.GetMigrationProgress(ctx)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.progress, progress)
+			tenantDb.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserAdmGetJobStatuses(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		statuses []model.JobStatus
+		dbErr    error
+		err      error
+	}{
+		"ok": {
+			statuses: []model.JobStatus{
+				{Name: "delete expired tokens", Runs: 3, Failures: 1},
+			},
 		},
 		"error": {
 			dbErr: errors.New("db connection failed"),
-			err:   errors.New("useradm: failed to delete user: db connection failed"),
+			err:   errors.New("useradm: failed to get job statuses: db connection failed"),
 		},
 	}
 
@@ -979,55 +3490,107 @@ func TestUserAdmDeleteUser(t *testing.T) {
 		tc := testCases[name]
 		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
 
-			t.Logf("test case: %s", name)
-
 			ctx := context.Background()
 
 			db := &mstore.DataStore{}
-			db.On("DeleteUser", ContextMatcher(), "foo").Return(tc.dbErr)
+			db.On("GetJobStatuses", ContextMatcher()).
+				Return(tc.statuses, tc.dbErr)
 
 			useradm := NewUserAdm(nil, db, nil, Config{})
-			if tc.verifyTenant {
-				id := &identity.Identity{
-					Tenant: "bar",
-				}
-				ctx = identity.WithContext(ctx, id)
 
-				cTenant := &mct.ClientRunner{}
-				cTenant.On("DeleteUser",
-					ContextMatcher(),
-					"bar", "foo",
-					&apiclient.HttpApi{}).
-					Return(tc.tenantErr)
-				useradm = useradm.WithTenantVerification(cTenant)
+			statuses, err := useradm.GetJobStatuses(ctx)
+			if tc.err != nil {
+				assert.EqualError(t, err, tc.err.Error())
+			} else {
+				assert.NoError(t, err)
 			}
+			assert.Equal(t, tc.statuses, statuses)
+			db.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUserAdmSetLimit(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		dbErr error
+		err   error
+	}{
+		"ok": {},
+		"error": {
+			dbErr: errors.New("db connection failed"),
+			err:   errors.New("useradm: failed to set limit: db connection failed"),
+		},
+	}
+
+	for name := range testCases {
+		tc := testCases[name]
+		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
+
+			ctx := context.Background()
+			limit := model.Limit{Name: model.LimitMaxUsers, Value: 10}
+
+			db := &mstore.DataStore{}
+			db.On("SetLimit", ContextMatcher(), &limit).Return(tc.dbErr)
 
-			err := useradm.DeleteUser(ctx, "foo")
+			useradm := NewUserAdm(nil, db, nil, Config{})
 
+			err := useradm.SetLimit(ctx, limit)
 			if tc.err != nil {
 				assert.EqualError(t, err, tc.err.Error())
 			} else {
 				assert.NoError(t, err)
 			}
+			db.AssertExpectations(t)
 		})
 	}
 }
 
-func TestUserAdmCreateTenant(t *testing.T) {
+func TestUserAdmGetLimitUsage(t *testing.T) {
 	t.Parallel()
 
 	testCases := map[string]struct {
-		tenant    string
-		tenantErr error
-		err       error
+		name string
+
+		dbLimit    *model.Limit
+		dbLimitErr error
+		dbCount    int
+		dbCountErr error
+
+		usage *model.LimitUsage
+		err   error
 	}{
 		"ok": {
-			tenant: "foobar",
+			name:    model.LimitMaxUsers,
+			dbLimit: &model.Limit{Name: model.LimitMaxUsers, Value: 10},
+			dbCount: 4,
+			usage: &model.LimitUsage{
+				Limit: model.Limit{Name: model.LimitMaxUsers, Value: 10},
+				Usage: 4,
+			},
 		},
-		"error": {
-			tenant:    "1234",
-			tenantErr: errors.New("migration failed"),
-			err:       errors.New("failed to apply migrations for tenant 1234: migration failed"),
+		"ok, not set": {
+			name:    model.LimitMaxUsers,
+			dbCount: 4,
+			usage: &model.LimitUsage{
+				Limit: model.Limit{Name: model.LimitMaxUsers},
+				Usage: 4,
+			},
+		},
+		"error: unknown limit": {
+			name: "max_devices",
+			err:  model.ErrUnknownLimit,
+		},
+		"error: get limit": {
+			name:       model.LimitMaxUsers,
+			dbLimitErr: errors.New("db connection failed"),
+			err:        errors.New("useradm: failed to get limit: db connection failed"),
+		},
+		"error: count users": {
+			name:       model.LimitMaxUsers,
+			dbCountErr: errors.New("db connection failed"),
+			err:        errors.New("useradm: failed to count users: db connection failed"),
 		},
 	}
 
@@ -1035,20 +3598,22 @@ func TestUserAdmCreateTenant(t *testing.T) {
 		tc := testCases[name]
 		t.Run(fmt.Sprintf("tc %s", name), func(t *testing.T) {
 
-			t.Logf("test case: %s", name)
-
 			ctx := context.Background()
 
-			tenantDb := &mstore.TenantDataKeeper{}
-			tenantDb.On("MigrateTenant", ContextMatcher(), tc.tenant).Return(tc.tenantErr)
+			db := &mstore.DataStore{}
+			db.On("GetLimit", ContextMatcher(), tc.name).
+				Return(tc.dbLimit, tc.dbLimitErr)
+			db.On("CountUsers", ContextMatcher(), model.UserFilter{}).
+				Return(tc.dbCount, tc.dbCountErr)
 
-			useradm := NewUserAdm(nil, nil, tenantDb, Config{})
+			useradm := NewUserAdm(nil, db, nil, Config{})
 
-			err := useradm.CreateTenant(ctx, model.NewTenant{ID: tc.tenant})
+			usage, err := useradm.GetLimitUsage(ctx, tc.name)
 			if tc.err != nil {
 				assert.EqualError(t, err, tc.err.Error())
 			} else {
 				assert.NoError(t, err)
+				assert.Equal(t, tc.usage, usage)
 			}
 		})
 	}
@@ -1124,7 +3689,7 @@ func TestUserAdmSetPassword(t *testing.T) {
 				Return(tc.dbUpdateErr)
 		}
 		useradm := NewUserAdm(nil, db, nil, Config{})
-		cTenant := &mct.ClientRunner{}
+		cTenant := &mct.TenantVerifier{}
 
 		err := useradm.SetPassword(ctx, model.UserUpdate{Email: tc.inUser.Email})
 